@@ -0,0 +1,138 @@
+package memcached
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencyWindow is the number of recent latencies tracked for each server.
+	latencyWindow = 256
+	// latencyMinSamples is the number of latencies observed before the adaptive
+	// timeout takes effect, the static read timeout is used until then.
+	latencyMinSamples = 32
+	// latencyRecomputeEvery is the number of latencies observed between the
+	// recomputations of the adaptive timeout.
+	latencyRecomputeEvery = 16
+	// latencyPercentile is the percentile of latencies the timeout is based on.
+	latencyPercentile = 0.99
+)
+
+// adaptiveTimeout computes the read timeout of each memcached server from the
+// latencies of its recent requests, the timeout is the p99 latency multiplied
+// by multiplier, bounded by [min, max].
+type adaptiveTimeout struct {
+	multiplier float64
+	min, max   time.Duration
+
+	mu sync.RWMutex // guards trackers
+	// trackers holds the latency tracker of each memcached server, it's replaced
+	// when the servers are changed.
+	trackers map[*Addr]*latencyTracker
+}
+
+func newAdaptiveTimeout(addrs []*Addr, multiplier float64, minTimeout, maxTimeout time.Duration) *adaptiveTimeout {
+	trackers := make(map[*Addr]*latencyTracker, len(addrs))
+	for _, addr := range addrs {
+		trackers[addr] = &latencyTracker{}
+	}
+
+	return &adaptiveTimeout{
+		multiplier: multiplier,
+		min:        minTimeout,
+		max:        maxTimeout,
+		trackers:   trackers,
+	}
+}
+
+// update tracks the latencies of addrs, the trackers of the servers kept are
+// carried over.
+func (a *adaptiveTimeout) update(addrs []*Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	trackers := make(map[*Addr]*latencyTracker, len(addrs))
+	for _, addr := range addrs {
+		t, ok := a.trackers[addr]
+		if !ok {
+			t = &latencyTracker{}
+		}
+		trackers[addr] = t
+	}
+	a.trackers = trackers
+}
+
+// tracker returns the latency tracker of the server at addr.
+func (a *adaptiveTimeout) tracker(addr *Addr) (*latencyTracker, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	t, ok := a.trackers[addr]
+	return t, ok
+}
+
+// observe records the latency of a request answered by the server at addr.
+func (a *adaptiveTimeout) observe(addr *Addr, latency time.Duration) {
+	t, ok := a.tracker(addr)
+	if !ok {
+		return
+	}
+
+	p, ok := t.observe(latency)
+	if !ok {
+		return
+	}
+
+	timeout := time.Duration(float64(p) * a.multiplier)
+	if timeout < a.min {
+		timeout = a.min
+	}
+	if timeout > a.max {
+		timeout = a.max
+	}
+	t.timeout.Store(int64(timeout))
+}
+
+// timeout returns the read timeout of the server at addr, fallback is returned
+// if there are not enough latencies observed.
+func (a *adaptiveTimeout) timeout(addr *Addr, fallback time.Duration) time.Duration {
+	if t, ok := a.tracker(addr); ok {
+		if timeout := t.timeout.Load(); timeout > 0 {
+			return time.Duration(timeout)
+		}
+	}
+
+	return fallback
+}
+
+// latencyTracker tracks the recent latencies of a memcached server.
+type latencyTracker struct {
+	mu      sync.Mutex // guards following
+	samples [latencyWindow]time.Duration
+	count   int
+
+	// timeout is the computed read timeout, 0 means not computed yet.
+	timeout atomic.Int64
+}
+
+// observe records the latency, and returns the percentile of recent latencies
+// if it's time to recompute the timeout.
+func (t *latencyTracker) observe(latency time.Duration) (time.Duration, bool) {
+	t.mu.Lock()
+	t.samples[t.count%latencyWindow] = latency
+	t.count++
+	if t.count < latencyMinSamples || t.count%latencyRecomputeEvery != 0 {
+		t.mu.Unlock()
+		return 0, false
+	}
+
+	n := min(t.count, latencyWindow)
+	sorted := make([]time.Duration, n)
+	copy(sorted, t.samples[:n])
+	t.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(float64(n-1)*latencyPercentile)], true
+}
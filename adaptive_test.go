@@ -0,0 +1,105 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_adaptiveTimeout(t *testing.T) {
+	addr := NewAddr("tcp", "localhost:11211", 0)
+
+	tests := []struct {
+		name      string
+		latencies func(i int) time.Duration
+		count     int
+		want      time.Duration
+	}{
+		{
+			name:      "not enough samples",
+			latencies: func(int) time.Duration { return time.Millisecond },
+			count:     latencyMinSamples - 1,
+			want:      time.Second, // the fallback
+		},
+		{
+			name:      "p99 multiplied",
+			latencies: func(int) time.Duration { return 10 * time.Millisecond },
+			count:     latencyWindow,
+			want:      30 * time.Millisecond,
+		},
+		{
+			name: "p99 of window",
+			latencies: func(i int) time.Duration {
+				// the outliers of the first window are evicted.
+				if i < latencyWindow {
+					return 100 * time.Millisecond
+				}
+				return 20 * time.Millisecond
+			},
+			count: 2 * latencyWindow,
+			want:  60 * time.Millisecond,
+		},
+		{
+			name:      "bounded by min",
+			latencies: func(int) time.Duration { return time.Microsecond },
+			count:     latencyWindow,
+			want:      5 * time.Millisecond,
+		},
+		{
+			name:      "bounded by max",
+			latencies: func(int) time.Duration { return time.Second },
+			count:     latencyWindow,
+			want:      500 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAdaptiveTimeout([]*Addr{addr}, 3, 5*time.Millisecond, 500*time.Millisecond)
+			for i := 0; i < tt.count; i++ {
+				a.observe(addr, tt.latencies(i))
+			}
+
+			assert.Equal(t, tt.want, a.timeout(addr, time.Second))
+		})
+	}
+}
+
+func Test_client_adaptiveReadTimeout(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetLatency(5 * time.Millisecond)
+
+	c, err := New(srv.Addr(), WithReadTimeout(5*time.Second),
+		WithAdaptiveReadTimeout(4, 50*time.Millisecond, 200*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+	assert.Equal(t, 5*time.Second, c.PoolStats()[srv.Addr()].ReadTimeout)
+
+	for i := 0; i < latencyMinSamples; i++ {
+		_, err := c.Get(ctx, "foo")
+		require.NoError(t, err)
+	}
+	timeout := c.PoolStats()[srv.Addr()].ReadTimeout
+	assert.GreaterOrEqual(t, timeout, 50*time.Millisecond)
+	assert.LessOrEqual(t, timeout, 200*time.Millisecond)
+
+	// the degraded server is detected by the adaptive timeout rather than 5s.
+	srv.SetLatency(time.Second)
+	start := time.Now()
+	_, err = c.Get(ctx, "foo")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 800*time.Millisecond)
+
+	// the timeouts are observed at the deadline, so that the timeout grows.
+	for i := 1; i < latencyRecomputeEvery; i++ {
+		_, err = c.Get(ctx, "foo")
+		require.Error(t, err)
+	}
+	assert.Equal(t, 200*time.Millisecond, c.PoolStats()[srv.Addr()].ReadTimeout)
+}
@@ -0,0 +1,239 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConnCommander runs the commands over the connection checked out by WithConn,
+// in the order they are called. The keys of the commands must be on the server
+// of the connection, otherwise ErrInvalidArgument is returned.
+type ConnCommander interface {
+	// Addr returns the address of the memcached server of the connection.
+	Addr() *Addr
+
+	Set(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error
+	Add(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error
+	Replace(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error
+	Append(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error
+	Prepend(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error
+	Cas(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64) error
+
+	Get(ctx context.Context, key string) (*Item, error)
+	Gets(ctx context.Context, keys ...string) ([]*Item, error)
+	GetAndTouch(ctx context.Context, expiry time.Duration, key string) (*Item, error)
+
+	Delete(ctx context.Context, key string) error
+	DeleteCAS(ctx context.Context, key string, cas uint64) error
+	Incr(ctx context.Context, key string, delta uint64) (uint64, error)
+	Decr(ctx context.Context, key string, delta uint64) (uint64, error)
+	Touch(ctx context.Context, key string, expiry time.Duration) error
+
+	MetaSet(ctx context.Context, key, value []byte, options ...MetaSetOption) (*MetaItem, error)
+	MetaGet(ctx context.Context, key []byte, options ...MetaGetOption) (*MetaItem, error)
+	MetaDelete(ctx context.Context, key []byte, options ...MetaDeleteOption) (*MetaItem, error)
+	MetaArithmetic(ctx context.Context, key []byte, delta uint64, options ...MetaArithmeticOption) (*MetaItem, error)
+	MetaNoOp(ctx context.Context) error
+}
+
+var _ ConnCommander = (*connCommander)(nil)
+
+// errConnReleased is returned when the ConnCommander is used after WithConn returns.
+var errConnReleased = errors.New("connection of WithConn has been released")
+
+// pinnedConnKey is the context key of the pinnedConn.
+type pinnedConnKey struct{}
+
+// pinnedConn is the connection checked out by WithConn, the requests whose context
+// carries it are sent over it rather than the connection pool.
+type pinnedConn struct {
+	addr *Addr
+	// dedicated means the connection is dialed for WithConn rather than taken
+	// from the pool, e.g. in the multiplexing mode, it's closed after used.
+	dedicated bool
+
+	mu       sync.Mutex // guards following, and serializes the requests
+	cn       memcachedConn
+	broken   bool
+	released bool
+}
+
+// pinnedConnFrom returns the pinnedConn carried by the context, or nil.
+func pinnedConnFrom(ctx context.Context) *pinnedConn {
+	pin, _ := ctx.Value(pinnedConnKey{}).(*pinnedConn)
+	return pin
+}
+
+// WithConn checks out a connection to the memcached server of the key, and runs
+// fn with the commands over it, the connection is returned to the pool after fn
+// returns. The commands are sent in order over the same connection without picking
+// the server again, e.g. a gets followed by a cas, or the commands relying on the
+// state of the connection kept by the server or a proxy:
+//
+//	err := client.WithConn(ctx, "foo", func(cc memcached.ConnCommander) error {
+//		items, err := cc.Gets(ctx, "foo")
+//		if err != nil {
+//			return err
+//		}
+//		return cc.Cas(ctx, "foo", newValue(items[0].Value), 0, 0, items[0].CAS)
+//	})
+//
+// The error returned by fn is returned as is. In the multiplexing mode a connection
+// is dialed for it and closed after used.
+func (c *client) WithConn(ctx context.Context, key string, fn func(cc ConnCommander) error) error {
+	if err := validateKeyAndValue([]byte(key), nil); err != nil {
+		return err
+	}
+
+	addr, err := c.pick(ctx, nil, []byte(key))
+	if err != nil {
+		return errors.Wrap(err, "pick node failed")
+	}
+
+	pin := &pinnedConn{addr: addr, dedicated: c.useMultiplexer(addr)}
+	if pin.dedicated {
+		pin.cn, err = c.dialConn(ctx, addr)
+	} else {
+		pin.cn, err = c.getConn(ctx, addr)
+	}
+	if err != nil {
+		return newCommandError(addr, nil, []byte(key), errors.Wrap(err, "alloc connection failed"))
+	}
+	defer c.releasePinnedConn(pin)
+
+	return fn(&connCommander{client: c, pin: pin})
+}
+
+// releasePinnedConn returns the connection of WithConn to the pool, or closes it
+// if it's dedicated or broken.
+func (c *client) releasePinnedConn(pin *pinnedConn) {
+	pin.mu.Lock()
+	defer pin.mu.Unlock()
+
+	pin.released = true
+	switch {
+	case pin.dedicated:
+		_ = pin.cn.Close()
+	case pin.broken:
+		pin.cn.getConnPool().discard(pin.cn)
+	default:
+		_ = pin.cn.release()
+	}
+}
+
+// dispatchPinned sends the request over the connection of WithConn.
+func (c *client) dispatchPinned(ctx context.Context, pin *pinnedConn, addr *Addr, req *request, resp *response) error {
+	if addr != pin.addr {
+		return errors.Wrapf(ErrInvalidArgument, "key is not on the server %s of WithConn", pin.addr.Address)
+	}
+
+	pin.mu.Lock()
+	defer pin.mu.Unlock()
+
+	if pin.released {
+		return errConnReleased
+	}
+	if pin.broken {
+		return errors.New("connection of WithConn is broken")
+	}
+
+	broken, err := c.roundTrip(ctx, addr, pin.cn, req, resp)
+	pin.broken = broken
+	return err
+}
+
+// connCommander implements ConnCommander by the client with the context
+// carrying the pinned connection.
+type connCommander struct {
+	client *client
+	pin    *pinnedConn
+}
+
+func (cc *connCommander) pinned(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pinnedConnKey{}, cc.pin)
+}
+
+func (cc *connCommander) Addr() *Addr { return cc.pin.addr }
+
+func (cc *connCommander) Set(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return cc.client.Set(cc.pinned(ctx), key, value, flag, expiry)
+}
+
+func (cc *connCommander) Add(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return cc.client.Add(cc.pinned(ctx), key, value, flag, expiry)
+}
+
+func (cc *connCommander) Replace(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return cc.client.Replace(cc.pinned(ctx), key, value, flag, expiry)
+}
+
+func (cc *connCommander) Append(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return cc.client.Append(cc.pinned(ctx), key, value, flag, expiry)
+}
+
+func (cc *connCommander) Prepend(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return cc.client.Prepend(cc.pinned(ctx), key, value, flag, expiry)
+}
+
+func (cc *connCommander) Cas(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64,
+) error {
+	return cc.client.Cas(cc.pinned(ctx), key, value, flag, expiry, cas)
+}
+
+func (cc *connCommander) Get(ctx context.Context, key string) (*Item, error) {
+	return cc.client.Get(cc.pinned(ctx), key)
+}
+
+func (cc *connCommander) Gets(ctx context.Context, keys ...string) ([]*Item, error) {
+	return cc.client.Gets(cc.pinned(ctx), keys...)
+}
+
+func (cc *connCommander) GetAndTouch(ctx context.Context, expiry time.Duration, key string) (*Item, error) {
+	return cc.client.GetAndTouch(cc.pinned(ctx), expiry, key)
+}
+
+func (cc *connCommander) Delete(ctx context.Context, key string) error {
+	return cc.client.Delete(cc.pinned(ctx), key)
+}
+
+func (cc *connCommander) DeleteCAS(ctx context.Context, key string, cas uint64) error {
+	return cc.client.DeleteCAS(cc.pinned(ctx), key, cas)
+}
+
+func (cc *connCommander) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return cc.client.Incr(cc.pinned(ctx), key, delta)
+}
+
+func (cc *connCommander) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return cc.client.Decr(cc.pinned(ctx), key, delta)
+}
+
+func (cc *connCommander) Touch(ctx context.Context, key string, expiry time.Duration) error {
+	return cc.client.Touch(cc.pinned(ctx), key, expiry)
+}
+
+func (cc *connCommander) MetaSet(ctx context.Context, key, value []byte, options ...MetaSetOption) (*MetaItem, error) {
+	return cc.client.MetaSet(cc.pinned(ctx), key, value, options...)
+}
+
+func (cc *connCommander) MetaGet(ctx context.Context, key []byte, options ...MetaGetOption) (*MetaItem, error) {
+	return cc.client.MetaGet(cc.pinned(ctx), key, options...)
+}
+
+func (cc *connCommander) MetaDelete(ctx context.Context, key []byte, options ...MetaDeleteOption) (*MetaItem, error) {
+	return cc.client.MetaDelete(cc.pinned(ctx), key, options...)
+}
+
+func (cc *connCommander) MetaArithmetic(
+	ctx context.Context, key []byte, delta uint64, options ...MetaArithmeticOption,
+) (*MetaItem, error) {
+	return cc.client.MetaArithmetic(cc.pinned(ctx), key, delta, options...)
+}
+
+func (cc *connCommander) MetaNoOp(ctx context.Context) error {
+	return cc.client.MetaNoOp(cc.pinned(ctx))
+}
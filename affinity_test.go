@@ -0,0 +1,90 @@
+package memcached
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_WithConn(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "counter", []byte("0"), 0, 0))
+
+	// the gets and cas of each goroutine run over one connection.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := c.WithConn(ctx, "counter", func(cc ConnCommander) error {
+					items, err := cc.Gets(ctx, "counter")
+					if err != nil {
+						return err
+					}
+					n, _ := strconv.Atoi(string(items[0].Value))
+					if err = cc.MetaNoOp(ctx); err != nil {
+						return err
+					}
+					return cc.Cas(ctx, "counter", []byte(strconv.Itoa(n+1)), 0, 0, items[0].CAS)
+				})
+				if !assert.True(t, err == nil || errors.Is(err, ErrExists), "%v", err) || err == nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	item, err := c.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, "4", string(item.Value))
+	assert.LessOrEqual(t, srv.Accepted(), 4)
+
+	// the connection could not be used after released.
+	var leaked ConnCommander
+	require.NoError(t, c.WithConn(ctx, "counter", func(cc ConnCommander) error {
+		leaked = cc
+		return nil
+	}))
+	_, err = leaked.Get(ctx, "counter")
+	assert.ErrorIs(t, err, errConnReleased)
+}
+
+func Test_client_WithConn_otherServer(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	err = c.WithConn(ctx, "foo", func(cc ConnCommander) error {
+		for i := 0; i < 100; i++ {
+			key := "key:" + strconv.Itoa(i)
+			addr, err := c.(*client).pick(context.Background(), nil, []byte(key))
+			require.NoError(t, err)
+
+			err = cc.Set(ctx, key, []byte("bar"), 0, 0)
+			if addr == cc.Addr() {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidArgument)
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = c.WithConn(ctx, "", func(ConnCommander) error { return nil })
+	assert.Error(t, err)
+}
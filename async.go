@@ -0,0 +1,425 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultAsyncQueueSize is the number of commands which could be queued for
+	// one memcached server before the callers are blocked.
+	defaultAsyncQueueSize = 1024
+	// defaultAsyncBatchSize is the max number of commands pipelined in one round trip.
+	defaultAsyncBatchSize = 128
+)
+
+// ErrAsyncClosed is returned by the Future of a command which is enqueued after
+// the Async is closed.
+var ErrAsyncClosed = errors.New("async closed")
+
+// AsyncOption configures the Async.
+type AsyncOption func(*Async)
+
+// AsyncQueueSize sets the number of commands which could be queued for each
+// memcached server, the callers are blocked when the queue is full. The default
+// is 1024.
+func AsyncQueueSize(n int) AsyncOption {
+	return func(a *Async) {
+		if n > 0 {
+			a.queueSize = n
+		}
+	}
+}
+
+// AsyncBatchSize sets the max number of queued commands which are pipelined to
+// one memcached server in one round trip. The default is 128.
+func AsyncBatchSize(n int) AsyncOption {
+	return func(a *Async) {
+		if n > 0 {
+			a.batchSize = n
+		}
+	}
+}
+
+// Async enqueues the commands and returns their Futures immediately, so that the
+// callers could overlap many requests without spawning a goroutine for each of
+// them. Each memcached server has one worker goroutine, which drains the queued
+// commands and pipelines them as meta commands in one round trip. None of them is
+// quiet, so that each one replies, and the replies, including the error lines
+// without opaque tokens, are attributed to the commands by their positions.
+//
+// The commands are built on the meta protocol, so that the memcached server must
+// be 1.6.0 or later. The context of each command is checked before it's sent,
+// and the round trip itself is bounded by the read and write timeouts of the
+// client. Close stops the workers once the Async is no longer used, it's called
+// by the Close of the client as well.
+type Async struct {
+	client    *client
+	queueSize int
+	batchSize int
+
+	mu     sync.RWMutex // guards closed and queues
+	closed bool
+	queues map[*Addr]chan *asyncOp
+	// senders tracks the enqueues in flight, the queues are closed after them.
+	senders sync.WaitGroup
+	wg      sync.WaitGroup
+
+	// mirror is the Async the writes are mirrored to, and onMirrorError is called
+	// with their errors, see MigrationClient.Async.
+	mirror        *Async
+	onMirrorError func(key string, err error)
+}
+
+// Async returns the Async of the client, see Async for more details.
+func (c *client) Async(opts ...AsyncOption) *Async {
+	a := &Async{
+		client:    c,
+		queueSize: defaultAsyncQueueSize,
+		batchSize: defaultAsyncBatchSize,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	addrs := c.topology().addrs
+	a.queues = make(map[*Addr]chan *asyncOp, len(addrs))
+	for _, addr := range addrs {
+		a.startWorker(addr)
+	}
+
+	c.mu.Lock()
+	c.asyncs[a] = struct{}{}
+	c.mu.Unlock()
+
+	return a
+}
+
+// startWorker creates the queue of the memcached server at addr and starts its
+// worker, it's called with mu held unless the Async is being created.
+func (a *Async) startWorker(addr *Addr) chan *asyncOp {
+	queue := make(chan *asyncOp, a.queueSize)
+	a.queues[addr] = queue
+
+	a.wg.Add(1)
+	go a.work(addr, queue)
+	return queue
+}
+
+// queue returns the queue of the memcached server at addr, the worker of the
+// server added after the Async is created is started on demand, see UpdateAddrs.
+// The caller must call senders.Done once it's done with the queue, which is not
+// closed until then. It returns false if the Async is closed.
+func (a *Async) queue(addr *Addr) (chan *asyncOp, bool) {
+	a.mu.RLock()
+	queue, ok := a.queues[addr]
+	if ok && !a.closed {
+		a.senders.Add(1)
+	}
+	closed := a.closed
+	a.mu.RUnlock()
+	if closed {
+		return nil, false
+	}
+	if ok {
+		return queue, true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil, false
+	}
+	if queue, ok = a.queues[addr]; !ok {
+		queue = a.startWorker(addr)
+	}
+	a.senders.Add(1)
+
+	return queue, true
+}
+
+// Get enqueues the retrieval of the key, the Future returns ErrNotFound if the
+// key does not exist.
+func (a *Async) Get(ctx context.Context, key string) *Future {
+	return a.enqueue(ctx, "mg", &asyncOp{key: key, withValue: true,
+		build: func(opaque uint64) (*request, *response, error) {
+			req, resp := buildMetaGetCommand([]byte(key), &metaGetFlags{v: true, f: true, c: true, O: opaque})
+			return req, resp, nil
+		},
+	})
+}
+
+// Set enqueues the storage of the key, the Future returns no item.
+func (a *Async) Set(ctx context.Context, key string, value []byte, flags uint32, expiry time.Duration) *Future {
+	a.mirrorWrite(key, func(mirror *Async) *Future { return mirror.Set(ctx, key, value, flags, expiry) })
+	return a.enqueue(ctx, "ms", &asyncOp{key: key,
+		build: func(opaque uint64) (*request, *response, error) {
+			return buildMetaSetCommand([]byte(key), value, &metaSetFlags{
+				F: flags, T: metaTTL(FromDuration(expiry)), O: opaque,
+			}, a.client.options.codec)
+		},
+	})
+}
+
+// Delete enqueues the deletion of the key, the Future returns ErrNotFound if
+// the key does not exist.
+func (a *Async) Delete(ctx context.Context, key string) *Future {
+	a.mirrorWrite(key, func(mirror *Async) *Future { return mirror.Delete(ctx, key) })
+	return a.enqueue(ctx, "md", &asyncOp{key: key,
+		build: func(opaque uint64) (*request, *response, error) {
+			req, resp := buildMetaDeleteCommand([]byte(key), &metaDeleteFlags{O: opaque})
+			return req, resp, nil
+		},
+	})
+}
+
+// Touch enqueues the update of the expiry of the key, the Future returns
+// ErrNotFound if the key does not exist.
+func (a *Async) Touch(ctx context.Context, key string, expiry time.Duration) *Future {
+	a.mirrorWrite(key, func(mirror *Async) *Future { return mirror.Touch(ctx, key, expiry) })
+	return a.enqueue(ctx, "mg", &asyncOp{key: key,
+		build: func(opaque uint64) (*request, *response, error) {
+			req, resp := buildMetaTouchCommand([]byte(key), metaTTL(FromDuration(expiry)), opaque, false)
+			return req, resp, nil
+		},
+	})
+}
+
+// mirrorWrite enqueues the write to the mirror if any, the result is reported by
+// onMirrorError rather than returned.
+func (a *Async) mirrorWrite(key string, write func(mirror *Async) *Future) {
+	if a.mirror == nil {
+		return
+	}
+
+	write(a.mirror).OnComplete(func(_ *Item, err error) { a.onMirrorError(key, err) })
+}
+
+// Close stops accepting commands, and waits for the queued ones to be done.
+func (a *Async) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.mu.Unlock()
+
+	// the enqueues in flight are done before the queues are closed, the workers
+	// keep draining the queues so that they're not blocked.
+	a.senders.Wait()
+	for _, queue := range a.queues {
+		close(queue)
+	}
+	a.wg.Wait()
+
+	c := a.client
+	c.mu.Lock()
+	delete(c.asyncs, a)
+	c.mu.Unlock()
+
+	if a.mirror != nil {
+		return a.mirror.Close()
+	}
+	return nil
+}
+
+// asyncOp is a command queued in the Async.
+type asyncOp struct {
+	ctx    context.Context
+	key    string
+	cmd    string
+	build  func(opaque uint64) (*request, *response, error)
+	future *Future
+	// withValue means the command returns the item with its value.
+	withValue bool
+}
+
+// enqueue queues the op to the memcached server of its key, and returns its Future.
+func (a *Async) enqueue(ctx context.Context, command string, op *asyncOp) *Future {
+	f := newFuture()
+	op.ctx, op.cmd, op.future = ctx, command, f
+	key := op.key
+
+	if err := a.client.checkMetaSupported(); err != nil {
+		f.complete(nil, err)
+		return f
+	}
+	if err := validateKeyAndValue([]byte(key), nil); err != nil {
+		f.complete(nil, err)
+		return f
+	}
+
+	addr, err := a.client.pick(ctx, []byte(command), []byte(key))
+	if err != nil {
+		f.complete(nil, errors.Wrap(err, "pick node failed"))
+		return f
+	}
+
+	queue, ok := a.queue(addr)
+	if !ok {
+		f.complete(nil, ErrAsyncClosed)
+		return f
+	}
+	defer a.senders.Done()
+
+	// the send is blocked while the queue is full, mu is not held across it.
+	select {
+	case queue <- op:
+	case <-ctx.Done():
+		f.complete(nil, ctx.Err())
+	}
+
+	return f
+}
+
+// work drains the queue of the memcached server at addr, and pipelines the
+// commands in batches until the queue is closed.
+func (a *Async) work(addr *Addr, queue chan *asyncOp) {
+	defer a.wg.Done()
+
+	batch := make([]*asyncOp, 0, a.batchSize)
+	for op := range queue {
+		batch = append(batch[:0], op)
+
+	drain:
+		for len(batch) < a.batchSize {
+			select {
+			case op, ok := <-queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, op)
+			default:
+				break drain
+			}
+		}
+
+		a.flush(addr, batch)
+	}
+}
+
+// flush pipelines the batch of commands to the memcached server at addr, and
+// completes their Futures. The opaque token of each command is its index in the
+// batch plus one.
+func (a *Async) flush(addr *Addr, batch []*asyncOp) {
+	ops := make([]*asyncOp, 0, len(batch))
+	reqs := make([]*request, 0, len(batch))
+	for _, op := range batch {
+		if err := op.ctx.Err(); err != nil {
+			op.future.complete(nil, err)
+			continue
+		}
+
+		req, resp, err := op.build(uint64(len(ops) + 1))
+		if err != nil {
+			op.future.complete(nil, err)
+			continue
+		}
+		defer releaseReqAndResp(req, resp)
+
+		ops = append(ops, op)
+		reqs = append(reqs, req)
+	}
+	if len(ops) == 0 {
+		return
+	}
+
+	// the commands are sent together, none of the callers owns the round trip.
+	ctx := context.WithoutCancel(ops[0].ctx)
+	replies, err := a.client.dispatchQuietPipeline(ctx, addr, reqs)
+	if err != nil {
+		// the error of the round trip is reported by each command with its key.
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) {
+			err = cmdErr.Err
+		}
+		for _, op := range ops {
+			op.future.complete(nil, newCommandError(addr, []byte(op.cmd), []byte(op.key), err))
+		}
+		return
+	}
+
+	codec := a.client.options.codec
+	for i, op := range ops {
+		item := &MetaItem{Key: []byte(op.key)}
+		if err = a.client.tolerateCAS(parseMetaItem(replies[uint64(i+1)], item, false, codec)); err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				err = newCommandError(addr, []byte(op.cmd), []byte(op.key), err)
+			}
+			op.future.complete(nil, err)
+			continue
+		}
+
+		var result *Item
+		if op.withValue {
+			result = &Item{Key: op.key, Value: item.Value, Flags: item.Flags, CAS: item.CAS}
+		}
+		op.future.complete(result, nil)
+	}
+}
+
+// Future is the result of a command enqueued in the Async.
+type Future struct {
+	done chan struct{}
+
+	mu        sync.Mutex // guards callbacks
+	callbacks []func(*Item, error)
+
+	// item and err are set before done is closed.
+	item *Item
+	err  error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// Done returns a channel which is closed when the command is done.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the command to be done and returns its result, the item is nil
+// unless the command returns a value. It returns the error of the context if the
+// context is done first, and the command is still in flight.
+func (f *Future) Wait(ctx context.Context) (*Item, error) {
+	select {
+	case <-f.done:
+		return f.item, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// OnComplete registers the callback which is called with the result once the
+// command is done, or immediately if it has been done. The callbacks are called
+// by the worker goroutine of the Async, so they should not block.
+func (f *Future) OnComplete(fn func(*Item, error)) {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		fn(f.item, f.err)
+		return
+	default:
+	}
+	f.callbacks = append(f.callbacks, fn)
+	f.mu.Unlock()
+}
+
+func (f *Future) complete(item *Item, err error) {
+	f.mu.Lock()
+	f.item, f.err = item, err
+	close(f.done)
+	callbacks := f.callbacks
+	f.callbacks = nil
+	f.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(item, err)
+	}
+}
@@ -0,0 +1,181 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Async(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	async := c.Async(AsyncBatchSize(4))
+	defer async.Close()
+
+	keys := make([]string, 0, 32)
+	futures := make([]*Future, 0, 32)
+	for i := 0; i < 32; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		futures = append(futures, async.Set(ctx, key, []byte("value-"+key), uint32(i), time.Minute))
+	}
+	for _, f := range futures {
+		item, err := f.Wait(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, item)
+	}
+
+	futures = futures[:0]
+	for _, key := range keys {
+		futures = append(futures, async.Get(ctx, key))
+	}
+	for i, f := range futures {
+		item, err := f.Wait(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, keys[i], item.Key)
+		assert.Equal(t, "value-"+keys[i], string(item.Value))
+		assert.Equal(t, uint32(i), item.Flags)
+		assert.NotZero(t, item.CAS)
+	}
+
+	tests := []struct {
+		name    string
+		future  *Future
+		wantErr error
+	}{
+		{name: "get missing", future: async.Get(ctx, "missing"), wantErr: ErrNotFound},
+		{name: "touch", future: async.Touch(ctx, keys[0], time.Hour)},
+		{name: "touch missing", future: async.Touch(ctx, "missing", time.Hour), wantErr: ErrNotFound},
+		{name: "delete", future: async.Delete(ctx, keys[1])},
+		{name: "delete missing", future: async.Delete(ctx, "missing"), wantErr: ErrNotFound},
+		{name: "invalid key", future: async.Get(ctx, ""), wantErr: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.future.Wait(ctx)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	_, err = c.Get(ctx, keys[1])
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func Test_Async_callbackAndClose(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	async := c.Async()
+
+	done := make(chan error, 1)
+	async.Set(ctx, "foo", []byte("bar"), 0, 0).OnComplete(func(_ *Item, err error) { done <- err })
+	require.NoError(t, <-done)
+
+	// the callback registered after completion is called immediately.
+	f := async.Get(ctx, "foo")
+	<-f.Done()
+	var got *Item
+	f.OnComplete(func(item *Item, _ error) { got = item })
+	require.NotNil(t, got)
+	assert.Equal(t, "bar", string(got.Value))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = async.Get(canceled, "foo").Wait(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, async.Close())
+	require.NoError(t, async.Close())
+	_, err = async.Get(ctx, "foo").Wait(ctx)
+	require.ErrorIs(t, err, ErrAsyncClosed)
+}
+
+func Test_Async_errorPerItem(t *testing.T) {
+	addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+		for {
+			line, err := rr.ReadString('\n')
+			if err != nil {
+				return
+			}
+			parts := strings.Fields(line)
+			switch parts[0] {
+			case "ms":
+				_, _ = rr.ReadString('\n')
+				if parts[1] == "bad" {
+					_, _ = io.WriteString(w, "SERVER_ERROR busy\r\n")
+					continue
+				}
+				_, _ = io.WriteString(w, "HD "+parts[len(parts)-1]+"\r\n")
+			case "mn":
+				_, _ = io.WriteString(w, "MN\r\n")
+			}
+		}
+	})
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	async := c.Async()
+	defer async.Close()
+
+	// the error line without opaque token is attributed to the command replying it.
+	keys := []string{"foo", "bad", "bar"}
+	futures := make([]*Future, 0, len(keys))
+	for _, key := range keys {
+		futures = append(futures, async.Set(ctx, key, []byte("value"), 0, 0))
+	}
+	for i, f := range futures {
+		_, err = f.Wait(ctx)
+		if keys[i] != "bad" {
+			require.NoError(t, err)
+			continue
+		}
+
+		require.ErrorIs(t, err, ErrServerError)
+		var cmdErr *CommandError
+		require.ErrorAs(t, err, &cmdErr)
+		assert.Equal(t, "ms", cmdErr.Cmd)
+		assert.Equal(t, "bad", cmdErr.Key)
+	}
+}
+
+func Test_Async_closedWithClient(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	async := c.Async()
+	f := async.Set(ctx, "foo", []byte("bar"), 0, 0)
+
+	// the queued commands are flushed before the client is closed.
+	require.NoError(t, c.Close())
+	_, err = f.Wait(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, c.(*client).asyncs)
+
+	_, err = async.Get(ctx, "foo").Wait(ctx)
+	require.ErrorIs(t, err, ErrAsyncClosed)
+	require.NoError(t, async.Close())
+}
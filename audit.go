@@ -0,0 +1,195 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuditTTLBuckets are the upper bounds of the buckets of the remaining TTL counted
+// by AuditCache, see NamespaceAudit.TTLs.
+var AuditTTLBuckets = []time.Duration{time.Minute, 10 * time.Minute, time.Hour, 24 * time.Hour}
+
+// CacheAudit is the report of AuditCache.
+type CacheAudit struct {
+	// Namespaces holds the audit of each key namespace by its name.
+	Namespaces map[string]*NamespaceAudit
+	// Total is the audit of all the keys.
+	Total *NamespaceAudit
+}
+
+// NamespaceAudit is the audit of the keys of a namespace.
+type NamespaceAudit struct {
+	// Items is the number of items.
+	Items int
+	// Bytes is the total size of the values in bytes.
+	Bytes uint64
+	// Fetched is the number of items fetched since stored.
+	Fetched int
+	// NoTTL is the number of items which never expire.
+	NoTTL int
+	// TTLs is the distribution of the remaining TTL of the items which expire,
+	// TTLs[i] counts the items expiring within AuditTTLBuckets[i] but not the
+	// former buckets, and the last one counts the items beyond all the buckets.
+	TTLs []int
+	// Slabs is the usage of each slab class by its ID.
+	Slabs map[uint64]*SlabUsage
+}
+
+// SlabUsage is the usage of a slab class by the items of a namespace.
+type SlabUsage struct {
+	Items int
+	Bytes uint64
+}
+
+func newNamespaceAudit() *NamespaceAudit {
+	return &NamespaceAudit{
+		TTLs:  make([]int, len(AuditTTLBuckets)+1),
+		Slabs: make(map[uint64]*SlabUsage, 4),
+	}
+}
+
+func (a *NamespaceAudit) add(item *MetaItemDebug) {
+	a.Items++
+	a.Bytes += item.Size
+	if item.HitBefore {
+		a.Fetched++
+	}
+
+	if item.TTL < 0 {
+		a.NoTTL++
+	} else {
+		ttl := time.Duration(item.TTL) * time.Second
+		i := 0
+		for i < len(AuditTTLBuckets) && ttl > AuditTTLBuckets[i] {
+			i++
+		}
+		a.TTLs[i]++
+	}
+
+	slab, ok := a.Slabs[item.SlabClassID]
+	if !ok {
+		slab = &SlabUsage{}
+		a.Slabs[item.SlabClassID] = slab
+	}
+	slab.Items++
+	slab.Bytes += item.Size
+}
+
+// MetaDebugEach calls fn with the debug information of each key starting with
+// prefix on every memcached server, listed by `lru_crawler metadump all`. The
+// items are the same as MetaDebug replies, i.e. the TTL and the last access time
+// are relative to now. Empty prefix means all keys.
+//
+// It's expensive for the server since all the items are dumped, so it must not
+// be used in the hot path. ErrNotSupported is returned for the servers other than
+// memcached or whose lru_crawler is disabled. The iteration stops at the first
+// error, either of the servers or returned by fn.
+func (c *client) MetaDebugEach(ctx context.Context, prefix string, fn func(addr *Addr, item *MetaItemDebug) error) error {
+	for _, addr := range c.topology().addrs {
+		lines, err := c.metadumpLines(ctx, addr)
+		if err != nil {
+			return newCommandError(addr, []byte("lru_crawler metadump all"), nil, err)
+		}
+
+		now := c.now()
+		for _, line := range lines {
+			item, err := parseMetadumpItem(line, now)
+			if err != nil {
+				return newCommandError(addr, []byte("lru_crawler metadump all"), nil, err)
+			}
+			if !bytes.HasPrefix(item.Key, []byte(prefix)) {
+				continue
+			}
+			if err = fn(addr, item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AuditCache reports the TTL distribution and the slab usage of the keys starting
+// with prefix on every memcached server, grouped by their namespaces, e.g. to find
+// the namespaces without TTL or occupying the large slab classes. See MetaDebugEach
+// for the cost and the errors.
+//
+// namespaceOf names the namespace of a key, nil groups the keys by the part before
+// the first ':', and the keys of Namespaces by "ns:<name>".
+func (c *client) AuditCache(ctx context.Context, prefix string, namespaceOf func(key string) string) (*CacheAudit, error) {
+	if namespaceOf == nil {
+		namespaceOf = defaultNamespaceOf
+	}
+
+	audit := &CacheAudit{
+		Namespaces: make(map[string]*NamespaceAudit, 8),
+		Total:      newNamespaceAudit(),
+	}
+	err := c.MetaDebugEach(ctx, prefix, func(_ *Addr, item *MetaItemDebug) error {
+		name := namespaceOf(string(item.Key))
+		ns, ok := audit.Namespaces[name]
+		if !ok {
+			ns = newNamespaceAudit()
+			audit.Namespaces[name] = ns
+		}
+		ns.add(item)
+		audit.Total.add(item)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "audit failed")
+	}
+
+	return audit, nil
+}
+
+// defaultNamespaceOf returns the part of the key before the first ':', and
+// "ns:<name>" for the keys of Namespaces. The keys without ':' are in the empty
+// namespace.
+func defaultNamespaceOf(key string) string {
+	if rest, ok := strings.CutPrefix(key, namespaceKeyPrefix); ok {
+		name, _, _ := strings.Cut(rest, ":")
+		return namespaceKeyPrefix + name
+	}
+
+	name, _, ok := strings.Cut(key, ":")
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+// parseMetadumpItem parses a line replied by `lru_crawler metadump`, e.g.
+// "key=foo exp=1700000060 la=1700000000 cas=1 fetch=no cls=1 size=3". The exp
+// and la are unix timestamps rather than relative as me command replies, they're
+// converted relative to now.
+func parseMetadumpItem(line []byte, now time.Time) (*MetaItemDebug, error) {
+	fields := bytes.Fields(line)
+	if len(fields) == 0 || !bytes.HasPrefix(fields[0], _MetadumpKeyPrefix) {
+		return nil, errors.Wrapf(ErrMalformedResponse, "unexpected metadump line %q", line)
+	}
+
+	key, err := url.QueryUnescape(string(fields[0][len(_MetadumpKeyPrefix):]))
+	if err != nil {
+		return nil, errors.Wrapf(ErrMalformedResponse, "unexpected metadump key %q", fields[0])
+	}
+
+	// the CAS unique is not used by the dumps, it's kept 0 if it could not be parsed.
+	item := &MetaItemDebug{Key: []byte(key)}
+	if err = parseMetaDebugFields(fields[1:], item); err != nil && !isCASParseError(err) {
+		return nil, err
+	}
+	if item.TTL >= 0 {
+		item.TTL = max(item.TTL-now.Unix(), 0)
+	}
+	if item.LastAssessTime > 0 {
+		item.LastAssessTime = max(now.Unix()-item.LastAssessTime, 0)
+	}
+
+	return item, nil
+}
@@ -0,0 +1,138 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseMetadumpItem(t *testing.T) {
+	now := time.Unix(1700000100, 0)
+
+	tests := []struct {
+		name    string
+		line    string
+		want    *MetaItemDebug
+		wantErr bool
+	}{
+		{
+			name: "expiring",
+			line: "key=foo exp=1700000160 la=1700000090 cas=7 fetch=yes cls=2 size=100",
+			want: &MetaItemDebug{Key: []byte("foo"), TTL: 60, LastAssessTime: 10, CAS: 7, HitBefore: true, SlabClassID: 2, Size: 100},
+		},
+		{
+			name: "never expire",
+			line: "key=a%3Ab exp=-1 la=1700000100 cas=1 fetch=no cls=1 size=3",
+			want: &MetaItemDebug{Key: []byte("a:b"), TTL: -1, CAS: 1, SlabClassID: 1, Size: 3},
+		},
+		{name: "no key", line: "exp=-1 la=1700000100", wantErr: true},
+		{name: "invalid field", line: "key=foo exp=soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMetadumpItem([]byte(tt.line), now)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrMalformedResponse)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_defaultNamespaceOf(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "user:42:profile", want: "user"},
+		{key: "ns:feed:3:item", want: "ns:feed"},
+		{key: "ns:feed", want: "ns:feed"},
+		{key: "plain", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, defaultNamespaceOf(tt.key))
+		})
+	}
+}
+
+func Test_client_MetaDebugEach(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "user:1", []byte("a"), 0, 0))
+	require.NoError(t, c.Set(ctx, "user:2", []byte("bb"), 0, time.Minute))
+	require.NoError(t, c.Set(ctx, "session:1", []byte("ccc"), 0, 0))
+
+	var items []*MetaItemDebug
+	err = c.MetaDebugEach(ctx, "user:", func(addr *Addr, item *MetaItemDebug) error {
+		assert.Equal(t, srv.Addr(), addr.Address)
+		items = append(items, item)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "user:1", string(items[0].Key))
+	assert.Equal(t, int64(-1), items[0].TTL)
+	assert.Equal(t, "user:2", string(items[1].Key))
+	assert.InDelta(t, 60, items[1].TTL, 1)
+	assert.Equal(t, uint64(2), items[1].Size)
+
+	// the iteration stops at the error of fn.
+	stop := errors.New("stop")
+	calls := 0
+	err = c.MetaDebugEach(ctx, "", func(*Addr, *MetaItemDebug) error {
+		calls++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_client_AuditCache(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "user:1", []byte("a"), 0, 0))
+	require.NoError(t, c.Set(ctx, "user:2", []byte("bb"), 0, 30*time.Second))
+	require.NoError(t, c.Set(ctx, "user:3", bytes.Repeat([]byte("c"), 2000), 0, 2*time.Hour))
+	require.NoError(t, c.Set(ctx, "session:1", []byte("ddd"), 0, 10*time.Minute))
+
+	audit, err := c.AuditCache(ctx, "", nil)
+	require.NoError(t, err)
+	require.Len(t, audit.Namespaces, 2)
+	assert.Equal(t, 4, audit.Total.Items)
+
+	user := audit.Namespaces["user"]
+	assert.Equal(t, 3, user.Items)
+	assert.Equal(t, uint64(2003), user.Bytes)
+	assert.Equal(t, 1, user.NoTTL)
+	assert.Equal(t, []int{1, 0, 0, 1, 0}, user.TTLs)
+	assert.Equal(t, &SlabUsage{Items: 2, Bytes: 3}, user.Slabs[1])
+	assert.Equal(t, &SlabUsage{Items: 1, Bytes: 2000}, user.Slabs[3])
+
+	session := audit.Namespaces["session"]
+	assert.Equal(t, 1, session.Items)
+	assert.Equal(t, []int{0, 1, 0, 0, 0}, session.TTLs)
+
+	// the keys are filtered by the prefix.
+	audit, err = c.AuditCache(ctx, "session:", nil)
+	require.NoError(t, err)
+	assert.Len(t, audit.Namespaces, 1)
+	assert.Equal(t, 1, audit.Total.Items)
+}
@@ -0,0 +1,57 @@
+package benchmark
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/yeqown/memcached"
+)
+
+// The benchmarks in this file run against the in-process fakeServer, so that the
+// allocations of the read path could be compared without a memcached server.
+//
+// go test -run=^$ -bench=FakeServer -benchmem
+
+var largeValue = []byte(strings.Repeat("v", 16*1024))
+
+func BenchmarkYeqownMemcachedGet_FakeServer(b *testing.B) {
+	server := newFakeServer(b)
+
+	client, err := memcached.New(server.addr())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	if err = client.Set(ctx, testKey, largeValue, 0, 0); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Get(ctx, testKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBradfitzGomemcacheGet_FakeServer(b *testing.B) {
+	server := newFakeServer(b)
+
+	client := memcache.New(server.addr())
+	if err := client.Set(&memcache.Item{Key: testKey, Value: largeValue}); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Get(testKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package benchmark
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeServer is an in-process memcached server which only understands the
+// commands used by benchmarks: get/gets/set/version and mg/ms/mn. It makes the
+// benchmarks runnable without a memcached server, and its cost is the same for
+// all clients. The replies are flushed once the pipelined commands are drained.
+type fakeServer struct {
+	ln net.Listener
+
+	mu    sync.RWMutex
+	items map[string][]byte // key => data block with CRLF
+}
+
+func newFakeServer(tb testing.TB) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s := &fakeServer{ln: ln, items: make(map[string][]byte)}
+	go s.serve()
+	tb.Cleanup(func() { _ = ln.Close() })
+
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeServer) serve() {
+	for {
+		cn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(cn)
+	}
+}
+
+func (s *fakeServer) handle(cn net.Conn) {
+	defer cn.Close()
+
+	rr := bufio.NewReader(cn)
+	wr := bufio.NewWriter(cn)
+	for {
+		line, err := rr.ReadSlice('\n')
+		if err != nil {
+			return
+		}
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch string(fields[0]) {
+		case "get", "gets":
+			s.mu.RLock()
+			for _, key := range fields[1:] {
+				if v, ok := s.items[string(key)]; ok {
+					_, _ = wr.WriteString("VALUE ")
+					_, _ = wr.Write(key)
+					_, _ = wr.WriteString(" 0 ")
+					_, _ = wr.WriteString(strconv.Itoa(len(v) - 2))
+					if string(fields[0]) == "gets" {
+						_, _ = wr.WriteString(" 1")
+					}
+					_, _ = wr.WriteString("\r\n")
+					_, _ = wr.Write(v)
+				}
+			}
+			s.mu.RUnlock()
+			_, _ = wr.WriteString("END\r\n")
+		case "set":
+			// set <key> <flags> <exptime> <bytes> [noreply]
+			if len(fields) < 5 {
+				_, _ = wr.WriteString("ERROR\r\n")
+				break
+			}
+			key := string(fields[1])
+			n, _ := strconv.Atoi(string(fields[4]))
+			data := make([]byte, n+2)
+			if _, err = io.ReadFull(rr, data); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.items[key] = data
+			s.mu.Unlock()
+			_, _ = wr.WriteString("STORED\r\n")
+		case "mg":
+			// mg <key> <flags>*
+			if len(fields) < 2 {
+				_, _ = wr.WriteString("CLIENT_ERROR bad command line format\r\n")
+				break
+			}
+			s.mu.RLock()
+			v, ok := s.items[string(fields[1])]
+			s.mu.RUnlock()
+			s.metaGet(wr, fields[1], fields[2:], v, ok)
+		case "ms":
+			// ms <key> <datalen> <flags>*
+			if len(fields) < 3 {
+				_, _ = wr.WriteString("CLIENT_ERROR bad command line format\r\n")
+				break
+			}
+			n, _ := strconv.Atoi(string(fields[2]))
+			data := make([]byte, n+2)
+			if _, err = io.ReadFull(rr, data); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.items[string(fields[1])] = data
+			s.mu.Unlock()
+			if quiet, opaque := metaFlags(fields[3:]); !quiet {
+				_, _ = wr.WriteString("HD")
+				_, _ = wr.Write(opaque)
+				_, _ = wr.WriteString("\r\n")
+			}
+		case "mn":
+			_, _ = wr.WriteString("MN\r\n")
+		case "version":
+			_, _ = wr.WriteString("VERSION 1.6.21\r\n")
+		case "quit":
+			return
+		default:
+			_, _ = wr.WriteString("ERROR\r\n")
+		}
+
+		if rr.Buffered() > 0 {
+			continue
+		}
+		if err = wr.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// metaGet writes the reply of mg, only the v, f, c, k, O and q flags are
+// understood, the value v is the data block with CRLF.
+func (s *fakeServer) metaGet(wr *bufio.Writer, key []byte, flags [][]byte, v []byte, ok bool) {
+	quiet, opaque := metaFlags(flags)
+	if !ok {
+		if !quiet {
+			_, _ = wr.WriteString("EN\r\n")
+		}
+		return
+	}
+
+	withValue := false
+	for _, flag := range flags {
+		if flag[0] == 'v' {
+			withValue = true
+		}
+	}
+	if withValue {
+		_, _ = wr.WriteString("VA ")
+		_, _ = wr.WriteString(strconv.Itoa(len(v) - 2))
+	} else {
+		_, _ = wr.WriteString("HD")
+	}
+	for _, flag := range flags {
+		switch flag[0] {
+		case 'f':
+			_, _ = wr.WriteString(" f0")
+		case 'c':
+			_, _ = wr.WriteString(" c1")
+		case 'k':
+			_, _ = wr.WriteString(" k")
+			_, _ = wr.Write(key)
+		}
+	}
+	_, _ = wr.Write(opaque)
+	_, _ = wr.WriteString("\r\n")
+	if withValue {
+		_, _ = wr.Write(v)
+	}
+}
+
+// metaFlags returns whether the meta command is quiet, and its opaque flag which
+// is echoed in the reply, e.g. " O123".
+func metaFlags(flags [][]byte) (quiet bool, opaque []byte) {
+	for _, flag := range flags {
+		switch flag[0] {
+		case 'q':
+			quiet = true
+		case 'O':
+			opaque = append([]byte{' '}, flag...)
+		}
+	}
+
+	return quiet, opaque
+}
@@ -0,0 +1,438 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	rainycape "github.com/rainycape/memcache"
+	"github.com/yeqown/memcached"
+)
+
+// The benchmarks in this file compare the clients with the same operations, each
+// of them is named as <benchmark>/<parameter>=<value>/client=<client>, so that
+// the report could be produced by:
+//
+//	benchstat -col /client results/suite.txt
+//
+// They run against the in-process fakeServer by default, set MEMCACHED_ADDR to
+// run them against a memcached server. The rainycape client speaks the binary
+// protocol, it's skipped unless a memcached server is given.
+//
+// make bench-report
+
+// benchClient is the operations benchmarked of each client.
+type benchClient interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	// GetMulti retrieves the keys in one request, and returns the number of hits.
+	GetMulti(keys []string) (int, error)
+	// SetMulti stores the keys one by one, so that the clients are compared with
+	// the same round trips.
+	SetMulti(keys []string, value []byte) error
+	Close() error
+}
+
+// pipelinedBenchClient is implemented by the clients which pipeline the keys.
+type pipelinedBenchClient interface {
+	// SetPipelined stores the keys pipelined.
+	SetPipelined(keys []string, value []byte) error
+}
+
+// benchClientFactory creates a benchClient connected to addr, which keeps up to
+// conns idle connections.
+type benchClientFactory struct {
+	name string
+	// binary is true if the client speaks the binary protocol.
+	binary bool
+	new    func(addr string, conns int) (benchClient, error)
+}
+
+var benchClients = []benchClientFactory{
+	{name: "yeqown", new: newYeqownClient},
+	{name: "bradfitz", new: newBradfitzClient},
+	{name: "rainycape", binary: true, new: newRainycapeClient},
+}
+
+var benchValueSizes = []int{16, 16 * 1024, 256 * 1024}
+
+// benchAddr returns MEMCACHED_ADDR, or the address of a fakeServer if it's not set.
+func benchAddr(b *testing.B) (addr string, fake bool) {
+	if addr = os.Getenv("MEMCACHED_ADDR"); addr != "" {
+		return addr, false
+	}
+
+	return newFakeServer(b).addr(), true
+}
+
+// runBenchClients runs fn with each client connected to the benchmarked server.
+func runBenchClients(b *testing.B, conns int, fn func(b *testing.B, client benchClient)) {
+	for _, factory := range benchClients {
+		b.Run("client="+factory.name, func(b *testing.B) {
+			addr, fake := benchAddr(b)
+			if fake && factory.binary {
+				b.Skipf("%s speaks the binary protocol, set MEMCACHED_ADDR to run it.", factory.name)
+			}
+
+			client, err := factory.new(addr, conns)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer client.Close()
+
+			fn(b, client)
+		})
+	}
+}
+
+func sizeName(size int) string {
+	if size >= 1024 {
+		return strconv.Itoa(size/1024) + "KB"
+	}
+
+	return strconv.Itoa(size) + "B"
+}
+
+func benchKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s_%d", testKey, i)
+	}
+
+	return keys
+}
+
+func BenchmarkSuiteGet(b *testing.B) {
+	for _, size := range benchValueSizes {
+		value := []byte(strings.Repeat("v", size))
+		b.Run("size="+sizeName(size), func(b *testing.B) {
+			runBenchClients(b, 1, func(b *testing.B, client benchClient) {
+				if err := client.Set(testKey, value); err != nil {
+					b.Fatal(err)
+				}
+
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := client.Get(testKey); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkSuiteSet(b *testing.B) {
+	for _, size := range benchValueSizes {
+		value := []byte(strings.Repeat("v", size))
+		b.Run("size="+sizeName(size), func(b *testing.B) {
+			runBenchClients(b, 1, func(b *testing.B, client benchClient) {
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := client.Set(testKey, value); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkSuiteGetMulti(b *testing.B) {
+	for _, n := range []int{16, 100} {
+		keys := benchKeys(n)
+		b.Run("keys="+strconv.Itoa(n), func(b *testing.B) {
+			runBenchClients(b, 1, func(b *testing.B, client benchClient) {
+				if err := client.SetMulti(keys, testValue); err != nil {
+					b.Fatal(err)
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					hits, err := client.GetMulti(keys)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if hits != n {
+						b.Fatalf("expect %d hits, got %d", n, hits)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSuiteSetMulti stores the keys one by one by all clients, and pipelined
+// by the clients supporting it, the modes are not compared with each other.
+func BenchmarkSuiteSetMulti(b *testing.B) {
+	for _, n := range []int{16, 100} {
+		keys := benchKeys(n)
+		b.Run("keys="+strconv.Itoa(n)+"/mode=sequential", func(b *testing.B) {
+			runBenchClients(b, 1, func(b *testing.B, client benchClient) {
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := client.SetMulti(keys, testValue); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+		b.Run("keys="+strconv.Itoa(n)+"/mode=pipelined", func(b *testing.B) {
+			runBenchClients(b, 1, func(b *testing.B, client benchClient) {
+				pipelined, ok := client.(pipelinedBenchClient)
+				if !ok {
+					b.Skip("the client does not pipeline the keys.")
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := pipelined.SetPipelined(keys, testValue); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSuiteConcurrentGet gets the keys by the given number of goroutines,
+// each client keeps as many idle connections as the goroutines.
+func BenchmarkSuiteConcurrentGet(b *testing.B) {
+	keys := benchKeys(64)
+	for _, goroutines := range []int{64, 256} {
+		b.Run("goroutines="+strconv.Itoa(goroutines), func(b *testing.B) {
+			runBenchClients(b, goroutines, func(b *testing.B, client benchClient) {
+				if err := client.SetMulti(keys, testValue); err != nil {
+					b.Fatal(err)
+				}
+
+				b.ReportAllocs()
+				b.SetParallelism(max(1, goroutines/runtime.GOMAXPROCS(0)))
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for i := 0; pb.Next(); i++ {
+						if _, err := client.Get(keys[i%len(keys)]); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+		})
+	}
+}
+
+// BenchmarkSuiteMeta compares the meta commands with the classic ones of
+// yeqown/memcached, the other clients do not support meta commands.
+func BenchmarkSuiteMeta(b *testing.B) {
+	addr, _ := benchAddr(b)
+	client, err := memcached.New(addr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	key := []byte(testKey)
+	if err = client.Set(ctx, testKey, testValue, 0, 0); err != nil {
+		b.Fatal(err)
+	}
+
+	benches := []struct {
+		name string
+		fn   func() error
+	}{
+		{name: "cmd=get", fn: func() error {
+			_, err := client.Get(ctx, testKey)
+			return err
+		}},
+		{name: "cmd=mg", fn: func() error {
+			_, err := client.MetaGet(ctx, key, memcached.MetaGetFlagReturnValue(), memcached.MetaGetFlagReturnClientFlags())
+			return err
+		}},
+		{name: "cmd=set", fn: func() error {
+			return client.Set(ctx, testKey, testValue, 0, 0)
+		}},
+		{name: "cmd=ms", fn: func() error {
+			_, err := client.MetaSet(ctx, key, testValue)
+			return err
+		}},
+	}
+
+	for _, bench := range benches {
+		b.Run(bench.name+"/client=yeqown", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := bench.fn(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+type yeqownClient struct {
+	client memcached.Client
+	async  *memcached.Async
+}
+
+func newYeqownClient(addr string, conns int) (benchClient, error) {
+	client, err := memcached.New(addr, memcached.WithMaxIdleConns(conns), memcached.WithMaxConns(max(conns, 100)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &yeqownClient{client: client, async: client.Async()}, nil
+}
+
+func (c *yeqownClient) Get(key string) ([]byte, error) {
+	item, err := c.client.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return item.Value, nil
+}
+
+func (c *yeqownClient) Set(key string, value []byte) error {
+	return c.client.Set(context.Background(), key, value, 0, 0)
+}
+
+func (c *yeqownClient) GetMulti(keys []string) (int, error) {
+	items, err := c.client.Gets(context.Background(), keys...)
+	return len(items), err
+}
+
+// SetMulti stores the keys one by one.
+func (c *yeqownClient) SetMulti(keys []string, value []byte) error {
+	for _, key := range keys {
+		if err := c.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetPipelined pipelines the keys by Async.
+func (c *yeqownClient) SetPipelined(keys []string, value []byte) error {
+	ctx := context.Background()
+	futures := make([]*memcached.Future, len(keys))
+	for i, key := range keys {
+		futures[i] = c.async.Set(ctx, key, value, 0, 0)
+	}
+	for _, f := range futures {
+		if _, err := f.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *yeqownClient) Close() error {
+	_ = c.async.Close()
+	return c.client.Close()
+}
+
+type bradfitzClient struct {
+	client *memcache.Client
+}
+
+func newBradfitzClient(addr string, conns int) (benchClient, error) {
+	client := memcache.New(addr)
+	client.Timeout = 3 * time.Second
+	client.MaxIdleConns = conns
+
+	return &bradfitzClient{client: client}, nil
+}
+
+func (c *bradfitzClient) Get(key string) ([]byte, error) {
+	item, err := c.client.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return item.Value, nil
+}
+
+func (c *bradfitzClient) Set(key string, value []byte) error {
+	return c.client.Set(&memcache.Item{Key: key, Value: value})
+}
+
+func (c *bradfitzClient) GetMulti(keys []string) (int, error) {
+	items, err := c.client.GetMulti(keys)
+	return len(items), err
+}
+
+// SetMulti stores the keys one by one.
+func (c *bradfitzClient) SetMulti(keys []string, value []byte) error {
+	for _, key := range keys {
+		if err := c.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *bradfitzClient) Close() error { return c.client.Close() }
+
+type rainycapeClient struct {
+	client *rainycape.Client
+}
+
+func newRainycapeClient(addr string, conns int) (benchClient, error) {
+	client, err := rainycape.New(addr)
+	if err != nil {
+		return nil, err
+	}
+	client.SetTimeout(3 * time.Second)
+	client.SetMaxIdleConnsPerAddr(conns)
+
+	return &rainycapeClient{client: client}, nil
+}
+
+func (c *rainycapeClient) Get(key string) ([]byte, error) {
+	item, err := c.client.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return item.Value, nil
+}
+
+func (c *rainycapeClient) Set(key string, value []byte) error {
+	return c.client.Set(&rainycape.Item{Key: key, Value: value})
+}
+
+func (c *rainycapeClient) GetMulti(keys []string) (int, error) {
+	items, err := c.client.GetMulti(keys)
+	return len(items), err
+}
+
+// SetMulti stores the keys one by one.
+func (c *rainycapeClient) SetMulti(keys []string, value []byte) error {
+	for _, key := range keys {
+		if err := c.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *rainycapeClient) Close() error { return c.client.Close() }
@@ -0,0 +1,43 @@
+package memcached
+
+import (
+	"context"
+	"time"
+)
+
+// deadlineBudget splits the deadline of a request between its first attempt and
+// the hedged one, so that the first attempt could not consume the whole deadline
+// and leave nothing to the hedged attempt. See WithDeadlineBudget.
+type deadlineBudget struct {
+	// firstShare is the share of the remaining time given to the first attempt,
+	// in (0, 1).
+	firstShare float64
+	// minAttempt is the minimum time of each attempt.
+	minAttempt time.Duration
+}
+
+// attemptContext returns the context of the nth attempt of the request, counted
+// from 0. The first attempt is bounded by its share of the deadline of ctx, but
+// no less than minAttempt, and leaves at least minAttempt to the later attempts.
+// The later attempts take the rest of the deadline. The deadline is not split if
+// the budget is nil, ctx has no deadline, or the remaining time is too short for
+// two attempts.
+func (b *deadlineBudget) attemptContext(ctx context.Context, n int) (context.Context, context.CancelFunc) {
+	if b == nil || n > 0 {
+		return context.WithCancel(ctx)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	remaining := deadline.Sub(nowFunc())
+	if remaining < 2*b.minAttempt {
+		return context.WithCancel(ctx)
+	}
+
+	share := time.Duration(float64(remaining) * b.firstShare)
+	share = min(max(share, b.minAttempt), remaining-b.minAttempt)
+
+	return context.WithTimeout(ctx, share)
+}
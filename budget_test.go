@@ -0,0 +1,100 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeqown/memcached/internal/testserver"
+)
+
+func Test_deadlineBudget_attemptContext(t *testing.T) {
+	budget := &deadlineBudget{firstShare: 0.6, minAttempt: 100 * time.Millisecond}
+
+	tests := []struct {
+		name    string
+		budget  *deadlineBudget
+		timeout time.Duration
+		attempt int
+		// want is the expected timeout of the attempt, 0 means the deadline of the
+		// call is not split.
+		want time.Duration
+	}{
+		{name: "disabled", budget: nil, timeout: time.Second},
+		{name: "no deadline", budget: budget},
+		{name: "first share", budget: budget, timeout: time.Second, want: 600 * time.Millisecond},
+		{name: "hedged attempt", budget: budget, timeout: time.Second, attempt: 1},
+		{name: "min attempt", budget: budget, timeout: 250 * time.Millisecond, want: 150 * time.Millisecond},
+		{name: "too short", budget: budget, timeout: 150 * time.Millisecond},
+		{
+			name:    "leaves min attempt",
+			budget:  &deadlineBudget{firstShare: 0.9, minAttempt: 200 * time.Millisecond},
+			timeout: time.Second,
+			want:    800 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			attemptCtx, cancel := tt.budget.attemptContext(ctx, tt.attempt)
+			defer cancel()
+
+			deadline, ok := attemptCtx.Deadline()
+			parent, parentOK := ctx.Deadline()
+			assert.Equal(t, parentOK, ok)
+			if tt.want == 0 {
+				assert.Equal(t, parent, deadline)
+				return
+			}
+			assert.InDelta(t, float64(tt.want), float64(time.Until(deadline)), float64(20*time.Millisecond))
+		})
+	}
+}
+
+func Test_client_WithDeadlineBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		wantErr bool
+	}{
+		// the first attempt takes the whole deadline, and the hedge is too late.
+		{name: "without budget", opts: nil, wantErr: true},
+		// the first attempt runs out of its share, and the hedge is sent at once.
+		{name: "with budget", opts: []ClientOption{WithDeadlineBudget(0.3, 10*time.Millisecond)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			opts := append([]ClientOption{WithHedgedReads(time.Second)}, tt.opts...)
+			c, err := New(srv.Addr(), opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+
+			// the first attempt is never replied, and the later ones are replied at once.
+			srv.InjectFaults(testserver.FaultStall)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			item, err := c.Get(ctx, "foo")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "bar", string(item.Value))
+		})
+	}
+}
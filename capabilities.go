@@ -0,0 +1,193 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// serverVersion represents the version of memcached server, e.g. 1.6.21.
+type serverVersion struct {
+	major, minor, patch int
+}
+
+func (v serverVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// atLeast reports whether the version is equal to or newer than the given version.
+func (v serverVersion) atLeast(other serverVersion) bool {
+	if v.major != other.major {
+		return v.major > other.major
+	}
+	if v.minor != other.minor {
+		return v.minor > other.minor
+	}
+
+	return v.patch >= other.patch
+}
+
+// parseServerVersion parses the version string replied by `version` command,
+// the suffix of the patch number is ignored, e.g. "1.4.5-1-gabcdef" and "1.6.21".
+func parseServerVersion(s string) (serverVersion, bool) {
+	parts := strings.SplitN(strings.TrimSpace(s), ".", 3)
+	if len(parts) < 2 {
+		return serverVersion{}, false
+	}
+
+	numbers := [3]int{}
+	for i, part := range parts {
+		// cut off the non-digit suffix, e.g. "5-1-gabcdef" => "5"
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			return serverVersion{}, false
+		}
+
+		n, err := strconv.Atoi(part[:end])
+		if err != nil {
+			return serverVersion{}, false
+		}
+		numbers[i] = n
+	}
+
+	return serverVersion{major: numbers[0], minor: numbers[1], patch: numbers[2]}, true
+}
+
+// feature represents a feature of memcached server which is not supported
+// by all versions.
+type feature struct {
+	name       string
+	minVersion serverVersion
+}
+
+var (
+	featureTouch = feature{name: "touch", minVersion: serverVersion{1, 4, 8}}
+	featureGAT   = feature{name: "gat/gats", minVersion: serverVersion{1, 5, 3}}
+	featureMeta  = feature{name: "meta commands", minVersion: serverVersion{1, 6, 0}}
+	// featureCachedump is not a command of its own, it's checked by KeySample.
+	featureCachedump = feature{name: "stats cachedump", minVersion: serverVersion{1, 4, 0}}
+	// featureMetadump is not a command of its own, it's checked by Rebalance.
+	featureMetadump = feature{name: "lru_crawler metadump", minVersion: serverVersion{1, 4, 31}}
+)
+
+// commandFeatures maps the command name to the feature it requires, commands
+// which are not in the map are supported by all versions.
+var commandFeatures = map[string]feature{
+	"touch": featureTouch,
+	"gat":   featureGAT,
+	"gats":  featureGAT,
+	"ms":    featureMeta,
+	"mg":    featureMeta,
+	"md":    featureMeta,
+	"ma":    featureMeta,
+	"me":    featureMeta,
+	"mn":    featureMeta,
+}
+
+// capabilities represents the features supported by a memcached server,
+// it's detected by the `version` command when the first connection to the
+// server is established.
+type capabilities struct {
+	// known is false if the version could not be detected, all features
+	// are considered supported in this case.
+	known   bool
+	version serverVersion
+}
+
+func (c *capabilities) supports(f feature) bool {
+	if c == nil || !c.known {
+		return true
+	}
+
+	return c.version.atLeast(f.minVersion)
+}
+
+// detectCapabilities queries the version of the server over the given connection.
+// The version command is not supported by some proxies, so that an unexpected
+// reply is not an error but an unknown capabilities.
+func detectCapabilities(ctx context.Context, addr *Addr, cn memcachedConn, c *client) (*capabilities, error) {
+	req, resp := buildVersionCommand()
+	defer releaseReqAndResp(req, resp)
+
+	if err := req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
+		return nil, errors.Wrap(err, "send version failed")
+	}
+	if err := resp.recv(ctx, cn, c.baseReadTimeout(addr)); err != nil {
+		if errors.Is(err, ErrNonexistentCommand) ||
+			errors.Is(err, ErrClientError) ||
+			errors.Is(err, ErrServerError) {
+			return &capabilities{}, nil
+		}
+
+		return nil, errors.Wrap(err, "recv version failed")
+	}
+
+	line := resp.rawLines[0]
+	if !bytes.HasPrefix(line, _VersionBytes) || len(line) < 8 {
+		return &capabilities{}, nil
+	}
+
+	version, ok := parseServerVersion(string(trimCRLF(line[8:])))
+	return &capabilities{known: ok, version: version}, nil
+}
+
+// shouldDetectCapabilities reports whether the client should detect the
+// capabilities of the server at given address.
+func (c *client) shouldDetectCapabilities(addr *Addr) bool {
+	if !c.options.capabilityDetection {
+		return false
+	}
+	// the versions of other servers are not comparable with memcached.
+	if c.options.compatibility != CompatMemcached {
+		return false
+	}
+
+	if isUDPNetwork(addr) {
+		return false
+	}
+
+	c.mu.Lock()
+	_, detected := c.capabilities[addr]
+	c.mu.Unlock()
+
+	return !detected
+}
+
+func (c *client) setCapabilities(addr *Addr, caps *capabilities) {
+	c.mu.Lock()
+	c.capabilities[addr] = caps
+	c.mu.Unlock()
+}
+
+// checkCapability returns ErrNotSupported if the command is not supported by
+// the server at given address.
+func (c *client) checkCapability(addr *Addr, cmd []byte) error {
+	f, ok := commandFeatures[string(cmd)]
+	if !ok {
+		return nil
+	}
+
+	return c.checkFeature(addr, f)
+}
+
+// checkFeature returns ErrNotSupported if the feature is not supported by the
+// server at given address.
+func (c *client) checkFeature(addr *Addr, f feature) error {
+	c.mu.Lock()
+	caps := c.capabilities[addr]
+	c.mu.Unlock()
+
+	if caps.supports(f) {
+		return nil
+	}
+
+	return errors.Wrapf(ErrNotSupported, "%s requires memcached %s or later, but server %s is %s",
+		f.name, f.minVersion, addr.Address, caps.version)
+}
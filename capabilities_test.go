@@ -0,0 +1,106 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linesConn is a mockConn which replies the given lines in order.
+type linesConn struct {
+	*mockConn
+
+	written []byte
+	lines   [][]byte
+}
+
+func newLinesConn(lines ...string) *linesConn {
+	c := &linesConn{mockConn: newMockConn()}
+	for _, line := range lines {
+		c.lines = append(c.lines, []byte(line))
+	}
+	return c
+}
+
+func (c *linesConn) Write(p []byte) (int, error) {
+	c.written = append(c.written, p...)
+	return len(p), nil
+}
+
+func (c *linesConn) readLine(_ byte) ([]byte, error) {
+	if len(c.lines) == 0 {
+		return nil, context.DeadlineExceeded
+	}
+
+	line := c.lines[0]
+	c.lines = c.lines[1:]
+	return line, nil
+}
+
+func Test_parseServerVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    serverVersion
+		wantOK  bool
+	}{
+		{name: "normal", version: "1.6.21", want: serverVersion{1, 6, 21}, wantOK: true},
+		{name: "with suffix", version: "1.4.5-1-gabcdef", want: serverVersion{1, 4, 5}, wantOK: true},
+		{name: "major and minor only", version: "1.5", want: serverVersion{1, 5, 0}, wantOK: true},
+		{name: "not a number", version: "unknown", wantOK: false},
+		{name: "empty", version: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseServerVersion(tt.version)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_detectCapabilities(t *testing.T) {
+	c := &client{options: newClientOptions(), clientState: newClientState()}
+	c.runtime.Store(newRuntimeOptions(c.options))
+
+	cn := newLinesConn("VERSION 1.4.20\r\n")
+	caps, err := detectCapabilities(context.Background(), nil, cn, c)
+	require.NoError(t, err)
+	assert.Equal(t, "version\r\n", string(cn.written))
+	assert.True(t, caps.known)
+	assert.Equal(t, serverVersion{1, 4, 20}, caps.version)
+
+	// proxies may not support the version command.
+	caps, err = detectCapabilities(context.Background(), nil, newLinesConn("ERROR\r\n"), c)
+	require.NoError(t, err)
+	assert.False(t, caps.known)
+
+	_, err = detectCapabilities(context.Background(), nil, newLinesConn(), c)
+	require.Error(t, err)
+}
+
+func TestCheckCapability(t *testing.T) {
+	addr := NewAddr("tcp", "localhost:11211", 0)
+	c := &client{options: newClientOptions(), clientState: newClientState()}
+
+	// capabilities are not detected yet.
+	require.NoError(t, c.checkCapability(addr, []byte("mg")))
+
+	c.setCapabilities(addr, &capabilities{known: true, version: serverVersion{1, 5, 0}})
+	require.NoError(t, c.checkCapability(addr, []byte("get")))
+	require.NoError(t, c.checkCapability(addr, []byte("touch")))
+	require.ErrorIs(t, c.checkCapability(addr, []byte("gat")), ErrNotSupported)
+	require.ErrorIs(t, c.checkCapability(addr, []byte("mg")), ErrNotSupported)
+
+	c.setCapabilities(addr, &capabilities{known: true, version: serverVersion{1, 6, 0}})
+	require.NoError(t, c.checkCapability(addr, []byte("gats")))
+	require.NoError(t, c.checkCapability(addr, []byte("mn")))
+
+	c.setCapabilities(addr, &capabilities{})
+	require.NoError(t, c.checkCapability(addr, []byte("mg")))
+}
@@ -0,0 +1,101 @@
+package memcached
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pkg/errors"
+)
+
+// Checksum is the algorithm of the checksum appended to the values, see WithChecksum.
+type Checksum uint8
+
+const (
+	// ChecksumNone disables the checksum.
+	ChecksumNone Checksum = iota
+	// ChecksumCRC32 appends the 4-byte CRC-32 (Castagnoli) checksum.
+	ChecksumCRC32
+	// ChecksumXXHash appends the 8-byte xxHash64 checksum.
+	ChecksumXXHash
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// size returns the bytes of the checksum, 0 means the algorithm is unknown.
+func (c Checksum) size() int {
+	switch c {
+	case ChecksumCRC32:
+		return 4
+	case ChecksumXXHash:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// appendSum appends the checksum of value to dst.
+func (c Checksum) appendSum(dst, value []byte) []byte {
+	switch c {
+	case ChecksumCRC32:
+		return binary.BigEndian.AppendUint32(dst, crc32.Checksum(value, crc32cTable))
+	default:
+		return binary.BigEndian.AppendUint64(dst, xxhash.Sum64(value))
+	}
+}
+
+// checksumCodec appends the checksum envelope to the values encoded by Codec,
+// and verifies it before they are decoded by Codec. The envelope is:
+//
+//	<value> <checksum> <algorithm:1 byte>
+//
+// The algorithm is stored in the envelope, so that the values written with any
+// algorithm are verified, the algorithm of the client could be changed safely.
+type checksumCodec struct {
+	Codec
+
+	algorithm Checksum
+}
+
+func (c checksumCodec) Encode(key, value []byte, flag uint32) ([]byte, uint32, error) {
+	evalue, eflag, err := c.Codec.Encode(key, value, flag)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	enveloped := make([]byte, 0, len(evalue)+c.algorithm.size()+1)
+	enveloped = append(enveloped, evalue...)
+	enveloped = c.algorithm.appendSum(enveloped, evalue)
+	enveloped = append(enveloped, byte(c.algorithm))
+
+	return enveloped, eflag, nil
+}
+
+func (c checksumCodec) Decode(key, value []byte, flag uint32) ([]byte, uint32, error) {
+	if len(value) == 0 {
+		return nil, 0, errors.Wrap(ErrChecksumMismatch, "missing checksum")
+	}
+
+	algorithm := Checksum(value[len(value)-1])
+	size := algorithm.size()
+	if size == 0 || len(value) < size+1 {
+		return nil, 0, errors.Wrap(ErrChecksumMismatch, "missing checksum")
+	}
+
+	value, sum := value[:len(value)-size-1], value[len(value)-size-1:len(value)-1]
+	if string(algorithm.appendSum(nil, value)) != string(sum) {
+		return nil, 0, errors.Wrapf(ErrChecksumMismatch, "key %s", key)
+	}
+
+	return c.Codec.Decode(key, value, flag)
+}
+
+// SupportsOperation rejects the operations which break the envelope, appending or
+// prepending bytes to it, and streaming the value without buffering it.
+func (c checksumCodec) SupportsOperation(operation string) error {
+	if operation == "append" || operation == "prepend" || operation == "stream" {
+		return errors.Wrapf(ErrNotSupported, "%s with checksum", operation)
+	}
+
+	return c.Codec.SupportsOperation(operation)
+}
@@ -0,0 +1,131 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memcodec "github.com/yeqown/memcached/codec"
+)
+
+func Test_checksumCodec(t *testing.T) {
+	for _, algorithm := range []Checksum{ChecksumCRC32, ChecksumXXHash} {
+		codec := checksumCodec{Codec: memcodec.Noop, algorithm: algorithm}
+
+		enveloped, flags, err := codec.Encode([]byte("foo"), []byte("bar"), 7)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(7), flags)
+		assert.Len(t, enveloped, 3+algorithm.size()+1)
+
+		value, flags, err := codec.Decode([]byte("foo"), enveloped, flags)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(value))
+		assert.Equal(t, uint32(7), flags)
+
+		// the values written with the other algorithm are verified too.
+		other := checksumCodec{Codec: memcodec.Noop, algorithm: ChecksumCRC32 + ChecksumXXHash - algorithm}
+		value, _, err = other.Decode([]byte("foo"), enveloped, flags)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(value))
+	}
+
+	codec := checksumCodec{Codec: memcodec.Noop, algorithm: ChecksumCRC32}
+	enveloped, _, err := codec.Encode([]byte("foo"), []byte("bar"), 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "empty", value: nil},
+		{name: "without checksum", value: []byte("bar")},
+		{name: "truncated", value: enveloped[1:]},
+		{name: "corrupted", value: append([]byte("baz"), enveloped[3:]...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := codec.Decode([]byte("foo"), tt.value, 0)
+			require.ErrorIs(t, err, ErrChecksumMismatch)
+		})
+	}
+
+	for _, operation := range []string{"append", "prepend", "stream"} {
+		require.ErrorIs(t, codec.SupportsOperation(operation), ErrNotSupported)
+	}
+	require.NoError(t, codec.SupportsOperation("set"))
+}
+
+func Test_client_WithChecksum(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(),
+		WithChecksum(ChecksumXXHash),
+		WithCodec(mustCompressCodec(t, memcodec.CompressionAlgorithmDeflate, 1, 6)),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+	raw, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer raw.Close()
+
+	ctx := context.Background()
+	value := []byte("hello hello hello hello hello hello")
+	require.NoError(t, c.Set(ctx, "foo", value, 1, 0))
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, value, item.Value)
+	assert.Equal(t, uint32(1), item.Flags)
+
+	mi, err := c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnValue())
+	require.NoError(t, err)
+	assert.Equal(t, value, mi.Value)
+
+	// corrupt the stored value by the client without checksum.
+	stored, err := raw.Get(ctx, "foo")
+	require.NoError(t, err)
+	stored.Value[0] ^= 0xFF
+	require.NoError(t, raw.Set(ctx, "foo", stored.Value, stored.Flags, 0))
+
+	_, err = c.Get(ctx, "foo")
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnValue())
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+
+	require.ErrorIs(t, c.Append(ctx, "foo", []byte("bar"), 0, 0), ErrNotSupported)
+}
+
+func Test_client_WithChecksum_arithmetic(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithChecksum(ChecksumCRC32))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	// the counters are not checksummed, so that they're incremented by memcached.
+	counter := c.Counter("hits", 0)
+	n, err := counter.Incr(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), n)
+	require.NoError(t, counter.Set(ctx, 10))
+	n, err = counter.Incr(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(15), n)
+	n, err = counter.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(15), n)
+
+	item, err := c.MetaArithmetic(ctx, []byte("hits"), 1, MetaArithmeticFlagReturnValue())
+	require.NoError(t, err)
+	assert.Equal(t, "16", string(item.Value))
+	n, err = c.Incr(ctx, "hits", 4)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), n)
+
+	item, err = c.MetaArithmetic(ctx, []byte("created"), 1, MetaArithmeticFlagAutoCreate(0),
+		MetaArithmeticFlagInitialValue(7), MetaArithmeticFlagReturnValue())
+	require.NoError(t, err)
+	assert.Equal(t, "7", string(item.Value))
+}
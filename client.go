@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
@@ -20,7 +22,35 @@ type Client interface {
 
 	basicTextProtocolCommander
 	metaTextProtocolCommander
-	statisticsTextProtocolCommander
+	AdminCommander
+	StatisticsCommander
+	streamingTextProtocolCommander
+	helperCommander
+
+	// PoolStats returns the statistics of the connection pools, keyed by the
+	// address of each memcached server. The servers which have not been
+	// connected are not included, unless their requests have been shed by
+	// the limit of WithMaxConcurrentRequests.
+	PoolStats() map[string]*PoolStats
+	// Metrics returns the hits and misses of the retrieval commands, Get, Gets,
+	// GetAndTouch(es), TouchAndGetMulti and MetaGet, of all and each memcached server.
+	Metrics() *Metrics
+	// LastProtocolErrors returns the last malformed responses captured by
+	// WithProtocolErrorCapture, from the oldest to the newest.
+	LastProtocolErrors() []*ProtocolError
+	// WhichNode returns the memcached server the key is picked to, see client.WhichNode.
+	WhichNode(key string) (*Addr, error)
+	// Distribution counts the keys picked to each memcached server, see KeyDistribution.
+	Distribution(keys []string) (*KeyDistribution, error)
+	// UpdateOptions applies the timeouts and the limits of the connection pools
+	// to the client in use, see client.UpdateOptions for the supported options.
+	UpdateOptions(opts ...ClientOption) error
+	// UpdateAddrs replaces the memcached servers of the client in use, see
+	// client.UpdateAddrs.
+	UpdateAddrs(addrs []*Addr) error
+	// With returns a view of the client sharing its connection pools, with the
+	// settings of the requests overridden, see client.With for the supported options.
+	With(opts ...ClientOption) (Client, error)
 	// TODO: support rawTextProtocolCommander
 	// rawTextProtocolCommander
 }
@@ -29,21 +59,87 @@ var _ Client = (*client)(nil)
 
 type client struct {
 	options *clientOptions
+	// derived means the client is a view derived by With, which shares the state
+	// of the client it's derived from rather than owning it.
+	derived bool
+	// readTimeoutOverride and writeTimeoutOverride are the timeouts of the requests
+	// overridden by With, 0 means the runtime options are used.
+	readTimeoutOverride  time.Duration
+	writeTimeoutOverride time.Duration
+
+	// dirty tracks the keys written by the noreply requests which are not
+	// acknowledged yet, it's nil if WithReadYourWrites is not set.
+	dirty *dirtyKeys
+
+	// globalBucket is the token bucket limiting the rate of requests to all memcached
+	// servers, it's nil if the global rate limit is not set. The buckets of each
+	// server are held by the topology.
+	globalBucket *tokenBucket
+
+	// adaptive computes the read timeout of each memcached server from its
+	// latencies, it's nil if the adaptive timeout is disabled.
+	adaptive *adaptiveTimeout
+
+	// protocolErrors keeps the last malformed responses, it's nil if the capture
+	// is disabled. See WithProtocolErrorCapture.
+	protocolErrors *protocolErrorRing
 
-	// addrs represents the list of memcached addresses.
-	// each one of them means a memcached server instance.
-	addrs []*Addr
+	// telemetry holds the OpenTelemetry tracers and metrics.
+	tracer  *telemetry.Tracer
+	metrics *telemetry.Metrics
 
-	// picker represents the picker strategy.
-	// it is used to pick a memcached server instance to execute a command.
-	picker Picker
+	*clientState
+}
+
+// clientState is the mutable state of the client, which is shared by the views
+// derived from the client by With.
+type clientState struct {
+	// topo holds the memcached servers and the state of each one of them, it's
+	// replaced under mu by UpdateAddrs.
+	topo atomic.Pointer[topology]
+	// stopRefresh stops the refresh of the topology, it's nil if WithTopologyRefresh
+	// is not set.
+	stopRefresh func()
 
 	mu        sync.Mutex // guards following
-	connPools map[*Addr]*connPool
+	connPools map[*Addr]*shardedPool
+	// multiplexers holds the multiplexed connections of each memcached server,
+	// it's used instead of connPools if the multiplexing mode is enabled.
+	multiplexers map[*Addr]*multiplexer
+	// capabilities holds the detected capabilities of each memcached server.
+	capabilities map[*Addr]*capabilities
+	// settings holds the detected settings of each memcached server, nil means the
+	// server rejected `stats settings`. See WithAutoTune and DetectMaxItemSize.
+	settings map[*Addr]*ServerSettings
+	// scheduledFlushes holds the time the delayed flush_all scheduled by the client
+	// flushes each memcached server at, see ScheduleFlush.
+	scheduledFlushes map[*Addr]time.Time
+	// noMultiKeyGetAndTouch holds the memcached servers which rejected multi-key
+	// gat/gats and the time the mark expires at, it's only used if the fallback of
+	// gat/gats is enabled.
+	noMultiKeyGetAndTouch map[*Addr]time.Time
+	// asyncs holds the Asyncs of the client which are not closed yet, they're
+	// closed along with the client.
+	asyncs map[*Async]struct{}
+
+	// runtime holds the options which could be updated by UpdateOptions, they
+	// should be read from it rather than options.
+	runtime atomic.Pointer[runtimeOptions]
+
+	// hitCounters holds the *hitCounter of each memcached server by its address.
+	hitCounters sync.Map
+}
 
-	// telemetry holds the OpenTelemetry tracers and metrics.
-	tracer  *telemetry.Tracer
-	metrics *telemetry.Metrics
+func newClientState() *clientState {
+	return &clientState{
+		connPools:             make(map[*Addr]*shardedPool, 4),
+		multiplexers:          make(map[*Addr]*multiplexer, 4),
+		capabilities:          make(map[*Addr]*capabilities, 4),
+		settings:              make(map[*Addr]*ServerSettings, 4),
+		scheduledFlushes:      make(map[*Addr]time.Time, 4),
+		noMultiKeyGetAndTouch: make(map[*Addr]time.Time, 4),
+		asyncs:                make(map[*Async]struct{}),
+	}
 }
 
 // New creates a new memcached client with the given address and options.
@@ -55,46 +151,172 @@ type client struct {
 // The Cluster mode means that the client can connect to multiple memcached instances
 // and automatically pick a memcached instance to execute a command, of course,
 // the client makes sure that the same key will be executed on the same memcached instance.
-// Be careful, there are some `keys` command does not obey this rule, such as `gets`, `gats`.
+// The multi-key commands such as `gets` and `gats` are split by the instances of
+// their keys, and sent to these instances concurrently.
 func New(addr string, opts ...ClientOption) (Client, error) {
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), defaultNewTimeout)
 	defer cancel()
-	return newClientWithContext(timeoutCtx, addr, opts...)
+	return NewWithContext(timeoutCtx, addr, opts...)
 }
 
-func newClientWithContext(_ context.Context, addr string, opts ...ClientOption) (Client, error) {
+// defaultNewTimeout bounds the resolution and the warm-up of the client created by
+// New and NewFromAddrs.
+const defaultNewTimeout = 5 * time.Second
+
+// NewWithContext is the same as New, but the resolution of the address and the
+// warm-up of the connections (see WithWarmUp) are bounded by ctx rather than the
+// timeout of 5 seconds, so that the caller controls how long the startup takes.
+// The resolvers implementing ContextResolver are given ctx, the others are not
+// waited for after ctx is done.
+func NewWithContext(ctx context.Context, addr string, opts ...ClientOption) (Client, error) {
 	options := newClientOptions()
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	addrs, err := options.resolver.Resolve(addr)
+	addrs, err := resolveContext(ctx, options.resolver, addr)
 	if err != nil {
 		return nil, errors.Wrap(err, "resolve failed")
 	}
 
+	c, err := newClient(ctx, options, addrs)
+	if err != nil {
+		return nil, err
+	}
+	if options.topologyRefresh > 0 {
+		c.(*client).startTopologyRefresh(addr)
+	}
+
+	return c, nil
+}
+
+// NewFromAddrs creates a new memcached client with the given addresses, it's the
+// same as New but skips the resolver, for the users who discover the memcached
+// instances by themselves, e.g. from a service registry:
+//
+//	addr := memcached.NewAddr("tcp", "10.0.0.1:11211", 0)
+//	addr.Weight = 2
+//	addr.Add("zone", "us-east-1a")
+//	client, err := memcached.NewFromAddrs([]*memcached.Addr{addr, ...})
+//
+// The addresses are used as they are, so the priorities of them should be unique,
+// see Addr.Priority. The slice is copied, but the addresses should not be modified
+// after the client is created. WithResolver is ignored.
+func NewFromAddrs(addrs []*Addr, opts ...ClientOption) (Client, error) {
+	options := newClientOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if err := validateAddrs(addrs); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultNewTimeout)
+	defer cancel()
+	return newClient(ctx, options, append([]*Addr(nil), addrs...))
+}
+
+// newClient creates a new memcached client with the resolved addresses, ctx bounds
+// the warm-up of the connections.
+func newClient(ctx context.Context, options *clientOptions, addrs []*Addr) (Client, error) {
+	if options.configErr != nil {
+		return nil, options.configErr
+	}
 	if len(addrs) == 0 {
 		return nil, errors.Wrap(ErrInvalidAddress, "empty address")
 	}
-	picker := options.pickBuilder.Build(addrs)
+	if options.multiplexConns > 0 && (options.enableUDP || options.noReply) {
+		return nil, errors.Wrap(ErrInvalidArgument, "multiplexing mode does not support UDP or noreply")
+	}
+	for address, opts := range options.addrOptions {
+		for _, opt := range opts {
+			if opt == nil || !overridableByAddr(opt) {
+				return nil, errors.Wrapf(ErrInvalidArgument, "option of %s could not be overridden by address", address)
+			}
+		}
+	}
+	if options.proxyProtocol > ProxyProtocolV2 {
+		return nil, errors.Wrapf(ErrInvalidArgument, "proxy protocol %s", options.proxyProtocol)
+	}
+	if options.transformer != nil {
+		options.codec = transformCodec{Codec: options.codec, transformer: options.transformer}
+	}
+	if options.checksum != ChecksumNone {
+		options.codec = checksumCodec{Codec: options.codec, algorithm: options.checksum}
+	}
+	if options.flagsPolicy != nil {
+		options.codec = flagsPolicyCodec{Codec: options.codec, policy: options.flagsPolicy}
+	}
+	if options.autoTune && options.maxItemSize == 0 {
+		options.maxItemSize = DetectMaxItemSize
+	}
+
+	var globalBucket *tokenBucket
+	if options.globalRateLimit > 0 {
+		globalBucket = newTokenBucket(options.globalRateLimit, options.globalRateBurst)
+	}
+
+	var adaptive *adaptiveTimeout
+	if options.adaptiveTimeout {
+		adaptive = newAdaptiveTimeout(addrs,
+			options.adaptiveMultiplier, options.adaptiveMinTimeout, options.adaptiveMaxTimeout)
+	}
 
 	// Initialize telemetry
 	cfg := telemetry.NewConfig(options.telemetryOptions...)
 
-	return &client{
+	c := &client{
 		options: options,
-		addrs:   addrs,
-		picker:  picker,
 
-		mu:        sync.Mutex{},
-		connPools: make(map[*Addr]*connPool, 4),
+		globalBucket: globalBucket,
+		adaptive:     adaptive,
 
 		tracer:  cfg.Tracer(),
 		metrics: cfg.Metrics(),
-	}, nil
+
+		clientState: newClientState(),
+	}
+	c.topo.Store(newTopology(options, addrs, nil))
+	if options.readYourWrites > 0 {
+		c.dirty = newDirtyKeys(options.readYourWrites)
+	}
+	if options.protocolErrorCapture > 0 {
+		c.protocolErrors = newProtocolErrorRing(options.protocolErrorCapture)
+	}
+	c.runtime.Store(newRuntimeOptions(options))
+	if options.eagerConnect {
+		if err := c.eagerConnect(ctx); err != nil {
+			_ = c.Close()
+			return nil, errors.Wrap(err, "eager connect failed")
+		}
+	}
+	c.warmUp(ctx)
+
+	return c, nil
 }
 
 func (c *client) Close() error {
+	if c.derived {
+		return nil
+	}
+	// the refresh is stopped first, since it updates the topology under mu.
+	if c.stopRefresh != nil {
+		c.stopRefresh()
+	}
+
+	// the Asyncs flush their queued commands before the connections are closed,
+	// they're closed without mu since the flushes acquire the connections under it.
+	c.mu.Lock()
+	asyncs := make([]*Async, 0, len(c.asyncs))
+	for a := range c.asyncs {
+		asyncs = append(asyncs, a)
+	}
+	c.mu.Unlock()
+	for _, a := range asyncs {
+		_ = a.Close()
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -103,10 +325,56 @@ func (c *client) Close() error {
 			return errors.Wrap(err, "Close")
 		}
 	}
+	for _, m := range c.multiplexers {
+		if err := m.close(); err != nil {
+			return errors.Wrap(err, "Close")
+		}
+	}
 
 	return nil
 }
 
+func (c *client) PoolStats() map[string]*PoolStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make(map[string]*PoolStats, len(c.connPools))
+	for addr, pool := range c.connPools {
+		s := pool.stats()
+		s.ReadTimeout = c.readTimeout(addr)
+		s.BufferedBytes = s.TotalConns * (c.options.connReaderSize + c.options.connWriterSize)
+		stats[addr.Address] = s
+	}
+
+	t := c.topology()
+	for addr, l := range t.limiters {
+		s, ok := stats[addr.Address]
+		if !ok {
+			if l.inFlight() == 0 && l.shed.Load() == 0 {
+				continue
+			}
+			s = &PoolStats{}
+			stats[addr.Address] = s
+		}
+		s.InFlightRequests = l.inFlight()
+		s.ShedRequests = l.shed.Load()
+	}
+
+	for addr, b := range t.breakers {
+		s, ok := stats[addr.Address]
+		if !ok {
+			if b.failedOpen.Load() == 0 {
+				continue
+			}
+			s = &PoolStats{}
+			stats[addr.Address] = s
+		}
+		s.FailedOpenRequests = b.failedOpen.Load()
+	}
+
+	return stats
+}
+
 // getConn returns a true connection from the pool.
 func (c *client) getConn(ctx context.Context, addr *Addr) (memcachedConn, error) {
 	c.mu.Lock()
@@ -117,38 +385,21 @@ func (c *client) getConn(ctx context.Context, addr *Addr) (memcachedConn, error)
 		return cn, err
 	}
 
-	wrapNewConn := func(ctx2 context.Context) (cn memcachedConn, err error) {
-		switch addr.Network {
-		case
-			"tcp", "tcp4", "tcp6",
-			"unix",
-			"udp", "udp4", "udp6":
-		default:
-			return nil, ErrInvalidNetworkProtocol
-		}
-
-		cn, err = newConnContext(ctx2, addr, c.options.dialTimeout)
-		if err != nil {
-			return nil, errors.Wrap(err, "newConnContext failed")
-		}
-
-		// SASL auth if enabled
-		if c.options.enableSASL {
-			if err = authSASL(cn, c.options.plainUsername, c.options.plainPassword); err != nil {
-				_ = cn.Close()
-				return nil, err
-			}
-		}
-
-		return cn, nil
+	wrapNewConn := func(ctx2 context.Context) (memcachedConn, error) {
+		return c.dialConn(ctx2, addr)
 	}
 
 	// could not find a pool for the given addr, create a new one
-	pool = newConnPool(
-		c.options.maxIdleConns, c.options.maxConns,
-		c.options.maxLifetime, c.options.maxIdleTimeout,
+	r := c.runtime.Load().of(addr)
+	pool = newShardedPool(
+		c.options.poolShards,
+		r.maxIdleConns, r.maxConns,
+		r.maxLifetime, r.maxIdleTimeout,
 		wrapNewConn,
 	)
+	pool.setWaitTimeout(r.poolWaitTimeout)
+	pool.setLiveness(c.livenessCheckOf(addr))
+	pool.setClock(c.now)
 	c.connPools[addr] = pool
 	c.mu.Unlock()
 
@@ -156,14 +407,130 @@ func (c *client) getConn(ctx context.Context, addr *Addr) (memcachedConn, error)
 	return cn, err
 }
 
-type callFunc func(ctx context.Context, conn memcachedConn) error
+// dialConn creates a new connection to the given addr, and authenticates it
+// or detects the capabilities of the server if needed.
+func (c *client) dialConn(ctx context.Context, addr *Addr) (cn memcachedConn, err error) {
+	switch addr.Network {
+	case
+		"tcp", "tcp4", "tcp6",
+		"unix",
+		"udp", "udp4", "udp6":
+	default:
+		return nil, ErrInvalidNetworkProtocol
+	}
+
+	raw, err := newConnContext(ctx, addr, c.dialTimeout(addr), c.options.dialer,
+		c.options.connReaderSize, c.options.connWriterSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "newConnContext failed")
+	}
+	cn = raw
+
+	if err = c.tuneConn(raw.raw); err != nil {
+		_ = cn.Close()
+		return nil, err
+	}
+
+	// the PROXY header must be the first bytes of the TCP connection.
+	if c.options.proxyProtocol != ProxyProtocolNone && !isUDPNetwork(addr) {
+		if err = c.sendProxyHeader(ctx, addr, raw); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+
+	// SASL auth if enabled
+	if sasl := c.saslOf(addr); sasl.enableSASL {
+		if err = authSASL(cn, sasl.plainUsername, sasl.plainPassword); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+
+	// detect capabilities once per server by the first connection.
+	if c.shouldDetectCapabilities(addr) {
+		caps, err := detectCapabilities(ctx, addr, cn, c)
+		if err != nil {
+			_ = cn.Close()
+			return nil, errors.Wrap(err, "detect capabilities failed")
+		}
+		c.setCapabilities(addr, caps)
+	}
+	if c.shouldDetectSettings(addr) {
+		settings, err := detectSettings(ctx, addr, cn, c)
+		if err != nil {
+			_ = cn.Close()
+			return nil, errors.Wrap(err, "detect settings failed")
+		}
+		c.setSettings(addr, settings)
+	}
+
+	return cn, nil
+}
+
+// getMultiplexer returns the multiplexer of the given addr, it creates one if not exists.
+func (c *client) getMultiplexer(addr *Addr) *multiplexer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.multiplexers[addr]
+	if !ok {
+		m = newMultiplexer(
+			c.options.multiplexConns,
+			func() (time.Duration, time.Duration) { return c.muxTimeouts(addr) },
+			muxCoalescing{window: c.options.coalesceWindow, maxBatch: c.options.coalesceMaxBatch},
+			func(ctx context.Context) (memcachedConn, error) {
+				return c.dialConn(ctx, addr)
+			},
+		)
+		c.multiplexers[addr] = m
+	}
+
+	return m
+}
+
+// useMultiplexer reports whether the requests to the given addr should be
+// dispatched by the multiplexer rather than the connection pool.
+func (c *client) useMultiplexer(addr *Addr) bool {
+	return c.options.multiplexConns > 0 && !isUDPNetwork(addr)
+}
+
+// dispatchMultiplexed sends the request over a multiplexed connection and receives the response.
+func (c *client) dispatchMultiplexed(ctx context.Context, addr *Addr, req *request, resp *response) error {
+	m := c.getMultiplexer(addr)
+	sess, err := m.session(ctx)
+	if err != nil {
+		return errors.Wrap(err, "alloc connection failed")
+	}
+
+	if err = c.checkCapability(addr, req.cmd); err != nil {
+		return err
+	}
+	if err = c.checkItemSize(addr, req.itemSize); err != nil {
+		return err
+	}
+
+	c.applyCompatibility(resp)
+
+	return m.roundTrip(ctx, sess, req, resp)
+}
+
+type callFunc func(ctx context.Context, addr *Addr, conn memcachedConn) error
+
+func (c *client) autoSwitchToUDP(_ context.Context, addr *Addr, req *request, resp *response) {
+	enabled := c.udpEnabled(addr)
+	req.udpEnabled = enabled
+	resp.udpEnabled = enabled
+}
 
-func (c *client) autoSwitchToUDP(_ context.Context, req *request, resp *response) {
-	req.udpEnabled = c.options.enableUDP
-	resp.udpEnabled = c.options.enableUDP
+// applyCompatibility adjusts the response according to the compatibility mode.
+func (c *client) applyCompatibility(resp *response) {
+	resp.lenientFaultLine = c.options.compatibility.quirks().lenientFaultLine
 }
 
-func (c *client) broadcastRequest(ctx context.Context, call callFunc) error {
+// broadcastRequest calls call with a connection to each memcached server
+// concurrently, the errors are wrapped in CommandError with cmd.
+func (c *client) broadcastRequest(ctx context.Context, cmd string, call callFunc) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -172,9 +539,13 @@ func (c *client) broadcastRequest(ctx context.Context, call callFunc) error {
 
 	wg := sync.WaitGroup{}
 
-	errCh := make(chan error, len(c.addrs))
+	addrs := c.topology().addrs
+	if addr := nodeFrom(ctx); addr != nil {
+		addrs = []*Addr{addr}
+	}
+	errCh := make(chan error, len(addrs))
 
-	for _, addr := range c.addrs {
+	for _, addr := range addrs {
 		wg.Add(1)
 		addrCopy := addr
 		go func() {
@@ -182,13 +553,13 @@ func (c *client) broadcastRequest(ctx context.Context, call callFunc) error {
 
 			cn, err := c.getConn(ctx, addrCopy)
 			if err != nil {
-				errCh <- err
+				errCh <- newCommandError(addrCopy, []byte(cmd), nil, err)
 				return
 			}
-			defer func() { _ = cn.release() }()
-
-			if err = call(ctx, cn); err != nil {
-				errCh <- err
+			err = call(ctx, addrCopy, cn)
+			releaseConn(cn, err)
+			if err != nil {
+				errCh <- newCommandError(addrCopy, []byte(cmd), nil, err)
 			}
 		}()
 	}
@@ -211,11 +582,38 @@ func (c *client) dispatchRequest(ctx context.Context, req *request, resp *respon
 	default:
 	}
 
-	addr, err := c.picker.Pick(c.addrs, req.cmd, req.key)
+	// the commands without key, e.g. mn, are sent over the connection of WithConn.
+	if pin := pinnedConnFrom(ctx); pin != nil && len(req.key) == 0 {
+		return c.dispatchRequestTo(ctx, pin.addr, req, resp)
+	}
+
+	addr, err := c.pick(ctx, req.cmd, req.key)
 	if err != nil {
 		return errors.Wrap(err, "pick node failed")
 	}
 
+	return c.dispatchRequestTo(ctx, addr, req, resp)
+}
+
+// pick picks the memcached server of the key, the hash tag of the key is used
+// instead of the key if it's enabled. The server targeted by DoOnNode is picked
+// for any key.
+func (c *client) pick(ctx context.Context, cmd, key []byte) (*Addr, error) {
+	if addr := nodeFrom(ctx); addr != nil {
+		return addr, nil
+	}
+	if tag := c.options.hashTag; tag != nil {
+		key = hashTagKey(key, tag[0], tag[1])
+	}
+
+	t := c.topology()
+	return t.picker.Pick(t.addrs, cmd, key)
+}
+
+// dispatchRequestTo sends the request to the memcached server at given address
+// and receives the response, it's used when the address is picked by the caller,
+// e.g. the keys of a multi-key command are grouped by their nodes.
+func (c *client) dispatchRequestTo(ctx context.Context, addr *Addr, req *request, resp *response) (err error) {
 	// START: Telemetry
 	start := time.Now()
 	var span trace.Span
@@ -224,41 +622,235 @@ func (c *client) dispatchRequest(ctx context.Context, req *request, resp *respon
 	}
 	// END: Telemetry
 
+	defer func() {
+		if err != nil {
+			err = newCommandError(addr, req.cmd, req.key, err)
+		}
+	}()
+	t := c.topology()
+	if b := t.breakers[addr]; b != nil {
+		defer func() { err = c.failOpen(b, req, resp, err) }()
+		if b.down(c.now()) {
+			err = ErrNodeDown
+			c.observe(ctx, span, req, addr, start, err)
+			return err
+		}
+	}
+
+	if err = c.limitRate(ctx, addr); err != nil {
+		c.observe(ctx, span, req, addr, start, err)
+		return err
+	}
+
+	if l := t.limiters[addr]; l != nil {
+		if err = l.acquire(ctx); err != nil {
+			c.observe(ctx, span, req, addr, start, err)
+			return err
+		}
+		defer l.release()
+	}
+
+	if l := c.options.wireLogger; l != nil {
+		defer func() { l.log(addr, req, resp, err) }()
+	}
+	if r := c.protocolErrors; r != nil {
+		defer func() { r.capture(addr, req, resp, err) }()
+	}
+	resp.addr = addr
+
+	if pin := pinnedConnFrom(ctx); pin != nil {
+		err = c.dispatchPinned(ctx, pin, addr, req, resp)
+		c.observe(ctx, span, req, addr, start, err)
+		return err
+	}
+
+	if c.useMultiplexer(addr) {
+		err = c.dispatchMultiplexed(ctx, addr, req, resp)
+		c.observe(ctx, span, req, addr, start, err)
+		return err
+	}
+
+	if c.dirty != nil {
+		if err = c.awaitWrites(ctx, addr, req); err != nil {
+			c.observe(ctx, span, req, addr, start, err)
+			return errors.Wrap(err, "await noreply writes failed")
+		}
+	}
+
 	cn, err := c.getConn(ctx, addr)
 	if err != nil {
-		if c.tracer != nil {
-			c.tracer.End(span, err)
-		}
-		if c.metrics != nil {
-			c.metrics.RecordDuration(context.Background(), string(req.cmd), addr.Address, time.Since(start), err)
+		if b := t.breakers[addr]; b != nil && isUnavailable(err) {
+			b.trip(c.now())
 		}
+		c.observe(ctx, span, req, addr, start, err)
 		return errors.Wrap(err, "alloc connection failed")
 	}
-	defer func() { _ = cn.release() }()
+	replayable := c.replayable(req, resp)
+	// the connection is out of sync with the server if the request or the response
+	// is not transferred completely, so that it must not be reused.
+	broken, err := c.roundTrip(ctx, addr, cn, req, resp)
+	if broken && replayable && staleConn(cn, err) {
+		pool := cn.getConnPool()
+		pool.discard(cn)
+		if cn, broken, err = c.replay(ctx, addr, pool, req, resp); cn == nil {
+			c.observe(ctx, span, req, addr, start, err)
+			return err
+		}
+	}
+	if broken {
+		cn.getConnPool().discard(cn)
+	} else {
+		_ = cn.release()
+	}
+	c.observe(ctx, span, req, addr, start, err)
+
+	return err
+}
+
+// roundTrip sends the request over the connection to the memcached server at addr
+// and receives the response. broken is true if the connection is out of sync with
+// the server, so that it must not be reused.
+func (c *client) roundTrip(
+	ctx context.Context, addr *Addr, cn memcachedConn, req *request, resp *response,
+) (broken bool, err error) {
+	if err = c.checkCapability(addr, req.cmd); err != nil {
+		return false, err
+	}
+	if err = c.checkItemSize(addr, req.itemSize); err != nil {
+		return false, err
+	}
 
-	c.autoSwitchToUDP(ctx, req, resp)
+	c.autoSwitchToUDP(ctx, addr, req, resp)
+	c.applyCompatibility(resp)
+	fenced := c.fenceNoReply(cn, req, resp)
+	noReply := resp.endIndicator == endIndicatorNoReply
 
-	if err = req.send(ctx, cn, c.options.writeTimeout); err != nil {
-		if c.tracer != nil {
-			c.tracer.End(span, err)
+	sent := c.now()
+	if err = req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
+		return true, errors.Wrap(err, "send failed")
+	}
+
+	readTimeout := c.readTimeout(addr)
+	err = resp.recv(ctx, cn, readTimeout)
+	if c.adaptive != nil {
+		switch {
+		case err == nil || isInSyncError(err):
+			c.adaptive.observe(addr, c.now().Sub(sent))
+		case errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() == nil:
+			// the latency of the timed out request is at least the deadline, it's
+			// recorded as a censored sample at the deadline rather than dropped, so
+			// that the timeout is not biased toward the requests answered in time.
+			c.adaptive.observe(addr, readTimeout)
 		}
-		if c.metrics != nil {
-			c.metrics.RecordDuration(context.Background(), string(req.cmd), addr.Address, time.Since(start), err)
+	}
+	if fenced {
+		err = c.verifiedNoReply(addr, resp, err)
+	}
+	if c.dirty != nil && (err == nil || isInSyncError(err)) {
+		if ferr := c.trackWrite(ctx, addr, cn, req, noReply); ferr != nil {
+			return true, errors.Wrap(ferr, "fence noreply write failed")
 		}
-		return errors.Wrap(err, "send failed")
 	}
 
-	recvErr := resp.recv(ctx, cn, c.options.readTimeout)
+	return resp.desynced(err), err
+}
 
-	// END: Telemetry
+// releaseConn puts the connection back to its pool after a command, or discards it
+// if the command failed with the error which may leave the reply unread, e.g. a
+// timeout, so that the rest of the reply is never read by the next command.
+func releaseConn(cn memcachedConn, err error) {
+	if err != nil && !isInSyncError(err) && !errors.Is(err, ErrNotSupported) {
+		cn.getConnPool().discard(cn)
+		return
+	}
+
+	_ = cn.release()
+}
+
+// limitRate takes a token from the rate limit buckets of the memcached server at
+// addr, it waits for the token if WithRateLimitWait is set.
+func (c *client) limitRate(ctx context.Context, addr *Addr) error {
+	buckets := c.topology().buckets
+	if c.globalBucket == nil && buckets == nil {
+		return nil
+	}
+
+	taken := make([]*tokenBucket, 0, 2)
+	for _, b := range []*tokenBucket{c.globalBucket, buckets[addr]} {
+		if b == nil {
+			continue
+		}
+
+		var err error
+		if c.options.rateLimitWait {
+			err = b.wait(ctx)
+		} else if _, ok := b.take(false); !ok {
+			err = ErrRateLimited
+		}
+		if err != nil {
+			// the token of the other bucket is not used.
+			for _, t := range taken {
+				t.refund()
+			}
+			return err
+		}
+		taken = append(taken, b)
+	}
+
+	return nil
+}
+
+// readTimeout returns the read timeout of requests to the memcached server at addr.
+func (c *client) readTimeout(addr *Addr) time.Duration {
+	// the read timeout overridden by With takes precedence over the adaptive one.
+	if c.adaptive == nil || c.readTimeoutOverride > 0 {
+		return c.baseReadTimeout(addr)
+	}
+
+	return c.adaptive.timeout(addr, c.baseReadTimeout(addr))
+}
+
+// muxTimeouts returns the read and write timeouts of the multiplexed connections
+// to the memcached server at addr.
+func (c *client) muxTimeouts(addr *Addr) (readTimeout, writeTimeout time.Duration) {
+	r := c.runtime.Load().of(addr)
+	return r.readTimeout, r.writeTimeout
+}
+
+// observe ends the span and records the metrics of the finished request, then
+// calls the request hooks.
+func (c *client) observe(ctx context.Context, span trace.Span, req *request, addr *Addr, start time.Time, err error) {
 	if c.tracer != nil {
-		c.tracer.End(span, recvErr)
+		c.tracer.End(span, err)
 	}
+
+	duration := time.Since(start)
 	if c.metrics != nil {
-		c.metrics.RecordDuration(context.Background(), string(req.cmd), addr.Address, time.Since(start), recvErr)
+		c.metrics.RecordDuration(context.Background(), string(req.cmd), addr.Address, duration, err)
+	}
+	if len(c.options.requestHooks) == 0 {
+		return
+	}
+
+	info := &RequestInfo{
+		Command:  string(req.cmd),
+		Addr:     addr.Address,
+		Duration: duration,
+		Err:      err,
+	}
+	for _, hook := range c.options.requestHooks {
+		hook(ctx, info)
 	}
+}
 
-	return recvErr
+// isInSyncError reports whether the error is replied by the server as a whole
+// response, so that the connection is still in sync with the requests.
+func isInSyncError(err error) bool {
+	return errors.Is(err, ErrNotFound) ||
+		errors.Is(err, ErrExists) ||
+		errors.Is(err, ErrNotStored) ||
+		errors.Is(err, ErrNonexistentCommand) ||
+		errors.Is(err, ErrServerError)
 }
 
 // authSASL performs the Binary SASL authentication.
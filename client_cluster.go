@@ -1,9 +1,16 @@
 package memcached
 
 import (
+	"bytes"
+	"context"
 	"hash/crc32"
+	"math"
+	"math/rand/v2"
 	"net"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 
@@ -16,10 +23,14 @@ var (
 	_ Builder = crc32HashPickBuilder{}
 	_ Builder = murmur3HashPickBuilder{}
 	_ Builder = rendezvousHashPickBuilder{}
+	_ Builder = roundRobinPickBuilder{}
+	_ Builder = weightedRandomPickBuilder{}
 
 	_ Picker = &crc32HashPicker{}
 	_ Picker = &murmur3HashPicker{}
 	_ Picker = &rendezvousHashPicker{}
+	_ Picker = &roundRobinPicker{}
+	_ Picker = &weightedRandomPicker{}
 )
 
 // Resolver is responsible for resolving a given address
@@ -31,12 +42,39 @@ type Resolver interface {
 	Resolve(addr string) ([]*Addr, error)
 }
 
+// ContextResolver is implemented by the resolvers which could be canceled, e.g. by
+// the context given to NewWithContext.
+type ContextResolver interface {
+	Resolver
+
+	ResolveContext(ctx context.Context, addr string) ([]*Addr, error)
+}
+
 // Picker is responsible for picking a given key to a specific Addr
 // while considering the cluster state.
 type Picker interface {
 	Pick(addr []*Addr, cmd, key []byte) (*Addr, error)
 }
 
+// hashTagKey returns the hash tag of the key which is delimited by open and close,
+// the first open and the first close after it are used as Redis does. The key is
+// returned as it is if there is no hash tag or the tag is empty.
+//
+// e.g. "{user:123}:profile" => "user:123", "{}:profile" => "{}:profile"
+func hashTagKey(key []byte, open, close byte) []byte {
+	start := bytes.IndexByte(key, open)
+	if start < 0 {
+		return key
+	}
+
+	end := bytes.IndexByte(key[start+1:], close)
+	if end <= 0 {
+		return key
+	}
+
+	return key[start+1 : start+1+end]
+}
+
 // Builder is responsible for building a Picker from a given list of Addr.
 type Builder interface {
 	Build(addrs []*Addr) Picker
@@ -48,6 +86,9 @@ type Builder interface {
 // it will return a list of Addr with only one Addr.
 // If the given address is "localhost:11211,localhost:11212",
 // it will return a list of Addr with two Addr.
+//
+// The weight of each address could be set by the query "weight", e.g.
+// "localhost:11211?weight=3,localhost:11212".
 type defaultResolver struct{}
 
 func (r defaultResolver) Resolve(addr string) ([]*Addr, error) {
@@ -64,12 +105,19 @@ func (r defaultResolver) Resolve(addr string) ([]*Addr, error) {
 			continue
 		}
 
+		address, weight, err := parseAddrWeight(address)
+		if err != nil {
+			return nil, err
+		}
+
 		network, resolvedAddr, err := r.resolveAddr(address)
 		if err != nil {
 			return nil, err
 		}
 
-		result = append(result, NewAddr(network, resolvedAddr, idx))
+		addr := NewAddr(network, resolvedAddr, idx)
+		addr.Weight = weight
+		result = append(result, addr)
 	}
 
 	if len(result) == 0 {
@@ -79,6 +127,36 @@ func (r defaultResolver) Resolve(addr string) ([]*Addr, error) {
 	return result, nil
 }
 
+// parseAddrWeight cuts the query off the address, and parses the weight from it.
+// The weight is 0 if the query is absent, e.g.
+//
+// localhost:11211?weight=3 => localhost:11211, 3
+func parseAddrWeight(address string) (string, int, error) {
+	address, rawQuery, ok := strings.Cut(address, "?")
+	if !ok {
+		return address, 0, nil
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", 0, errors.Wrapf(ErrInvalidAddress, "invalid query of address %s: %v", address, err)
+	}
+
+	weight := 0
+	for name, values := range query {
+		if name != "weight" {
+			return "", 0, errors.Wrapf(ErrInvalidAddress, "unknown query %q of address %s", name, address)
+		}
+
+		weight, err = strconv.Atoi(values[len(values)-1])
+		if err != nil || weight < 1 {
+			return "", 0, errors.Wrapf(ErrInvalidAddress, "weight of address %s must be a positive integer", address)
+		}
+	}
+
+	return address, weight, nil
+}
+
 // resolveAddr resolves single network address, supports tcp, udp and unix socket format.
 func (r defaultResolver) resolveAddr(address string) (network, addr string, err error) {
 	address = strings.TrimSpace(address)
@@ -128,7 +206,7 @@ func (p *crc32HashPicker) Pick(addrs []*Addr, _, key []byte) (*Addr, error) {
 	}
 
 	sum := crc32.ChecksumIEEE(key)
-	return addrs[sum%uint32(n)], nil
+	return pickWeightedBucket(addrs, uint64(sum)), nil
 }
 
 type crc32HashPickBuilder struct{}
@@ -157,7 +235,27 @@ func (p *murmur3HashPicker) Pick(addrs []*Addr, _, key []byte) (*Addr, error) {
 	}
 
 	sum := p.hash(key)
-	return addrs[sum%uint64(n)], nil
+	return pickWeightedBucket(addrs, sum), nil
+}
+
+// pickWeightedBucket picks the address by the hash sum of key from the buckets,
+// each address owns as many adjacent buckets as its weight. If all weights are 1,
+// it's the same as addrs[sum%len(addrs)].
+func pickWeightedBucket(addrs []*Addr, sum uint64) *Addr {
+	total := 0
+	for _, addr := range addrs {
+		total += addr.weight()
+	}
+
+	bucket := int(sum % uint64(total))
+	for _, addr := range addrs {
+		if bucket < addr.weight() {
+			return addr
+		}
+		bucket -= addr.weight()
+	}
+
+	return addrs[len(addrs)-1]
 }
 
 type murmur3HashPickBuilder struct {
@@ -199,6 +297,10 @@ type rendezvousHashPicker struct {
 }
 
 func (p *rendezvousHashPicker) Pick(addrs []*Addr, _, key []byte) (*Addr, error) {
+	if hasWeights(addrs) {
+		return p.pickWeighted(addrs, key)
+	}
+
 	highest := uint64(0)
 	var winner int
 
@@ -228,6 +330,42 @@ func (p *rendezvousHashPicker) score(addr *Addr, key []byte) uint64 {
 	return p.hash(_key)
 }
 
+// pickWeighted picks the address with the highest weighted score, the score is
+// scaled by the weight as -weight/ln(hash/2^64), so that the probability of an
+// address to win is proportional to its weight.
+func (p *rendezvousHashPicker) pickWeighted(addrs []*Addr, key []byte) (*Addr, error) {
+	if len(addrs) == 0 {
+		return nil, errors.Wrap(ErrInvalidAddress, "no available address")
+	}
+
+	highest := math.Inf(-1)
+	var winner int
+
+	for idx, addr := range addrs {
+		// map the hash into (0, 1) to avoid ln(0).
+		x := (float64(p.score(addr, key)>>11) + 0.5) / (1 << 53)
+		score := -float64(addr.weight()) / math.Log(x)
+
+		if score > highest || (score == highest && addr.Priority > addrs[winner].Priority) {
+			highest = score
+			winner = idx
+		}
+	}
+
+	return addrs[winner], nil
+}
+
+// hasWeights reports whether any of the addresses has a weight other than 1.
+func hasWeights(addrs []*Addr) bool {
+	for _, addr := range addrs {
+		if addr.weight() != 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
 type rendezvousHashPickBuilder struct {
 	hash func(key []byte) uint64
 }
@@ -251,3 +389,122 @@ func (b rendezvousHashPickBuilder) Build(_ []*Addr) Picker {
 		hash: b.hash,
 	}
 }
+
+// WhichNode returns the memcached server the key is picked to, with the hash tag
+// applied, it's for debugging the distribution of the keys, e.g. a hot node. The
+// pickers without key affinity, e.g. roundRobinPicker, return one pick of theirs.
+func (c *client) WhichNode(key string) (*Addr, error) {
+	if err := validateKeyAndValue([]byte(key), nil); err != nil {
+		return nil, err
+	}
+
+	return c.pick(context.Background(), []byte("get"), []byte(key))
+}
+
+// KeyDistribution is the number of the keys picked to each memcached server.
+type KeyDistribution struct {
+	// Counts holds the number of keys of each server, including the ones without keys.
+	Counts map[*Addr]int
+	// Total is the number of keys counted.
+	Total int
+}
+
+// Imbalance returns the ratio of the most loaded server's keys to its fair share
+// by weight, 1 means the keys are spread perfectly, and 2 means a server takes
+// twice as many keys as it should. It's 0 if no key is counted.
+func (d *KeyDistribution) Imbalance() float64 {
+	if d.Total == 0 {
+		return 0
+	}
+
+	totalWeight := 0
+	for addr := range d.Counts {
+		totalWeight += addr.weight()
+	}
+
+	imbalance := 0.0
+	for addr, count := range d.Counts {
+		share := float64(d.Total) * float64(addr.weight()) / float64(totalWeight)
+		imbalance = max(imbalance, float64(count)/share)
+	}
+
+	return imbalance
+}
+
+// Distribution picks each key to its memcached server and counts the keys of each
+// server, so that a Picker could be validated to spread the keys evenly before it's
+// rolled out, e.g. with a sample of the production keys.
+func (c *client) Distribution(keys []string) (*KeyDistribution, error) {
+	addrs := c.topology().addrs
+	d := &KeyDistribution{Counts: make(map[*Addr]int, len(addrs))}
+	for _, addr := range addrs {
+		d.Counts[addr] = 0
+	}
+
+	for _, key := range keys {
+		addr, err := c.WhichNode(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pick %s", key)
+		}
+		d.Counts[addr]++
+		d.Total++
+	}
+
+	return d, nil
+}
+
+// The roundRobinPicker is the implementation of Picker which picks the addresses in
+// turn regardless of the key, each address is picked as many times in a row as its
+// weight.
+//
+// NOTE: there is no key affinity, a key is read from another server than the one it's
+// written to most likely. It's only for the workloads spreading the writes without
+// reading them back from the same client, e.g. warming the caches.
+type roundRobinPicker struct {
+	next atomic.Uint64
+}
+
+func (p *roundRobinPicker) Pick(addrs []*Addr, _, _ []byte) (*Addr, error) {
+	if len(addrs) == 0 {
+		return nil, errors.Wrap(ErrInvalidAddress, "no available address")
+	}
+
+	return pickWeightedBucket(addrs, p.next.Add(1)-1), nil
+}
+
+type roundRobinPickBuilder struct{}
+
+// NewRoundRobinPickBuilder creates a new Builder picking the addresses in turn, see
+// roundRobinPicker for the caveat.
+func NewRoundRobinPickBuilder() Builder {
+	return roundRobinPickBuilder{}
+}
+
+func (b roundRobinPickBuilder) Build(_ []*Addr) Picker {
+	return &roundRobinPicker{}
+}
+
+// The weightedRandomPicker is the implementation of Picker which picks a random
+// address regardless of the key, the probability of an address to be picked is
+// proportional to its weight. It has no key affinity as roundRobinPicker.
+type weightedRandomPicker struct{}
+
+func (p *weightedRandomPicker) Pick(addrs []*Addr, _, _ []byte) (*Addr, error) {
+	if len(addrs) == 0 {
+		return nil, errors.Wrap(ErrInvalidAddress, "no available address")
+	}
+
+	return pickWeightedBucket(addrs, rand.Uint64()), nil
+}
+
+type weightedRandomPickBuilder struct{}
+
+// NewWeightedRandomPickBuilder creates a new Builder picking a random address by the
+// weights, see weightedRandomPicker for the caveat.
+func NewWeightedRandomPickBuilder() Builder {
+	return weightedRandomPickBuilder{}
+}
+
+func (b weightedRandomPickBuilder) Build(_ []*Addr) Picker {
+	return &weightedRandomPicker{}
+}
@@ -1,10 +1,12 @@
 package memcached
 
 import (
+	"context"
 	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func newDefaultResolver() defaultResolver {
@@ -194,3 +196,291 @@ func Test_rendezvousHash_Pick_stable(t *testing.T) {
 	assert.NotNil(t, addr2)
 	assert.Equal(t, "localhost:11211", addr.Address)
 }
+
+func Test_hashTagKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "{user:123}:profile", want: "user:123"},
+		{key: "session:{user:123}", want: "user:123"},
+		{key: "{user:123}:{other}", want: "user:123"},
+		{key: "{}:profile", want: "{}:profile"},
+		{key: "}{user:123}", want: "user:123"},
+		{key: "{user:123", want: "{user:123"},
+		{key: "user:123", want: "user:123"},
+		{key: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(hashTagKey([]byte(tt.key), '{', '}')))
+		})
+	}
+}
+
+func Test_client_pickWithHashTag(t *testing.T) {
+	addrs, err := newDefaultResolver().Resolve("localhost:11211,localhost:11212,localhost:11213")
+	require.NoError(t, err)
+
+	options := &clientOptions{hashTag: &[2]byte{'{', '}'}, pickBuilder: NewRendezvousHashPickBuilder(0)}
+	c := &client{options: options, clientState: newClientState()}
+	c.topo.Store(newTopology(options, addrs, nil))
+
+	for i := 0; i < 100; i++ {
+		tag := "{user:" + strconv.Itoa(i) + "}"
+		want, err := c.pick(context.Background(), []byte("get"), []byte("user:"+strconv.Itoa(i)))
+		require.NoError(t, err)
+
+		for _, key := range []string{tag + ":profile", tag + ":settings", "cache:" + tag} {
+			got, err := c.pick(context.Background(), []byte("get"), []byte(key))
+			require.NoError(t, err)
+			assert.Same(t, want, got, key)
+		}
+	}
+}
+
+func Test_defaultResolver_ResolveWeight(t *testing.T) {
+	tests := []struct {
+		name        string
+		addr        string
+		wantWeights []int
+		wantErr     error
+	}{
+		{
+			name:        "weights",
+			addr:        "localhost:11211?weight=3,localhost:11212,unix:///tmp/memcached.sock?weight=2",
+			wantWeights: []int{3, 0, 2},
+		},
+		{
+			name:    "zero weight",
+			addr:    "localhost:11211?weight=0",
+			wantErr: ErrInvalidAddress,
+		},
+		{
+			name:    "invalid weight",
+			addr:    "localhost:11211?weight=x",
+			wantErr: ErrInvalidAddress,
+		},
+		{
+			name:    "unknown query",
+			addr:    "localhost:11211?priority=1",
+			wantErr: ErrInvalidAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := newDefaultResolver().Resolve(tt.addr)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			weights := make([]int, 0, len(addrs))
+			for _, addr := range addrs {
+				assert.NotContains(t, addr.Address, "?")
+				weights = append(weights, addr.Weight)
+			}
+			assert.Equal(t, tt.wantWeights, weights)
+		})
+	}
+}
+
+func Test_pickers_weighted(t *testing.T) {
+	addrs, err := newDefaultResolver().Resolve("localhost:11211?weight=3,localhost:11212,localhost:11213")
+	require.NoError(t, err)
+
+	builders := map[string]Builder{
+		"crc32":      NewCr32HashPickBuilder(),
+		"murmur3":    NewMurmur3HashPickBuilder(0),
+		"rendezvous": NewRendezvousHashPickBuilder(0),
+		"roundrobin": NewRoundRobinPickBuilder(),
+		"random":     NewWeightedRandomPickBuilder(),
+	}
+
+	const keys = 20000
+	for name, builder := range builders {
+		t.Run(name, func(t *testing.T) {
+			picker := builder.Build(addrs)
+
+			counts := make(map[string]int, len(addrs))
+			for i := 0; i < keys; i++ {
+				addr, err := picker.Pick(addrs, []byte("get"), []byte("key:"+strconv.Itoa(i)))
+				require.NoError(t, err)
+				counts[addr.Address]++
+			}
+
+			// the weights are 3:1:1.
+			assert.InDelta(t, keys*3/5, counts["localhost:11211"], keys*0.05)
+			assert.InDelta(t, keys/5, counts["localhost:11212"], keys*0.05)
+			assert.InDelta(t, keys/5, counts["localhost:11213"], keys*0.05)
+		})
+	}
+}
+
+func Test_roundRobinPicker_Pick(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+		want []string
+	}{
+		{
+			name: "equal",
+			addr: "localhost:11211,localhost:11212,localhost:11213",
+			want: []string{"localhost:11211", "localhost:11212", "localhost:11213", "localhost:11211"},
+		},
+		{
+			name: "weighted",
+			addr: "localhost:11211?weight=2,localhost:11212",
+			want: []string{"localhost:11211", "localhost:11211", "localhost:11212", "localhost:11211"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := newDefaultResolver().Resolve(tt.addr)
+			require.NoError(t, err)
+
+			picker := NewRoundRobinPickBuilder().Build(addrs)
+			got := make([]string, 0, len(tt.want))
+			for range tt.want {
+				// the same key is spread too.
+				addr, err := picker.Pick(addrs, []byte("set"), []byte("key"))
+				require.NoError(t, err)
+				got = append(got, addr.Address)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := NewRoundRobinPickBuilder().Build(nil).Pick(nil, []byte("set"), []byte("key"))
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func Test_client_WhichNode(t *testing.T) {
+	c, err := New("localhost:11211,localhost:11212,localhost:11213", WithHashTag('{', '}'))
+	require.NoError(t, err)
+	defer c.Close()
+
+	addr, err := c.WhichNode("{user:1}:profile")
+	require.NoError(t, err)
+	other, err := c.WhichNode("{user:1}:settings")
+	require.NoError(t, err)
+	assert.Same(t, addr, other)
+
+	_, err = c.WhichNode("")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func Test_client_Distribution(t *testing.T) {
+	tests := []struct {
+		name          string
+		addr          string
+		keys          int
+		wantImbalance float64
+		delta         float64
+	}{
+		{name: "no keys", addr: "localhost:11211,localhost:11212", keys: 0, wantImbalance: 0},
+		{name: "even", addr: "localhost:11211,localhost:11212,localhost:11213", keys: 3000, wantImbalance: 1, delta: 0.1},
+		{name: "weighted", addr: "localhost:11211?weight=3,localhost:11212", keys: 4000, wantImbalance: 1, delta: 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.addr)
+			require.NoError(t, err)
+			defer c.Close()
+
+			keys := make([]string, 0, tt.keys)
+			for i := 0; i < tt.keys; i++ {
+				keys = append(keys, "key:"+strconv.Itoa(i))
+			}
+
+			d, err := c.Distribution(keys)
+			require.NoError(t, err)
+			assert.Equal(t, tt.keys, d.Total)
+			assert.Len(t, d.Counts, len(c.(*client).topology().addrs))
+			assert.InDelta(t, tt.wantImbalance, d.Imbalance(), tt.delta)
+		})
+	}
+}
+
+func Test_KeyDistribution_Imbalance(t *testing.T) {
+	a, b := NewAddr("tcp", "localhost:11211", 0), NewAddr("tcp", "localhost:11212", 1)
+	d := &KeyDistribution{Counts: map[*Addr]int{a: 75, b: 25}, Total: 100}
+	assert.InDelta(t, 1.5, d.Imbalance(), 1e-9)
+}
+
+func Test_client_VersionAllAndServerInfo(t *testing.T) {
+	srv1, srv2, srv3 := newTestServer(t), newTestServer(t), newTestServer(t)
+	srv2.SetVersion("1.5.22")
+
+	c, err := New(srv1.Addr() + "," + srv2.Addr() + "," + srv3.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	addrs := c.(*client).topology().addrs
+
+	versions, err := c.VersionAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[*Addr]string{addrs[0]: "1.6.21", addrs[1]: "1.5.22", addrs[2]: "1.6.21"}, versions)
+
+	infos, err := c.ServerInfo(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 3)
+	assert.Equal(t, "1.5.22", infos[addrs[1]].Version)
+	assert.Equal(t, 64, infos[addrs[1]].PointerSize)
+	assert.GreaterOrEqual(t, int64(infos[addrs[1]].Uptime), int64(0))
+
+	// the servers which reply are returned along with the error.
+	srv3.Stop()
+	versions, err = c.VersionAll(ctx)
+	require.Error(t, err)
+	assert.Equal(t, map[*Addr]string{addrs[0]: "1.6.21", addrs[1]: "1.5.22"}, versions)
+
+	infos, err = c.ServerInfo(ctx)
+	require.Error(t, err)
+	assert.Len(t, infos, 2)
+	assert.NotContains(t, infos, addrs[2])
+}
+
+func Test_NewFromAddrs(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	srv2.SetVersion("1.5.22")
+
+	addr1 := NewAddr("tcp", srv1.Addr(), 0)
+	addr2 := &Addr{Network: "tcp", Address: srv2.Addr(), Priority: 1, Weight: 2}
+	addr2.Add("zone", "us-east-1a")
+
+	c, err := NewFromAddrs([]*Addr{addr1, addr2})
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the addresses are used as they are, without resolving.
+	assert.Equal(t, []*Addr{addr1, addr2}, c.(*client).topology().addrs)
+	assert.Equal(t, "us-east-1a", c.(*client).topology().addrs[1].GetMetadata("zone"))
+
+	versions, err := c.VersionAll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[*Addr]string{addr1: "1.6.21", addr2: "1.5.22"}, versions)
+
+	tests := []struct {
+		name  string
+		addrs []*Addr
+	}{
+		{name: "empty", addrs: nil},
+		{name: "nil address", addrs: []*Addr{addr1, nil}},
+		{name: "empty address", addrs: []*Addr{NewAddr("tcp", "", 0)}},
+		{name: "negative weight", addrs: []*Addr{{Network: "tcp", Address: srv1.Addr(), Weight: -1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFromAddrs(tt.addrs)
+			require.ErrorIs(t, err, ErrInvalidAddress)
+		})
+	}
+}
@@ -3,9 +3,12 @@ package memcached
 import (
 	"bytes"
 	"context"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+
+	memcodec "github.com/yeqown/memcached/codec"
 )
 
 type basicTextProtocolCommander interface {
@@ -45,6 +48,31 @@ type basicTextProtocolCommander interface {
 	// the server stores along with the data and sends back when the item is retrieved.
 	Cas(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64) error
 
+	// SetWithExpiration, AddWithExpiration, ReplaceWithExpiration, AppendWithExpiration,
+	// PrependWithExpiration and CasWithExpiration are the same as the commands above,
+	// but accept an Expiration which could be an absolute Unix timestamp, see FromDuration
+	// and FromUnix for more details.
+	SetWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error
+	AddWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error
+	ReplaceWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error
+	AppendWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error
+	PrependWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error
+	CasWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration, cas uint64) error
+
+	// SetItem, AddItem, ReplaceItem, AppendItem, PrependItem and CasItem are the same as
+	// the commands above, but are sent as meta set command in the corresponding mode, so
+	// that the new CAS and size of the stored item are returned in one round trip, rather
+	// than requiring a follow-up gets for the later check-and-set operations.
+	//
+	// They require the meta protocol, and always wait for the reply even if noReply mode
+	// is enabled. CasItem rejects the cas 0 with ErrInvalidArgument as DeleteCAS does.
+	SetItem(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error)
+	AddItem(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error)
+	ReplaceItem(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error)
+	AppendItem(ctx context.Context, key string, value []byte) (*MetaItem, error)
+	PrependItem(ctx context.Context, key string, value []byte) (*MetaItem, error)
+	CasItem(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64) (*MetaItem, error)
+
 	/**
 	Retrieval commands: get and gets
 	*/
@@ -71,12 +99,36 @@ type basicTextProtocolCommander interface {
 	// Be careful when using this command unless you are sure that
 	// all keys are stored in the same memcached instance.
 	GetAndTouches(ctx context.Context, expiry time.Duration, keys ...string) ([]*Item, error)
+	// GetAndTouchWithExpiration is the same as GetAndTouch, but accepts an Expiration.
+	GetAndTouchWithExpiration(ctx context.Context, expiry Expiration, key string) (*Item, error)
+	// GetAndTouchesWithExpiration is the same as GetAndTouches, but accepts an Expiration.
+	GetAndTouchesWithExpiration(ctx context.Context, expiry Expiration, keys ...string) ([]*Item, error)
+	// TouchAndGetMulti is used to get the values of the given keys and update the expiration
+	// time of each key to its own exptime, the exptime is the same as Expiration.
+	//
+	// The keys are grouped by their servers and then by their exptime, so that one gats
+	// command is sent for the keys of the same exptime in the same server. The items are
+	// returned by their keys, and the missing keys are absent rather than ErrNotFound.
+	TouchAndGetMulti(ctx context.Context, expiries map[string]uint32) (map[string]*Item, error)
+	// GetValue is the same as Get, but the value is borrowed from a buffer managed by
+	// the client rather than copied. The Value MUST be released, and its bytes MUST NOT
+	// be used after released, see Value.
+	GetValue(ctx context.Context, key string) (*Value, error)
+	// GetAndTouchValue is the same as GetAndTouch, but the value is borrowed like GetValue.
+	GetAndTouchValue(ctx context.Context, expiry time.Duration, key string) (*Value, error)
 	/**
 	Other commands: delete
 	*/
 
 	// Delete is used to delete the given key.
 	Delete(ctx context.Context, key string) error
+	// DeleteCAS is used to delete the given key only if its <cas unique> value is
+	// still cas, which could be got by Gets, so that the item which has been updated
+	// by others since the caller's last read would not be deleted. It returns
+	// ErrExists if the item has been updated, and ErrNotFound if the item is missing
+	// unless noReply mode is enabled. The cas 0 is rejected with ErrInvalidArgument,
+	// since it's never replied by the server, e.g. the CAS unique parsed leniently.
+	DeleteCAS(ctx context.Context, key string, cas uint64) error
 	// Incr is used to increment the value of the given key.
 	// If noReply mode is enabled, it will return 0.
 	Incr(ctx context.Context, key string, delta uint64) (uint64, error)
@@ -86,16 +138,17 @@ type basicTextProtocolCommander interface {
 	// Touch is used to update the expiration time of an existing item
 	// without fetching it.
 	Touch(ctx context.Context, key string, expiry time.Duration) error
-
-	// Version is used to get the version of the memcached server.
-	// TODO(@yeqown): auto-detect the version of the memcached server.
-	// 	to support limit some commands that are not supported by the server.
-	//  e.g. flags are uint16 only before 1.2.1
-	// 	e.g. SASL authentication is supported after 1.4.3
-	Version(ctx context.Context) (string, error)
-
-	// FlushAll is used to flush all data in the memcached server.
-	FlushAll(ctx context.Context) error
+	// TouchWithExpiration is the same as Touch, but accepts an Expiration.
+	TouchWithExpiration(ctx context.Context, key string, expiry Expiration) error
+	// DeleteMulti and TouchMulti are used to delete or touch the given keys in batch.
+	// The keys are grouped by their servers, and the quiet meta commands of each group
+	// are pipelined in one round trip, rather than one round trip per key.
+	//
+	// They return the errors of the failed keys, and nil if all keys succeed. The missing
+	// keys are reported as ErrNotFound by TouchMulti, but not by DeleteMulti, since the
+	// quiet meta delete command suppresses the miss. They require the meta protocol.
+	DeleteMulti(ctx context.Context, keys []string) map[string]error
+	TouchMulti(ctx context.Context, expiry time.Duration, keys []string) map[string]error
 }
 
 type metaTextProtocolCommander interface {
@@ -113,17 +166,122 @@ type metaTextProtocolCommander interface {
 	MetaDelete(ctx context.Context, key []byte, options ...MetaDeleteOption) (*MetaItem, error)
 	// MetaArithmetic is used to increment or decrement the value of the given key with metadata.
 	// All available options start with MetaArithmeticFlagXXX, such as MetaArithmeticFlagReturnCAS
-	// and MetaArithmeticFlagReturnClientFlags.
+	// and MetaArithmeticFlagReturnClientFlags. The value returned is not decoded by the codec.
 	MetaArithmetic(ctx context.Context, key []byte, delta uint64, options ...MetaArithmeticOption) (*MetaItem, error)
 	// MetaDebug is used to get the debug information of the given key with metadata.
 	// All available options start with MetaDebugFlagXXX, such as MetaDebugFlagBinaryKey
 	MetaDebug(ctx context.Context, key []byte, options ...MetaDebugOption) (*MetaItemDebug, error)
+	// MetaDebugEach calls fn with the debug information of each key starting with prefix
+	// on every server, listed by `lru_crawler metadump all`. See client.MetaDebugEach.
+	MetaDebugEach(ctx context.Context, prefix string, fn func(addr *Addr, item *MetaItemDebug) error) error
 	// MetaNoOp is used to do nothing but return OK.
 	MetaNoOp(ctx context.Context) error
 }
 
-type statisticsTextProtocolCommander interface {
+// AdminCommander is the set of the commands administering the memcached servers
+// rather than the items, such as querying their versions and flushing them. It's
+// a part of Client, and could be accepted instead of Client by the code which only
+// administers the servers.
+type AdminCommander interface {
+	// Version is used to get the version of the memcached server.
+	//
+	// The client also detects the version of each server when connecting to it,
+	// and rejects the commands which are not supported by the server with ErrNotSupported,
+	// see WithCapabilityDetection for more details.
+	Version(ctx context.Context) (string, error)
+	// VersionAll is used to get the versions of all memcached servers in the cluster,
+	// it's useful to check a mixed-version cluster during rolling upgrades. The versions
+	// of the servers which reply successfully are returned along with the error.
+	VersionAll(ctx context.Context) (map[*Addr]string, error)
+	// ServerInfo is used to get the version, uptime and pointer size of all memcached
+	// servers in the cluster from their stats. The information of the servers which
+	// reply successfully are returned along with the error.
+	ServerInfo(ctx context.Context) (map[*Addr]*ServerInfo, error)
+
+	// FlushAll is used to flush all data in the memcached server.
+	FlushAll(ctx context.Context) error
+	// ScheduleFlush schedules the memcached server at addr to flush all data after
+	// the delay by `flush_all <delay>`, and keeps track of it, see ScheduledFlushes.
+	ScheduleFlush(ctx context.Context, addr *Addr, delay time.Duration) error
+	// ScheduledFlushes lists the delayed flushes scheduled by ScheduleFlush which are
+	// not due yet, ordered by the address of the servers.
+	ScheduledFlushes() []ScheduledFlush
+}
+
+// StatisticsCommander is the set of the commands querying the statistics of the
+// memcached servers and sampling their keys. It's a part of Client, and could be
+// accepted instead of Client by the code which only inspects the servers, e.g.
+// the monitoring.
+type StatisticsCommander interface {
+	// Stats is used to get the statistics of the memcached server.
 	Stats(ctx context.Context) (*Statistic, error)
+	// AggregateStats queries the stats of all memcached servers, and sums them into
+	// the cluster-wide view with the hit rate and the outlier nodes. The view of the
+	// servers which reply successfully is returned along with the error.
+	AggregateStats(ctx context.Context) (*ClusterStats, error)
+	// StatsDelta polls the stats of the server at addr every interval, and streams
+	// the rates of the counters between the polls. See client.StatsDelta.
+	StatsDelta(ctx context.Context, addr *Addr, interval time.Duration) (<-chan *StatRate, error)
+	// StatsSettings queries the settings of all memcached servers by `stats settings`,
+	// the settings of the servers which reply successfully are returned along with
+	// the error.
+	StatsSettings(ctx context.Context) (map[*Addr]*ServerSettings, error)
+	// KeySample lists at most perClass keys of each slab class of every server by
+	// `stats cachedump`, it's best-effort and expensive. See client.KeySample.
+	KeySample(ctx context.Context, perClass int) ([]*SampledKey, error)
+	// AuditCache reports the TTL distribution and slab usage of the keys starting with
+	// prefix per key namespace, by `lru_crawler metadump all`. See client.AuditCache.
+	AuditCache(ctx context.Context, prefix string, namespaceOf func(key string) string) (*CacheAudit, error)
+}
+
+type helperCommander interface {
+	// Update atomically modifies the value of the given key by a read-modify-write
+	// loop: it gets the item with its CAS unique, calls fn with the current value,
+	// and stores the new value only if the item has not been modified in between.
+	// It retries when the item is modified concurrently, and returns ErrExists
+	// after the retries are exhausted.
+	//
+	// It returns ErrNotFound if the key does not exist, unless UpdateAutoCreate
+	// is set, and the error returned by fn as is. The flags of the item are kept.
+	// The item read with CAS 0 by CASParsingLenient is not written, ErrNotSupported
+	// is returned instead.
+	//
+	// NOTE: the text protocol does not return the remaining TTL of the item, so
+	// that the expiration is reset to the one given by UpdateExpiration, which is
+	// NoExpiration by default.
+	Update(ctx context.Context, key string, fn UpdateFunc, opts ...UpdateOption) error
+	// MetaUpdate is Update by the meta commands, it compares the CAS unique by meta
+	// set and returns the CAS unique of the item it stores, so that the caller could
+	// chain the next compare-and-set without reading the item again. The retries
+	// are backed off by UpdateBackoff as well.
+	MetaUpdate(ctx context.Context, key []byte, fn UpdateFunc, opts ...UpdateOption) (uint64, error)
+	// Counter returns the counter of the given key which is created on demand
+	// with the given ttl, see Counter for more details.
+	Counter(key string, ttl time.Duration) *Counter
+	// NewMutex returns a distributed lock of the given key which expires after
+	// ttl, see Mutex for more details and the safety caveats.
+	NewMutex(key string, ttl time.Duration, opts ...MutexOption) *Mutex
+	// Namespaces returns the helper to group keys into namespaces which could be
+	// invalidated at once, see Namespaces for more details.
+	Namespaces(opts ...NamespaceOption) *Namespaces
+	// Async returns the helper to enqueue commands and wait for their Futures,
+	// they're pipelined to each server in batches. See Async for more details.
+	Async(opts ...AsyncOption) *Async
+	// SoftTTL returns the helper to store the values with a logical expiry ahead
+	// of their TTL, so that they could be refreshed ahead. See SoftTTL.
+	SoftTTL() *SoftTTL
+	// WithConn runs fn with the commands over one connection to the server of the
+	// key, in order and without picking the server again. See client.WithConn.
+	WithConn(ctx context.Context, key string, fn func(cc ConnCommander) error) error
+	// DoOnNode runs fn with the context whose commands are sent to the server at
+	// addr, bypassing the picker. See client.DoOnNode.
+	DoOnNode(ctx context.Context, addr *Addr, fn func(ctx context.Context) error) error
+	// Node returns the commands bound to the server at addr, bypassing the picker.
+	// See client.Node.
+	Node(addr *Addr) (NodeClient, error)
+	// WatchKeys returns the helper to poll the keys by cheap meta get commands and
+	// report their changes, see KeyWatcher.
+	WatchKeys(keys []string, opts ...KeyWatcherOption) *KeyWatcher
 }
 
 type rawTextProtocolCommander interface {
@@ -137,10 +295,13 @@ type rawTextProtocolCommander interface {
  * Storage commands: set, add, replace, append, prepend, cas
  */
 
-func (c *client) storageCommand(ctx context.Context, command, key string, value []byte, flag uint32, expiry time.Duration) error {
+func (c *client) storageCommand(ctx context.Context, command, key string, value []byte, flag uint32, expiry Expiration) error {
 	if err := validateKeyAndValue([]byte(key), nil); err != nil {
 		return err
 	}
+	if err := expiry.validate(); err != nil {
+		return err
+	}
 
 	req, resp, err := buildStorageCommand(command, key, value, flag, expiry, c.options.noReply, c.options.codec)
 	if err != nil {
@@ -149,6 +310,23 @@ func (c *client) storageCommand(ctx context.Context, command, key string, value
 	defer releaseReqAndResp(req, resp)
 
 	if err = c.dispatchRequest(ctx, req, resp); err != nil {
+		return storageReply(resp, err)
+	}
+
+	return c.captureMalformed(req, resp, storageReply(resp, nil))
+}
+
+// storageReply returns the result of the storage command by its response and the
+// error of the request. The outcomes replied by the server, NOT_STORED, EXISTS and
+// NOT_FOUND, are returned as the sentinel errors rather than wrapped, so that they
+// could be compared directly, see StoreResultOf.
+func storageReply(resp *response, err error) error {
+	if err != nil {
+		for _, outcome := range []error{ErrNotStored, ErrExists, ErrNotFound} {
+			if errors.Is(err, outcome) {
+				return outcome
+			}
+		}
 		return errors.Wrap(err, "request failed")
 	}
 
@@ -160,29 +338,58 @@ func (c *client) storageCommand(ctx context.Context, command, key string, value
 }
 
 func (c *client) Set(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return c.storageCommand(ctx, "set", key, value, flag, FromDuration(expiry))
+}
+
+func (c *client) SetWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
 	return c.storageCommand(ctx, "set", key, value, flag, expiry)
 }
 
 func (c *client) Add(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return c.storageCommand(ctx, "add", key, value, flag, FromDuration(expiry))
+}
+
+func (c *client) AddWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
 	return c.storageCommand(ctx, "add", key, value, flag, expiry)
 }
 
 func (c *client) Replace(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return c.storageCommand(ctx, "replace", key, value, flag, FromDuration(expiry))
+}
+
+func (c *client) ReplaceWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
 	return c.storageCommand(ctx, "replace", key, value, flag, expiry)
 }
 
 func (c *client) Append(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return c.storageCommand(ctx, "append", key, value, flag, FromDuration(expiry))
+}
+
+func (c *client) AppendWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
 	return c.storageCommand(ctx, "append", key, value, flag, expiry)
 }
 
 func (c *client) Prepend(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return c.storageCommand(ctx, "prepend", key, value, flag, FromDuration(expiry))
+}
+
+func (c *client) PrependWithExpiration(ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
 	return c.storageCommand(ctx, "prepend", key, value, flag, expiry)
 }
 
 func (c *client) Cas(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64) error {
+	return c.CasWithExpiration(ctx, key, value, flag, FromDuration(expiry), cas)
+}
+
+func (c *client) CasWithExpiration(
+	ctx context.Context, key string, value []byte, flag uint32, expiry Expiration, cas uint64,
+) error {
 	if err := validateKeyAndValue([]byte(key), value); err != nil {
 		return err
 	}
+	if err := expiry.validate(); err != nil {
+		return err
+	}
 
 	req, resp, err := buildCasCommand(key, value, flag, expiry, cas, c.options.noReply, c.options.codec)
 	if err != nil {
@@ -191,14 +398,51 @@ func (c *client) Cas(ctx context.Context, key string, value []byte, flag uint32,
 	defer releaseReqAndResp(req, resp)
 
 	if err = c.dispatchRequest(ctx, req, resp); err != nil {
-		return errors.Wrap(err, "request failed")
+		return storageReply(resp, err)
 	}
 
-	if err = resp.expect(_StoredCRLFBytes); err != nil {
-		return errors.Wrap(ErrMalformedResponse, err.Error())
+	return c.captureMalformed(req, resp, storageReply(resp, nil))
+}
+
+func (c *client) SetItem(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error) {
+	return c.storeItem(ctx, key, value, MetaSetFlagModeSwitch(MetaSetModeSet),
+		MetaSetFlagClientFlags(flag), MetaSetFlagTTL(metaTTL(FromDuration(expiry))))
+}
+
+func (c *client) AddItem(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error) {
+	return c.storeItem(ctx, key, value, MetaSetFlagModeSwitch(MetaSetModeAdd),
+		MetaSetFlagClientFlags(flag), MetaSetFlagTTL(metaTTL(FromDuration(expiry))))
+}
+
+func (c *client) ReplaceItem(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error) {
+	return c.storeItem(ctx, key, value, MetaSetFlagModeSwitch(MetaSetModeReplace),
+		MetaSetFlagClientFlags(flag), MetaSetFlagTTL(metaTTL(FromDuration(expiry))))
+}
+
+func (c *client) AppendItem(ctx context.Context, key string, value []byte) (*MetaItem, error) {
+	return c.storeItem(ctx, key, value, MetaSetFlagModeSwitch(MetaSetModeAppend))
+}
+
+func (c *client) PrependItem(ctx context.Context, key string, value []byte) (*MetaItem, error) {
+	return c.storeItem(ctx, key, value, MetaSetFlagModeSwitch(MetaSetModePrepend))
+}
+
+func (c *client) CasItem(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64,
+) (*MetaItem, error) {
+	if cas == 0 {
+		return nil, errors.Wrap(ErrInvalidArgument, "cas unique 0")
 	}
 
-	return nil
+	return c.storeItem(ctx, key, value, MetaSetFlagCompareCAS(cas),
+		MetaSetFlagClientFlags(flag), MetaSetFlagTTL(metaTTL(FromDuration(expiry))))
+}
+
+// storeItem stores the item by meta set command with the given options, and
+// returns the CAS and size of the stored item.
+func (c *client) storeItem(ctx context.Context, key string, value []byte, options ...MetaSetOption) (*MetaItem, error) {
+	options = append(options, MetaSetFlagReturnCAS(), MetaSetFlagReturnSize())
+	return c.MetaSet(ctx, []byte(key), value, options...)
 }
 
 /**
@@ -213,14 +457,15 @@ func (c *client) Get(ctx context.Context, key string) (*Item, error) {
 	req, resp := buildGetsCommand("get", key)
 	defer releaseReqAndResp(req, resp)
 
-	if err := c.dispatchRequest(ctx, req, resp); err != nil {
+	if err := c.dispatchHedgedRequest(ctx, req, resp); err != nil {
 		return nil, errors.Wrap(err, "request failed")
 	}
 
 	items, err := parseValueItems(resp.rawLines, false, false, c.options.codec)
 	if err != nil {
-		return nil, errors.Wrap(err, "parse values failed")
+		return nil, c.captureMalformed(req, resp, errors.Wrap(err, "parse values failed"))
 	}
+	c.countKeyHit(resp.addr, len(items) > 0)
 	if len(items) == 0 {
 		return nil, errors.Wrap(ErrNotFound, "no items found")
 	}
@@ -233,28 +478,29 @@ func (c *client) Gets(ctx context.Context, keys ...string) ([]*Item, error) {
 		return []*Item{}, nil
 	}
 
-	req, resp := buildGetsCommand("gets", keys...)
-	defer releaseReqAndResp(req, resp)
-
-	if err := c.dispatchRequest(ctx, req, resp); err != nil {
-		return nil, errors.Wrap(err, "request failed")
-	}
-
-	items, err := parseValueItems(resp.rawLines, false, true, c.options.codec)
-	if err != nil {
-		return nil, errors.Wrap(ErrMalformedResponse, "parse values failed")
-	}
-	if len(items) == 0 {
-		return nil, errors.Wrap(ErrNotFound, "no items found")
-	}
-
-	return items, nil
+	return c.retrieveMultiKeys(ctx, multiKeyRetrieval{
+		command: "gets",
+		build: func(keys ...string) (*request, *response) {
+			return buildGetsCommand("gets", keys...)
+		},
+		withCAS: true,
+	}, keys...)
 }
 
 func (c *client) GetAndTouch(ctx context.Context, expiry time.Duration, key string) (*Item, error) {
+	return c.GetAndTouchWithExpiration(ctx, FromDuration(expiry), key)
+}
+
+func (c *client) GetAndTouchWithExpiration(ctx context.Context, expiry Expiration, key string) (*Item, error) {
 	if err := validateKeyAndValue([]byte(key), nil); err != nil {
 		return nil, err
 	}
+	if err := expiry.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.checkGetAndTouchSupported(); err != nil {
+		return nil, err
+	}
 
 	req, resp := buildGetAndTouchesCommand("gat", expiry, key)
 	defer releaseReqAndResp(req, resp)
@@ -265,8 +511,9 @@ func (c *client) GetAndTouch(ctx context.Context, expiry time.Duration, key stri
 
 	items, err := parseValueItems(resp.rawLines, false, false, c.options.codec)
 	if err != nil {
-		return nil, errors.Wrap(ErrMalformedResponse, "parse values failed")
+		return nil, c.captureMalformed(req, resp, errors.Wrap(ErrMalformedResponse, "parse values failed"))
 	}
+	c.countKeyHit(resp.addr, len(items) > 0)
 
 	if len(items) == 0 {
 		return nil, errors.Wrap(ErrNotFound, "no items found")
@@ -276,28 +523,34 @@ func (c *client) GetAndTouch(ctx context.Context, expiry time.Duration, key stri
 }
 
 func (c *client) GetAndTouches(ctx context.Context, expiry time.Duration, keys ...string) ([]*Item, error) {
+	return c.GetAndTouchesWithExpiration(ctx, FromDuration(expiry), keys...)
+}
+
+func (c *client) GetAndTouchesWithExpiration(ctx context.Context, expiry Expiration, keys ...string) ([]*Item, error) {
 	if len(keys) == 0 {
 		return []*Item{}, nil
 	}
 
-	req, resp := buildGetAndTouchesCommand("gats", expiry, keys...)
-	defer releaseReqAndResp(req, resp)
-
-	if err := c.dispatchRequest(ctx, req, resp); err != nil {
-		return nil, errors.Wrap(err, "request failed")
+	if err := c.checkGetAndTouchSupported(); err != nil {
+		return nil, err
 	}
-
-	// parse response
-	items, err := parseValueItems(resp.rawLines, false, true, c.options.codec)
-	if err != nil {
-		return nil, errors.Wrap(ErrMalformedResponse, "parse values failed")
+	if err := expiry.validate(); err != nil {
+		return nil, err
 	}
 
-	if len(items) == 0 {
-		return nil, errors.Wrap(ErrNotFound, "no items found")
-	}
+	return c.retrieveMultiKeys(ctx, c.getAndTouchRetrieval(expiry), keys...)
+}
 
-	return items, nil
+// getAndTouchRetrieval returns the gats retrieval which touches the keys with expiry.
+func (c *client) getAndTouchRetrieval(expiry Expiration) multiKeyRetrieval {
+	return multiKeyRetrieval{
+		command: "gats",
+		build: func(keys ...string) (*request, *response) {
+			return buildGetAndTouchesCommand("gats", expiry, keys...)
+		},
+		withCAS: true,
+		perKey:  c.options.compatibility.quirks().noMultiKeyGetAndTouch,
+	}
 }
 
 /**
@@ -318,42 +571,58 @@ func (c *client) Delete(ctx context.Context, key string) error {
 
 	// expect DELETED\r\n
 	if err := resp.expect(_DeletedCRLFBytes); err != nil {
-		return errors.Wrap(ErrMalformedResponse, err.Error())
+		return c.captureMalformed(req, resp, errors.Wrap(ErrMalformedResponse, err.Error()))
 	}
 
 	return nil
 }
 
-func (c *client) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
-	if err := validateKeyAndValue([]byte(key), nil); err != nil {
-		return 0, err
-	}
-
-	req, resp := buildArithmeticCommand("incr", key, delta, c.options.noReply)
-	if err := c.dispatchRequest(ctx, req, resp); err != nil {
-		return 0, errors.Wrap(err, "request failed")
+func (c *client) DeleteCAS(ctx context.Context, key string, cas uint64) error {
+	if cas == 0 {
+		return errors.Wrap(ErrInvalidArgument, "cas unique 0")
 	}
 
-	// parse response
-	value, err := parseArithmetic(resp.rawLines[0])
-	if err != nil {
-		return 0, errors.Wrap(ErrMalformedResponse, err.Error())
+	options := []MetaDeleteOption{MetaDeleteFlagCompareCAS(cas)}
+	if c.options.noReply {
+		options = append(options, MetaDeleteFlagNoReply())
 	}
 
-	return value, nil
+	_, err := c.MetaDelete(ctx, []byte(key), options...)
+	return err
 }
 
-func (c *client) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+/**
+ * Arithmetic commands: incr, decr
+ */
+
+func (c *client) arithmeticCommand(ctx context.Context, command, key string, delta uint64) (uint64, error) {
 	if err := validateKeyAndValue([]byte(key), nil); err != nil {
 		return 0, err
 	}
 
-	req, resp := buildArithmeticCommand("decr", key, delta, c.options.noReply)
+	req, resp := buildArithmeticCommand(command, key, delta, c.options.noReply)
+	defer releaseReqAndResp(req, resp)
+
 	if err := c.dispatchRequest(ctx, req, resp); err != nil {
-		return 0, errors.Wrap(err, "request failed")
+		return arithmeticReply(resp, err)
+	}
+
+	value, err := arithmeticReply(resp, nil)
+	return value, c.captureMalformed(req, resp, err)
+}
+
+// arithmeticReply returns the value replied to the incr or decr command, 0 in the
+// noReply mode. NOT_FOUND is returned as the sentinel error like storageReply does,
+// and the value which is not a number is ErrNonNumericValue.
+func arithmeticReply(resp *response, err error) (uint64, error) {
+	if err != nil {
+		return 0, storageReply(resp, err)
+	}
+	if len(resp.rawLines) == 0 {
+		// noReply mode enabled
+		return 0, nil
 	}
 
-	// parse response
 	value, err := parseArithmetic(resp.rawLines[0])
 	if err != nil {
 		return 0, errors.Wrap(ErrMalformedResponse, err.Error())
@@ -362,10 +631,25 @@ func (c *client) Decr(ctx context.Context, key string, delta uint64) (uint64, er
 	return value, nil
 }
 
+func (c *client) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return c.arithmeticCommand(ctx, "incr", key, delta)
+}
+
+func (c *client) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return c.arithmeticCommand(ctx, "decr", key, delta)
+}
+
 func (c *client) Touch(ctx context.Context, key string, expiry time.Duration) error {
+	return c.TouchWithExpiration(ctx, key, FromDuration(expiry))
+}
+
+func (c *client) TouchWithExpiration(ctx context.Context, key string, expiry Expiration) error {
 	if err := validateKeyAndValue([]byte(key), nil); err != nil {
 		return err
 	}
+	if err := expiry.validate(); err != nil {
+		return err
+	}
 
 	req, resp := buildTouchCommand(key, expiry, c.options.noReply)
 	defer releaseReqAndResp(req, resp)
@@ -376,7 +660,7 @@ func (c *client) Touch(ctx context.Context, key string, expiry time.Duration) er
 
 	// expect TOUCHED\r\n
 	if err := resp.expect(_TouchedCRLFBytes); err != nil {
-		return errors.Wrap(ErrMalformedResponse, err.Error())
+		return c.captureMalformed(req, resp, errors.Wrap(ErrMalformedResponse, err.Error()))
 	}
 
 	return nil
@@ -390,51 +674,159 @@ func (c *client) Version(ctx context.Context) (string, error) {
 		return "", errors.Wrap(err, "request")
 	}
 
-	// parse version number from response
-	// VERSION 1.6.14
-	line := resp.rawLines[0]
-	if !bytes.HasPrefix(line, _VersionBytes) {
-		return "", errors.Wrap(ErrMalformedResponse, string(line))
+	version, err := parseVersion(resp.rawLines[0])
+	return version, c.captureMalformed(req, resp, err)
+}
+
+func (c *client) VersionAll(ctx context.Context) (map[*Addr]string, error) {
+	var mu sync.Mutex
+	versions := make(map[*Addr]string, len(c.topology().addrs))
+
+	call := func(ctx context.Context, addr *Addr, cn memcachedConn) error {
+		version, err := c.versionOf(ctx, addr, cn)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		versions[addr] = version
+		mu.Unlock()
+		return nil
 	}
 
-	return string(trimCRLF(line[8:])), nil
+	if err := c.broadcastRequest(ctx, "version", call); err != nil {
+		return versions, errors.Wrap(err, "request failed")
+	}
+
+	return versions, nil
 }
 
-func (c *client) FlushAll(ctx context.Context) error {
-	call := func(ctx context.Context, cn memcachedConn) error {
-		req, resp := buildFlushAllCommand(c.options.noReply)
-		defer releaseReqAndResp(req, resp)
+func (c *client) ServerInfo(ctx context.Context) (map[*Addr]*ServerInfo, error) {
+	var mu sync.Mutex
+	infos := make(map[*Addr]*ServerInfo, len(c.topology().addrs))
 
-		c.autoSwitchToUDP(ctx, req, resp)
+	call := func(ctx context.Context, addr *Addr, cn memcachedConn) error {
+		req, resp := buildStatsCommand("")
+		defer releaseReqAndResp(req, resp)
 
-		if err := req.send(ctx, cn, c.options.writeTimeout); err != nil {
+		if err := req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
 			return errors.Wrap(err, "send failed")
 		}
-		if err := resp.recv(ctx, cn, c.options.readTimeout); err != nil {
-			return errors.Wrap(err, "recv failed")
+		resp.addr = addr
+		err := resp.recv(ctx, cn, c.baseReadTimeout(addr))
+		c.options.wireLogger.log(addr, req, resp, err)
+		if err != nil {
+			return errors.Wrap(c.captureMalformed(req, resp, err), "recv failed")
+		}
+		stats, err := parseStats(resp.rawLines)
+		if err != nil {
+			return c.captureMalformed(req, resp, err)
 		}
 
-		// expect OK\r\n
-		if err := resp.expect(_OKCRLFBytes); err != nil {
-			return errors.Wrap(ErrMalformedResponse, err.Error())
+		mu.Lock()
+		infos[addr] = &ServerInfo{
+			Version:     stats.Version,
+			Uptime:      time.Duration(stats.Uptime) * time.Second,
+			PointerSize: stats.PointerSize,
 		}
+		mu.Unlock()
+		return nil
+	}
+
+	if err := c.broadcastRequest(ctx, "stats", call); err != nil {
+		return infos, errors.Wrap(err, "request failed")
+	}
+
+	return infos, nil
+}
+
+// versionOf queries the version of the server over the given connection.
+func (c *client) versionOf(ctx context.Context, addr *Addr, cn memcachedConn) (string, error) {
+	req, resp := buildVersionCommand()
+	defer releaseReqAndResp(req, resp)
+
+	c.applyCompatibility(resp)
+	if err := req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
+		return "", errors.Wrap(err, "send failed")
+	}
+	resp.addr = addr
+	err := resp.recv(ctx, cn, c.baseReadTimeout(addr))
+	c.options.wireLogger.log(addr, req, resp, err)
+	if err != nil {
+		return "", errors.Wrap(c.captureMalformed(req, resp, err), "recv failed")
+	}
+
+	version, err := parseVersion(resp.rawLines[0])
+	return version, c.captureMalformed(req, resp, err)
+}
 
+// parseVersion parses the version number from the reply of version command.
+// VERSION 1.6.14\r\n
+func parseVersion(line []byte) (string, error) {
+	if !bytes.HasPrefix(line, _VersionBytes) || len(line) < 8 {
+		return "", errors.Wrap(ErrMalformedResponse, string(line))
+	}
+
+	return string(trimCRLF(line[8:])), nil
+}
+
+func (c *client) FlushAll(ctx context.Context) error {
+	call := func(ctx context.Context, addr *Addr, cn memcachedConn) error {
+		if err := c.flushAllOn(ctx, addr, cn, NoExpiration); err != nil {
+			return err
+		}
+
+		// the flush replaces the delayed one scheduled before.
+		c.setScheduledFlush(addr, time.Time{})
 		return nil
 	}
 
-	if err := c.broadcastRequest(ctx, call); err != nil {
+	if err := c.broadcastRequest(ctx, "flush_all", call); err != nil {
 		return errors.Wrap(err, "request failed")
 	}
 
 	return nil
 }
 
+// flushAllOn flushes the items of the server over the given connection after the
+// delay, see buildFlushAllCommand.
+func (c *client) flushAllOn(ctx context.Context, addr *Addr, cn memcachedConn, delay Expiration) error {
+	req, resp := buildFlushAllCommand(delay, c.options.noReply)
+	defer releaseReqAndResp(req, resp)
+
+	c.autoSwitchToUDP(ctx, addr, req, resp)
+	c.applyCompatibility(resp)
+	fenced := c.fenceNoReply(cn, req, resp)
+
+	if err := req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
+		return errors.Wrap(err, "send failed")
+	}
+	err := resp.recv(ctx, cn, c.baseReadTimeout(addr))
+	c.options.wireLogger.log(addr, req, resp, err)
+	if fenced {
+		err = c.verifiedNoReply(addr, resp, err)
+	}
+	if err != nil {
+		return errors.Wrap(err, "recv failed")
+	}
+
+	// expect OK\r\n
+	if err := resp.expect(_OKCRLFBytes); err != nil {
+		return c.captureMalformed(req, resp, errors.Wrap(ErrMalformedResponse, err.Error()))
+	}
+
+	return nil
+}
+
 /**
  * Other commands(META text commands):
  * meta set(ms), meta get(mg), meta delete(md), meta arithmetic(ma), meta no-op(mn)
  */
 
 func (c *client) MetaSet(ctx context.Context, key, value []byte, msOptions ...MetaSetOption) (*MetaItem, error) {
+	if err := c.checkMetaSupported(); err != nil {
+		return nil, err
+	}
 	if err := validateKeyAndValue(key, nil); err != nil {
 		return nil, err
 	}
@@ -443,6 +835,12 @@ func (c *client) MetaSet(ctx context.Context, key, value []byte, msOptions ...Me
 	for _, applyFn := range msOptions {
 		applyFn(msFlags)
 	}
+	if err := validateTTL("T", msFlags.T); err != nil {
+		return nil, err
+	}
+	if err := validateTTL("N", msFlags.N); err != nil {
+		return nil, err
+	}
 	clientFlags := msFlags.F
 
 	req, resp, err := buildMetaSetCommand(key, value, msFlags, c.options.codec)
@@ -459,15 +857,18 @@ func (c *client) MetaSet(ctx context.Context, key, value []byte, msOptions ...Me
 		TTL:   int64(msFlags.T),
 		Flags: clientFlags,
 	}
-	err = parseMetaItem(resp.rawLines, item, msFlags.q, c.options.codec)
+	err = c.tolerateCAS(parseMetaItem(resp.rawLines, item, msFlags.q, c.options.codec))
 	if err != nil {
-		return nil, err
+		return nil, c.captureMalformed(req, resp, err)
 	}
 
 	return item, nil
 }
 
 func (c *client) MetaGet(ctx context.Context, key []byte, mgOptions ...MetaGetOption) (*MetaItem, error) {
+	if err := c.checkMetaSupported(); err != nil {
+		return nil, err
+	}
 	if err := validateKeyAndValue(key, nil); err != nil {
 		return nil, err
 	}
@@ -476,6 +877,12 @@ func (c *client) MetaGet(ctx context.Context, key []byte, mgOptions ...MetaGetOp
 	for _, applyFn := range mgOptions {
 		applyFn(mgFlags)
 	}
+	if err := validateTTL("T", mgFlags.T); err != nil {
+		return nil, err
+	}
+	if err := validateTTL("N", mgFlags.N); err != nil {
+		return nil, err
+	}
 
 	// If you use specified customize Codec, then client always request flags by default.
 	if c.options.codec != nil {
@@ -485,21 +892,35 @@ func (c *client) MetaGet(ctx context.Context, key []byte, mgOptions ...MetaGetOp
 	req, resp := buildMetaGetCommand(key, mgFlags)
 	defer releaseReqAndResp(req, resp)
 
-	if err := c.dispatchRequest(ctx, req, resp); err != nil {
+	dispatch := c.dispatchHedgedRequest
+	if mgFlags.modifies() {
+		dispatch = c.dispatchRequest
+	}
+	if err := dispatch(ctx, req, resp); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.countKeyHit(resp.addr, false)
+		}
 		return nil, errors.Wrap(err, "request failed")
 	}
 
 	item := &MetaItem{
 		Key: key,
 	}
-	if err := parseMetaItem(resp.rawLines, item, mgFlags.q, c.options.codec); err != nil {
-		return nil, err
+	if err := c.tolerateCAS(parseMetaItem(resp.rawLines, item, mgFlags.q, c.options.codec)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.countKeyHit(resp.addr, false)
+		}
+		return nil, c.captureMalformed(req, resp, err)
 	}
+	c.countKeyHit(resp.addr, true)
 
 	return item, nil
 }
 
 func (c *client) MetaDelete(ctx context.Context, key []byte, options ...MetaDeleteOption) (*MetaItem, error) {
+	if err := c.checkMetaSupported(); err != nil {
+		return nil, err
+	}
 	if err := validateKeyAndValue(key, nil); err != nil {
 		return nil, err
 	}
@@ -508,6 +929,9 @@ func (c *client) MetaDelete(ctx context.Context, key []byte, options ...MetaDele
 	for _, applyFn := range options {
 		applyFn(mdFlags)
 	}
+	if err := validateTTL("T", mdFlags.T); err != nil {
+		return nil, err
+	}
 
 	req, resp := buildMetaDeleteCommand(key, mdFlags)
 	defer releaseReqAndResp(req, resp)
@@ -519,14 +943,17 @@ func (c *client) MetaDelete(ctx context.Context, key []byte, options ...MetaDele
 	item := &MetaItem{
 		Key: key,
 	}
-	if err := parseMetaItem(resp.rawLines, item, mdFlags.q, c.options.codec); err != nil {
-		return nil, err
+	if err := c.tolerateCAS(parseMetaItem(resp.rawLines, item, mdFlags.q, c.options.codec)); err != nil {
+		return nil, c.captureMalformed(req, resp, err)
 	}
 
 	return item, nil
 }
 
 func (c *client) MetaArithmetic(ctx context.Context, key []byte, delta uint64, options ...MetaArithmeticOption) (*MetaItem, error) {
+	if err := c.checkMetaSupported(); err != nil {
+		return nil, err
+	}
 	if err := validateKeyAndValue(key, nil); err != nil {
 		return nil, err
 	}
@@ -535,6 +962,12 @@ func (c *client) MetaArithmetic(ctx context.Context, key []byte, delta uint64, o
 	for _, applyFn := range options {
 		applyFn(maFlags)
 	}
+	if err := validateTTL("T", maFlags.T); err != nil {
+		return nil, err
+	}
+	if err := validateTTL("N", maFlags.N); err != nil {
+		return nil, err
+	}
 
 	req, resp := buildMetaArithmeticCommand(key, delta, maFlags)
 	defer releaseReqAndResp(req, resp)
@@ -543,11 +976,13 @@ func (c *client) MetaArithmetic(ctx context.Context, key []byte, delta uint64, o
 		return nil, errors.Wrap(err, "request failed")
 	}
 
+	// the value of the counter is the decimal number of memcached, which is never
+	// encoded by the codec.
 	item := &MetaItem{
 		Key: key,
 	}
-	if err := parseMetaItem(resp.rawLines, item, maFlags.q, c.options.codec); err != nil {
-		return nil, err
+	if err := c.tolerateCAS(parseMetaItem(resp.rawLines, item, maFlags.q, memcodec.Noop)); err != nil {
+		return nil, c.captureMalformed(req, resp, err)
 	}
 
 	return item, nil
@@ -566,6 +1001,9 @@ func validateKeyAndValue(key, value []byte) error {
 }
 
 func (c *client) MetaDebug(ctx context.Context, key []byte, options ...MetaDebugOption) (*MetaItemDebug, error) {
+	if err := c.checkMetaSupported(); err != nil {
+		return nil, err
+	}
 	if err := validateKeyAndValue(key, nil); err != nil {
 		return nil, err
 	}
@@ -582,18 +1020,20 @@ func (c *client) MetaDebug(ctx context.Context, key []byte, options ...MetaDebug
 		return nil, errors.Wrap(err, "request failed")
 	}
 
-	item := &MetaItemDebug{
-		Key: key,
-	}
+	item := &MetaItemDebug{}
 	// parse response
-	if err := parseMetaItemDebug(resp.rawLines, item); err != nil {
-		return nil, err
+	if err := c.tolerateCAS(parseMetaItemDebug(resp.rawLines, item)); err != nil {
+		return nil, c.captureMalformed(req, resp, err)
 	}
 
 	return item, nil
 }
 
 func (c *client) MetaNoOp(ctx context.Context) error {
+	if err := c.checkMetaSupported(); err != nil {
+		return err
+	}
+
 	req, resp := buildMetaNoOpCommand()
 	defer releaseReqAndResp(req, resp)
 
@@ -601,11 +1041,11 @@ func (c *client) MetaNoOp(ctx context.Context) error {
 		return errors.Wrap(err, "request failed")
 	}
 	if err := resp.expect(_MetaMNCRLFBytes); err != nil {
-		if errors.Is(err, ErrMalformedResponse) {
-			return err
+		if !errors.Is(err, ErrMalformedResponse) {
+			err = errors.Wrap(ErrMalformedResponse, err.Error())
 		}
 
-		return errors.Wrap(ErrMalformedResponse, err.Error())
+		return c.captureMalformed(req, resp, err)
 	}
 
 	return nil
@@ -624,7 +1064,8 @@ func (c *client) Stats(ctx context.Context) (*Statistic, error) {
 		return nil, errors.Wrap(err, "request failed")
 	}
 
-	return parseStats(resp.rawLines)
+	stats, err := parseStats(resp.rawLines)
+	return stats, c.captureMalformed(req, resp, err)
 }
 
 func (c *client) Raw(ctx context.Context, cmd string) ([]string, error) {
@@ -0,0 +1,453 @@
+package memcached
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// keyGroup represents the keys of a multi-key command which are stored in the
+// same memcached server.
+type keyGroup struct {
+	addr *Addr
+	keys []string
+}
+
+// groupKeysByNode groups the keys by the memcached server they are picked to,
+// the groups are ordered by the first key of each group.
+func (c *client) groupKeysByNode(ctx context.Context, command string, keys []string) ([]*keyGroup, error) {
+	groups := make([]*keyGroup, 0, len(c.topology().addrs))
+	index := make(map[*Addr]*keyGroup, len(c.topology().addrs))
+
+	for _, key := range keys {
+		addr, err := c.pick(ctx, []byte(command), []byte(key))
+		if err != nil {
+			return nil, errors.Wrap(err, "pick node failed")
+		}
+
+		g, ok := index[addr]
+		if !ok {
+			g = &keyGroup{addr: addr}
+			index[addr] = g
+			groups = append(groups, g)
+		}
+		g.keys = append(g.keys, key)
+	}
+
+	return groups, nil
+}
+
+// multiKeyRetrieval describes a multi-key retrieval command(gets/gats).
+type multiKeyRetrieval struct {
+	command string
+	build   func(keys ...string) (*request, *response)
+	withCAS bool
+	// perKey means the command is sent for each key separately, since the
+	// server does not support multi-key retrieval.
+	perKey bool
+}
+
+// retrieveMultiKeys executes the multi-key retrieval command. In cluster mode, the keys
+// are grouped by their servers and each group is sent to its server concurrently,
+// so that every key is read from the server where it's stored. Missing keys are
+// skipped, and the items are ordered as the given keys.
+func (c *client) retrieveMultiKeys(ctx context.Context, r multiKeyRetrieval, keys ...string) ([]*Item, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	groups, err := c.groupKeysByNode(ctx, r.command, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*Item
+	if len(groups) == 1 {
+		if items, err = c.retrieveFromNode(ctx, groups[0].addr, r, groups[0].keys); err != nil {
+			return nil, err
+		}
+	} else {
+		results := make([][]*Item, len(groups))
+		errs := make([]error, len(groups))
+
+		wg := sync.WaitGroup{}
+		for i, g := range groups {
+			wg.Add(1)
+			go func(i int, g *keyGroup) {
+				defer wg.Done()
+				results[i], errs[i] = c.retrieveFromNode(ctx, g.addr, r, g.keys)
+			}(i, g)
+		}
+		wg.Wait()
+
+		for i := range groups {
+			if errs[i] != nil {
+				return nil, errs[i]
+			}
+			items = append(items, results[i]...)
+		}
+		sortItemsByKeys(items, keys)
+	}
+
+	if len(items) == 0 {
+		return nil, errors.Wrap(ErrNotFound, "no items found")
+	}
+
+	return items, nil
+}
+
+// retrieveFromNode executes the retrieval command of the keys stored in the
+// memcached server at given address. If multi-key gat/gats is rejected by the
+// server and the fallback is enabled, the keys are retrieved one by one and the
+// server is remembered for noMultiKeyRejectionTTL, so that the following requests
+// skip the multi-key command.
+func (c *client) retrieveFromNode(ctx context.Context, addr *Addr, r multiKeyRetrieval, keys []string) ([]*Item, error) {
+	if len(keys) == 1 || r.perKey || c.multiKeyGetAndTouchRejected(r.command, addr) {
+		return c.retrieveKeyByKey(ctx, addr, r, keys)
+	}
+
+	items, err := c.retrieveChunks(ctx, addr, r, keys)
+	if err != nil && c.options.getAndTouchFallback && isGetAndTouchCommand(r.command) && isMultiKeyRejection(err) {
+		c.rejectMultiKeyGetAndTouch(addr)
+		return c.retrieveKeyByKey(ctx, addr, r, keys)
+	}
+
+	return items, err
+}
+
+// retrieveKeyByKey executes the retrieval command for each key separately, and
+// merges the items.
+func (c *client) retrieveKeyByKey(ctx context.Context, addr *Addr, r multiKeyRetrieval, keys []string) ([]*Item, error) {
+	items := make([]*Item, 0, len(keys))
+	for _, key := range keys {
+		got, err := c.retrieveOnce(ctx, addr, r, []string{key})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, got...)
+	}
+
+	return items, nil
+}
+
+// retrieveChunks executes the retrieval command of the keys in the chunks bounded
+// by WithMultiKeyLimits one by one, and merges the items.
+func (c *client) retrieveChunks(ctx context.Context, addr *Addr, r multiKeyRetrieval, keys []string) ([]*Item, error) {
+	chunks := splitKeys(keys, c.options.multiKeyMaxKeys, c.options.multiKeyMaxBytes)
+	if len(chunks) == 1 {
+		return c.retrieveOnce(ctx, addr, r, keys)
+	}
+
+	items := make([]*Item, 0, len(keys))
+	for _, chunk := range chunks {
+		got, err := c.retrieveOnce(ctx, addr, r, chunk)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, got...)
+	}
+
+	return items, nil
+}
+
+// splitKeys splits the keys into the chunks of at most maxKeys keys, and at most
+// maxBytes bytes of the keys and the spaces before them, 0 means no limit. Each
+// chunk takes at least one key even if the key is longer than maxBytes.
+func splitKeys(keys []string, maxKeys, maxBytes int) [][]string {
+	if maxKeys <= 0 && maxBytes <= 0 {
+		return [][]string{keys}
+	}
+
+	chunks := make([][]string, 0, 1)
+	start, size := 0, 0
+	for i, key := range keys {
+		n := i - start
+		if n > 0 && ((maxKeys > 0 && n >= maxKeys) || (maxBytes > 0 && size+1+len(key) > maxBytes)) {
+			chunks = append(chunks, keys[start:i])
+			start, size = i, 0
+		}
+		size += 1 + len(key)
+	}
+
+	return append(chunks, keys[start:])
+}
+
+func (c *client) retrieveOnce(ctx context.Context, addr *Addr, r multiKeyRetrieval, keys []string) ([]*Item, error) {
+	req, resp := r.build(keys...)
+	defer releaseReqAndResp(req, resp)
+
+	if err := c.dispatchRequestTo(ctx, addr, req, resp); err != nil {
+		// the keys of the unavailable server are missed, see WithFailOpen.
+		if errors.Is(err, ErrFailedOpen) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "request failed")
+	}
+
+	items, err := parseValueItems(resp.rawLines, false, r.withCAS, c.options.codec)
+	switch err = c.tolerateCAS(err); {
+	case isCASParseError(err):
+		return nil, errors.Wrap(err, "parse values failed")
+	case err != nil:
+		return nil, c.captureMalformed(req, resp, errors.Wrap(ErrMalformedResponse, "parse values failed"))
+	}
+	c.countHits(addr, len(items), len(keys)-len(items))
+
+	return items, nil
+}
+
+func isGetAndTouchCommand(command string) bool {
+	return command == "gat" || command == "gats"
+}
+
+// noMultiKeyRejectionTTL is how long a server which rejected multi-key gat/gats
+// is sent the keys one by one, it's probed again after that, e.g. it's upgraded
+// or replaced by another server at the same address.
+const noMultiKeyRejectionTTL = 10 * time.Minute
+
+// isMultiKeyRejection reports whether the error is the rejection of the command
+// format by the server, i.e. it does not accept multiple keys, rather than the
+// other errors such as a bad key or a broken connection.
+func isMultiKeyRejection(err error) bool {
+	return errors.Is(err, ErrNonexistentCommand) || errors.Is(err, errBadCommandLineFormat)
+}
+
+// multiKeyGetAndTouchRejected reports whether the server at given address has
+// rejected multi-key gat/gats in the last noMultiKeyRejectionTTL.
+func (c *client) multiKeyGetAndTouchRejected(command string, addr *Addr) bool {
+	if !c.options.getAndTouchFallback || !isGetAndTouchCommand(command) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt, ok := c.noMultiKeyGetAndTouch[addr]
+	if ok && !c.now().Before(expiresAt) {
+		delete(c.noMultiKeyGetAndTouch, addr)
+		return false
+	}
+	return ok
+}
+
+func (c *client) rejectMultiKeyGetAndTouch(addr *Addr) {
+	c.mu.Lock()
+	c.noMultiKeyGetAndTouch[addr] = c.now().Add(noMultiKeyRejectionTTL)
+	c.mu.Unlock()
+}
+
+// sortItemsByKeys sorts the items as the order of the keys, the items of the
+// same key keep their order.
+func sortItemsByKeys(items []*Item, keys []string) {
+	order := make(map[string]int, len(keys))
+	for i, key := range keys {
+		if _, ok := order[key]; !ok {
+			order[key] = i
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return order[items[i].Key] < order[items[j].Key]
+	})
+}
+
+// expiryGroup represents the keys of a keyGroup which are touched with the same exptime.
+type expiryGroup struct {
+	expiry Expiration
+	keys   []string
+}
+
+// groupKeysByExpiry groups the keys by their exptime, the groups are ordered by
+// the exptime, and the keys of each group keep their order.
+func groupKeysByExpiry(keys []string, expiries map[string]uint32) []*expiryGroup {
+	groups := make([]*expiryGroup, 0, 4)
+	index := make(map[Expiration]*expiryGroup, 4)
+
+	for _, key := range keys {
+		expiry := Expiration(expiries[key])
+		g, ok := index[expiry]
+		if !ok {
+			g = &expiryGroup{expiry: expiry}
+			index[expiry] = g
+			groups = append(groups, g)
+		}
+		g.keys = append(g.keys, key)
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].expiry < groups[j].expiry })
+	return groups
+}
+
+func (c *client) TouchAndGetMulti(ctx context.Context, expiries map[string]uint32) (map[string]*Item, error) {
+	if len(expiries) == 0 {
+		return map[string]*Item{}, nil
+	}
+
+	if err := c.checkGetAndTouchSupported(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(expiries))
+	for key, exptime := range expiries {
+		if err := validateKeyAndValue([]byte(key), nil); err != nil {
+			return nil, err
+		}
+		if err := Expiration(exptime).validate(); err != nil {
+			return nil, errors.Wrapf(err, "key %s", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	groups, err := c.groupKeysByNode(ctx, "gats", keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu    sync.Mutex
+		items = make(map[string]*Item, len(keys))
+	)
+	errs := make([]error, len(groups))
+
+	wg := sync.WaitGroup{}
+	for i, g := range groups {
+		wg.Add(1)
+		go func(i int, g *keyGroup) {
+			defer wg.Done()
+
+			// the exptime groups of a server are sent one by one.
+			for _, eg := range groupKeysByExpiry(g.keys, expiries) {
+				got, err := c.retrieveFromNode(ctx, g.addr, c.getAndTouchRetrieval(eg.expiry), eg.keys)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+
+				mu.Lock()
+				for _, item := range got {
+					items[item.Key] = item
+				}
+				mu.Unlock()
+			}
+		}(i, g)
+	}
+	wg.Wait()
+
+	for _, err = range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+func (c *client) DeleteMulti(ctx context.Context, keys []string) map[string]error {
+	build := func(key string, opaque uint64) (*request, *response) {
+		return buildMetaDeleteCommand([]byte(key), &metaDeleteFlags{q: true, O: opaque})
+	}
+
+	return c.pipelineMultiKeys(ctx, "md", keys, build, false)
+}
+
+func (c *client) TouchMulti(ctx context.Context, expiry time.Duration, keys []string) map[string]error {
+	ttl := metaTTL(FromDuration(expiry))
+	build := func(key string, opaque uint64) (*request, *response) {
+		return buildMetaTouchCommand([]byte(key), ttl, opaque, true)
+	}
+
+	return c.pipelineMultiKeys(ctx, "mg", keys, build, true)
+}
+
+// pipelineMultiKeys groups the keys by their servers and pipelines the quiet meta
+// commands built by build for each group concurrently. The opaque token of each
+// command is its index in the group plus one, so that the replies are attributed to
+// the keys. If missIsError is true, the key without reply is reported as ErrNotFound,
+// since the quiet command suppresses the miss.
+func (c *client) pipelineMultiKeys(
+	ctx context.Context, command string, keys []string,
+	build func(key string, opaque uint64) (*request, *response), missIsError bool,
+) map[string]error {
+	var mu sync.Mutex
+	errs := make(map[string]error)
+	fail := func(keys []string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, key := range keys {
+			errs[key] = err
+		}
+	}
+
+	if err := c.checkMetaSupported(); err != nil {
+		fail(keys, err)
+		return errs
+	}
+
+	valid := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if err := validateKeyAndValue([]byte(key), nil); err != nil {
+			fail([]string{key}, err)
+			continue
+		}
+		valid = append(valid, key)
+	}
+
+	groups, err := c.groupKeysByNode(ctx, command, valid)
+	if err != nil {
+		fail(valid, err)
+		return errs
+	}
+
+	wg := sync.WaitGroup{}
+	for _, g := range groups {
+		wg.Add(1)
+		go func(g *keyGroup) {
+			defer wg.Done()
+
+			reqs := make([]*request, 0, len(g.keys))
+			for i, key := range g.keys {
+				req, resp := build(key, uint64(i+1))
+				defer releaseReqAndResp(req, resp)
+				reqs = append(reqs, req)
+			}
+
+			replies, err := c.dispatchQuietPipeline(ctx, g.addr, reqs)
+			if err != nil {
+				fail(g.keys, err)
+				return
+			}
+
+			for i, key := range g.keys {
+				reply, ok := replies[uint64(i+1)]
+				if !ok {
+					if missIsError {
+						fail([]string{key}, ErrNotFound)
+					}
+					continue
+				}
+				if err := c.tolerateCAS(parseMetaItem(reply, &MetaItem{}, true, c.options.codec)); err != nil {
+					fail([]string{key}, err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
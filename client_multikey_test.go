@@ -0,0 +1,340 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_multiKeyRetrieval_cluster(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	keys := make([]string, 0, 16)
+	for i := 0; i < 16; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		require.NoError(t, c.Set(ctx, key, []byte("value-"+key), 0, 0))
+	}
+
+	// the keys are spread over both servers.
+	for _, srv := range []string{srv1.Addr(), srv2.Addr()} {
+		single, err := New(srv)
+		require.NoError(t, err)
+		items, err := single.Gets(ctx, keys...)
+		require.NoError(t, err)
+		assert.Less(t, len(items), len(keys))
+		_ = single.Close()
+	}
+
+	missing := append([]string{"missing"}, keys...)
+
+	tests := []struct {
+		name     string
+		retrieve func() ([]*Item, error)
+	}{
+		{
+			name:     "gets",
+			retrieve: func() ([]*Item, error) { return c.Gets(ctx, missing...) },
+		},
+		{
+			name:     "gats",
+			retrieve: func() ([]*Item, error) { return c.GetAndTouches(ctx, time.Minute, missing...) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := tt.retrieve()
+			require.NoError(t, err)
+			require.Len(t, items, len(keys))
+			for i, item := range items {
+				assert.Equal(t, keys[i], item.Key)
+				assert.Equal(t, "value-"+keys[i], string(item.Value))
+				assert.NotZero(t, item.CAS)
+			}
+		})
+	}
+
+	_, err = c.Gets(ctx, "missing", "missing-too")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func Test_splitKeys(t *testing.T) {
+	keys := []string{"a", "bb", "ccc", "dddd", "e"}
+
+	tests := []struct {
+		name     string
+		maxKeys  int
+		maxBytes int
+		want     [][]string
+	}{
+		{name: "no limit", want: [][]string{keys}},
+		{name: "max keys", maxKeys: 2, want: [][]string{{"a", "bb"}, {"ccc", "dddd"}, {"e"}}},
+		{name: "max bytes", maxBytes: 7, want: [][]string{{"a", "bb"}, {"ccc"}, {"dddd", "e"}}},
+		{name: "both", maxKeys: 1, maxBytes: 100, want: [][]string{{"a"}, {"bb"}, {"ccc"}, {"dddd"}, {"e"}}},
+		// the key longer than maxBytes takes a chunk by itself.
+		{name: "long key", maxBytes: 3, want: [][]string{{"a"}, {"bb"}, {"ccc"}, {"dddd"}, {"e"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitKeys(keys, tt.maxKeys, tt.maxBytes))
+		})
+	}
+}
+
+func Test_multiKeyRetrieval_chunks(t *testing.T) {
+	srv := newTestServer(t)
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	hook := func(_ context.Context, info *RequestInfo) {
+		if info.Command == "gets" || info.Command == "gats" {
+			mu.Lock()
+			requests++
+			mu.Unlock()
+		}
+	}
+	c, err := New(srv.Addr(), WithMultiKeyLimits(3, 0), WithRequestHook(hook))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	keys := make([]string, 0, 8)
+	for i := 0; i < 8; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		require.NoError(t, c.Set(ctx, key, []byte("value-"+key), 0, 0))
+	}
+
+	items, err := c.Gets(ctx, keys...)
+	require.NoError(t, err)
+	require.Len(t, items, len(keys))
+	for i, item := range items {
+		assert.Equal(t, keys[i], item.Key)
+	}
+
+	items, err = c.GetAndTouches(ctx, time.Minute, keys...)
+	require.NoError(t, err)
+	require.Len(t, items, len(keys))
+
+	// each retrieval of 8 keys takes 3 requests.
+	assert.Equal(t, 6, requests)
+}
+
+func Test_multiKeyGetAndTouch_fallback(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetSingleKeyGetAndTouch(true)
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		wantErr error
+	}{
+		{
+			name:    "fallback disabled",
+			wantErr: ErrClientError,
+		},
+		{
+			name: "fallback enabled",
+			opts: []ClientOption{WithGetAndTouchFallback(true)},
+		},
+		{
+			name: "compatibility mode",
+			opts: []ClientOption{WithCompatibility(CompatDragonfly)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(srv.Addr(), tt.opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			require.NoError(t, c.Set(ctx, "foo", []byte("1"), 0, 0))
+			require.NoError(t, c.Set(ctx, "bar", []byte("2"), 0, 0))
+
+			// twice, the second one is sent key by key directly.
+			for i := 0; i < 2; i++ {
+				items, err := c.GetAndTouches(ctx, time.Minute, "foo", "bar")
+				if tt.wantErr != nil {
+					require.ErrorIs(t, err, tt.wantErr)
+					continue
+				}
+				require.NoError(t, err)
+				require.Len(t, items, 2)
+				assert.Equal(t, "foo", items[0].Key)
+				assert.Equal(t, "bar", items[1].Key)
+			}
+		})
+	}
+}
+
+func Test_multiKeyGetAndTouch_fallbackExpires(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetSingleKeyGetAndTouch(true)
+
+	var requests atomic.Int32
+	hook := func(_ context.Context, info *RequestInfo) {
+		if info.Command == "gats" {
+			requests.Add(1)
+		}
+	}
+	clock := &fakeClock{now: time.Now()}
+	c, err := New(srv.Addr(), WithGetAndTouchFallback(true), WithClock(clock), WithRequestHook(hook))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("1"), 0, 0))
+	require.NoError(t, c.Set(ctx, "bar", []byte("2"), 0, 0))
+
+	getAndTouches := func() {
+		items, err := c.GetAndTouches(ctx, time.Minute, "foo", "bar")
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+	}
+
+	// the rejected multi-key gats and the keys one by one.
+	getAndTouches()
+	assert.Equal(t, int32(3), requests.Load())
+	// the keys one by one directly.
+	getAndTouches()
+	assert.Equal(t, int32(5), requests.Load())
+	// the server is probed again after the mark expires.
+	clock.advance(noMultiKeyRejectionTTL)
+	getAndTouches()
+	assert.Equal(t, int32(8), requests.Load())
+}
+
+func Test_multiKeyGetAndTouch_fallbackOtherErrors(t *testing.T) {
+	lines := make(chan string, 2)
+	addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+		for i := 0; i < 2; i++ {
+			line, err := rr.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+			_, _ = io.WriteString(w, "CLIENT_ERROR object too large for cache\r\n")
+		}
+	})
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMaxConns(1), WithGetAndTouchFallback(true))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the error other than the rejection of multiple keys is returned as is.
+	_, err = c.GetAndTouches(context.Background(), time.Minute, "foo", "bar")
+	require.ErrorIs(t, err, ErrClientError)
+	assert.False(t, c.(*client).multiKeyGetAndTouchRejected("gats", c.(*client).topology().addrs[0]))
+	assert.Equal(t, "gats 60 foo bar\r\n", <-lines)
+	assert.Empty(t, lines, "the keys must not be retried one by one")
+}
+
+func Test_client_TouchAndGetMulti(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	expiries := make(map[string]uint32, 16)
+	for i := 0; i < 16; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		require.NoError(t, c.Set(ctx, key, []byte("value-"+key), 0, time.Minute))
+		expiries[key] = uint32(100 * (i%3 + 1))
+	}
+	expiries["missing"] = 100
+
+	items, err := c.TouchAndGetMulti(ctx, expiries)
+	require.NoError(t, err)
+	require.Len(t, items, 16)
+	assert.NotContains(t, items, "missing")
+
+	for key, exptime := range expiries {
+		if key == "missing" {
+			continue
+		}
+		require.Contains(t, items, key)
+		assert.Equal(t, "value-"+key, string(items[key].Value))
+		assert.NotZero(t, items[key].CAS)
+
+		// each key is touched with its own exptime.
+		item, err := c.MetaGet(ctx, []byte(key), MetaGetFlagReturnTTL())
+		require.NoError(t, err)
+		assert.InDelta(t, int64(exptime), item.TTL, 1, key)
+	}
+
+	items, err = c.TouchAndGetMulti(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	_, err = c.TouchAndGetMulti(ctx, map[string]uint32{"key-0": 60*60*24*30 + 1})
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = c.TouchAndGetMulti(ctx, map[string]uint32{"": 60})
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func Test_groupKeysByExpiry(t *testing.T) {
+	groups := groupKeysByExpiry([]string{"a", "b", "c", "d"}, map[string]uint32{"a": 60, "b": 0, "c": 60, "d": 30})
+	require.Len(t, groups, 3)
+	assert.Equal(t, &expiryGroup{expiry: NoExpiration, keys: []string{"b"}}, groups[0])
+	assert.Equal(t, &expiryGroup{expiry: 30, keys: []string{"d"}}, groups[1])
+	assert.Equal(t, &expiryGroup{expiry: 60, keys: []string{"a", "c"}}, groups[2])
+}
+
+func Test_client_DeleteMultiAndTouchMulti(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	keys := make([]string, 0, 16)
+	for i := 0; i < 16; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		require.NoError(t, c.Set(ctx, key, []byte("value"), 0, time.Minute))
+	}
+
+	errs := c.TouchMulti(ctx, 0, append([]string{"missing", ""}, keys...))
+	require.Len(t, errs, 2)
+	assert.ErrorIs(t, errs["missing"], ErrNotFound)
+	assert.ErrorIs(t, errs[""], ErrInvalidKey)
+
+	// the keys never expire after touched with 0.
+	for _, key := range keys {
+		item, err := c.MetaGet(ctx, []byte(key), MetaGetFlagReturnTTL())
+		require.NoError(t, err)
+		assert.Equal(t, int64(-1), item.TTL, key)
+	}
+
+	assert.Nil(t, c.DeleteMulti(ctx, append([]string{"missing"}, keys...)))
+	for _, key := range keys {
+		_, err := c.Get(ctx, key)
+		require.ErrorIs(t, err, ErrNotFound, key)
+	}
+
+	errs = c.TouchMulti(ctx, time.Minute, keys[:2])
+	require.Len(t, errs, 2)
+	assert.ErrorIs(t, errs[keys[0]], ErrNotFound)
+}
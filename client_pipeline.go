@@ -0,0 +1,119 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// dispatchQuietPipeline sends the quiet meta commands to the memcached server at
+// given address in one round trip, and fences them with one mn command. The
+// commands must be built with the q flag and the O flag of their 1-based positions,
+// so that the replies which are not suppressed (e.g. NS, EX, or the values of mg)
+// are attributed to the commands by their opaque tokens. The returned replies are
+// copied, and keyed by the tokens.
+//
+// An error line (e.g. SERVER_ERROR) carries no opaque token, since memcached
+// replies the commands in order, it's tied to the command after the last one
+// replied with the token.
+func (c *client) dispatchQuietPipeline(ctx context.Context, addr *Addr, reqs []*request) (map[uint64][][]byte, error) {
+	if len(reqs) == 0 {
+		return map[uint64][][]byte{}, nil
+	}
+
+	req := joinQuietRequests(reqs)
+	resp := buildFencedResponse()
+	resp.inlineFaults = true
+	defer releaseReqAndResp(req, resp)
+
+	if err := c.dispatchRequestTo(ctx, addr, req, resp); err != nil {
+		return nil, errors.Wrap(err, "request failed")
+	}
+
+	return groupRepliesByOpaque(resp.rawLines)
+}
+
+// joinQuietRequests joins the quiet meta commands into one request, which is
+// fenced by the mn command of the last one only.
+func joinQuietRequests(reqs []*request) *request {
+	size := len(_MetaNoOpCRLFBytes)
+	for _, r := range reqs {
+		size += len(r.raw)
+	}
+
+	last := len(reqs) - 1
+	raw := make([]byte, 0, size)
+	for i, r := range reqs {
+		if r.fenced && i < last {
+			raw = append(raw, r.raw[:len(r.raw)-len(_MetaNoOpCRLFBytes)]...)
+			continue
+		}
+		raw = append(raw, r.raw...)
+	}
+
+	req := buildRequest(reqs[0].cmd, nil, raw)
+	if req.fenced = reqs[last].fenced; !req.fenced {
+		fenceRequest(req)
+	}
+
+	return req
+}
+
+// groupRepliesByOpaque groups the reply lines of meta commands by the opaque
+// token of each reply, the data block is grouped with its VA line. The error
+// line is tied to the command after the last replied one, as the opaque tokens
+// are the positions of the commands.
+//
+// VA <size> <flags>*\r\n
+// <data block>\r\n
+// <CD> <flags>*\r\n
+func groupRepliesByOpaque(lines [][]byte) (map[uint64][][]byte, error) {
+	replies := make(map[uint64][][]byte, len(lines))
+
+	var last uint64
+	for i := 0; i < len(lines); i++ {
+		header := lines[i]
+		if isErrorLine(header) {
+			last++
+			replies[last] = [][]byte{bytes.Clone(header)}
+			continue
+		}
+		parts := bytes.Split(trimCRLF(header), _SpaceBytes)
+
+		flagsIndex := 1
+		reply := [][]byte{bytes.Clone(header)}
+		if bytes.Equal(parts[0], []byte("VA")) {
+			if i+1 >= len(lines) {
+				return nil, errors.Wrap(ErrMalformedResponse, "missing value")
+			}
+			flagsIndex = 2
+			i++
+			reply = append(reply, bytes.Clone(lines[i]))
+		}
+
+		opaque, ok := opaqueToken(parts, flagsIndex)
+		if !ok {
+			return nil, errors.Wrapf(ErrMalformedResponse, "reply %q without opaque token", trimCRLF(header))
+		}
+		replies[opaque] = reply
+		last = opaque
+	}
+
+	return replies, nil
+}
+
+// opaqueToken returns the numeric opaque token in the flags of reply.
+func opaqueToken(parts [][]byte, start int) (uint64, bool) {
+	for i := start; i < len(parts); i++ {
+		if len(parts[i]) < 2 || parts[i][0] != 'O' {
+			continue
+		}
+
+		opaque, err := strconv.ParseUint(string(parts[i][1:]), 10, 64)
+		return opaque, err == nil
+	}
+
+	return 0, false
+}
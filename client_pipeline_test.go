@@ -0,0 +1,215 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_quietMetaCommands_fenced(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ClientOption
+	}{
+		{name: "connection pool", opt: WithMaxConns(1)},
+		{name: "multiplexing", opt: WithMultiplexing(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			c, err := New(srv.Addr(), tt.opt)
+			require.NoError(t, err)
+			defer c.Close()
+
+			testQuietMetaCommands(t, c)
+			assert.Equal(t, 1, srv.Accepted())
+		})
+	}
+}
+
+func testQuietMetaCommands(t *testing.T, c Client) {
+	ctx := context.Background()
+
+	_, err := c.MetaSet(ctx, []byte("foo"), []byte("bar"), MetaSetFlagNoReply())
+	require.NoError(t, err)
+
+	// the reply of quiet mg on hit is not suppressed.
+	item, err := c.MetaGet(ctx, []byte("foo"), MetaGetFlagNoReply(), MetaGetFlagReturnValue())
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+
+	// the reply of the failure is not suppressed.
+	_, err = c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagNoReply(), MetaSetFlagCompareCAS(1<<40))
+	require.ErrorIs(t, err, ErrExists)
+
+	_, err = c.MetaDelete(ctx, []byte("missing"), MetaDeleteFlagNoReply())
+	require.NoError(t, err)
+
+	// the connection is still in sync with the requests.
+	got, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(got.Value))
+}
+
+func Test_dispatchQuietPipeline(t *testing.T) {
+	srv := newTestServer(t)
+	mc, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer mc.Close()
+
+	ctx := context.Background()
+	require.NoError(t, mc.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	c := mc.(*client)
+	build := []func() *request{
+		func() *request {
+			req, _, err := buildMetaSetCommand([]byte("foo"), []byte("baz"),
+				&metaSetFlags{q: true, O: 1, C: 1 << 40}, c.options.codec)
+			require.NoError(t, err)
+			return req
+		},
+		func() *request {
+			req, _ := buildMetaGetCommand([]byte("foo"), &metaGetFlags{q: true, O: 2, v: true})
+			return req
+		},
+		func() *request {
+			req, _ := buildMetaDeleteCommand([]byte("missing"), &metaDeleteFlags{q: true, O: 3})
+			return req
+		},
+	}
+	reqs := make([]*request, 0, len(build))
+	for _, fn := range build {
+		reqs = append(reqs, fn())
+	}
+
+	replies, err := c.dispatchQuietPipeline(ctx, c.topology().addrs[0], reqs)
+	require.NoError(t, err)
+	require.Len(t, replies, 2)
+
+	require.ErrorIs(t, parseMetaItem(replies[1], &MetaItem{}, true, c.options.codec), ErrExists)
+	item := &MetaItem{}
+	require.NoError(t, parseMetaItem(replies[2], item, true, c.options.codec))
+	assert.Equal(t, "bar", string(item.Value))
+	assert.Equal(t, uint64(2), item.Opaque)
+	assert.NotContains(t, replies, uint64(3))
+}
+
+func Test_dispatchQuietPipeline_errorLine(t *testing.T) {
+	srv := newTestServer(t)
+	mc, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer mc.Close()
+
+	ctx := context.Background()
+	require.NoError(t, mc.Set(ctx, "foo", []byte("bar"), 0, 0))
+	require.NoError(t, mc.Set(ctx, "counter", []byte("1"), 0, 0))
+
+	c := mc.(*client)
+	reqs := make([]*request, 0, 4)
+	for i, key := range []string{"counter", "foo", "counter", "foo"} {
+		req, _ := buildMetaArithmeticCommand([]byte(key), 1, &metaArithmeticFlags{q: true, O: uint64(i + 1)})
+		reqs = append(reqs, req)
+	}
+
+	// the increments of foo fail with the error lines without opaque token.
+	replies, err := c.dispatchQuietPipeline(ctx, c.topology().addrs[0], reqs)
+	require.NoError(t, err)
+	require.NoError(t, parseMetaItem(replies[1], &MetaItem{}, true, nil))
+	require.NoError(t, parseMetaItem(replies[3], &MetaItem{}, true, nil))
+	require.ErrorIs(t, parseMetaItem(replies[2], &MetaItem{}, true, nil), ErrNonNumericValue)
+	require.ErrorIs(t, parseMetaItem(replies[4], &MetaItem{}, true, nil), ErrNonNumericValue)
+
+	value, err := mc.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, "3", string(value.Value))
+}
+
+func Test_joinQuietRequests(t *testing.T) {
+	quiet := func(key string, opaque uint64) *request {
+		req, _ := buildMetaGetCommand([]byte(key), &metaGetFlags{q: true, O: opaque})
+		return req
+	}
+
+	req := joinQuietRequests([]*request{quiet("foo", 1), quiet("bar", 2)})
+	assert.Equal(t, "mg foo O1 q\r\nmg bar O2 q\r\nmn\r\n", string(req.raw))
+	assert.True(t, req.fenced)
+
+	// the command which is not fenced is followed by one.
+	unfenced := buildRequest([]byte("mg"), []byte("baz"), []byte("mg baz v\r\n"))
+	req = joinQuietRequests([]*request{quiet("foo", 1), unfenced})
+	assert.Equal(t, "mg foo O1 q\r\nmg baz v\r\nmn\r\n", string(req.raw))
+	assert.True(t, req.fenced)
+}
+
+func Test_groupRepliesByOpaque(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    map[uint64][]string
+		wantErr error
+	}{
+		{
+			name:  "empty",
+			lines: nil,
+			want:  map[uint64][]string{},
+		},
+		{
+			name:  "replies with values",
+			lines: []string{"NS O1\r\n", "VA 3 f0 O2 c5\r\n", "bar\r\n", "EX c9 O3\r\n"},
+			want: map[uint64][]string{
+				1: {"NS O1\r\n"},
+				2: {"VA 3 f0 O2 c5\r\n", "bar\r\n"},
+				3: {"EX c9 O3\r\n"},
+			},
+		},
+		{
+			name: "error lines tied in order",
+			lines: []string{
+				"SERVER_ERROR out of memory\r\n", "NS O2\r\n", "CLIENT_ERROR bad data chunk\r\n", "EX O5\r\n",
+			},
+			want: map[uint64][]string{
+				1: {"SERVER_ERROR out of memory\r\n"},
+				2: {"NS O2\r\n"},
+				3: {"CLIENT_ERROR bad data chunk\r\n"},
+				5: {"EX O5\r\n"},
+			},
+		},
+		{
+			name:    "reply without opaque",
+			lines:   []string{"NS O1\r\n", "EX\r\n"},
+			wantErr: ErrMalformedResponse,
+		},
+		{
+			name:    "value without data block",
+			lines:   []string{"VA 3 O2\r\n"},
+			wantErr: ErrMalformedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make([][]byte, 0, len(tt.lines))
+			for _, line := range tt.lines {
+				lines = append(lines, []byte(line))
+			}
+
+			replies, err := groupRepliesByOpaque(lines)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			got := make(map[uint64][]string, len(replies))
+			for opaque, reply := range replies {
+				for _, line := range reply {
+					got[opaque] = append(got[opaque], string(line))
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package memcached
 
 import (
+	"bufio"
 	"context"
+	"io"
+	"net"
 	"sync"
 	"testing"
 	"time"
@@ -29,7 +32,7 @@ func mustCompressCodec(t *testing.T, algorithm memcodec.Compression, threshold,
 
 func (su *clientTestSuite) SetupSuite() {
 	addrs := "localhost:11211"
-	c, err := newClientWithContext(context.Background(), addrs)
+	c, err := NewWithContext(context.Background(), addrs)
 	su.Require().NoError(err)
 	su.client = c.(*client)
 }
@@ -40,7 +43,7 @@ func (su *clientTestSuite) TearDownSuite() {
 }
 
 func (su *clientTestSuite) newCompressedClient() *client {
-	c, err := newClientWithContext(
+	c, err := NewWithContext(
 		context.Background(),
 		"localhost:11211",
 		WithCodec(mustCompressCodec(su.T(), memcodec.CompressionAlgorithmDeflate, 1, 6)),
@@ -242,7 +245,7 @@ func (su *clientTestSuite) Test_compressionMetaReadTransparency() {
 }
 
 func TestCompressionDisablesAppendPrepend(t *testing.T) {
-	client := &client{options: newClientOptions()}
+	client := &client{options: newClientOptions(), clientState: newClientState()}
 	client.options.codec = mustCompressCodec(t, memcodec.CompressionAlgorithmDeflate, 0, 6)
 
 	err := client.Append(context.Background(), "key", []byte("value"), 0, 0)
@@ -255,7 +258,7 @@ func TestCompressionDisablesAppendPrepend(t *testing.T) {
 }
 
 func TestCompressionDisablesMetaAppendPrepend(t *testing.T) {
-	client := &client{options: newClientOptions()}
+	client := &client{options: newClientOptions(), clientState: newClientState()}
 	client.options.codec = mustCompressCodec(t, memcodec.CompressionAlgorithmDeflate, 0, 6)
 
 	errModes := []metaSetMode{MetaSetModeAppend, MetaSetModePrepend}
@@ -299,7 +302,7 @@ func TestCodecCapabilitiesApplyPerTextStorageOperation(t *testing.T) {
 }
 
 func TestCodecCapabilitiesApplyPerCasOperation(t *testing.T) {
-	c := &client{options: newClientOptions()}
+	c := &client{options: newClientOptions(), clientState: newClientState()}
 	c.options.codec = prependOnlyRestrictedCodec{}
 
 	_, _, err := buildCasCommand("foo", []byte("bar"), 0, 0, 1, false, c.options.codec)
@@ -307,7 +310,7 @@ func TestCodecCapabilitiesApplyPerCasOperation(t *testing.T) {
 }
 
 func TestCodecCapabilitiesApplyPerMetaSetOperation(t *testing.T) {
-	c := &client{options: newClientOptions()}
+	c := &client{options: newClientOptions(), clientState: newClientState()}
 	c.options.codec = prependOnlyRestrictedCodec{}
 
 	flags := &metaSetFlags{}
@@ -331,6 +334,34 @@ func TestNewCompressCodecInstallsCompressionBehavior(t *testing.T) {
 	assert.Equal(t, uint32(0x12), memcodec.AppFlags(encodedFlags))
 }
 
+func TestFlagsPolicyChecksWrites(t *testing.T) {
+	srv := newTestServer(t)
+	policy := memcodec.NewFlagsPolicy(memcodec.CompressAppFlagsSize)
+	serializer, err := policy.Reserve("serializer", 4)
+	require.NoError(t, err)
+
+	c, err := New(srv.Addr(),
+		WithCodec(mustCompressCodec(t, memcodec.CompressionAlgorithmDeflate, 1, 6)),
+		WithFlagsPolicy(policy),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	flags, err := serializer.Set(0, 2)
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), flags, 0))
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), serializer.Get(item.Flags))
+
+	// the bits not reserved are rejected before sent.
+	require.ErrorIs(t, c.Set(ctx, "foo", []byte("bar"), 0x10, 0), ErrInvalidArgument)
+	_, err = c.MetaSet(ctx, []byte("foo"), []byte("bar"), MetaSetFlagClientFlags(0x10))
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
 func TestClientSuite(t *testing.T) {
 	suite.Run(t, new(clientTestSuite))
 }
@@ -339,7 +370,7 @@ func Test_udp(t *testing.T) {
 	t.Skipf("skip test_udp, since it could not run in CI")
 
 	addrs := "udp://localhost:11211"
-	c, err := newClientWithContext(context.Background(), addrs, WithUDPEnabled())
+	c, err := NewWithContext(context.Background(), addrs, WithUDPEnabled())
 	if err != nil {
 		t.Fatalf("Failed to create client: %+v", err)
 	}
@@ -360,7 +391,7 @@ func Test_unix(t *testing.T) {
 	t.Skipf("skip test_unix, since it could not run in CI")
 
 	addrs := "unix:///tmp/memcached.sock"
-	c, err := newClientWithContext(context.Background(), addrs)
+	c, err := NewWithContext(context.Background(), addrs)
 	require.NoError(t, err)
 	require.NotNil(t, c)
 
@@ -370,3 +401,45 @@ func Test_unix(t *testing.T) {
 
 	t.Logf("version: %s", ver)
 }
+
+func TestDispatchDiscardsConnOutOfSync(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		// the first connection replies a truncated value and hangs, the second
+		// one replies as expected.
+		for i := 0; i < 2; i++ {
+			cn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			rr := bufio.NewReader(cn)
+			if line, _ := rr.ReadString('\n'); line != "get foo\r\n" {
+				_ = cn.Close()
+				return
+			}
+			if i == 0 {
+				_, _ = io.WriteString(cn, "VALUE foo 0 3\r\nb")
+				defer cn.Close()
+				continue
+			}
+			_, _ = io.WriteString(cn, "VALUE foo 0 3\r\nbar\r\nEND\r\n")
+			defer cn.Close()
+		}
+	}()
+
+	c, err := New(ln.Addr().String(), WithCapabilityDetection(false), WithMaxConns(1),
+		WithReadTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Get(context.Background(), "foo")
+	require.Error(t, err)
+
+	// the connection left out of sync is not reused.
+	item, err := c.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bar"), item.Value)
+}
@@ -0,0 +1,20 @@
+package memcached
+
+import (
+	"time"
+)
+
+// Clock tells the current time to the client, see WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock of the wall clock, it's the default.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return nowFunc() }
+
+// now returns the current time by the Clock of the client.
+func (c *client) now() time.Time {
+	return c.options.clock.Now()
+}
@@ -0,0 +1,150 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is the Clock moved by hand.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestWithClock(t *testing.T) {
+	o := newClientOptions()
+	assert.Equal(t, systemClock{}, o.clock)
+
+	clock := &fakeClock{now: time.Now()}
+	WithClock(clock)(o)
+	assert.Equal(t, clock, o.clock)
+	WithClock(nil)(o)
+	assert.Equal(t, systemClock{}, o.clock)
+
+	// the clock could not be changed at runtime or by a view.
+	assert.False(t, updatableAtRuntime(WithClock(clock)))
+	assert.False(t, overridableByView(WithClock(clock)))
+}
+
+func TestWithClock_pool(t *testing.T) {
+	srv := newTestServer(t)
+	clock := &fakeClock{now: time.Now()}
+	c, err := New(srv.Addr(), WithClock(clock), WithMaxLifetime(time.Hour), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+	_, err = c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Zero(t, c.PoolStats()[srv.Addr()].MaxLifeTimeClosed)
+
+	// the connection expires by the clock rather than the wall clock.
+	clock.advance(2 * time.Hour)
+	_, err = c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), c.PoolStats()[srv.Addr()].MaxLifeTimeClosed)
+}
+
+func TestWithClock_Mutex(t *testing.T) {
+	srv := newTestServer(t)
+	clock := &fakeClock{now: time.Now().Add(24 * time.Hour)}
+	c, err := New(srv.Addr(), WithClock(clock))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the ttl longer than 30 days is converted by the clock.
+	ctx := context.Background()
+	ttl := 40 * 24 * time.Hour
+	m := c.NewMutex("lock", ttl)
+	ok, err := m.TryLock(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	item, err := c.MetaGet(ctx, []byte("lock"), MetaGetFlagReturnTTL())
+	require.NoError(t, err)
+	assert.InDelta(t, (ttl + 24*time.Hour).Seconds(), float64(item.TTL), 5)
+}
+
+func TestWithClock_Namespaces(t *testing.T) {
+	srv := newTestServer(t)
+	start := time.Now().Add(24 * time.Hour)
+	clock := &fakeClock{now: start}
+	c, err := New(srv.Addr(), WithClock(clock))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the version is initialized by the clock.
+	ctx := context.Background()
+	ns := c.Namespaces(NamespaceCacheTTL(time.Minute))
+	version, err := ns.Version(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(start.UnixNano()), version)
+
+	// the cached version expires by the clock as well.
+	require.NoError(t, c.Namespaces().InvalidateNamespace(ctx, "user"))
+	cached, err := ns.Version(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, version, cached)
+
+	clock.advance(2 * time.Minute)
+	bumped, err := ns.Version(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, version+1, bumped)
+}
+
+func TestWithClock_ScheduleFlush(t *testing.T) {
+	srv := newTestServer(t)
+	clock := &fakeClock{now: time.Now().Add(24 * time.Hour)}
+	c, err := New(srv.Addr(), WithClock(clock))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the delay longer than 30 days is converted by the clock as the shorter ones.
+	ctx := context.Background()
+	addr := c.(*client).topology().addrs[0]
+	delay := 40 * 24 * time.Hour
+	require.NoError(t, c.ScheduleFlush(ctx, addr, delay))
+	assert.Equal(t, []ScheduledFlush{{Addr: addr, At: time.Unix(clock.Now().Add(delay).Unix(), 0)}}, c.ScheduledFlushes())
+
+	clock.advance(delay)
+	assert.Empty(t, c.ScheduledFlushes())
+}
+
+func TestWithClock_Counter(t *testing.T) {
+	srv := newTestServer(t)
+	clock := &fakeClock{now: time.Now()}
+	c, err := New(srv.Addr(), WithClock(clock))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the ttl longer than 30 days is converted by the clock when the item is
+	// created, rather than when the counter is built.
+	ctx := context.Background()
+	ttl := 40 * 24 * time.Hour
+	counter := c.Counter("hits", ttl)
+	clock.advance(60 * 24 * time.Hour)
+	_, err = counter.Incr(ctx, 1)
+	require.NoError(t, err)
+
+	item, err := c.MetaGet(ctx, []byte("hits"), MetaGetFlagReturnTTL())
+	require.NoError(t, err)
+	assert.InDelta(t, (ttl + 60*24*time.Hour).Seconds(), float64(item.TTL), 5)
+}
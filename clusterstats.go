@@ -0,0 +1,168 @@
+package memcached
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// StatsOutlierFactor is the factor by which a metric of a node exceeds the median
+// of the other nodes to be reported as an outlier by AggregateStats.
+var StatsOutlierFactor = 10.0
+
+// outlierMetrics are the metrics of the nodes checked for outliers, in the order
+// the outliers are reported.
+var outlierMetrics = []struct {
+	name  string
+	value func(s *Statistic) int64
+}{
+	{name: "evictions", value: func(s *Statistic) int64 { return s.Evictions }},
+	{name: "curr_items", value: func(s *Statistic) int64 { return s.CurrItems }},
+	{name: "bytes", value: func(s *Statistic) int64 { return s.Bytes }},
+	{name: "curr_connections", value: func(s *Statistic) int64 { return s.CurrConnections }},
+}
+
+// ClusterStats is the cluster-wide view of the stats of all servers, reported by
+// AggregateStats. The counters are summed over the nodes replied successfully.
+type ClusterStats struct {
+	// Nodes holds the stats of each server replied successfully.
+	Nodes map[*Addr]*Statistic
+
+	CurrItems       int64
+	Bytes           int64
+	LimitMaxbytes   int64
+	CurrConnections int64
+	CmdGet          int64
+	CmdSet          int64
+	GetHits         int64
+	GetMisses       int64
+	Evictions       int64
+
+	// HitRate is the ratio of the hits to the gets of all nodes, i.e. the hit rate
+	// of each node weighted by its gets. It's 0 if there is no get.
+	HitRate float64
+	// MemoryUsage is the ratio of Bytes to LimitMaxbytes, 0 if the limit is unknown.
+	MemoryUsage float64
+
+	// Outliers are the metrics of the nodes exceeding StatsOutlierFactor times the
+	// median of the other nodes, e.g. one node evicting far more than the others.
+	Outliers []StatsOutlier
+}
+
+// StatsOutlier is a metric of a node far beyond the other nodes.
+type StatsOutlier struct {
+	Addr *Addr
+	// Metric is the name of the stat, e.g. "evictions".
+	Metric string
+	Value  int64
+	// Median is the median of the metric of the other nodes.
+	Median float64
+}
+
+// AggregateStats queries the stats of all memcached servers and aggregates them
+// into the cluster-wide view, see ClusterStats. The view of the servers which
+// reply successfully is returned along with the error.
+func (c *client) AggregateStats(ctx context.Context) (*ClusterStats, error) {
+	var mu sync.Mutex
+	nodes := make(map[*Addr]*Statistic, len(c.topology().addrs))
+
+	call := func(ctx context.Context, addr *Addr, cn memcachedConn) error {
+		lines, err := c.statsLines(ctx, addr, cn, "")
+		if err != nil {
+			return err
+		}
+		stats, err := parseStats(lines)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		nodes[addr] = stats
+		mu.Unlock()
+		return nil
+	}
+
+	err := c.broadcastRequest(ctx, "stats", call)
+	cs := aggregateStats(nodes)
+	if err != nil {
+		return cs, errors.Wrap(err, "request failed")
+	}
+
+	return cs, nil
+}
+
+// aggregateStats sums the stats of the nodes and finds the outliers among them.
+func aggregateStats(nodes map[*Addr]*Statistic) *ClusterStats {
+	cs := &ClusterStats{Nodes: nodes}
+	for _, s := range nodes {
+		cs.CurrItems += s.CurrItems
+		cs.Bytes += s.Bytes
+		cs.LimitMaxbytes += s.LimitMaxbytes
+		cs.CurrConnections += s.CurrConnections
+		cs.CmdGet += s.CmdGet
+		cs.CmdSet += s.CmdSet
+		cs.GetHits += s.GetHits
+		cs.GetMisses += s.GetMisses
+		cs.Evictions += s.Evictions
+	}
+
+	if gets := cs.GetHits + cs.GetMisses; gets > 0 {
+		cs.HitRate = float64(cs.GetHits) / float64(gets)
+	}
+	if cs.LimitMaxbytes > 0 {
+		cs.MemoryUsage = float64(cs.Bytes) / float64(cs.LimitMaxbytes)
+	}
+	cs.Outliers = findStatsOutliers(nodes)
+
+	return cs
+}
+
+// findStatsOutliers reports the metrics of the nodes exceeding StatsOutlierFactor
+// times the median of the other nodes, the median is taken as 1 at least so that
+// a few evictions of a node are not reported when the others have none.
+func findStatsOutliers(nodes map[*Addr]*Statistic) []StatsOutlier {
+	if len(nodes) < 2 {
+		return nil
+	}
+
+	addrs := make([]*Addr, 0, len(nodes))
+	for addr := range nodes {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Address < addrs[j].Address })
+
+	var outliers []StatsOutlier
+	others := make([]int64, 0, len(addrs)-1)
+	for _, metric := range outlierMetrics {
+		for _, addr := range addrs {
+			others = others[:0]
+			for _, other := range addrs {
+				if other != addr {
+					others = append(others, metric.value(nodes[other]))
+				}
+			}
+
+			median := medianOf(others)
+			value := metric.value(nodes[addr])
+			if float64(value) > StatsOutlierFactor*max(median, 1) {
+				outliers = append(outliers, StatsOutlier{Addr: addr, Metric: metric.name, Value: value, Median: median})
+			}
+		}
+	}
+
+	return outliers
+}
+
+// medianOf returns the median of the values, it sorts the values in place.
+func medianOf(values []int64) float64 {
+	slices.Sort(values)
+	n := len(values)
+	if n%2 == 1 {
+		return float64(values[n/2])
+	}
+
+	return float64(values[n/2-1]+values[n/2]) / 2
+}
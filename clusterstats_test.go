@@ -0,0 +1,58 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_aggregateStats(t *testing.T) {
+	a, b, c := &Addr{Address: "a:11211"}, &Addr{Address: "b:11211"}, &Addr{Address: "c:11211"}
+	nodes := map[*Addr]*Statistic{
+		a: {CurrItems: 100, Bytes: 1000, LimitMaxbytes: 4000, GetHits: 90, GetMisses: 10, Evictions: 5},
+		b: {CurrItems: 120, Bytes: 1000, LimitMaxbytes: 4000, GetHits: 10, GetMisses: 90, Evictions: 6},
+		c: {CurrItems: 110, Bytes: 2000, LimitMaxbytes: 4000, Evictions: 200},
+	}
+
+	cs := aggregateStats(nodes)
+	assert.Equal(t, int64(330), cs.CurrItems)
+	assert.Equal(t, int64(4000), cs.Bytes)
+	assert.Equal(t, int64(211), cs.Evictions)
+	assert.InDelta(t, 0.5, cs.HitRate, 1e-9)
+	assert.InDelta(t, 4000.0/12000, cs.MemoryUsage, 1e-9)
+	assert.Equal(t, []StatsOutlier{{Addr: c, Metric: "evictions", Value: 200, Median: 5.5}}, cs.Outliers)
+
+	// a few evictions are not outliers when the others have none.
+	cs = aggregateStats(map[*Addr]*Statistic{a: {Evictions: 3}, b: {}})
+	assert.Empty(t, cs.Outliers)
+	assert.Zero(t, cs.HitRate)
+	assert.Zero(t, cs.MemoryUsage)
+
+	cs = aggregateStats(map[*Addr]*Statistic{a: {Evictions: 300}})
+	assert.Empty(t, cs.Outliers)
+}
+
+func Test_client_AggregateStats(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key-%d", i), []byte("value"), 0, 0))
+	}
+
+	cs, err := c.AggregateStats(ctx)
+	require.NoError(t, err)
+	assert.Len(t, cs.Nodes, 2)
+	assert.Equal(t, int64(20), cs.CurrItems)
+
+	srv2.Stop()
+	cs, err = c.AggregateStats(ctx)
+	require.Error(t, err)
+	assert.Len(t, cs.Nodes, 1)
+}
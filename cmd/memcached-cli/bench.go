@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/yeqown/memcached"
+)
+
+// benchOptions holds the parameters of a benchmark run, the names are
+// borrowed from memtier_benchmark so that the results are comparable.
+type benchOptions struct {
+	clients   int
+	ratio     string
+	valueSize int
+	duration  time.Duration
+	keySpace  int
+	keyPrefix string
+}
+
+func newBenchCommand() *cobra.Command {
+	var (
+		contextName string
+		opts        benchOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Run a load test against the current context",
+		Long: "Bench drives set/get load against the memcached servers of the current (or given) context " +
+			"through the library's connection pool, and reports throughput and latency percentiles.",
+		Example:      "memcached-cli bench --clients 50 --ratio 1:10 --value-size 100 --duration 30s",
+		SilenceUsage: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cmd.Root().PersistentPreRun(cmd, args)
+
+			manager, err := newContextManager()
+			if err != nil {
+				logger.Warnf("failed to create context manager: %v", err)
+			}
+			storeContextManager(cmd, manager)
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			manager := getContextManager(cmd, false)
+			if err := manager.close(); err != nil {
+				logger.Warnf("failed to save context: %v", err)
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sets, gets, err := parseBenchRatio(opts.ratio)
+			if err != nil {
+				return err
+			}
+			if opts.clients <= 0 || opts.valueSize < 0 || opts.duration <= 0 || opts.keySpace <= 0 {
+				return errors.New("clients, duration and key-space must be positive, value-size must not be negative")
+			}
+
+			manager := getContextManager(cmd, false)
+			client, err := manager.getClientWithContext(contextName)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Running %s test with %d clients, ratio %d:%d (set:get), value size %d bytes, key space %d\n",
+				opts.duration, opts.clients, sets, gets, opts.valueSize, opts.keySpace)
+
+			report := runBench(cmd.Context(), client, &opts, sets, gets)
+			printBenchReport(report)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&contextName, "context", "c", "", "context name to use, if not set, use current context")
+	cmd.Flags().IntVar(&opts.clients, "clients", 50, "number of concurrent clients")
+	cmd.Flags().StringVar(&opts.ratio, "ratio", "1:10", "set:get ratio")
+	cmd.Flags().IntVar(&opts.valueSize, "value-size", 100, "size of the value in bytes for set commands")
+	cmd.Flags().DurationVar(&opts.duration, "duration", 30*time.Second, "duration of the test")
+	cmd.Flags().IntVar(&opts.keySpace, "key-space", 10000, "number of distinct keys to use")
+	cmd.Flags().StringVar(&opts.keyPrefix, "key-prefix", "memtier-", "prefix of the keys")
+
+	return cmd
+}
+
+// parseBenchRatio parses the ratio in format "<set>:<get>", e.g. "1:10".
+func parseBenchRatio(ratio string) (sets, gets int, err error) {
+	parts := strings.Split(ratio, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid ratio %q, expect format <set>:<get>", ratio)
+	}
+
+	if sets, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil || sets < 0 {
+		return 0, 0, fmt.Errorf("invalid set ratio %q", parts[0])
+	}
+	if gets, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil || gets < 0 {
+		return 0, 0, fmt.Errorf("invalid get ratio %q", parts[1])
+	}
+	if sets+gets == 0 {
+		return 0, 0, fmt.Errorf("invalid ratio %q, at least one of set and get must be positive", ratio)
+	}
+
+	return sets, gets, nil
+}
+
+// benchStats records the result of one kind of command.
+type benchStats struct {
+	ops       int
+	errors    int
+	misses    int
+	latencies latencyHistogram
+}
+
+func (s *benchStats) merge(other *benchStats) {
+	s.ops += other.ops
+	s.errors += other.errors
+	s.misses += other.misses
+	s.latencies.merge(&other.latencies)
+}
+
+// latencyHistogram splits each power of two into latencySubBuckets linear
+// sub-buckets, which bounds the relative error of the percentiles to
+// 1/latencySubBuckets.
+const (
+	latencySubBucketBits = 5
+	latencySubBuckets    = 1 << latencySubBucketBits
+	latencyBuckets       = (64 - latencySubBucketBits + 1) * latencySubBuckets
+)
+
+// latencyHistogram is a log-linear histogram of the latencies in nanoseconds,
+// it takes the same memory however long the test runs, at the cost of
+// reporting the percentiles within 1/latencySubBuckets of the recorded ones.
+// The average and the max are exact.
+type latencyHistogram struct {
+	counts [latencyBuckets]uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// latencyBucket returns the index of the bucket holding v.
+func latencyBucket(v uint64) int {
+	if v < latencySubBuckets {
+		return int(v)
+	}
+
+	shift := bits.Len64(v) - latencySubBucketBits - 1
+	return (shift+1)*latencySubBuckets + int(v>>shift) - latencySubBuckets
+}
+
+// latencyBucketMax returns the largest value held by the bucket at idx.
+func latencyBucketMax(idx int) uint64 {
+	if idx < latencySubBuckets {
+		return uint64(idx)
+	}
+
+	shift := idx/latencySubBuckets - 1
+	lower := uint64(idx%latencySubBuckets+latencySubBuckets) << shift
+	return lower + (1 << shift) - 1
+}
+
+func (h *latencyHistogram) record(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+
+	h.counts[latencyBucket(uint64(latency))]++
+	h.count++
+	h.sum += latency
+	if latency > h.max {
+		h.max = latency
+	}
+}
+
+func (h *latencyHistogram) merge(other *latencyHistogram) {
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+	h.count += other.count
+	h.sum += other.sum
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+func (h *latencyHistogram) avg() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	return h.sum / time.Duration(h.count)
+}
+
+// percentile returns the p-th percentile of the latencies, it's never greater
+// than the max latency recorded.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(float64(h.count)*p/100 + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > h.count {
+		rank = h.count
+	}
+
+	var seen uint64
+	for i, n := range h.counts {
+		if seen += n; seen >= rank {
+			if v := time.Duration(latencyBucketMax(i)); v < h.max {
+				return v
+			}
+			break
+		}
+	}
+
+	return h.max
+}
+
+type benchReport struct {
+	elapsed time.Duration
+	sets    *benchStats
+	gets    *benchStats
+}
+
+func runBench(ctx context.Context, client memcached.Client, opts *benchOptions, sets, gets int) *benchReport {
+	ctx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	value := []byte(strings.Repeat("x", opts.valueSize))
+	report := &benchReport{sets: &benchStats{}, gets: &benchStats{}}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	start := time.Now()
+	for i := 0; i < opts.clients; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			rnd := rand.New(rand.NewSource(seed))
+			setStats, getStats := &benchStats{}, &benchStats{}
+
+			for n := 0; ctx.Err() == nil; n++ {
+				key := opts.keyPrefix + strconv.Itoa(rnd.Intn(opts.keySpace))
+
+				// issue sets first and then gets in each cycle of (sets + gets) commands.
+				if n%(sets+gets) < sets {
+					began := time.Now()
+					err := client.Set(ctx, key, value, 0, 0)
+					recordBenchResult(ctx, setStats, time.Since(began), err)
+					continue
+				}
+
+				began := time.Now()
+				_, err := client.Get(ctx, key)
+				recordBenchResult(ctx, getStats, time.Since(began), err)
+			}
+
+			mu.Lock()
+			report.sets.merge(setStats)
+			report.gets.merge(getStats)
+			mu.Unlock()
+		}(time.Now().UnixNano() + int64(i))
+	}
+
+	wg.Wait()
+	report.elapsed = time.Since(start)
+
+	return report
+}
+
+func recordBenchResult(ctx context.Context, stats *benchStats, latency time.Duration, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, memcached.ErrNotFound):
+		stats.misses++
+	case ctx.Err() != nil:
+		// the test is over, the command is interrupted by the deadline.
+		return
+	default:
+		stats.errors++
+	}
+
+	stats.ops++
+	stats.latencies.record(latency)
+}
+
+func printBenchReport(report *benchReport) {
+	seconds := report.elapsed.Seconds()
+
+	fmt.Println()
+	fmt.Printf("%-8s %12s %12s %10s %10s %12s %12s %12s %12s %12s\n",
+		"Type", "Ops/sec", "Ops", "Misses", "Errors", "Avg", "p50", "p99", "p99.9", "Max")
+	fmt.Println(strings.Repeat("-", 126))
+
+	total := &benchStats{}
+	for _, row := range []struct {
+		name  string
+		stats *benchStats
+	}{
+		{name: "Sets", stats: report.sets},
+		{name: "Gets", stats: report.gets},
+		{name: "Totals", stats: total},
+	} {
+		if row.stats != total {
+			total.merge(row.stats)
+		}
+
+		latencies := &row.stats.latencies
+		fmt.Printf("%-8s %12.2f %12d %10d %10d %12s %12s %12s %12s %12s\n",
+			row.name,
+			float64(row.stats.ops)/seconds,
+			row.stats.ops,
+			row.stats.misses,
+			row.stats.errors,
+			latencies.avg(),
+			latencies.percentile(50),
+			latencies.percentile(99),
+			latencies.percentile(99.9),
+			latencies.max,
+		)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_latencyBucket(t *testing.T) {
+	for _, v := range []uint64{0, 1, 31, 32, 33, 63, 64, 65, 1000, 123456789, 1<<63 - 1} {
+		idx := latencyBucket(v)
+		if idx < 0 || idx >= latencyBuckets {
+			t.Fatalf("latencyBucket(%d) = %d, out of range", v, idx)
+		}
+		if upper := latencyBucketMax(idx); v > upper {
+			t.Errorf("latencyBucketMax(%d) = %d, less than %d", idx, upper, v)
+		}
+		if idx > 0 {
+			if prev := latencyBucketMax(idx - 1); v <= prev {
+				t.Errorf("%d is held by bucket %d, but not greater than the max %d of the previous one", v, idx, prev)
+			}
+		}
+	}
+}
+
+func Test_latencyHistogram_percentile(t *testing.T) {
+	var h latencyHistogram
+	if got := h.percentile(99); got != 0 {
+		t.Fatalf("percentile of empty histogram = %s, want 0", got)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	latencies := make([]time.Duration, 100000)
+	for i := range latencies {
+		latencies[i] = time.Duration(rnd.ExpFloat64() * float64(time.Millisecond))
+		h.record(latencies[i])
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	for _, p := range []float64{50, 90, 99, 99.9} {
+		want := latencies[int(float64(len(latencies))*p/100+0.5)-1]
+		got := h.percentile(p)
+		if got < want || float64(got-want) > float64(want)/latencySubBuckets {
+			t.Errorf("p%v = %s, want within 1/%d above %s", p, got, latencySubBuckets, want)
+		}
+	}
+	if got := h.percentile(100); got != latencies[len(latencies)-1] {
+		t.Errorf("p100 = %s, want the max %s", got, latencies[len(latencies)-1])
+	}
+	if h.max != latencies[len(latencies)-1] {
+		t.Errorf("max = %s, want %s", h.max, latencies[len(latencies)-1])
+	}
+}
+
+func Test_benchStats_merge(t *testing.T) {
+	a, b := &benchStats{}, &benchStats{}
+	for i := 1; i <= 10; i++ {
+		recordBenchResult(t.Context(), a, time.Duration(i)*time.Millisecond, nil)
+		recordBenchResult(t.Context(), b, time.Duration(i+10)*time.Millisecond, nil)
+	}
+
+	a.merge(b)
+	if a.ops != 20 || a.latencies.count != 20 {
+		t.Fatalf("ops = %d, count = %d, want 20", a.ops, a.latencies.count)
+	}
+	if got, want := a.latencies.avg(), 10500*time.Microsecond; got != want {
+		t.Errorf("avg = %s, want %s", got, want)
+	}
+	if got, want := a.latencies.max, 20*time.Millisecond; got != want {
+		t.Errorf("max = %s, want %s", got, want)
+	}
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 	"strings"
 	"time"
 
@@ -9,6 +14,7 @@ import (
 	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 	"github.com/yeqown/memcached"
+	"gopkg.in/yaml.v3"
 )
 
 /**
@@ -69,22 +75,12 @@ func newContextListCommand() *cobra.Command {
 		Short: "List all contexts",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			manager := getContextManager(cmd, false)
-			current, _ := manager.getCurrentContext()
-			allContexts := manager.listContexts()
-			if len(allContexts) == 0 {
-				fmt.Println("No contexts found.")
-			} else {
-				fmt.Printf("Found %d Contexts:\n", len(allContexts))
-				fmt.Println()
+			currentName := ""
+			if current, _ := manager.getCurrentContext(); current != nil {
+				currentName = current.Name
 			}
 
-			for _, name := range allContexts {
-				if current != nil && current.Name == name {
-					fmt.Printf("* %s\n", name)
-				} else {
-					fmt.Printf("  %s\n", name)
-				}
-			}
+			getPrinter().printContexts(manager.listContexts(), currentName)
 
 			return nil
 		},
@@ -132,28 +128,88 @@ func newContextCurrentCommand() *cobra.Command {
 				return err
 			}
 
-			// 处理服务器地址的换行显示
-			servers := strings.Split(ctx.Servers, ",")
-
-			fmt.Printf("📌 Current Context: %s\n", ctx.Name)
-			fmt.Println("\nConfigurations:")
-			fmt.Println("┌─────────────────────┬──────────────────────────────────────────────────────┐")
-			fmt.Printf("│ %-20s│ %-52s │\n", "Param", "Value")
-			fmt.Println("├─────────────────────┼──────────────────────────────────────────────────────┤")
-			fmt.Printf("│ %-20s│ %-52s │\n", "Servers", fmt.Sprintf("%d instances:", len(servers)))
-			for _, server := range servers {
-				fmt.Printf("│                     │ %-52s │\n", server)
+			getPrinter().printContext(ctx)
+
+			return nil
+		},
+	}
+}
+
+// contextsFile is the file format of the exported contexts.
+type contextsFile struct {
+	Contexts []*Context `yaml:"contexts"`
+}
+
+func newContextExportCommand() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "export [name...]",
+		Short: "Export contexts as YAML, all contexts if no name is given",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager := getContextManager(cmd, false)
+			contexts, err := manager.exportContexts(args)
+			if err != nil {
+				return err
+			}
+
+			data, err := yaml.Marshal(contextsFile{Contexts: contexts})
+			if err != nil {
+				return errors.Wrap(err, "marshal contexts")
+			}
+			if file == "" || file == "-" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+
+			return os.WriteFile(file, data, 0600)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "file to write the contexts to, stdout by default")
+
+	return cmd
+}
+
+func newContextImportCommand() *cobra.Command {
+	var overwrite bool
+
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import contexts from the YAML file exported by `ctx export`, '-' reads stdin",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				data []byte
+				err  error
+			)
+			if args[0] == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return errors.Wrap(err, "read contexts")
+			}
+
+			var imported contextsFile
+			if err = yaml.Unmarshal(data, &imported); err != nil {
+				return errors.Wrap(err, "parse contexts")
 			}
-			fmt.Printf("│ %-20s│ %-52d │\n", "ConnectionPoolSize", ctx.Config.PoolSize)
-			fmt.Printf("│ %-20s│ %-52s │\n", "DialTimeout", ctx.Config.DialTimeout)
-			fmt.Printf("│ %-20s│ %-52s │\n", "ReadTimeout", ctx.Config.ReadTimeout)
-			fmt.Printf("│ %-20s│ %-52s │\n", "WriteTimeout", ctx.Config.WriteTimeout)
-			fmt.Printf("│ %-20s│ %-52s │\n", "HashStrategy", ctx.Config.HashStrategy)
-			fmt.Println("└─────────────────────┴──────────────────────────────────────────────────────┘")
 
+			manager := getContextManager(cmd, false)
+			if err = manager.importContexts(imported.Contexts, overwrite); err != nil {
+				return err
+			}
+
+			fmt.Printf("%d contexts imported.\n", len(imported.Contexts))
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "replace the existing contexts of the same names")
+
+	return cmd
 }
 
 /**
@@ -180,38 +236,55 @@ func newKVGetCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			item, err := client.MetaGet(
-				cmd.Context(),
-				[]byte(args[0]), // key
-				memcached.MetaGetFlagReturnTTL(),
-				memcached.MetaGetFlagReturnSize(),
-				memcached.MetaGetFlagReturnValue(),
-				memcached.MetaGetFlagReturnCAS(),
-				memcached.MetaGetFlagReturnKey(),
-				memcached.MetaGetFlagReturnClientFlags(),
-				memcached.MetaGetFlagReturnLastAccessedTime(),
-				memcached.MetaGetFlagReturnHitBefore(),
-			)
-			if err != nil {
-				return ignoreMemcachedError(err)
-			}
 
-			history.addRecord("get", args)
+			return onNode(cmd, client, func(ctx context.Context) error {
+				item, err := client.MetaGet(
+					ctx,
+					[]byte(args[0]), // key
+					memcached.MetaGetFlagReturnTTL(),
+					memcached.MetaGetFlagReturnSize(),
+					memcached.MetaGetFlagReturnValue(),
+					memcached.MetaGetFlagReturnCAS(),
+					memcached.MetaGetFlagReturnKey(),
+					memcached.MetaGetFlagReturnClientFlags(),
+					memcached.MetaGetFlagReturnLastAccessedTime(),
+					memcached.MetaGetFlagReturnHitBefore(),
+				)
+				if err != nil {
+					return ignoreMemcachedError(err)
+				}
 
-			printMetaItem(item)
+				history.addRecord("get", args)
 
-			return nil
+				getPrinter().printMetaItem(item)
+
+				return nil
+			})
 		},
 	}
 }
 
 // 修改 KV 命令，添加历史记录
 func newKVSetCommand() *cobra.Command {
-	var expiration time.Duration
+	return newKVStorageCommand("set", "Set key to value")
+}
+
+func newKVAddCommand() *cobra.Command {
+	return newKVStorageCommand("add", "Add key with value if it does not exist")
+}
+
+func newKVReplaceCommand() *cobra.Command {
+	return newKVStorageCommand("replace", "Replace value of key if it exists")
+}
+
+// newKVStorageCommand returns the kv command of the storage command, one of set,
+// add and replace, the flags are shared with the REPL, see bindStorageFlags.
+func newKVStorageCommand(command, short string) *cobra.Command {
+	opts := &storageOptions{}
 
 	cmd := &cobra.Command{
-		Use:          "set [key] [value]",
-		Short:        "Set key to value",
+		Use:          command + " [key] [value]",
+		Short:        short,
 		Args:         cobra.ExactArgs(2),
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -222,19 +295,20 @@ func newKVSetCommand() *cobra.Command {
 				return err
 			}
 
-			err = client.Set(cmd.Context(), args[0], []byte(args[1]), magicFlags, expiration)
-			if err != nil {
-				return ignoreMemcachedError(err)
-			}
+			return onNode(cmd, client, func(ctx context.Context) error {
+				if err = store(ctx, client, command, args[0], []byte(args[1]), opts); err != nil {
+					return ignoreMemcachedError(err)
+				}
 
-			history.addRecord("set", args)
+				history.addRecord(command, args)
 
-			fmt.Printf("OK\n")
-			return nil
+				getPrinter().printOK()
+				return nil
+			})
 		},
 	}
 
-	cmd.Flags().DurationVarP(&expiration, "ttl", "t", 0, "ttl of key in seconds")
+	bindStorageFlags(cmd.Flags(), opts)
 	return cmd
 }
 
@@ -252,15 +326,17 @@ func newKVDeleteCommand() *cobra.Command {
 				return err
 			}
 
-			err = client.Delete(cmd.Context(), args[0])
-			if err != nil {
-				return ignoreMemcachedError(err)
-			}
+			return onNode(cmd, client, func(ctx context.Context) error {
+				err = client.Delete(ctx, args[0])
+				if err != nil {
+					return ignoreMemcachedError(err)
+				}
 
-			history.addRecord("delete", args)
+				history.addRecord("delete", args)
 
-			fmt.Printf("OK\n")
-			return nil
+				getPrinter().printOK()
+				return nil
+			})
 		},
 	}
 }
@@ -280,35 +356,82 @@ func newKVGetsCommand() *cobra.Command {
 				return err
 			}
 
-			items := make([]*memcached.MetaItem, 0, len(args))
-			for _, key := range args {
-				item, err := client.MetaGet(
-					cmd.Context(),
-					[]byte(key), // key
-					memcached.MetaGetFlagReturnTTL(),
-					memcached.MetaGetFlagReturnSize(),
-					memcached.MetaGetFlagReturnValue(),
-					memcached.MetaGetFlagReturnCAS(),
-					memcached.MetaGetFlagReturnKey(),
-					memcached.MetaGetFlagReturnClientFlags(),
-					memcached.MetaGetFlagReturnLastAccessedTime(),
-					memcached.MetaGetFlagReturnHitBefore(),
-				)
-				if err != nil {
-					fmt.Printf("Encounter an error while getting key '%s': %v\n", key, errors.Cause(err))
-					continue
+			return onNode(cmd, client, func(ctx context.Context) error {
+				items := make([]*memcached.MetaItem, 0, len(args))
+				for _, key := range args {
+					item, err := client.MetaGet(
+						ctx,
+						[]byte(key), // key
+						memcached.MetaGetFlagReturnTTL(),
+						memcached.MetaGetFlagReturnSize(),
+						memcached.MetaGetFlagReturnValue(),
+						memcached.MetaGetFlagReturnCAS(),
+						memcached.MetaGetFlagReturnKey(),
+						memcached.MetaGetFlagReturnClientFlags(),
+						memcached.MetaGetFlagReturnLastAccessedTime(),
+						memcached.MetaGetFlagReturnHitBefore(),
+					)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Encounter an error while getting key '%s': %v\n", key, errors.Cause(err))
+						continue
+					}
+
+					items = append(items, item)
 				}
 
-				items = append(items, item)
+				history.addRecord("gets", args)
+
+				getPrinter().printMetaItems(items)
+
+				return nil
+			})
+		},
+	}
+}
+
+func newKVDebugCommand() *cobra.Command {
+	var binaryKey bool
+
+	cmd := &cobra.Command{
+		Use:          "debug [key]",
+		Short:        "Show debug information of a key",
+		Long:         "Debug command shows the expiration, last access, CAS, slab class and size of a key without fetching its value",
+		Example:      "memcached-cli kv debug foo",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager := getContextManager(cmd, false)
+			history := manager.getHistoryManager()
+			client, err := manager.getClientWithContext(getTemporaryContextName(cmd))
+			if err != nil {
+				return err
 			}
 
-			history.addRecord("gets", args)
+			return onNode(cmd, client, func(ctx context.Context) error {
+				key := []byte(args[0])
+				var options []memcached.MetaDebugOption
+				if binaryKey {
+					if key, err = base64.StdEncoding.DecodeString(args[0]); err != nil {
+						return errors.Wrap(err, "decode base64 key")
+					}
+					options = append(options, memcached.MetaDebugFlagBinaryKey())
+				}
+
+				item, err := client.MetaDebug(ctx, key, options...)
+				if err != nil {
+					return ignoreMemcachedError(err)
+				}
 
-			printMetaItems(items)
+				history.addRecord("debug", args)
 
-			return nil
+				getPrinter().printMetaItemDebug(item)
+				return nil
+			})
 		},
 	}
+
+	cmd.Flags().BoolVarP(&binaryKey, "binary", "b", false, "key is base64 encoded binary value")
+	return cmd
 }
 
 func newKVTouchCommand() *cobra.Command {
@@ -329,14 +452,16 @@ func newKVTouchCommand() *cobra.Command {
 				return err
 			}
 
-			if err := client.Touch(cmd.Context(), args[0], expiration); err != nil {
-				return ignoreMemcachedError(err)
-			}
+			return onNode(cmd, client, func(ctx context.Context) error {
+				if err := client.Touch(ctx, args[0], expiration); err != nil {
+					return ignoreMemcachedError(err)
+				}
 
-			history.addRecord("touch", args)
+				history.addRecord("touch", args)
 
-			fmt.Println("OK")
-			return nil
+				getPrinter().printOK()
+				return nil
+			})
 		},
 	}
 
@@ -361,44 +486,46 @@ func newKVFlushAllCommand() *cobra.Command {
 				return err
 			}
 
-			left := int(delay)
-			var ticker *time.Ticker
-			if delay <= 0 {
-				goto imme
-			}
-
-			ticker = time.NewTicker(time.Second)
-			defer ticker.Stop()
+			return onNode(cmd, client, func(ctx context.Context) error {
+				left := int(delay)
+				var ticker *time.Ticker
+				if delay <= 0 {
+					goto imme
+				}
 
-			fmt.Print("Flush All delayed...\n") //
-			for left >= 0 {
-				select {
-				case <-ticker.C:
-					progress := int(float64(int(delay)-left) / float64(delay) * 20)
-					if progress > 20 {
-						progress = 20
+				ticker = time.NewTicker(time.Second)
+				defer ticker.Stop()
+
+				fmt.Print("Flush All delayed...\n") //
+				for left >= 0 {
+					select {
+					case <-ticker.C:
+						progress := int(float64(int(delay)-left) / float64(delay) * 20)
+						if progress > 20 {
+							progress = 20
+						}
+						fmt.Printf("\r%s%s %d seconds left to execute, ctrl+C to cancel anyway",
+							strings.Repeat("█", progress),
+							strings.Repeat("░", 20-progress),
+							left)
+						left--
+					case <-ctx.Done():
+						fmt.Println("\nOperation cancelled")
+						return ctx.Err()
 					}
-					fmt.Printf("\r%s%s %d seconds left to execute, ctrl+C to cancel anyway",
-						strings.Repeat("█", progress),
-						strings.Repeat("░", 20-progress),
-						left)
-					left--
-				case <-cmd.Context().Done():
-					fmt.Println("\nOperation cancelled")
-					return cmd.Context().Err()
 				}
-			}
-			fmt.Println()
+				fmt.Println()
 
-		imme:
-			if err := client.FlushAll(cmd.Context()); err != nil {
-				return ignoreMemcachedError(err)
-			}
+			imme:
+				if err := client.FlushAll(ctx); err != nil {
+					return ignoreMemcachedError(err)
+				}
 
-			history.addRecord("flushall", args)
+				history.addRecord("flushall", args)
 
-			fmt.Println("OK")
-			return nil
+				getPrinter().printOK()
+				return nil
+			})
 		},
 	}
 
@@ -406,25 +533,92 @@ func newKVFlushAllCommand() *cobra.Command {
 	return cmd
 }
 
-func printMetaItems(items []*memcached.MetaItem) {
-	for idx, item := range items {
-		fmt.Printf(" ================= The [%d] item =================\n", idx)
-		printMetaItem(item)
+func newKVStatsCommand() *cobra.Command {
+	var (
+		aggregate bool
+		watch     time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show statistics of the server",
+		Long: "Stats command prints the general-purpose statistics of the memcached server, " +
+			"or the cluster-wide view of all servers with --aggregate, " +
+			"or the rates of the counters of the server of --node every interval with --watch until interrupted",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager := getContextManager(cmd, false)
+			history := manager.getHistoryManager()
+			client, err := manager.getClientWithContext(getTemporaryContextName(cmd))
+			if err != nil {
+				return err
+			}
+
+			if watch > 0 {
+				return watchStats(cmd, client, watch)
+			}
+
+			return onNode(cmd, client, func(ctx context.Context) error {
+				if aggregate {
+					cs, err := client.AggregateStats(ctx)
+					if err != nil {
+						if cs == nil || len(cs.Nodes) == 0 {
+							return ignoreMemcachedError(err)
+						}
+						logger.Warnf("some servers failed: %v", err)
+					}
+
+					history.addRecord("stats", args)
+
+					getPrinter().printClusterStats(cs)
+					return nil
+				}
+
+				stats, err := client.Stats(ctx)
+				if err != nil {
+					return ignoreMemcachedError(err)
+				}
+
+				history.addRecord("stats", args)
+
+				getPrinter().printStats(stats)
+				return nil
+			})
+		},
 	}
+
+	cmd.Flags().BoolVarP(&aggregate, "aggregate", "a", false, "aggregate the stats of all servers in the cluster")
+	cmd.Flags().DurationVarP(&watch, "watch", "w", 0, "print the rates of the counters every interval, e.g. 1s, requires --node")
+	return cmd
 }
 
-func printMetaItem(item *memcached.MetaItem) {
-	lastAccessAt := time.Now().Add(-time.Duration(item.LastAccessedTime) * time.Second)
-
-	fmt.Printf("Key:              %s\n", item.Key)
-	fmt.Printf("Flags:            %d (0x%x)\n", item.Flags, item.Flags)
-	fmt.Printf("CAS:              %d (0x%x)\n", item.CAS, item.CAS)
-	fmt.Printf("ClientFlags:      %d (0x%x)\n", item.Flags, item.Flags)
-	fmt.Printf("LastAccessedTime: %s (%s)\n", lastAccessAt.Format(time.RFC3339), formatSeconds(int(item.LastAccessedTime), "before", "never"))
-	fmt.Printf("HitBefore:        %s\n", map[bool]string{true: "✅", false: "❌"}[item.HitBefore])
-	fmt.Printf("TTL:              %d (%s)\n", item.TTL, formatSeconds(int(item.TTL), "later", "never expires"))
-	fmt.Printf("Value:            %s\n", item.Value)
-	fmt.Println()
+// watchStats prints the rates of the counters of the server of --node every interval,
+// until the command is interrupted.
+func watchStats(cmd *cobra.Command, client memcached.Client, interval time.Duration) error {
+	node := getNodeAddr(cmd)
+	if node == "" {
+		return errors.New("--watch requires --node to pick the server")
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	rates, err := client.StatsDelta(ctx, &memcached.Addr{Address: node}, interval)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("watching %s every %s, the first rates are printed after two polls", node, interval)
+	for rate := range rates {
+		if rate.Err != nil {
+			logger.Warnf("failed to poll stats: %v", rate.Err)
+			continue
+		}
+		getPrinter().printStatRate(rate)
+	}
+
+	return nil
 }
 
 func formatSeconds(seconds int, suffix, zeroString string) (readable string) {
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,20 +13,20 @@ import (
 
 // Context represents a memcached instance group configuration
 type Context struct {
-	Name      string       `json:"name"`
-	Servers   string       `json:"servers"`
-	Config    clientConfig `json:"config"`
-	CreatedAt time.Time    `json:"created_at"`
-	LastUsed  time.Time    `json:"last_used"`
+	Name      string       `json:"name" yaml:"name"`
+	Servers   string       `json:"servers" yaml:"servers"`
+	Config    clientConfig `json:"config" yaml:"config"`
+	CreatedAt time.Time    `json:"created_at" yaml:"-"`
+	LastUsed  time.Time    `json:"last_used" yaml:"-"`
 }
 
 // clientConfig contains connection-related settings
 type clientConfig struct {
-	PoolSize     int           `json:"pool_size"`
-	DialTimeout  time.Duration `json:"dial_timeout"`
-	ReadTimeout  time.Duration `json:"read_timeout"`
-	WriteTimeout time.Duration `json:"write_timeout"`
-	HashStrategy string        `json:"hash_strategy"` // only crc32, murmur3, rendezvous(default)
+	PoolSize     int           `json:"pool_size" yaml:"pool_size"`
+	DialTimeout  time.Duration `json:"dial_timeout" yaml:"dial_timeout"`
+	ReadTimeout  time.Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout time.Duration `json:"write_timeout" yaml:"write_timeout"`
+	HashStrategy string        `json:"hash_strategy" yaml:"hash_strategy"` // only crc32, murmur3, rendezvous(default)
 }
 
 // DefaultConfig returns a ConnectionConfig with default values
@@ -46,33 +49,91 @@ func defaultConfig(hashStrategy *string) clientConfig {
 	}
 }
 
-func createClient(ctx *Context) (memcached.Client, error) {
-	var builder memcached.Builder = memcached.NewCr32HashPickBuilder()
-	switch ctx.Config.HashStrategy {
-	case "rendezvous":
-		builder = memcached.NewRendezvousHashPickBuilder(magicSeed)
-	case "murmur3":
-		builder = memcached.NewMurmur3HashPickBuilder(magicSeed)
+// toConfig converts the settings into the memcached.Config of the servers, so
+// that the settings are validated and applied by the library.
+func (c clientConfig) toConfig(servers string) *memcached.Config {
+	return &memcached.Config{
+		Addrs:        servers,
+		MaxConns:     c.PoolSize,
+		DialTimeout:  memcached.Duration(c.DialTimeout),
+		ReadTimeout:  memcached.Duration(c.ReadTimeout),
+		WriteTimeout: memcached.Duration(c.WriteTimeout),
+		HashStrategy: c.HashStrategy,
+		HashSeed:     magicSeed,
 	}
+}
 
+// uniqueServers removes the duplicated servers of the comma separated list.
+func uniqueServers(servers string) string {
 	_uniqueServers := make([]string, 0, 4)
-	for _, server := range strings.Split(ctx.Servers, ",") {
+	for _, server := range strings.Split(servers, ",") {
 		if lo.Contains(_uniqueServers, strings.TrimSpace(server)) {
 			continue
 		}
 
 		_uniqueServers = append(_uniqueServers, strings.TrimSpace(server))
 	}
-	uniqServers := strings.Join(_uniqueServers, ",")
-
-	client, err := memcached.New(
-		uniqServers,
-		memcached.WithPickBuilder(builder),
-		memcached.WithMaxConns(ctx.Config.PoolSize),
-		memcached.WithDialTimeout(ctx.Config.DialTimeout),
-		memcached.WithReadTimeout(ctx.Config.ReadTimeout),
-		memcached.WithWriteTimeout(ctx.Config.WriteTimeout),
-	)
+
+	return strings.Join(_uniqueServers, ",")
+}
+
+// envPrefix is the prefix of the environment variables overriding the contexts,
+// see applyEnv.
+const envPrefix = "MEMCACHED_CLI_"
+
+// applyEnv overrides the config of the context by the environment variables, so
+// that the CLI could be configured without the ~/.memcached-cli directory, e.g. in
+// CI and containers. MEMCACHED_CLI_SERVERS overrides the servers and
+// MEMCACHED_CLI_POOL_SIZE the pool size, the other fields of memcached.Config are
+// overridden by MEMCACHED_CLI_ and the upper case of their JSON names, such as
+// MEMCACHED_CLI_DIAL_TIMEOUT and MEMCACHED_CLI_SASL_USERNAME.
+func applyEnv(cfg *memcached.Config) error {
+	if servers, ok := os.LookupEnv(envPrefix + "SERVERS"); ok {
+		cfg.Addrs = uniqueServers(servers)
+	}
+	if poolSize, ok := os.LookupEnv(envPrefix + "POOL_SIZE"); ok {
+		size, err := strconv.Atoi(poolSize)
+		if err != nil {
+			return fmt.Errorf("environment variable %sPOOL_SIZE=%q: %v", envPrefix, poolSize, err)
+		}
+		cfg.MaxConns = size
+	}
+
+	return cfg.ApplyEnv(envPrefix)
+}
+
+// envContext returns the context configured by the environment variables only,
+// which is used if there's no context selected, nil if MEMCACHED_CLI_SERVERS is
+// not set. It's never saved.
+func envContext() *Context {
+	servers := os.Getenv(envPrefix + "SERVERS")
+	if strings.TrimSpace(servers) == "" {
+		return nil
+	}
+
+	return &Context{
+		Name:      "env",
+		Servers:   servers,
+		Config:    defaultConfig(nil),
+		CreatedAt: time.Now(),
+		LastUsed:  time.Now(),
+	}
+}
+
+func createClient(ctx *Context) (memcached.Client, error) {
+	uniqServers := uniqueServers(ctx.Servers)
+
+	var opts []memcached.ClientOption
+	if wireLogging {
+		opts = append(opts, memcached.WithWireLogging(memcached.NewWireLogger(os.Stderr)))
+	}
+
+	cfg := ctx.Config.toConfig(uniqServers)
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	client, err := memcached.NewFromConfig(cfg, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -88,7 +90,8 @@ func (m *contextManager) initialize() error {
 	m.current = stored.Current
 	m.historyMaxLines = stored.HistoryMaxLines
 	m.historyEnabled = stored.HistoryEnabled
-	if m.current != "" {
+	// the context selected by MEMCACHED_CLI_CONTEXT is connected on demand.
+	if m.current != "" && os.Getenv(envPrefix+"CONTEXT") == "" {
 		m.currentClient, err = createClient(m.contexts[m.current])
 		if err != nil {
 			return err
@@ -252,16 +255,28 @@ func (m *contextManager) getCurrentContext() (*Context, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	if name := os.Getenv(envPrefix + "CONTEXT"); name != "" {
+		ctx, exists := m.contexts[name]
+		if !exists {
+			return nil, fmt.Errorf("context %s of %sCONTEXT not found", name, envPrefix)
+		}
+		return ctx, nil
+	}
+
 	if m.current == "" {
+		if ctx := envContext(); ctx != nil {
+			return ctx, nil
+		}
 		return nil, fmt.Errorf("no context selected")
 	}
 
 	return m.contexts[m.current], nil
 }
 
-func (m *contextManager) getClientWithContext(ctxName string) (memcached.Client, error) {
+// getContext returns the context of the given name, or the current one if the name is empty.
+func (m *contextManager) getContext(ctxName string) (*Context, error) {
 	if ctxName == "" {
-		return m.getCurrentClient()
+		return m.getCurrentContext()
 	}
 
 	m.mu.RLock()
@@ -271,6 +286,19 @@ func (m *contextManager) getClientWithContext(ctxName string) (memcached.Client,
 	if !exists {
 		return nil, fmt.Errorf("context %s not found", ctxName)
 	}
+
+	return ctx, nil
+}
+
+func (m *contextManager) getClientWithContext(ctxName string) (memcached.Client, error) {
+	if ctxName == "" {
+		return m.getCurrentClient()
+	}
+
+	ctx, err := m.getContext(ctxName)
+	if err != nil {
+		return nil, err
+	}
 	client, err := createClient(ctx)
 	if err != nil {
 		return nil, err
@@ -305,6 +333,68 @@ func (m *contextManager) getCurrentClient() (memcached.Client, error) {
 	return client, nil
 }
 
+// exportContexts returns the contexts of the given names ordered by their names,
+// or all the contexts if names is empty.
+func (m *contextManager) exportContexts(names []string) ([]*Context, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(names) == 0 {
+		names = make([]string, 0, len(m.contexts))
+		for name := range m.contexts {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	contexts := make([]*Context, 0, len(names))
+	for _, name := range names {
+		ctx, exists := m.contexts[name]
+		if !exists {
+			return nil, fmt.Errorf("context %s not found", name)
+		}
+		contexts = append(contexts, ctx)
+	}
+
+	return contexts, nil
+}
+
+// importContexts adds the contexts, the existing ones of the same names are
+// replaced only if overwrite is true. Nothing is imported if any context is
+// invalid or exists. The first one becomes the current context if there's none.
+func (m *contextManager) importContexts(contexts []*Context, overwrite bool) error {
+	m.mu.Lock()
+	if m.contexts == nil {
+		m.contexts = make(map[string]*Context, len(contexts))
+	}
+
+	for _, ctx := range contexts {
+		if ctx.Name == "" || strings.TrimSpace(ctx.Servers) == "" {
+			m.mu.Unlock()
+			return fmt.Errorf("context %q requires name and servers", ctx.Name)
+		}
+		if _, exists := m.contexts[ctx.Name]; exists && !overwrite {
+			m.mu.Unlock()
+			return fmt.Errorf("context %s already exists", ctx.Name)
+		}
+	}
+
+	for _, ctx := range contexts {
+		ctx.CreatedAt = time.Now()
+		ctx.LastUsed = ctx.CreatedAt
+		m.contexts[ctx.Name] = ctx
+		if ctx.Name == m.current {
+			m.currentClient = nil
+		}
+	}
+	if m.current == "" && len(contexts) > 0 {
+		m.current = contexts[0].Name
+	}
+	m.mu.Unlock()
+
+	return m.save()
+}
+
 func (m *contextManager) getHistoryManager() *kvCommandHistoryManager {
 	if !m.historyEnabled {
 		return nil
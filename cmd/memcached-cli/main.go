@@ -12,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/yeqown/log"
+	"github.com/yeqown/memcached"
 )
 
 const (
@@ -20,6 +21,8 @@ const (
 
 var (
 	logger = newLogger()
+	// wireLogging means the commands on the wire are written to stderr.
+	wireLogging bool
 )
 
 func main() {
@@ -59,12 +62,18 @@ func main() {
 		&timeout, "timeout", "", 10*time.Second, "timeout for interactive mode, default 10s")
 	rootCmd.PersistentFlags().BoolVarP(
 		&verbose, "verbose", "v", false, "enable verbose mode")
+	rootCmd.PersistentFlags().VarP(
+		&output, "output", "o", "output format: table(default), json, plain")
+	rootCmd.PersistentFlags().BoolVarP(
+		&wireLogging, "wire", "", false, "print the request and response lines on the wire to stderr")
 
 	rootCmd.AddCommand(
-		newVersionCommand(), // add version command
-		newContextCommand(), // add context manage sub commands
-		newKVCommand(),      // add kv sub commands
-		newHistoryCommand(), // add history sub commands
+		newVersionCommand(),   // add version command
+		newContextCommand(),   // add context manage sub commands
+		newKVCommand(),        // add kv sub commands
+		newHistoryCommand(),   // add history sub commands
+		newBenchCommand(),     // add bench command
+		newRebalanceCommand(), // add rebalance command
 	)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -174,6 +183,8 @@ func newContextCommand() *cobra.Command {
 		newContextUseCommand(),
 		newContextDeleteCommand(),
 		newContextCurrentCommand(),
+		newContextExportCommand(),
+		newContextImportCommand(),
 	)
 
 	return cmd
@@ -181,7 +192,10 @@ func newContextCommand() *cobra.Command {
 
 func newKVCommand() *cobra.Command {
 
-	var contextName string
+	var (
+		contextName string
+		node        string
+	)
 
 	cmd := &cobra.Command{
 		Use:          "kv",
@@ -197,6 +211,7 @@ func newKVCommand() *cobra.Command {
 			}
 			storeContextManager(cmd, manager)
 			storeTemporaryContextName(cmd, contextName)
+			storeNodeAddr(cmd, node)
 		},
 		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
 			manager := getContextManager(cmd, false)
@@ -220,14 +235,21 @@ func newKVCommand() *cobra.Command {
 	cmd.PersistentFlags().StringVarP(
 		&contextName,
 		"context", "c", "", "context name to use, if not set, use current context")
+	cmd.PersistentFlags().StringVar(
+		&node,
+		"node", "", "send the command to the server host:port of the context, bypassing the hash distribution")
 
 	cmd.AddCommand(
 		newKVGetCommand(),
 		newKVSetCommand(),
+		newKVAddCommand(),
+		newKVReplaceCommand(),
 		newKVDeleteCommand(),
 		newKVGetsCommand(),
 		newKVTouchCommand(),
+		newKVDebugCommand(),
 		newKVFlushAllCommand(),
+		newKVStatsCommand(),
 	)
 
 	return cmd
@@ -344,6 +366,35 @@ func getTemporaryContextName(cmd *cobra.Command) string {
 	return ""
 }
 
+type nodeAddrKeyType struct{}
+
+var nodeAddrKey = nodeAddrKeyType{}
+
+func storeNodeAddr(cmd *cobra.Command, node string) {
+	if len(node) == 0 || cmd == nil {
+		return
+	}
+
+	newCtx := context.WithValue(cmd.Context(), nodeAddrKey, node)
+	cmd.SetContext(newCtx)
+}
+
+func getNodeAddr(cmd *cobra.Command) string {
+	node, _ := cmd.Context().Value(nodeAddrKey).(string)
+	return node
+}
+
+// onNode runs fn with the context of the command, which targets the server of
+// --node if it's set, see memcached.Client.DoOnNode.
+func onNode(cmd *cobra.Command, client memcached.Client, fn func(ctx context.Context) error) error {
+	node := getNodeAddr(cmd)
+	if node == "" {
+		return fn(cmd.Context())
+	}
+
+	return client.DoOnNode(cmd.Context(), &memcached.Addr{Address: node}, fn)
+}
+
 func newLogger() *log.Logger {
 	l, err := log.NewLogger(
 		log.WithLevel(log.LevelInfo),
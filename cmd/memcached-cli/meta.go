@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/yeqown/memcached"
+)
+
+// metaFlag is a flag of the meta commands given in the REPL as the meta protocol
+// does, one character followed by its token if any, e.g. `v` and `N30`.
+type metaFlag[T any] struct {
+	// arg is the name of the token the flag takes, empty if it takes none.
+	arg   string
+	usage string
+	// build builds the option of the flag by its token, nil means the flag is taken
+	// by the command itself, e.g. the delta of arith.
+	build func(token string) (T, error)
+}
+
+// metaFlags are the flags supported by one meta command, keyed by the flag.
+type metaFlags[T any] map[byte]metaFlag[T]
+
+// metaFlagSet is the view of metaFlags regardless of the option type, which is
+// used to validate the toggled flags and print the help.
+type metaFlagSet interface {
+	// validate checks the flag token, e.g. `N30`.
+	validate(token string) error
+	// usages returns the usage lines of the flags ordered by the flags.
+	usages() []string
+}
+
+func (flags metaFlags[T]) validate(token string) error {
+	if token == "" {
+		return fmt.Errorf("empty flag")
+	}
+
+	flag, ok := flags[token[0]]
+	if !ok {
+		return fmt.Errorf("unknown flag %q", token[0])
+	}
+	if flag.arg == "" && len(token) > 1 {
+		return fmt.Errorf("flag %q takes no token", token[0])
+	}
+	if flag.arg != "" && len(token) == 1 {
+		return fmt.Errorf("flag %q requires <%s>", token[0], flag.arg)
+	}
+
+	return nil
+}
+
+func (flags metaFlags[T]) usages() []string {
+	keys := make([]byte, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		flag := string(key)
+		if arg := flags[key].arg; arg != "" {
+			flag += "<" + arg + ">"
+		}
+		lines = append(lines, fmt.Sprintf("%-14s %s", flag, flags[key].usage))
+	}
+
+	return lines
+}
+
+// options builds the options of the flag tokens, the later token of the same flag
+// overrides the former one, so that the flags given in the command line override
+// the toggled ones.
+func (flags metaFlags[T]) options(tokens []string) ([]T, error) {
+	merged := make(map[byte]string, len(tokens))
+	for _, token := range tokens {
+		if err := flags.validate(token); err != nil {
+			return nil, err
+		}
+		merged[token[0]] = token[1:]
+	}
+
+	options := make([]T, 0, len(merged))
+	for key, token := range merged {
+		build := flags[key].build
+		if build == nil {
+			continue
+		}
+
+		option, err := build(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flag %q: %v", key, err)
+		}
+		options = append(options, option)
+	}
+
+	return options, nil
+}
+
+// flagOf builds the option of the flag which takes no token.
+func flagOf[T any](fn func() T) func(string) (T, error) {
+	return func(string) (T, error) { return fn(), nil }
+}
+
+// uintFlagOf builds the option of the flag which takes a number token, e.g. a TTL
+// or a CAS unique.
+func uintFlagOf[T any](fn func(uint64) T) func(string) (T, error) {
+	return func(token string) (T, error) {
+		v, err := strconv.ParseUint(token, 10, 64)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		return fn(v), nil
+	}
+}
+
+var metaGetFlags = metaFlags[memcached.MetaGetOption]{
+	'b': {usage: "interpret key as base64 encoded binary value", build: flagOf(memcached.MetaGetFlagBinaryKey)},
+	'c': {usage: "return item cas token", build: flagOf(memcached.MetaGetFlagReturnCAS)},
+	'f': {usage: "return client flags", build: flagOf(memcached.MetaGetFlagReturnClientFlags)},
+	'h': {usage: "return whether item has been hit before", build: flagOf(memcached.MetaGetFlagReturnHitBefore)},
+	'k': {usage: "return key", build: flagOf(memcached.MetaGetFlagReturnKey)},
+	'l': {usage: "return time since item was last accessed in seconds", build: flagOf(memcached.MetaGetFlagReturnLastAccessedTime)},
+	'O': {arg: "token", usage: "opaque value, copied back with the response", build: uintFlagOf(memcached.MetaGetFlagOpaque)},
+	'q': {usage: "use noreply semantics for return codes", build: flagOf(memcached.MetaGetFlagNoReply)},
+	's': {usage: "return item size", build: flagOf(memcached.MetaGetFlagReturnSize)},
+	't': {usage: "return item TTL remaining in seconds", build: flagOf(memcached.MetaGetFlagReturnTTL)},
+	'u': {usage: "don't bump the item in the LRU", build: flagOf(memcached.MetaGetFlagDontBumpLRU)},
+	'v': {usage: "return item value", build: flagOf(memcached.MetaGetFlagReturnValue)},
+	'E': {arg: "cas", usage: "use token as new CAS value if item is modified", build: uintFlagOf(memcached.MetaGetFlagNewCAS)},
+	'N': {arg: "ttl", usage: "vivify on miss, takes TTL as an argument", build: uintFlagOf(memcached.MetaGetFlagVivifyOnMiss)},
+	'R': {arg: "ttl", usage: "win for recache if item's TTL is less than token", build: uintFlagOf(memcached.MetaGetFlagWinForRecache)},
+	'T': {arg: "ttl", usage: "update remaining TTL", build: uintFlagOf(memcached.MetaGetFlagUpdateRemainingTTL)},
+}
+
+var metaSetFlags = metaFlags[memcached.MetaSetOption]{
+	'b': {usage: "interpret key as base64 encoded binary value", build: flagOf(memcached.MetaSetFlagBinaryKey)},
+	'c': {usage: "return CAS value if successfully stored", build: flagOf(memcached.MetaSetFlagReturnCAS)},
+	'k': {usage: "return key", build: flagOf(memcached.MetaSetFlagReturnKey)},
+	'q': {usage: "use noreply semantics for return codes", build: flagOf(memcached.MetaSetFlagNoReply)},
+	's': {usage: "return the size of the stored item", build: flagOf(memcached.MetaSetFlagReturnSize)},
+	'C': {arg: "cas", usage: "compare CAS value when storing item", build: uintFlagOf(memcached.MetaSetFlagCompareCAS)},
+	'E': {arg: "cas", usage: "use token as new CAS value", build: uintFlagOf(memcached.MetaSetFlagNewCAS)},
+	'F': {arg: "flags", usage: "set client flags", build: func(token string) (memcached.MetaSetOption, error) {
+		v, err := strconv.ParseUint(token, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return memcached.MetaSetFlagClientFlags(uint32(v)), nil
+	}},
+	'I': {usage: "invalidate, set-to-invalid if supplied CAS is older than item's CAS", build: flagOf(memcached.MetaSetFlagInvalidate)},
+	'M': {arg: "mode", usage: "mode switch: E(add), A(append), P(prepend), R(replace), S(set)", build: func(token string) (memcached.MetaSetOption, error) {
+		modes := map[string]memcached.MetaSetOption{
+			"E": memcached.MetaSetFlagModeSwitch(memcached.MetaSetModeAdd),
+			"A": memcached.MetaSetFlagModeSwitch(memcached.MetaSetModeAppend),
+			"P": memcached.MetaSetFlagModeSwitch(memcached.MetaSetModePrepend),
+			"R": memcached.MetaSetFlagModeSwitch(memcached.MetaSetModeReplace),
+			"S": memcached.MetaSetFlagModeSwitch(memcached.MetaSetModeSet),
+		}
+		option, ok := modes[strings.ToUpper(token[:1])]
+		if !ok {
+			return nil, fmt.Errorf("unknown mode %q", token)
+		}
+		return option, nil
+	}},
+	'N': {arg: "ttl", usage: "auto vivify on miss, takes TTL as an argument", build: uintFlagOf(memcached.MetaSetFlagAutoVivify)},
+	'O': {arg: "token", usage: "opaque value, copied back with the response", build: uintFlagOf(memcached.MetaSetFlagOpaque)},
+	'T': {arg: "ttl", usage: "update TTL", build: uintFlagOf(memcached.MetaSetFlagTTL)},
+}
+
+var metaDeleteFlags = metaFlags[memcached.MetaDeleteOption]{
+	'b': {usage: "interpret key as base64 encoded binary value", build: flagOf(memcached.MetaDeleteFlagBinaryKey)},
+	'k': {usage: "return key", build: flagOf(memcached.MetaDeleteFlagReturnKey)},
+	'q': {usage: "use noreply semantics for return codes", build: flagOf(memcached.MetaDeleteFlagNoReply)},
+	'x': {usage: "remove the item value, but leave the item in place", build: flagOf(memcached.MetaDeleteFlagRemoveValueOnly)},
+	'C': {arg: "cas", usage: "compare CAS value", build: uintFlagOf(memcached.MetaDeleteFlagCompareCAS)},
+	'E': {arg: "cas", usage: "use token as new CAS value", build: uintFlagOf(memcached.MetaDeleteFlagNewCAS)},
+	'I': {usage: "invalidate, mark as stale, bumps CAS", build: flagOf(memcached.MetaDeleteFlagInvalidate)},
+	'O': {arg: "token", usage: "opaque value, copied back with the response", build: uintFlagOf(memcached.MetaDeleteFlagOpaque)},
+	'T': {arg: "ttl", usage: "update TTL, only when paired with the I flag", build: uintFlagOf(memcached.MetaDeleteFlagUpdateTTL)},
+}
+
+var metaArithmeticFlags = metaFlags[memcached.MetaArithmeticOption]{
+	'b': {usage: "interpret key as base64 encoded binary value", build: flagOf(memcached.MetaArithmeticFlagBinaryKey)},
+	'c': {usage: "return current CAS value if successful", build: flagOf(memcached.MetaArithmeticFlagReturnCAS)},
+	'k': {usage: "return key", build: flagOf(memcached.MetaArithmeticFlagReturnKey)},
+	'q': {usage: "use noreply semantics for return codes", build: flagOf(memcached.MetaArithmeticFlagNoReply)},
+	't': {usage: "return current TTL", build: flagOf(memcached.MetaArithmeticFlagReturnTTL)},
+	'v': {usage: "return new value", build: flagOf(memcached.MetaArithmeticFlagReturnValue)},
+	'C': {arg: "cas", usage: "compare CAS value", build: uintFlagOf(memcached.MetaArithmeticFlagCompareCAS)},
+	'D': {arg: "delta", usage: "delta to apply, 1 by default"},
+	'E': {arg: "cas", usage: "use token as new CAS value", build: uintFlagOf(memcached.MetaArithmeticFlagNewCAS)},
+	'J': {arg: "value", usage: "initial value to use if auto created after miss", build: uintFlagOf(memcached.MetaArithmeticFlagInitialValue)},
+	'M': {arg: "mode", usage: "mode switch: I(incr, +), D(decr, -)", build: func(token string) (memcached.MetaArithmeticOption, error) {
+		switch strings.ToUpper(token[:1]) {
+		case "I", "+":
+			return memcached.MetaArithmeticFlagModeSwitch(memcached.MetaArithmeticModeIncr), nil
+		case "D", "-":
+			return memcached.MetaArithmeticFlagModeSwitch(memcached.MetaArithmeticModeDecr), nil
+		}
+		return nil, fmt.Errorf("unknown mode %q", token)
+	}},
+	'N': {arg: "ttl", usage: "auto create item on miss with supplied TTL", build: uintFlagOf(memcached.MetaArithmeticFlagAutoCreate)},
+	'O': {arg: "token", usage: "opaque value, copied back with the response", build: uintFlagOf(memcached.MetaArithmeticFlagOpaque)},
+	'T': {arg: "ttl", usage: "update TTL on success", build: uintFlagOf(memcached.MetaArithmeticFlagUpdateTTL)},
+}
+
+// metaCommands are the meta commands of the REPL and their usages.
+var metaCommands = []struct {
+	name  string
+	usage string
+	flags metaFlagSet
+}{
+	{name: "get", usage: "meta get <key> [flags...]", flags: metaGetFlags},
+	{name: "set", usage: "meta set <key> <value> [flags...]", flags: metaSetFlags},
+	{name: "delete", usage: "meta delete <key> [flags...]", flags: metaDeleteFlags},
+	{name: "arith", usage: "meta arith <key> [flags...]", flags: metaArithmeticFlags},
+}
+
+// metaSuggestions are the completions of the meta subcommands.
+var metaSuggestions = []prompt.Suggest{
+	{Text: "get", Description: "Get the item with meta flags"},
+	{Text: "set", Description: "Set the item with meta flags"},
+	{Text: "delete", Description: "Delete the item with meta flags"},
+	{Text: "arith", Description: "Increment or decrement the item with meta flags"},
+	{Text: "toggle", Description: "Toggle the flag given to each following meta command"},
+	{Text: "flags", Description: "Show the toggled flags"},
+	{Text: "help", Description: "Show the flags of the meta commands"},
+}
+
+func lookupMetaFlags(name string) (metaFlagSet, bool) {
+	for _, command := range metaCommands {
+		if command.name == name {
+			return command.flags, true
+		}
+	}
+
+	return nil, false
+}
+
+// metaFlagTokens returns the toggled flags of the meta command followed by the
+// given ones, so that the given ones override the toggled ones.
+func (r *replCommander) metaFlagTokens(name string, tokens []string) []string {
+	return append(append([]string(nil), r.metaToggles[name]...), tokens...)
+}
+
+// handleMeta handles the meta command family, which builds the meta options by
+// the flags given as the meta protocol does, so that the meta flags could be
+// experimented with interactively, e.g. `meta get foo v t N30`.
+func (r *replCommander) handleMeta(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: meta <get|set|delete|arith|toggle|flags|help> ...")
+	}
+
+	switch args[1] {
+	case "get":
+		return r.handleMetaGet(ctx, args[2:])
+	case "set":
+		return r.handleMetaSet(ctx, args[2:])
+	case "delete":
+		return r.handleMetaDelete(ctx, args[2:])
+	case "arith":
+		return r.handleMetaArithmetic(ctx, args[2:])
+	case "toggle":
+		return r.handleMetaToggle(args[2:])
+	case "flags":
+		r.handleMetaFlags()
+		return nil
+	case "help":
+		return r.handleMetaHelp(args[2:])
+	}
+
+	return fmt.Errorf("unknown meta command: %s", args[1])
+}
+
+func (r *replCommander) handleMetaGet(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: meta get <key> [flags...]")
+	}
+
+	options, err := metaGetFlags.options(r.metaFlagTokens("get", args[1:]))
+	if err != nil {
+		return err
+	}
+	item, err := r.getMemcachedClient().MetaGet(ctx, []byte(args[0]), options...)
+	if err != nil {
+		return ignoreMemcachedError(err)
+	}
+	printMetaResult(item)
+	return nil
+}
+
+func (r *replCommander) handleMetaSet(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: meta set <key> <value> [flags...]")
+	}
+
+	options, err := metaSetFlags.options(r.metaFlagTokens("set", args[2:]))
+	if err != nil {
+		return err
+	}
+	item, err := r.getMemcachedClient().MetaSet(ctx, []byte(args[0]), []byte(args[1]), options...)
+	if err != nil {
+		return ignoreMemcachedError(err)
+	}
+	printMetaResult(item)
+	return nil
+}
+
+func (r *replCommander) handleMetaDelete(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: meta delete <key> [flags...]")
+	}
+
+	options, err := metaDeleteFlags.options(r.metaFlagTokens("delete", args[1:]))
+	if err != nil {
+		return err
+	}
+	item, err := r.getMemcachedClient().MetaDelete(ctx, []byte(args[0]), options...)
+	if err != nil {
+		return ignoreMemcachedError(err)
+	}
+	printMetaResult(item)
+	return nil
+}
+
+func (r *replCommander) handleMetaArithmetic(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: meta arith <key> [flags...]")
+	}
+
+	tokens := r.metaFlagTokens("arith", args[1:])
+	options, err := metaArithmeticFlags.options(tokens)
+	if err != nil {
+		return err
+	}
+	delta := uint64(1)
+	for _, token := range tokens {
+		if token[0] != 'D' {
+			continue
+		}
+		if delta, err = strconv.ParseUint(token[1:], 10, 64); err != nil {
+			return fmt.Errorf("invalid flag 'D': %v", err)
+		}
+	}
+
+	item, err := r.getMemcachedClient().MetaArithmetic(ctx, []byte(args[0]), delta, options...)
+	if err != nil {
+		return ignoreMemcachedError(err)
+	}
+	printMetaResult(item)
+	return nil
+}
+
+// handleMetaToggle toggles the flag of the meta command, the toggled flags are
+// given to each following meta command until toggled off. Toggling the flag with
+// a different token replaces it.
+func (r *replCommander) handleMetaToggle(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: meta toggle <get|set|delete|arith> <flag>")
+	}
+
+	flags, ok := lookupMetaFlags(args[0])
+	if !ok {
+		return fmt.Errorf("unknown meta command: %s", args[0])
+	}
+	token := args[1]
+	if err := flags.validate(token); err != nil {
+		return err
+	}
+
+	toggled := r.metaToggles[args[0]]
+	for idx, t := range toggled {
+		if t[0] != token[0] {
+			continue
+		}
+
+		toggled = append(toggled[:idx], toggled[idx+1:]...)
+		if t != token {
+			toggled = append(toggled, token)
+		}
+		r.metaToggles[args[0]] = toggled
+		r.handleMetaFlags()
+		return nil
+	}
+
+	r.metaToggles[args[0]] = append(toggled, token)
+	r.handleMetaFlags()
+	return nil
+}
+
+// handleMetaFlags prints the toggled flags of each meta command.
+func (r *replCommander) handleMetaFlags() {
+	for _, command := range metaCommands {
+		fmt.Printf("  %-8s %s\n", command.name, strings.Join(r.metaToggles[command.name], " "))
+	}
+}
+
+func (r *replCommander) handleMetaHelp(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: meta help [get|set|delete|arith]")
+	}
+
+	for _, command := range metaCommands {
+		if len(args) == 1 && args[0] != command.name {
+			continue
+		}
+
+		fmt.Printf("%s\n", command.usage)
+		for _, line := range command.flags.usages() {
+			fmt.Printf("  %s\n", line)
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("meta toggle <command> <flag>  Toggle the flag given to each following meta command")
+	fmt.Println("meta flags                    Show the toggled flags")
+	return nil
+}
+
+// printMetaResult prints the item replied by the meta command, which is nil if
+// the server replies nothing, e.g. the noreply ones.
+func printMetaResult(item *memcached.MetaItem) {
+	if item == nil {
+		getPrinter().printOK()
+		return
+	}
+
+	getPrinter().printMetaItem(item)
+}
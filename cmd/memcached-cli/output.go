@@ -0,0 +1,496 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yeqown/memcached"
+)
+
+const (
+	outputTable = "table" // human-readable format, default
+	outputJSON  = "json"  // machine-readable format for scripting
+	outputPlain = "plain" // bare values, one per line, for shell pipelines
+)
+
+// outputFormat is a pflag.Value which only accepts supported output formats,
+// so that an invalid --output flag is rejected while parsing arguments.
+type outputFormat string
+
+var output = outputFormat(outputTable)
+
+func (o *outputFormat) String() string { return string(*o) }
+
+func (o *outputFormat) Set(v string) error {
+	switch v {
+	case outputTable, outputJSON, outputPlain:
+		*o = outputFormat(v)
+		return nil
+	}
+
+	return errors.Errorf("unsupported output format %q, must be one of: %s, %s, %s",
+		v, outputTable, outputJSON, outputPlain)
+}
+
+func (o *outputFormat) Type() string { return "string" }
+
+// printer prints the results of commands in a specific format.
+type printer interface {
+	printMetaItem(item *memcached.MetaItem)
+	printMetaItems(items []*memcached.MetaItem)
+	printMetaItemDebug(item *memcached.MetaItemDebug)
+	printStats(stats *memcached.Statistic)
+	printClusterStats(cs *memcached.ClusterStats)
+	printStatRate(rate *memcached.StatRate)
+	printContexts(names []string, current string)
+	printContext(ctx *Context)
+	printOK()
+}
+
+// getPrinter returns the printer of the output format set by the global --output flag.
+func getPrinter() printer {
+	switch output {
+	case outputJSON:
+		return jsonPrinter{}
+	case outputPlain:
+		return plainPrinter{}
+	}
+
+	return tablePrinter{}
+}
+
+/**
+ * table printer
+ */
+
+type tablePrinter struct{}
+
+func (tablePrinter) printMetaItem(item *memcached.MetaItem) {
+	lastAccessAt := time.Now().Add(-time.Duration(item.LastAccessedTime) * time.Second)
+
+	fmt.Printf("Key:              %s\n", item.Key)
+	fmt.Printf("Flags:            %d (0x%x)\n", item.Flags, item.Flags)
+	fmt.Printf("CAS:              %d (0x%x)\n", item.CAS, item.CAS)
+	fmt.Printf("ClientFlags:      %d (0x%x)\n", item.Flags, item.Flags)
+	fmt.Printf("LastAccessedTime: %s (%s)\n", lastAccessAt.Format(time.RFC3339), formatSeconds(int(item.LastAccessedTime), "before", "never"))
+	fmt.Printf("HitBefore:        %s\n", map[bool]string{true: "✅", false: "❌"}[item.HitBefore])
+	fmt.Printf("TTL:              %d (%s)\n", item.TTL, formatSeconds(int(item.TTL), "later", "never expires"))
+	fmt.Printf("Value:            %s\n", item.Value)
+	fmt.Println()
+}
+
+func (p tablePrinter) printMetaItems(items []*memcached.MetaItem) {
+	for idx, item := range items {
+		fmt.Printf(" ================= The [%d] item =================\n", idx)
+		p.printMetaItem(item)
+	}
+}
+
+func (tablePrinter) printMetaItemDebug(item *memcached.MetaItemDebug) {
+	lastAccessAt := time.Now().Add(-time.Duration(item.LastAssessTime) * time.Second)
+
+	fmt.Printf("Key:              %s\n", item.Key)
+	fmt.Printf("CAS:              %d (0x%x)\n", item.CAS, item.CAS)
+	fmt.Printf("LastAccessedTime: %s (%s)\n", lastAccessAt.Format(time.RFC3339), formatSeconds(int(item.LastAssessTime), "before", "never"))
+	fmt.Printf("HitBefore:        %s\n", map[bool]string{true: "✅", false: "❌"}[item.HitBefore])
+	fmt.Printf("TTL:              %d (%s)\n", item.TTL, formatSeconds(int(item.TTL), "later", "never expires"))
+	fmt.Printf("SlabClassID:      %d\n", item.SlabClassID)
+	fmt.Printf("Size:             %d bytes\n", item.Size)
+	fmt.Println()
+}
+
+func (tablePrinter) printStats(stats *memcached.Statistic) {
+	fields := statsFields(stats)
+
+	fmt.Println("┌────────────────────────────────┬──────────────────────────────┐")
+	fmt.Printf("│ %-31s│ %-28s │\n", "Stat", "Value")
+	fmt.Println("├────────────────────────────────┼──────────────────────────────┤")
+	for _, f := range fields {
+		fmt.Printf("│ %-31s│ %-28v │\n", f.name, f.value)
+	}
+	fmt.Println("└────────────────────────────────┴──────────────────────────────┘")
+}
+
+func (tablePrinter) printClusterStats(cs *memcached.ClusterStats) {
+	fmt.Println("┌────────────────────────────────┬──────────────────────────────┐")
+	fmt.Printf("│ %-31s│ %-28s │\n", "Cluster", "Value")
+	fmt.Println("├────────────────────────────────┼──────────────────────────────┤")
+	for _, f := range clusterStatsFields(cs) {
+		fmt.Printf("│ %-31s│ %-28v │\n", f.name, f.value)
+	}
+	fmt.Println("└────────────────────────────────┴──────────────────────────────┘")
+
+	fmt.Println()
+	fmt.Printf("%-24s %12s %14s %10s %12s %8s\n", "Node", "Items", "Bytes", "HitRate", "Evictions", "Conns")
+	for _, node := range clusterNodeViews(cs) {
+		fmt.Printf("%-24s %12d %14d %9.2f%% %12d %8d\n",
+			node.Addr, node.CurrItems, node.Bytes, node.HitRate*100, node.Evictions, node.CurrConnections)
+	}
+
+	if len(cs.Outliers) > 0 {
+		fmt.Println()
+		fmt.Println("Outliers:")
+		for _, o := range cs.Outliers {
+			fmt.Printf("  ⚠️  %s: %s=%d (median of others %.1f)\n", o.Addr.Address, o.Metric, o.Value, o.Median)
+		}
+	}
+}
+
+func (tablePrinter) printStatRate(rate *memcached.StatRate) {
+	fmt.Printf("%s %-21s gets/s %9.1f  sets/s %9.1f  hit %6.2f%%  evictions/s %7.1f  read %10.0f B/s  written %10.0f B/s\n",
+		rate.Time.Format("15:04:05"), rate.Addr.Address, rate.GetsPerSec, rate.SetsPerSec, rate.HitRate*100,
+		rate.EvictionsPerSec, rate.BytesReadPerSec, rate.BytesWrittenPerSec)
+}
+
+func (tablePrinter) printContexts(names []string, current string) {
+	if len(names) == 0 {
+		fmt.Println("No contexts found.")
+		return
+	}
+
+	fmt.Printf("Found %d Contexts:\n", len(names))
+	fmt.Println()
+	for _, name := range names {
+		if current == name {
+			fmt.Printf("* %s\n", name)
+		} else {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+}
+
+func (tablePrinter) printContext(ctx *Context) {
+	servers := strings.Split(ctx.Servers, ",")
+
+	fmt.Printf("📌 Current Context: %s\n", ctx.Name)
+	fmt.Println("\nConfigurations:")
+	fmt.Println("┌─────────────────────┬──────────────────────────────────────────────────────┐")
+	fmt.Printf("│ %-20s│ %-52s │\n", "Param", "Value")
+	fmt.Println("├─────────────────────┼──────────────────────────────────────────────────────┤")
+	fmt.Printf("│ %-20s│ %-52s │\n", "Servers", fmt.Sprintf("%d instances:", len(servers)))
+	for _, server := range servers {
+		fmt.Printf("│                     │ %-52s │\n", server)
+	}
+	fmt.Printf("│ %-20s│ %-52d │\n", "ConnectionPoolSize", ctx.Config.PoolSize)
+	fmt.Printf("│ %-20s│ %-52s │\n", "DialTimeout", ctx.Config.DialTimeout)
+	fmt.Printf("│ %-20s│ %-52s │\n", "ReadTimeout", ctx.Config.ReadTimeout)
+	fmt.Printf("│ %-20s│ %-52s │\n", "WriteTimeout", ctx.Config.WriteTimeout)
+	fmt.Printf("│ %-20s│ %-52s │\n", "HashStrategy", ctx.Config.HashStrategy)
+	fmt.Println("└─────────────────────┴──────────────────────────────────────────────────────┘")
+}
+
+func (tablePrinter) printOK() { fmt.Println("OK") }
+
+/**
+ * json printer
+ */
+
+type jsonPrinter struct{}
+
+// metaItemView is the JSON representation of memcached.MetaItem, key and value
+// are printed as strings rather than base64 encoded bytes.
+type metaItemView struct {
+	Key              string `json:"key"`
+	Value            string `json:"value"`
+	Flags            uint32 `json:"flags"`
+	CAS              uint64 `json:"cas"`
+	TTL              int64  `json:"ttl"`
+	LastAccessedTime int64  `json:"last_accessed_time"`
+	Size             uint64 `json:"size"`
+	HitBefore        bool   `json:"hit_before"`
+}
+
+func newMetaItemView(item *memcached.MetaItem) metaItemView {
+	return metaItemView{
+		Key:              string(item.Key),
+		Value:            string(item.Value),
+		Flags:            item.Flags,
+		CAS:              item.CAS,
+		TTL:              item.TTL,
+		LastAccessedTime: item.LastAccessedTime,
+		Size:             item.Size,
+		HitBefore:        item.HitBefore,
+	}
+}
+
+// metaItemDebugView is the JSON representation of memcached.MetaItemDebug.
+type metaItemDebugView struct {
+	Key              string `json:"key"`
+	CAS              uint64 `json:"cas"`
+	TTL              int64  `json:"ttl"`
+	LastAccessedTime int64  `json:"last_accessed_time"`
+	HitBefore        bool   `json:"hit_before"`
+	SlabClassID      uint64 `json:"slab_class_id"`
+	Size             uint64 `json:"size"`
+}
+
+func (jsonPrinter) encode(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		logger.Errorf("failed to encode output: %v", err)
+	}
+}
+
+func (p jsonPrinter) printMetaItem(item *memcached.MetaItem) {
+	p.encode(newMetaItemView(item))
+}
+
+func (p jsonPrinter) printMetaItems(items []*memcached.MetaItem) {
+	views := make([]metaItemView, 0, len(items))
+	for _, item := range items {
+		views = append(views, newMetaItemView(item))
+	}
+	p.encode(views)
+}
+
+func (p jsonPrinter) printMetaItemDebug(item *memcached.MetaItemDebug) {
+	p.encode(metaItemDebugView{
+		Key:              string(item.Key),
+		CAS:              item.CAS,
+		TTL:              item.TTL,
+		LastAccessedTime: item.LastAssessTime,
+		HitBefore:        item.HitBefore,
+		SlabClassID:      item.SlabClassID,
+		Size:             item.Size,
+	})
+}
+
+func (p jsonPrinter) printStats(stats *memcached.Statistic) { p.encode(stats) }
+
+// clusterStatsView is the JSON representation of memcached.ClusterStats, the nodes
+// are keyed by their addresses.
+type clusterStatsView struct {
+	CurrItems       int64              `json:"curr_items"`
+	Bytes           int64              `json:"bytes"`
+	LimitMaxbytes   int64              `json:"limit_maxbytes"`
+	CurrConnections int64              `json:"curr_connections"`
+	CmdGet          int64              `json:"cmd_get"`
+	CmdSet          int64              `json:"cmd_set"`
+	GetHits         int64              `json:"get_hits"`
+	GetMisses       int64              `json:"get_misses"`
+	Evictions       int64              `json:"evictions"`
+	HitRate         float64            `json:"hit_rate"`
+	MemoryUsage     float64            `json:"memory_usage"`
+	Nodes           []clusterNodeView  `json:"nodes"`
+	Outliers        []statsOutlierView `json:"outliers"`
+}
+
+// clusterNodeView is the summary of the stats of a node in the cluster.
+type clusterNodeView struct {
+	Addr            string  `json:"addr"`
+	CurrItems       int64   `json:"curr_items"`
+	Bytes           int64   `json:"bytes"`
+	HitRate         float64 `json:"hit_rate"`
+	Evictions       int64   `json:"evictions"`
+	CurrConnections int64   `json:"curr_connections"`
+}
+
+type statsOutlierView struct {
+	Addr   string  `json:"addr"`
+	Metric string  `json:"metric"`
+	Value  int64   `json:"value"`
+	Median float64 `json:"median"`
+}
+
+func (p jsonPrinter) printClusterStats(cs *memcached.ClusterStats) {
+	outliers := make([]statsOutlierView, 0, len(cs.Outliers))
+	for _, o := range cs.Outliers {
+		outliers = append(outliers, statsOutlierView{Addr: o.Addr.Address, Metric: o.Metric, Value: o.Value, Median: o.Median})
+	}
+
+	p.encode(clusterStatsView{
+		CurrItems:       cs.CurrItems,
+		Bytes:           cs.Bytes,
+		LimitMaxbytes:   cs.LimitMaxbytes,
+		CurrConnections: cs.CurrConnections,
+		CmdGet:          cs.CmdGet,
+		CmdSet:          cs.CmdSet,
+		GetHits:         cs.GetHits,
+		GetMisses:       cs.GetMisses,
+		Evictions:       cs.Evictions,
+		HitRate:         cs.HitRate,
+		MemoryUsage:     cs.MemoryUsage,
+		Nodes:           clusterNodeViews(cs),
+		Outliers:        outliers,
+	})
+}
+
+// statRateView is the JSON representation of memcached.StatRate.
+type statRateView struct {
+	Time               time.Time `json:"time"`
+	Addr               string    `json:"addr"`
+	IntervalSeconds    float64   `json:"interval_seconds"`
+	GetsPerSec         float64   `json:"gets_per_sec"`
+	SetsPerSec         float64   `json:"sets_per_sec"`
+	HitsPerSec         float64   `json:"hits_per_sec"`
+	MissesPerSec       float64   `json:"misses_per_sec"`
+	EvictionsPerSec    float64   `json:"evictions_per_sec"`
+	BytesReadPerSec    float64   `json:"bytes_read_per_sec"`
+	BytesWrittenPerSec float64   `json:"bytes_written_per_sec"`
+	ConnectionsPerSec  float64   `json:"connections_per_sec"`
+	HitRate            float64   `json:"hit_rate"`
+}
+
+func (p jsonPrinter) printStatRate(rate *memcached.StatRate) {
+	p.encode(statRateView{
+		Time:               rate.Time,
+		Addr:               rate.Addr.Address,
+		IntervalSeconds:    rate.Interval.Seconds(),
+		GetsPerSec:         rate.GetsPerSec,
+		SetsPerSec:         rate.SetsPerSec,
+		HitsPerSec:         rate.HitsPerSec,
+		MissesPerSec:       rate.MissesPerSec,
+		EvictionsPerSec:    rate.EvictionsPerSec,
+		BytesReadPerSec:    rate.BytesReadPerSec,
+		BytesWrittenPerSec: rate.BytesWrittenPerSec,
+		ConnectionsPerSec:  rate.ConnectionsPerSec,
+		HitRate:            rate.HitRate,
+	})
+}
+
+func (p jsonPrinter) printContexts(names []string, current string) {
+	type contextView struct {
+		Name    string `json:"name"`
+		Current bool   `json:"current"`
+	}
+
+	views := make([]contextView, 0, len(names))
+	for _, name := range names {
+		views = append(views, contextView{Name: name, Current: name == current})
+	}
+	p.encode(views)
+}
+
+func (p jsonPrinter) printContext(ctx *Context) { p.encode(ctx) }
+
+func (p jsonPrinter) printOK() { p.encode(map[string]bool{"ok": true}) }
+
+/**
+ * plain printer
+ */
+
+type plainPrinter struct{}
+
+func (plainPrinter) printMetaItem(item *memcached.MetaItem) { fmt.Printf("%s\n", item.Value) }
+
+func (plainPrinter) printMetaItems(items []*memcached.MetaItem) {
+	for _, item := range items {
+		fmt.Printf("%s\t%s\n", item.Key, item.Value)
+	}
+}
+
+func (plainPrinter) printMetaItemDebug(item *memcached.MetaItemDebug) {
+	fmt.Printf("key=%s\n", item.Key)
+	fmt.Printf("cas=%d\n", item.CAS)
+	fmt.Printf("ttl=%d\n", item.TTL)
+	fmt.Printf("last_accessed_time=%d\n", item.LastAssessTime)
+	fmt.Printf("hit_before=%t\n", item.HitBefore)
+	fmt.Printf("slab_class_id=%d\n", item.SlabClassID)
+	fmt.Printf("size=%d\n", item.Size)
+}
+
+func (plainPrinter) printStats(stats *memcached.Statistic) {
+	for _, f := range statsFields(stats) {
+		fmt.Printf("%s %v\n", f.name, f.value)
+	}
+}
+
+func (plainPrinter) printClusterStats(cs *memcached.ClusterStats) {
+	for _, f := range clusterStatsFields(cs) {
+		fmt.Printf("%s %v\n", f.name, f.value)
+	}
+	for _, o := range cs.Outliers {
+		fmt.Printf("outlier %s %s %d\n", o.Addr.Address, o.Metric, o.Value)
+	}
+}
+
+func (plainPrinter) printStatRate(rate *memcached.StatRate) {
+	fmt.Printf("%d %s %.1f %.1f %.4f %.1f %.0f %.0f\n", rate.Time.Unix(), rate.Addr.Address, rate.GetsPerSec,
+		rate.SetsPerSec, rate.HitRate, rate.EvictionsPerSec, rate.BytesReadPerSec, rate.BytesWrittenPerSec)
+}
+
+func (plainPrinter) printContexts(names []string, _ string) {
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
+
+func (plainPrinter) printContext(ctx *Context) {
+	fmt.Printf("name=%s\n", ctx.Name)
+	fmt.Printf("servers=%s\n", ctx.Servers)
+	fmt.Printf("pool_size=%d\n", ctx.Config.PoolSize)
+	fmt.Printf("dial_timeout=%s\n", ctx.Config.DialTimeout)
+	fmt.Printf("read_timeout=%s\n", ctx.Config.ReadTimeout)
+	fmt.Printf("write_timeout=%s\n", ctx.Config.WriteTimeout)
+	fmt.Printf("hash_strategy=%s\n", ctx.Config.HashStrategy)
+}
+
+func (plainPrinter) printOK() {}
+
+type statsField struct {
+	name  string
+	value any
+}
+
+// statsFields flattens the memcached.Statistic into (json name, value) pairs
+// sorted by name.
+func statsFields(stats *memcached.Statistic) []statsField {
+	v := reflect.ValueOf(stats).Elem()
+	t := v.Type()
+
+	fields := make([]statsField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		fields = append(fields, statsField{name: name, value: v.Field(i).Interface()})
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+	return fields
+}
+
+// clusterStatsFields lists the cluster-wide metrics of memcached.ClusterStats.
+func clusterStatsFields(cs *memcached.ClusterStats) []statsField {
+	return []statsField{
+		{name: "nodes", value: len(cs.Nodes)},
+		{name: "curr_items", value: cs.CurrItems},
+		{name: "bytes", value: cs.Bytes},
+		{name: "limit_maxbytes", value: cs.LimitMaxbytes},
+		{name: "memory_usage", value: fmt.Sprintf("%.2f%%", cs.MemoryUsage*100)},
+		{name: "curr_connections", value: cs.CurrConnections},
+		{name: "cmd_get", value: cs.CmdGet},
+		{name: "cmd_set", value: cs.CmdSet},
+		{name: "hit_rate", value: fmt.Sprintf("%.2f%%", cs.HitRate*100)},
+		{name: "evictions", value: cs.Evictions},
+	}
+}
+
+// clusterNodeViews summarizes the stats of each node sorted by address.
+func clusterNodeViews(cs *memcached.ClusterStats) []clusterNodeView {
+	views := make([]clusterNodeView, 0, len(cs.Nodes))
+	for addr, stats := range cs.Nodes {
+		view := clusterNodeView{
+			Addr:            addr.Address,
+			CurrItems:       stats.CurrItems,
+			Bytes:           stats.Bytes,
+			Evictions:       stats.Evictions,
+			CurrConnections: stats.CurrConnections,
+		}
+		if gets := stats.GetHits + stats.GetMisses; gets > 0 {
+			view.HitRate = float64(stats.GetHits) / float64(gets)
+		}
+		views = append(views, view)
+	}
+
+	sort.Slice(views, func(i, j int) bool { return views[i].Addr < views[j].Addr })
+	return views
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/yeqown/memcached"
+)
+
+// rebalanceProgressEvery is the number of scanned keys between two progress lines.
+const rebalanceProgressEvery = 1000
+
+func newRebalanceCommand() *cobra.Command {
+	var (
+		contextName  string
+		newServers   string
+		deleteSource bool
+		rate         float64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rebalance",
+		Short: "Move keys to their new servers after the topology of the current context is changed",
+		Long: "Rebalance dumps the keys of the servers of the current (or given) context by lru_crawler metadump, " +
+			"and copies each key whose server is changed in the new topology to its new server, with the hash " +
+			"settings of the context. Update the servers of the context once it's done.",
+		Example:      `memcached-cli rebalance --to "10.0.0.1:11211,10.0.0.3:11211" --delete-source --rate 1000`,
+		SilenceUsage: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cmd.Root().PersistentPreRun(cmd, args)
+
+			manager, err := newContextManager()
+			if err != nil {
+				logger.Warnf("failed to create context manager: %v", err)
+			}
+			storeContextManager(cmd, manager)
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			manager := getContextManager(cmd, false)
+			if err := manager.close(); err != nil {
+				logger.Warnf("failed to save context: %v", err)
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if newServers == "" {
+				return errors.New("the new servers must be set by --to")
+			}
+
+			manager := getContextManager(cmd, false)
+			ctx, err := manager.getContext(contextName)
+			if err != nil {
+				return err
+			}
+
+			oldServers := uniqueServers(ctx.Servers)
+			opts := []memcached.RebalanceOption{
+				memcached.RebalanceClientOptions(memcached.FromConfig(ctx.Config.toConfig(oldServers))),
+				memcached.RebalanceRateLimit(rate),
+				memcached.RebalanceProgress(func(addr *memcached.Addr, stats memcached.RebalanceStats) {
+					if stats.Scanned%rebalanceProgressEvery == 0 {
+						fmt.Printf("%s: scanned %d, moved %d, skipped %d, failed %d\n",
+							addr.Address, stats.Scanned, stats.Moved, stats.Skipped, stats.Failed)
+					}
+				}),
+			}
+			if deleteSource {
+				opts = append(opts, memcached.RebalanceDeleteSource())
+			}
+
+			fmt.Printf("Rebalancing from %s to %s\n", oldServers, uniqueServers(newServers))
+			stats, err := memcached.Rebalance(cmd.Context(), oldServers, uniqueServers(newServers), opts...)
+			if stats != nil {
+				fmt.Printf("Done: scanned %d, moved %d, skipped %d, deleted %d, failed %d\n",
+					stats.Scanned, stats.Moved, stats.Skipped, stats.Deleted, stats.Failed)
+			}
+
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&contextName, "context", "c", "", "context name to use, if not set, use current context")
+	cmd.Flags().StringVar(&newServers, "to", "", "comma separated servers of the new topology")
+	cmd.Flags().BoolVar(&deleteSource, "delete-source", false, "delete the keys from their old servers once copied")
+	cmd.Flags().Float64Var(&rate, "rate", 0, "max number of keys moved per second, 0 means unlimited")
+
+	return cmd
+}
@@ -16,6 +16,9 @@ import (
 type replCommander struct {
 	cm      *contextManager
 	timeout time.Duration
+
+	// metaToggles are the flags toggled by `meta toggle`, keyed by the meta commands.
+	metaToggles map[string][]string
 }
 
 func newREPLCommander(manager *contextManager, timeout time.Duration) (*replCommander, error) {
@@ -24,8 +27,9 @@ func newREPLCommander(manager *contextManager, timeout time.Duration) (*replComm
 	}
 
 	return &replCommander{
-		cm:      manager,
-		timeout: timeout,
+		cm:          manager,
+		timeout:     timeout,
+		metaToggles: make(map[string][]string, len(metaCommands)),
 	}, nil
 }
 
@@ -39,10 +43,15 @@ func (r *replCommander) commandCompleter(d prompt.Document) []prompt.Suggest {
 		{Text: "get", Description: "Get value by key"},
 		{Text: "gets", Description: "Get multiple values by keys"},
 		{Text: "set", Description: "Set key to value"},
+		{Text: "add", Description: "Add key with value if it does not exist"},
+		{Text: "replace", Description: "Replace value of key if it exists"},
 		{Text: "delete", Description: "Delete key"},
 		{Text: "incr", Description: "Increment value"},
 		{Text: "decr", Description: "Decrement value"},
 		{Text: "touch", Description: "Update expiration time"},
+		{Text: "debug", Description: "Show debug information of a key"},
+		{Text: "stats", Description: "Show statistics of the server"},
+		{Text: "meta", Description: "Run meta commands with flags, see `meta help`"},
 		// other
 		{Text: "version", Description: "Show version information"},
 		{Text: "help", Description: "Show help message"},
@@ -51,6 +60,12 @@ func (r *replCommander) commandCompleter(d prompt.Document) []prompt.Suggest {
 	}
 
 	sub := d.GetWordBeforeCursor()
+	if words := strings.Fields(d.TextBeforeCursor()); len(words) > 0 && words[0] == "meta" {
+		suggestions = metaSuggestions
+		if len(words) > 2 || (len(words) == 2 && sub == "") {
+			return []prompt.Suggest{}
+		}
+	}
 
 	if sub == "" {
 		return []prompt.Suggest{}
@@ -65,10 +80,13 @@ func (r *replCommander) commandExecutor(line string) {
 		return
 	}
 
-	args := strings.Fields(line)
+	args, err := splitArgs(line)
+	if err != nil {
+		fmt.Printf("Invalid command: %v\n", err)
+		return
+	}
 	cmd := args[0]
 
-	var err error
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
@@ -84,8 +102,8 @@ func (r *replCommander) commandExecutor(line string) {
 		err = r.handleGet(ctx, args)
 	case "gets":
 		err = r.handleMGet(ctx, args)
-	case "set":
-		err = r.handleSet(ctx, args)
+	case "set", "add", "replace":
+		err = r.handleStorage(ctx, args)
 	case "delete":
 		err = r.handleDelete(ctx, args)
 	case "incr":
@@ -94,6 +112,12 @@ func (r *replCommander) commandExecutor(line string) {
 		err = r.handleDecr(ctx, args)
 	case "touch":
 		err = r.handleTouch(ctx, args)
+	case "debug":
+		err = r.handleDebug(ctx, args)
+	case "stats":
+		err = r.handleStats(ctx)
+	case "meta":
+		err = r.handleMeta(ctx, args)
 
 	case "version":
 		err = r.handleVersion(ctx)
@@ -131,14 +155,12 @@ func (r *replCommander) handleUse(ctx context.Context, args []string) error {
 }
 
 func (r *replCommander) handleList(_ context.Context) error {
-	ctx, _ := r.cm.getCurrentContext()
-	for _, name := range r.cm.listContexts() {
-		if ctx != nil && ctx.Name == name {
-			fmt.Printf("* %s\n", name)
-		} else {
-			fmt.Printf("  %s\n", name)
-		}
+	currentName := ""
+	if ctx, _ := r.cm.getCurrentContext(); ctx != nil {
+		currentName = ctx.Name
 	}
+
+	getPrinter().printContexts(r.cm.listContexts(), currentName)
 	return nil
 }
 
@@ -176,26 +198,22 @@ func (r *replCommander) handleGet(ctx context.Context, args []string) error {
 	if err != nil {
 		return ignoreMemcachedError(err)
 	}
-	printMetaItem(item)
+	getPrinter().printMetaItem(item)
 	return nil
 }
 
-func (r *replCommander) handleSet(ctx context.Context, args []string) error {
-	if len(args) < 3 {
-		return fmt.Errorf("usage: set <key> <value> [expiration]")
-	}
-
-	var expiration time.Duration
-	if len(args) >= 4 {
-		if e, err := strconv.ParseUint(args[3], 10, 32); err == nil {
-			expiration = time.Duration(e) * time.Second
-		}
+// handleStorage handles the storage commands, set, add and replace, which accept
+// the same flags as the kv commands, see parseStorageArgs.
+func (r *replCommander) handleStorage(ctx context.Context, args []string) error {
+	key, value, opts, err := parseStorageArgs(args[0], args[1:])
+	if err != nil {
+		return err
 	}
 
-	if err := r.getMemcachedClient().Set(ctx, args[1], []byte(args[2]), magicFlags, expiration); err != nil {
+	if err = store(ctx, r.getMemcachedClient(), args[0], key, []byte(value), opts); err != nil {
 		return ignoreMemcachedError(err)
 	}
-	fmt.Println("OK")
+	getPrinter().printOK()
 	return nil
 }
 
@@ -207,7 +225,7 @@ func (r *replCommander) handleDelete(ctx context.Context, args []string) error {
 	if err := r.getMemcachedClient().Delete(ctx, args[1]); err != nil {
 		return ignoreMemcachedError(err)
 	}
-	fmt.Println("OK")
+	getPrinter().printOK()
 	return nil
 }
 
@@ -261,7 +279,20 @@ func (r *replCommander) handleTouch(ctx context.Context, args []string) error {
 	if err := r.getMemcachedClient().Touch(ctx, args[1], time.Duration(expiration)*time.Second); err != nil {
 		return ignoreMemcachedError(err)
 	}
-	fmt.Println("OK")
+	getPrinter().printOK()
+	return nil
+}
+
+func (r *replCommander) handleDebug(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: debug <key>")
+	}
+
+	item, err := r.getMemcachedClient().MetaDebug(ctx, []byte(args[1]))
+	if err != nil {
+		return ignoreMemcachedError(err)
+	}
+	getPrinter().printMetaItemDebug(item)
 	return nil
 }
 
@@ -288,15 +319,25 @@ func (r *replCommander) handleMGet(ctx context.Context, args []string) error {
 			memcached.MetaGetFlagReturnHitBefore(),
 		)
 		if err != nil {
-			fmt.Printf("Encounter error while getting key '%s': %v\n", key, errors.Cause(err))
+			fmt.Fprintf(os.Stderr, "Encounter error while getting key '%s': %v\n", key, errors.Cause(err))
 			continue
 		}
 
 		items = append(items, item)
 	}
 
-	printMetaItems(items)
+	getPrinter().printMetaItems(items)
+
+	return nil
+}
+
+func (r *replCommander) handleStats(ctx context.Context) error {
+	stats, err := r.getMemcachedClient().Stats(ctx)
+	if err != nil {
+		return ignoreMemcachedError(err)
+	}
 
+	getPrinter().printStats(stats)
 	return nil
 }
 
@@ -317,11 +358,17 @@ func (r *replCommander) handleHelp() {
 
 	fmt.Println("  get <key>         Get value by key")
 	fmt.Println("  gets <key...>     Get multiple values by keys")
-	fmt.Println("  set <key> <value> Set key to value")
+	fmt.Println("  set <key> <value> Set key to value, quote the value with spaces")
+	fmt.Println("                    options: [ttl-seconds] --ttl <duration> --flags <n> --cas <n>")
+	fmt.Println("  add <key> <value> Add key with value if it does not exist, same options as set")
+	fmt.Println("  replace <key> <value> Replace value of key if it exists, same options as set")
 	fmt.Println("  delete <key>      Delete key")
 	fmt.Println("  incr <key> [delta] Increment value")
 	fmt.Println("  decr <key> [delta] Decrement value")
 	fmt.Println("  touch <key> <exp> Update expiration time")
+	fmt.Println("  debug <key>       Show debug information of a key")
+	fmt.Println("  stats             Show statistics of the server")
+	fmt.Println("  meta <cmd> ...    Run meta get/set/delete/arith with flags, see `meta help`")
 
 	fmt.Println("  help              Show this help message")
 	fmt.Println("  exit, quit        Exit the program")
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/yeqown/memcached"
+)
+
+// storageOptions are the options of the storage commands, set, add and replace,
+// which are shared by the kv commands and the REPL, see bindStorageFlags.
+type storageOptions struct {
+	ttl   time.Duration
+	flags uint32
+	// cas makes set compare the CAS unique of the item, 0 means not compared.
+	cas uint64
+}
+
+// bindStorageFlags binds the flags of the storage commands to opts.
+func bindStorageFlags(fs *pflag.FlagSet, opts *storageOptions) {
+	fs.DurationVarP(&opts.ttl, "ttl", "t", 0, "ttl of key, e.g. 30s, 0 means never expires")
+	fs.Uint32VarP(&opts.flags, "flags", "f", magicFlags, "client flags stored along with the value")
+	fs.Uint64Var(&opts.cas, "cas", 0, "store only if the CAS unique of the item is still the given one, set only")
+}
+
+// store runs the storage command, one of set, add and replace, by the options.
+func store(ctx context.Context, client memcached.Client, command, key string, value []byte, opts *storageOptions) error {
+	if opts.cas != 0 && command != "set" {
+		return fmt.Errorf("--cas is only supported by set")
+	}
+
+	switch command {
+	case "set":
+		if opts.cas != 0 {
+			return client.Cas(ctx, key, value, opts.flags, opts.ttl, opts.cas)
+		}
+		return client.Set(ctx, key, value, opts.flags, opts.ttl)
+	case "add":
+		return client.Add(ctx, key, value, opts.flags, opts.ttl)
+	case "replace":
+		return client.Replace(ctx, key, value, opts.flags, opts.ttl)
+	}
+
+	return fmt.Errorf("unknown storage command: %s", command)
+}
+
+// parseStorageArgs parses the arguments of the storage command in the REPL, which
+// are `<key> <value> [ttl-seconds]` followed or preceded by the flags bound by
+// bindStorageFlags, e.g. `set greeting "hello world" --ttl 1m --flags 1`.
+func parseStorageArgs(command string, args []string) (key, value string, opts *storageOptions, err error) {
+	opts = &storageOptions{}
+	fs := pflag.NewFlagSet(command, pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	bindStorageFlags(fs, opts)
+	if err = fs.Parse(args); err != nil {
+		return "", "", nil, err
+	}
+
+	positional := fs.Args()
+	if len(positional) != 2 && len(positional) != 3 {
+		return "", "", nil, fmt.Errorf("usage: %s <key> <value> [ttl-seconds] [--ttl duration] [--flags n] [--cas n]", command)
+	}
+	if len(positional) == 3 {
+		if fs.Changed("ttl") {
+			return "", "", nil, fmt.Errorf("ttl is given twice")
+		}
+		seconds, err := strconv.ParseUint(positional[2], 10, 32)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("invalid ttl %q: %v", positional[2], err)
+		}
+		opts.ttl = time.Duration(seconds) * time.Second
+	}
+
+	return positional[0], positional[1], opts, nil
+}
+
+// splitArgs splits the line of the REPL into the arguments by the white spaces,
+// the ones in the single or double quotes are kept, and the backslash escapes the
+// next character out of the single quotes, e.g. `set k "hello world"`.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,87 @@
+// memcached-proxy sits between the applications and a memcached server to debug
+// the traffic: it logs the decoded commands and their replies, records the session
+// to a file, and replays a recorded session without the server to reproduce the
+// bugs deterministically.
+//
+//	memcached-proxy -listen 127.0.0.1:11311 -upstream localhost:11211 -record session.jsonl
+//	memcached-proxy -listen 127.0.0.1:11311 -replay session.jsonl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/yeqown/memcached"
+)
+
+func main() {
+	var (
+		listen   = flag.String("listen", "127.0.0.1:11311", "address to accept the applications on")
+		upstream = flag.String("upstream", "localhost:11211", "address of the memcached server")
+		record   = flag.String("record", "", "file to record the session to")
+		replay   = flag.String("replay", "", "file of the recorded session to replay instead of relaying to the upstream")
+		quiet    = flag.Bool("quiet", false, "do not log the commands and replies to stderr")
+	)
+	flag.Parse()
+
+	if err := run(*listen, *upstream, *record, *replay, *quiet); err != nil {
+		fmt.Fprintln(os.Stderr, "memcached-proxy:", err)
+		os.Exit(1)
+	}
+}
+
+func run(listen, upstream, record, replay string, quiet bool) error {
+	var opts []memcached.ProxyOption
+	if !quiet {
+		opts = append(opts, memcached.ProxyWireLogger(memcached.NewWireLogger(os.Stderr)))
+	}
+
+	if record != "" {
+		f, err := os.Create(record)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		opts = append(opts, memcached.ProxyRecorder(f))
+	}
+
+	if replay != "" {
+		exchanges, err := readExchanges(replay)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, memcached.ProxyReplay(exchanges))
+		log.Printf("replaying %d exchanges from %s", len(exchanges), replay)
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+
+	proxy := memcached.NewProxy(upstream, opts...)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		_ = proxy.Close()
+	}()
+
+	log.Printf("listening on %s", ln.Addr())
+	return proxy.Serve(ln)
+}
+
+func readExchanges(name string) ([]*memcached.ProxyExchange, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return memcached.ReadProxyExchanges(f)
+}
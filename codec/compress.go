@@ -97,7 +97,7 @@ func NewCompressCodec(algorithm Compression, threshold, level int) (CompressCode
 }
 
 func (c *compressCodec) Encode(_ []byte, value []byte, flag uint32) ([]byte, uint32, error) {
-	if flag > 0xFFFF {
+	if flag >= 1<<CompressAppFlagsSize {
 		return nil, 0, errInvalidFlags
 	}
 
@@ -147,7 +147,9 @@ func (c *compressCodec) SupportsOperation(operation string) error {
 	if c.compression == CompressionAlgorithmNone {
 		return nil
 	}
-	if operation == "append" || operation == "prepend" {
+	// "stream" means the value is transferred without buffering, which could not
+	// be compressed or decompressed as a whole.
+	if operation == "append" || operation == "prepend" || operation == "stream" {
 		return errNotSupported
 	}
 	return nil
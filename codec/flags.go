@@ -0,0 +1,181 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrFlagsReserved is returned when the bits of a field are reserved by another one.
+	ErrFlagsReserved = errors.New("flags: bits already reserved")
+	// ErrFlagsOverflow is returned when a field or a value does not fit in its bits.
+	ErrFlagsOverflow = errors.New("flags: out of range")
+	// ErrFlagsUnreserved is returned when the flags set the bits which are not reserved.
+	ErrFlagsUnreserved = errors.New("flags: bits not reserved")
+)
+
+const (
+	// FlagsSize is the number of bits of the client flags.
+	FlagsSize = 32
+	// CompressAppFlagsSize is the number of bits of the caller-facing flags preserved
+	// by the MC-COMPRESS layout, the others are used by the compression codec.
+	CompressAppFlagsSize = 16
+)
+
+// FlagsField is a range of bits in the caller-facing client flags reserved by a
+// FlagsPolicy, e.g. the bits of the serializer id.
+type FlagsField struct {
+	Name   string
+	Offset uint8
+	Width  uint8
+}
+
+// Mask returns the bits of the field.
+func (f FlagsField) Mask() uint32 {
+	return uint32((uint64(1)<<f.Width)-1) << f.Offset
+}
+
+// Get returns the value of the field in flags.
+func (f FlagsField) Get(flags uint32) uint32 {
+	return (flags & f.Mask()) >> f.Offset
+}
+
+// Set returns flags with the field set to value, the other bits are kept.
+func (f FlagsField) Set(flags, value uint32) (uint32, error) {
+	if uint64(value) >= uint64(1)<<f.Width {
+		return flags, fmt.Errorf("%w: value %d of field %s exceeds %d bits", ErrFlagsOverflow, value, f.Name, f.Width)
+	}
+
+	return flags&^f.Mask() | value<<f.Offset, nil
+}
+
+// FlagsPolicy partitions the caller-facing client flags into named fields, so that
+// the application and the serializers could share the flags without clobbering
+// the bits of each other. The size is the number of bits available to them, it's
+// CompressAppFlagsSize if the compression codec is used, since the others are
+// taken by the MC-COMPRESS layout:
+//
+//	policy := codec.NewFlagsPolicy(codec.CompressAppFlagsSize)
+//	serializer, _ := policy.Reserve("serializer", 4)
+//	version, _ := policy.Reserve("schema-version", 8)
+//	flags, _ := serializer.Set(0, 2)
+//	flags, _ = version.Set(flags, 7)
+//
+// It's safe for concurrent use.
+type FlagsPolicy struct {
+	size uint8
+
+	mu     sync.RWMutex // guards fields
+	fields []FlagsField // sorted by offset
+}
+
+// NewFlagsPolicy creates a FlagsPolicy of the given number of bits, which is
+// FlagsSize if it's 0 or larger than FlagsSize.
+func NewFlagsPolicy(size uint8) *FlagsPolicy {
+	if size == 0 || size > FlagsSize {
+		size = FlagsSize
+	}
+
+	return &FlagsPolicy{size: size}
+}
+
+// Size returns the number of bits of the policy.
+func (p *FlagsPolicy) Size() uint8 { return p.size }
+
+// Reserve reserves the lowest free bits of the given width for the named field.
+func (p *FlagsPolicy) Reserve(name string, width uint8) (FlagsField, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	offset := uint8(0)
+	for _, f := range p.fields {
+		if offset+width <= f.Offset {
+			break
+		}
+		offset = f.Offset + f.Width
+	}
+
+	return p.reserveLocked(FlagsField{Name: name, Offset: offset, Width: width})
+}
+
+// ReserveAt reserves the bits from offset of the given width for the named field,
+// it's used to describe the layouts which are already in use.
+func (p *FlagsPolicy) ReserveAt(name string, offset, width uint8) (FlagsField, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.reserveLocked(FlagsField{Name: name, Offset: offset, Width: width})
+}
+
+// reserveLocked adds the field after checking it does not conflict with others.
+// NOTE: MUST run in the FlagsPolicy.mu.Lock()
+func (p *FlagsPolicy) reserveLocked(field FlagsField) (FlagsField, error) {
+	if field.Name == "" {
+		return FlagsField{}, fmt.Errorf("%w: empty field name", ErrFlagsReserved)
+	}
+	if field.Width == 0 || int(field.Offset)+int(field.Width) > int(p.size) {
+		return FlagsField{}, fmt.Errorf("%w: field %s [%d, %d) exceeds %d bits",
+			ErrFlagsOverflow, field.Name, field.Offset, int(field.Offset)+int(field.Width), p.size)
+	}
+
+	if _, ok := p.fieldLocked(field.Name); ok {
+		return FlagsField{}, fmt.Errorf("%w: field %s exists", ErrFlagsReserved, field.Name)
+	}
+	for _, f := range p.fields {
+		if f.Mask()&field.Mask() != 0 {
+			return FlagsField{}, fmt.Errorf("%w: field %s overlaps %s", ErrFlagsReserved, field.Name, f.Name)
+		}
+	}
+
+	p.fields = append(p.fields, field)
+	sort.Slice(p.fields, func(i, j int) bool { return p.fields[i].Offset < p.fields[j].Offset })
+
+	return field, nil
+}
+
+// Field returns the named field.
+func (p *FlagsPolicy) Field(name string) (FlagsField, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.fieldLocked(name)
+}
+
+// fieldLocked returns the named field.
+// NOTE: MUST run in the FlagsPolicy.mu.RLock()
+func (p *FlagsPolicy) fieldLocked(name string) (FlagsField, bool) {
+	for _, f := range p.fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+
+	return FlagsField{}, false
+}
+
+// Fields returns the reserved fields ordered by their offsets.
+func (p *FlagsPolicy) Fields() []FlagsField {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return append([]FlagsField(nil), p.fields...)
+}
+
+// Check returns ErrFlagsUnreserved if flags set any bit which is not reserved
+// by the fields.
+func (p *FlagsPolicy) Check(flags uint32) error {
+	p.mu.RLock()
+	var reserved uint32
+	for _, f := range p.fields {
+		reserved |= f.Mask()
+	}
+	p.mu.RUnlock()
+
+	if unreserved := flags &^ reserved; unreserved != 0 {
+		return fmt.Errorf("%w: %#x", ErrFlagsUnreserved, unreserved)
+	}
+
+	return nil
+}
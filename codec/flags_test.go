@@ -0,0 +1,98 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagsPolicyReserve(t *testing.T) {
+	policy := NewFlagsPolicy(CompressAppFlagsSize)
+	assert.Equal(t, uint8(CompressAppFlagsSize), policy.Size())
+
+	legacy, err := policy.ReserveAt("legacy", 4, 4)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0xF0), legacy.Mask())
+
+	// the lowest free bits are reserved.
+	serializer, err := policy.Reserve("serializer", 4)
+	require.NoError(t, err)
+	assert.Equal(t, FlagsField{Name: "serializer", Offset: 0, Width: 4}, serializer)
+
+	version, err := policy.Reserve("version", 8)
+	require.NoError(t, err)
+	assert.Equal(t, FlagsField{Name: "version", Offset: 8, Width: 8}, version)
+
+	tests := []struct {
+		name    string
+		reserve func() error
+		wantErr error
+	}{
+		{
+			name:    "duplicated name",
+			reserve: func() error { _, err := policy.ReserveAt("legacy", 0, 1); return err },
+			wantErr: ErrFlagsReserved,
+		},
+		{
+			name:    "overlapped",
+			reserve: func() error { _, err := policy.ReserveAt("other", 6, 4); return err },
+			wantErr: ErrFlagsReserved,
+		},
+		{
+			name:    "no free bits",
+			reserve: func() error { _, err := policy.Reserve("other", 1); return err },
+			wantErr: ErrFlagsOverflow,
+		},
+		{
+			name:    "zero width",
+			reserve: func() error { _, err := NewFlagsPolicy(0).Reserve("other", 0); return err },
+			wantErr: ErrFlagsOverflow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, tt.reserve(), tt.wantErr)
+		})
+	}
+
+	assert.Equal(t, []FlagsField{serializer, legacy, version}, policy.Fields())
+	got, ok := policy.Field("version")
+	assert.True(t, ok)
+	assert.Equal(t, version, got)
+}
+
+func TestFlagsFieldSetGet(t *testing.T) {
+	policy := NewFlagsPolicy(0)
+	serializer, err := policy.Reserve("serializer", 4)
+	require.NoError(t, err)
+	version, err := policy.Reserve("version", 28)
+	require.NoError(t, err)
+
+	flags, err := serializer.Set(0, 0x3)
+	require.NoError(t, err)
+	flags, err = version.Set(flags, 0xFFFFFFF)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0xFFFFFFF3), flags)
+	assert.Equal(t, uint32(0x3), serializer.Get(flags))
+	assert.Equal(t, uint32(0xFFFFFFF), version.Get(flags))
+
+	// the other fields are kept.
+	flags, err = serializer.Set(flags, 0x5)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0xFFFFFFF5), flags)
+
+	_, err = serializer.Set(flags, 0x10)
+	require.ErrorIs(t, err, ErrFlagsOverflow)
+}
+
+func TestFlagsPolicyCheck(t *testing.T) {
+	policy := NewFlagsPolicy(CompressAppFlagsSize)
+	_, err := policy.Reserve("serializer", 4)
+	require.NoError(t, err)
+
+	require.NoError(t, policy.Check(0))
+	require.NoError(t, policy.Check(0xF))
+	require.ErrorIs(t, policy.Check(0x10), ErrFlagsUnreserved)
+}
@@ -0,0 +1,164 @@
+package memcached
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// Compatibility represents the kind of server the client talks to. Servers and
+// proxies which speak the memcached text protocol usually differ in some details,
+// the compatibility mode centralizes these quirks so that the client can adjust
+// its behaviors rather than failing with malformed responses.
+type Compatibility uint8
+
+const (
+	// CompatMemcached means the client talks to the memcached server, it is the default mode.
+	CompatMemcached Compatibility = iota
+	// CompatDragonfly means the client talks to the Dragonfly server.
+	// Dragonfly does not support meta commands and multi-key gat/gats,
+	// so gats are executed key by key.
+	CompatDragonfly
+	// CompatTwemproxy means the client talks to the memcached servers through twemproxy.
+	// Twemproxy does not proxy meta commands and gat/gats commands.
+	CompatTwemproxy
+)
+
+func (c Compatibility) String() string {
+	switch c {
+	case CompatMemcached:
+		return "memcached"
+	case CompatDragonfly:
+		return "dragonfly"
+	case CompatTwemproxy:
+		return "twemproxy"
+	}
+
+	return "unknown"
+}
+
+// compatQuirks describes the differences between the server and memcached.
+type compatQuirks struct {
+	// noMeta means meta commands(ms/mg/md/ma/me/mn) are not supported.
+	noMeta bool
+	// noGetAndTouch means gat/gats commands are not supported.
+	noGetAndTouch bool
+	// noMultiKeyGetAndTouch means gat/gats commands only accept one key.
+	noMultiKeyGetAndTouch bool
+	// lenientFaultLine means the server replies error lines slightly different
+	// from memcached, such as "ERROR <message>" or lines end with '\n' only.
+	lenientFaultLine bool
+	// lenientCAS means the server may reply CAS uniques which are not 64-bit
+	// unsigned decimals, they're parsed leniently by CASParsingAuto.
+	lenientCAS bool
+}
+
+func (c Compatibility) quirks() compatQuirks {
+	switch c {
+	case CompatDragonfly:
+		return compatQuirks{
+			noMeta:                true,
+			noMultiKeyGetAndTouch: true,
+			lenientFaultLine:      true,
+			lenientCAS:            true,
+		}
+	case CompatTwemproxy:
+		return compatQuirks{
+			noMeta:           true,
+			noGetAndTouch:    true,
+			lenientFaultLine: true,
+		}
+	}
+
+	return compatQuirks{}
+}
+
+// CASParsing is how the CAS uniques replied by the server are parsed, see WithCASParsing.
+type CASParsing uint8
+
+const (
+	// CASParsingAuto parses the CAS uniques by the compatibility mode, leniently in
+	// CompatDragonfly mode and strictly in the others. It's the default.
+	CASParsingAuto CASParsing = iota
+	// CASParsingStrict requires the CAS uniques to be 64-bit unsigned decimals, the
+	// commands fail with *CASParseError otherwise.
+	CASParsingStrict
+	// CASParsingLenient returns the items whose CAS uniques could not be parsed with
+	// CAS 0, so that they're still read, but could not be written by Cas.
+	CASParsingLenient
+)
+
+func (p CASParsing) String() string {
+	switch p {
+	case CASParsingAuto:
+		return "auto"
+	case CASParsingStrict:
+		return "strict"
+	case CASParsingLenient:
+		return "lenient"
+	}
+
+	return "unknown"
+}
+
+// tolerateCAS drops the *CASParseError if the CAS uniques are parsed leniently, the
+// items parsed along with it are kept with CAS 0. The other errors are returned as is.
+func (c *client) tolerateCAS(err error) error {
+	if err == nil || !isCASParseError(err) {
+		return err
+	}
+
+	switch c.options.casParsing {
+	case CASParsingLenient:
+		return nil
+	case CASParsingAuto:
+		if c.options.compatibility.quirks().lenientCAS {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// checkMetaSupported returns ErrNotSupported if meta commands are not supported
+// in current compatibility mode.
+func (c *client) checkMetaSupported() error {
+	if c.options.compatibility.quirks().noMeta {
+		return errors.Wrapf(ErrNotSupported, "meta commands in %s compatibility mode", c.options.compatibility)
+	}
+
+	return nil
+}
+
+// checkGetAndTouchSupported returns ErrNotSupported if gat/gats commands are not supported
+// in current compatibility mode.
+func (c *client) checkGetAndTouchSupported() error {
+	if c.options.compatibility.quirks().noGetAndTouch {
+		return errors.Wrapf(ErrNotSupported, "gat/gats commands in %s compatibility mode", c.options.compatibility)
+	}
+
+	return nil
+}
+
+// forecastLenientFaultLine forecasts the error line from the response line, it
+// tolerates the error lines which are slightly different from memcached:
+//
+// ERROR <message>\r\n
+// CLIENT_ERROR\r\n
+// SERVER_ERROR <message>\n
+func forecastLenientFaultLine(line []byte) error {
+	trimmed := bytes.TrimRight(line, "\r\n")
+
+	switch {
+	case bytes.Equal(trimmed, []byte("ERROR")), bytes.HasPrefix(trimmed, []byte("ERROR ")):
+		return ErrNonexistentCommand
+	case bytes.HasPrefix(trimmed, []byte("CLIENT_ERROR")):
+		return parseClientError(string(trimmed[12:]))
+	case bytes.HasPrefix(trimmed, []byte("SERVER_ERROR")):
+		return parseServerError(string(trimmed[12:]))
+	}
+
+	// restrict the capacity so that appending CRLF copies rather than overwrites
+	// the bytes after the line.
+	return forecastCommonFaultLine(append(trimmed[:len(trimmed):len(trimmed)], _CRLFBytes...))
+}
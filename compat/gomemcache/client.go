@@ -0,0 +1,367 @@
+// Package gomemcache provides the API of github.com/bradfitz/gomemcache/memcache
+// backed by the memcached client, so that the codebases using gomemcache could
+// migrate to it by replacing the import path and the constructor:
+//
+//	import memcache "github.com/yeqown/memcached/compat/gomemcache"
+//
+//	mc, err := memcache.New("10.0.0.1:11211", "10.0.0.2:11211")
+//	if err != nil {
+//		// handle error
+//	}
+//	err = mc.Set(&memcache.Item{Key: "foo", Value: []byte("bar")})
+//
+// The underlying client is accessible by Unwrap to use the features which
+// gomemcache does not provide, e.g. meta commands.
+package gomemcache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yeqown/memcached"
+)
+
+// DefaultTimeout is the default timeout of each operation.
+const DefaultTimeout = 500 * time.Millisecond
+
+// Errors are the same as gomemcache's, the errors of the underlying client
+// are converted to them if possible.
+var (
+	// ErrCacheMiss means that a Get failed because the item wasn't present.
+	ErrCacheMiss = errors.New("memcache: cache miss")
+	// ErrCASConflict means that a CompareAndSwap call failed due to the
+	// cached value being modified between the Get and the CompareAndSwap.
+	// If the cached value was simply evicted rather than replaced,
+	// ErrNotStored will be returned instead.
+	ErrCASConflict = errors.New("memcache: compare-and-swap conflict")
+	// ErrNotStored means that a conditional write operation (i.e. Add or
+	// CompareAndSwap) failed because the condition was not satisfied.
+	ErrNotStored = errors.New("memcache: item not stored")
+	// ErrServerError means that a server error occurred.
+	ErrServerError = errors.New("memcache: server error")
+	// ErrMalformedKey is returned when an invalid key is used.
+	// Keys must be at maximum 250 bytes long and not
+	// contain whitespace or control characters.
+	ErrMalformedKey = errors.New("malformed: key is too long or contains invalid characters")
+	// ErrNoServers is returned when no servers are configured or available.
+	ErrNoServers = errors.New("memcache: no servers configured or available")
+)
+
+// Item is an item to be got or stored in a memcached server.
+type Item struct {
+	// Key is the Item's key (250 bytes maximum).
+	Key string
+	// Value is the Item's value.
+	Value []byte
+	// Flags are server-opaque flags whose semantics are entirely
+	// up to the app.
+	Flags uint32
+	// Expiration is the cache expiration time, in seconds: either a relative
+	// time from now (up to 1 month), or an absolute Unix epoch time.
+	// Zero means the Item has no expiration time.
+	Expiration int32
+
+	// casid is the compare and swap ID, set by Get and used by CompareAndSwap.
+	casid uint64
+}
+
+// Client is a memcache client with the API of gomemcache.
+type Client struct {
+	// Timeout specifies the timeout of each operation.
+	// If zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	client memcached.Client
+}
+
+// New returns a memcache client using the provided servers with equal weight.
+// Different from gomemcache, it returns an error if the servers are invalid.
+// Use NewFromClient to configure the underlying client with options.
+func New(server ...string) (*Client, error) {
+	if len(server) == 0 {
+		return nil, ErrNoServers
+	}
+
+	client, err := memcached.New(strings.Join(server, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromClient(client), nil
+}
+
+// NewFromClient returns a memcache client backed by the given client.
+func NewFromClient(client memcached.Client) *Client {
+	return &Client{client: client}
+}
+
+// Unwrap returns the underlying client.
+func (c *Client) Unwrap() memcached.Client {
+	return c.client
+}
+
+// Close closes the underlying client.
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// Get gets the item for the given key. ErrCacheMiss is returned for a
+// memcache cache miss. The key must be at most 250 bytes in length.
+func (c *Client) Get(key string) (*Item, error) {
+	if !legalKey(key) {
+		return nil, ErrMalformedKey
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	items, err := c.client.Gets(ctx, key)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if len(items) == 0 {
+		return nil, ErrCacheMiss
+	}
+
+	return fromItem(items[0]), nil
+}
+
+// GetMulti is a batch version of Get. The returned map from keys to
+// items may have fewer elements than the input slice, due to memcache
+// cache misses. Each key must be at most 250 bytes in length.
+// If no error is returned, the returned map will also be non-nil.
+//
+// The keys are grouped by their servers, and the groups are fetched
+// concurrently, each by one gets command.
+func (c *Client) GetMulti(keys []string) (map[string]*Item, error) {
+	for _, key := range keys {
+		if !legalKey(key) {
+			return nil, ErrMalformedKey
+		}
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	// the keys are grouped by their servers, and each group is read by one gets.
+	items, err := c.client.Gets(ctx, keys...)
+	if err != nil && !errors.Is(err, memcached.ErrNotFound) {
+		return nil, convertError(err)
+	}
+
+	result := make(map[string]*Item, len(items))
+	for _, item := range items {
+		result[item.Key] = fromItem(item)
+	}
+
+	return result, nil
+}
+
+// Set writes the given item, unconditionally.
+func (c *Client) Set(item *Item) error {
+	return c.store(item, c.client.SetWithExpiration)
+}
+
+// Add writes the given item, if no value already exists for its
+// key. ErrNotStored is returned if that condition is not met.
+func (c *Client) Add(item *Item) error {
+	return c.store(item, c.client.AddWithExpiration)
+}
+
+// Replace writes the given item, but only if the server *does*
+// already hold data for this key.
+func (c *Client) Replace(item *Item) error {
+	return c.store(item, c.client.ReplaceWithExpiration)
+}
+
+// Append appends the given item to the existing item, if a value already
+// exists for its key. ErrNotStored is returned if that condition is not met.
+func (c *Client) Append(item *Item) error {
+	return c.store(item, c.client.AppendWithExpiration)
+}
+
+// Prepend prepends the given item to the existing item, if a value already
+// exists for its key. ErrNotStored is returned if that condition is not met.
+func (c *Client) Prepend(item *Item) error {
+	return c.store(item, c.client.PrependWithExpiration)
+}
+
+// CompareAndSwap writes the given item that was previously returned
+// by Get, if the value was neither modified nor evicted between the
+// Get and the CompareAndSwap calls. The item's Key should not change
+// between calls but all other item fields may differ. ErrCASConflict
+// is returned if the value was modified in between the
+// calls. ErrNotStored is returned if the value was evicted in between
+// the calls.
+func (c *Client) CompareAndSwap(item *Item) error {
+	return c.store(item, func(
+		ctx context.Context, key string, value []byte, flags uint32, expiry memcached.Expiration,
+	) error {
+		err := c.client.CasWithExpiration(ctx, key, value, flags, expiry, item.casid)
+		if errors.Is(err, memcached.ErrNotFound) {
+			return ErrNotStored
+		}
+
+		return err
+	})
+}
+
+type storeFunc func(ctx context.Context, key string, value []byte, flags uint32, expiry memcached.Expiration) error
+
+func (c *Client) store(item *Item, fn storeFunc) error {
+	if !legalKey(item.Key) {
+		return ErrMalformedKey
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	err := fn(ctx, item.Key, item.Value, item.Flags, memcached.Expiration(item.Expiration))
+	return convertError(err)
+}
+
+// Delete deletes the item with the provided key. The error ErrCacheMiss is
+// returned if the item didn't already exist in the cache.
+func (c *Client) Delete(key string) error {
+	if !legalKey(key) {
+		return ErrMalformedKey
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	return convertError(c.client.Delete(ctx, key))
+}
+
+// DeleteAll deletes all items in the cache.
+func (c *Client) DeleteAll() error {
+	return c.FlushAll()
+}
+
+// FlushAll flushes all items in the cache of all servers.
+func (c *Client) FlushAll() error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	return convertError(c.client.FlushAll(ctx))
+}
+
+// Touch updates the expiry for the given key. The seconds parameter is either
+// a Unix timestamp or, if seconds is less than 1 month, the number of seconds
+// into the future at which time the item will expire. Zero means the item has
+// no expiration time. ErrCacheMiss is returned if the key is not in the cache.
+func (c *Client) Touch(key string, seconds int32) error {
+	if !legalKey(key) {
+		return ErrMalformedKey
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	return convertError(c.client.TouchWithExpiration(ctx, key, memcached.Expiration(seconds)))
+}
+
+// Increment atomically increments key by delta. The return value is
+// the new value after being incremented or an error. If the value
+// didn't exist in memcached the error is ErrCacheMiss. The value in
+// memcached must be a decimal number, or an error will be returned.
+// On 64-bit overflow, the new value wraps around.
+func (c *Client) Increment(key string, delta uint64) (uint64, error) {
+	return c.arithmetic(key, delta, c.client.Incr)
+}
+
+// Decrement atomically decrements key by delta. The return value is
+// the new value after being decremented or an error. If the value
+// didn't exist in memcached the error is ErrCacheMiss. The value in
+// memcached must be a decimal number, or an error will be returned.
+// On underflow, the new value is capped at zero and does not wrap
+// around.
+func (c *Client) Decrement(key string, delta uint64) (uint64, error) {
+	return c.arithmetic(key, delta, c.client.Decr)
+}
+
+func (c *Client) arithmetic(
+	key string, delta uint64, fn func(ctx context.Context, key string, delta uint64) (uint64, error),
+) (uint64, error) {
+	if !legalKey(key) {
+		return 0, ErrMalformedKey
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	value, err := fn(ctx, key, delta)
+	if err != nil {
+		return 0, convertError(err)
+	}
+
+	return value, nil
+}
+
+// Ping checks all servers are available.
+func (c *Client) Ping() error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	_, err := c.client.VersionAll(ctx)
+	return convertError(err)
+}
+
+func fromItem(item *memcached.Item) *Item {
+	return &Item{
+		Key:   item.Key,
+		Value: item.Value,
+		Flags: item.Flags,
+		casid: item.CAS,
+	}
+}
+
+// convertError converts the errors of the underlying client to the gomemcache
+// ones, the others are returned as is.
+func convertError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotStored):
+		return ErrNotStored
+	case errors.Is(err, memcached.ErrNotFound):
+		return ErrCacheMiss
+	case errors.Is(err, memcached.ErrExists):
+		return ErrCASConflict
+	case errors.Is(err, memcached.ErrNotStored):
+		return ErrNotStored
+	case errors.Is(err, memcached.ErrInvalidKey):
+		return ErrMalformedKey
+	case errors.Is(err, memcached.ErrServerError):
+		return ErrServerError
+	}
+
+	return err
+}
+
+// legalKey reports whether the key is valid for memcached: at most 250 bytes
+// and no whitespace or control characters.
+func legalKey(key string) bool {
+	if len(key) == 0 || len(key) > 250 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
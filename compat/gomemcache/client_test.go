@@ -0,0 +1,160 @@
+package gomemcache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeqown/memcached"
+	"github.com/yeqown/memcached/internal/testserver"
+)
+
+func newTestClient(t *testing.T) *Client {
+	srv, err := testserver.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = srv.Close() })
+
+	mc, err := New(srv.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = mc.Close() })
+
+	return mc
+}
+
+func Test_Client(t *testing.T) {
+	mc := newTestClient(t)
+	require.NoError(t, mc.Ping())
+
+	_, err := mc.Get("foo")
+	require.ErrorIs(t, err, ErrCacheMiss)
+
+	require.NoError(t, mc.Set(&Item{Key: "foo", Value: []byte("bar"), Flags: 7, Expiration: 60}))
+	require.ErrorIs(t, mc.Add(&Item{Key: "foo", Value: []byte("baz")}), ErrNotStored)
+	require.ErrorIs(t, mc.Replace(&Item{Key: "missing", Value: []byte("baz")}), ErrNotStored)
+	require.NoError(t, mc.Append(&Item{Key: "foo", Value: []byte("!")}))
+
+	item, err := mc.Get("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar!", string(item.Value))
+	assert.Equal(t, uint32(7), item.Flags)
+
+	// the item is modified after Get, so that the CompareAndSwap fails.
+	require.NoError(t, mc.Set(&Item{Key: "foo", Value: []byte("qux")}))
+	item.Value = []byte("cas")
+	require.ErrorIs(t, mc.CompareAndSwap(item), ErrCASConflict)
+
+	item, err = mc.Get("foo")
+	require.NoError(t, err)
+	item.Value = []byte("cas")
+	require.NoError(t, mc.CompareAndSwap(item))
+
+	require.NoError(t, mc.Delete("foo"))
+	require.ErrorIs(t, mc.CompareAndSwap(item), ErrNotStored)
+	require.ErrorIs(t, mc.Delete("foo"), ErrCacheMiss)
+	require.ErrorIs(t, mc.Touch("foo", 60), ErrCacheMiss)
+
+	require.NoError(t, mc.Set(&Item{Key: "counter", Value: []byte("10")}))
+	n, err := mc.Increment("counter", 5)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(15), n)
+	n, err = mc.Decrement("counter", 20)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), n)
+	_, err = mc.Increment("missing", 1)
+	require.ErrorIs(t, err, ErrCacheMiss)
+
+	require.NoError(t, mc.Touch("counter", 60))
+	require.NoError(t, mc.DeleteAll())
+	_, err = mc.Get("counter")
+	require.ErrorIs(t, err, ErrCacheMiss)
+}
+
+func Test_Client_GetMulti(t *testing.T) {
+	mc := newTestClient(t)
+
+	require.NoError(t, mc.Set(&Item{Key: "a", Value: []byte("1")}))
+	require.NoError(t, mc.Set(&Item{Key: "b", Value: []byte("2")}))
+
+	items, err := mc.GetMulti([]string{"a", "b", "missing"})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "1", string(items["a"].Value))
+	assert.Equal(t, "2", string(items["b"].Value))
+
+	items, err = mc.GetMulti(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, items)
+}
+
+func Test_Client_cluster(t *testing.T) {
+	var servers []*testserver.Server
+	for i := 0; i < 2; i++ {
+		srv, err := testserver.New()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = srv.Close() })
+		servers = append(servers, srv)
+	}
+
+	var (
+		mu       sync.Mutex
+		commands = make(map[string]int)
+	)
+	client, err := memcached.New(servers[0].Addr()+","+servers[1].Addr(),
+		memcached.WithRequestHook(func(_ context.Context, info *memcached.RequestInfo) {
+			mu.Lock()
+			commands[info.Command]++
+			mu.Unlock()
+		}))
+	require.NoError(t, err)
+	mc := NewFromClient(client)
+	t.Cleanup(func() { _ = mc.Close() })
+
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		require.NoError(t, mc.Set(&Item{Key: keys[i], Value: []byte(keys[i])}))
+	}
+
+	// the keys are read by one gets per server rather than one per key.
+	items, err := mc.GetMulti(append(keys, "missing"))
+	require.NoError(t, err)
+	require.Len(t, items, len(keys))
+	for _, key := range keys {
+		assert.Equal(t, key, string(items[key].Value))
+	}
+	mu.Lock()
+	assert.Equal(t, 2, commands["gets"])
+	mu.Unlock()
+
+	// ping checks every server rather than one of them.
+	require.NoError(t, mc.Ping())
+	servers[1].Stop()
+	require.Error(t, mc.Ping())
+}
+
+func Test_legalKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{name: "normal", key: "foo:bar", want: true},
+		{name: "max length", key: strings.Repeat("a", 250), want: true},
+		{name: "empty", key: "", want: false},
+		{name: "too long", key: strings.Repeat("a", 251), want: false},
+		{name: "space", key: "foo bar", want: false},
+		{name: "newline", key: "foo\n", want: false},
+		{name: "del", key: "foo\x7f", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, legalKey(tt.key))
+		})
+	}
+}
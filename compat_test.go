@@ -0,0 +1,180 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompatibilityDisablesMetaCommands(t *testing.T) {
+	c := &client{options: newClientOptions(), clientState: newClientState()}
+	WithCompatibility(CompatDragonfly)(c.options)
+
+	_, err := c.MetaGet(context.Background(), []byte("key"))
+	require.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.MetaSet(context.Background(), []byte("key"), []byte("value"))
+	require.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.MetaDelete(context.Background(), []byte("key"))
+	require.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.MetaArithmetic(context.Background(), []byte("key"), 1)
+	require.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.MetaDebug(context.Background(), []byte("key"))
+	require.ErrorIs(t, err, ErrNotSupported)
+	require.ErrorIs(t, c.MetaNoOp(context.Background()), ErrNotSupported)
+}
+
+func TestCompatibilityDisablesGetAndTouch(t *testing.T) {
+	c := &client{options: newClientOptions(), clientState: newClientState()}
+	WithCompatibility(CompatTwemproxy)(c.options)
+
+	_, err := c.GetAndTouch(context.Background(), time.Second, "key")
+	require.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.GetAndTouches(context.Background(), time.Second, "key1", "key2")
+	require.ErrorIs(t, err, ErrNotSupported)
+}
+
+func Test_forecastLenientFaultLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    []byte
+		wantErr error
+	}{
+		{
+			name:    "error with message",
+			line:    []byte("ERROR unknown command\r\n"),
+			wantErr: ErrNonexistentCommand,
+		},
+		{
+			name:    "error ends with LF",
+			line:    []byte("ERROR\n"),
+			wantErr: ErrNonexistentCommand,
+		},
+		{
+			name:    "client error without message",
+			line:    []byte("CLIENT_ERROR\r\n"),
+			wantErr: ErrClientError,
+		},
+		{
+			name:    "server error ends with LF",
+			line:    []byte("SERVER_ERROR out of memory\n"),
+			wantErr: ErrServerOOM,
+		},
+		{
+			name:    "not found ends with LF",
+			line:    []byte("NOT_FOUND\n"),
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "normal line",
+			line:    []byte("STORED\r\n"),
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := forecastLenientFaultLine(tt.line)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	// the bytes after the line must not be overwritten.
+	buf := []byte("NOT_FOUND\nEND\r\n")
+	_ = forecastLenientFaultLine(buf[:10])
+	assert.Equal(t, "NOT_FOUND\nEND\r\n", string(buf))
+}
+
+func TestCASParsing(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		wantErr bool
+	}{
+		{name: "auto", opts: nil, wantErr: true},
+		{name: "strict", opts: []ClientOption{WithCASParsing(CASParsingStrict)}, wantErr: true},
+		{name: "lenient", opts: []ClientOption{WithCASParsing(CASParsingLenient)}},
+		{name: "auto in dragonfly mode", opts: []ClientOption{WithCompatibility(CompatDragonfly)}},
+		{name: "strict in dragonfly mode", opts: []ClientOption{WithCompatibility(CompatDragonfly), WithCASParsing(CASParsingStrict)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+				if line, _ := rr.ReadString('\n'); line != "gets foo\r\n" {
+					return
+				}
+				_, _ = io.WriteString(w, "VALUE foo 0 3 18446744073709551616\r\nbar\r\nEND\r\n")
+			})
+
+			c, err := New(addr, append(tt.opts, WithCapabilityDetection(false), WithMaxConns(1))...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			items, err := c.Gets(context.Background(), "foo")
+			if tt.wantErr {
+				var casErr *CASParseError
+				require.ErrorAs(t, err, &casErr)
+				assert.Equal(t, "18446744073709551616", casErr.Token)
+				assert.ErrorIs(t, err, strconv.ErrRange)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, items, 1)
+			assert.Equal(t, []byte("bar"), items[0].Value)
+			assert.Zero(t, items[0].CAS)
+		})
+	}
+}
+
+func TestCASParsing_lenientNotWritable(t *testing.T) {
+	var written atomic.Int32
+	addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+		for {
+			line, err := rr.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "gets "):
+				_, _ = io.WriteString(w, "VALUE foo 0 3 18446744073709551616\r\nbar\r\nEND\r\n")
+			case strings.HasPrefix(line, "mg "):
+				_, _ = io.WriteString(w, "VA 3 c18446744073709551616 f0\r\nbar\r\n")
+			default:
+				written.Add(1)
+				_, _ = io.WriteString(w, "SERVER_ERROR unexpected\r\n")
+			}
+		}
+	})
+
+	c, err := New(addr, WithCASParsing(CASParsingLenient), WithCapabilityDetection(false), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	update := func(old []byte) ([]byte, error) { return append(old, '!'), nil }
+
+	err = c.Update(ctx, "foo", update)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.MetaUpdate(ctx, []byte("foo"), update)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	item, err := c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnCAS())
+	require.NoError(t, err)
+	require.Zero(t, item.CAS)
+	_, err = c.CasItem(ctx, "foo", []byte("baz"), 0, 0, item.CAS)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	assert.Zero(t, written.Load())
+}
@@ -0,0 +1,515 @@
+package memcached
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is the time.Duration of Config, it's encoded as the string of
+// time.ParseDuration in the config files and the environment variables, e.g. "1.5s".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return errors.Wrapf(ErrInvalidArgument, "duration %q", text)
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config is the alternative of the functional options which could be persisted,
+// e.g. loaded from a file by LoadConfig or from the environment by ApplyEnv. The
+// zero value of each field means the default of its option, so that only the
+// fields which are set are applied. The options which are not data, e.g. codecs,
+// hooks and dialers, are passed to New along with FromConfig:
+//
+//	cfg, err := memcached.LoadConfig("memcached.yaml")
+//	if err != nil {
+//		// handle error
+//	}
+//	client, err := memcached.NewFromConfig(cfg, memcached.WithCodec(codec))
+type Config struct {
+	// Addrs is the address of the memcached servers passed to New, e.g.
+	// "localhost:11211,localhost:11212".
+	Addrs string `json:"addrs" yaml:"addrs"`
+
+	// DialTimeout, ReadTimeout and WriteTimeout, see WithDialTimeout, WithReadTimeout
+	// and WithWriteTimeout.
+	DialTimeout  Duration `json:"dial_timeout" yaml:"dial_timeout"`
+	ReadTimeout  Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout" yaml:"write_timeout"`
+
+	// The connection pool, see WithMaxConns, WithMaxIdleConns, WithMaxLifetime,
+	// WithMaxIdleTimeout and WithPoolWaitTimeout.
+	MaxConns        int      `json:"max_conns" yaml:"max_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns" yaml:"max_idle_conns"`
+	MaxLifetime     Duration `json:"max_lifetime" yaml:"max_lifetime"`
+	MaxIdleTimeout  Duration `json:"max_idle_timeout" yaml:"max_idle_timeout"`
+	PoolWaitTimeout Duration `json:"pool_wait_timeout" yaml:"pool_wait_timeout"`
+	// WarmUpConns is the number of connections opened to each server when the client
+	// is created, see WithWarmUp.
+	WarmUpConns int `json:"warm_up_conns" yaml:"warm_up_conns"`
+	// EagerConnect connects to each server when the client is created, see WithEagerConnect.
+	EagerConnect bool `json:"eager_connect" yaml:"eager_connect"`
+	// PoolShards is the number of shards the pool of each server is striped over, see
+	// WithPoolShards.
+	PoolShards int `json:"pool_shards" yaml:"pool_shards"`
+
+	// HashStrategy is the picker of the servers, one of "crc32" (default), "murmur3",
+	// "rendezvous", "round_robin" and "weighted_random", murmur3 and rendezvous are
+	// seeded by HashSeed.
+	HashStrategy string `json:"hash_strategy" yaml:"hash_strategy"`
+	HashSeed     uint64 `json:"hash_seed" yaml:"hash_seed"`
+	// HashTag is the open and close delimiters of the hash tag, e.g. "{}", see WithHashTag.
+	HashTag string `json:"hash_tag" yaml:"hash_tag"`
+
+	// The load shedding, see WithMaxConcurrentRequests, WithConcurrencyWaitTimeout,
+	// WithRateLimit, WithGlobalRateLimit and WithRateLimitWait.
+	MaxConcurrentRequests  int      `json:"max_concurrent_requests" yaml:"max_concurrent_requests"`
+	ConcurrencyWaitTimeout Duration `json:"concurrency_wait_timeout" yaml:"concurrency_wait_timeout"`
+	RateLimit              float64  `json:"rate_limit" yaml:"rate_limit"`
+	RateBurst              int      `json:"rate_burst" yaml:"rate_burst"`
+	GlobalRateLimit        float64  `json:"global_rate_limit" yaml:"global_rate_limit"`
+	GlobalRateBurst        int      `json:"global_rate_burst" yaml:"global_rate_burst"`
+	RateLimitWait          bool     `json:"rate_limit_wait" yaml:"rate_limit_wait"`
+	// FailOpen makes the requests to the unavailable servers fail open, see WithFailOpen.
+	FailOpen bool `json:"fail_open" yaml:"fail_open"`
+
+	// HedgeDelay enables the hedged reads, see WithHedgedReads.
+	HedgeDelay Duration `json:"hedge_delay" yaml:"hedge_delay"`
+	// DeadlineBudgetShare and DeadlineBudgetMin split the deadline of the hedged
+	// reads between their attempts, see WithDeadlineBudget.
+	DeadlineBudgetShare float64  `json:"deadline_budget_share" yaml:"deadline_budget_share"`
+	DeadlineBudgetMin   Duration `json:"deadline_budget_min" yaml:"deadline_budget_min"`
+
+	// NoReply, UDP and Multiplexing, see WithNoReply, WithUDPEnabled and WithMultiplexing.
+	NoReply      bool `json:"no_reply" yaml:"no_reply"`
+	UDP          bool `json:"udp" yaml:"udp"`
+	Multiplexing int  `json:"multiplexing" yaml:"multiplexing"`
+	// WriteCoalesceWindow and WriteCoalesceMaxBatch coalesce the writes of the multiplexed
+	// requests, see WithWriteCoalescing. Either of them enables it.
+	WriteCoalesceWindow   Duration `json:"write_coalesce_window" yaml:"write_coalesce_window"`
+	WriteCoalesceMaxBatch int      `json:"write_coalesce_max_batch" yaml:"write_coalesce_max_batch"`
+
+	// The sockets and the connections, see WithTCPKeepAlive, WithTCPNoDelay,
+	// WithSocketBuffers and WithConnBufferSizes. The negative TCPKeepAlive disables it.
+	TCPKeepAlive      Duration `json:"tcp_keep_alive" yaml:"tcp_keep_alive"`
+	TCPNoDelay        *bool    `json:"tcp_no_delay" yaml:"tcp_no_delay"`
+	SocketReadBuffer  int      `json:"socket_read_buffer" yaml:"socket_read_buffer"`
+	SocketWriteBuffer int      `json:"socket_write_buffer" yaml:"socket_write_buffer"`
+	ConnReaderSize    int      `json:"conn_reader_size" yaml:"conn_reader_size"`
+	ConnWriterSize    int      `json:"conn_writer_size" yaml:"conn_writer_size"`
+	// StaleConnReplay replays the idempotent requests failed by the stale pooled
+	// connections, it's enabled if unset, see WithStaleConnReplay.
+	StaleConnReplay *bool `json:"stale_conn_replay" yaml:"stale_conn_replay"`
+	// LivenessCheckIdle enables the liveness check of the connections idle longer
+	// than it by LivenessProbe, one of "poll" (default) and "noop", see WithLivenessCheck.
+	LivenessCheckIdle Duration `json:"liveness_check_idle" yaml:"liveness_check_idle"`
+	LivenessProbe     string   `json:"liveness_probe" yaml:"liveness_probe"`
+
+	// SASLUsername and SASLPassword enable the SASL authentication, see WithSASL.
+	SASLUsername string `json:"sasl_username" yaml:"sasl_username"`
+	SASLPassword string `json:"sasl_password" yaml:"sasl_password"`
+
+	// Compatibility is the server behind the client, one of "memcached" (default),
+	// "dragonfly" and "twemproxy", see WithCompatibility.
+	Compatibility string `json:"compatibility" yaml:"compatibility"`
+	// CASParsing is how the CAS uniques are parsed, one of "auto" (default), "strict"
+	// and "lenient", see WithCASParsing.
+	CASParsing          string `json:"cas_parsing" yaml:"cas_parsing"`
+	GetAndTouchFallback bool   `json:"get_and_touch_fallback" yaml:"get_and_touch_fallback"`
+	CapabilityDetection *bool  `json:"capability_detection" yaml:"capability_detection"`
+	// MultiKeyMaxKeys and MultiKeyMaxBytes bound the keys of each request of the
+	// multi-key retrievals, 0 keeps the defaults, see WithMultiKeyLimits.
+	MultiKeyMaxKeys  int `json:"multi_key_max_keys" yaml:"multi_key_max_keys"`
+	MultiKeyMaxBytes int `json:"multi_key_max_bytes" yaml:"multi_key_max_bytes"`
+	// MaxItemSize is the max item size in bytes, -1 detects it from each server, see
+	// WithMaxItemSize.
+	MaxItemSize int `json:"max_item_size" yaml:"max_item_size"`
+	// AutoTune configures the guards by the settings of each server, see WithAutoTune.
+	AutoTune bool `json:"auto_tune" yaml:"auto_tune"`
+	// ProtocolErrorCapture is the number of the last malformed responses kept, see
+	// WithProtocolErrorCapture.
+	ProtocolErrorCapture int `json:"protocol_error_capture" yaml:"protocol_error_capture"`
+
+	// Checksum is the checksum of the values, one of "none" (default), "crc32" and
+	// "xxhash", see WithChecksum.
+	Checksum string `json:"checksum" yaml:"checksum"`
+	// ProxyProtocol is the version of the PROXY header, one of "none" (default), "v1"
+	// and "v2", see WithProxyProtocol.
+	ProxyProtocol string `json:"proxy_protocol" yaml:"proxy_protocol"`
+}
+
+// LoadConfig reads the Config from the file at path, the file is in JSON or YAML
+// format by its extension (.json, .yaml or .yml). The Config is not validated.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read config file")
+	}
+
+	cfg := &Config{}
+	if err = unmarshalByExt(path, data, cfg); err != nil {
+		return nil, errors.Wrapf(err, "parse config file %s", path)
+	}
+
+	return cfg, nil
+}
+
+// unmarshalByExt unmarshals the content of the file at path into v, the file
+// is in JSON or YAML format by its extension.
+func unmarshalByExt(path string, data []byte, v any) error {
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, v)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, v)
+	default:
+		return errors.Wrapf(ErrInvalidArgument, "unknown file format %q", ext)
+	}
+	if err != nil {
+		return errors.Wrap(ErrInvalidArgument, err.Error())
+	}
+
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// ApplyEnv overrides the fields of the Config by the environment variables named
+// by prefix and the upper case of their JSON names, e.g. MEMCACHED_DIAL_TIMEOUT
+// for DialTimeout with the prefix "MEMCACHED_". The variables which are not set
+// are skipped, so that the environment could override a file loaded by LoadConfig.
+func (cfg *Config) ApplyEnv(prefix string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		key := prefix + strings.ToUpper(name)
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+
+		if err := setEnvField(v.Field(i), value); err != nil {
+			return errors.Wrapf(ErrInvalidArgument, "environment variable %s=%q", key, value)
+		}
+	}
+
+	return nil
+}
+
+// setEnvField sets the field of Config by the value of its environment variable.
+func setEnvField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		var d Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Pointer:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(&b))
+	default:
+		return errors.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
+
+// Validate checks the Config could create a client, the errors are ErrInvalidAddress
+// or ErrInvalidArgument.
+func (cfg *Config) Validate() error {
+	if strings.TrimSpace(cfg.Addrs) == "" {
+		return errors.Wrap(ErrInvalidAddress, "empty address")
+	}
+
+	_, err := cfg.options()
+	return err
+}
+
+// options converts the Config into the functional options, the fields which
+// are not set are skipped.
+func (cfg *Config) options() ([]ClientOption, error) {
+	durations := []struct {
+		name string
+		d    Duration
+	}{
+		{"dial_timeout", cfg.DialTimeout}, {"read_timeout", cfg.ReadTimeout}, {"write_timeout", cfg.WriteTimeout},
+		{"max_lifetime", cfg.MaxLifetime}, {"max_idle_timeout", cfg.MaxIdleTimeout},
+		{"pool_wait_timeout", cfg.PoolWaitTimeout}, {"concurrency_wait_timeout", cfg.ConcurrencyWaitTimeout},
+		{"hedge_delay", cfg.HedgeDelay}, {"deadline_budget_min", cfg.DeadlineBudgetMin},
+		{"write_coalesce_window", cfg.WriteCoalesceWindow},
+	}
+	for _, f := range durations {
+		if f.d < 0 {
+			return nil, errors.Wrapf(ErrInvalidArgument, "negative %s", f.name)
+		}
+	}
+	numbers := []struct {
+		name string
+		n    int
+	}{
+		{"max_conns", cfg.MaxConns}, {"max_idle_conns", cfg.MaxIdleConns},
+		{"max_concurrent_requests", cfg.MaxConcurrentRequests}, {"rate_burst", cfg.RateBurst},
+		{"global_rate_burst", cfg.GlobalRateBurst}, {"multiplexing", cfg.Multiplexing},
+		{"socket_read_buffer", cfg.SocketReadBuffer}, {"socket_write_buffer", cfg.SocketWriteBuffer},
+		{"conn_reader_size", cfg.ConnReaderSize}, {"conn_writer_size", cfg.ConnWriterSize},
+		{"write_coalesce_max_batch", cfg.WriteCoalesceMaxBatch},
+		{"protocol_error_capture", cfg.ProtocolErrorCapture},
+	}
+	for _, f := range numbers {
+		if f.n < 0 {
+			return nil, errors.Wrapf(ErrInvalidArgument, "negative %s", f.name)
+		}
+	}
+	if cfg.MaxItemSize < DetectMaxItemSize {
+		return nil, errors.Wrapf(ErrInvalidArgument, "max_item_size %d", cfg.MaxItemSize)
+	}
+	if cfg.DeadlineBudgetShare < 0 || cfg.DeadlineBudgetShare >= 1 {
+		return nil, errors.Wrapf(ErrInvalidArgument, "deadline_budget_share %v", cfg.DeadlineBudgetShare)
+	}
+	if cfg.RateLimit < 0 || cfg.GlobalRateLimit < 0 {
+		return nil, errors.Wrap(ErrInvalidArgument, "negative rate limit")
+	}
+	if cfg.Multiplexing > 0 && (cfg.UDP || cfg.NoReply) {
+		return nil, errors.Wrap(ErrInvalidArgument, "multiplexing mode does not support UDP or noreply")
+	}
+
+	opts := make([]ClientOption, 0, 16)
+	add := func(ok bool, opt ClientOption) {
+		if ok {
+			opts = append(opts, opt)
+		}
+	}
+
+	switch cfg.HashStrategy {
+	case "", "crc32":
+	case "murmur3":
+		opts = append(opts, WithPickBuilder(NewMurmur3HashPickBuilder(cfg.HashSeed)))
+	case "rendezvous":
+		opts = append(opts, WithPickBuilder(NewRendezvousHashPickBuilder(cfg.HashSeed)))
+	case "round_robin":
+		opts = append(opts, WithPickBuilder(NewRoundRobinPickBuilder()))
+	case "weighted_random":
+		opts = append(opts, WithPickBuilder(NewWeightedRandomPickBuilder()))
+	default:
+		return nil, errors.Wrapf(ErrInvalidArgument, "unknown hash strategy %q", cfg.HashStrategy)
+	}
+	switch len(cfg.HashTag) {
+	case 0:
+	case 2:
+		opts = append(opts, WithHashTag(cfg.HashTag[0], cfg.HashTag[1]))
+	default:
+		return nil, errors.Wrapf(ErrInvalidArgument, "hash tag %q must be the open and close delimiters", cfg.HashTag)
+	}
+
+	compatibility, err := parseCompatibility(cfg.Compatibility)
+	if err != nil {
+		return nil, err
+	}
+	add(cfg.Compatibility != "", WithCompatibility(compatibility))
+
+	casParsing, err := parseCASParsing(cfg.CASParsing)
+	if err != nil {
+		return nil, err
+	}
+	add(cfg.CASParsing != "", WithCASParsing(casParsing))
+
+	checksum := ChecksumNone
+	switch cfg.Checksum {
+	case "", "none":
+	case "crc32":
+		checksum = ChecksumCRC32
+	case "xxhash":
+		checksum = ChecksumXXHash
+	default:
+		return nil, errors.Wrapf(ErrInvalidArgument, "unknown checksum %q", cfg.Checksum)
+	}
+	add(checksum != ChecksumNone, WithChecksum(checksum))
+
+	proxyProtocol := ProxyProtocolNone
+	switch cfg.ProxyProtocol {
+	case "", "none":
+	case "v1":
+		proxyProtocol = ProxyProtocolV1
+	case "v2":
+		proxyProtocol = ProxyProtocolV2
+	default:
+		return nil, errors.Wrapf(ErrInvalidArgument, "unknown proxy protocol %q", cfg.ProxyProtocol)
+	}
+	add(proxyProtocol != ProxyProtocolNone, WithProxyProtocol(proxyProtocol, nil))
+
+	probe := ProbePoll
+	switch cfg.LivenessProbe {
+	case "", "poll":
+	case "noop":
+		probe = ProbeNoOp
+	default:
+		return nil, errors.Wrapf(ErrInvalidArgument, "unknown liveness probe %q", cfg.LivenessProbe)
+	}
+	add(cfg.LivenessCheckIdle > 0, WithLivenessCheck(time.Duration(cfg.LivenessCheckIdle), probe))
+
+	add(cfg.DialTimeout > 0, WithDialTimeout(time.Duration(cfg.DialTimeout)))
+	add(cfg.ReadTimeout > 0, WithReadTimeout(time.Duration(cfg.ReadTimeout)))
+	add(cfg.WriteTimeout > 0, WithWriteTimeout(time.Duration(cfg.WriteTimeout)))
+
+	add(cfg.MaxConns > 0, WithMaxConns(cfg.MaxConns))
+	add(cfg.MaxIdleConns > 0, WithMaxIdleConns(cfg.MaxIdleConns))
+	add(cfg.MaxLifetime > 0, WithMaxLifetime(time.Duration(cfg.MaxLifetime)))
+	add(cfg.MaxIdleTimeout > 0, WithMaxIdleTimeout(time.Duration(cfg.MaxIdleTimeout)))
+	add(cfg.PoolWaitTimeout > 0, WithPoolWaitTimeout(time.Duration(cfg.PoolWaitTimeout)))
+	add(cfg.PoolShards > 1, WithPoolShards(cfg.PoolShards))
+	add(cfg.WarmUpConns > 0, WithWarmUp(cfg.WarmUpConns))
+	add(cfg.EagerConnect, WithEagerConnect())
+
+	add(cfg.MaxConcurrentRequests > 0, WithMaxConcurrentRequests(cfg.MaxConcurrentRequests))
+	add(cfg.ConcurrencyWaitTimeout > 0, WithConcurrencyWaitTimeout(time.Duration(cfg.ConcurrencyWaitTimeout)))
+	add(cfg.RateLimit > 0, WithRateLimit(cfg.RateLimit, cfg.RateBurst))
+	add(cfg.GlobalRateLimit > 0, WithGlobalRateLimit(cfg.GlobalRateLimit, cfg.GlobalRateBurst))
+	add(cfg.RateLimitWait, WithRateLimitWait(true))
+	add(cfg.FailOpen, WithFailOpen())
+	add(cfg.HedgeDelay > 0, WithHedgedReads(time.Duration(cfg.HedgeDelay)))
+	add(cfg.DeadlineBudgetShare > 0,
+		WithDeadlineBudget(cfg.DeadlineBudgetShare, time.Duration(cfg.DeadlineBudgetMin)))
+
+	add(cfg.NoReply, WithNoReply())
+	add(cfg.UDP, WithUDPEnabled())
+	add(cfg.Multiplexing > 0, WithMultiplexing(cfg.Multiplexing))
+	add(cfg.WriteCoalesceWindow > 0 || cfg.WriteCoalesceMaxBatch > 0,
+		WithWriteCoalescing(time.Duration(cfg.WriteCoalesceWindow), cfg.WriteCoalesceMaxBatch))
+
+	add(cfg.TCPKeepAlive != 0, WithTCPKeepAlive(time.Duration(cfg.TCPKeepAlive)))
+	add(cfg.TCPNoDelay != nil, WithTCPNoDelay(cfg.TCPNoDelay != nil && *cfg.TCPNoDelay))
+	add(cfg.SocketReadBuffer > 0 || cfg.SocketWriteBuffer > 0,
+		WithSocketBuffers(cfg.SocketReadBuffer, cfg.SocketWriteBuffer))
+	add(cfg.ConnReaderSize > 0 || cfg.ConnWriterSize > 0,
+		WithConnBufferSizes(cfg.ConnReaderSize, cfg.ConnWriterSize))
+	add(cfg.StaleConnReplay != nil,
+		WithStaleConnReplay(cfg.StaleConnReplay != nil && *cfg.StaleConnReplay))
+
+	add(cfg.SASLUsername != "", WithSASL(cfg.SASLUsername, cfg.SASLPassword))
+	add(cfg.GetAndTouchFallback, WithGetAndTouchFallback(true))
+	if cfg.MultiKeyMaxKeys > 0 || cfg.MultiKeyMaxBytes > 0 {
+		maxBytes := cfg.MultiKeyMaxBytes
+		if maxBytes <= 0 {
+			maxBytes = defaultMultiKeyMaxBytes
+		}
+		opts = append(opts, WithMultiKeyLimits(cfg.MultiKeyMaxKeys, maxBytes))
+	}
+	add(cfg.CapabilityDetection != nil,
+		WithCapabilityDetection(cfg.CapabilityDetection != nil && *cfg.CapabilityDetection))
+	add(cfg.MaxItemSize != 0, WithMaxItemSize(cfg.MaxItemSize))
+	add(cfg.ProtocolErrorCapture > 0, WithProtocolErrorCapture(cfg.ProtocolErrorCapture))
+	add(cfg.AutoTune, WithAutoTune())
+
+	return opts, nil
+}
+
+// parseCompatibility parses the Compatibility by its name, empty means CompatMemcached.
+func parseCompatibility(name string) (Compatibility, error) {
+	if name == "" {
+		return CompatMemcached, nil
+	}
+
+	for _, mode := range []Compatibility{CompatMemcached, CompatDragonfly, CompatTwemproxy} {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+
+	return CompatMemcached, errors.Wrapf(ErrInvalidArgument, "unknown compatibility %q", name)
+}
+
+// parseCASParsing parses the CASParsing by its name, empty means CASParsingAuto.
+func parseCASParsing(name string) (CASParsing, error) {
+	if name == "" {
+		return CASParsingAuto, nil
+	}
+
+	for _, mode := range []CASParsing{CASParsingAuto, CASParsingStrict, CASParsingLenient} {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+
+	return CASParsingAuto, errors.Wrapf(ErrInvalidArgument, "unknown CAS parsing %q", name)
+}
+
+// FromConfig applies the fields of the Config which are set as the options, the
+// Addrs is ignored, see NewFromConfig. The client fails to be created by New if
+// the Config is invalid.
+func FromConfig(cfg *Config) ClientOption {
+	return func(o *clientOptions) {
+		opts, err := cfg.options()
+		if err != nil {
+			o.configErr = err
+			return
+		}
+
+		for _, opt := range opts {
+			opt(o)
+		}
+	}
+}
+
+// NewFromConfig validates the Config and creates a client to its Addrs, the
+// options are applied after the Config.
+func NewFromConfig(cfg *Config, opts ...ClientOption) (Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return New(cfg.Addrs, append([]ClientOption{FromConfig(cfg)}, opts...)...)
+}
@@ -0,0 +1,198 @@
+package memcached
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	noDelay := false
+	want := &Config{
+		Addrs:        "localhost:11211,localhost:11212",
+		DialTimeout:  Duration(time.Second),
+		ReadTimeout:  Duration(1500 * time.Millisecond),
+		MaxConns:     20,
+		HashStrategy: "rendezvous",
+		HashSeed:     42,
+		TCPNoDelay:   &noDelay,
+		Checksum:     "crc32",
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr error
+	}{
+		{
+			name: "json",
+			file: "memcached.json",
+			content: `{"addrs": "localhost:11211,localhost:11212", "dial_timeout": "1s", "read_timeout": "1.5s",
+				"max_conns": 20, "hash_strategy": "rendezvous", "hash_seed": 42, "tcp_no_delay": false, "checksum": "crc32"}`,
+		},
+		{
+			name: "yaml",
+			file: "memcached.yaml",
+			content: `
+addrs: localhost:11211,localhost:11212
+dial_timeout: 1s
+read_timeout: 1.5s
+max_conns: 20
+hash_strategy: rendezvous
+hash_seed: 42
+tcp_no_delay: false
+checksum: crc32
+`,
+		},
+		{
+			name:    "invalid duration",
+			file:    "memcached.json",
+			content: `{"dial_timeout": "1 second"}`,
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "unknown format",
+			file:    "memcached.toml",
+			content: `addrs = "localhost:11211"`,
+			wantErr: ErrInvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			cfg, err := LoadConfig(path)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, want, cfg)
+		})
+	}
+}
+
+func Test_Config_ApplyEnv(t *testing.T) {
+	t.Setenv("MC_ADDRS", "localhost:11213")
+	t.Setenv("MC_WRITE_TIMEOUT", "250ms")
+	t.Setenv("MC_RATE_LIMIT", "100.5")
+	t.Setenv("MC_NO_REPLY", "true")
+	t.Setenv("MC_CAPABILITY_DETECTION", "false")
+
+	cfg := &Config{Addrs: "localhost:11211", MaxConns: 20}
+	require.NoError(t, cfg.ApplyEnv("MC_"))
+
+	detection := false
+	assert.Equal(t, &Config{
+		Addrs:               "localhost:11213",
+		WriteTimeout:        Duration(250 * time.Millisecond),
+		MaxConns:            20,
+		RateLimit:           100.5,
+		NoReply:             true,
+		CapabilityDetection: &detection,
+	}, cfg)
+
+	t.Setenv("MC_MAX_CONNS", "many")
+	require.ErrorIs(t, cfg.ApplyEnv("MC_"), ErrInvalidArgument)
+}
+
+func Test_Config_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr error
+	}{
+		{name: "valid", cfg: &Config{Addrs: "localhost:11211", HashStrategy: "murmur3", Compatibility: "dragonfly"}},
+		{name: "empty address", cfg: &Config{}, wantErr: ErrInvalidAddress},
+		{name: "negative timeout", cfg: &Config{Addrs: "localhost:11211", ReadTimeout: -1}, wantErr: ErrInvalidArgument},
+		{name: "negative max conns", cfg: &Config{Addrs: "localhost:11211", MaxConns: -1}, wantErr: ErrInvalidArgument},
+		{name: "unknown hash", cfg: &Config{Addrs: "localhost:11211", HashStrategy: "md5"}, wantErr: ErrInvalidArgument},
+		{name: "invalid hash tag", cfg: &Config{Addrs: "localhost:11211", HashTag: "{"}, wantErr: ErrInvalidArgument},
+		{
+			name:    "unknown compatibility",
+			cfg:     &Config{Addrs: "localhost:11211", Compatibility: "redis"},
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "unknown CAS parsing",
+			cfg:     &Config{Addrs: "localhost:11211", CASParsing: "loose"},
+			wantErr: ErrInvalidArgument,
+		},
+		{name: "invalid max item size", cfg: &Config{Addrs: "localhost:11211", MaxItemSize: -2}, wantErr: ErrInvalidArgument},
+		{
+			name:    "invalid deadline budget share",
+			cfg:     &Config{Addrs: "localhost:11211", DeadlineBudgetShare: 1.5},
+			wantErr: ErrInvalidArgument,
+		},
+		{name: "unknown checksum", cfg: &Config{Addrs: "localhost:11211", Checksum: "md5"}, wantErr: ErrInvalidArgument},
+		{
+			name:    "unknown proxy protocol",
+			cfg:     &Config{Addrs: "localhost:11211", ProxyProtocol: "v3"},
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "multiplexing with noreply",
+			cfg:     &Config{Addrs: "localhost:11211", Multiplexing: 2, NoReply: true},
+			wantErr: ErrInvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_NewFromConfig(t *testing.T) {
+	srv := newTestServer(t)
+	detection := false
+	cfg := &Config{
+		Addrs:               srv.Addr(),
+		ReadTimeout:         Duration(time.Second),
+		MaxConns:            7,
+		MaxIdleConns:        3,
+		HashTag:             "{}",
+		TCPKeepAlive:        -1,
+		Compatibility:       "twemproxy",
+		CASParsing:          "lenient",
+		CapabilityDetection: &detection,
+	}
+
+	c, err := NewFromConfig(cfg, WithMaxIdleConns(2))
+	require.NoError(t, err)
+	defer c.Close()
+
+	o := c.(*client).options
+	assert.Equal(t, time.Second, o.readTimeout)
+	assert.Equal(t, 3*time.Second, o.dialTimeout)
+	assert.Equal(t, 7, o.maxConns)
+	// the options passed to NewFromConfig are applied after the Config.
+	assert.Equal(t, 2, o.maxIdleConns)
+	assert.Equal(t, &[2]byte{'{', '}'}, o.hashTag)
+	assert.Negative(t, o.tcpKeepAlive)
+	assert.Equal(t, CompatTwemproxy, o.compatibility)
+	assert.Equal(t, CASParsingLenient, o.casParsing)
+	assert.False(t, o.capabilityDetection)
+
+	require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+
+	_, err = New(srv.Addr(), FromConfig(&Config{MaxConns: -1}))
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = NewFromConfig(&Config{})
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
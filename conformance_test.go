@@ -0,0 +1,448 @@
+//go:build conformance
+
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The conformance tests run every implemented command against internal/testserver,
+// and compare the bytes on the wire with the golden files in testdata/conformance,
+// so that the regressions of the request format or the response parsing are
+// caught, e.g. the malformed response of touch. They're guarded by the build tag:
+//
+//	go test -tags conformance -run TestConformance .
+//
+// The golden files are recorded against the testserver, and updated by the -update
+// flag. MEMCACHED_ADDR runs them against a real memcached instead, which replies
+// some commands differently, e.g. the flags returned on miss, so that the diffs
+// are the places the testserver departs from memcached rather than regressions.
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the conformance tests")
+
+// conformanceAddr returns the address of the memcached server given by
+// MEMCACHED_ADDR, or starts a testserver if it's not set.
+func conformanceAddr(t *testing.T) string {
+	if addr := os.Getenv("MEMCACHED_ADDR"); addr != "" {
+		return addr
+	}
+
+	return newTestServer(t).Addr()
+}
+
+type conformanceCase struct {
+	name string
+	opts []ClientOption
+	// setup prepares the items by an unrecorded client, and returns the CAS
+	// unique of the key "foo" if it exists.
+	setup func(t *testing.T, ctx context.Context, c Client) uint64
+	run   func(ctx context.Context, c Client, cas uint64) error
+	// wantErr is the error of run, nil means succeeded.
+	wantErr error
+}
+
+// setFoo stores the key "foo" with value "bar".
+func setFoo(t *testing.T, ctx context.Context, c Client) uint64 {
+	item, err := c.MetaSet(ctx, []byte("foo"), []byte("bar"), MetaSetFlagReturnCAS())
+	require.NoError(t, err)
+	return item.CAS
+}
+
+// setCounter stores the key "foo" with value "10".
+func setCounter(t *testing.T, ctx context.Context, c Client) uint64 {
+	require.NoError(t, c.Set(ctx, "foo", []byte("10"), 0, 0))
+	return 0
+}
+
+func conformanceCases() []conformanceCase {
+	ignore := func(_ *MetaItem, err error) error { return err }
+
+	return []conformanceCase{
+		// storage commands
+		{name: "set", run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Set(ctx, "foo", []byte("bar"), 1, time.Minute)
+		}},
+		{name: "set noreply", opts: []ClientOption{WithNoReply()}, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Set(ctx, "foo", []byte("bar"), 0, 0)
+		}},
+		{name: "add", run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Add(ctx, "foo", []byte("bar"), 0, 0)
+		}},
+		{name: "add existing", setup: setFoo, wantErr: ErrNotStored, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Add(ctx, "foo", []byte("baz"), 0, 0)
+		}},
+		{name: "replace", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Replace(ctx, "foo", []byte("baz"), 0, 0)
+		}},
+		{name: "replace missing", wantErr: ErrNotStored, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Replace(ctx, "foo", []byte("baz"), 0, 0)
+		}},
+		{name: "append", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Append(ctx, "foo", []byte("baz"), 0, 0)
+		}},
+		{name: "prepend", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Prepend(ctx, "foo", []byte("baz"), 0, 0)
+		}},
+		{name: "cas", setup: setFoo, run: func(ctx context.Context, c Client, cas uint64) error {
+			return c.Cas(ctx, "foo", []byte("baz"), 0, 0, cas)
+		}},
+		{name: "cas mismatched", setup: setFoo, wantErr: ErrExists, run: func(ctx context.Context, c Client, cas uint64) error {
+			return c.Cas(ctx, "foo", []byte("baz"), 0, 0, cas+1)
+		}},
+		{name: "cas missing", wantErr: ErrNotFound, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Cas(ctx, "foo", []byte("baz"), 0, 0, 1)
+		}},
+		{name: "set item", run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.SetItem(ctx, "foo", []byte("bar"), 1, time.Minute))
+		}},
+		{name: "append item", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.AppendItem(ctx, "foo", []byte("baz")))
+		}},
+
+		// retrieval commands
+		{name: "get", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.Get(ctx, "foo")
+			return err
+		}},
+		{name: "get missing", wantErr: ErrNotFound, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.Get(ctx, "foo")
+			return err
+		}},
+		{name: "gets", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.Gets(ctx, "foo", "missing")
+			return err
+		}},
+		{name: "gat", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.GetAndTouch(ctx, time.Minute, "foo")
+			return err
+		}},
+		{name: "gats", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.GetAndTouches(ctx, time.Minute, "foo", "missing")
+			return err
+		}},
+
+		// other commands
+		{name: "delete", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Delete(ctx, "foo")
+		}},
+		{name: "delete missing", wantErr: ErrNotFound, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Delete(ctx, "foo")
+		}},
+		{name: "delete cas", setup: setFoo, run: func(ctx context.Context, c Client, cas uint64) error {
+			return c.DeleteCAS(ctx, "foo", cas)
+		}},
+		{name: "incr", setup: setCounter, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.Incr(ctx, "foo", 5)
+			return err
+		}},
+		{name: "decr", setup: setCounter, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.Decr(ctx, "foo", 20)
+			return err
+		}},
+		{name: "incr missing", wantErr: ErrNotFound, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.Incr(ctx, "foo", 1)
+			return err
+		}},
+		{name: "incr non-numeric", setup: setFoo, wantErr: ErrNonNumericValue, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.Incr(ctx, "foo", 1)
+			return err
+		}},
+		{name: "touch", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Touch(ctx, "foo", time.Minute)
+		}},
+		{name: "touch missing", wantErr: ErrNotFound, run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.Touch(ctx, "foo", time.Minute)
+		}},
+		{name: "version", run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.Version(ctx)
+			return err
+		}},
+		{name: "flush_all", run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.FlushAll(ctx)
+		}},
+
+		// meta commands
+		{name: "mg all flags", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaGet(ctx, []byte("foo"),
+				MetaGetFlagReturnValue(), MetaGetFlagReturnCAS(), MetaGetFlagReturnClientFlags(),
+				MetaGetFlagReturnHitBefore(), MetaGetFlagReturnKey(), MetaGetFlagReturnLastAccessedTime(),
+				MetaGetFlagOpaque(7), MetaGetFlagReturnSize(), MetaGetFlagReturnTTL()))
+		}},
+		{name: "mg without value", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnSize(), MetaGetFlagDontBumpLRU()))
+		}},
+		{name: "mg missing", wantErr: ErrNotFound, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnValue()))
+		}},
+		{name: "mg quiet missing", run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnValue(), MetaGetFlagNoReply()))
+		}},
+		{name: "mg binary key", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaGet(ctx, []byte("foo"), MetaGetFlagBinaryKey(), MetaGetFlagReturnKey()))
+		}},
+		{name: "mg update ttl", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaGet(ctx, []byte("foo"), MetaGetFlagUpdateRemainingTTL(60), MetaGetFlagReturnTTL()))
+		}},
+		{name: "mg vivify on miss", run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaGet(ctx, []byte("foo"), MetaGetFlagVivifyOnMiss(30), MetaGetFlagReturnValue()))
+		}},
+		{name: "ms flags", run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaSet(ctx, []byte("foo"), []byte("bar"),
+				MetaSetFlagClientFlags(3), MetaSetFlagTTL(60), MetaSetFlagReturnCAS(),
+				MetaSetFlagReturnKey(), MetaSetFlagOpaque(9)))
+		}},
+		{name: "ms quiet", run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaSet(ctx, []byte("foo"), []byte("bar"), MetaSetFlagNoReply()))
+		}},
+		{name: "ms compare cas", setup: setFoo, wantErr: ErrExists, run: func(ctx context.Context, c Client, cas uint64) error {
+			return ignore(c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagCompareCAS(cas+1)))
+		}},
+		{name: "ms mode add", setup: setFoo, wantErr: ErrNotStored, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagModeSwitch(MetaSetModeAdd)))
+		}},
+		{name: "ms mode replace", wantErr: ErrNotStored, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagModeSwitch(MetaSetModeReplace)))
+		}},
+		{name: "ms mode append", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagModeSwitch(MetaSetModeAppend)))
+		}},
+		{name: "ms mode prepend", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagModeSwitch(MetaSetModePrepend)))
+		}},
+		{name: "md", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaDelete(ctx, []byte("foo"), MetaDeleteFlagReturnKey(), MetaDeleteFlagOpaque(5)))
+		}},
+		{name: "md missing", wantErr: ErrNotFound, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaDelete(ctx, []byte("foo")))
+		}},
+		{name: "md invalidate", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaDelete(ctx, []byte("foo"), MetaDeleteFlagInvalidate(), MetaDeleteFlagUpdateTTL(30)))
+		}},
+		{name: "ma incr", setup: setCounter, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaArithmetic(ctx, []byte("foo"), 5, MetaArithmeticFlagReturnValue()))
+		}},
+		{name: "ma decr", setup: setCounter, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaArithmetic(ctx, []byte("foo"), 5,
+				MetaArithmeticFlagModeSwitch(MetaArithmeticModeDecr), MetaArithmeticFlagReturnValue()))
+		}},
+		{name: "ma auto create", run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaArithmetic(ctx, []byte("foo"), 5, MetaArithmeticFlagAutoCreate(60),
+				MetaArithmeticFlagInitialValue(100), MetaArithmeticFlagReturnValue(), MetaArithmeticFlagReturnTTL()))
+		}},
+		{name: "ma missing", wantErr: ErrNotFound, run: func(ctx context.Context, c Client, _ uint64) error {
+			return ignore(c.MetaArithmetic(ctx, []byte("foo"), 1))
+		}},
+		{name: "me", setup: setFoo, run: func(ctx context.Context, c Client, _ uint64) error {
+			_, err := c.MetaDebug(ctx, []byte("foo"))
+			return err
+		}},
+		{name: "mn", run: func(ctx context.Context, c Client, _ uint64) error {
+			return c.MetaNoOp(ctx)
+		}},
+	}
+}
+
+func TestConformance(t *testing.T) {
+	ctx := context.Background()
+	addr := conformanceAddr(t)
+
+	plain, err := New(addr)
+	require.NoError(t, err)
+	defer plain.Close()
+
+	for _, tt := range conformanceCases() {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, plain.FlushAll(ctx))
+			var cas uint64
+			if tt.setup != nil {
+				cas = tt.setup(t, ctx, plain)
+			}
+
+			rec := newWireRecorder(t, addr)
+			opts := append([]ClientOption{WithMaxConns(1), WithCapabilityDetection(false)}, tt.opts...)
+			c, err := New(rec.Addr(), opts...)
+			require.NoError(t, err)
+
+			err = tt.run(ctx, c, cas)
+			require.NoError(t, c.Close())
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			got := rec.transcript()
+			path := filepath.Join("testdata", "conformance", strings.ReplaceAll(tt.name, " ", "_")+".golden")
+			if *updateGolden {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			require.NoError(t, err, "run with -update to create the golden file")
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
+
+// wireRecorder is a proxy to the memcached server which records the bytes on
+// the wire of the only connection it accepts.
+type wireRecorder struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu     sync.Mutex // guards following
+	conns  []net.Conn
+	chunks []wireChunk
+}
+
+// wireChunk is the bytes sent in one direction, ">" for the requests and "<"
+// for the responses.
+type wireChunk struct {
+	dir  string
+	data []byte
+}
+
+func newWireRecorder(t *testing.T, addr string) *wireRecorder {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	r := &wireRecorder{ln: ln}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		cn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		upstream, err := net.Dial("tcp", addr)
+		if err != nil {
+			_ = cn.Close()
+			return
+		}
+
+		r.mu.Lock()
+		r.conns = append(r.conns, cn, upstream)
+		r.mu.Unlock()
+
+		r.wg.Add(2)
+		go r.forward(">", upstream, cn)
+		go r.forward("<", cn, upstream)
+	}()
+
+	return r
+}
+
+func (r *wireRecorder) Addr() string { return r.ln.Addr().String() }
+
+// forward copies the bytes from src to dst and records them. The write side of
+// dst is closed once src is drained, so that the server closes the connection
+// after all the requests are executed.
+func (r *wireRecorder) forward(dir string, dst, src net.Conn) {
+	defer r.wg.Done()
+	defer func() { _ = dst.(*net.TCPConn).CloseWrite() }()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			r.record(dir, buf[:n])
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *wireRecorder) record(dir string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last := len(r.chunks) - 1; last >= 0 && r.chunks[last].dir == dir {
+		r.chunks[last].data = append(r.chunks[last].data, data...)
+		return
+	}
+	r.chunks = append(r.chunks, wireChunk{dir: dir, data: bytes.Clone(data)})
+}
+
+// transcript stops the recorder and renders the recorded bytes line by line,
+// the volatile tokens (e.g. CAS unique, TTL and version) are normalized.
+func (r *wireRecorder) transcript() string {
+	_ = r.ln.Close()
+	waitTimeout(&r.wg, time.Second)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, cn := range r.conns {
+		_ = cn.Close()
+	}
+
+	var sb strings.Builder
+	for _, chunk := range r.chunks {
+		for _, line := range bytes.SplitAfter(chunk.data, _CRLFBytes) {
+			if len(line) == 0 {
+				continue
+			}
+			sb.WriteString(chunk.dir + " " + strconv.Quote(normalizeWireLine(string(line))) + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// waitTimeout waits for wg at most d, so that a connection which is not closed
+// by the server does not block the tests.
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(d):
+	}
+}
+
+var wireNormalizers = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{re: regexp.MustCompile(`^VERSION .*\r\n$`), repl: "VERSION <version>\r\n"},
+	{re: regexp.MustCompile(`^(VALUE \S+ \d+ \d+) \d+`), repl: "$1 <cas>"},
+	{re: regexp.MustCompile(`^(cas \S+ \d+ \d+ \d+) \d+`), repl: "$1 <cas>"},
+	{re: regexp.MustCompile(`^(ME \S+) exp=(-?\d+) la=\d+ cas=\d+(.*) cls=\d+ size=\d+`), repl: "$1 exp=$2 la=<la> cas=<cas>$3 cls=<cls> size=<size>"},
+	{re: regexp.MustCompile(`( [cC])\d+\b`), repl: "$1<cas>"},
+	{re: regexp.MustCompile(`( t)\d+\b`), repl: "$1<ttl>"},
+	{re: regexp.MustCompile(`( l)\d+\b`), repl: "$1<la>"},
+}
+
+// normalizeWireLine replaces the volatile tokens of the line with placeholders.
+func normalizeWireLine(line string) string {
+	for _, n := range wireNormalizers {
+		line = n.re.ReplaceAllString(line, n.repl)
+	}
+
+	return line
+}
@@ -2,9 +2,11 @@ package memcached
 
 import (
 	"bufio"
+	"container/list"
 	"context"
 	"io"
 	"net"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -33,6 +35,13 @@ type Addr struct {
 	// is unique.
 	Priority int
 
+	// Weight of the address in the cluster, a node with weight 3 takes about three
+	// times as many keys as a node with weight 1. It's respected by all pickers,
+	// 0 means the default weight 1.
+	//
+	// The defaultResolver parses the weight from the address, e.g. "localhost:11211?weight=3".
+	Weight int
+
 	metadata map[string]any
 }
 
@@ -46,6 +55,15 @@ func NewAddr(network, address string, priority int) *Addr {
 	}
 }
 
+// weight returns the weight of the address, which is at least 1.
+func (a *Addr) weight() int {
+	if a.Weight < 1 {
+		return 1
+	}
+
+	return a.Weight
+}
+
 func (a *Addr) shortcut() []byte {
 	return []byte(a.Network + "-" + a.Address + strconv.Itoa(a.Priority))
 }
@@ -57,13 +75,12 @@ func (a *Addr) GetMetadata(mdKey string) any {
 
 // Add adds the metadata key-value pair to the Addr.
 func (a *Addr) Add(mdKey string, mdValue any) {
+	if a.metadata == nil {
+		a.metadata = make(map[string]any, 2)
+	}
 	a.metadata[mdKey] = mdValue
 }
 
-func (a *Addr) dial(ctx context.Context, dialTimeout time.Duration) (net.Conn, error) {
-	return (&net.Dialer{Timeout: dialTimeout}).DialContext(ctx, a.Network, a.Address)
-}
-
 // memcachedConn wraps a net.Conn and provides a way to read and write data
 // from the connection.
 // It also provides support for a connection pool mechanism, including expired check,
@@ -72,6 +89,8 @@ type memcachedConn interface {
 	io.ReadWriteCloser
 
 	// readLine reads a line from the connection using the given delimiter.
+	// The returned slice is only valid until the next read, the caller must
+	// copy it if the line is retained.
 	readLine(delim byte) ([]byte, error)
 	// expired returns true if the connection is expired.
 	// it always returns the duration of time since the connection is created.
@@ -101,6 +120,10 @@ type conn struct {
 	createdAt  time.Time
 	addr       net.Addr
 	returnedAt time.Time
+	// released is true once the connection is put back to the pool, and gotBytes
+	// is true if any byte is read since then, see reusedConn.
+	released bool
+	gotBytes bool
 
 	sync.Mutex // guards following
 	raw        net.Conn
@@ -109,17 +132,33 @@ type conn struct {
 
 	rr *bufio.Reader
 	wr *bufio.Writer
+	// lineBuf is reused to assemble the line which is longer than the buffer of rr.
+	lineBuf []byte
+
+	// noReplies is the number of noreply requests sent since the last verification,
+	// see WithNoReplyVerify. The connection is used by one request at a time.
+	noReplies int
+	// replies is the number of replies received, it's read by the other requests
+	// waiting for the noreply writes over the connection, see WithReadYourWrites.
+	replies atomic.Uint64
 }
 
 // func newConn(addr *Addr, dialTimeout time.Duration) (*conn, error) {
 // 	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
 // 	defer cancel()
-// 	return newConnContext(ctx, addr, dialTimeout)
+// 	return newConnContext(ctx, addr, dialTimeout, nil, defaultConnBufferSize, defaultConnBufferSize)
 // }
 
-// newConnWithContext dials a TCP connection
-func newConnContext(ctx context.Context, addr *Addr, dialTimeout time.Duration) (*conn, error) {
-	rawConn, err := addr.dial(ctx, dialTimeout)
+// defaultConnBufferSize is the default size of the reader and the writer buffers
+// of each connection, it's the default size of bufio.
+const defaultConnBufferSize = 4096
+
+// newConnWithContext dials a TCP connection, its reader and writer are buffered
+// by the given sizes.
+func newConnContext(
+	ctx context.Context, addr *Addr, dialTimeout time.Duration, dialer DialFunc, readerSize, writerSize int,
+) (*conn, error) {
+	rawConn, err := addr.dial(ctx, dialTimeout, dialer)
 	if err != nil {
 		return nil, errors.Wrap(err, "dialContext")
 	}
@@ -133,8 +172,8 @@ func newConnContext(ctx context.Context, addr *Addr, dialTimeout time.Duration)
 		raw:    rawConn,
 		addr:   rawConn.RemoteAddr(),
 
-		rr: bufio.NewReader(rawConn),
-		wr: bufio.NewWriter(rawConn),
+		rr: bufio.NewReaderSize(rawConn, readerSize),
+		wr: bufio.NewWriterSize(rawConn, writerSize),
 	}
 
 	return cn, nil
@@ -144,8 +183,21 @@ func (c *conn) getConnPool() *connPool {
 	return c.pool
 }
 
+// setConnPool attaches the connection to the pool, it's aged by the clock of the
+// pool since then.
 func (c *conn) setConnPool(p *connPool) {
 	c.pool = p
+	c.createdAt = p.now()
+	c.returnedAt = c.createdAt
+}
+
+// now returns the current time by the clock of the pool of the connection.
+func (c *conn) now() time.Time {
+	if c.pool != nil {
+		return c.pool.now()
+	}
+
+	return nowFunc()
 }
 
 var zeroTime = time.Time{}
@@ -171,7 +223,25 @@ func (c *conn) readLine(delim byte) ([]byte, error) {
 		return nil, errors.New("connection is closed")
 	}
 
-	return c.rr.ReadBytes(delim)
+	// ReadSlice returns the line in the buffer of rr without allocation, and
+	// ErrBufferFull if the line is longer than the buffer, in which case the
+	// fragments are assembled in lineBuf.
+	line, err := c.rr.ReadSlice(delim)
+	c.gotBytes = c.gotBytes || len(line) > 0
+	if err != bufio.ErrBufferFull {
+		return line, err
+	}
+
+	c.lineBuf = append(c.lineBuf[:0], line...)
+	for err == bufio.ErrBufferFull {
+		line, err = c.rr.ReadSlice(delim)
+		c.lineBuf = append(c.lineBuf, line...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c.lineBuf, nil
 }
 
 // Read reads data from the connection
@@ -180,7 +250,9 @@ func (c *conn) Read(p []byte) (n int, err error) {
 		return 0, errors.New("connection is closed")
 	}
 
-	return c.rr.Read(p)
+	n, err = c.rr.Read(p)
+	c.gotBytes = c.gotBytes || n > 0
+	return n, err
 }
 
 // Write writes data to the connection
@@ -196,6 +268,21 @@ func (c *conn) Write(p []byte) (n int, err error) {
 	return n, c.wr.Flush()
 }
 
+// bufferedWrite writes data into the buffer of the connection without flushing,
+// see batchWriter.
+func (c *conn) bufferedWrite(p []byte) (n int, err error) {
+	if c.closed {
+		return 0, errors.New("connection is closed")
+	}
+
+	return c.wr.Write(p)
+}
+
+// flush sends the buffered data.
+func (c *conn) flush() error {
+	return c.wr.Flush()
+}
+
 // Close closes the connection
 func (c *conn) Close() error {
 	c.Mutex.Lock()
@@ -214,7 +301,7 @@ func (c *conn) Close() error {
 }
 
 func (c *conn) expired(since time.Time) (time.Duration, bool) {
-	now := nowFunc()
+	now := c.now()
 	past := now.Sub(c.createdAt)
 	if since.IsZero() {
 		return past, false
@@ -239,7 +326,9 @@ func (c *conn) idle(since time.Time) (time.Duration, bool) {
 func (c *conn) release() error {
 	_ = c.setReadDeadline(zeroTime)
 	_ = c.setWriteDeadline(zeroTime)
-	c.returnedAt = nowFunc()
+	c.returnedAt = c.now()
+	c.released = true
+	c.gotBytes = false
 	// put the connection back to the pool
 	return c.pool.put(c)
 }
@@ -255,14 +344,30 @@ func (c *conn) release() error {
 // Idle connections are connections that are not used for a certain period
 // of time decided by the maxIdleTime.
 //
+// If all connections are busy, the callers wait in a FIFO queue, the returned
+// connection is handed over to the earliest waiter directly.
+//
 // The pool is thread-safe.
 type connPool struct {
 	maxIdle, maxConns int
 	maxLifeTime       time.Duration
 	maxIdleTime       time.Duration
-
-	mu         sync.Mutex // guards following
-	conns      chan memcachedConn
+	// waitTimeout is the max duration to wait for a connection when the pool
+	// is exhausted, 0 means waiting until the context is done.
+	waitTimeout time.Duration
+	// liveness checks the idle connections before they are taken out of the pool,
+	// nil means they are not checked, see WithLivenessCheck.
+	liveness *livenessCheck
+	// notify is called with the lock held when an idle connection or a slot becomes
+	// available, it's set by shardedPool to wake up its waiters.
+	notify func()
+	// now tells the current time to age the connections, see WithClock.
+	now nowFuncType
+
+	mu sync.Mutex // guards following
+	// conns is the list of idle connections, the most recently returned one
+	// is at the end.
+	conns      []memcachedConn
 	createConn func(ctx context.Context) (memcachedConn, error)
 	// The number of connections numOpen by the pool.
 	numOpen atomic.Int32
@@ -270,10 +375,22 @@ type connPool struct {
 	// and all existing connections will be closed.
 	closed    bool
 	cleanerCh chan struct{}
+	// waiters is the queue of callers waiting for a connection, each element is
+	// a chan connRequest.
+	waiters *list.List
+
+	waitCount         int64         // the number of callers waited for a connection
+	waitDuration      time.Duration // the total time waited for connections
+	maxIdleClosed     int64         // the number of connections closed due to maxIdle
+	maxIdleTimeClosed int64         // the number of connections closed due to maxIdleTime
+	maxLifeTimeClosed int64         // the number of connections closed due to maxLifeTime
+	deadClosed        int64         // the number of connections closed due to the liveness check
+}
 
-	maxIdleClosed     int64 // the number of connections closed due to maxIdle
-	maxIdleTimeClosed int64 // the number of connections closed due to maxIdleTime
-	maxLifeTimeClosed int64 // the number of connections closed due to maxLifeTime
+// connRequest is handed over to a waiter of the pool. If cn is nil, the waiter
+// takes over a connection slot and should create the connection by itself.
+type connRequest struct {
+	cn memcachedConn
 }
 
 func newConnPool(
@@ -286,13 +403,15 @@ func newConnPool(
 		maxConns:    maxConn,
 		maxLifeTime: maxLifeTime,
 		maxIdleTime: maxIdleTime,
+		now:         nowFunc,
 
 		mu:         sync.Mutex{},
-		conns:      make(chan memcachedConn, maxConn),
+		conns:      make([]memcachedConn, 0, maxConn),
 		createConn: createConn,
 		numOpen:    atomic.Int32{},
 		closed:     false,
 		cleanerCh:  nil, // created when needed in startCleaner
+		waiters:    list.New(),
 
 		maxIdleClosed:     0,
 		maxIdleTimeClosed: 0,
@@ -310,50 +429,211 @@ func (p *connPool) close() error {
 	}
 
 	p.closed = true
-	// close all existing connections, so that the get() couldn't
-	// create a new connection.
-	close(p.conns)
+	// close all idle connections, the connections in use are closed when
+	// they are put back.
+	idle := p.conns
+	p.conns = nil
+	p.numOpen.Add(-int32(len(idle)))
 	if p.cleanerCh != nil {
 		p.cleanerCh <- struct{}{}
 	}
-
+	// wake up all waiters, they would find the pool is closed.
+	for e := p.waiters.Front(); e != nil; e = e.Next() {
+		close(e.Value.(chan connRequest))
+	}
+	p.waiters.Init()
 	p.mu.Unlock()
+
+	for _, cn := range idle {
+		_ = cn.Close()
+	}
+
 	return nil
 }
 
 func (p *connPool) get(ctx context.Context) (memcachedConn, error) {
+	return p.acquire(ctx, true)
+}
+
+// tryGet takes an idle connection or creates a new one as get does, but it fails
+// with errPoolExhausted rather than waits if the pool is full.
+func (p *connPool) tryGet(ctx context.Context) (memcachedConn, error) {
+	return p.acquire(ctx, false)
+}
+
+// acquire takes an idle connection or creates a new one, if the pool is full it
+// waits for a connection to be returned, or fails with errPoolExhausted if wait
+// is false.
+func (p *connPool) acquire(ctx context.Context, wait bool) (memcachedConn, error) {
+	p.mu.Lock()
 	if p.closed {
+		p.mu.Unlock()
 		return nil, errors.New("connection pool is closed")
 	}
 
 	// try to get a connection from the pool first if there is any
 	// otherwise create a new connection.
-	select {
-	case cn := <-p.conns:
-		return cn, nil
-	default:
+	for cn := p.popIdleLocked(); cn != nil; cn = p.popIdleLocked() {
+		p.mu.Unlock()
+		if p.liveness == nil || !p.liveness.due(cn, p.now()) || p.liveness.probe(ctx, cn) {
+			return cn, nil
+		}
+
+		// the dead connection is closed, and the next idle one is tried.
+		_ = cn.Close()
 		p.mu.Lock()
-		// no available connection, check if we can create a new one.
-		if int(p.numOpen.Load()) >= p.maxConns {
+		p.releaseSlotLocked()
+		p.deadClosed++
+		if p.closed {
 			p.mu.Unlock()
-			// the pool is full, wait for a connection to be returned
-			select {
-			case cn := <-p.conns:
-				return cn, nil
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			}
+			return nil, errors.New("connection pool is closed")
 		}
+	}
+
+	// no available connection, check if we can create a new one.
+	if int(p.numOpen.Load()) < p.maxConns {
+		// occupy the slot before creating, so that concurrent callers
+		// could not exceed maxConns.
+		p.numOpen.Add(1)
 		p.mu.Unlock()
+		return p.openConn(ctx)
+	}
 
-		cn, err := p.createConn(ctx)
-		if err != nil {
-			return nil, err
+	if !wait {
+		p.mu.Unlock()
+		return nil, errPoolExhausted
+	}
+
+	// the pool is full, wait for a connection to be returned in order.
+	req := make(chan connRequest, 1)
+	elem := p.waiters.PushBack(req)
+	p.waitCount++
+	waitTimeout := p.waitTimeout
+	p.mu.Unlock()
+
+	start := nowFunc()
+	var timeout <-chan time.Time
+	if waitTimeout > 0 {
+		timer := time.NewTimer(waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case r, ok := <-req:
+		p.recordWait(start)
+		if !ok {
+			return nil, errors.New("connection pool is closed")
 		}
-		cn.setConnPool(p)
+		if r.cn == nil {
+			return p.openConn(ctx)
+		}
+		return r.cn, nil
+	case <-ctx.Done():
+		p.cancelWait(elem, req, start)
+		return nil, ctx.Err()
+	case <-timeout:
+		p.cancelWait(elem, req, start)
+		return nil, errors.Wrapf(ErrPoolWaitTimeout, "waited %s", waitTimeout)
+	}
+}
+
+// dial creates a new connection rather than taking an idle one, e.g. to replace
+// a stale connection. It waits for a connection as get does if the pool is full.
+func (p *connPool) dial(ctx context.Context) (memcachedConn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errors.New("connection pool is closed")
+	}
+
+	if int(p.numOpen.Load()) < p.maxConns {
 		p.numOpen.Add(1)
+		p.mu.Unlock()
+		return p.openConn(ctx)
+	}
+	p.mu.Unlock()
+
+	return p.get(ctx)
+}
 
-		return cn, nil
+// openConn creates a new connection with the slot occupied by the caller, the
+// slot is released if the creation failed.
+func (p *connPool) openConn(ctx context.Context) (memcachedConn, error) {
+	cn, err := p.createConn(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.releaseSlotLocked()
+		p.mu.Unlock()
+		return nil, err
+	}
+	cn.setConnPool(p)
+
+	return cn, nil
+}
+
+func (p *connPool) recordWait(start time.Time) {
+	p.mu.Lock()
+	p.waitDuration += nowFunc().Sub(start)
+	p.mu.Unlock()
+}
+
+// cancelWait removes the waiter from the queue. The connection or slot which has
+// been handed over to the waiter at the same time is returned to the pool.
+func (p *connPool) cancelWait(elem *list.Element, req chan connRequest, start time.Time) {
+	p.mu.Lock()
+	p.waitDuration += nowFunc().Sub(start)
+	p.waiters.Remove(elem)
+
+	var r connRequest
+	select {
+	case got, ok := <-req:
+		if !ok {
+			p.mu.Unlock()
+			return
+		}
+		r = got
+	default:
+		p.mu.Unlock()
+		return
+	}
+
+	if r.cn == nil {
+		p.releaseSlotLocked()
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	_ = p.put(r.cn)
+}
+
+// handOverLocked hands over the connection or slot to the earliest waiter,
+// it returns false if there is no waiter.
+// NOTE: MUST run in the connPool.mu.Lock()
+func (p *connPool) handOverLocked(cn memcachedConn) bool {
+	front := p.waiters.Front()
+	if front == nil {
+		return false
+	}
+
+	p.waiters.Remove(front)
+	// the channel is buffered and only one request is sent to it.
+	front.Value.(chan connRequest) <- connRequest{cn: cn}
+	return true
+}
+
+// releaseSlotLocked releases a connection slot after a connection is closed or
+// failed to create, the slot is handed over to the earliest waiter if any.
+// NOTE: MUST run in the connPool.mu.Lock()
+func (p *connPool) releaseSlotLocked() {
+	if !p.closed && p.handOverLocked(nil) {
+		return
+	}
+
+	p.numOpen.Add(-1)
+	if p.notify != nil {
+		p.notify()
 	}
 }
 
@@ -363,28 +643,135 @@ func (p *connPool) put(cn memcachedConn) error {
 	}
 
 	p.mu.Lock()
-	maxIdleClose := p.maxIdle > 0 && len(p.conns) >= p.maxIdle
-	if p.closed || (p.maxConns > 0 && int(p.numOpen.Load()) > p.maxConns) || maxIdleClose {
-		_ = cn.Close()
+	if p.closed || (p.maxConns > 0 && int(p.numOpen.Load()) > p.maxConns) {
 		p.numOpen.Add(-1)
-		if maxIdleClose {
-			p.maxIdleClosed++
-		}
+		p.mu.Unlock()
+		return cn.Close()
+	}
 
+	if p.handOverLocked(cn) {
 		p.mu.Unlock()
 		return nil
 	}
 
-	select {
-	case p.conns <- cn:
-		p.startCleanerLocked()
+	if p.maxIdle > 0 && len(p.conns) >= p.maxIdle {
+		p.numOpen.Add(-1)
+		p.maxIdleClosed++
 		p.mu.Unlock()
-		return nil
-	default:
+		return cn.Close()
+	}
+
+	p.conns = append(p.conns, cn)
+	p.startCleanerLocked()
+	if p.notify != nil {
+		p.notify()
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// popIdleLocked takes the most recently returned idle connection, so that the
+// connections used rarely stay idle and are closed by the cleaner. The expired
+// connections are closed rather than returned. It returns nil if there is no
+// idle connection.
+// NOTE: MUST run in the connPool.mu.Lock()
+func (p *connPool) popIdleLocked() memcachedConn {
+	var expiredSince time.Time
+	if p.maxLifeTime > 0 {
+		expiredSince = p.now().Add(-p.maxLifeTime)
+	}
+
+	for len(p.conns) > 0 {
+		last := len(p.conns) - 1
+		cn := p.conns[last]
+		p.conns[last] = nil
+		p.conns = p.conns[:last]
+
+		if _, expired := cn.expired(expiredSince); !expired {
+			return cn
+		}
+
+		_ = cn.Close()
+		p.numOpen.Add(-1)
+		p.maxLifeTimeClosed++
+	}
+
+	return nil
+}
+
+// take takes the given connection out of the pool if it's idle, it reports false
+// if the connection is in use or closed.
+func (p *connPool) take(cn memcachedConn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, idle := range p.conns {
+		if idle == cn {
+			p.conns = slices.Delete(p.conns, i, i+1)
+			return true
+		}
+	}
+
+	return false
+}
+
+// discard closes the connection rather than putting it back to the pool, it's
+// used when the connection is in an unknown state, e.g. the response is not
+// fully read.
+func (p *connPool) discard(cn memcachedConn) {
+	_ = cn.Close()
+
+	p.mu.Lock()
+	p.releaseSlotLocked()
+	p.mu.Unlock()
+}
+
+// resize applies the new limits to the pool in use. The idle connections beyond
+// the limits are closed at once, and the connections in use beyond maxConns are
+// closed when they are put back, so that the pool shrinks gradually. The waiters
+// take over the new slots if the pool grows.
+func (p *connPool) resize(
+	maxIdle, maxConns int,
+	maxLifeTime, maxIdleTime, waitTimeout time.Duration,
+) {
+	p.mu.Lock()
+	if p.closed {
 		p.mu.Unlock()
-		// rare case, the pool is full
+		return
+	}
+
+	p.maxIdle, p.maxConns = maxIdle, maxConns
+	p.maxLifeTime, p.maxIdleTime = maxLifeTime, maxIdleTime
+	p.waitTimeout = waitTimeout
+
+	// close the least recently returned idle connections first.
+	var closing []memcachedConn
+	for len(p.conns) > 0 &&
+		((p.maxIdle > 0 && len(p.conns) > p.maxIdle) || int(p.numOpen.Load()) > p.maxConns) {
+		closing = append(closing, p.conns[0])
+		p.conns[0] = nil
+		p.conns = p.conns[1:]
 		p.numOpen.Add(-1)
-		return cn.Close()
+		p.maxIdleClosed++
+	}
+
+	for int(p.numOpen.Load()) < p.maxConns && p.handOverLocked(nil) {
+		p.numOpen.Add(1)
+	}
+
+	// wake up the cleaner to apply the new lifetimes, or start it if needed.
+	if p.cleanerCh != nil {
+		select {
+		case p.cleanerCh <- struct{}{}:
+		default:
+		}
+	} else {
+		p.startCleanerLocked()
+	}
+	p.mu.Unlock()
+
+	for _, cn := range closing {
+		_ = cn.Close()
 	}
 }
 
@@ -429,8 +816,12 @@ func (p *connPool) connectionsCleaner(d time.Duration) {
 
 		for _, cn := range closing {
 			_ = cn.Close()
-			p.numOpen.Add(-1)
 		}
+		p.mu.Lock()
+		for range closing {
+			p.releaseSlotLocked()
+		}
+		p.mu.Unlock()
 
 		if d < minInterval {
 			d = minInterval
@@ -461,79 +852,108 @@ func (p *connPool) shortestIdleTimeLocked() time.Duration {
 //
 // 1. if the connection is expired (exceeds maxLifeTime since created).
 // 2. if the connection idle time exceeds the idle connection limit(maxIdleTime).
+//
+// The idle list is filtered in place, so that the concurrent put() which is
+// blocked by the lock always appends to a valid list.
 func (p *connPool) connectionCleanerRunLocked(d time.Duration) (time.Duration, []memcachedConn) {
-	var idleClosing int64
-	closing := make([]memcachedConn, 0, p.maxIdle/2)
-	newConns := make(chan memcachedConn, p.maxConns)
-
+	var idleSince, expiredSince time.Time
 	if p.maxIdleTime > 0 {
-		idleSince := nowFunc().Add(-p.maxIdleTime)
-		close(p.conns)
-		// TODO(@yeqown): could we optimize the loop here?
-		//  we re-allocate the newConns channel every time we clean up the connections.
-		for c := range p.conns {
-			if d2, ok := c.idle(idleSince); !ok {
-				if d2 < d {
-					// Ensure idle connections are cleaned up as soon
-					// as possible.
-					d = d2
-				}
-				newConns <- c // put back
+		idleSince = p.now().Add(-p.maxIdleTime)
+	}
+	if p.maxLifeTime > 0 {
+		expiredSince = p.now().Add(-p.maxLifeTime)
+	}
+
+	var closing []memcachedConn
+	kept := p.conns[:0]
+	for _, c := range p.conns {
+		if p.maxIdleTime > 0 {
+			d2, ok := c.idle(idleSince)
+			if ok {
+				closing = append(closing, c)
+				p.maxIdleTimeClosed++
 				continue
 			}
-			closing = append(closing, c)
-			idleClosing++
+			if d2 < d {
+				// Ensure idle connections are cleaned up as soon
+				// as possible.
+				d = d2
+			}
 		}
 
-		p.conns = newConns
-		p.maxIdleTimeClosed += idleClosing
-	}
-
-	newConns = make(chan memcachedConn, p.maxConns)
-	if p.maxLifeTime > 0 {
-		expiredSince := nowFunc().Add(-p.maxLifeTime)
-		close(p.conns)
-		for c := range p.conns {
-			if d2, ok := c.expired(expiredSince); !ok {
-				if d2 < d {
-					// Prevents connections staying in the pool when they
-					// have expired.
-					d = d2
-				}
-				newConns <- c // put back
+		if p.maxLifeTime > 0 {
+			d2, ok := c.expired(expiredSince)
+			if ok {
+				closing = append(closing, c)
+				p.maxLifeTimeClosed++
 				continue
 			}
-			closing = append(closing, c)
+			if d2 < d {
+				// Prevents connections staying in the pool when they
+				// have expired.
+				d = d2
+			}
 		}
 
-		p.conns = newConns
-		p.maxLifeTimeClosed += int64(len(closing)) - idleClosing
+		kept = append(kept, c)
+	}
+
+	// clear the tail so that the closed connections could be collected.
+	for i := len(kept); i < len(p.conns); i++ {
+		p.conns[i] = nil
 	}
+	p.conns = kept
 
 	return d, closing
 }
 
-type connPoolStats struct {
-	TotalConns int
-	IdleConns  int
+// PoolStats represents the statistics of the connection pool to one memcached server.
+type PoolStats struct {
+	TotalConns int // the number of connections opened, both in use and idle
+	IdleConns  int // the number of idle connections
 	MaxConns   int
 	MaxIdle    int
 
-	maxIdleClosed     int64
-	maxIdleTimeClosed int64
-	maxLifeTimeClosed int64
+	WaitCount    int64         // the total number of callers waited for a connection
+	WaitDuration time.Duration // the total time waited for connections
+	Waiting      int           // the number of callers waiting for a connection now
+
+	MaxIdleClosed     int64 // the number of connections closed due to maxIdle
+	MaxIdleTimeClosed int64 // the number of connections closed due to maxIdleTime
+	MaxLifeTimeClosed int64 // the number of connections closed due to maxLifeTime
+	DeadClosed        int64 // the number of connections closed due to WithLivenessCheck
+
+	// ReadTimeout is the read timeout of requests now, it adapts to the latencies
+	// of the server if WithAdaptiveReadTimeout is set.
+	ReadTimeout time.Duration
+
+	// BufferedBytes is the memory taken by the reader and the writer buffers of the
+	// connections opened, see WithConnBufferSizes.
+	BufferedBytes int
+
+	// InFlightRequests and ShedRequests are only counted if WithMaxConcurrentRequests is set.
+	InFlightRequests int   // the number of requests in flight now
+	ShedRequests     int64 // the total number of requests rejected with ErrOverloaded
+
+	// FailedOpenRequests is the total number of requests failed open as cache misses
+	// or no-op writes, it's only counted if WithFailOpen is set.
+	FailedOpenRequests int64
 }
 
-func (p *connPool) stats() *connPoolStats {
+func (p *connPool) stats() *PoolStats {
 	p.mu.Lock()
-	s := &connPoolStats{
+	s := &PoolStats{
 		TotalConns:        int(p.numOpen.Load()),
 		IdleConns:         len(p.conns),
 		MaxConns:          p.maxConns,
 		MaxIdle:           p.maxIdle,
-		maxIdleClosed:     p.maxIdleClosed,
-		maxIdleTimeClosed: p.maxIdleTimeClosed,
-		maxLifeTimeClosed: p.maxLifeTimeClosed,
+		WaitCount:         p.waitCount,
+		WaitDuration:      p.waitDuration,
+		Waiting:           p.waiters.Len(),
+		MaxIdleClosed:     p.maxIdleClosed,
+		MaxIdleTimeClosed: p.maxIdleTimeClosed,
+		MaxLifeTimeClosed: p.maxLifeTimeClosed,
+		DeadClosed:        p.deadClosed,
 	}
 	p.mu.Unlock()
 	return s
@@ -2,7 +2,9 @@ package memcached
 
 import (
 	"context"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -309,9 +311,9 @@ func Test_connPool_cleanup_maxIdle(t *testing.T) {
 	assert.Equal(t, 0, stat.IdleConns)
 	assert.Equal(t, 10, stat.MaxConns)
 	assert.Equal(t, 5, stat.MaxIdle)
-	assert.Equal(t, int64(0), stat.maxIdleClosed)
-	assert.Equal(t, int64(0), stat.maxLifeTimeClosed)
-	assert.Equal(t, int64(0), stat.maxIdleTimeClosed)
+	assert.Equal(t, int64(0), stat.MaxIdleClosed)
+	assert.Equal(t, int64(0), stat.MaxLifeTimeClosed)
+	assert.Equal(t, int64(0), stat.MaxIdleTimeClosed)
 
 	// wait for the cleaner to clean up the idle connection, decrease the numOpen
 	// connections to 5.
@@ -326,9 +328,9 @@ func Test_connPool_cleanup_maxIdle(t *testing.T) {
 	assert.Equal(t, 0, stat.IdleConns) // since all connections are cleaned up(idle=1s)
 	assert.Equal(t, 10, stat.MaxConns)
 	assert.Equal(t, 5, stat.MaxIdle)
-	assert.Equal(t, int64(5), stat.maxIdleClosed)
-	assert.Equal(t, int64(0), stat.maxLifeTimeClosed)
-	assert.Equal(t, int64(5), stat.maxIdleTimeClosed)
+	assert.Equal(t, int64(5), stat.MaxIdleClosed)
+	assert.Equal(t, int64(0), stat.MaxLifeTimeClosed)
+	assert.Equal(t, int64(5), stat.MaxIdleTimeClosed)
 }
 
 // Test_connPool_cleanup_maxLife tests the case that connection sits in
@@ -360,9 +362,9 @@ func Test_connPool_cleanup_maxLife(t *testing.T) {
 	assert.Equal(t, 0, stat.IdleConns)
 	assert.Equal(t, 10, stat.MaxConns)
 	assert.Equal(t, 5, stat.MaxIdle)
-	assert.Equal(t, int64(0), stat.maxIdleClosed)
-	assert.Equal(t, int64(0), stat.maxLifeTimeClosed)
-	assert.Equal(t, int64(0), stat.maxIdleTimeClosed)
+	assert.Equal(t, int64(0), stat.MaxIdleClosed)
+	assert.Equal(t, int64(0), stat.MaxLifeTimeClosed)
+	assert.Equal(t, int64(0), stat.MaxIdleTimeClosed)
 
 	// wait for the cleaner to clean up the idle connection, decrease the numOpen
 	// connections to 5.
@@ -377,7 +379,305 @@ func Test_connPool_cleanup_maxLife(t *testing.T) {
 	assert.Equal(t, 0, stat.IdleConns) // since all connections are cleaned up(idle=1s)
 	assert.Equal(t, 10, stat.MaxConns)
 	assert.Equal(t, 5, stat.MaxIdle)
-	assert.Equal(t, int64(5), stat.maxIdleClosed)
-	assert.Equal(t, int64(5), stat.maxLifeTimeClosed)
-	assert.Equal(t, int64(0), stat.maxIdleTimeClosed)
+	assert.Equal(t, int64(5), stat.MaxIdleClosed)
+	assert.Equal(t, int64(5), stat.MaxLifeTimeClosed)
+	assert.Equal(t, int64(0), stat.MaxIdleTimeClosed)
+}
+
+func Test_connPool_waitQueueInOrder(t *testing.T) {
+	pool := newConnPool(1, 1, 0, 0, createConn)
+	ctx := context.Background()
+
+	cn, err := pool.get(ctx)
+	assert.NoError(t, err)
+
+	got := make(chan int, 3)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			cn, err := pool.get(ctx)
+			if assert.NoError(t, err) {
+				got <- i
+				_ = pool.put(cn)
+			}
+		}(i)
+		// make sure the waiters are queued in order.
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	assert.Equal(t, 3, pool.stats().Waiting)
+	assert.NoError(t, pool.put(cn))
+	wg.Wait()
+	close(got)
+
+	order := make([]int, 0, 3)
+	for i := range got {
+		order = append(order, i)
+	}
+	assert.Equal(t, []int{0, 1, 2}, order)
+
+	stat := pool.stats()
+	assert.Equal(t, int64(3), stat.WaitCount)
+	assert.Equal(t, 0, stat.Waiting)
+	assert.True(t, stat.WaitDuration > 0)
+	assert.Equal(t, 1, stat.TotalConns)
+}
+
+func Test_connPool_deadConnHandsOverSlot(t *testing.T) {
+	pool := newConnPool(1, 1, 0, 0, createConn)
+	ctx := context.Background()
+
+	cn, err := pool.get(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, pool.put(cn))
+
+	probing, release := make(chan struct{}), make(chan struct{})
+	pool.liveness = &livenessCheck{probe: func(context.Context, memcachedConn) bool {
+		close(probing)
+		<-release
+		return false
+	}}
+
+	// the idle connection is taken and found dead, while the other caller waits.
+	// the connection taken instead of it is held until the waiter is done.
+	held := make(chan memcachedConn, 1)
+	go func() {
+		cn, _ := pool.get(ctx)
+		held <- cn
+	}()
+	<-probing
+	pool.liveness = nil
+
+	got := make(chan error, 1)
+	go func() {
+		cn, err := pool.get(ctx)
+		if err == nil {
+			_ = pool.put(cn)
+		}
+		got <- err
+	}()
+	assert.Eventually(t, func() bool { return pool.stats().Waiting == 1 }, time.Second, time.Millisecond)
+
+	// the slot of the dead connection is handed over to the waiter.
+	close(release)
+	select {
+	case err := <-got:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the waiter is not handed over the slot of the dead connection")
+	}
+	if cn := <-held; cn != nil {
+		_ = pool.put(cn)
+	}
+}
+
+func Test_connPool_waitTimeout(t *testing.T) {
+	pool := newConnPool(1, 1, 0, 0, createConn)
+	pool.waitTimeout = 50 * time.Millisecond
+
+	cn, err := pool.get(context.Background())
+	assert.NoError(t, err)
+
+	start := time.Now()
+	_, err = pool.get(context.Background())
+	assert.ErrorIs(t, err, ErrPoolWaitTimeout)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	stat := pool.stats()
+	assert.Equal(t, int64(1), stat.WaitCount)
+	assert.Equal(t, 0, stat.Waiting)
+
+	// the connection is put back to the pool rather than a gone waiter.
+	assert.NoError(t, pool.put(cn))
+	assert.Equal(t, 1, pool.stats().IdleConns)
+}
+
+func Test_connPool_discardHandsOverSlot(t *testing.T) {
+	pool := newConnPool(1, 1, 0, 0, createConn)
+
+	cn, err := pool.get(context.Background())
+	assert.NoError(t, err)
+
+	done := make(chan memcachedConn, 1)
+	go func() {
+		cn, err := pool.get(context.Background())
+		assert.NoError(t, err)
+		done <- cn
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// the waiter creates a new connection with the slot of the discarded one.
+	pool.discard(cn)
+	select {
+	case got := <-done:
+		assert.NotSame(t, cn, got)
+	case <-time.After(time.Second):
+		t.Fatal("waiter is not woken up")
+	}
+	assert.Equal(t, 1, pool.stats().TotalConns)
+}
+
+// closeCountingConn is a mockConn which counts the closed connections.
+type closeCountingConn struct {
+	*mockConn
+
+	closed *atomic.Int32
+}
+
+func (c *closeCountingConn) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+func Test_connPool_closeIdleConns(t *testing.T) {
+	closed := &atomic.Int32{}
+	pool := newConnPool(5, 10, 0, 0, func(context.Context) (memcachedConn, error) {
+		return &closeCountingConn{mockConn: newMockConn(), closed: closed}, nil
+	})
+
+	conns := make([]memcachedConn, 0, 3)
+	for i := 0; i < 3; i++ {
+		cn, err := pool.get(context.Background())
+		assert.NoError(t, err)
+		conns = append(conns, cn)
+	}
+	assert.NoError(t, pool.put(conns[0]))
+	assert.NoError(t, pool.put(conns[1]))
+
+	// idle connections are closed immediately, the one in use is closed when put back.
+	assert.NoError(t, pool.close())
+	assert.Equal(t, int32(2), closed.Load())
+	assert.Equal(t, 1, pool.stats().TotalConns)
+
+	assert.NoError(t, pool.put(conns[2]))
+	assert.Equal(t, int32(3), closed.Load())
+	assert.Equal(t, 0, pool.stats().TotalConns)
+}
+
+func Test_connPool_resize(t *testing.T) {
+	closed := &atomic.Int32{}
+	pool := newConnPool(5, 4, 0, 0, func(context.Context) (memcachedConn, error) {
+		return &closeCountingConn{mockConn: newMockConn(), closed: closed}, nil
+	})
+
+	conns := make([]memcachedConn, 0, 4)
+	for i := 0; i < 4; i++ {
+		cn, err := pool.get(context.Background())
+		assert.NoError(t, err)
+		conns = append(conns, cn)
+	}
+	assert.NoError(t, pool.put(conns[0]))
+	assert.NoError(t, pool.put(conns[1]))
+
+	// shrink: the idle connections are closed at once, the ones in use are
+	// closed when they are put back.
+	pool.resize(1, 1, 0, 0, 0)
+	assert.Equal(t, int32(2), closed.Load())
+	assert.Equal(t, 2, pool.stats().TotalConns)
+
+	assert.NoError(t, pool.put(conns[2]))
+	assert.Equal(t, int32(3), closed.Load())
+	assert.NoError(t, pool.put(conns[3]))
+	assert.Equal(t, 1, pool.stats().IdleConns)
+
+	cn, err := pool.get(context.Background())
+	assert.NoError(t, err)
+
+	// grow: the waiter takes over the new slot.
+	done := make(chan memcachedConn, 1)
+	go func() {
+		cn, err := pool.get(context.Background())
+		assert.NoError(t, err)
+		done <- cn
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	pool.resize(1, 2, 0, 0, 0)
+	select {
+	case got := <-done:
+		assert.NotSame(t, cn, got)
+	case <-time.After(time.Second):
+		t.Fatal("waiter is not woken up")
+	}
+	stat := pool.stats()
+	assert.Equal(t, 2, stat.TotalConns)
+	assert.Equal(t, 2, stat.MaxConns)
+}
+
+func Test_connPool_popExpiredConn(t *testing.T) {
+	pool := newConnPool(5, 10, time.Minute, 0, createConn)
+
+	cn, err := pool.get(context.Background())
+	assert.NoError(t, err)
+	cn.(*mockConn).createdAt = time.Now().Add(-2 * time.Minute)
+	assert.NoError(t, pool.put(cn))
+
+	got, err := pool.get(context.Background())
+	assert.NoError(t, err)
+	assert.NotSame(t, cn, got)
+
+	stat := pool.stats()
+	assert.Equal(t, 1, stat.TotalConns)
+	assert.Equal(t, int64(1), stat.MaxLifeTimeClosed)
+}
+
+// Test_connPool_stress_cleaner runs the cleaner with get, put and discard concurrently,
+// the idle list must stay consistent with numOpen and never panic.
+func Test_connPool_stress_cleaner(t *testing.T) {
+	pool := newConnPool(5, 20, time.Millisecond, time.Millisecond, createConn)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for ctx.Err() == nil {
+			pool.mu.Lock()
+			_, closing := pool.connectionCleanerRunLocked(time.Hour)
+			for range closing {
+				pool.releaseSlotLocked()
+			}
+			pool.mu.Unlock()
+
+			for _, cn := range closing {
+				_ = cn.Close()
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			r := rand.New(rand.NewSource(seed))
+			for ctx.Err() == nil {
+				cn, err := pool.get(ctx)
+				if err != nil {
+					assert.ErrorIs(t, err, context.DeadlineExceeded)
+					return
+				}
+
+				if r.Intn(10) == 0 {
+					pool.discard(cn)
+					continue
+				}
+				assert.NoError(t, pool.put(cn))
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	stat := pool.stats()
+	assert.Equal(t, stat.IdleConns, stat.TotalConns)
+	assert.LessOrEqual(t, stat.TotalConns, 5)
+	assert.Equal(t, 0, stat.Waiting)
+
+	assert.NoError(t, pool.close())
+	assert.Equal(t, 0, pool.stats().TotalConns)
 }
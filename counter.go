@@ -0,0 +1,138 @@
+package memcached
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	memcodec "github.com/yeqown/memcached/codec"
+)
+
+// Counter is a numeric item in memcached which is created on demand, it's a
+// common building block of rate limiting. It's built on the meta arithmetic
+// command, so that the memcached server must be 1.6.0 or later.
+//
+// The value is stored as an ASCII decimal unsigned 64-bit number as memcached
+// requires, the increment wraps around at 64 bits and the decrement stops at 0.
+// It's neither encoded nor decoded by the codec of the client, e.g. WithChecksum.
+type Counter struct {
+	// client is the view of the client without the codec, or the one mirroring
+	// the commands if the Counter is returned by MigrationClient.
+	client Client
+	// clock converts the ttl longer than 30 days by the clock of the client.
+	clock Clock
+	key   string
+	ttl   time.Duration
+}
+
+// Counter returns the counter of the given key, the item is created with the
+// given ttl by the first Incr or Decr if it does not exist, and the ttl is NOT
+// extended by the later ones. The ttl 0 means the counter never expires.
+func (c *client) Counter(key string, ttl time.Duration) *Counter {
+	return &Counter{
+		client: c.withoutCodec(),
+		clock:  c.options.clock,
+		key:    key,
+		ttl:    ttl,
+	}
+}
+
+// Key returns the key of the counter.
+func (ct *Counter) Key() string {
+	return ct.key
+}
+
+// Incr increments the counter by delta and returns the new value, the counter
+// is created with delta as its value if it does not exist.
+func (ct *Counter) Incr(ctx context.Context, delta uint64) (uint64, error) {
+	return ct.arithmetic(ctx, delta, MetaArithmeticModeIncr, delta)
+}
+
+// Decr decrements the counter by delta and returns the new value, the counter
+// is created with 0 as its value if it does not exist.
+func (ct *Counter) Decr(ctx context.Context, delta uint64) (uint64, error) {
+	return ct.arithmetic(ctx, delta, MetaArithmeticModeDecr, 0)
+}
+
+func (ct *Counter) arithmetic(ctx context.Context, delta uint64, mode metaArithmeticMode, initial uint64) (uint64, error) {
+	// the delta 0 is omitted from the command which means 1 by default.
+	if delta == 0 {
+		return ct.Get(ctx)
+	}
+
+	item, err := ct.client.MetaArithmetic(ctx, []byte(ct.key), delta,
+		MetaArithmeticFlagModeSwitch(mode),
+		MetaArithmeticFlagAutoCreate(metaTTL(ct.expiry())),
+		MetaArithmeticFlagInitialValue(initial),
+		MetaArithmeticFlagReturnValue(),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "counter")
+	}
+
+	return parseCounterValue(item.Value)
+}
+
+// Get returns the value of the counter, 0 if it does not exist.
+func (ct *Counter) Get(ctx context.Context) (uint64, error) {
+	item, err := ct.client.MetaGet(ctx, []byte(ct.key), MetaGetFlagReturnValue())
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "counter")
+	}
+
+	return parseCounterValue(item.Value)
+}
+
+// Set sets the value of the counter, and resets its ttl.
+func (ct *Counter) Set(ctx context.Context, value uint64) error {
+	_, err := ct.client.MetaSet(ctx, []byte(ct.key), []byte(strconv.FormatUint(value, 10)),
+		MetaSetFlagTTL(metaTTL(ct.expiry())),
+	)
+	if err != nil {
+		return errors.Wrap(err, "counter")
+	}
+
+	return nil
+}
+
+// Delete deletes the counter, it's not an error if the counter does not exist.
+func (ct *Counter) Delete(ctx context.Context) error {
+	_, err := ct.client.MetaDelete(ctx, []byte(ct.key))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return errors.Wrap(err, "counter")
+	}
+
+	return nil
+}
+
+// expiry converts the ttl at the time of each command, since the ttl longer than
+// 30 days is an absolute Unix timestamp.
+func (ct *Counter) expiry() Expiration {
+	return expirationAfter(ct.clock.Now(), ct.ttl)
+}
+
+// withoutCodec returns the view of the client which stores and reads the values
+// as they are, see With.
+func (c *client) withoutCodec() *client {
+	options := *c.options
+	options.codec = memcodec.Noop
+
+	view := *c
+	view.options = &options
+	view.derived = true
+	return &view
+}
+
+func parseCounterValue(value []byte) (uint64, error) {
+	n, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(ErrMalformedResponse, "counter value %q is not a decimal number", value)
+	}
+
+	return n, nil
+}
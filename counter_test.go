@@ -0,0 +1,112 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Counter(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	t.Run("auto create", func(t *testing.T) {
+		counter := c.Counter("hits", time.Minute)
+
+		n, err := counter.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), n)
+
+		n, err = counter.Incr(ctx, 3)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), n)
+		n, err = counter.Incr(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), n)
+
+		item, err := c.MetaGet(ctx, []byte("hits"), MetaGetFlagReturnTTL())
+		require.NoError(t, err)
+		assert.InDelta(t, 60, item.TTL, 1)
+	})
+
+	t.Run("decrement stops at zero", func(t *testing.T) {
+		counter := c.Counter("stock", 0)
+
+		n, err := counter.Decr(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), n)
+
+		require.NoError(t, counter.Set(ctx, 10))
+		n, err = counter.Decr(ctx, 4)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(6), n)
+		n, err = counter.Decr(ctx, 100)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), n)
+
+		item, err := c.MetaGet(ctx, []byte("stock"), MetaGetFlagReturnTTL())
+		require.NoError(t, err)
+		assert.Equal(t, int64(-1), item.TTL)
+	})
+
+	t.Run("zero delta", func(t *testing.T) {
+		counter := c.Counter("zero", 0)
+		require.NoError(t, counter.Set(ctx, 7))
+
+		n, err := counter.Incr(ctx, 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(7), n)
+	})
+
+	t.Run("non-numeric value", func(t *testing.T) {
+		require.NoError(t, c.Set(ctx, "text", []byte("abc"), 0, 0))
+		counter := c.Counter("text", 0)
+
+		_, err := counter.Incr(ctx, 1)
+		require.ErrorIs(t, err, ErrClientError)
+		_, err = counter.Get(ctx)
+		require.ErrorIs(t, err, ErrMalformedResponse)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		counter := c.Counter("deleted", 0)
+		_, err := counter.Incr(ctx, 1)
+		require.NoError(t, err)
+
+		require.NoError(t, counter.Delete(ctx))
+		require.NoError(t, counter.Delete(ctx))
+		n, err := counter.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), n)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		const workers, times = 8, 50
+		counter := c.Counter("concurrent", time.Minute)
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < times; j++ {
+					_, err := counter.Incr(ctx, 1)
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		n, err := counter.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(workers*times), n)
+	})
+}
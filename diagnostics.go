@@ -0,0 +1,153 @@
+package memcached
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxCapturedLineLength is the max bytes of each line captured by ProtocolError,
+// the longer one (usually a value) is truncated.
+const maxCapturedLineLength = 1024
+
+// ProtocolError is a malformed response captured by WithProtocolErrorCapture, with
+// the request it's replied to. The lines are copied, and truncated to 1KB each.
+type ProtocolError struct {
+	// Time is when the response is found malformed.
+	Time time.Time
+	// Addr is the address of the memcached server, it's empty if unknown.
+	Addr string
+	// Err is the error returned to the caller.
+	Err error
+	// Request is the raw request, Response is the raw lines received before the
+	// response is found malformed, including the error line if any.
+	Request  []byte
+	Response [][]byte
+	// Truncated is true if any of the lines is truncated.
+	Truncated bool
+}
+
+// String returns the captured lines both escaped and in hex, e.g.
+//
+//	2024-01-02T15:04:05.000000Z 127.0.0.1:11211 ! "malformed response"
+//	> "touch foo 60\r\n"
+//	< "TOUCHED\r\n"
+//	00000000  54 4f 55 43 48 45 44 0d  0a                       |TOUCHED..|
+func (e *ProtocolError) String() string {
+	buf := bytes.Buffer{}
+	buf.WriteString(e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00") + " " + e.Addr + " ! ")
+	if e.Err != nil {
+		buf.WriteString(strconv.Quote(e.Err.Error()))
+	}
+	buf.WriteByte('\n')
+
+	writeLine := func(prefix string, line []byte) {
+		buf.WriteString(prefix + strconv.Quote(string(line)) + "\n")
+		buf.WriteString(hex.Dump(line))
+	}
+	for _, line := range bytes.SplitAfter(e.Request, _CRLFBytes) {
+		if len(line) > 0 {
+			writeLine("> ", line)
+		}
+	}
+	for _, line := range e.Response {
+		writeLine("< ", line)
+	}
+	if e.Truncated {
+		buf.WriteString("(truncated to " + strconv.Itoa(maxCapturedLineLength) + " bytes per line)\n")
+	}
+
+	return buf.String()
+}
+
+// protocolErrorRing keeps the last malformed responses.
+type protocolErrorRing struct {
+	mu   sync.Mutex // guards following
+	errs []*ProtocolError
+	// next is the index the next one is kept at, the oldest one is overwritten
+	// once the ring is full.
+	next int
+	full bool
+}
+
+func newProtocolErrorRing(n int) *protocolErrorRing {
+	return &protocolErrorRing{errs: make([]*ProtocolError, n)}
+}
+
+// capture keeps the response of the request if err is ErrMalformedResponse, the
+// lines are copied since they're reused after the response is released.
+func (r *protocolErrorRing) capture(addr *Addr, req *request, resp *response, err error) {
+	if r == nil || err == nil || !errors.Is(err, ErrMalformedResponse) {
+		return
+	}
+
+	e := &ProtocolError{Time: nowFunc(), Err: err}
+	if addr != nil {
+		e.Addr = addr.Address
+	}
+	clip := func(line []byte) []byte {
+		if len(line) > maxCapturedLineLength {
+			e.Truncated = true
+			line = line[:maxCapturedLineLength]
+		}
+		return bytes.Clone(line)
+	}
+	if req != nil {
+		for _, line := range bytes.SplitAfter(req.raw, _CRLFBytes) {
+			e.Request = append(e.Request, clip(line)...)
+		}
+	}
+	if resp != nil {
+		e.Response = make([][]byte, 0, len(resp.rawLines)+1)
+		for _, line := range resp.rawLines {
+			e.Response = append(e.Response, clip(line))
+		}
+		if resp.faultLine != nil {
+			e.Response = append(e.Response, clip(resp.faultLine))
+		}
+	}
+
+	r.mu.Lock()
+	r.errs[r.next] = e
+	r.next = (r.next + 1) % len(r.errs)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.mu.Unlock()
+}
+
+// last returns the kept errors from the oldest to the newest.
+func (r *protocolErrorRing) last() []*ProtocolError {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]*ProtocolError(nil), r.errs[:r.next]...)
+	}
+
+	errs := make([]*ProtocolError, 0, len(r.errs))
+	errs = append(errs, r.errs[r.next:]...)
+	return append(errs, r.errs[:r.next]...)
+}
+
+// captureMalformed captures the response of the request received by dispatchRequest
+// if err is ErrMalformedResponse, and returns err, see WithProtocolErrorCapture.
+func (c *client) captureMalformed(req *request, resp *response, err error) error {
+	c.protocolErrors.capture(resp.addr, req, resp, err)
+	return err
+}
+
+// LastProtocolErrors returns the last malformed responses captured by
+// WithProtocolErrorCapture, from the oldest to the newest. It's nil if the
+// capture is disabled.
+func (c *client) LastProtocolErrors() []*ProtocolError {
+	return c.protocolErrors.last()
+}
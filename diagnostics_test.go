@@ -0,0 +1,98 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_LastProtocolErrors(t *testing.T) {
+	addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+		for i := 0; i < 2; i++ {
+			line, _ := rr.ReadString('\n')
+			switch line {
+			case "touch foo 60\r\n":
+				_, _ = io.WriteString(w, "OK\r\n")
+			case "get bar\r\n":
+				// the data block is shorter than declared.
+				_, _ = io.WriteString(w, "VALUE bar 0 5\r\nabc\r\nEND\r\n")
+			}
+		}
+	})
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMaxConns(1), WithProtocolErrorCapture(4))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.ErrorIs(t, c.Touch(ctx, "foo", time.Minute), ErrMalformedResponse)
+	_, err = c.Get(ctx, "bar")
+	require.ErrorIs(t, err, ErrMalformedResponse)
+
+	errs := c.LastProtocolErrors()
+	require.Len(t, errs, 2)
+
+	// the malformed reply found by the command.
+	assert.Equal(t, addr, errs[0].Addr)
+	assert.ErrorIs(t, errs[0].Err, ErrMalformedResponse)
+	assert.Equal(t, "touch foo 60\r\n", string(errs[0].Request))
+	assert.Equal(t, [][]byte{[]byte("OK\r\n")}, errs[0].Response)
+	assert.Contains(t, errs[0].String(), `< "OK\r\n"`)
+	assert.Contains(t, errs[0].String(), "4f 4b 0d 0a")
+
+	// the malformed reply found by receiving it.
+	assert.Equal(t, addr, errs[1].Addr)
+	assert.Equal(t, "get bar\r\n", string(errs[1].Request))
+	require.NotEmpty(t, errs[1].Response)
+	assert.Equal(t, "VALUE bar 0 5\r\n", string(errs[1].Response[0]))
+}
+
+func Test_client_LastProtocolErrors_disabled(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.Nil(t, c.LastProtocolErrors())
+}
+
+func Test_protocolErrorRing(t *testing.T) {
+	r := newProtocolErrorRing(2)
+	assert.Empty(t, r.last())
+
+	capture := func(i int) {
+		req := buildRequest([]byte("get"), nil, []byte("get key:"+strconv.Itoa(i)+"\r\n"))
+		resp := acquireResponse()
+		resp.rawLines = append(resp.rawLines, []byte(strings.Repeat("x", maxCapturedLineLength+1)))
+		defer releaseReqAndResp(req, resp)
+
+		r.capture(nil, req, resp, errors.Wrap(ErrMalformedResponse, "parse failed"))
+	}
+
+	// the other errors are not captured.
+	r.capture(nil, nil, nil, ErrNotFound)
+	r.capture(nil, nil, nil, nil)
+	assert.Empty(t, r.last())
+
+	for i := 0; i < 3; i++ {
+		capture(i)
+	}
+	errs := r.last()
+	require.Len(t, errs, 2)
+	assert.Equal(t, "get key:1\r\n", string(errs[0].Request))
+	assert.Equal(t, "get key:2\r\n", string(errs[1].Request))
+	assert.True(t, errs[1].Truncated)
+	assert.Len(t, errs[1].Response[0], maxCapturedLineLength)
+
+	var nilRing *protocolErrorRing
+	nilRing.capture(nil, nil, nil, ErrMalformedResponse)
+	assert.Nil(t, nilRing.last())
+}
@@ -0,0 +1,146 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DialFunc dials a connection to the address on the named network, it's the
+// signature of net.Dialer.DialContext. See WithDialer.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// dial dials a connection to the memcached server at the Addr by the dialer,
+// nil means the net.Dialer. The dialTimeout bounds the dialer by the context.
+func (a *Addr) dial(ctx context.Context, dialTimeout time.Duration, dialer DialFunc) (net.Conn, error) {
+	if dialer == nil {
+		return (&net.Dialer{Timeout: dialTimeout}).DialContext(ctx, a.Network, a.Address)
+	}
+
+	if dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+	}
+
+	return dialer(ctx, a.Network, a.Address)
+}
+
+// socketBuffers is implemented by the TCP, UDP and unix connections.
+type socketBuffers interface {
+	SetReadBuffer(bytes int) error
+	SetWriteBuffer(bytes int) error
+}
+
+// tuneConn applies the socket options set by WithTCPKeepAlive, WithTCPNoDelay
+// and WithSocketBuffers to the connection just dialed. The connections returned
+// by a custom dialer which are not the net package ones are left as is.
+func (c *client) tuneConn(raw net.Conn) error {
+	o := c.options
+
+	if tcp, ok := raw.(*net.TCPConn); ok {
+		if o.tcpKeepAlive < 0 {
+			if err := tcp.SetKeepAlive(false); err != nil {
+				return errors.Wrap(err, "set keepalive")
+			}
+		} else {
+			if err := tcp.SetKeepAlive(true); err != nil {
+				return errors.Wrap(err, "set keepalive")
+			}
+			if err := tcp.SetKeepAlivePeriod(o.tcpKeepAlive); err != nil {
+				return errors.Wrap(err, "set keepalive period")
+			}
+		}
+
+		if err := tcp.SetNoDelay(o.tcpNoDelay); err != nil {
+			return errors.Wrap(err, "set nodelay")
+		}
+	}
+
+	if sb, ok := raw.(socketBuffers); ok {
+		if o.socketReadBuffer > 0 {
+			if err := sb.SetReadBuffer(o.socketReadBuffer); err != nil {
+				return errors.Wrap(err, "set read buffer")
+			}
+		}
+		if o.socketWriteBuffer > 0 {
+			if err := sb.SetWriteBuffer(o.socketWriteBuffer); err != nil {
+				return errors.Wrap(err, "set write buffer")
+			}
+		}
+	}
+
+	return nil
+}
+
+// HTTPConnectDialer returns a DialFunc which tunnels the TCP connections through
+// the HTTP proxy at proxyAddr by the CONNECT method, the proxy is dialed by base,
+// nil means the net.Dialer. The header, e.g. Proxy-Authorization, is sent with
+// the CONNECT request.
+//
+//	client, err := memcached.New("10.0.0.1:11211",
+//		memcached.WithDialer(memcached.HTTPConnectDialer("proxy.internal:3128", nil, nil)))
+func HTTPConnectDialer(proxyAddr string, header http.Header, base DialFunc) DialFunc {
+	if base == nil {
+		base = (&net.Dialer{}).DialContext
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return nil, errors.Wrapf(ErrInvalidNetworkProtocol, "HTTP CONNECT does not support %s", network)
+		}
+
+		cn, err := base(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "dial HTTP proxy")
+		}
+
+		if err = httpConnect(ctx, cn, address, header); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+
+		return cn, nil
+	}
+}
+
+// httpConnect asks the HTTP proxy over cn to tunnel to the address.
+func httpConnect(ctx context.Context, cn net.Conn, address string, header http.Header) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = cn.SetDeadline(deadline)
+		defer func() { _ = cn.SetDeadline(zeroTime) }()
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Host:   address,
+		Header: header,
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if err := req.Write(cn); err != nil {
+		return errors.Wrap(err, "write CONNECT request")
+	}
+
+	// the reader is dropped after the response, it's safe since the memcached
+	// server never speaks first, so nothing follows the response.
+	resp, err := http.ReadResponse(bufio.NewReader(cn), req)
+	if err != nil {
+		return errors.Wrap(err, "read CONNECT response")
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("HTTP proxy CONNECT %s: %s", address, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startConnectProxy starts an HTTP proxy which only serves the CONNECT requests
+// carrying the header "Proxy-Authorization: secret".
+func startConnectProxy(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			cn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer cn.Close()
+
+				req, err := http.ReadRequest(bufio.NewReader(cn))
+				if err != nil {
+					return
+				}
+				if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != "secret" {
+					_, _ = io.WriteString(cn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					_, _ = io.WriteString(cn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer upstream.Close()
+
+				_, _ = io.WriteString(cn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go func() { _, _ = io.Copy(upstream, cn) }()
+				_, _ = io.Copy(cn, upstream)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func Test_client_WithDialer(t *testing.T) {
+	srv := newTestServer(t)
+
+	var dialed atomic.Int32
+	dialer := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed.Add(1)
+		_, ok := ctx.Deadline()
+		assert.True(t, ok, "dial timeout is applied")
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	}
+
+	c, err := New(srv.Addr(), WithDialer(dialer))
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+	assert.Equal(t, int32(1), dialed.Load())
+}
+
+func Test_HTTPConnectDialer(t *testing.T) {
+	srv := newTestServer(t)
+	proxyAddr := startConnectProxy(t)
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		network string
+		wantErr bool
+	}{
+		{
+			name:    "tunneled",
+			header:  http.Header{"Proxy-Authorization": []string{"secret"}},
+			network: "tcp",
+		},
+		{
+			name:    "rejected by proxy",
+			network: "tcp",
+			wantErr: true,
+		},
+		{
+			name:    "unix not supported",
+			network: "unix",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := NewAddr(tt.network, srv.Addr(), 0)
+			c, err := NewFromAddrs([]*Addr{addr}, WithDialer(HTTPConnectDialer(proxyAddr, tt.header, nil)))
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			err = c.Set(ctx, "foo", []byte("bar"), 0, 0)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			item, err := c.Get(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, "bar", string(item.Value))
+		})
+	}
+}
+
+func Test_client_tuneConn(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "default"},
+		{
+			name: "tuned",
+			opts: []ClientOption{WithTCPKeepAlive(time.Minute), WithTCPNoDelay(false), WithSocketBuffers(1<<20, 1<<20)},
+		},
+		{
+			name: "keepalive disabled",
+			opts: []ClientOption{WithTCPKeepAlive(-1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tuned net.Conn
+			dialer := func(ctx context.Context, network, address string) (net.Conn, error) {
+				cn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+				tuned = cn
+				return cn, err
+			}
+
+			c, err := New(srv.Addr(), append(tt.opts, WithDialer(dialer))...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+			assert.IsType(t, &net.TCPConn{}, tuned)
+		})
+	}
+
+	// the connections which are not the net package ones are left as is.
+	c := &client{options: newClientOptions(), clientState: newClientState()}
+	WithSocketBuffers(1<<20, 1<<20)(c.options)
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+	assert.NoError(t, c.tuneConn(p1))
+}
+
+func Test_client_WithConnBufferSizes(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name         string
+		readerBytes  int
+		writerBytes  int
+		wantBuffered int
+		valueSize    int
+	}{
+		{name: "default", wantBuffered: 2 * defaultConnBufferSize, valueSize: 100},
+		{name: "tiny", readerBytes: 64, writerBytes: 64, wantBuffered: 128, valueSize: 10 << 10},
+		{name: "large", readerBytes: 256 << 10, writerBytes: 64 << 10, wantBuffered: 320 << 10, valueSize: 512 << 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(srv.Addr(), WithConnBufferSizes(tt.readerBytes, tt.writerBytes))
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			value := bytes.Repeat([]byte("v"), tt.valueSize)
+			require.NoError(t, c.Set(ctx, "foo", value, 0, 0))
+			item, err := c.Get(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, value, item.Value)
+
+			stats := c.PoolStats()[srv.Addr()]
+			require.NotNil(t, stats)
+			assert.Equal(t, stats.TotalConns*tt.wantBuffered, stats.BufferedBytes)
+			assert.Equal(t, 1, stats.TotalConns)
+		})
+	}
+}
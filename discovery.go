@@ -0,0 +1,292 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	_ ContextResolver = (*DiscoveryResolver)(nil)
+	_ WatchResolver   = (*DiscoveryResolver)(nil)
+)
+
+const (
+	// defaultDiscoveryTimeout is the default timeout of querying the cluster config
+	// from the discovery endpoint, including dialing it.
+	defaultDiscoveryTimeout = 5 * time.Second
+	// maxDiscoveryPayloadSize is the max bytes of the cluster config read from the
+	// HTTP discovery endpoint.
+	maxDiscoveryPayloadSize = 1 << 20
+)
+
+// Formats of the cluster config of the parsers registered by NewDiscoveryResolver.
+const (
+	// DiscoveryFormatCluster is the format replied to "config get cluster" by the
+	// configuration endpoints of AWS ElastiCache and Google Cloud Memorystore, the
+	// version line and the line of the nodes, each node is "hostname|ip|port".
+	DiscoveryFormatCluster = "cluster"
+	// DiscoveryFormatJSON is the JSON format, the servers listed in the same way as
+	// the seed file of FileResolver, optionally with the version of them:
+	//
+	//	{"version": 3, "nodes": [{"address": "10.0.0.1:11211", "weight": 2}]}
+	DiscoveryFormatJSON = "json"
+)
+
+// DiscoveryConfig is the cluster config reported by a discovery endpoint.
+type DiscoveryConfig struct {
+	// Version is increased every time the nodes are changed, it's 0 if the format
+	// has no version.
+	Version int64
+	// Addrs is the nodes of the cluster.
+	Addrs []*Addr
+}
+
+// DiscoveryParser parses the cluster config fetched from a discovery endpoint.
+type DiscoveryParser func(payload []byte) (*DiscoveryConfig, error)
+
+// DiscoveryResolver resolves a discovery endpoint into the nodes of the cluster
+// reported by it, the endpoint is one of:
+//
+//   - host:port or memcached://host:port, the configuration endpoint speaking the
+//     "config get cluster" convention of AWS ElastiCache and Google Cloud Memorystore.
+//   - http://... or https://..., the HTTP endpoint replying the cluster config to GET.
+//
+// The cluster config is parsed by DiscoveryFormatCluster for the former and by
+// DiscoveryFormatJSON for the latter by default, the other parser is picked by the
+// fragment of the endpoint, which is never sent to the endpoint:
+//
+//	resolver := memcached.NewDiscoveryResolver()
+//	resolver.RegisterParser("consul", parseConsulNodes)
+//	client, err := memcached.New("https://consul.internal/v1/catalog/service/memcached#consul",
+//		memcached.WithResolver(resolver))
+//
+// The nodes are resolved once when the client is created, Watch reports the changes
+// of them, and WithTopologyRefresh makes the client swap them in:
+//
+//	client, err := memcached.New("memcached://discovery.internal:11211",
+//		memcached.WithResolver(resolver), memcached.WithTopologyRefresh(time.Minute))
+type DiscoveryResolver struct {
+	timeout    time.Duration
+	dialer     net.Dialer
+	httpClient *http.Client
+
+	mu      sync.RWMutex // guards following
+	parsers map[string]DiscoveryParser
+}
+
+// NewDiscoveryResolver creates a DiscoveryResolver with the parsers of the
+// DiscoveryFormatCluster and DiscoveryFormatJSON formats.
+func NewDiscoveryResolver() *DiscoveryResolver {
+	return &DiscoveryResolver{
+		timeout:    defaultDiscoveryTimeout,
+		httpClient: http.DefaultClient,
+		parsers: map[string]DiscoveryParser{
+			DiscoveryFormatCluster: parseClusterConfig,
+			DiscoveryFormatJSON:    parseDiscoveryJSON,
+		},
+	}
+}
+
+// RegisterParser registers the parser of the format, which is picked by the fragment
+// of the endpoint, e.g. "https://discovery.internal/nodes#format". The parser of the
+// same format is replaced, including the default ones.
+func (r *DiscoveryResolver) RegisterParser(format string, parser DiscoveryParser) {
+	r.mu.Lock()
+	r.parsers[format] = parser
+	r.mu.Unlock()
+}
+
+// Resolve queries the nodes of the cluster from the discovery endpoint.
+func (r *DiscoveryResolver) Resolve(endpoint string) ([]*Addr, error) {
+	return r.ResolveContext(context.Background(), endpoint)
+}
+
+// ResolveContext is the same as Resolve, but the query is canceled if ctx is done.
+func (r *DiscoveryResolver) ResolveContext(ctx context.Context, endpoint string) ([]*Addr, error) {
+	config, _, err := r.config(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Addrs, nil
+}
+
+// Config queries the cluster config from the discovery endpoint.
+func (r *DiscoveryResolver) Config(ctx context.Context, endpoint string) (*DiscoveryConfig, error) {
+	config, _, err := r.config(ctx, endpoint)
+	return config, err
+}
+
+// Watch queries the cluster config from the discovery endpoint every interval until
+// the context is done, and calls fn with the nodes of the first config queried, then
+// every time the version of the config is increased, or the config is changed if it
+// has no version. The failed queries are skipped. Watch blocks the caller, and
+// returns the error of the context.
+func (r *DiscoveryResolver) Watch(ctx context.Context, endpoint string, interval time.Duration, fn func([]*Addr)) error {
+	return watchDiscovery(ctx, interval, func(ctx context.Context) (*DiscoveryConfig, []byte, error) {
+		return r.config(ctx, endpoint)
+	}, fn)
+}
+
+// discoveryQuery queries the cluster config from a discovery endpoint, the payload
+// fetched is returned along with it.
+type discoveryQuery func(ctx context.Context) (*DiscoveryConfig, []byte, error)
+
+// watchDiscovery runs query every interval until the context is done, and calls fn
+// with the nodes of the first config queried, then every time the version of the
+// config is increased, or the config is changed if it has no version. The failed
+// queries are skipped. It blocks the caller, and returns the error of the context.
+func watchDiscovery(ctx context.Context, interval time.Duration, query discoveryQuery, fn func([]*Addr)) error {
+	var (
+		version int64 = -1
+		last    []byte
+	)
+	poll := func() {
+		config, payload, err := query(ctx)
+		if err != nil {
+			return
+		}
+		if config.Version < version || (config.Version == version && (version != 0 || bytes.Equal(payload, last))) {
+			return
+		}
+		version, last = config.Version, payload
+		fn(config.Addrs)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for poll(); ; poll() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// config fetches the cluster config from the endpoint and parses it by the parser
+// of its format, the payload fetched is returned along with it.
+func (r *DiscoveryResolver) config(ctx context.Context, endpoint string) (*DiscoveryConfig, []byte, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return nil, nil, errors.Wrap(ErrInvalidAddress, "empty discovery endpoint")
+	}
+	endpoint, format, _ := strings.Cut(endpoint, "#")
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	scheme, address, remote := strings.Cut(endpoint, "://")
+	fetch := func(ctx context.Context) ([]byte, error) { return fetchClusterConfig(ctx, &r.dialer, address) }
+	switch {
+	case !remote:
+		address = endpoint
+		fallthrough
+	case scheme == "memcached":
+		if format == "" {
+			format = DiscoveryFormatCluster
+		}
+	case scheme == "http" || scheme == "https":
+		if format == "" {
+			format = DiscoveryFormatJSON
+		}
+		fetch = func(ctx context.Context) ([]byte, error) { return r.fetchHTTP(ctx, endpoint) }
+	default:
+		return nil, nil, errors.Wrapf(ErrInvalidAddress, "unknown scheme of discovery endpoint %s", endpoint)
+	}
+
+	r.mu.RLock()
+	parse, ok := r.parsers[format]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, nil, errors.Wrapf(ErrInvalidArgument, "unknown discovery format %q", format)
+	}
+
+	payload, err := fetch(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "query cluster config from %s", endpoint)
+	}
+
+	config, err := parse(payload)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "parse cluster config from %s", endpoint)
+	}
+	if len(config.Addrs) == 0 {
+		return nil, nil, errors.Wrapf(ErrInvalidAddress, "no nodes in cluster config from %s", endpoint)
+	}
+
+	return config, payload, nil
+}
+
+// fetchHTTP gets the cluster config from the HTTP endpoint at rawURL.
+func (r *DiscoveryResolver) fetchHTTP(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidAddress, "parse discovery endpoint: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "get")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, maxDiscoveryPayloadSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	if len(payload) > maxDiscoveryPayloadSize {
+		return nil, errors.Wrapf(ErrInvalidArgument, "cluster config exceeds %d bytes", maxDiscoveryPayloadSize)
+	}
+
+	return payload, nil
+}
+
+// discoveryJSON is the cluster config in DiscoveryFormatJSON format.
+type discoveryJSON struct {
+	Version int64        `json:"version"`
+	Nodes   []seedServer `json:"nodes"`
+}
+
+// parseDiscoveryJSON parses the cluster config in DiscoveryFormatJSON format, the
+// bare list of the servers is accepted as well.
+func parseDiscoveryJSON(payload []byte) (*DiscoveryConfig, error) {
+	var config discoveryJSON
+
+	payload = bytes.TrimSpace(payload)
+	var err error
+	if bytes.HasPrefix(payload, []byte("[")) {
+		err = json.Unmarshal(payload, &config.Nodes)
+	} else {
+		err = json.Unmarshal(payload, &config)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(ErrMalformedResponse, "parse JSON: %v", err)
+	}
+
+	addrs, err := resolveSeedServers(config.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiscoveryConfig{Version: config.Version, Addrs: addrs}, nil
+}
@@ -0,0 +1,213 @@
+package memcached
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDiscoveryServer serves the cluster config returned by config to GET.
+func newDiscoveryServer(t *testing.T, config func() string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/nodes" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(config()))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func Test_parseDiscoveryJSON(t *testing.T) {
+	config, err := parseDiscoveryJSON([]byte(`{"version": 3, "nodes": [{"address": "10.0.0.1:11211", "weight": 2}, {"address": "10.0.0.2:11211"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), config.Version)
+	require.Len(t, config.Addrs, 2)
+	assert.Equal(t, "10.0.0.1:11211", config.Addrs[0].Address)
+	assert.Equal(t, 2, config.Addrs[0].Weight)
+
+	// the bare list of the servers has no version.
+	config, err = parseDiscoveryJSON([]byte(` [{"address": "10.0.0.1:11211"}]`))
+	require.NoError(t, err)
+	assert.Zero(t, config.Version)
+	assert.Len(t, config.Addrs, 1)
+
+	_, err = parseDiscoveryJSON([]byte(`{"nodes": `))
+	require.ErrorIs(t, err, ErrMalformedResponse)
+	_, err = parseDiscoveryJSON([]byte(`[{"address": "10.0.0.1:11211", "weight": -1}]`))
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func Test_DiscoveryResolver_Resolve(t *testing.T) {
+	srv := newTestServer(t)
+	endpoint := newDiscoveryServer(t, func() string {
+		return `{"version": 1, "nodes": [{"address": "` + srv.Addr() + `"}]}`
+	})
+
+	r := NewDiscoveryResolver()
+	addrs, err := r.Resolve(endpoint.URL + "/nodes")
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, srv.Addr(), addrs[0].Address)
+
+	// the client is created with the nodes of the cluster.
+	c, err := New(endpoint.URL+"/nodes", WithResolver(r))
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+
+	// the "config get cluster" convention, e.g. Google Cloud Memorystore.
+	host, port, _ := strings.Cut(srv.Addr(), ":")
+	config := newFakeConfigEndpoint(t, false, "7\nnode1|"+host+"|"+port+"\n")
+	cfg, err := r.Config(context.Background(), "memcached://"+config.ln.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), cfg.Version)
+	assert.Equal(t, srv.Addr(), cfg.Addrs[0].Address)
+
+	_, err = r.Resolve(endpoint.URL + "/missing")
+	require.Error(t, err)
+	_, err = r.Resolve("ftp://" + srv.Addr())
+	require.ErrorIs(t, err, ErrInvalidAddress)
+	_, err = r.Resolve(endpoint.URL + "/nodes#yaml")
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func Test_DiscoveryResolver_RegisterParser(t *testing.T) {
+	endpoint := newDiscoveryServer(t, func() string { return "10.0.0.1:11211\n10.0.0.2:11211\n" })
+
+	r := NewDiscoveryResolver()
+	r.RegisterParser("lines", func(payload []byte) (*DiscoveryConfig, error) {
+		config := &DiscoveryConfig{}
+		for idx, line := range strings.Fields(string(payload)) {
+			config.Addrs = append(config.Addrs, NewAddr("tcp", line, idx))
+		}
+		return config, nil
+	})
+
+	// the parser is picked by the fragment.
+	addrs, err := r.Resolve(endpoint.URL + "/nodes#lines")
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+	assert.Equal(t, "10.0.0.2:11211", addrs[1].Address)
+
+	_, err = r.Resolve(endpoint.URL + "/nodes")
+	require.ErrorIs(t, err, ErrMalformedResponse)
+
+	// no nodes parsed.
+	r.RegisterParser("lines", func([]byte) (*DiscoveryConfig, error) { return &DiscoveryConfig{}, nil })
+	_, err = r.Resolve(endpoint.URL + "/nodes#lines")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func Test_DiscoveryResolver_Watch(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		config = `[{"address": "10.0.0.1:11211"}]`
+	)
+	endpoint := newDiscoveryServer(t, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return config
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan []*Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewDiscoveryResolver().Watch(ctx, endpoint.URL+"/nodes", 5*time.Millisecond,
+			func(addrs []*Addr) { changes <- addrs })
+	}()
+
+	// the first config is reported, then the config without version is reported
+	// when it's changed.
+	select {
+	case addrs := <-changes:
+		require.Len(t, addrs, 1)
+	case <-time.After(time.Second):
+		t.Fatal("the first config is not reported")
+	}
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	config = `[{"address": "10.0.0.1:11211"}, {"address": "10.0.0.2:11211"}]`
+	mu.Unlock()
+
+	select {
+	case addrs := <-changes:
+		require.Len(t, addrs, 2)
+		assert.Equal(t, "10.0.0.2:11211", addrs[1].Address)
+	case <-time.After(time.Second):
+		t.Fatal("the change is not reported")
+	}
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func Test_DiscoveryResolver_topologyRefresh(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	var (
+		mu    sync.Mutex
+		nodes = []string{srv1.Addr()}
+	)
+	endpoint := newDiscoveryServer(t, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return `[{"address": "` + strings.Join(nodes, `"}, {"address": "`) + `"}]`
+	})
+	setNodes := func(addrs ...string) {
+		mu.Lock()
+		nodes = addrs
+		mu.Unlock()
+	}
+
+	c, err := New(endpoint.URL+"/nodes", WithResolver(NewDiscoveryResolver()), WithTopologyRefresh(5*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+	mc := c.(*client)
+	addr1 := mc.topology().addrs[0]
+
+	ctx := context.Background()
+	keys := make([]string, 0, 50)
+	for i := 0; i < cap(keys); i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+
+	// the node added takes its share of the keys, the node kept keeps its pool.
+	setNodes(srv1.Addr(), srv2.Addr())
+	require.Eventually(t, func() bool { return len(mc.topology().addrs) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Same(t, addr1, mc.topology().addrs[0])
+	d, err := c.Distribution(keys)
+	require.NoError(t, err)
+	assert.Positive(t, d.Counts[mc.topology().addrs[1]])
+	for _, key := range keys {
+		require.NoError(t, c.Set(ctx, key, []byte("value"), 0, 0))
+	}
+
+	// the keys of the node removed are picked to the node left.
+	setNodes(srv2.Addr())
+	require.Eventually(t, func() bool { return len(mc.topology().addrs) == 1 }, time.Second, 5*time.Millisecond)
+	addr2 := mc.topology().addrs[0]
+	assert.Equal(t, srv2.Addr(), addr2.Address)
+	mc.mu.Lock()
+	assert.NotContains(t, mc.connPools, addr1)
+	mc.mu.Unlock()
+
+	d, err = c.Distribution(keys)
+	require.NoError(t, err)
+	assert.Equal(t, map[*Addr]int{addr2: len(keys)}, d.Counts)
+	for _, key := range keys {
+		require.NoError(t, c.Set(ctx, key, []byte("value"), 0, 0))
+	}
+}
@@ -14,4 +14,12 @@
 // The client also supports the cluster mode, which means that the client can connect
 // to multiple memcached instances, and embed some hash algorithm to pick a memcached
 // instance to execute a command.
+//
+// The requests and the responses are pooled and reused internally, but the values
+// returned to the caller are owned by the caller: the Item, MetaItem and other
+// results never refer to the pooled buffers, so that they could be retained and
+// modified after the command returns. The key of a MetaItem is the key given by
+// the caller, and the slices given to the commands, e.g. the value of Set, are
+// not retained after the command returns, except the ones given to Async which
+// are retained until their Futures are done.
 package memcached
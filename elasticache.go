@@ -0,0 +1,212 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	_ ContextResolver = (*ElastiCacheResolver)(nil)
+	_ WatchResolver   = (*ElastiCacheResolver)(nil)
+)
+
+// elastiCacheLegacyKey is the key holding the cluster config on the ElastiCache
+// engines before 1.4.14, which do not support "config get cluster".
+const elastiCacheLegacyKey = "AmazonElastiCache:cluster"
+
+// ElastiCacheResolver resolves the configuration endpoint of an AWS ElastiCache
+// memcached cluster into its nodes by "config get cluster", i.e. the Auto Discovery
+// of the official AWS clients:
+//
+//	client, err := memcached.New("mycluster.abc123.cfg.use1.cache.amazonaws.com:11211",
+//		memcached.WithResolver(memcached.NewElastiCacheResolver()))
+//
+// The address of each node is its private IP if it's known, otherwise the hostname,
+// and the hostname is kept in the metadata "hostname". The nodes are resolved once
+// when the client is created, Watch reports the changes of them, which are followed
+// by the client if WithTopologyRefresh is set.
+type ElastiCacheResolver struct {
+	timeout time.Duration
+	dialer  net.Dialer
+}
+
+// NewElastiCacheResolver creates an ElastiCacheResolver.
+func NewElastiCacheResolver() *ElastiCacheResolver {
+	return &ElastiCacheResolver{timeout: defaultDiscoveryTimeout}
+}
+
+// Resolve queries the nodes of the cluster from the configuration endpoint, the
+// host:port of it.
+func (r *ElastiCacheResolver) Resolve(endpoint string) ([]*Addr, error) {
+	return r.ResolveContext(context.Background(), endpoint)
+}
+
+// ResolveContext is the same as Resolve, but the query is canceled if ctx is done.
+func (r *ElastiCacheResolver) ResolveContext(ctx context.Context, endpoint string) ([]*Addr, error) {
+	config, err := r.Config(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Addrs, nil
+}
+
+// Config queries the cluster config from the configuration endpoint, the host:port
+// of it.
+func (r *ElastiCacheResolver) Config(ctx context.Context, endpoint string) (*DiscoveryConfig, error) {
+	config, _, err := r.config(ctx, endpoint)
+	return config, err
+}
+
+// Watch queries the cluster config from the configuration endpoint every interval
+// until the context is done, and calls fn with the nodes of the first config queried,
+// then every time the version of the config is increased. The failed queries are
+// skipped. Watch blocks the caller, and returns the error of the context.
+func (r *ElastiCacheResolver) Watch(ctx context.Context, endpoint string, interval time.Duration, fn func([]*Addr)) error {
+	return watchDiscovery(ctx, interval, func(ctx context.Context) (*DiscoveryConfig, []byte, error) {
+		return r.config(ctx, endpoint)
+	}, fn)
+}
+
+func (r *ElastiCacheResolver) config(ctx context.Context, endpoint string) (*DiscoveryConfig, []byte, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return nil, nil, errors.Wrap(ErrInvalidAddress, "empty configuration endpoint")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	payload, err := fetchClusterConfig(ctx, &r.dialer, endpoint)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "query cluster config from %s", endpoint)
+	}
+
+	config, err := parseClusterConfig(payload)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "parse cluster config from %s", endpoint)
+	}
+
+	return config, payload, nil
+}
+
+// fetchClusterConfig queries the cluster config by "config get cluster" from the
+// configuration endpoint at address. The ElastiCache engines before 1.4.14 are
+// queried by the key "AmazonElastiCache:cluster" instead, since they reply ERROR
+// to "config get cluster".
+func fetchClusterConfig(ctx context.Context, dialer *net.Dialer, address string) ([]byte, error) {
+	cn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial")
+	}
+	defer cn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = cn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { _ = cn.SetDeadline(time.Now()) })
+	defer stop()
+
+	rr := bufio.NewReader(cn)
+	payload, err := queryClusterConfig(cn, rr, "config get cluster\r\n")
+	if errors.Is(err, ErrNonexistentCommand) {
+		payload, err = queryClusterConfig(cn, rr, "get "+elastiCacheLegacyKey+"\r\n")
+	}
+
+	return payload, err
+}
+
+// queryClusterConfig sends the command and reads the block of the cluster config
+// replied, e.g.
+//
+//	CONFIG cluster 0 147\r\n
+//	12\n
+//	host1|10.0.0.1|11211 host2|10.0.0.2|11211\n
+//	\r\n
+//	END\r\n
+//
+// The block is led by "VALUE" instead of "CONFIG" for the legacy key.
+func queryClusterConfig(w io.Writer, rr *bufio.Reader, cmd string) ([]byte, error) {
+	if _, err := io.WriteString(w, cmd); err != nil {
+		return nil, errors.Wrap(err, "write")
+	}
+
+	line, err := rr.ReadBytes('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	line = trimCRLF(line)
+
+	fields := bytes.Fields(line)
+	switch {
+	case bytes.Equal(line, []byte("ERROR")):
+		return nil, ErrNonexistentCommand
+	case bytes.Equal(line, []byte("END")):
+		return nil, errors.Wrap(ErrNotFound, "no cluster config")
+	case len(fields) != 4 || (string(fields[0]) != "CONFIG" && string(fields[0]) != "VALUE"):
+		return nil, errors.Wrapf(ErrMalformedResponse, "unexpected line %q", line)
+	}
+
+	size, err := strconv.Atoi(string(fields[3]))
+	if err != nil || size < 0 {
+		return nil, errors.Wrapf(ErrMalformedResponse, "invalid size in %q", line)
+	}
+	payload := make([]byte, size+2)
+	if _, err = io.ReadFull(rr, payload); err != nil {
+		return nil, errors.Wrap(err, "read config")
+	}
+	if end, err := rr.ReadBytes('\n'); err != nil || !bytes.Equal(trimCRLF(end), []byte("END")) {
+		return nil, errors.Wrap(ErrMalformedResponse, "missing END")
+	}
+
+	return payload[:size], nil
+}
+
+// parseClusterConfig parses the cluster config replied to "config get cluster", the
+// version line and the line of the nodes separated by spaces, each node is
+// "hostname|ip|port".
+func parseClusterConfig(payload []byte) (*DiscoveryConfig, error) {
+	lines := strings.Split(strings.TrimRight(string(payload), "\r\n"), "\n")
+	if len(lines) < 2 {
+		return nil, errors.Wrapf(ErrMalformedResponse, "cluster config %q", payload)
+	}
+
+	version, err := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(ErrMalformedResponse, "invalid config version %q", lines[0])
+	}
+
+	nodes := strings.Fields(lines[1])
+	if len(nodes) == 0 {
+		return nil, errors.Wrap(ErrInvalidAddress, "no nodes in cluster config")
+	}
+
+	config := &DiscoveryConfig{Version: version, Addrs: make([]*Addr, 0, len(nodes))}
+	for idx, node := range nodes {
+		parts := strings.Split(node, "|")
+		if len(parts) != 3 {
+			return nil, errors.Wrapf(ErrMalformedResponse, "invalid node %q", node)
+		}
+		hostname, ip, port := parts[0], parts[1], parts[2]
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return nil, errors.Wrapf(ErrMalformedResponse, "invalid port of node %q", node)
+		}
+
+		host := ip
+		if host == "" {
+			host = hostname
+		}
+		addr := NewAddr("tcp", net.JoinHostPort(host, port), idx)
+		addr.Add("hostname", hostname)
+		config.Addrs = append(config.Addrs, addr)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,165 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConfigEndpoint is the configuration endpoint of an ElastiCache cluster, which
+// replies the cluster config to "config get cluster", or to the legacy key if legacy.
+type fakeConfigEndpoint struct {
+	ln     net.Listener
+	legacy bool
+
+	mu     sync.Mutex
+	config string
+}
+
+func newFakeConfigEndpoint(t *testing.T, legacy bool, config string) *fakeConfigEndpoint {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	e := &fakeConfigEndpoint{ln: ln, legacy: legacy, config: config}
+	go func() {
+		for {
+			cn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go e.serve(cn)
+		}
+	}()
+
+	return e
+}
+
+func (e *fakeConfigEndpoint) setConfig(config string) {
+	e.mu.Lock()
+	e.config = config
+	e.mu.Unlock()
+}
+
+func (e *fakeConfigEndpoint) serve(cn net.Conn) {
+	defer cn.Close()
+
+	rr := bufio.NewReader(cn)
+	for {
+		line, err := rr.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		e.mu.Lock()
+		config := e.config
+		e.mu.Unlock()
+
+		switch {
+		case line == "config get cluster\r\n" && !e.legacy:
+			_, _ = fmt.Fprintf(cn, "CONFIG cluster 0 %d\r\n%s\r\nEND\r\n", len(config), config)
+		case line == "get "+elastiCacheLegacyKey+"\r\n" && e.legacy:
+			_, _ = fmt.Fprintf(cn, "VALUE %s 0 %d\r\n%s\r\nEND\r\n", elastiCacheLegacyKey, len(config), config)
+		default:
+			_, _ = cn.Write([]byte("ERROR\r\n"))
+		}
+	}
+}
+
+func Test_parseClusterConfig(t *testing.T) {
+	config, err := parseClusterConfig([]byte("12\nnode1.cache.amazonaws.com|10.0.0.1|11211 node2.cache.amazonaws.com||11212\n"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), config.Version)
+	require.Len(t, config.Addrs, 2)
+	assert.Equal(t, "10.0.0.1:11211", config.Addrs[0].Address)
+	assert.Equal(t, "node1.cache.amazonaws.com", config.Addrs[0].GetMetadata("hostname"))
+	// the hostname is used if the IP is unknown.
+	assert.Equal(t, "node2.cache.amazonaws.com:11212", config.Addrs[1].Address)
+	assert.Equal(t, 1, config.Addrs[1].Priority)
+
+	for _, payload := range []string{
+		"",
+		"12",
+		"x\nhost|10.0.0.1|11211\n",
+		"12\nhost|10.0.0.1\n",
+		"12\nhost|10.0.0.1|port\n",
+	} {
+		_, err = parseClusterConfig([]byte(payload))
+		assert.ErrorIs(t, err, ErrMalformedResponse, payload)
+	}
+	_, err = parseClusterConfig([]byte("12\n \n"))
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func Test_ElastiCacheResolver_Resolve(t *testing.T) {
+	srv := newTestServer(t)
+	host, port, err := net.SplitHostPort(srv.Addr())
+	require.NoError(t, err)
+	config := "3\nnode1|" + host + "|" + port + "\n"
+
+	for _, legacy := range []bool{false, true} {
+		endpoint := newFakeConfigEndpoint(t, legacy, config)
+
+		addrs, err := NewElastiCacheResolver().Resolve(endpoint.ln.Addr().String())
+		require.NoError(t, err)
+		require.Len(t, addrs, 1)
+		assert.Equal(t, srv.Addr(), addrs[0].Address)
+
+		// the client is created with the nodes of the cluster.
+		c, err := New(endpoint.ln.Addr().String(), WithResolver(NewElastiCacheResolver()))
+		require.NoError(t, err)
+		require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+		require.NoError(t, c.Close())
+	}
+
+	_, err = NewElastiCacheResolver().Resolve(" ")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+
+	endpoint := newFakeConfigEndpoint(t, false, "oops")
+	_, err = NewElastiCacheResolver().Resolve(endpoint.ln.Addr().String())
+	require.ErrorIs(t, err, ErrMalformedResponse)
+}
+
+func Test_ElastiCacheResolver_Watch(t *testing.T) {
+	endpoint := newFakeConfigEndpoint(t, false, "1\nnode1|10.0.0.1|11211\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan []*Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewElastiCacheResolver().Watch(ctx, endpoint.ln.Addr().String(), 5*time.Millisecond,
+			func(addrs []*Addr) { changes <- addrs })
+	}()
+
+	// the nodes are reported first, then only if the version is increased.
+	select {
+	case addrs := <-changes:
+		require.Len(t, addrs, 1)
+	case <-time.After(time.Second):
+		t.Fatal("the first config is not reported")
+	}
+	endpoint.setConfig("1\nnode1|10.0.0.1|11211 node3|10.0.0.3|11211\n")
+	time.Sleep(20 * time.Millisecond)
+	endpoint.setConfig("2\nnode1|10.0.0.1|11211 node2|10.0.0.2|11211\n")
+
+	select {
+	case addrs := <-changes:
+		require.Len(t, addrs, 2)
+		assert.Equal(t, "10.0.0.2:11211", addrs[1].Address)
+		assert.Equal(t, "node2", addrs[1].GetMetadata("hostname"))
+	case <-time.After(time.Second):
+		t.Fatal("the change is not reported")
+	}
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
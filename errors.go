@@ -1,6 +1,8 @@
 package memcached
 
 import (
+	"strconv"
+
 	"github.com/pkg/errors"
 )
 
@@ -17,6 +19,16 @@ var (
 	ErrExists = errors.New("exists")
 	// ErrNotStored response by server "NOT_STORED"
 	ErrNotStored = errors.New("not stored")
+	// ErrValueTooLarge response by server "SERVER_ERROR object too large for cache",
+	// the value exceeds the item size limit of the server. It is also an ErrServerError.
+	ErrValueTooLarge = errors.WithMessage(ErrServerError, "object too large for cache")
+	// ErrServerOOM response by server "SERVER_ERROR out of memory ...",
+	// the server could not allocate memory to store the item. It is also an ErrServerError.
+	ErrServerOOM = errors.WithMessage(ErrServerError, "out of memory")
+	// ErrNonNumericValue response by server "CLIENT_ERROR cannot increment or decrement
+	// non-numeric value", the value of the item to incr or decr is not a number. It is
+	// also an ErrClientError.
+	ErrNonNumericValue = errors.WithMessage(ErrClientError, "cannot increment or decrement non-numeric value")
 	// ErrAuthenticationUnSupported represents an authentication not supported error.
 	// no need to authenticate or the server does not support PLAIN mechanism.
 	ErrAuthenticationUnSupported = errors.New("authentication not supported")
@@ -26,6 +38,30 @@ var (
 	ErrInvalidArgument = errors.New("invalid arguments")
 	// ErrNotSupported represents a not supported error.
 	ErrNotSupported = errors.New("not supported")
+	// ErrPoolWaitTimeout represents the connection pool is exhausted and no connection
+	// is returned within the wait timeout, see WithPoolWaitTimeout.
+	ErrPoolWaitTimeout = errors.New("connection pool wait timeout")
+	// ErrLockNotHeld represents the lock is not held by the Mutex, e.g. it has
+	// expired and possibly been acquired by others.
+	ErrLockNotHeld = errors.New("lock not held")
+	// ErrOverloaded represents the in-flight requests to the memcached server reach
+	// the limit and the request is shed, see WithMaxConcurrentRequests.
+	ErrOverloaded = errors.New("too many in-flight requests")
+	// ErrRateLimited represents the request exceeds the rate limit set by WithRateLimit
+	// or WithGlobalRateLimit.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrNodeDown represents the memcached server is marked down since it failed to
+	// connect recently, see WithFailOpen.
+	ErrNodeDown = errors.New("node down")
+	// ErrFailedOpen represents the request to the unavailable memcached server fails
+	// open as a cache miss, see WithFailOpen. It is also an ErrNotFound.
+	ErrFailedOpen = errors.WithMessage(ErrNotFound, "failed open")
+	// ErrChecksumMismatch represents the checksum of the value does not match it, the
+	// value is corrupted by the server, a proxy or the network, see WithChecksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrDecryptionFailed represents the value could not be decrypted, e.g. it's
+	// encrypted by an unknown key or corrupted, see AESGCMKeyring.
+	ErrDecryptionFailed = errors.New("decryption failed")
 
 	// ErrMalformedResponse represents a malformed response error, it could be returned
 	// when the response is not expected. Debug the server response to see whether it is
@@ -45,3 +81,68 @@ var (
 	// ErrInvalidNetworkProtocol represents an invalid network protocol error.
 	ErrInvalidNetworkProtocol = errors.New("invalid network protocol")
 )
+
+// CommandError is the error of a command sent to a memcached server, it tells
+// which server, command and key the error belongs to. The underlying error is
+// kept, so that errors.Is and errors.As work with the sentinel errors above:
+//
+//	var cmdErr *memcached.CommandError
+//	if errors.As(err, &cmdErr) {
+//		log.Printf("%s %s on %s: %v", cmdErr.Cmd, cmdErr.Key, cmdErr.Addr.Address, cmdErr.Err)
+//	}
+//	if errors.Is(err, memcached.ErrServerError) { ... }
+type CommandError struct {
+	// Addr is the memcached server the command is sent to.
+	Addr *Addr
+	// Cmd is the name of the command, e.g. "get" or "ms".
+	Cmd string
+	// Key is the (first) key of the command, empty if the command has no key.
+	Key string
+	// Err is the underlying error.
+	Err error
+}
+
+func newCommandError(addr *Addr, cmd, key []byte, err error) *CommandError {
+	return &CommandError{Addr: addr, Cmd: string(cmd), Key: string(key), Err: err}
+}
+
+func (e *CommandError) Error() string {
+	message := e.Cmd
+	if e.Key != "" {
+		message += " " + e.Key
+	}
+	if e.Addr != nil {
+		message += " on " + e.Addr.Address
+	}
+
+	return message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// Cause returns the underlying error, it's used by errors.Cause of github.com/pkg/errors.
+func (e *CommandError) Cause() error { return e.Err }
+
+// CASParseError is the error of the CAS unique replied by the server which is not
+// a 64-bit unsigned decimal, e.g. it overflows or is in another format. The items
+// are returned with CAS 0 instead if the CAS uniques are parsed leniently, see
+// WithCASParsing. The underlying error is strconv.ErrRange or strconv.ErrSyntax:
+//
+//	var casErr *memcached.CASParseError
+//	if errors.As(err, &casErr) {
+//		log.Printf("unsupported CAS unique %q: %v", casErr.Token, casErr.Err)
+//	}
+type CASParseError struct {
+	// Token is the CAS unique replied.
+	Token string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *CASParseError) Error() string {
+	return "invalid CAS unique " + strconv.Quote(e.Token) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *CASParseError) Unwrap() error { return e.Err }
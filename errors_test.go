@@ -0,0 +1,123 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CommandError(t *testing.T) {
+	addr := NewAddr("tcp", "127.0.0.1:11211", 0)
+
+	tests := []struct {
+		name string
+		err  *CommandError
+		want string
+	}{
+		{
+			name: "with key",
+			err:  newCommandError(addr, []byte("get"), []byte("foo"), ErrServerError),
+			want: "get foo on 127.0.0.1:11211: server error",
+		},
+		{
+			name: "without key",
+			err:  newCommandError(addr, []byte("flush_all"), nil, ErrClientError),
+			want: "flush_all on 127.0.0.1:11211: client error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.err.Error())
+
+			wrapped := pkgerrors.Wrap(tt.err, "request failed")
+			assert.ErrorIs(t, wrapped, tt.err.Err)
+			assert.Equal(t, tt.err.Err, pkgerrors.Cause(wrapped))
+
+			var cmdErr *CommandError
+			require.ErrorAs(t, wrapped, &cmdErr)
+			assert.Same(t, addr, cmdErr.Addr)
+		})
+	}
+}
+
+func Test_CommandError_returnedByClient(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithReadTimeout(200*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	_, err = c.Incr(ctx, "foo", 1)
+	require.ErrorIs(t, err, ErrClientError)
+	var cmdErr *CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	assert.Equal(t, "incr", cmdErr.Cmd)
+	assert.Equal(t, "foo", cmdErr.Key)
+	assert.Equal(t, srv.Addr(), cmdErr.Addr.Address)
+
+	srv.Stop()
+	err = c.FlushAll(ctx)
+	require.Error(t, err)
+	require.ErrorAs(t, err, &cmdErr)
+	assert.Equal(t, "flush_all", cmdErr.Cmd)
+	assert.Empty(t, cmdErr.Key)
+	assert.Equal(t, srv.Addr(), cmdErr.Addr.Address)
+}
+
+func Test_StoreResultOf(t *testing.T) {
+	addr := NewAddr("tcp", "127.0.0.1:11211", 0)
+
+	tests := []struct {
+		name    string
+		err     error
+		want    StoreResult
+		wantErr error
+	}{
+		{name: "stored", err: nil, want: StoreResultStored},
+		{name: "not stored", err: ErrNotStored, want: StoreResultNotStored},
+		{name: "exists", err: ErrExists, want: StoreResultExists},
+		{name: "not found", err: ErrNotFound, want: StoreResultNotFound},
+		{
+			name: "wrapped exists",
+			err:  pkgerrors.Wrap(newCommandError(addr, []byte("ms"), []byte("foo"), ErrExists), "request failed"),
+			want: StoreResultExists,
+		},
+		{name: "failed", err: ErrServerError, want: StoreResultFailed, wantErr: ErrServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StoreResultOf(tt.err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_storageCommand_outcomes(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	// the outcomes are returned as the bare sentinels.
+	assert.Equal(t, ErrNotStored, c.Add(ctx, "foo", []byte("baz"), 0, 0))
+	assert.Equal(t, ErrNotStored, c.Replace(ctx, "missing", []byte("baz"), 0, 0))
+	assert.Equal(t, ErrExists, c.Cas(ctx, "foo", []byte("baz"), 0, 0, 1<<40))
+	assert.Equal(t, ErrNotFound, c.Cas(ctx, "missing", []byte("baz"), 0, 0, 1))
+
+	result, err := StoreResultOf(c.Add(ctx, "foo", []byte("baz"), 0, 0))
+	require.NoError(t, err)
+	assert.Equal(t, StoreResultNotStored, result)
+	assert.Equal(t, "NOT_STORED", result.String())
+}
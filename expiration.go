@@ -0,0 +1,150 @@
+package memcached
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxRelativeExpiration is the maximum exptime which is interpreted by memcached
+// as a relative number of seconds (30 days), the exptime greater than it is
+// interpreted as an absolute Unix timestamp.
+const maxRelativeExpiration = 60 * 60 * 24 * 30
+
+// minAbsoluteExpiration is the minimum absolute Unix timestamp (2000-01-01T00:00:00Z)
+// accepted by the client. An exptime between 30 days and it is almost certainly a
+// relative number of seconds by mistake, e.g. 60*60*24*40, which would be interpreted
+// as a timestamp in 1970 and make the item expire immediately.
+const minAbsoluteExpiration = 946684800
+
+// Expiration represents the exptime of an item in memcached protocol.
+//
+// The memcached server interprets the exptime as a relative number of seconds
+// if it is less than or equal to 30 days, otherwise as an absolute Unix timestamp.
+// Expiration handles the rule explicitly, so that create it with FromDuration or
+// FromUnix rather than converting a number directly.
+type Expiration int64
+
+const (
+	// NoExpiration means the item never expires.
+	NoExpiration Expiration = 0
+	// ExpireImmediately means the item expires immediately.
+	ExpireImmediately Expiration = -1
+)
+
+// FromDuration creates an Expiration which expires after the given duration.
+//
+// The duration is rounded up to whole seconds, e.g. 500ms expires after 1s and
+// 1500ms after 2s. Zero means NoExpiration, negative duration means ExpireImmediately.
+// The duration longer than 30 days is converted to an absolute Unix timestamp.
+//
+// Note that the time.Duration parameters of the commands used to be truncated to
+// whole seconds, so that a duration less than one second was sent as 0 and the
+// item never expired.
+func FromDuration(d time.Duration) Expiration {
+	return expirationAfter(nowFunc(), d)
+}
+
+// expirationAfter is FromDuration with the current time given, which is used to
+// convert the duration longer than 30 days.
+func expirationAfter(now time.Time, d time.Duration) Expiration {
+	switch {
+	case d == 0:
+		return NoExpiration
+	case d < 0:
+		return ExpireImmediately
+	}
+
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds <= maxRelativeExpiration {
+		return Expiration(seconds)
+	}
+
+	return Expiration(now.Add(d).Unix())
+}
+
+// FromUnix creates an Expiration which expires at the given Unix timestamp.
+//
+// The timestamp before 2000 is in the past and some of them could not be distinguished
+// from a relative exptime by the server, so that ExpireImmediately is returned.
+func FromUnix(timestamp int64) Expiration {
+	if timestamp < minAbsoluteExpiration {
+		return ExpireImmediately
+	}
+
+	return Expiration(timestamp)
+}
+
+// ExpireAt creates an Expiration which expires at the given time. The zero time
+// means NoExpiration, and the time before 2000 means ExpireImmediately.
+func ExpireAt(t time.Time) Expiration {
+	if t.IsZero() {
+		return NoExpiration
+	}
+
+	timestamp := t.Unix()
+	if timestamp < minAbsoluteExpiration {
+		return ExpireImmediately
+	}
+
+	return Expiration(timestamp)
+}
+
+// Duration returns the time until the item expires, it returns 0 if the item
+// never expires, and a negative duration if the item has expired.
+func (e Expiration) Duration() time.Duration {
+	switch {
+	case e == NoExpiration:
+		return 0
+	case e < 0:
+		return time.Duration(e) * time.Second
+	case e <= maxRelativeExpiration:
+		return time.Duration(e) * time.Second
+	}
+
+	return time.Unix(int64(e), 0).Sub(nowFunc())
+}
+
+// IsAbsolute reports whether the Expiration is an absolute Unix timestamp.
+func (e Expiration) IsAbsolute() bool {
+	return e > maxRelativeExpiration
+}
+
+// String returns the exptime token sent to the server.
+func (e Expiration) String() string {
+	return strconv.FormatInt(int64(e), 10)
+}
+
+// validate checks the Expiration is not a relative number of seconds greater than 30 days.
+func (e Expiration) validate() error {
+	if e > maxRelativeExpiration && e < minAbsoluteExpiration {
+		return errors.Wrapf(ErrInvalidArgument,
+			"exptime %d exceeds 30 days and would be interpreted as a Unix timestamp in 1970, "+
+				"use FromDuration or ExpireAt instead", int64(e))
+	}
+
+	return nil
+}
+
+// validateTTL checks the TTL token of meta commands, the same rule as Expiration applies.
+func validateTTL(flag string, ttl uint64) error {
+	if ttl > maxRelativeExpiration && ttl < minAbsoluteExpiration {
+		return errors.Wrapf(ErrInvalidArgument,
+			"%s(token) %d exceeds 30 days and would be interpreted as a Unix timestamp in 1970, "+
+				"use the ExpireAt flag option instead", flag, ttl)
+	}
+
+	return nil
+}
+
+// metaTTL converts the Expiration to the TTL token of meta commands. The token is
+// unsigned, so that the expired time is converted to a timestamp in the past which
+// makes the item expire immediately as well.
+func metaTTL(e Expiration) uint64 {
+	if e < 0 {
+		return minAbsoluteExpiration
+	}
+
+	return uint64(e)
+}
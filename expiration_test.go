@@ -0,0 +1,109 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memcodec "github.com/yeqown/memcached/codec"
+)
+
+func TestFromDuration(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     Expiration
+	}{
+		{name: "zero means never expires", duration: 0, want: NoExpiration},
+		{name: "negative means expires immediately", duration: -time.Second, want: ExpireImmediately},
+		{name: "less than one second is rounded up", duration: 100 * time.Millisecond, want: 1},
+		{name: "one nanosecond is rounded up", duration: time.Nanosecond, want: 1},
+		{name: "whole seconds are kept", duration: 2 * time.Second, want: 2},
+		{name: "fractional seconds are rounded up", duration: 1500 * time.Millisecond, want: 2},
+		{name: "relative seconds", duration: time.Hour, want: 3600},
+		{name: "exactly 30 days is relative", duration: 30 * 24 * time.Hour, want: maxRelativeExpiration},
+		{
+			name:     "more than 30 days is absolute",
+			duration: 40 * 24 * time.Hour,
+			want:     Expiration(now.Add(40 * 24 * time.Hour).Unix()),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FromDuration(tt.duration)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.duration > 30*24*time.Hour, got.IsAbsolute())
+		})
+	}
+}
+
+func TestFromUnix(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	exp := FromUnix(now.Add(time.Hour).Unix())
+	assert.True(t, exp.IsAbsolute())
+	assert.Equal(t, time.Hour, exp.Duration())
+	assert.Equal(t, "1700003600", exp.String())
+
+	// timestamps in the first 30 days of 1970 would be treated as relative seconds.
+	assert.Equal(t, ExpireImmediately, FromUnix(60*60*24*10))
+}
+
+func Test_buildStorageCommandWithExpiration(t *testing.T) {
+	req, _, err := buildStorageCommand("set", "foo", []byte("bar"), 0, FromUnix(1700000000), false, memcodec.Noop)
+	require.NoError(t, err)
+	assert.Equal(t, "set foo 0 1700000000 3\r\nbar\r\n", string(req.raw))
+
+	req, _ = buildTouchCommand("foo", ExpireImmediately, false)
+	assert.Equal(t, "touch foo -1\r\n", string(req.raw))
+
+	// the sub-second duration used to be truncated to 0, which never expires.
+	req, _, err = buildStorageCommand("set", "foo", []byte("bar"), 0, FromDuration(500*time.Millisecond), false, memcodec.Noop)
+	require.NoError(t, err)
+	assert.Equal(t, "set foo 0 1 3\r\nbar\r\n", string(req.raw))
+}
+
+func TestExpireAt(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+
+	assert.Equal(t, Expiration(1700000000), ExpireAt(at))
+	assert.Equal(t, NoExpiration, ExpireAt(time.Time{}))
+	assert.Equal(t, ExpireImmediately, ExpireAt(time.Unix(60*60*24*40, 0)))
+
+	flags := &metaSetFlags{}
+	MetaSetFlagExpireAt(at)(flags)
+	assert.Equal(t, uint64(1700000000), flags.T)
+
+	// the expired time is still a timestamp in the past.
+	mgFlags := &metaGetFlags{}
+	MetaGetFlagUpdateExpireAt(time.Unix(100, 0))(mgFlags)
+	assert.Equal(t, uint64(minAbsoluteExpiration), mgFlags.T)
+}
+
+func TestExpirationBoundaryValidation(t *testing.T) {
+	c := &client{options: newClientOptions(), clientState: newClientState()}
+	fortyDays := 60 * 60 * 24 * 40
+
+	err := c.SetWithExpiration(context.Background(), "key", []byte("value"), 0, Expiration(fortyDays))
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	err = c.TouchWithExpiration(context.Background(), "key", Expiration(fortyDays))
+	require.ErrorIs(t, err, ErrInvalidArgument)
+
+	_, err = c.MetaSet(context.Background(), []byte("key"), []byte("value"), MetaSetFlagTTL(uint64(fortyDays)))
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = c.MetaGet(context.Background(), []byte("key"), MetaGetFlagUpdateRemainingTTL(uint64(fortyDays)))
+	require.ErrorIs(t, err, ErrInvalidArgument)
+
+	assert.NoError(t, FromDuration(40*24*time.Hour).validate())
+	assert.NoError(t, validateTTL("T", maxRelativeExpiration))
+}
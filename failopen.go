@@ -0,0 +1,118 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// failOpenCooldown is the duration a memcached server is marked down after failing
+// to connect, the requests to it fail open at once during the duration.
+const failOpenCooldown = time.Second
+
+// failOpenReplies are the replies faked for the unconditional writes which fail
+// open, so that they are handled as done by the callers. The conditional writes,
+// e.g. add, cas and the meta ones comparing the CAS unique or switching the mode,
+// fail as usual, since whether they would be done is unknown.
+var failOpenReplies = map[string][]byte{
+	"set": _StoredCRLFBytes, "delete": _DeletedCRLFBytes, "touch": _TouchedCRLFBytes,
+	"ms": []byte("HD\r\n"), "md": []byte("HD\r\n"),
+}
+
+// failOpenMisses are the commands which fail open as missed, the other commands,
+// e.g. version, stats and flush_all, fail as usual.
+var failOpenMisses = map[string]struct{}{
+	"get": {}, "gets": {}, "gat": {}, "gats": {},
+	"incr": {}, "decr": {},
+	"mg": {}, "ma": {},
+}
+
+// conditionalMeta reports whether the meta write compares the CAS unique by the C
+// flag or switches the mode by the M flag, e.g. MA for add.
+//
+// ms <key> <datalen> <flags>*\r\n
+// md <key> <flags>*\r\n
+func conditionalMeta(req *request) bool {
+	line, _, _ := bytes.Cut(req.raw, _CRLFBytes)
+	fields := bytes.Fields(line)
+	start := 2
+	if string(req.cmd) == "ms" {
+		start = 3
+	}
+
+	for _, flag := range fields[min(start, len(fields)):] {
+		if flag[0] == 'C' || flag[0] == 'M' {
+			return true
+		}
+	}
+
+	return false
+}
+
+// failOpenBreaker marks one memcached server down after it fails to connect, and
+// counts the requests to it which fail open, see WithFailOpen.
+type failOpenBreaker struct {
+	// downUntil is the time in unix nanoseconds until which the server is down.
+	downUntil atomic.Int64
+	// failedOpen is the number of requests which fail open.
+	failedOpen atomic.Int64
+}
+
+// down reports whether the server is marked down at now.
+func (b *failOpenBreaker) down(now time.Time) bool {
+	return now.UnixNano() < b.downUntil.Load()
+}
+
+// trip marks the server down for failOpenCooldown from now.
+func (b *failOpenBreaker) trip(now time.Time) {
+	b.downUntil.Store(now.Add(failOpenCooldown).UnixNano())
+}
+
+// isUnavailable reports whether the error means the memcached server could not
+// be reached or does not reply in time, rather than it replies an error.
+func isUnavailable(err error) bool {
+	if errors.Is(err, ErrNodeDown) {
+		return true
+	}
+	// the context canceled by the caller is not an outage of the server.
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// failOpen turns the error of the request to the unavailable memcached server,
+// whose breaker is b, into a cache miss or a no-op unconditional write, the other
+// errors are returned as is.
+func (c *client) failOpen(b *failOpenBreaker, req *request, resp *response, err error) error {
+	if err == nil || !isUnavailable(err) {
+		return err
+	}
+
+	cmd := string(req.cmd)
+	if reply, ok := failOpenReplies[cmd]; ok && !conditionalMeta(req) {
+		resp.rewind()
+		resp.rawLines = append(resp.rawLines, resp.retain(reply))
+		b.failedOpen.Add(1)
+		return nil
+	}
+	if _, ok := failOpenMisses[cmd]; ok {
+		b.failedOpen.Add(1)
+		return ErrFailedOpen
+	}
+
+	return err
+}
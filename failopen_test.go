@@ -0,0 +1,102 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_failOpen(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithFailOpen(), WithDialTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+	srv.Stop()
+
+	// the reads miss, and the unconditional writes are no-ops.
+	_, err = c.Get(ctx, "foo")
+	require.ErrorIs(t, err, ErrFailedOpen)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = c.Gets(ctx, "foo", "bar")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = c.Incr(ctx, "foo", 1)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, c.Set(ctx, "foo", []byte("baz"), 0, 0))
+	require.NoError(t, c.Delete(ctx, "foo"))
+	require.NoError(t, c.Touch(ctx, "foo", time.Minute))
+	_, err = c.MetaSet(ctx, []byte("foo"), []byte("baz"))
+	require.NoError(t, err)
+	_, err = c.MetaDelete(ctx, []byte("foo"))
+	require.NoError(t, err)
+
+	// the conditional writes and the other commands fail as usual.
+	isFailed := func(err error) {
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrNotFound)
+	}
+	isFailed(c.Add(ctx, "foo", []byte("baz"), 0, 0))
+	isFailed(c.Replace(ctx, "foo", []byte("baz"), 0, 0))
+	isFailed(c.Cas(ctx, "foo", []byte("baz"), 0, 0, 1))
+	_, err = c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagCompareCAS(1))
+	isFailed(err)
+	_, err = c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagModeSwitch(MetaSetModeAdd))
+	isFailed(err)
+	_, err = c.MetaDelete(ctx, []byte("foo"), MetaDeleteFlagCompareCAS(1))
+	isFailed(err)
+	_, err = c.Version(ctx)
+	isFailed(err)
+
+	assert.Equal(t, int64(8), c.PoolStats()[srv.Addr()].FailedOpenRequests)
+
+	// the server is marked down, so that it's not connected even if it's back.
+	accepted := srv.Accepted()
+	require.NoError(t, srv.Restart())
+	_, err = c.Get(ctx, "foo")
+	require.ErrorIs(t, err, ErrFailedOpen)
+	assert.Equal(t, accepted, srv.Accepted())
+}
+
+func Test_client_failOpen_cluster(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr()+","+srv2.Addr(), WithFailOpen())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	keys := make([]string, 0, 16)
+	for i := 0; i < 16; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		require.NoError(t, c.Set(ctx, key, []byte("value"), 0, 0))
+	}
+	srv2.Stop()
+
+	// the keys of the unavailable server are missed.
+	items, err := c.Gets(ctx, keys...)
+	require.NoError(t, err)
+	assert.NotEmpty(t, items)
+	assert.Less(t, len(items), len(keys))
+	for _, item := range items {
+		node, err := c.WhichNode(item.Key)
+		require.NoError(t, err)
+		assert.Equal(t, srv1.Addr(), node.Address)
+	}
+}
+
+func Test_failOpenBreaker(t *testing.T) {
+	now := time.Now()
+
+	b := &failOpenBreaker{}
+	assert.False(t, b.down(now))
+
+	b.trip(now)
+	assert.True(t, b.down(now))
+	assert.False(t, b.down(now.Add(failOpenCooldown)))
+}
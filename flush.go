@@ -0,0 +1,104 @@
+package memcached
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ScheduledFlush is a delayed flush_all scheduled by ScheduleFlush.
+type ScheduledFlush struct {
+	Addr *Addr
+	// At is the time the server flushes all the items at.
+	At time.Time
+}
+
+// ScheduleFlush schedules the memcached server at addr, one of the servers of the
+// client, to flush all the items after the delay by `flush_all <delay>`. The items
+// stored before the flush is due are flushed as well. The delay must be positive,
+// use FlushAll to flush immediately.
+//
+// memcached keeps one pending flush per server, a later ScheduleFlush replaces it
+// and FlushAll flushes it at once, but it could not be cancelled, so that the
+// client keeps track of the flushes it schedules, see ScheduledFlushes. The flushes
+// scheduled by other clients or lost by the server restarting are not tracked.
+func (c *client) ScheduleFlush(ctx context.Context, addr *Addr, delay time.Duration) (err error) {
+	if delay <= 0 {
+		return errors.Wrapf(ErrInvalidArgument, "flush delay %s", delay)
+	}
+	addr, err = c.lookupAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	cn, err := c.getConn(ctx, addr)
+	if err != nil {
+		return newCommandError(addr, []byte("flush_all"), nil, err)
+	}
+	defer func() { releaseConn(cn, err) }()
+
+	now := c.now()
+	exptime := expirationAfter(now, delay)
+	if err = c.flushAllOn(ctx, addr, cn, exptime); err != nil {
+		return newCommandError(addr, []byte("flush_all"), nil, err)
+	}
+
+	at := time.Unix(int64(exptime), 0)
+	if exptime <= maxRelativeExpiration {
+		at = now.Add(time.Duration(exptime) * time.Second)
+	}
+	c.setScheduledFlush(addr, at)
+
+	return nil
+}
+
+// ScheduledFlushes lists the flushes scheduled by ScheduleFlush which are not due
+// yet, ordered by the address of the servers.
+func (c *client) ScheduledFlushes() []ScheduledFlush {
+	now := c.now()
+
+	c.mu.Lock()
+	flushes := make([]ScheduledFlush, 0, len(c.scheduledFlushes))
+	for addr, at := range c.scheduledFlushes {
+		if !now.Before(at) {
+			delete(c.scheduledFlushes, addr)
+			continue
+		}
+		flushes = append(flushes, ScheduledFlush{Addr: addr, At: at})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(flushes, func(i, j int) bool { return flushes[i].Addr.Address < flushes[j].Addr.Address })
+	return flushes
+}
+
+// setScheduledFlush records the flush of the server at given address due at, the
+// zero time clears it.
+func (c *client) setScheduledFlush(addr *Addr, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if at.IsZero() {
+		delete(c.scheduledFlushes, addr)
+		return
+	}
+	c.scheduledFlushes[addr] = at
+}
+
+// lookupAddr returns the server of the client which is addr or has the same
+// address, ErrInvalidArgument is returned if there is none.
+func (c *client) lookupAddr(addr *Addr) (*Addr, error) {
+	if addr == nil {
+		return nil, errors.Wrap(ErrInvalidArgument, "nil addr")
+	}
+
+	for _, candidate := range c.topology().addrs {
+		if candidate == addr || candidate.Address == addr.Address {
+			return candidate, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrInvalidArgument, "unknown server %s", addr.Address)
+}
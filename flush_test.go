@@ -0,0 +1,98 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_buildFlushAllCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   Expiration
+		noReply bool
+		want    string
+	}{
+		{name: "immediately", delay: NoExpiration, want: "flush_all\r\n"},
+		{name: "delayed", delay: FromDuration(time.Minute), want: "flush_all 60\r\n"},
+		{name: "delayed noreply", delay: FromDuration(time.Minute), noReply: true, want: "flush_all 60 noreply\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, resp := buildFlushAllCommand(tt.delay, tt.noReply)
+			defer releaseReqAndResp(req, resp)
+			assert.Equal(t, tt.want, string(req.raw))
+		})
+	}
+}
+
+func Test_client_ScheduleFlush(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	now := time.Now()
+	clock := &fakeClock{now: now}
+	c, err := New(srv1.Addr()+","+srv2.Addr(), WithClock(clock))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	addr1, addr2 := c.(*client).topology().addrs[0], c.(*client).topology().addrs[1]
+	key := func(addr *Addr) string {
+		for i := 0; ; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if node, err := c.WhichNode(key); err == nil && node == addr {
+				return key
+			}
+		}
+	}
+	key1, key2 := key(addr1), key(addr2)
+	require.NoError(t, c.Set(ctx, key1, []byte("1"), 0, 0))
+	require.NoError(t, c.Set(ctx, key2, []byte("2"), 0, 0))
+
+	require.NoError(t, c.ScheduleFlush(ctx, &Addr{Address: addr1.Address}, 10*time.Second))
+	require.NoError(t, c.ScheduleFlush(ctx, addr2, time.Minute))
+	// the later flush replaces the pending one.
+	require.NoError(t, c.ScheduleFlush(ctx, addr2, 30*time.Second))
+	assert.Equal(t, []ScheduledFlush{
+		{Addr: addr1, At: now.Add(10 * time.Second)},
+		{Addr: addr2, At: now.Add(30 * time.Second)},
+	}, sortedFlushes(c.ScheduledFlushes(), addr1, addr2))
+
+	_, err = c.Get(ctx, key1)
+	require.NoError(t, err)
+
+	srv1.Advance(11 * time.Second)
+	clock.advance(11 * time.Second)
+	now = now.Add(11 * time.Second)
+	_, err = c.Get(ctx, key1)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = c.Get(ctx, key2)
+	require.NoError(t, err)
+	assert.Equal(t, []ScheduledFlush{{Addr: addr2, At: now.Add(19 * time.Second)}}, c.ScheduledFlushes())
+
+	// the flush replaces all the pending ones.
+	require.NoError(t, c.FlushAll(ctx))
+	assert.Empty(t, c.ScheduledFlushes())
+
+	require.ErrorIs(t, c.ScheduleFlush(ctx, addr1, 0), ErrInvalidArgument)
+	require.ErrorIs(t, c.ScheduleFlush(ctx, &Addr{Address: "unknown:11211"}, time.Second), ErrInvalidArgument)
+}
+
+// sortedFlushes orders the flushes as the given addresses, since the addresses of
+// the test servers are not ordered.
+func sortedFlushes(flushes []ScheduledFlush, addrs ...*Addr) []ScheduledFlush {
+	sorted := make([]ScheduledFlush, 0, len(flushes))
+	for _, addr := range addrs {
+		for _, flush := range flushes {
+			if flush.Addr == addr {
+				sorted = append(sorted, flush)
+			}
+		}
+	}
+
+	return sorted
+}
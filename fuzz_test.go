@@ -0,0 +1,111 @@
+package memcached
+
+import (
+	"bytes"
+	"testing"
+
+	memcodec "github.com/yeqown/memcached/codec"
+)
+
+// splitLines splits the raw response into lines ending with '\n' as the response
+// reader does, the last line without '\n' is kept as well.
+func splitLines(raw []byte) [][]byte {
+	lines := make([][]byte, 0, 4)
+	for len(raw) > 0 {
+		i := bytes.IndexByte(raw, '\n')
+		if i < 0 {
+			lines = append(lines, raw)
+			break
+		}
+		lines = append(lines, raw[:i+1])
+		raw = raw[i+1:]
+	}
+
+	return lines
+}
+
+func FuzzParseValueItems(f *testing.F) {
+	// responses captured from memcached 1.6.21
+	f.Add([]byte("VALUE foo 0 3\r\nbar\r\nEND\r\n"), false)
+	f.Add([]byte("VALUE foo 12 3 26\r\nbar\r\nVALUE baz 0 0 27\r\n\r\nEND\r\n"), true)
+	f.Add([]byte("VALUE foo 0 5\r\nb\r\nr\r\nEND\r\n"), false)
+	f.Add([]byte("END\r\n"), false)
+	f.Add([]byte("VALUE  0 3\r\nbar\r\nEND\r\n"), true)
+	f.Add([]byte("VALUE foo 4294967296 18446744073709551616\r\nbar\r\nEND\r\n"), true)
+
+	f.Fuzz(func(t *testing.T, raw []byte, withCAS bool) {
+		lines := splitLines(raw)
+		_, _ = parseValueItems(lines, false, withCAS, memcodec.Noop)
+		_, _ = parseValueItems(lines, true, withCAS, memcodec.Noop)
+	})
+}
+
+func FuzzParseMetaItem(f *testing.F) {
+	// responses captured from memcached 1.6.21
+	f.Add([]byte("VA 3 c26 kZm9v b O456 s3 f12 t-1\r\nbar\r\n"))
+	f.Add([]byte("HD c26 kfoo O456 h1 l30\r\n"))
+	f.Add([]byte("EN\r\n"))
+	f.Add([]byte("NS\r\n"))
+	f.Add([]byte("VA\r\n"))
+	f.Add([]byte("HD  c\r\n"))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		item := &MetaItem{}
+		_ = parseMetaItem(splitLines(raw), item, false, memcodec.Noop)
+		_ = parseMetaItem(splitLines(raw), item, true, memcodec.Noop)
+	})
+}
+
+func FuzzParseMetaItemDebug(f *testing.F) {
+	// responses captured from memcached 1.6.21
+	f.Add([]byte("ME foo exp=-1 la=2 cas=18 fetch=no cls=1 size=65\r\n"))
+	f.Add([]byte("EN\r\n"))
+	f.Add([]byte("ME\r\n"))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		_ = parseMetaItemDebug(splitLines(raw), &MetaItemDebug{})
+	})
+}
+
+func FuzzParseStats(f *testing.F) {
+	// responses captured from memcached 1.6.21
+	f.Add([]byte("STAT pid 1\r\nSTAT uptime 3600\r\nSTAT version 1.6.21\r\nSTAT rusage_user 0.123456\r\n" +
+		"STAT accepting_conns 1\r\nEND\r\n"))
+	f.Add([]byte("STAT pid\r\nSTAT  \r\nEND\r\n"))
+	f.Add([]byte("STAT rusage_user NaN\r\nSTAT version 1 2\r\n"))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		_, _ = parseStats(splitLines(raw))
+	})
+}
+
+func FuzzBinaryResponseRead(f *testing.F) {
+	// the response of SASL list mechanisms captured from memcached 1.6.21
+	f.Add([]byte{
+		0x81, 0x20, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x05,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		'P', 'L', 'A', 'I', 'N',
+	})
+	// key and extras length exceed the total body length
+	f.Add([]byte{
+		0x81, 0x21, 0x00, 0x08,
+		0x04, 0x00, 0x00, 0x20,
+		0x00, 0x00, 0x00, 0x03,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		'k', 'e', 'y',
+	})
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		br := &binaryResponse{}
+		if err := br.read(bytes.NewReader(raw)); err != nil {
+			return
+		}
+		_ = br.expect(_binaryStatusOK)
+	})
+}
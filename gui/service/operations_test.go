@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"io"
 	"testing"
 	"time"
 
@@ -57,6 +58,30 @@ func (f *fakeMemcachedClient) Cas(context.Context, string, []byte, uint32, time.
 	return nil
 }
 
+func (f *fakeMemcachedClient) SetWithExpiration(context.Context, string, []byte, uint32, memcached.Expiration) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) AddWithExpiration(context.Context, string, []byte, uint32, memcached.Expiration) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) ReplaceWithExpiration(context.Context, string, []byte, uint32, memcached.Expiration) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) AppendWithExpiration(context.Context, string, []byte, uint32, memcached.Expiration) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) PrependWithExpiration(context.Context, string, []byte, uint32, memcached.Expiration) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) CasWithExpiration(context.Context, string, []byte, uint32, memcached.Expiration, uint64) error {
+	return nil
+}
+
 func (f *fakeMemcachedClient) Get(ctx context.Context, key string) (*memcached.Item, error) {
 	f.getCalled = true
 	return &memcached.Item{Key: key, Value: []byte("plain-value")}, nil
@@ -74,6 +99,26 @@ func (f *fakeMemcachedClient) GetAndTouches(context.Context, time.Duration, ...s
 	return nil, nil
 }
 
+func (f *fakeMemcachedClient) GetAndTouchWithExpiration(context.Context, memcached.Expiration, string) (*memcached.Item, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) GetAndTouchesWithExpiration(context.Context, memcached.Expiration, ...string) ([]*memcached.Item, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) TouchAndGetMulti(context.Context, map[string]uint32) (map[string]*memcached.Item, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) GetValue(context.Context, string) (*memcached.Value, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) GetAndTouchValue(context.Context, time.Duration, string) (*memcached.Value, error) {
+	return nil, nil
+}
+
 func (f *fakeMemcachedClient) Delete(context.Context, string) error { return nil }
 
 func (f *fakeMemcachedClient) Incr(context.Context, string, uint64) (uint64, error) { return 0, nil }
@@ -82,10 +127,60 @@ func (f *fakeMemcachedClient) Decr(context.Context, string, uint64) (uint64, err
 
 func (f *fakeMemcachedClient) Touch(context.Context, string, time.Duration) error { return nil }
 
+func (f *fakeMemcachedClient) TouchWithExpiration(context.Context, string, memcached.Expiration) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) SetItem(context.Context, string, []byte, uint32, time.Duration) (*memcached.MetaItem, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) AddItem(context.Context, string, []byte, uint32, time.Duration) (*memcached.MetaItem, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) ReplaceItem(context.Context, string, []byte, uint32, time.Duration) (*memcached.MetaItem, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) AppendItem(context.Context, string, []byte) (*memcached.MetaItem, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) PrependItem(context.Context, string, []byte) (*memcached.MetaItem, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) CasItem(context.Context, string, []byte, uint32, time.Duration, uint64) (*memcached.MetaItem, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) DeleteMulti(context.Context, []string) map[string]error { return nil }
+
+func (f *fakeMemcachedClient) TouchMulti(context.Context, time.Duration, []string) map[string]error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) DeleteCAS(context.Context, string, uint64) error { return nil }
+
 func (f *fakeMemcachedClient) Version(context.Context) (string, error) { return "", nil }
 
+func (f *fakeMemcachedClient) VersionAll(context.Context) (map[*memcached.Addr]string, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) ServerInfo(context.Context) (map[*memcached.Addr]*memcached.ServerInfo, error) {
+	return nil, nil
+}
+
 func (f *fakeMemcachedClient) FlushAll(context.Context) error { return nil }
 
+func (f *fakeMemcachedClient) ScheduleFlush(context.Context, *memcached.Addr, time.Duration) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) ScheduledFlushes() []memcached.ScheduledFlush { return nil }
+
 func (f *fakeMemcachedClient) MetaSet(context.Context, []byte, []byte, ...memcached.MetaSetOption) (*memcached.MetaItem, error) {
 	return nil, nil
 }
@@ -118,10 +213,97 @@ func (f *fakeMemcachedClient) MetaDebug(context.Context, []byte, ...memcached.Me
 	return nil, nil
 }
 
+func (f *fakeMemcachedClient) MetaDebugEach(context.Context, string, func(*memcached.Addr, *memcached.MetaItemDebug) error) error {
+	return nil
+}
+
 func (f *fakeMemcachedClient) MetaNoOp(context.Context) error { return nil }
 
 func (f *fakeMemcachedClient) Stats(context.Context) (*memcached.Statistic, error) { return nil, nil }
 
+func (f *fakeMemcachedClient) AggregateStats(context.Context) (*memcached.ClusterStats, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) StatsDelta(context.Context, *memcached.Addr, time.Duration) (<-chan *memcached.StatRate, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) StatsSettings(context.Context) (map[*memcached.Addr]*memcached.ServerSettings, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) PoolStats() map[string]*memcached.PoolStats { return nil }
+
+func (f *fakeMemcachedClient) WhichNode(string) (*memcached.Addr, error) { return nil, nil }
+
+func (f *fakeMemcachedClient) Distribution([]string) (*memcached.KeyDistribution, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) Metrics() *memcached.Metrics { return nil }
+
+func (f *fakeMemcachedClient) UpdateOptions(...memcached.ClientOption) error { return nil }
+func (f *fakeMemcachedClient) UpdateAddrs([]*memcached.Addr) error           { return nil }
+
+func (f *fakeMemcachedClient) LastProtocolErrors() []*memcached.ProtocolError { return nil }
+
+func (f *fakeMemcachedClient) With(...memcached.ClientOption) (memcached.Client, error) {
+	return f, nil
+}
+
+func (f *fakeMemcachedClient) Update(context.Context, string, memcached.UpdateFunc, ...memcached.UpdateOption) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) MetaUpdate(context.Context, []byte, memcached.UpdateFunc, ...memcached.UpdateOption) (uint64, error) {
+	return 0, nil
+}
+
+func (f *fakeMemcachedClient) Counter(string, time.Duration) *memcached.Counter { return nil }
+
+func (f *fakeMemcachedClient) NewMutex(string, time.Duration, ...memcached.MutexOption) *memcached.Mutex {
+	return nil
+}
+
+func (f *fakeMemcachedClient) Namespaces(...memcached.NamespaceOption) *memcached.Namespaces {
+	return nil
+}
+
+func (f *fakeMemcachedClient) Async(...memcached.AsyncOption) *memcached.Async { return nil }
+
+func (f *fakeMemcachedClient) SoftTTL() *memcached.SoftTTL { return nil }
+
+func (f *fakeMemcachedClient) WatchKeys([]string, ...memcached.KeyWatcherOption) *memcached.KeyWatcher {
+	return nil
+}
+
+func (f *fakeMemcachedClient) KeySample(context.Context, int) ([]*memcached.SampledKey, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) AuditCache(context.Context, string, func(string) string) (*memcached.CacheAudit, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) WithConn(context.Context, string, func(memcached.ConnCommander) error) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) DoOnNode(context.Context, *memcached.Addr, func(context.Context) error) error {
+	return nil
+}
+
+func (f *fakeMemcachedClient) Node(*memcached.Addr) (memcached.NodeClient, error) { return nil, nil }
+
+func (f *fakeMemcachedClient) GetReader(context.Context, string) (*memcached.ValueReader, error) {
+	return nil, nil
+}
+
+func (f *fakeMemcachedClient) SetReader(context.Context, string, io.Reader, int64, uint32, memcached.Expiration) error {
+	return nil
+}
+
 var _ memcached.Client = (*fakeMemcachedClient)(nil)
 
 func TestOperationServiceNormalizeMemcachedKey(t *testing.T) {
@@ -0,0 +1,513 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeqown/memcached/internal/testserver"
+)
+
+func newTestServer(t testing.TB) *testserver.Server {
+	srv, err := testserver.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv
+}
+
+func TestHarness_textCommands(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	version, err := c.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1.6.21", version)
+
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 3, 0))
+	require.ErrorIs(t, c.Add(ctx, "foo", []byte("baz"), 0, 0), ErrNotStored)
+	require.NoError(t, c.Append(ctx, "foo", []byte("!"), 0, 0))
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar!", string(item.Value))
+	assert.Equal(t, uint32(3), item.Flags)
+
+	items, err := c.Gets(ctx, "foo", "missing")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.ErrorIs(t, c.Cas(ctx, "foo", []byte("x"), 0, 0, items[0].CAS+1), ErrExists)
+	require.NoError(t, c.Cas(ctx, "foo", []byte("x"), 0, 0, items[0].CAS))
+
+	require.NoError(t, c.Set(ctx, "counter", []byte("10"), 0, 0))
+	n, err := c.Incr(ctx, "counter", 5)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(15), n)
+	n, err = c.Decr(ctx, "counter", 20)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), n)
+
+	require.NoError(t, c.Touch(ctx, "foo", time.Hour))
+	item, err = c.GetAndTouch(ctx, time.Hour, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(item.Value))
+
+	require.NoError(t, c.Delete(ctx, "foo"))
+	require.ErrorIs(t, c.Delete(ctx, "foo"), ErrNotFound)
+	_, err = c.Get(ctx, "foo")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, c.FlushAll(ctx))
+	_, err = c.Get(ctx, "counter")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestHarness_deleteCAS(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		missing error
+	}{
+		{name: "default", missing: ErrNotFound},
+		// the miss is suppressed in noreply mode, but the CAS mismatch is not.
+		{name: "noreply", opts: []ClientOption{WithNoReply()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			c, err := New(srv.Addr(), tt.opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+			items, err := c.Gets(ctx, "foo")
+			require.NoError(t, err)
+			stale := items[0].CAS
+
+			// cas 0 is never a CAS unique of the item.
+			require.ErrorIs(t, c.DeleteCAS(ctx, "foo", 0), ErrInvalidArgument)
+			_, err = c.Get(ctx, "foo")
+			require.NoError(t, err)
+
+			// the item is updated by others since the last read.
+			require.NoError(t, c.Set(ctx, "foo", []byte("baz"), 0, 0))
+			require.ErrorIs(t, c.DeleteCAS(ctx, "foo", stale), ErrExists)
+
+			items, err = c.Gets(ctx, "foo")
+			require.NoError(t, err)
+			require.NoError(t, c.DeleteCAS(ctx, "foo", items[0].CAS))
+
+			_, err = c.Get(ctx, "foo")
+			require.ErrorIs(t, err, ErrNotFound)
+			err = c.DeleteCAS(ctx, "foo", items[0].CAS)
+			if tt.missing != nil {
+				require.ErrorIs(t, err, tt.missing)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHarness_arithmetic(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		noReply bool
+	}{
+		{name: "default"},
+		// nothing is replied in noreply mode, the value is 0 and the miss is suppressed.
+		{name: "noreply", opts: []ClientOption{WithNoReply()}, noReply: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			c, err := New(srv.Addr(), tt.opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			require.NoError(t, c.Set(ctx, "counter", []byte("10"), 0, 0))
+
+			n, err := c.Incr(ctx, "counter", 5)
+			require.NoError(t, err)
+			n2, err := c.Decr(ctx, "counter", 2)
+			require.NoError(t, err)
+			if tt.noReply {
+				assert.Zero(t, n)
+				assert.Zero(t, n2)
+			} else {
+				assert.Equal(t, uint64(15), n)
+				assert.Equal(t, uint64(13), n2)
+			}
+
+			item, err := c.Get(ctx, "counter")
+			require.NoError(t, err)
+			assert.Equal(t, "13", string(item.Value))
+
+			_, err = c.Incr(ctx, "missing", 1)
+			if tt.noReply {
+				require.NoError(t, err)
+			} else {
+				require.Equal(t, ErrNotFound, err)
+			}
+		})
+	}
+}
+
+func TestHarness_arithmeticNonNumeric(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	_, err = c.Incr(ctx, "foo", 1)
+	require.ErrorIs(t, err, ErrNonNumericValue)
+	require.ErrorIs(t, err, ErrClientError)
+	_, err = c.Decr(ctx, "foo", 1)
+	require.ErrorIs(t, err, ErrNonNumericValue)
+
+	// the connection is still usable.
+	n, err := c.Incr(ctx, "foo", 0)
+	require.ErrorIs(t, err, ErrNonNumericValue)
+	assert.Zero(t, n)
+	require.NoError(t, c.Set(ctx, "foo", []byte("1"), 0, 0))
+	n, err = c.Incr(ctx, "foo", 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), n)
+}
+
+func TestHarness_storeItem(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	added, err := c.AddItem(ctx, "foo", []byte("bar"), 3, time.Minute)
+	require.NoError(t, err)
+	assert.NotZero(t, added.CAS)
+	assert.Equal(t, uint64(3), added.Size)
+	_, err = c.AddItem(ctx, "foo", []byte("baz"), 0, 0)
+	require.ErrorIs(t, err, ErrNotStored)
+
+	appended, err := c.AppendItem(ctx, "foo", []byte("!"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), appended.Size)
+	assert.NotEqual(t, added.CAS, appended.CAS)
+	prepended, err := c.PrependItem(ctx, "foo", []byte("<"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), prepended.Size)
+
+	// the returned CAS is used by the later check-and-set operation directly, and
+	// cas 0 is never a CAS unique of the item.
+	_, err = c.CasItem(ctx, "foo", []byte("x"), 0, 0, 0)
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = c.CasItem(ctx, "foo", []byte("x"), 0, 0, appended.CAS)
+	require.ErrorIs(t, err, ErrExists)
+	swapped, err := c.CasItem(ctx, "foo", []byte("x"), 0, 0, prepended.CAS)
+	require.NoError(t, err)
+
+	items, err := c.Gets(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(items[0].Value))
+	assert.Equal(t, swapped.CAS, items[0].CAS)
+
+	_, err = c.ReplaceItem(ctx, "missing", []byte("x"), 0, 0)
+	require.ErrorIs(t, err, ErrNotStored)
+	_, err = c.AppendItem(ctx, "missing", []byte("x"))
+	require.ErrorIs(t, err, ErrNotStored)
+
+	set, err := c.SetItem(ctx, "foo", []byte("bar"), 5, 0)
+	require.NoError(t, err)
+	replaced, err := c.ReplaceItem(ctx, "foo", []byte("quux"), 5, 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), replaced.Size)
+	assert.NotEqual(t, set.CAS, replaced.CAS)
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "quux", string(item.Value))
+	assert.Equal(t, uint32(5), item.Flags)
+}
+
+func TestHarness_metaCommands(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.MetaNoOp(ctx))
+
+	set, err := c.MetaSet(ctx, []byte("foo"), []byte("bar"),
+		MetaSetFlagClientFlags(7), MetaSetFlagTTL(60), MetaSetFlagReturnCAS())
+	require.NoError(t, err)
+	assert.NotZero(t, set.CAS)
+
+	got, err := c.MetaGet(ctx, []byte("foo"),
+		MetaGetFlagReturnValue(), MetaGetFlagReturnClientFlags(), MetaGetFlagReturnCAS(), MetaGetFlagReturnTTL())
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(got.Value))
+	assert.Equal(t, uint32(7), got.Flags)
+	assert.Equal(t, set.CAS, got.CAS)
+	assert.InDelta(t, 60, got.TTL, 1)
+
+	_, err = c.MetaSet(ctx, []byte("foo"), []byte("baz"), MetaSetFlagCompareCAS(set.CAS+1))
+	require.ErrorIs(t, err, ErrExists)
+
+	counter, err := c.MetaArithmetic(ctx, []byte("counter"), 1,
+		MetaArithmeticFlagAutoCreate(60), MetaArithmeticFlagInitialValue(10), MetaArithmeticFlagReturnValue())
+	require.NoError(t, err)
+	assert.Equal(t, "10", string(counter.Value))
+	counter, err = c.MetaArithmetic(ctx, []byte("counter"), 3, MetaArithmeticFlagReturnValue())
+	require.NoError(t, err)
+	assert.Equal(t, "13", string(counter.Value))
+
+	debug, err := c.MetaDebug(ctx, []byte("foo"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(debug.Key))
+	assert.Equal(t, uint64(3), debug.Size)
+
+	binaryKey := []byte{0xff, 0x00, 0x01}
+	_, err = c.MetaSet(ctx, binaryKey, []byte("bin"), MetaSetFlagBinaryKey())
+	require.NoError(t, err)
+	debug, err = c.MetaDebug(ctx, binaryKey, MetaDebugFlagBinaryKey())
+	require.NoError(t, err)
+	assert.Equal(t, binaryKey, debug.Key)
+	assert.Equal(t, uint64(3), debug.Size)
+
+	_, err = c.MetaDelete(ctx, []byte("foo"))
+	require.NoError(t, err)
+	_, err = c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnValue())
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+// TestHarness_faults checks the client returns an error rather than hanging on
+// the faults, and recovers by the next command.
+func TestHarness_faults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault testserver.Fault
+	}{
+		{name: "dropped connection", fault: testserver.FaultDrop},
+		{name: "partial write", fault: testserver.FaultPartialWrite},
+		{name: "garbage response", fault: testserver.FaultGarbage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			c, err := New(srv.Addr(), WithReadTimeout(200*time.Millisecond), WithMaxConns(1), WithStaleConnReplay(false))
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+			srv.InjectFaults(tt.fault)
+			_, err = c.Get(ctx, "foo")
+			require.Error(t, err)
+
+			item, err := c.Get(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, "bar", string(item.Value))
+		})
+	}
+}
+
+// TestHarness_latency checks the late response of a timed out command is not
+// taken by the next command on the same connection.
+func TestHarness_latency(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithReadTimeout(100*time.Millisecond), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("foo"), 0, 0))
+	require.NoError(t, c.Set(ctx, "bar", []byte("bar"), 0, 0))
+
+	srv.SetLatency(300 * time.Millisecond)
+	_, err = c.Get(ctx, "foo")
+	require.Error(t, err)
+
+	srv.SetLatency(0)
+	item, err := c.Get(ctx, "bar")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+}
+
+// TestHarness_delayedTail checks the rest of the reply of a timed out command,
+// which arrives later over the same connection, is never taken by the next command,
+// whichever path the command is dispatched by.
+func TestHarness_delayedTail(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		// timedOut is the command timed out by the delayed tail of its reply.
+		timedOut func(ctx context.Context, c Client) error
+	}{
+		{
+			name:     "get",
+			timedOut: func(ctx context.Context, c Client) error { _, err := c.Get(ctx, "foo"); return err },
+		},
+		{
+			name: "meta get",
+			timedOut: func(ctx context.Context, c Client) error {
+				_, err := c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnValue())
+				return err
+			},
+		},
+		{
+			name:     "broadcast",
+			timedOut: func(ctx context.Context, c Client) error { _, err := c.ServerInfo(ctx); return err },
+		},
+		{
+			name:     "multiplexed",
+			opts:     []ClientOption{WithMultiplexing(1)},
+			timedOut: func(ctx context.Context, c Client) error { _, err := c.Get(ctx, "foo"); return err },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			opts := append([]ClientOption{WithReadTimeout(50 * time.Millisecond), WithMaxConns(1)}, tt.opts...)
+			c, err := New(srv.Addr(), opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			require.NoError(t, c.Set(ctx, "foo", []byte("foo"), 0, 0))
+			require.NoError(t, c.Set(ctx, "bar", []byte("bar"), 0, 0))
+
+			srv.InjectFaults(testserver.FaultDelayedTail)
+			require.Error(t, tt.timedOut(ctx, c))
+			// the tail of the reply arrives before the next command.
+			time.Sleep(2 * testserver.DelayedTailDelay)
+
+			item, err := c.Get(ctx, "bar")
+			require.NoError(t, err)
+			assert.Equal(t, "bar", item.Key)
+			assert.Equal(t, "bar", string(item.Value))
+		})
+	}
+}
+
+// TestHarness_concurrentFaults runs the scenario of issue #18, Set, Get and Touch
+// of the keys concurrently, with the faults injected and the ownership of the
+// requests and responses asserted. The commands may fail, but the items returned
+// must always be the ones of the keys requested.
+// https://github.com/yeqown/memcached/issues/18
+func TestHarness_concurrentFaults(t *testing.T) {
+	assertOwnership.Store(true)
+	defer assertOwnership.Store(false)
+	poisonReleased.Store(true)
+	defer poisonReleased.Store(false)
+
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithReadTimeout(50*time.Millisecond), WithMaxConns(4))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	keys := []string{"alpha", "beta", "gamma", "delta"}
+	for _, key := range keys {
+		require.NoError(t, c.Set(ctx, key, []byte(key+":0"), 0, 0))
+	}
+
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for n := 1; n <= 50; n++ {
+				_ = c.Set(ctx, key, []byte(fmt.Sprintf("%s:%d", key, n)), 0, 0)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				item, err := c.Get(ctx, key)
+				if err != nil {
+					continue
+				}
+				assert.Equal(t, key, item.Key)
+				assert.True(t, strings.HasPrefix(string(item.Value), key+":"), "value %q of %s", item.Value, key)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				_ = c.Touch(ctx, key, time.Minute)
+				if n%10 == i {
+					srv.InjectFaults(testserver.FaultDelayedTail, testserver.FaultGarbage, testserver.FaultPartialWrite)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestHarness_failover checks the keys on the alive nodes are not affected when
+// a node is down, and the node is available again after it's restarted.
+func TestHarness_failover(t *testing.T) {
+	servers := []*testserver.Server{newTestServer(t), newTestServer(t), newTestServer(t)}
+	addrs := make([]string, 0, len(servers))
+	for _, srv := range servers {
+		addrs = append(addrs, srv.Addr())
+	}
+
+	c, err := New(strings.Join(addrs, ","), WithDialTimeout(200*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	nodes := make(map[string]string, 30)
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		require.NoError(t, c.Set(ctx, key, []byte(key), 0, 0))
+
+		addr, err := c.(*client).topology().picker.Pick(c.(*client).topology().addrs, []byte("get"), []byte(key))
+		require.NoError(t, err)
+		nodes[key] = addr.Address
+	}
+
+	down := servers[1]
+	down.Stop()
+
+	for key, node := range nodes {
+		item, err := c.Get(ctx, key)
+		if node == down.Addr() {
+			require.Error(t, err, key)
+			continue
+		}
+		require.NoError(t, err, key)
+		assert.Equal(t, key, string(item.Value))
+	}
+
+	require.NoError(t, down.Restart())
+	for key := range nodes {
+		item, err := c.Get(ctx, key)
+		require.NoError(t, err, key)
+		assert.Equal(t, key, string(item.Value))
+	}
+}
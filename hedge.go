@@ -0,0 +1,133 @@
+package memcached
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// hedgedAttempt is the result of one attempt of a hedged request.
+type hedgedAttempt struct {
+	req  *request
+	resp *response
+	err  error
+	// overBudget is true if the attempt failed by running out of its share of
+	// the deadline, see WithDeadlineBudget.
+	overBudget bool
+}
+
+// deadlinePassed reports whether ctx is done or its deadline has passed, the read
+// deadline of the connection set from it fires before ctx is done by its timer.
+func deadlinePassed(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// final reports whether the attempt has a reply from the server, rather than
+// failed before it, so that it's taken without waiting for the other attempt.
+func (a *hedgedAttempt) final() bool {
+	return a.err == nil || errors.Is(a.err, ErrNotFound)
+}
+
+// dispatchHedgedRequest dispatches the read request like dispatchRequest, but
+// sends the same request again over another connection to the same server if
+// it has not been replied within the delay set by WithHedgedReads. The first
+// reply is taken, and the other attempt is canceled if it's not sent yet.
+//
+// The request MUST NOT modify the item, since it could be executed twice.
+func (c *client) dispatchHedgedRequest(ctx context.Context, req *request, resp *response) error {
+	delay := c.options.hedgeDelay
+	if delay <= 0 || pinnedConnFrom(ctx) != nil {
+		return c.dispatchRequest(ctx, req, resp)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	addr, err := c.pick(ctx, req.cmd, req.key)
+	if err != nil {
+		return errors.Wrap(err, "pick node failed")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	// the attempts may outlive the call, they are released once done.
+	results := make(chan *hedgedAttempt, 2)
+	launched := 0
+	attempt := func() {
+		a := &hedgedAttempt{
+			req:  buildRequest(req.cmd, req.key, req.raw),
+			resp: acquireResponse(),
+		}
+		a.resp.endIndicator = resp.endIndicator
+		a.resp.limitedLines = resp.limitedLines
+		a.resp.specEndLine = resp.specEndLine
+		a.resp.lenientFaultLine = resp.lenientFaultLine
+		a.resp.rawLines = a.resp.rawLines[:0]
+
+		attemptCtx, attemptCancel := c.options.deadlineBudget.attemptContext(ctx, launched)
+		launched++
+		go func() {
+			defer attemptCancel()
+			a.err = c.dispatchRequestTo(attemptCtx, addr, a.req, a.resp)
+			// the attempt ran out of its budget rather than the deadline of the call.
+			a.overBudget = a.err != nil && deadlinePassed(attemptCtx) && ctx.Err() == nil
+			results <- a
+		}()
+	}
+
+	attempt()
+	pending := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var taken *hedgedAttempt
+	for taken == nil {
+		select {
+		case a := <-results:
+			pending--
+			if a.overBudget && launched == 1 {
+				// the hedged attempt is sent at once with the rest of the budget.
+				attempt()
+				pending++
+			}
+			if a.final() || pending == 0 {
+				taken = a
+				continue
+			}
+			// the failed attempt is dropped, waits for the other one.
+			a.req.release()
+			a.resp.release()
+		case <-timer.C:
+			if ctx.Err() == nil && launched == 1 {
+				attempt()
+				pending++
+			}
+		}
+	}
+	cancel()
+
+	if pending > 0 {
+		go func() {
+			a := <-results
+			releaseReqAndResp(a.req, a.resp)
+		}()
+	}
+
+	// take over the lines, and put the buffers of the caller's response back to the pool.
+	resp.rawLines, taken.resp.rawLines = taken.resp.rawLines, resp.rawLines
+	resp.buf, taken.resp.buf = taken.resp.buf, resp.buf
+	resp.faultLine = taken.resp.faultLine
+	resp.addr = taken.resp.addr
+	err = taken.err
+	releaseReqAndResp(taken.req, taken.resp)
+
+	return err
+}
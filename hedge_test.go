@@ -0,0 +1,111 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_hedgedReads(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithHedgedReads(50*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	// replied within the delay, not hedged.
+	for i := 0; i < 3; i++ {
+		item, err := c.Get(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(item.Value))
+	}
+	assert.Equal(t, 1, srv.Accepted())
+
+	tests := []struct {
+		name string
+		get  func() ([]byte, error)
+	}{
+		{
+			name: "get",
+			get: func() ([]byte, error) {
+				item, err := c.Get(ctx, "foo")
+				if err != nil {
+					return nil, err
+				}
+				return item.Value, nil
+			},
+		},
+		{
+			name: "meta get",
+			get: func() ([]byte, error) {
+				item, err := c.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnValue())
+				if err != nil {
+					return nil, err
+				}
+				return item.Value, nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the first attempt is slow, and the hedged one is replied at once.
+			srv.SetLatency(time.Second)
+			time.AfterFunc(20*time.Millisecond, func() { srv.SetLatency(0) })
+
+			start := time.Now()
+			value, err := tt.get()
+			require.NoError(t, err)
+			assert.Equal(t, "bar", string(value))
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+		})
+	}
+
+	// the miss is a reply too.
+	_, err = c.MetaGet(ctx, []byte("missing"))
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = c.Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func Test_client_hedgedReads_modifying(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithHedgedReads(20*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	srv.SetLatency(100 * time.Millisecond)
+
+	// the vivifying meta get is sent once, no other connection is dialed for it.
+	_, err = c.MetaGet(context.Background(), []byte("foo"), MetaGetFlagVivifyOnMiss(60))
+	require.NoError(t, err)
+	assert.Equal(t, 1, srv.Accepted())
+}
+
+func Test_metaGetFlags_modifies(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  MetaGetOption
+		want bool
+	}{
+		{name: "value", opt: MetaGetFlagReturnValue(), want: false},
+		{name: "ttl", opt: MetaGetFlagReturnTTL(), want: false},
+		{name: "new cas", opt: MetaGetFlagNewCAS(1), want: true},
+		{name: "vivify", opt: MetaGetFlagVivifyOnMiss(60), want: true},
+		{name: "recache", opt: MetaGetFlagWinForRecache(30), want: true},
+		{name: "touch", opt: MetaGetFlagUpdateRemainingTTL(60), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := &metaGetFlags{}
+			tt.opt(flags)
+			assert.Equal(t, tt.want, flags.modifies())
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package memcached
+
+import (
+	"sync/atomic"
+)
+
+// Metrics is the snapshot of the hits and misses of the retrieval commands of the
+// client, see Client.Metrics. A key found is a hit, and a key not found is a miss,
+// so that a multi-key command counts each of its keys.
+type Metrics struct {
+	// Hits is the number of keys found over all the memcached servers.
+	Hits uint64
+	// Misses is the number of keys not found over all the memcached servers.
+	Misses uint64
+	// Nodes holds the hits and misses of each memcached server by its address.
+	Nodes map[string]*NodeMetrics
+}
+
+// NodeMetrics is the hits and misses of the retrieval commands of one memcached server.
+type NodeMetrics struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRatio returns the ratio of hits to all the keys retrieved, 0 if none.
+func (m *Metrics) HitRatio() float64 { return hitRatio(m.Hits, m.Misses) }
+
+// HitRatio returns the ratio of hits to all the keys retrieved, 0 if none.
+func (m *NodeMetrics) HitRatio() float64 { return hitRatio(m.Hits, m.Misses) }
+
+func hitRatio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(hits+misses)
+}
+
+// hitCounter counts the hits and misses of one memcached server.
+type hitCounter struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// countHits counts the keys found and not found by a retrieval command sent to the
+// memcached server at addr.
+func (c *client) countHits(addr *Addr, hits, misses int) {
+	counter, ok := c.hitCounters.Load(addr.Address)
+	if !ok {
+		counter, _ = c.hitCounters.LoadOrStore(addr.Address, &hitCounter{})
+	}
+
+	hc := counter.(*hitCounter)
+	if hits > 0 {
+		hc.hits.Add(uint64(hits))
+	}
+	if misses > 0 {
+		hc.misses.Add(uint64(misses))
+	}
+}
+
+// countKeyHit counts the key found or not by a single-key retrieval command sent
+// to the memcached server at addr, which is the one the response is received from,
+// see response.addr. Nothing is counted if it's nil, the request is not sent.
+func (c *client) countKeyHit(addr *Addr, hit bool) {
+	if addr == nil {
+		return
+	}
+
+	if hit {
+		c.countHits(addr, 1, 0)
+	} else {
+		c.countHits(addr, 0, 1)
+	}
+}
+
+func (c *client) Metrics() *Metrics {
+	m := &Metrics{Nodes: make(map[string]*NodeMetrics)}
+	c.hitCounters.Range(func(key, value any) bool {
+		hc := value.(*hitCounter)
+		node := &NodeMetrics{Hits: hc.hits.Load(), Misses: hc.misses.Load()}
+		m.Nodes[key.(string)] = node
+		m.Hits += node.Hits
+		m.Misses += node.Misses
+		return true
+	})
+
+	return m
+}
@@ -0,0 +1,86 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_Metrics(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	assert.Equal(t, &Metrics{Nodes: map[string]*NodeMetrics{}}, c.Metrics())
+	assert.Zero(t, c.Metrics().HitRatio())
+
+	keys := make([]string, 0, 8)
+	for i := 0; i < 8; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		require.NoError(t, c.Set(ctx, key, []byte("value"), 0, 0))
+	}
+
+	_, err = c.Get(ctx, "key-0")
+	require.NoError(t, err)
+	_, err = c.Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = c.GetAndTouch(ctx, time.Minute, "key-1")
+	require.NoError(t, err)
+	_, err = c.MetaGet(ctx, []byte("key-2"), MetaGetFlagReturnValue())
+	require.NoError(t, err)
+	_, err = c.MetaGet(ctx, []byte("missing"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// each key of the multi-key commands is counted.
+	_, err = c.Gets(ctx, append(keys, "missing-1", "missing-2")...)
+	require.NoError(t, err)
+
+	// the other commands are not counted.
+	require.ErrorIs(t, c.Delete(ctx, "missing"), ErrNotFound)
+
+	m := c.Metrics()
+	assert.Equal(t, uint64(3+8), m.Hits)
+	assert.Equal(t, uint64(2+2), m.Misses)
+	assert.InDelta(t, 11.0/15.0, m.HitRatio(), 1e-9)
+
+	require.Len(t, m.Nodes, 2)
+	var hits, misses uint64
+	for _, node := range m.Nodes {
+		assert.NotZero(t, node.Hits)
+		hits += node.Hits
+		misses += node.Misses
+	}
+	assert.Equal(t, m.Hits, hits)
+	assert.Equal(t, m.Misses, misses)
+}
+
+func Test_client_Metrics_dispatchedNode(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr()+","+srv2.Addr(), WithPickBuilder(NewRoundRobinPickBuilder()))
+	require.NoError(t, err)
+	defer c.Close()
+	only1, err := New(srv1.Addr())
+	require.NoError(t, err)
+	defer only1.Close()
+
+	ctx := context.Background()
+	require.NoError(t, only1.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	// the picker alternates the nodes, the key is counted on the node it's sent to.
+	for i := 0; i < 4; i++ {
+		_, _ = c.Get(ctx, "foo")
+		_, _ = c.MetaGet(ctx, []byte("foo"))
+	}
+
+	m := c.Metrics()
+	require.Len(t, m.Nodes, 2)
+	assert.Equal(t, &NodeMetrics{Hits: 4}, m.Nodes[srv1.Addr()])
+	assert.Equal(t, &NodeMetrics{Misses: 4}, m.Nodes[srv2.Addr()])
+}
@@ -0,0 +1,23 @@
+package memcached
+
+import (
+	"context"
+	"time"
+)
+
+// RequestInfo describes a finished request dispatched to a memcached server.
+type RequestInfo struct {
+	// Command is the command name of the request, e.g. "get", "ms".
+	Command string
+	// Addr is the address of the memcached server which the request is sent to.
+	Addr string
+	// Duration is the time spent on the request, including waiting for a connection.
+	Duration time.Duration
+	// Err is the error of the request, nil if succeeded. Note that the errors
+	// replied by the server (e.g. ErrNotFound) are reported as well.
+	Err error
+}
+
+// RequestHook is called after each request is finished, it's called synchronously
+// in the caller's goroutine, so that it should return as soon as possible.
+type RequestHook func(ctx context.Context, info *RequestInfo)
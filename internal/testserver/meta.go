@@ -0,0 +1,340 @@
+package testserver
+
+import (
+	"bufio"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// metaFlag is a flag of meta commands, e.g. "v" or "T30".
+type metaFlag struct {
+	name  byte
+	token string
+}
+
+// metaRequest is the parsed arguments of a meta command: <key> <flags>*
+type metaRequest struct {
+	// key is the key to look up, decoded if the b flag is set.
+	key string
+	// rawKey is the key sent by the client.
+	rawKey string
+	flags  []metaFlag
+}
+
+func parseMetaRequest(args []string) (*metaRequest, bool) {
+	if len(args) < 1 {
+		return nil, false
+	}
+
+	req := &metaRequest{key: args[0], rawKey: args[0]}
+	for _, arg := range args[1:] {
+		req.flags = append(req.flags, metaFlag{name: arg[0], token: arg[1:]})
+	}
+
+	if req.has('b') {
+		key, err := base64.StdEncoding.DecodeString(req.rawKey)
+		if err != nil {
+			return nil, false
+		}
+		req.key = string(key)
+	}
+
+	return req, true
+}
+
+func (r *metaRequest) has(name byte) bool {
+	_, ok := r.token(name)
+	return ok
+}
+
+func (r *metaRequest) token(name byte) (string, bool) {
+	for _, f := range r.flags {
+		if f.name == name {
+			return f.token, true
+		}
+	}
+
+	return "", false
+}
+
+// mode returns the first character of the M flag, 0 if not set.
+func (r *metaRequest) mode() byte {
+	token, ok := r.token('M')
+	if !ok || token == "" {
+		return 0
+	}
+
+	return token[0]
+}
+
+func (r *metaRequest) uint(name byte) (uint64, bool) {
+	token, ok := r.token(name)
+	if !ok {
+		return 0, false
+	}
+
+	v, err := strconv.ParseUint(token, 10, 64)
+	return v, err == nil
+}
+
+// returnFlags returns the flags of the item in the order of the request, it
+// must be called before the item is accessed.
+func (r *metaRequest) returnFlags(it *item, now time.Time) []string {
+	var tokens []string
+	for _, f := range r.flags {
+		switch f.name {
+		case 'k':
+			tokens = append(tokens, "k"+r.rawKey)
+		case 'O':
+			tokens = append(tokens, "O"+f.token)
+		case 'b':
+			if r.has('k') {
+				tokens = append(tokens, "b")
+			}
+		}
+		if it == nil {
+			continue
+		}
+
+		switch f.name {
+		case 'f':
+			tokens = append(tokens, "f"+strconv.FormatUint(uint64(it.flags), 10))
+		case 'c':
+			tokens = append(tokens, "c"+strconv.FormatUint(it.cas, 10))
+		case 't':
+			tokens = append(tokens, "t"+strconv.FormatInt(remainingTTL(it, now), 10))
+		case 's':
+			tokens = append(tokens, "s"+strconv.Itoa(len(it.value)))
+		case 'h':
+			tokens = append(tokens, "h"+strconv.Itoa(boolToInt(it.fetched)))
+		case 'l':
+			tokens = append(tokens, "l"+strconv.FormatInt(int64(now.Sub(it.accessed)/time.Second), 10))
+		}
+	}
+
+	return tokens
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// metaReply replies the status code with return flags, the HD code is omitted in quiet mode.
+func metaReply(req *metaRequest, code string, tokens []string) []byte {
+	if req.has('q') && (code == "HD" || code == "EN" || code == "NF") {
+		return nil
+	}
+
+	return []byte(code + joinTokens(tokens) + "\r\n")
+}
+
+// metaGet executes: mg <key> <flags>*\r\n
+func (st *store) metaGet(args []string) []byte {
+	req, ok := parseMetaRequest(args)
+	if !ok {
+		return clientError("bad command line format")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	it := st.getLocked(req.key)
+	// won means the item is vivified on miss, the client wins to recache it.
+	won := false
+	if it == nil {
+		ttl, ok := req.uint('N')
+		if !ok {
+			return metaReply(req, "EN", req.returnFlags(nil, time.Time{}))
+		}
+		it = &item{value: []byte{}, expireAt: st.expireAtLocked(int64(ttl))}
+		st.putLocked(req.key, it)
+		won = true
+	}
+	if ttl, ok := req.uint('T'); ok {
+		it.expireAt = st.expireAtLocked(int64(ttl))
+	}
+
+	tokens := req.returnFlags(it, st.nowLocked())
+	if won {
+		tokens = append(tokens, "W")
+	}
+	it.fetched = true
+	it.accessed = st.nowLocked()
+
+	if !req.has('v') {
+		return []byte("HD" + joinTokens(tokens) + "\r\n")
+	}
+
+	return []byte("VA " + strconv.Itoa(len(it.value)) + joinTokens(tokens) + "\r\n" + string(it.value) + "\r\n")
+}
+
+// metaSet executes: ms <key> <datalen> <flags>*\r\n<data block>\r\n
+func (st *store) metaSet(args []string, rr *bufio.Reader) []byte {
+	if len(args) < 2 {
+		return clientError("bad command line format")
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		return clientError("bad data chunk")
+	}
+
+	req, ok := parseMetaRequest(append([]string{args[0]}, args[2:]...))
+	if !ok {
+		return clientError("bad command line format")
+	}
+
+	data, ok := readDataBlock(rr, n)
+	if !ok {
+		return clientError("bad data chunk")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	flags, _ := req.uint('F')
+	ttl, _ := req.uint('T')
+	fresh := &item{value: data, flags: uint32(flags), expireAt: st.expireAtLocked(int64(ttl))}
+
+	it := st.getLocked(req.key)
+	if cas, ok := req.uint('C'); ok {
+		if it == nil {
+			return metaReply(req, "NF", req.returnFlags(nil, time.Time{}))
+		}
+		if it.cas != cas {
+			return metaReply(req, "EX", req.returnFlags(nil, time.Time{}))
+		}
+	}
+
+	// only the first character of the mode token is significant as memcached does.
+	switch req.mode() {
+	case 'E', 'e':
+		if it != nil {
+			return metaReply(req, "NS", req.returnFlags(nil, time.Time{}))
+		}
+	case 'R', 'r':
+		if it == nil {
+			return metaReply(req, "NS", req.returnFlags(nil, time.Time{}))
+		}
+	case 'A', 'a', 'P', 'p':
+		if it == nil {
+			return metaReply(req, "NS", req.returnFlags(nil, time.Time{}))
+		}
+		fresh.flags, fresh.expireAt = it.flags, it.expireAt
+		if mode := req.mode(); mode == 'A' || mode == 'a' {
+			fresh.value = append(append([]byte{}, it.value...), data...)
+		} else {
+			fresh.value = append(data, it.value...)
+		}
+	}
+
+	st.putLocked(req.key, fresh)
+	return metaReply(req, "HD", req.returnFlags(fresh, st.nowLocked()))
+}
+
+// metaDelete executes: md <key> <flags>*\r\n
+func (st *store) metaDelete(args []string) []byte {
+	req, ok := parseMetaRequest(args)
+	if !ok {
+		return clientError("bad command line format")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	it := st.getLocked(req.key)
+	if it == nil {
+		return metaReply(req, "NF", req.returnFlags(nil, time.Time{}))
+	}
+	if cas, ok := req.uint('C'); ok && it.cas != cas {
+		return metaReply(req, "EX", req.returnFlags(nil, time.Time{}))
+	}
+
+	delete(st.items, req.key)
+	return metaReply(req, "HD", req.returnFlags(nil, time.Time{}))
+}
+
+// metaArithmetic executes: ma <key> <flags>*\r\n
+func (st *store) metaArithmetic(args []string) []byte {
+	req, ok := parseMetaRequest(args)
+	if !ok {
+		return clientError("bad command line format")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	it := st.getLocked(req.key)
+	if it == nil {
+		// auto create the item with the initial value if N is set.
+		ttl, ok := req.uint('N')
+		if !ok {
+			return metaReply(req, "NF", req.returnFlags(nil, time.Time{}))
+		}
+		initial, _ := req.uint('J')
+		it = &item{value: []byte(strconv.FormatUint(initial, 10)), expireAt: st.expireAtLocked(int64(ttl))}
+	} else {
+		if cas, ok := req.uint('C'); ok && it.cas != cas {
+			return metaReply(req, "EX", req.returnFlags(nil, time.Time{}))
+		}
+
+		delta, ok := req.uint('D')
+		if !ok {
+			delta = 1
+		}
+		mode := req.mode()
+		incr := mode != 'D' && mode != 'd' && mode != '-'
+		if _, ok := applyDelta(it, incr, delta); !ok {
+			return clientError("cannot increment or decrement non-numeric value")
+		}
+	}
+	if ttl, ok := req.uint('T'); ok {
+		it.expireAt = st.expireAtLocked(int64(ttl))
+	}
+	st.putLocked(req.key, it)
+
+	tokens := req.returnFlags(it, st.nowLocked())
+	// the hit is not suppressed in quiet mode as memcached does.
+	if !req.has('v') {
+		return []byte("HD" + joinTokens(tokens) + "\r\n")
+	}
+
+	return []byte("VA " + strconv.Itoa(len(it.value)) + joinTokens(tokens) + "\r\n" + string(it.value) + "\r\n")
+}
+
+// metaDebug executes: me <key> <flags>*\r\n
+func (st *store) metaDebug(args []string) []byte {
+	req, ok := parseMetaRequest(args)
+	if !ok {
+		return clientError("bad command line format")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	it := st.getLocked(req.key)
+	if it == nil {
+		return []byte("EN\r\n")
+	}
+
+	fetch := "no"
+	if it.fetched {
+		fetch = "yes"
+	}
+	// the base64 encoded key is marked by the b flag as memcached does.
+	binary := ""
+	if req.has('b') {
+		binary = " b"
+	}
+
+	return []byte("ME " + req.rawKey +
+		" exp=" + strconv.FormatInt(remainingTTL(it, st.nowLocked()), 10) +
+		" la=" + strconv.FormatInt(int64(st.nowLocked().Sub(it.accessed)/time.Second), 10) +
+		" cas=" + strconv.FormatUint(it.cas, 10) +
+		" fetch=" + fetch +
+		" cls=1 size=" + strconv.Itoa(len(it.value)) + binary + "\r\n")
+}
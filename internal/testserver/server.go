@@ -0,0 +1,386 @@
+// Package testserver implements an in-memory memcached server for tests, which
+// speaks enough of the text and meta protocols to run the client without a real
+// memcached. Faults could be injected to simulate the failures of the network
+// and the server, e.g. latency, dropped connections, partial or delayed writes,
+// stalled replies and garbage responses.
+package testserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault is a failure injected into the reply of a command.
+type Fault uint8
+
+const (
+	// FaultNone replies the command normally.
+	FaultNone Fault = iota
+	// FaultDrop closes the connection without replying the command.
+	FaultDrop
+	// FaultPartialWrite writes the first half of the reply, then closes the connection.
+	FaultPartialWrite
+	// FaultGarbage replies a garbage line instead of the reply.
+	FaultGarbage
+	// FaultDelayedTail writes the first half of the reply, then the rest after
+	// DelayedTailDelay over the same connection, as a slow network does.
+	FaultDelayedTail
+	// FaultStall never replies the command, the connection is kept until it's
+	// closed by the client or the server, as a stuck server does.
+	FaultStall
+)
+
+// DelayedTailDelay is the delay of the second half of the reply of FaultDelayedTail.
+const DelayedTailDelay = 100 * time.Millisecond
+
+// garbageLine is the reply of FaultGarbage, it's not a valid response of any command.
+const garbageLine = "#$%^&* garbage\r\n"
+
+// Server is an in-memory memcached server listening on a TCP address.
+type Server struct {
+	addr    string
+	store   *store
+	started time.Time
+
+	mu       sync.Mutex // guards following
+	version  string
+	ln       net.Listener
+	conns    map[net.Conn]struct{}
+	accepted int
+	latency  time.Duration
+	faults   []Fault
+	// singleKeyGAT makes gat/gats reject multiple keys as Dragonfly does.
+	singleKeyGAT bool
+	// itemSizeMax is the max item size replied by `stats settings`.
+	itemSizeMax int
+
+	wg sync.WaitGroup
+}
+
+// New starts a Server listening on a random port of the loopback address.
+func New() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		addr:        ln.Addr().String(),
+		started:     time.Now(),
+		version:     "1.6.21",
+		conns:       make(map[net.Conn]struct{}),
+		store:       newStore(),
+		itemSizeMax: 1024 * 1024,
+	}
+	s.serve(ln)
+
+	return s, nil
+}
+
+// Addr returns the address the server listens on, it does not change after restarts.
+func (s *Server) Addr() string { return s.addr }
+
+// SetVersion sets the version replied by the version command, e.g. "1.5.0".
+func (s *Server) SetVersion(version string) {
+	s.mu.Lock()
+	s.version = version
+	s.mu.Unlock()
+}
+
+// SetLatency delays every reply by the given duration.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	s.latency = d
+	s.mu.Unlock()
+}
+
+// SetSingleKeyGetAndTouch makes gat/gats with multiple keys reply CLIENT_ERROR,
+// as the servers which do not support multi-key gat/gats do, e.g. Dragonfly.
+func (s *Server) SetSingleKeyGetAndTouch(enabled bool) {
+	s.mu.Lock()
+	s.singleKeyGAT = enabled
+	s.mu.Unlock()
+}
+
+// SetItemSizeMax sets the max item size replied by `stats settings`, the items are
+// not limited by it.
+func (s *Server) SetItemSizeMax(size int) {
+	s.mu.Lock()
+	s.itemSizeMax = size
+	s.mu.Unlock()
+}
+
+// InjectFaults applies the faults to the replies of the next commands in order,
+// one fault per command. Commands without reply (noreply) do not consume faults.
+func (s *Server) InjectFaults(faults ...Fault) {
+	s.mu.Lock()
+	s.faults = append(s.faults, faults...)
+	s.mu.Unlock()
+}
+
+// Accepted returns the number of connections accepted since the server started.
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// DropConnections closes all connections from clients, the server keeps listening.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	for cn := range s.conns {
+		_ = cn.Close()
+	}
+	s.mu.Unlock()
+}
+
+// Advance moves the clock of the server forward by d, so that the items expire
+// without sleeping.
+func (s *Server) Advance(d time.Duration) {
+	s.store.advance(d)
+}
+
+// Stop stops listening and closes all connections, the items are kept so that
+// the server could be restarted with them.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	if s.ln != nil {
+		_ = s.ln.Close()
+		s.ln = nil
+	}
+	for cn := range s.conns {
+		_ = cn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Restart listens on the same address again after Stop.
+func (s *Server) Restart() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	s.serve(ln)
+	return nil
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.Stop()
+	return nil
+}
+
+func (s *Server) serve(ln net.Listener) {
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			cn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.conns[cn] = struct{}{}
+			s.accepted++
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serveConn(cn)
+			}()
+		}
+	}()
+}
+
+func (s *Server) serveConn(cn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, cn)
+		s.mu.Unlock()
+		_ = cn.Close()
+	}()
+
+	rr := bufio.NewReader(cn)
+	for {
+		line, err := rr.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		reply, quit := s.handle(strings.TrimRight(line, "\r\n"), rr)
+		if quit {
+			return
+		}
+		if len(reply) == 0 {
+			continue
+		}
+		if !s.deliver(cn, reply) {
+			return
+		}
+	}
+}
+
+// deliver writes the reply with the latency and the fault applied, it returns
+// false if the connection should be closed.
+func (s *Server) deliver(cn net.Conn, reply []byte) bool {
+	s.mu.Lock()
+	latency := s.latency
+	fault := FaultNone
+	if len(s.faults) > 0 {
+		fault = s.faults[0]
+		s.faults = s.faults[1:]
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	switch fault {
+	case FaultDrop:
+		return false
+	case FaultPartialWrite:
+		_, _ = cn.Write(reply[:len(reply)/2])
+		return false
+	case FaultStall:
+		_, _ = io.Copy(io.Discard, cn)
+		return false
+	case FaultGarbage:
+		reply = []byte(garbageLine)
+	case FaultDelayedTail:
+		if _, err := cn.Write(reply[:len(reply)/2]); err != nil {
+			return false
+		}
+		time.Sleep(DelayedTailDelay)
+		reply = reply[len(reply)/2:]
+	}
+
+	_, err := cn.Write(reply)
+	return err == nil
+}
+
+// handle executes the command line, and reads the data block from rr if the
+// command carries one. quit is true if the connection should be closed.
+func (s *Server) handle(line string, rr *bufio.Reader) (reply []byte, quit bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return []byte("ERROR\r\n"), false
+	}
+
+	switch cmd := fields[0]; cmd {
+	case "get", "gets":
+		return s.store.retrieve(fields[1:], cmd == "gets", nil), false
+	case "gat", "gats":
+		if len(fields) < 3 {
+			return clientError("bad command line format"), false
+		}
+		exptime, ok := parseExptime(fields[1])
+		if !ok {
+			return clientError("invalid exptime argument"), false
+		}
+		s.mu.Lock()
+		singleKey := s.singleKeyGAT
+		s.mu.Unlock()
+		if singleKey && len(fields) > 3 {
+			return clientError("bad command line format"), false
+		}
+		return s.store.retrieve(fields[2:], cmd == "gats", &exptime), false
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return s.store.storage(cmd, fields[1:], rr), false
+	case "delete":
+		return s.store.delete(fields[1:]), false
+	case "incr", "decr":
+		return s.store.arithmetic(cmd == "incr", fields[1:]), false
+	case "touch":
+		return s.store.touch(fields[1:]), false
+	case "flush_all":
+		return s.store.flushAll(fields[1:]), false
+	case "version":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return []byte("VERSION " + s.version + "\r\n"), false
+	case "verbosity":
+		return noreplyOr(fields[1:], "OK"), false
+	case "stats":
+		if len(fields) > 1 {
+			switch fields[1] {
+			case "items":
+				return s.store.statsItems(), false
+			case "cachedump":
+				return s.store.cachedump(fields[2:]), false
+			case "settings":
+				return s.settings(), false
+			}
+		}
+		return s.stats(), false
+	case "lru_crawler":
+		if len(fields) == 3 && fields[1] == "metadump" && fields[2] == "all" {
+			return s.store.metadump(), false
+		}
+		return clientError("bad command line format"), false
+	case "quit":
+		return nil, true
+	case "mg":
+		return s.store.metaGet(fields[1:]), false
+	case "ms":
+		return s.store.metaSet(fields[1:], rr), false
+	case "md":
+		return s.store.metaDelete(fields[1:]), false
+	case "ma":
+		return s.store.metaArithmetic(fields[1:]), false
+	case "me":
+		return s.store.metaDebug(fields[1:]), false
+	case "mn":
+		return []byte("MN\r\n"), false
+	}
+
+	return []byte("ERROR\r\n"), false
+}
+
+// settings replies a subset of the settings of `stats settings`.
+func (s *Server) settings() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, port, _ := net.SplitHostPort(s.addr)
+	return []byte(fmt.Sprintf("STAT maxbytes 67108864\r\nSTAT maxconns 1024\r\nSTAT tcpport %s\r\n"+
+		"STAT udpport 0\r\nSTAT num_threads 4\r\nSTAT item_size_max %d\r\nSTAT cas_enabled yes\r\n"+
+		"STAT binding_protocol ascii\r\nEND\r\n", port, s.itemSizeMax))
+}
+
+// stats replies a subset of the general-purpose statistics.
+func (s *Server) stats() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	stat := func(name string, value any) {
+		_, _ = fmt.Fprintf(&b, "STAT %s %v\r\n", name, value)
+	}
+
+	stat("pid", 1)
+	stat("uptime", int64(time.Since(s.started)/time.Second))
+	stat("version", s.version)
+	stat("pointer_size", 64)
+	stat("curr_connections", len(s.conns))
+	stat("total_connections", s.accepted)
+	stat("curr_items", s.store.len())
+	b.WriteString("END\r\n")
+
+	return []byte(b.String())
+}
@@ -0,0 +1,487 @@
+package testserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRelativeExpiration is the max exptime interpreted as a relative number of
+// seconds, the greater one is an absolute Unix timestamp.
+const maxRelativeExpiration = 60 * 60 * 24 * 30
+
+type item struct {
+	value []byte
+	flags uint32
+	// expireAt is zero if the item never expires.
+	expireAt time.Time
+	cas      uint64
+	fetched  bool
+	accessed time.Time
+}
+
+// store holds the items and executes the text protocol commands on them.
+type store struct {
+	mu     sync.Mutex // guards following
+	items  map[string]*item
+	casSeq uint64
+	// skew is added to the wall clock, so that the items could expire without sleeping.
+	skew time.Duration
+	// flushAt is the time the items are flushed by a delayed flush_all, zero if
+	// there is none pending.
+	flushAt time.Time
+}
+
+func newStore() *store {
+	return &store{items: make(map[string]*item)}
+}
+
+// nowLocked returns the current time of the store.
+// NOTE: MUST run in the store.mu.Lock()
+func (st *store) nowLocked() time.Time {
+	return time.Now().Add(st.skew)
+}
+
+// advance moves the clock of the store forward by d.
+func (st *store) advance(d time.Duration) {
+	st.mu.Lock()
+	st.skew += d
+	st.mu.Unlock()
+}
+
+func (st *store) len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.flushDueLocked()
+	return len(st.items)
+}
+
+// flushDueLocked flushes the items if the delayed flush_all is due.
+// NOTE: MUST run in the store.mu.Lock()
+func (st *store) flushDueLocked() {
+	if st.flushAt.IsZero() || st.nowLocked().Before(st.flushAt) {
+		return
+	}
+
+	st.items = make(map[string]*item)
+	st.flushAt = time.Time{}
+}
+
+// getLocked returns the item which is not expired, nil if missing.
+// NOTE: MUST run in the store.mu.Lock()
+func (st *store) getLocked(key string) *item {
+	st.flushDueLocked()
+	it, ok := st.items[key]
+	if !ok {
+		return nil
+	}
+	if !it.expireAt.IsZero() && !st.nowLocked().Before(it.expireAt) {
+		delete(st.items, key)
+		return nil
+	}
+
+	return it
+}
+
+// putLocked stores the item with a new cas unique.
+// NOTE: MUST run in the store.mu.Lock()
+func (st *store) putLocked(key string, it *item) {
+	st.casSeq++
+	it.cas = st.casSeq
+	it.accessed = st.nowLocked()
+	st.items[key] = it
+}
+
+// parseExptime parses the exptime argument of text protocol.
+func parseExptime(s string) (int64, bool) {
+	exptime, err := strconv.ParseInt(s, 10, 64)
+	return exptime, err == nil
+}
+
+// expireAtLocked converts the exptime to the time the item expires at, the zero
+// time means never expires.
+// NOTE: MUST run in the store.mu.Lock()
+func (st *store) expireAtLocked(exptime int64) time.Time {
+	switch {
+	case exptime == 0:
+		return time.Time{}
+	case exptime < 0:
+		return st.nowLocked().Add(-time.Second)
+	case exptime <= maxRelativeExpiration:
+		return st.nowLocked().Add(time.Duration(exptime) * time.Second)
+	}
+
+	return time.Unix(exptime, 0)
+}
+
+// readDataBlock reads the data block of n bytes terminated by CRLF.
+func readDataBlock(rr *bufio.Reader, n int) ([]byte, bool) {
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(rr, data); err != nil {
+		return nil, false
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return nil, false
+	}
+
+	return data[:n], true
+}
+
+func clientError(message string) []byte {
+	return []byte("CLIENT_ERROR " + message + "\r\n")
+}
+
+// noreplyOr returns nil if the last argument is noreply, otherwise the reply line.
+func noreplyOr(args []string, reply string) []byte {
+	if len(args) > 0 && args[len(args)-1] == "noreply" {
+		return nil
+	}
+
+	return []byte(reply + "\r\n")
+}
+
+// retrieve executes get/gets, and gat/gats if exptime is not nil.
+func (st *store) retrieve(keys []string, withCAS bool, exptime *int64) []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var b bytes.Buffer
+	for _, key := range keys {
+		it := st.getLocked(key)
+		if it == nil {
+			continue
+		}
+		if exptime != nil {
+			it.expireAt = st.expireAtLocked(*exptime)
+		}
+		it.fetched = true
+		it.accessed = st.nowLocked()
+
+		b.WriteString("VALUE " + key + " " + strconv.FormatUint(uint64(it.flags), 10) + " " + strconv.Itoa(len(it.value)))
+		if withCAS {
+			b.WriteString(" " + strconv.FormatUint(it.cas, 10))
+		}
+		b.WriteString("\r\n")
+		b.Write(it.value)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("END\r\n")
+
+	return b.Bytes()
+}
+
+// storage executes set/add/replace/append/prepend/cas:
+//
+//	<command name> <key> <flags> <exptime> <bytes> [noreply]\r\n
+//	cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]\r\n
+func (st *store) storage(cmd string, args []string, rr *bufio.Reader) []byte {
+	minArgs := 4
+	if cmd == "cas" {
+		minArgs = 5
+	}
+	if len(args) < minArgs {
+		return clientError("bad command line format")
+	}
+
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, ok := parseExptime(args[2])
+	n, err2 := strconv.Atoi(args[3])
+	if err1 != nil || !ok || err2 != nil || n < 0 {
+		return clientError("bad command line format")
+	}
+	var unique uint64
+	if cmd == "cas" {
+		var err error
+		if unique, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			return clientError("bad command line format")
+		}
+	}
+
+	data, ok := readDataBlock(rr, n)
+	if !ok {
+		return clientError("bad data chunk")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	key := args[0]
+	it := st.getLocked(key)
+	fresh := &item{value: data, flags: uint32(flags), expireAt: st.expireAtLocked(exptime)}
+
+	switch cmd {
+	case "add":
+		if it != nil {
+			return noreplyOr(args, "NOT_STORED")
+		}
+	case "replace":
+		if it == nil {
+			return noreplyOr(args, "NOT_STORED")
+		}
+	case "append", "prepend":
+		if it == nil {
+			return noreplyOr(args, "NOT_STORED")
+		}
+		// the flags and exptime are ignored.
+		fresh.flags, fresh.expireAt = it.flags, it.expireAt
+		if cmd == "append" {
+			fresh.value = append(bytes.Clone(it.value), data...)
+		} else {
+			fresh.value = append(data, it.value...)
+		}
+	case "cas":
+		if it == nil {
+			return noreplyOr(args, "NOT_FOUND")
+		}
+		if it.cas != unique {
+			return noreplyOr(args, "EXISTS")
+		}
+	}
+
+	st.putLocked(key, fresh)
+	return noreplyOr(args, "STORED")
+}
+
+// delete executes: delete <key> [noreply]\r\n
+func (st *store) delete(args []string) []byte {
+	if len(args) < 1 {
+		return []byte("ERROR\r\n")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.getLocked(args[0]) == nil {
+		return noreplyOr(args, "NOT_FOUND")
+	}
+
+	delete(st.items, args[0])
+	return noreplyOr(args, "DELETED")
+}
+
+// arithmetic executes: incr|decr <key> <value> [noreply]\r\n
+func (st *store) arithmetic(incr bool, args []string) []byte {
+	if len(args) < 2 {
+		return []byte("ERROR\r\n")
+	}
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return clientError("invalid numeric delta argument")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	it := st.getLocked(args[0])
+	if it == nil {
+		return noreplyOr(args, "NOT_FOUND")
+	}
+
+	value, ok := applyDelta(it, incr, delta)
+	if !ok {
+		return clientError("cannot increment or decrement non-numeric value")
+	}
+	st.putLocked(args[0], it)
+
+	return noreplyOr(args, strconv.FormatUint(value, 10))
+}
+
+// applyDelta increments or decrements the numeric value of the item, the
+// increment wraps around at 64 bits and the decrement stops at 0.
+func applyDelta(it *item, incr bool, delta uint64) (uint64, bool) {
+	value, err := strconv.ParseUint(string(it.value), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	switch {
+	case incr:
+		value += delta
+	case delta > value:
+		value = 0
+	default:
+		value -= delta
+	}
+	it.value = []byte(strconv.FormatUint(value, 10))
+
+	return value, true
+}
+
+// touch executes: touch <key> <exptime> [noreply]\r\n
+func (st *store) touch(args []string) []byte {
+	if len(args) < 2 {
+		return []byte("ERROR\r\n")
+	}
+	exptime, ok := parseExptime(args[1])
+	if !ok {
+		return clientError("invalid exptime argument")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	it := st.getLocked(args[0])
+	if it == nil {
+		return noreplyOr(args, "NOT_FOUND")
+	}
+
+	it.expireAt = st.expireAtLocked(exptime)
+	return noreplyOr(args, "TOUCHED")
+}
+
+// flushAll executes: flush_all [delay] [noreply]\r\n, the items are flushed
+// once the delay elapses, and a later flush_all replaces the pending one.
+func (st *store) flushAll(args []string) []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(args) > 0 && args[0] != "noreply" {
+		delay, ok := parseExptime(args[0])
+		if !ok {
+			return clientError("bad command line format")
+		}
+		if delay > 0 {
+			st.flushAt = st.expireAtLocked(delay)
+			return noreplyOr(args, "OK")
+		}
+	}
+
+	st.items = make(map[string]*item)
+	st.flushAt = time.Time{}
+	return noreplyOr(args, "OK")
+}
+
+// remainingTTL returns the remaining seconds of the item, -1 means never expires.
+func remainingTTL(it *item, now time.Time) int64 {
+	if it.expireAt.IsZero() {
+		return -1
+	}
+
+	return int64(it.expireAt.Sub(now).Round(time.Second) / time.Second)
+}
+
+func joinTokens(tokens []string) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	return " " + strings.Join(tokens, " ")
+}
+
+// slabClassOf returns the slab class of the item, the items are grouped by the
+// size of their values like memcached does, but in fewer classes.
+func slabClassOf(it *item) int {
+	switch n := len(it.value); {
+	case n <= 64:
+		return 1
+	case n <= 1024:
+		return 2
+	}
+
+	return 3
+}
+
+// statsItems replies the number of items of each slab class, e.g. "STAT items:1:number 3".
+func (st *store) statsItems() []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	counts := make(map[int]int, 3)
+	for key := range st.items {
+		if it := st.getLocked(key); it != nil {
+			counts[slabClassOf(it)]++
+		}
+	}
+
+	var b strings.Builder
+	for class := 1; class <= 3; class++ {
+		if counts[class] > 0 {
+			b.WriteString("STAT items:" + strconv.Itoa(class) + ":number " + strconv.Itoa(counts[class]) + "\r\n")
+		}
+	}
+	b.WriteString("END\r\n")
+
+	return []byte(b.String())
+}
+
+// cachedump replies at most limit keys of the slab class, 0 means all, e.g.
+// "ITEM foo [3 b; 0 s]". The keys are ordered to make the replies stable.
+func (st *store) cachedump(args []string) []byte {
+	if len(args) != 2 {
+		return clientError("bad command line format")
+	}
+	class, err1 := strconv.Atoi(args[0])
+	limit, err2 := strconv.Atoi(args[1])
+	if err1 != nil || err2 != nil || limit < 0 {
+		return clientError("bad command line format")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	keys := make([]string, 0, len(st.items))
+	for key := range st.items {
+		if it := st.getLocked(key); it != nil && slabClassOf(it) == class {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	var b strings.Builder
+	for _, key := range keys {
+		it := st.items[key]
+		var exptime int64
+		if !it.expireAt.IsZero() {
+			exptime = it.expireAt.Unix()
+		}
+		b.WriteString("ITEM " + key + " [" + strconv.Itoa(len(it.value)) + " b; " +
+			strconv.FormatInt(exptime, 10) + " s]\r\n")
+	}
+	b.WriteString("END\r\n")
+
+	return []byte(b.String())
+}
+
+// metadump replies the metadata of all the items, e.g.
+// "key=foo exp=-1 la=1700000000 cas=1 fetch=no cls=1 size=3". The keys are URL
+// encoded and ordered to make the replies stable.
+func (st *store) metadump() []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	keys := make([]string, 0, len(st.items))
+	for key := range st.items {
+		if st.getLocked(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		it := st.items[key]
+		exptime := int64(-1)
+		if !it.expireAt.IsZero() {
+			exptime = it.expireAt.Unix()
+		}
+		fetch := "no"
+		if it.fetched {
+			fetch = "yes"
+		}
+		b.WriteString("key=" + url.QueryEscape(key) + " exp=" + strconv.FormatInt(exptime, 10) +
+			" la=" + strconv.FormatInt(it.accessed.Unix(), 10) + " cas=" + strconv.FormatUint(it.cas, 10) +
+			" fetch=" + fetch + " cls=" + strconv.Itoa(slabClassOf(it)) + " size=" + strconv.Itoa(len(it.value)) + "\r\n")
+	}
+	b.WriteString("END\r\n")
+
+	return []byte(b.String())
+}
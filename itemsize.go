@@ -0,0 +1,43 @@
+package memcached
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DetectMaxItemSize makes WithMaxItemSize detect the max item size of each memcached
+// server from `item_size_max` of `stats settings` by the first connection to it. The
+// items are not limited by the servers whose limit could not be detected, e.g. the
+// servers other than memcached.
+const DetectMaxItemSize = -1
+
+// itemHeaderSize is the size of the item header of memcached on 64-bit platforms
+// with CAS enabled, which is counted into the size of an item.
+const itemHeaderSize = 48 + 8
+
+// itemSize returns the approximate size of an item in memcached: the header, the key
+// with its terminator, and the data block with its CRLF.
+func itemSize(nKey, nValue int) int {
+	return itemHeaderSize + nKey + 1 + nValue + 2
+}
+
+// checkItemSize returns ErrValueTooLarge if the item of size bytes exceeds the max
+// item size of the memcached server at addr.
+func (c *client) checkItemSize(addr *Addr, size int) error {
+	if size == 0 || c.options.maxItemSize == 0 {
+		return nil
+	}
+
+	limit := c.options.maxItemSize
+	if limit == DetectMaxItemSize {
+		limit = 0
+		if settings := c.settingsOf(addr); settings != nil {
+			limit = settings.ItemSizeMax
+		}
+	}
+	if limit <= 0 || size <= limit {
+		return nil
+	}
+
+	return errors.Wrapf(ErrValueTooLarge, "item of %d bytes exceeds the max item size %d of %s",
+		size, limit, addr.Address)
+}
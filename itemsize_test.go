@@ -0,0 +1,56 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_WithMaxItemSize(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetItemSizeMax(1024)
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "fixed", size: 1024},
+		{name: "detected", size: DetectMaxItemSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(srv.Addr(), WithMaxItemSize(tt.size))
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			small := bytes.Repeat([]byte("a"), 512)
+			large := bytes.Repeat([]byte("a"), 1024)
+
+			require.NoError(t, c.Set(ctx, "small", small, 0, 0))
+			require.ErrorIs(t, c.Set(ctx, "large", large, 0, 0), ErrValueTooLarge)
+			require.ErrorIs(t, c.Cas(ctx, "small", large, 0, 0, 1), ErrValueTooLarge)
+			_, err = c.MetaSet(ctx, []byte("large"), large)
+			require.ErrorIs(t, err, ErrValueTooLarge)
+			err = c.SetReader(ctx, "large", bytes.NewReader(large), int64(len(large)), 0, NoExpiration)
+			require.ErrorIs(t, err, ErrValueTooLarge)
+
+			// the large item is never sent.
+			_, err = c.Get(ctx, "large")
+			require.ErrorIs(t, err, ErrNotFound)
+			item, err := c.Get(ctx, "small")
+			require.NoError(t, err)
+			assert.Equal(t, small, item.Value)
+		})
+	}
+
+	// no limit by default.
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.Set(context.Background(), "large", bytes.Repeat([]byte("a"), 2048), 0, 0))
+}
@@ -0,0 +1,200 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SampledKey is a key listed by KeySample.
+type SampledKey struct {
+	Addr *Addr
+	Key  string
+	// SlabClass is the slab class of the item in the server.
+	SlabClass int
+	// Size is the size of the value in bytes.
+	Size int
+	// ExpireAt is the time the item expires at, zero if it never expires. Some
+	// versions of memcached report the start time of the server for the items
+	// which never expire.
+	ExpireAt time.Time
+}
+
+var (
+	// _ItemsNumberPrefix is the prefix of the number of items of a slab class
+	// replied by `stats items`, e.g. "STAT items:1:number 3".
+	_ItemsNumberPrefix = []byte("STAT items:")
+	_ItemBytes         = []byte("ITEM ")
+)
+
+// KeySample lists at most perClass keys of each slab class of every memcached
+// server by `stats items` and `stats cachedump <class> <perClass>`, for the servers
+// whose lru_crawler is disabled, e.g. to inspect what is cached. 0 perClass means
+// as many as the server replies.
+//
+// It's best-effort only: the server replies the most recently used items of each
+// class, and limits the reply of a class to 2MB, so that it's a sample rather than
+// a full listing, and the keys may be expired or changed once listed. It's also
+// expensive for the server, since the slab class is locked while dumped, so it
+// must not be used in the hot path.
+//
+// It's only supported by memcached, ErrNotSupported is returned for the servers
+// reported otherwise by the capability detection, or which reject the command.
+// The keys of the servers replied are returned even if others fail.
+func (c *client) KeySample(ctx context.Context, perClass int) ([]*SampledKey, error) {
+	if perClass < 0 {
+		return nil, errors.Wrap(ErrInvalidArgument, "negative number of keys per slab class")
+	}
+	if c.options.compatibility != CompatMemcached {
+		return nil, errors.Wrapf(ErrNotSupported, "stats cachedump with %s", c.options.compatibility)
+	}
+
+	var (
+		mu   sync.Mutex
+		keys = make([]*SampledKey, 0, 64)
+	)
+
+	call := func(ctx context.Context, addr *Addr, cn memcachedConn) error {
+		if err := c.checkFeature(addr, featureCachedump); err != nil {
+			return err
+		}
+
+		lines, err := c.statsLines(ctx, addr, cn, "items")
+		if err != nil {
+			return err
+		}
+		classes := parseSlabClasses(lines)
+
+		for _, class := range classes {
+			lines, err = c.statsLines(ctx, addr, cn, "cachedump "+strconv.Itoa(class)+" "+strconv.Itoa(perClass))
+			if err != nil {
+				return err
+			}
+
+			sampled, err := parseCachedump(lines, addr, class)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			keys = append(keys, sampled...)
+			mu.Unlock()
+		}
+
+		return nil
+	}
+
+	err := c.broadcastRequest(ctx, "stats", call)
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Addr.Address != keys[j].Addr.Address {
+			return keys[i].Addr.Address < keys[j].Addr.Address
+		}
+		if keys[i].SlabClass != keys[j].SlabClass {
+			return keys[i].SlabClass < keys[j].SlabClass
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if err != nil {
+		return keys, errors.Wrap(err, "request failed")
+	}
+
+	return keys, nil
+}
+
+// statsLines sends `stats <subCommand>` over the connection and returns the lines
+// replied before END. The commands rejected by the server are ErrNotSupported.
+func (c *client) statsLines(ctx context.Context, addr *Addr, cn memcachedConn, subCommand string) ([][]byte, error) {
+	req, resp := buildStatsCommand(subCommand)
+	defer releaseReqAndResp(req, resp)
+
+	if err := req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
+		return nil, errors.Wrap(err, "send failed")
+	}
+	err := resp.recv(ctx, cn, c.baseReadTimeout(addr))
+	c.options.wireLogger.log(addr, req, resp, err)
+	if err != nil {
+		if errors.Is(err, ErrNonexistentCommand) || errors.Is(err, ErrClientError) {
+			return nil, errors.Wrapf(ErrNotSupported, "stats %s: %v", subCommand, err)
+		}
+		return nil, errors.Wrap(err, "recv failed")
+	}
+
+	// the lines are only valid until the response is released.
+	lines := make([][]byte, 0, len(resp.rawLines))
+	for _, line := range resp.rawLines {
+		if bytes.Equal(line, _EndCRLFBytes) {
+			break
+		}
+		lines = append(lines, bytes.Clone(trimCRLF(line)))
+	}
+
+	return lines, nil
+}
+
+// parseSlabClasses parses the slab classes holding items from the reply of
+// `stats items`, e.g. "STAT items:1:number 3".
+func parseSlabClasses(lines [][]byte) []int {
+	classes := make([]int, 0, 8)
+	for _, line := range lines {
+		if !bytes.HasPrefix(line, _ItemsNumberPrefix) {
+			continue
+		}
+
+		fields := bytes.Fields(line[len(_ItemsNumberPrefix):])
+		if len(fields) != 2 {
+			continue
+		}
+		name, number := fields[0], fields[1]
+		classID, stat, ok := bytes.Cut(name, []byte(":"))
+		if !ok || string(stat) != "number" {
+			continue
+		}
+
+		class, err := strconv.Atoi(string(classID))
+		if err != nil {
+			continue
+		}
+		if n, err := strconv.Atoi(string(number)); err != nil || n == 0 {
+			continue
+		}
+		classes = append(classes, class)
+	}
+
+	return classes
+}
+
+// parseCachedump parses the keys from the reply of `stats cachedump`, e.g.
+// "ITEM foo [3 b; 1700000000 s]".
+func parseCachedump(lines [][]byte, addr *Addr, class int) ([]*SampledKey, error) {
+	keys := make([]*SampledKey, 0, len(lines))
+	for _, line := range lines {
+		if !bytes.HasPrefix(line, _ItemBytes) {
+			return nil, errors.Wrapf(ErrMalformedResponse, "unexpected cachedump line %q", line)
+		}
+
+		// <key> [<size> b; <exptime> s]
+		fields := bytes.Fields(line[len(_ItemBytes):])
+		if len(fields) != 5 || len(fields[1]) < 2 || fields[1][0] != '[' {
+			return nil, errors.Wrapf(ErrMalformedResponse, "unexpected cachedump line %q", line)
+		}
+
+		size, err1 := strconv.Atoi(string(fields[1][1:]))
+		exptime, err2 := strconv.ParseInt(string(fields[3]), 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, errors.Wrapf(ErrMalformedResponse, "unexpected cachedump line %q", line)
+		}
+
+		key := &SampledKey{Addr: addr, Key: string(fields[0]), SlabClass: class, Size: size}
+		if exptime > 0 {
+			key.ExpireAt = time.Unix(exptime, 0)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
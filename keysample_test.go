@@ -0,0 +1,125 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSlabClasses(t *testing.T) {
+	lines := [][]byte{
+		[]byte("STAT items:1:number 3"),
+		[]byte("STAT items:1:age 10"),
+		[]byte("STAT items:5:number 0"),
+		[]byte("STAT items:12:number 7"),
+		[]byte("STAT items:x:number 7"),
+	}
+
+	assert.Equal(t, []int{1, 12}, parseSlabClasses(lines))
+}
+
+func Test_parseCachedump(t *testing.T) {
+	addr := NewAddr("tcp", "localhost:11211", 0)
+
+	tests := []struct {
+		name    string
+		lines   [][]byte
+		want    []*SampledKey
+		wantErr error
+	}{
+		{
+			name:  "items",
+			lines: [][]byte{[]byte("ITEM foo [3 b; 0 s]"), []byte("ITEM bar [10 b; 1700000000 s]")},
+			want: []*SampledKey{
+				{Addr: addr, Key: "foo", SlabClass: 2, Size: 3},
+				{Addr: addr, Key: "bar", SlabClass: 2, Size: 10, ExpireAt: time.Unix(1700000000, 0)},
+			},
+		},
+		{
+			name:  "empty",
+			lines: nil,
+			want:  []*SampledKey{},
+		},
+		{
+			name:    "malformed",
+			lines:   [][]byte{[]byte("ITEM foo [3 b;]")},
+			wantErr: ErrMalformedResponse,
+		},
+		{
+			name:    "unexpected line",
+			lines:   [][]byte{[]byte("STAT foo 1")},
+			wantErr: ErrMalformedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCachedump(tt.lines, addr, 2)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_client_KeySample(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	for _, key := range keys {
+		require.NoError(t, c.Set(ctx, key, []byte("small"), 0, 0))
+	}
+	require.NoError(t, c.Set(ctx, "large", bytes.Repeat([]byte("v"), 2048), 0, time.Hour))
+
+	sampled, err := c.KeySample(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, sampled, len(keys)+1)
+
+	got := make(map[string]*SampledKey, len(sampled))
+	for _, key := range sampled {
+		got[key.Key] = key
+	}
+	assert.Equal(t, 5, got["a"].Size)
+	assert.True(t, got["a"].ExpireAt.IsZero())
+	assert.Equal(t, 2048, got["large"].Size)
+	assert.False(t, got["large"].ExpireAt.IsZero())
+	assert.NotEqual(t, got["a"].SlabClass, got["large"].SlabClass)
+
+	// at most 1 key of each slab class of each server.
+	sampled, err = c.KeySample(ctx, 1)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(sampled), 4)
+
+	_, err = c.KeySample(ctx, -1)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func Test_client_KeySample_notSupported(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetVersion("1.2.8")
+
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.KeySample(context.Background(), 10)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	proxied, err := New(srv.Addr(), WithCompatibility(CompatTwemproxy))
+	require.NoError(t, err)
+	defer proxied.Close()
+
+	_, err = proxied.KeySample(context.Background(), 10)
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
@@ -0,0 +1,136 @@
+package memcached
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// concurrencyLimiter limits the number of in-flight requests to one memcached
+// server, so that a slow server could not absorb unbounded goroutines of the
+// callers. The requests beyond the limit are shed with ErrOverloaded.
+type concurrencyLimiter struct {
+	// slots holds a token for each in-flight request.
+	slots chan struct{}
+	// wait is the max duration to wait for a slot, 0 means failing fast.
+	wait time.Duration
+	// shed is the number of requests rejected with ErrOverloaded.
+	shed atomic.Int64
+}
+
+func newConcurrencyLimiter(n int, wait time.Duration) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots: make(chan struct{}, n),
+		wait:  wait,
+	}
+}
+
+// acquire takes a slot for the request, it returns ErrOverloaded if no slot is
+// released within the wait duration, or the error of the context if it's done
+// before that. The slot must be released by release.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if l.wait <= 0 {
+		l.shed.Add(1)
+		return ErrOverloaded
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		l.shed.Add(1)
+		return ErrOverloaded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *concurrencyLimiter) release() { <-l.slots }
+
+// inFlight returns the number of in-flight requests.
+func (l *concurrencyLimiter) inFlight() int { return len(l.slots) }
+
+// tokenBucket is the token bucket limiting the rate of requests, tokens are added
+// at rate per second up to burst, and each request takes one token.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex // guards following
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// take takes a token, ok is false if there is no token now. If reserve is true,
+// the token is always taken in advance, and delay is the duration to wait until
+// it's available.
+func (b *tokenBucket) take(reserve bool) (delay time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if !reserve {
+		return 0, false
+	}
+
+	delay = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	b.tokens--
+	return delay, true
+}
+
+// refund gives back the token taken but not used.
+func (b *tokenBucket) refund() {
+	b.mu.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+	b.mu.Unlock()
+}
+
+// wait takes a token, and waits until it's available or the context is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	delay, _ := b.take(true)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.refund()
+		return ctx.Err()
+	}
+}
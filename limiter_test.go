@@ -0,0 +1,217 @@
+package memcached
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_concurrencyLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		wait     time.Duration
+		ctx      func() (context.Context, context.CancelFunc)
+		wantErr  error
+		wantShed int64
+	}{
+		{
+			name:     "fail fast",
+			wantErr:  ErrOverloaded,
+			wantShed: 1,
+		},
+		{
+			name:     "wait timeout",
+			wait:     10 * time.Millisecond,
+			wantErr:  ErrOverloaded,
+			wantShed: 1,
+		},
+		{
+			name: "context done",
+			wait: time.Minute,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+
+			l := newConcurrencyLimiter(1, tt.wait)
+			require.NoError(t, l.acquire(ctx))
+			assert.Equal(t, 1, l.inFlight())
+
+			require.ErrorIs(t, l.acquire(ctx), tt.wantErr)
+			assert.Equal(t, tt.wantShed, l.shed.Load())
+
+			l.release()
+			assert.Equal(t, 0, l.inFlight())
+			require.NoError(t, l.acquire(context.Background()))
+		})
+	}
+}
+
+func Test_client_maxConcurrentRequests(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetLatency(200 * time.Millisecond)
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	hook := func(_ context.Context, info *RequestInfo) {
+		mu.Lock()
+		errs = append(errs, info.Err)
+		mu.Unlock()
+	}
+
+	c, err := New(srv.Addr(), WithMaxConcurrentRequests(1), WithRequestHook(hook))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	done := make(chan error, 1)
+	go func() { done <- c.Set(ctx, "foo", []byte("bar"), 0, 0) }()
+
+	require.Eventually(t, func() bool {
+		return c.PoolStats()[srv.Addr()] != nil && c.PoolStats()[srv.Addr()].InFlightRequests == 1
+	}, time.Second, time.Millisecond)
+
+	_, err = c.Get(ctx, "foo")
+	require.ErrorIs(t, err, ErrOverloaded)
+	require.NoError(t, <-done)
+
+	stats := c.PoolStats()[srv.Addr()]
+	assert.Equal(t, 0, stats.InFlightRequests)
+	assert.Equal(t, int64(1), stats.ShedRequests)
+
+	mu.Lock()
+	assert.ErrorIs(t, errs[0], ErrOverloaded)
+	mu.Unlock()
+
+	// the request waits for the in-flight one rather than failing fast.
+	waiting, err := New(srv.Addr(), WithMaxConcurrentRequests(1), WithConcurrencyWaitTimeout(time.Second))
+	require.NoError(t, err)
+	defer waiting.Close()
+
+	go func() { done <- waiting.Set(ctx, "foo", []byte("baz"), 0, 0) }()
+	require.Eventually(t, func() bool {
+		return waiting.PoolStats()[srv.Addr()] != nil && waiting.PoolStats()[srv.Addr()].InFlightRequests == 1
+	}, time.Second, time.Millisecond)
+
+	item, err := waiting.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", string(item.Value))
+	require.NoError(t, <-done)
+}
+
+func Test_tokenBucket(t *testing.T) {
+	b := newTokenBucket(100, 2)
+
+	// the burst is taken at once.
+	for i := 0; i < 2; i++ {
+		_, ok := b.take(false)
+		require.True(t, ok)
+	}
+	_, ok := b.take(false)
+	require.False(t, ok)
+
+	// the reserved token is available after about 1/rate second.
+	delay, ok := b.take(true)
+	require.True(t, ok)
+	assert.InDelta(t, 10*time.Millisecond, delay, float64(2*time.Millisecond))
+
+	b.refund()
+	start := time.Now()
+	require.NoError(t, b.wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, b.wait(ctx), context.Canceled)
+}
+
+func Test_client_rateLimit(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		allowed int
+	}{
+		{name: "per node", opts: []ClientOption{WithRateLimit(1, 2)}, allowed: 4},
+		{name: "global", opts: []ClientOption{WithGlobalRateLimit(1, 3)}, allowed: 3},
+		{name: "both", opts: []ClientOption{WithRateLimit(1, 1), WithGlobalRateLimit(1, 5)}, allowed: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(srv1.Addr()+","+srv2.Addr(), tt.opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			// the keys are spread over both servers.
+			allowed := 0
+			for i := 0; i < 32; i++ {
+				err := c.Set(ctx, "key-"+strconv.Itoa(i), []byte("value"), 0, 0)
+				if err != nil {
+					require.ErrorIs(t, err, ErrRateLimited)
+					continue
+				}
+				allowed++
+			}
+			assert.Equal(t, tt.allowed, allowed)
+		})
+	}
+}
+
+func Test_client_rateLimitWait(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithRateLimit(20, 1), WithRateLimitWait(true))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+	}
+	// the 2 requests beyond the burst wait for 50ms each.
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+	require.ErrorIs(t, c.Set(timeout, "foo", []byte("bar"), 0, 0), context.DeadlineExceeded)
+}
+
+func Test_client_rateLimitWait_refund(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithRateLimit(1, 1), WithGlobalRateLimit(1, 2), WithRateLimitWait(true))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	// the global token is taken at once, but the wait for the node fails.
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.Set(timeout, "foo", []byte("bar"), 0, 0), context.DeadlineExceeded)
+
+	// the global token is given back.
+	_, ok := c.(*client).globalBucket.take(false)
+	assert.True(t, ok)
+}
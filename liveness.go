@@ -0,0 +1,108 @@
+package memcached
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LivenessProbe is the way to check whether an idle connection is still alive
+// before it's taken out of the pool, see WithLivenessCheck.
+type LivenessProbe uint8
+
+const (
+	// ProbePoll polls the socket without blocking, the connection is dead if it's
+	// closed or reset by the server, or there are bytes which are never requested.
+	// It costs no round trip, and falls back to ProbeNoOp on the platforms or the
+	// connections (e.g. TLS) which could not be polled.
+	ProbePoll LivenessProbe = iota
+	// ProbeNoOp sends a mn command and waits for the reply within the read timeout,
+	// it costs a round trip but detects the server which hangs too.
+	ProbeNoOp
+)
+
+// errUnexpectedBytes means the idle connection has received the bytes which are
+// never requested, so that it's out of sync with the server.
+var errUnexpectedBytes = errors.New("unexpected bytes on idle connection")
+
+// livenessCheck checks whether the connections idle longer than idle are alive
+// before they are taken out of the pool.
+type livenessCheck struct {
+	idle  time.Duration
+	probe func(ctx context.Context, cn memcachedConn) bool
+}
+
+// due reports whether the connection has been idle long enough to be checked at now.
+func (l *livenessCheck) due(cn memcachedConn, now time.Time) bool {
+	_, ok := cn.idle(now.Add(-l.idle))
+	return ok
+}
+
+// livenessCheckOf returns the liveness check of the connections to the memcached
+// server at addr, it's nil if WithLivenessCheck is not set.
+func (c *client) livenessCheckOf(addr *Addr) *livenessCheck {
+	if c.options.livenessIdle <= 0 || isUDPNetwork(addr) {
+		return nil
+	}
+
+	noOp := func(ctx context.Context, cn memcachedConn) bool {
+		return c.probeNoOp(ctx, addr, cn) == nil
+	}
+	if c.options.livenessProbe == ProbeNoOp {
+		return &livenessCheck{idle: c.options.livenessIdle, probe: noOp}
+	}
+
+	return &livenessCheck{
+		idle: c.options.livenessIdle,
+		probe: func(ctx context.Context, cn memcachedConn) bool {
+			p, ok := cn.(pollableConn)
+			if !ok {
+				return noOp(ctx, cn)
+			}
+			polled, err := p.poll()
+			if !polled {
+				return noOp(ctx, cn)
+			}
+			return err == nil
+		},
+	}
+}
+
+// probeNoOp sends a mn command over the connection and waits for the reply. The
+// servers which do not support the meta commands reply an error, which proves the
+// connection is alive as well.
+func (c *client) probeNoOp(ctx context.Context, addr *Addr, cn memcachedConn) error {
+	req, resp := buildMetaNoOpCommand()
+	defer releaseReqAndResp(req, resp)
+
+	c.applyCompatibility(resp)
+	if err := req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
+		return errors.Wrap(err, "send failed")
+	}
+	err := resp.recv(ctx, cn, c.baseReadTimeout(addr))
+	c.options.wireLogger.log(addr, req, resp, err)
+	if err != nil && !isInSyncError(err) {
+		return errors.Wrap(err, "recv failed")
+	}
+
+	return nil
+}
+
+// pollableConn is implemented by the connections which could be checked without
+// blocking, see ProbePoll.
+type pollableConn interface {
+	// poll reports the error of the connection, polled is false if it could not
+	// be polled.
+	poll() (polled bool, err error)
+}
+
+var _ pollableConn = (*conn)(nil)
+
+func (c *conn) poll() (polled bool, err error) {
+	if c.rr.Buffered() > 0 {
+		return true, errUnexpectedBytes
+	}
+
+	return pollConn(c.raw)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package memcached
+
+import "net"
+
+// pollConn could not poll the connection on this platform, the liveness check
+// falls back to ProbeNoOp.
+func pollConn(net.Conn) (polled bool, err error) {
+	return false, nil
+}
@@ -0,0 +1,57 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_livenessCheck(t *testing.T) {
+	for _, probe := range []LivenessProbe{ProbePoll, ProbeNoOp} {
+		t.Run([]string{"poll", "noop"}[probe], func(t *testing.T) {
+			srv := newTestServer(t)
+			c, err := New(srv.Addr(), WithMaxConns(1),
+				WithLivenessCheck(time.Nanosecond, probe), WithStaleConnReplay(false))
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+			// the alive connection is reused.
+			accepted := srv.Accepted()
+			_, err = c.Get(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, accepted, srv.Accepted())
+			assert.Equal(t, int64(0), c.PoolStats()[srv.Addr()].DeadClosed)
+
+			// the dead connection is closed before the request is sent over it.
+			dropStaleConn(srv)
+			item, err := c.Get(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, "bar", string(item.Value))
+			assert.Equal(t, accepted+1, srv.Accepted())
+			assert.Equal(t, int64(1), c.PoolStats()[srv.Addr()].DeadClosed)
+		})
+	}
+}
+
+func Test_client_livenessCheck_idle(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithMaxConns(1),
+		WithLivenessCheck(time.Hour, ProbePoll), WithStaleConnReplay(false))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	// the connection which has not been idle long enough is not checked.
+	dropStaleConn(srv)
+	_, err = c.Get(ctx, "foo")
+	require.Error(t, err)
+	assert.Equal(t, int64(0), c.PoolStats()[srv.Addr()].DeadClosed)
+}
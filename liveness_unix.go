@@ -0,0 +1,45 @@
+//go:build unix
+
+package memcached
+
+import (
+	"io"
+	"net"
+	"syscall"
+)
+
+// pollConn peeks the socket of the connection without blocking, the connection
+// is alive if there is nothing to read. polled is false if the connection does
+// not expose its socket, e.g. TLS.
+func pollConn(raw net.Conn) (polled bool, err error) {
+	sc, ok := raw.(syscall.Conn)
+	if !ok {
+		return false, nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return false, nil
+	}
+
+	var buf [1]byte
+	rerr := rc.Read(func(fd uintptr) bool {
+		n, _, perr := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case n == 0 && perr == nil:
+			err = io.EOF
+		case n > 0:
+			err = errUnexpectedBytes
+		case perr == syscall.EAGAIN || perr == syscall.EWOULDBLOCK:
+			err = nil
+		default:
+			err = perr
+		}
+		// it never waits for the socket to be readable.
+		return true
+	})
+	if rerr != nil {
+		return true, rerr
+	}
+
+	return true, err
+}
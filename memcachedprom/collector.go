@@ -0,0 +1,401 @@
+// Package memcachedprom provides a Prometheus collector for the memcached client.
+//
+// The collector is fed by the request hook and the pool statistics of the client:
+//
+//	collector := memcachedprom.NewCollector()
+//	client, err := memcached.New(addr, memcached.WithRequestHook(collector.ObserveRequest))
+//	if err != nil {
+//		// handle error
+//	}
+//	collector.WatchPools(client)
+//	collector.WatchHits(client)
+//	prometheus.MustRegister(collector)
+//
+// The rates of the counters of the servers polled by the client are exported by
+// WatchStatsDelta.
+package memcachedprom
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/yeqown/memcached"
+)
+
+// Status values of the requests.
+const (
+	StatusOK          = "ok"
+	StatusMiss        = "miss"
+	StatusExists      = "exists"
+	StatusNotStored   = "not_stored"
+	StatusServerError = "server_error"
+	StatusCanceled    = "canceled"
+	StatusPoolTimeout = "pool_timeout"
+	StatusOverloaded  = "overloaded"
+	StatusRateLimited = "rate_limited"
+	StatusError       = "error"
+)
+
+// PoolStatser is implemented by memcached.Client.
+type PoolStatser interface {
+	PoolStats() map[string]*memcached.PoolStats
+}
+
+// HitStatser is implemented by memcached.Client.
+type HitStatser interface {
+	Metrics() *memcached.Metrics
+}
+
+// StatsDeltaer is implemented by memcached.Client.
+type StatsDeltaer interface {
+	StatsDelta(ctx context.Context, addr *memcached.Addr, interval time.Duration) (<-chan *memcached.StatRate, error)
+}
+
+// Option configures the Collector.
+type Option func(*options)
+
+type options struct {
+	namespace   string
+	constLabels prometheus.Labels
+	buckets     []float64
+}
+
+// WithNamespace sets the namespace of the metrics, default is "memcached".
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithConstLabels sets the labels attached to all metrics, e.g. to distinguish
+// the clients of different clusters registered in one registry.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(o *options) {
+		o.constLabels = labels
+	}
+}
+
+// WithBuckets sets the buckets of the request latency histogram in seconds.
+func WithBuckets(buckets []float64) Option {
+	return func(o *options) {
+		if len(buckets) == 0 {
+			return
+		}
+		o.buckets = buckets
+	}
+}
+
+// defaultBuckets ranges from 100µs to about 1.6s, memcached requests are
+// mostly served in less than a millisecond.
+var defaultBuckets = prometheus.ExponentialBuckets(0.0001, 2, 15)
+
+// Collector is a prometheus.Collector exposing the metrics of a memcached client:
+//
+//   - <namespace>_requests_total{command,node,status}
+//   - <namespace>_request_duration_seconds{command,node}
+//   - <namespace>_node_up{node}
+//   - <namespace>_pool_* of each node, see WatchPools.
+//   - <namespace>_hits_total{node} and <namespace>_misses_total{node}, see WatchHits.
+//   - <namespace>_server_* of each node, see WatchStatsDelta.
+type Collector struct {
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	nodeUp   *prometheus.GaugeVec
+
+	poolConns       *prometheus.Desc
+	poolIdleConns   *prometheus.Desc
+	poolMaxConns    *prometheus.Desc
+	poolWaiting     *prometheus.Desc
+	poolWaitTotal   *prometheus.Desc
+	poolWaitSeconds *prometheus.Desc
+	poolClosedConns *prometheus.Desc
+	poolInFlight    *prometheus.Desc
+	poolShedTotal   *prometheus.Desc
+	poolFailedOpen  *prometheus.Desc
+
+	hitsTotal   *prometheus.Desc
+	missesTotal *prometheus.Desc
+
+	serverGets         *prometheus.Desc
+	serverSets         *prometheus.Desc
+	serverHits         *prometheus.Desc
+	serverMisses       *prometheus.Desc
+	serverEvictions    *prometheus.Desc
+	serverBytesRead    *prometheus.Desc
+	serverBytesWritten *prometheus.Desc
+	serverHitRatio     *prometheus.Desc
+
+	mu    sync.Mutex // guards following
+	pool  PoolStatser
+	hits  HitStatser
+	rates map[string]*memcached.StatRate
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector creates a Collector, the requests are observed by passing
+// ObserveRequest to memcached.WithRequestHook.
+func NewCollector(opts ...Option) *Collector {
+	o := &options{
+		namespace: "memcached",
+		buckets:   defaultBuckets,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	poolDesc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, "pool", name), help,
+			append([]string{"node"}, labels...), o.constLabels,
+		)
+	}
+
+	serverDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, "server", name), help, []string{"node"}, o.constLabels,
+		)
+	}
+
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   o.namespace,
+			Name:        "requests_total",
+			Help:        "The total number of requests by command, node and status.",
+			ConstLabels: o.constLabels,
+		}, []string{"command", "node", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   o.namespace,
+			Name:        "request_duration_seconds",
+			Help:        "The latency of requests by command and node.",
+			ConstLabels: o.constLabels,
+			Buckets:     o.buckets,
+		}, []string{"command", "node"}),
+		nodeUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   o.namespace,
+			Name:        "node_up",
+			Help:        "Whether the last request to the node was answered by the server (1) or failed (0).",
+			ConstLabels: o.constLabels,
+		}, []string{"node"}),
+
+		poolConns:       poolDesc("connections", "The number of connections opened, both in use and idle."),
+		poolIdleConns:   poolDesc("idle_connections", "The number of idle connections."),
+		poolMaxConns:    poolDesc("max_connections", "The max number of connections."),
+		poolWaiting:     poolDesc("waiting", "The number of callers waiting for a connection now."),
+		poolWaitTotal:   poolDesc("wait_total", "The total number of callers waited for a connection."),
+		poolWaitSeconds: poolDesc("wait_seconds_total", "The total time waited for connections."),
+		poolClosedConns: poolDesc("closed_connections_total",
+			"The total number of connections closed by the pool by reason.", "reason"),
+		poolInFlight:  poolDesc("in_flight_requests", "The number of requests in flight now."),
+		poolShedTotal: poolDesc("shed_requests_total", "The total number of requests shed by the limit of in-flight requests."),
+		poolFailedOpen: poolDesc("failed_open_requests_total",
+			"The total number of requests failed open as cache misses or no-op writes."),
+
+		hitsTotal: prometheus.NewDesc(prometheus.BuildFQName(o.namespace, "", "hits_total"),
+			"The total number of keys found by the retrieval commands.", []string{"node"}, o.constLabels),
+		missesTotal: prometheus.NewDesc(prometheus.BuildFQName(o.namespace, "", "misses_total"),
+			"The total number of keys not found by the retrieval commands.", []string{"node"}, o.constLabels),
+
+		serverGets:         serverDesc("gets_per_second", "The get commands served by the server per second."),
+		serverSets:         serverDesc("sets_per_second", "The set commands served by the server per second."),
+		serverHits:         serverDesc("hits_per_second", "The keys found by the server per second."),
+		serverMisses:       serverDesc("misses_per_second", "The keys not found by the server per second."),
+		serverEvictions:    serverDesc("evictions_per_second", "The items evicted by the server per second."),
+		serverBytesRead:    serverDesc("bytes_read_per_second", "The bytes read by the server from the network per second."),
+		serverBytesWritten: serverDesc("bytes_written_per_second", "The bytes written by the server to the network per second."),
+		serverHitRatio:     serverDesc("hit_ratio", "The ratio of the hits to the gets of the server within the last interval."),
+	}
+}
+
+// WatchPools makes the collector export the statistics of the connection pools
+// of the client on each scrape, the previous watched one is replaced.
+func (c *Collector) WatchPools(client PoolStatser) {
+	c.mu.Lock()
+	c.pool = client
+	c.mu.Unlock()
+}
+
+// WatchHits makes the collector export the hits and misses of the retrieval commands
+// of the client on each scrape, the previous watched one is replaced. The hit ratio
+// could be computed from them, e.g.
+//
+//	rate(memcached_hits_total[5m]) / (rate(memcached_hits_total[5m]) + rate(memcached_misses_total[5m]))
+func (c *Collector) WatchHits(client HitStatser) {
+	c.mu.Lock()
+	c.hits = client
+	c.mu.Unlock()
+}
+
+// WatchStatsDelta makes the collector export the rates of the counters of the given
+// servers, polled by the client every interval, see memcached.Client.StatsDelta.
+// The rates are computed from the stats of the servers, so that they cover the
+// requests of all clients, unlike WatchHits. The polling stops after ctx is done,
+// and a node is not exported until its next successful poll if the poll fails.
+func (c *Collector) WatchStatsDelta(ctx context.Context, client StatsDeltaer, addrs []*memcached.Addr, interval time.Duration) error {
+	channels := make([]<-chan *memcached.StatRate, 0, len(addrs))
+	for _, addr := range addrs {
+		ch, err := client.StatsDelta(ctx, addr, interval)
+		if err != nil {
+			return errors.Wrapf(err, "watch stats of %s", addr.Address)
+		}
+		channels = append(channels, ch)
+	}
+
+	for _, ch := range channels {
+		go func() {
+			for rate := range ch {
+				c.mu.Lock()
+				if c.rates == nil {
+					c.rates = make(map[string]*memcached.StatRate)
+				}
+				if rate.Err != nil {
+					delete(c.rates, rate.Addr.Address)
+				} else {
+					c.rates[rate.Addr.Address] = rate
+				}
+				c.mu.Unlock()
+			}
+		}()
+	}
+
+	return nil
+}
+
+// ObserveRequest records the finished request, it's a memcached.RequestHook.
+func (c *Collector) ObserveRequest(_ context.Context, info *memcached.RequestInfo) {
+	status := Status(info.Err)
+
+	c.requests.WithLabelValues(info.Command, info.Addr, status).Inc()
+	c.latency.WithLabelValues(info.Command, info.Addr).Observe(info.Duration.Seconds())
+
+	switch status {
+	case StatusCanceled, StatusPoolTimeout, StatusOverloaded, StatusRateLimited:
+		// the request is not answered by the node, it tells nothing about the node.
+	case StatusError:
+		c.nodeUp.WithLabelValues(info.Addr).Set(0)
+	default:
+		c.nodeUp.WithLabelValues(info.Addr).Set(1)
+	}
+}
+
+// Status classifies the error of a request into one of the Status values.
+func Status(err error) string {
+	switch {
+	case err == nil:
+		return StatusOK
+	case errors.Is(err, memcached.ErrNotFound):
+		return StatusMiss
+	case errors.Is(err, memcached.ErrExists):
+		return StatusExists
+	case errors.Is(err, memcached.ErrNotStored):
+		return StatusNotStored
+	case errors.Is(err, memcached.ErrServerError),
+		errors.Is(err, memcached.ErrClientError),
+		errors.Is(err, memcached.ErrNonexistentCommand):
+		return StatusServerError
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return StatusCanceled
+	case errors.Is(err, memcached.ErrPoolWaitTimeout):
+		return StatusPoolTimeout
+	case errors.Is(err, memcached.ErrOverloaded):
+		return StatusOverloaded
+	case errors.Is(err, memcached.ErrRateLimited):
+		return StatusRateLimited
+	}
+
+	return StatusError
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.latency.Describe(ch)
+	c.nodeUp.Describe(ch)
+
+	ch <- c.poolConns
+	ch <- c.poolIdleConns
+	ch <- c.poolMaxConns
+	ch <- c.poolWaiting
+	ch <- c.poolWaitTotal
+	ch <- c.poolWaitSeconds
+	ch <- c.poolClosedConns
+	ch <- c.poolInFlight
+	ch <- c.poolShedTotal
+	ch <- c.poolFailedOpen
+	ch <- c.hitsTotal
+	ch <- c.missesTotal
+	ch <- c.serverGets
+	ch <- c.serverSets
+	ch <- c.serverHits
+	ch <- c.serverMisses
+	ch <- c.serverEvictions
+	ch <- c.serverBytesRead
+	ch <- c.serverBytesWritten
+	ch <- c.serverHitRatio
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.latency.Collect(ch)
+	c.nodeUp.Collect(ch)
+
+	c.mu.Lock()
+	pool, hits := c.pool, c.hits
+	rates := make([]*memcached.StatRate, 0, len(c.rates))
+	for _, rate := range c.rates {
+		rates = append(rates, rate)
+	}
+	c.mu.Unlock()
+
+	for _, rate := range rates {
+		gauge := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, rate.Addr.Address)
+		}
+
+		gauge(c.serverGets, rate.GetsPerSec)
+		gauge(c.serverSets, rate.SetsPerSec)
+		gauge(c.serverHits, rate.HitsPerSec)
+		gauge(c.serverMisses, rate.MissesPerSec)
+		gauge(c.serverEvictions, rate.EvictionsPerSec)
+		gauge(c.serverBytesRead, rate.BytesReadPerSec)
+		gauge(c.serverBytesWritten, rate.BytesWrittenPerSec)
+		gauge(c.serverHitRatio, rate.HitRate)
+	}
+	if hits != nil {
+		for node, m := range hits.Metrics().Nodes {
+			ch <- prometheus.MustNewConstMetric(c.hitsTotal, prometheus.CounterValue, float64(m.Hits), node)
+			ch <- prometheus.MustNewConstMetric(c.missesTotal, prometheus.CounterValue, float64(m.Misses), node)
+		}
+	}
+	if pool == nil {
+		return
+	}
+
+	for node, stats := range pool.PoolStats() {
+		gauge := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, node)
+		}
+		counter := func(desc *prometheus.Desc, v float64, labels ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, append([]string{node}, labels...)...)
+		}
+
+		gauge(c.poolConns, float64(stats.TotalConns))
+		gauge(c.poolIdleConns, float64(stats.IdleConns))
+		gauge(c.poolMaxConns, float64(stats.MaxConns))
+		gauge(c.poolWaiting, float64(stats.Waiting))
+		counter(c.poolWaitTotal, float64(stats.WaitCount))
+		counter(c.poolWaitSeconds, stats.WaitDuration.Seconds())
+		counter(c.poolClosedConns, float64(stats.MaxIdleClosed), "max_idle")
+		counter(c.poolClosedConns, float64(stats.MaxIdleTimeClosed), "max_idle_time")
+		counter(c.poolClosedConns, float64(stats.MaxLifeTimeClosed), "max_lifetime")
+		counter(c.poolClosedConns, float64(stats.DeadClosed), "dead")
+		gauge(c.poolInFlight, float64(stats.InFlightRequests))
+		counter(c.poolShedTotal, float64(stats.ShedRequests))
+		counter(c.poolFailedOpen, float64(stats.FailedOpenRequests))
+	}
+}
@@ -0,0 +1,145 @@
+package memcachedprom
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeqown/memcached"
+	"github.com/yeqown/memcached/memcachedtest"
+)
+
+func Test_Status(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "nil", err: nil, want: StatusOK},
+		{name: "not found", err: errors.Wrap(memcached.ErrNotFound, "get"), want: StatusMiss},
+		{name: "exists", err: memcached.ErrExists, want: StatusExists},
+		{name: "not stored", err: memcached.ErrNotStored, want: StatusNotStored},
+		{name: "value too large", err: memcached.ErrValueTooLarge, want: StatusServerError},
+		{name: "client error", err: memcached.ErrClientError, want: StatusServerError},
+		{name: "canceled", err: errors.Wrap(context.Canceled, "recv"), want: StatusCanceled},
+		{name: "pool timeout", err: memcached.ErrPoolWaitTimeout, want: StatusPoolTimeout},
+		{name: "rate limited", err: memcached.ErrRateLimited, want: StatusRateLimited},
+		{name: "overloaded", err: errors.Wrap(memcached.ErrOverloaded, "localhost:11211"), want: StatusOverloaded},
+		{name: "io error", err: errors.New("broken pipe"), want: StatusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Status(tt.err))
+		})
+	}
+}
+
+func Test_Collector(t *testing.T) {
+	// the fake client runs the in-memory server, which is stopped by closing it.
+	fake, err := memcachedtest.NewFakeClient()
+	require.NoError(t, err)
+	defer fake.Close()
+
+	collector := NewCollector(WithNamespace("test"))
+	client, err := memcached.New(fake.Addr(), memcached.WithRequestHook(collector.ObserveRequest))
+	require.NoError(t, err)
+	defer client.Close()
+	collector.WatchPools(client)
+	collector.WatchHits(client)
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(collector))
+
+	ctx := context.Background()
+	require.NoError(t, client.Set(ctx, "foo", []byte("bar"), 0, 0))
+	_, err = client.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.ErrorIs(t, client.Delete(ctx, "missing"), memcached.ErrNotFound)
+	_, err = client.Gets(ctx, "foo", "missing", "missing-too")
+	require.NoError(t, err)
+
+	node := fake.Addr()
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.requests.WithLabelValues("set", node, StatusOK)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.requests.WithLabelValues("get", node, StatusOK)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.requests.WithLabelValues("delete", node, StatusMiss)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.nodeUp.WithLabelValues(node)))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	names := make(map[string]int, len(families))
+	counters := make(map[string]float64, len(families))
+	for _, family := range families {
+		names[family.GetName()] = len(family.GetMetric())
+		if metrics := family.GetMetric(); len(metrics) == 1 && metrics[0].GetCounter() != nil {
+			counters[family.GetName()] = metrics[0].GetCounter().GetValue()
+		}
+	}
+	assert.Equal(t, 4, names["test_request_duration_seconds"])
+	assert.Equal(t, 1, names["test_pool_connections"])
+	assert.Equal(t, 1, names["test_pool_idle_connections"])
+	assert.Equal(t, 4, names["test_pool_closed_connections_total"])
+	assert.Equal(t, 1, names["test_pool_shed_requests_total"])
+	assert.Equal(t, float64(2), counters["test_hits_total"])
+	assert.Equal(t, float64(2), counters["test_misses_total"])
+
+	require.NoError(t, fake.Close())
+	_, err = client.Get(ctx, "foo")
+	require.Error(t, err)
+	_, err = client.Get(ctx, "foo")
+	require.Error(t, err)
+	assert.Equal(t, float64(0), testutil.ToFloat64(collector.nodeUp.WithLabelValues(node)))
+}
+
+type fakeStatsDeltaer map[string]chan *memcached.StatRate
+
+func (f fakeStatsDeltaer) StatsDelta(_ context.Context, addr *memcached.Addr, _ time.Duration) (<-chan *memcached.StatRate, error) {
+	ch, ok := f[addr.Address]
+	if !ok {
+		return nil, memcached.ErrInvalidArgument
+	}
+	return ch, nil
+}
+
+func Test_Collector_WatchStatsDelta(t *testing.T) {
+	a, b := &memcached.Addr{Address: "a:11211"}, &memcached.Addr{Address: "b:11211"}
+	client := fakeStatsDeltaer{a.Address: make(chan *memcached.StatRate), b.Address: make(chan *memcached.StatRate)}
+
+	collector := NewCollector(WithNamespace("test"))
+	ctx := context.Background()
+	require.ErrorIs(t, collector.WatchStatsDelta(ctx, client, []*memcached.Addr{{Address: "c:11211"}}, time.Second),
+		memcached.ErrInvalidArgument)
+	require.NoError(t, collector.WatchStatsDelta(ctx, client, []*memcached.Addr{a, b}, time.Second))
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(collector))
+
+	client[a.Address] <- &memcached.StatRate{Addr: a, GetsPerSec: 120, EvictionsPerSec: 3, HitRate: 0.9}
+	client[b.Address] <- &memcached.StatRate{Addr: b, GetsPerSec: 80}
+	// the node failed to poll is not exported.
+	client[b.Address] <- &memcached.StatRate{Addr: b, Err: memcached.ErrServerError}
+	close(client[a.Address])
+	close(client[b.Address])
+
+	var gathered map[string][]float64
+	assert.Eventually(t, func() bool {
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		gathered = make(map[string][]float64, len(families))
+		for _, family := range families {
+			for _, m := range family.GetMetric() {
+				gathered[family.GetName()] = append(gathered[family.GetName()], m.GetGauge().GetValue())
+			}
+		}
+		gets := gathered["test_server_gets_per_second"]
+		return len(gets) == 1 && gets[0] == 120
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []float64{3}, gathered["test_server_evictions_per_second"])
+	assert.Equal(t, []float64{0.9}, gathered["test_server_hit_ratio"])
+}
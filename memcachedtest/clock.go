@@ -0,0 +1,60 @@
+package memcachedtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yeqown/memcached"
+)
+
+var _ memcached.Clock = (*FakeClock)(nil)
+
+// FakeClock implements the memcached.Clock which is moved by hand, so that the
+// tests of the code depending on the time, e.g. the soft TTL and the lifetime of
+// the connections, run without sleeping:
+//
+//	clock := memcachedtest.NewFakeClock(time.Time{})
+//	client, err := memcachedtest.NewFakeClient(memcached.WithClock(clock))
+//	...
+//	// the values stored by SoftTTL expire logically, and the items expire in the
+//	// in-memory memcached server.
+//	clock.Advance(time.Minute)
+//	client.Advance(time.Minute)
+//
+// It's safe for concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex // guards following
+	now time.Time
+}
+
+// NewFakeClock creates a FakeClock starting at now, the zero time means the
+// current time.
+func NewFakeClock(now time.Time) *FakeClock {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d, or backward if d is negative.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Set moves the clock to now.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
@@ -0,0 +1,53 @@
+package memcachedtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeqown/memcached"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+
+	assert.False(t, NewFakeClock(time.Time{}).Now().IsZero())
+}
+
+func TestFakeClock_SoftTTL(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	c, err := NewFakeClient(memcached.WithClock(clock))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	softTTL := c.SoftTTL()
+	require.NoError(t, softTTL.Set(ctx, "foo", []byte("bar"), 0, 10*time.Second, time.Minute))
+
+	item, err := softTTL.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.False(t, item.Expired)
+
+	// the value expires logically, and is still served until the hard TTL.
+	clock.Advance(10 * time.Second)
+	c.Advance(10 * time.Second)
+	item, err = softTTL.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.True(t, item.Expired)
+	assert.Equal(t, "bar", string(item.Value))
+
+	clock.Advance(time.Minute)
+	c.Advance(time.Minute)
+	_, err = softTTL.Get(ctx, "foo")
+	require.ErrorIs(t, err, memcached.ErrNotFound)
+}
@@ -0,0 +1,75 @@
+// Package memcachedtest provides a fake memcached client for the unit tests of
+// the services which use memcached, so that they run without a real memcached:
+//
+//	client, err := memcachedtest.NewFakeClient()
+//	if err != nil {
+//		// handle error
+//	}
+//	defer client.Close()
+//
+//	svc := NewService(client) // accepts memcached.Client
+//
+// The FakeClient is a real client connected to an in-memory memcached server
+// running in the same process, rather than a mock of each method, so that the
+// semantics of the commands are kept, e.g. ErrNotFound, ErrExists and
+// ErrNotStored, the TTL and the CAS unique of the items. The server speaks the
+// text and meta protocols, the binary protocol (SASL) is not supported.
+package memcachedtest
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yeqown/memcached"
+	"github.com/yeqown/memcached/internal/testserver"
+)
+
+var _ memcached.Client = (*FakeClient)(nil)
+
+// FakeClient implements the memcached.Client backed by an in-memory memcached
+// server, which is stopped when the client is closed.
+type FakeClient struct {
+	memcached.Client
+
+	server *testserver.Server
+}
+
+// NewFakeClient starts an in-memory memcached server listening on the loopback
+// address, and creates a client of it with the given options.
+func NewFakeClient(opts ...memcached.ClientOption) (*FakeClient, error) {
+	server, err := testserver.New()
+	if err != nil {
+		return nil, errors.Wrap(err, "start fake server")
+	}
+
+	client, err := memcached.New(server.Addr(), opts...)
+	if err != nil {
+		_ = server.Close()
+		return nil, errors.Wrap(err, "create client")
+	}
+
+	return &FakeClient{Client: client, server: server}, nil
+}
+
+// Addr returns the address of the in-memory memcached server, other clients
+// could connect to it to share the items.
+func (f *FakeClient) Addr() string {
+	return f.server.Addr()
+}
+
+// Advance moves the clock of the in-memory memcached server forward by d, so
+// that the items expire without sleeping. The expirations given as Unix
+// timestamps are compared with the moved clock too.
+func (f *FakeClient) Advance(d time.Duration) {
+	f.server.Advance(d)
+}
+
+// Close closes the client and stops the in-memory memcached server, the items
+// are dropped.
+func (f *FakeClient) Close() error {
+	err := f.Client.Close()
+	_ = f.server.Close()
+
+	return err
+}
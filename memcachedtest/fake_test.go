@@ -0,0 +1,99 @@
+package memcachedtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeqown/memcached"
+)
+
+func newFakeClient(t *testing.T) *FakeClient {
+	c, err := NewFakeClient()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func TestFakeClient_semantics(t *testing.T) {
+	c := newFakeClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 1, 0))
+
+	tests := []struct {
+		name    string
+		run     func() error
+		wantErr error
+	}{
+		{
+			name:    "get missing",
+			run:     func() error { _, err := c.Get(ctx, "missing"); return err },
+			wantErr: memcached.ErrNotFound,
+		},
+		{
+			name:    "add existing",
+			run:     func() error { return c.Add(ctx, "foo", []byte("baz"), 0, 0) },
+			wantErr: memcached.ErrNotStored,
+		},
+		{
+			name:    "replace missing",
+			run:     func() error { return c.Replace(ctx, "missing", []byte("baz"), 0, 0) },
+			wantErr: memcached.ErrNotStored,
+		},
+		{
+			name:    "cas mismatched",
+			run:     func() error { return c.Cas(ctx, "foo", []byte("baz"), 0, 0, 1<<40) },
+			wantErr: memcached.ErrExists,
+		},
+		{
+			name:    "meta delete missing",
+			run:     func() error { _, err := c.MetaDelete(ctx, []byte("missing")); return err },
+			wantErr: memcached.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, tt.run(), tt.wantErr)
+		})
+	}
+
+	items, err := c.Gets(ctx, "foo")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, uint32(1), items[0].Flags)
+	require.NoError(t, c.Cas(ctx, "foo", []byte("baz"), 0, 0, items[0].CAS))
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", string(item.Value))
+}
+
+func TestFakeClient_Advance(t *testing.T) {
+	c := newFakeClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, time.Minute))
+	require.NoError(t, c.Set(ctx, "forever", []byte("bar"), 0, 0))
+
+	item, err := c.MetaGet(ctx, []byte("foo"), memcached.MetaGetFlagReturnTTL())
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), item.TTL)
+
+	c.Advance(30 * time.Second)
+	item, err = c.MetaGet(ctx, []byte("foo"), memcached.MetaGetFlagReturnTTL())
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), item.TTL)
+
+	c.Advance(30 * time.Second)
+	_, err = c.Get(ctx, "foo")
+	require.ErrorIs(t, err, memcached.ErrNotFound)
+
+	_, err = c.Get(ctx, "forever")
+	require.NoError(t, err)
+}
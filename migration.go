@@ -0,0 +1,657 @@
+package memcached
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"sync/atomic"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+var _ Client = (*MigrationClient)(nil)
+
+// MigrationOption configures the MigrationClient.
+type MigrationOption func(*MigrationClient)
+
+// MigrationReadPercent sets the initial percentage of the keys read from the new
+// Client, see MigrationClient.SetReadPercent. The default is 0.
+func MigrationReadPercent(percent int) MigrationOption {
+	return func(m *MigrationClient) {
+		m.SetReadPercent(percent)
+	}
+}
+
+// MigrationBackfill makes the MigrationClient copy the items read from the old
+// Client to the new one by add, with the given expiry since the remaining TTL of
+// the items is unknown. GetAndTouch copies the items with its own expiry.
+func MigrationBackfill(expiry time.Duration) MigrationOption {
+	return func(m *MigrationClient) {
+		m.backfill = true
+		m.backfillExpiry = expiry
+	}
+}
+
+// MigrationOnError sets the function called with the errors of the old Client and
+// of the backfill, which are not returned to the callers. The outcomes, e.g.
+// ErrNotFound and ErrNotStored, are not reported, since the items of the two
+// Clients could differ.
+func MigrationOnError(fn func(key string, err error)) MigrationOption {
+	return func(m *MigrationClient) {
+		m.onError = fn
+	}
+}
+
+// MigrationClient migrates the callers from an old memcached cluster to a new one
+// by double writes, it's the Client of the new cluster with the writes mirrored to
+// the old one, and the reads served by either of them by a percentage dial:
+//
+//	m := memcached.NewMigrationClient(oldClient, newClient, memcached.MigrationBackfill(time.Hour))
+//	m.SetReadPercent(10) // then 50, 100, and switch to newClient at last.
+//
+// The keys within the percentage are read from the new Client and fall back to the
+// old one if missing, and the others are read from the old Client only. The keys
+// are dialed by their hash, so that a key is always read from the same side at the
+// same percentage.
+//
+// The storage, delete, touch and arithmetic commands, including the meta ones, the
+// multi-key ones and the ones of Async, are sent to both Clients, and the results
+// of the new Client are returned. The commands comparing the CAS unique, e.g. Cas,
+// CasItem, DeleteCAS, Update and the meta commands with the C flag, are sent to the
+// new Client only, since the CAS unique is not shared, and the key is deleted from
+// the old Client once they succeed, so is SetReader, since the reader could not be
+// read twice. The retrievals, e.g. Get, Gets, GetAndTouch, GetValue and
+// TouchAndGetMulti, are dialed, and the meta get modifying the item is sent to both
+// Clients. The helpers returned by Counter, NewMutex, Namespaces and SoftTTL send
+// their commands by the MigrationClient as well. The commands bound to a server or
+// a connection of the new Client, i.e. Node, DoOnNode, WithConn, ScheduleFlush and
+// With, return ErrNotSupported, and all the other commands, e.g. MetaGet and Stats,
+// are sent to the new Client only. The CAS unique of the items read from the old
+// Client is not valid for the new one.
+type MigrationClient struct {
+	Client
+
+	old Client
+	// readPercent is shared with the MigrationClient of the helpers, e.g. Counter.
+	readPercent    *atomic.Int32
+	backfill       bool
+	backfillExpiry time.Duration
+	onError        func(key string, err error)
+}
+
+// NewMigrationClient creates the MigrationClient migrating from the old Client to
+// the new one, both of them are closed by MigrationClient.Close.
+func NewMigrationClient(from, to Client, opts ...MigrationOption) *MigrationClient {
+	m := &MigrationClient{Client: to, old: from, readPercent: new(atomic.Int32)}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// SetReadPercent sets the percentage of the keys read from the new Client, it's
+// clamped to [0, 100]. It could be changed at any time.
+func (m *MigrationClient) SetReadPercent(percent int) {
+	m.readPercent.Store(int32(min(max(percent, 0), 100)))
+}
+
+// ReadPercent returns the percentage of the keys read from the new Client.
+func (m *MigrationClient) ReadPercent() int {
+	return int(m.readPercent.Load())
+}
+
+// readsNew reports whether the key is read from the new Client.
+func (m *MigrationClient) readsNew(key string) bool {
+	return crc32.ChecksumIEEE([]byte(key))%100 < uint32(m.readPercent.Load())
+}
+
+// reportOld reports the error of the old Client which is not an outcome.
+func (m *MigrationClient) reportOld(key string, err error) {
+	if err == nil || m.onError == nil {
+		return
+	}
+	for _, outcome := range []error{ErrNotFound, ErrNotStored, ErrExists} {
+		if errors.Is(err, outcome) {
+			return
+		}
+	}
+
+	m.onError(key, err)
+}
+
+// migrate returns the MigrationClient migrating from the old Client to the new one
+// with the same settings, it's used by the helpers built on the views of Clients.
+func (m *MigrationClient) migrate(from, to Client) *MigrationClient {
+	view := *m
+	view.Client, view.old = to, from
+
+	return &view
+}
+
+// write sends the command to both Clients, and returns the error of the new one.
+func (m *MigrationClient) write(key string, fn func(c Client) error) error {
+	err := fn(m.Client)
+	m.reportOld(key, fn(m.old))
+
+	return err
+}
+
+// writeItem is the same as write, but for the commands returning the item.
+func (m *MigrationClient) writeItem(key string, fn func(c Client) (*MetaItem, error)) (*MetaItem, error) {
+	item, err := fn(m.Client)
+	_, oldErr := fn(m.old)
+	m.reportOld(key, oldErr)
+
+	return item, err
+}
+
+// writeMulti is the same as write, but for the multi-key commands, the errors of
+// the old Client are reported by their keys.
+func (m *MigrationClient) writeMulti(fn func(c Client) map[string]error) map[string]error {
+	errs := fn(m.Client)
+	for key, err := range fn(m.old) {
+		m.reportOld(key, err)
+	}
+
+	return errs
+}
+
+// invalidateOld deletes the key from the old Client once it's modified in the new
+// one by the command which could not be mirrored.
+func (m *MigrationClient) invalidateOld(ctx context.Context, key string, err error) error {
+	if err == nil {
+		m.reportOld(key, m.old.Delete(ctx, key))
+	}
+
+	return err
+}
+
+func (m *MigrationClient) Set(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return m.write(key, func(c Client) error { return c.Set(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) Add(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return m.write(key, func(c Client) error { return c.Add(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) Replace(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return m.write(key, func(c Client) error { return c.Replace(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) Append(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return m.write(key, func(c Client) error { return c.Append(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) Prepend(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return m.write(key, func(c Client) error { return c.Prepend(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) SetWithExpiration(
+	ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
+	return m.write(key, func(c Client) error { return c.SetWithExpiration(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) AddWithExpiration(
+	ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
+	return m.write(key, func(c Client) error { return c.AddWithExpiration(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) ReplaceWithExpiration(
+	ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
+	return m.write(key, func(c Client) error { return c.ReplaceWithExpiration(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) AppendWithExpiration(
+	ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
+	return m.write(key, func(c Client) error { return c.AppendWithExpiration(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) PrependWithExpiration(
+	ctx context.Context, key string, value []byte, flag uint32, expiry Expiration) error {
+	return m.write(key, func(c Client) error { return c.PrependWithExpiration(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) Cas(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64) error {
+	return m.invalidateOld(ctx, key, m.Client.Cas(ctx, key, value, flag, expiry, cas))
+}
+
+func (m *MigrationClient) CasWithExpiration(
+	ctx context.Context, key string, value []byte, flag uint32, expiry Expiration, cas uint64) error {
+	return m.invalidateOld(ctx, key, m.Client.CasWithExpiration(ctx, key, value, flag, expiry, cas))
+}
+
+func (m *MigrationClient) Delete(ctx context.Context, key string) error {
+	return m.write(key, func(c Client) error { return c.Delete(ctx, key) })
+}
+
+func (m *MigrationClient) DeleteCAS(ctx context.Context, key string, cas uint64) error {
+	return m.invalidateOld(ctx, key, m.Client.DeleteCAS(ctx, key, cas))
+}
+
+func (m *MigrationClient) Touch(ctx context.Context, key string, expiry time.Duration) error {
+	return m.write(key, func(c Client) error { return c.Touch(ctx, key, expiry) })
+}
+
+func (m *MigrationClient) TouchWithExpiration(ctx context.Context, key string, expiry Expiration) error {
+	return m.write(key, func(c Client) error { return c.TouchWithExpiration(ctx, key, expiry) })
+}
+
+func (m *MigrationClient) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	n, err := m.Client.Incr(ctx, key, delta)
+	_, oldErr := m.old.Incr(ctx, key, delta)
+	m.reportOld(key, oldErr)
+
+	return n, err
+}
+
+func (m *MigrationClient) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	n, err := m.Client.Decr(ctx, key, delta)
+	_, oldErr := m.old.Decr(ctx, key, delta)
+	m.reportOld(key, oldErr)
+
+	return n, err
+}
+
+func (m *MigrationClient) SetItem(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error) {
+	return m.writeItem(key, func(c Client) (*MetaItem, error) { return c.SetItem(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) AddItem(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error) {
+	return m.writeItem(key, func(c Client) (*MetaItem, error) { return c.AddItem(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) ReplaceItem(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) (*MetaItem, error) {
+	return m.writeItem(key, func(c Client) (*MetaItem, error) { return c.ReplaceItem(ctx, key, value, flag, expiry) })
+}
+
+func (m *MigrationClient) AppendItem(ctx context.Context, key string, value []byte) (*MetaItem, error) {
+	return m.writeItem(key, func(c Client) (*MetaItem, error) { return c.AppendItem(ctx, key, value) })
+}
+
+func (m *MigrationClient) PrependItem(ctx context.Context, key string, value []byte) (*MetaItem, error) {
+	return m.writeItem(key, func(c Client) (*MetaItem, error) { return c.PrependItem(ctx, key, value) })
+}
+
+func (m *MigrationClient) CasItem(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64) (*MetaItem, error) {
+	item, err := m.Client.CasItem(ctx, key, value, flag, expiry, cas)
+	return item, m.invalidateOld(ctx, key, err)
+}
+
+func (m *MigrationClient) DeleteMulti(ctx context.Context, keys []string) map[string]error {
+	return m.writeMulti(func(c Client) map[string]error { return c.DeleteMulti(ctx, keys) })
+}
+
+func (m *MigrationClient) TouchMulti(ctx context.Context, expiry time.Duration, keys []string) map[string]error {
+	return m.writeMulti(func(c Client) map[string]error { return c.TouchMulti(ctx, expiry, keys) })
+}
+
+func (m *MigrationClient) MetaSet(ctx context.Context, key, value []byte, options ...MetaSetOption) (*MetaItem, error) {
+	flags := &metaSetFlags{}
+	for _, applyFn := range options {
+		applyFn(flags)
+	}
+	if flags.C != 0 {
+		item, err := m.Client.MetaSet(ctx, key, value, options...)
+		return item, m.invalidateOld(ctx, string(key), err)
+	}
+
+	return m.writeItem(string(key), func(c Client) (*MetaItem, error) { return c.MetaSet(ctx, key, value, options...) })
+}
+
+func (m *MigrationClient) MetaDelete(ctx context.Context, key []byte, options ...MetaDeleteOption) (*MetaItem, error) {
+	flags := &metaDeleteFlags{}
+	for _, applyFn := range options {
+		applyFn(flags)
+	}
+	if flags.C != 0 {
+		item, err := m.Client.MetaDelete(ctx, key, options...)
+		return item, m.invalidateOld(ctx, string(key), err)
+	}
+
+	return m.writeItem(string(key), func(c Client) (*MetaItem, error) { return c.MetaDelete(ctx, key, options...) })
+}
+
+func (m *MigrationClient) MetaArithmetic(
+	ctx context.Context, key []byte, delta uint64, options ...MetaArithmeticOption) (*MetaItem, error) {
+	flags := &metaArithmeticFlags{}
+	for _, applyFn := range options {
+		applyFn(flags)
+	}
+	if flags.C != 0 {
+		item, err := m.Client.MetaArithmetic(ctx, key, delta, options...)
+		return item, m.invalidateOld(ctx, string(key), err)
+	}
+
+	return m.writeItem(string(key), func(c Client) (*MetaItem, error) {
+		return c.MetaArithmetic(ctx, key, delta, options...)
+	})
+}
+
+func (m *MigrationClient) Update(ctx context.Context, key string, fn UpdateFunc, opts ...UpdateOption) error {
+	return m.invalidateOld(ctx, key, m.Client.Update(ctx, key, fn, opts...))
+}
+
+func (m *MigrationClient) MetaUpdate(
+	ctx context.Context, key []byte, fn UpdateFunc, opts ...UpdateOption) (uint64, error) {
+	cas, err := m.Client.MetaUpdate(ctx, key, fn, opts...)
+	return cas, m.invalidateOld(ctx, string(key), err)
+}
+
+func (m *MigrationClient) SetReader(
+	ctx context.Context, key string, r io.Reader, size int64, flag uint32, expiry Expiration) error {
+	return m.invalidateOld(ctx, key, m.Client.SetReader(ctx, key, r, size, flag, expiry))
+}
+
+// MetaGet is sent to the new Client only, unless it modifies the item, e.g. by the
+// T or N flag, which is sent to both Clients.
+func (m *MigrationClient) MetaGet(ctx context.Context, key []byte, options ...MetaGetOption) (*MetaItem, error) {
+	flags := &metaGetFlags{}
+	for _, applyFn := range options {
+		applyFn(flags)
+	}
+	if !flags.modifies() {
+		return m.Client.MetaGet(ctx, key, options...)
+	}
+
+	return m.writeItem(string(key), func(c Client) (*MetaItem, error) { return c.MetaGet(ctx, key, options...) })
+}
+
+// Counter returns the Counter of the new Client, whose commands are mirrored to
+// the Counter of the old Client.
+func (m *MigrationClient) Counter(key string, ttl time.Duration) *Counter {
+	ct := m.Client.Counter(key, ttl)
+	ct.client = m.migrate(m.old.Counter(key, ttl).client, ct.client)
+
+	return ct
+}
+
+// NewMutex returns the Mutex of the new Client, whose lock is added to both
+// Clients, and released or refreshed in the new one only by comparing the CAS
+// unique, so that the lock in the old Client is deleted then as CasItem does.
+func (m *MigrationClient) NewMutex(key string, ttl time.Duration, opts ...MutexOption) *Mutex {
+	mu := m.Client.NewMutex(key, ttl, opts...)
+	mu.commands = m
+
+	return mu
+}
+
+// Namespaces returns the Namespaces of the new Client, whose commands are sent by
+// the MigrationClient, i.e. the versions are bumped in both Clients.
+func (m *MigrationClient) Namespaces(opts ...NamespaceOption) *Namespaces {
+	ns := m.Client.Namespaces(opts...)
+	ns.commands = m
+
+	return ns
+}
+
+// SoftTTL returns the SoftTTL of the new Client, whose commands are sent by the
+// MigrationClient.
+func (m *MigrationClient) SoftTTL() *SoftTTL {
+	s := m.Client.SoftTTL()
+	s.commands = m
+
+	return s
+}
+
+// WithConn is not supported, since the commands over one connection could not be
+// mirrored.
+func (m *MigrationClient) WithConn(context.Context, string, func(cc ConnCommander) error) error {
+	return errors.Wrap(ErrNotSupported, "connection of MigrationClient")
+}
+
+// DoOnNode is not supported, since the server belongs to one of the Clients.
+func (m *MigrationClient) DoOnNode(context.Context, *Addr, func(ctx context.Context) error) error {
+	return errors.Wrap(ErrNotSupported, "node of MigrationClient")
+}
+
+// Node is not supported, since the server belongs to one of the Clients.
+func (m *MigrationClient) Node(*Addr) (NodeClient, error) {
+	return nil, errors.Wrap(ErrNotSupported, "node of MigrationClient")
+}
+
+// ScheduleFlush is not supported, since the server belongs to one of the Clients.
+func (m *MigrationClient) ScheduleFlush(context.Context, *Addr, time.Duration) error {
+	return errors.Wrap(ErrNotSupported, "scheduled flush of MigrationClient")
+}
+
+// With is not supported, since the view of the new Client does not mirror.
+func (m *MigrationClient) With(...ClientOption) (Client, error) {
+	return nil, errors.Wrap(ErrNotSupported, "view of MigrationClient")
+}
+
+// Async returns the Async of the new Client, the writes enqueued are mirrored to
+// the Async of the old Client, and its errors are reported as the ones of the old
+// Client. Both of them are closed by the Close of the returned one.
+func (m *MigrationClient) Async(opts ...AsyncOption) *Async {
+	a := m.Client.Async(opts...)
+	a.mirror = m.old.Async(opts...)
+	a.onMirrorError = m.reportOld
+
+	return a
+}
+
+func (m *MigrationClient) FlushAll(ctx context.Context) error {
+	return m.write("", func(c Client) error { return c.FlushAll(ctx) })
+}
+
+func (m *MigrationClient) Get(ctx context.Context, key string) (*Item, error) {
+	return m.read(ctx, key, FromDuration(m.backfillExpiry), func(c Client) (*Item, error) { return c.Get(ctx, key) })
+}
+
+func (m *MigrationClient) GetAndTouch(ctx context.Context, expiry time.Duration, key string) (*Item, error) {
+	return m.read(ctx, key, FromDuration(expiry), func(c Client) (*Item, error) { return c.GetAndTouch(ctx, expiry, key) })
+}
+
+func (m *MigrationClient) GetAndTouchWithExpiration(ctx context.Context, expiry Expiration, key string) (*Item, error) {
+	return m.read(ctx, key, expiry, func(c Client) (*Item, error) { return c.GetAndTouchWithExpiration(ctx, expiry, key) })
+}
+
+func (m *MigrationClient) GetValue(ctx context.Context, key string) (*Value, error) {
+	return m.readValue(ctx, key, FromDuration(m.backfillExpiry), func(c Client) (*Value, error) { return c.GetValue(ctx, key) })
+}
+
+func (m *MigrationClient) GetAndTouchValue(ctx context.Context, expiry time.Duration, key string) (*Value, error) {
+	return m.readValue(ctx, key, FromDuration(expiry), func(c Client) (*Value, error) {
+		return c.GetAndTouchValue(ctx, expiry, key)
+	})
+}
+
+// read reads the key from the new Client with the fallback to the old one if it's
+// dialed, otherwise from the old Client only.
+func (m *MigrationClient) read(
+	ctx context.Context, key string, backfillExpiry Expiration, get func(c Client) (*Item, error),
+) (*Item, error) {
+	if !m.readsNew(key) {
+		return get(m.old)
+	}
+
+	item, err := get(m.Client)
+	if !errors.Is(err, ErrNotFound) {
+		return item, err
+	}
+
+	item, err = get(m.old)
+	if err != nil {
+		return nil, err
+	}
+	m.backfillItem(ctx, item, backfillExpiry)
+
+	return item, nil
+}
+
+// readValue is the same as read, but for the commands borrowing the value.
+func (m *MigrationClient) readValue(
+	ctx context.Context, key string, backfillExpiry Expiration, get func(c Client) (*Value, error),
+) (*Value, error) {
+	if !m.readsNew(key) {
+		return get(m.old)
+	}
+
+	value, err := get(m.Client)
+	if !errors.Is(err, ErrNotFound) {
+		return value, err
+	}
+
+	value, err = get(m.old)
+	if err != nil {
+		return nil, err
+	}
+	m.backfillItem(ctx, &Item{Key: value.Key, Value: value.Bytes(), Flags: value.Flags}, backfillExpiry)
+
+	return value, nil
+}
+
+func (m *MigrationClient) Gets(ctx context.Context, keys ...string) ([]*Item, error) {
+	return m.readMulti(ctx, keys, FromDuration(m.backfillExpiry), func(c Client, keys ...string) ([]*Item, error) {
+		return c.Gets(ctx, keys...)
+	})
+}
+
+func (m *MigrationClient) GetAndTouches(ctx context.Context, expiry time.Duration, keys ...string) ([]*Item, error) {
+	return m.readMulti(ctx, keys, FromDuration(expiry), func(c Client, keys ...string) ([]*Item, error) {
+		return c.GetAndTouches(ctx, expiry, keys...)
+	})
+}
+
+func (m *MigrationClient) GetAndTouchesWithExpiration(
+	ctx context.Context, expiry Expiration, keys ...string) ([]*Item, error) {
+	return m.readMulti(ctx, keys, expiry, func(c Client, keys ...string) ([]*Item, error) {
+		return c.GetAndTouchesWithExpiration(ctx, expiry, keys...)
+	})
+}
+
+// readMulti is the same as read, but for the multi-key commands, the keys missing
+// in the new Client fall back to the old one together.
+func (m *MigrationClient) readMulti(
+	ctx context.Context, keys []string, backfillExpiry Expiration, get func(c Client, keys ...string) ([]*Item, error),
+) ([]*Item, error) {
+	newKeys := make([]string, 0, len(keys))
+	oldKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if m.readsNew(key) {
+			newKeys = append(newKeys, key)
+		} else {
+			oldKeys = append(oldKeys, key)
+		}
+	}
+
+	items := make([]*Item, 0, len(keys))
+	if len(newKeys) > 0 {
+		// none of the keys is found is not an error, they fall back to the old Client.
+		found, err := get(m.Client, newKeys...)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		items = append(items, found...)
+
+		hit := make(map[string]struct{}, len(found))
+		for _, item := range found {
+			hit[item.Key] = struct{}{}
+		}
+		for _, key := range newKeys {
+			if _, ok := hit[key]; !ok {
+				oldKeys = append(oldKeys, key)
+			}
+		}
+	}
+
+	if len(oldKeys) > 0 {
+		found, err := get(m.old, oldKeys...)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		for _, item := range found {
+			if m.readsNew(item.Key) {
+				m.backfillItem(ctx, item, backfillExpiry)
+			}
+		}
+		items = append(items, found...)
+	}
+	if len(items) == 0 {
+		return nil, errors.Wrap(ErrNotFound, "no items found")
+	}
+	sortItemsByKeys(items, keys)
+
+	return items, nil
+}
+
+// TouchAndGetMulti reads the keys as Gets does, the items read from the old Client
+// are backfilled with their own exptime.
+func (m *MigrationClient) TouchAndGetMulti(ctx context.Context, expiries map[string]uint32) (map[string]*Item, error) {
+	newExpiries := make(map[string]uint32, len(expiries))
+	oldExpiries := make(map[string]uint32, len(expiries))
+	for key, exptime := range expiries {
+		if m.readsNew(key) {
+			newExpiries[key] = exptime
+		} else {
+			oldExpiries[key] = exptime
+		}
+	}
+
+	items := make(map[string]*Item, len(expiries))
+	if len(newExpiries) > 0 {
+		found, err := m.Client.TouchAndGetMulti(ctx, newExpiries)
+		if err != nil {
+			return nil, err
+		}
+		for key, exptime := range newExpiries {
+			if item, ok := found[key]; ok {
+				items[key] = item
+			} else {
+				oldExpiries[key] = exptime
+			}
+		}
+	}
+
+	if len(oldExpiries) > 0 {
+		found, err := m.old.TouchAndGetMulti(ctx, oldExpiries)
+		if err != nil {
+			return nil, err
+		}
+		for key, item := range found {
+			if m.readsNew(key) {
+				m.backfillItem(ctx, item, Expiration(oldExpiries[key]))
+			}
+			items[key] = item
+		}
+	}
+
+	return items, nil
+}
+
+// backfillItem copies the item read from the old Client to the new one if required,
+// the item written to the new Client in the meantime is kept.
+func (m *MigrationClient) backfillItem(ctx context.Context, item *Item, expiry Expiration) {
+	if !m.backfill {
+		return
+	}
+
+	err := m.Client.AddWithExpiration(ctx, item.Key, item.Value, item.Flags, expiry)
+	if err != nil && !errors.Is(err, ErrNotStored) && m.onError != nil {
+		m.onError(item.Key, errors.Wrap(err, "backfill"))
+	}
+}
+
+// Close closes both the new and the old Clients.
+func (m *MigrationClient) Close() error {
+	var multiErr error
+	if err := m.Client.Close(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+	if err := m.old.Close(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	return multiErr
+}
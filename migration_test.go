@@ -0,0 +1,353 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMigrationClient(t *testing.T, opts ...MigrationOption) (m *MigrationClient, oldClient, newClient Client) {
+	t.Helper()
+
+	oldClient, err := New(newTestServer(t).Addr())
+	require.NoError(t, err)
+	newClient, err = New(newTestServer(t).Addr())
+	require.NoError(t, err)
+
+	m = NewMigrationClient(oldClient, newClient, opts...)
+	t.Cleanup(func() { _ = m.Close() })
+
+	return m, oldClient, newClient
+}
+
+func Test_MigrationClient_write(t *testing.T) {
+	m, oldClient, newClient := newTestMigrationClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, m.Set(ctx, "foo", []byte("bar"), 1, 0))
+	require.NoError(t, m.Set(ctx, "counter", []byte("1"), 0, 0))
+	n, err := m.Incr(ctx, "counter", 2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), n)
+
+	for _, c := range []Client{oldClient, newClient} {
+		item, err := c.Get(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(item.Value))
+		assert.Equal(t, uint32(1), item.Flags)
+
+		item, err = c.Get(ctx, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, "3", string(item.Value))
+	}
+
+	// the CAS unique of the new Client is used, and the key is invalidated in the old one.
+	items, err := newClient.Gets(ctx, "foo")
+	require.NoError(t, err)
+	require.NoError(t, m.Cas(ctx, "foo", []byte("baz"), 0, 0, items[0].CAS))
+	_, err = oldClient.Get(ctx, "foo")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, m.Delete(ctx, "counter"))
+	for _, c := range []Client{oldClient, newClient} {
+		_, err = c.Get(ctx, "counter")
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+
+	// the result of the new Client is returned.
+	require.NoError(t, oldClient.Set(ctx, "only-old", []byte("1"), 0, 0))
+	require.ErrorIs(t, m.Delete(ctx, "only-old"), ErrNotFound)
+}
+
+func Test_MigrationClient_writeMethods(t *testing.T) {
+	ctx := context.Background()
+	value := func(want string) func(t *testing.T, old Client) {
+		return func(t *testing.T, old Client) {
+			item, err := old.Get(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, want, string(item.Value))
+		}
+	}
+	deleted := func(t *testing.T, old Client) {
+		_, err := old.Get(ctx, "foo")
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+	casOf := func(t *testing.T, c Client) uint64 {
+		items, err := c.Gets(ctx, "foo")
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		return items[0].CAS
+	}
+
+	tests := []struct {
+		name  string
+		write func(t *testing.T, m *MigrationClient, newClient Client) error
+		// verify checks the key "foo" in the old Client, it's "1" before written.
+		verify func(t *testing.T, old Client)
+	}{
+		{name: "MetaSet", verify: value("2"), write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			_, err := m.MetaSet(ctx, []byte("foo"), []byte("2"))
+			return err
+		}},
+		{name: "MetaSet compare cas", verify: deleted, write: func(t *testing.T, m *MigrationClient, c Client) error {
+			_, err := m.MetaSet(ctx, []byte("foo"), []byte("2"), MetaSetFlagCompareCAS(casOf(t, c)))
+			return err
+		}},
+		{name: "MetaDelete", verify: deleted, write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			_, err := m.MetaDelete(ctx, []byte("foo"))
+			return err
+		}},
+		{name: "MetaArithmetic", verify: value("6"), write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			_, err := m.MetaArithmetic(ctx, []byte("foo"), 5)
+			return err
+		}},
+		{name: "DeleteMulti", verify: deleted, write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			return m.DeleteMulti(ctx, []string{"foo"})["foo"]
+		}},
+		{name: "TouchMulti", write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			return m.TouchMulti(ctx, time.Hour, []string{"foo"})["foo"]
+		}, verify: func(t *testing.T, old Client) {
+			item, err := old.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnTTL())
+			require.NoError(t, err)
+			assert.Positive(t, item.TTL)
+		}},
+		{name: "Update", verify: deleted, write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			return m.Update(ctx, "foo", func(old []byte) ([]byte, error) { return append(old, '2'), nil })
+		}},
+		{name: "MetaUpdate", verify: deleted, write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			_, err := m.MetaUpdate(ctx, []byte("foo"), func(old []byte) ([]byte, error) { return append(old, '2'), nil })
+			return err
+		}},
+		{name: "SetItem", verify: value("2"), write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			_, err := m.SetItem(ctx, "foo", []byte("2"), 0, 0)
+			return err
+		}},
+		{name: "AppendItem", verify: value("12"), write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			_, err := m.AppendItem(ctx, "foo", []byte("2"))
+			return err
+		}},
+		{name: "CasItem", verify: deleted, write: func(t *testing.T, m *MigrationClient, c Client) error {
+			_, err := m.CasItem(ctx, "foo", []byte("2"), 0, 0, casOf(t, c))
+			return err
+		}},
+		{name: "Async", verify: value("2"), write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			a := m.Async()
+			defer a.Close()
+			_, err := a.Set(ctx, "foo", []byte("2"), 0, 0).Wait(ctx)
+			return err
+		}},
+		{name: "SetReader", verify: deleted, write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			return m.SetReader(ctx, "foo", strings.NewReader("2"), 1, 0, 0)
+		}},
+		{name: "MetaGet touch", write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			_, err := m.MetaGet(ctx, []byte("foo"), MetaGetFlagUpdateRemainingTTL(3600))
+			return err
+		}, verify: func(t *testing.T, old Client) {
+			item, err := old.MetaGet(ctx, []byte("foo"), MetaGetFlagReturnTTL())
+			require.NoError(t, err)
+			assert.Positive(t, item.TTL)
+		}},
+		{name: "Counter", verify: value("6"), write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			_, err := m.Counter("foo", 0).Incr(ctx, 5)
+			return err
+		}},
+		{name: "SoftTTL", write: func(t *testing.T, m *MigrationClient, _ Client) error {
+			return m.SoftTTL().Set(ctx, "foo", []byte("2"), 0, time.Minute, time.Hour)
+		}, verify: func(t *testing.T, old Client) {
+			item, err := old.SoftTTL().Get(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, "2", string(item.Value))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			m, oldClient, newClient := newTestMigrationClient(t,
+				MigrationOnError(func(_ string, err error) { errs = append(errs, err) }))
+			for _, c := range []Client{oldClient, newClient} {
+				require.NoError(t, c.Set(ctx, "foo", []byte("1"), 0, 0))
+			}
+
+			require.NoError(t, tt.write(t, m, newClient))
+			tt.verify(t, oldClient)
+			assert.Empty(t, errs)
+		})
+	}
+}
+
+func Test_MigrationClient_helpers(t *testing.T) {
+	m, oldClient, _ := newTestMigrationClient(t, MigrationReadPercent(100))
+	ctx := context.Background()
+
+	// the namespaces are written and invalidated in both Clients.
+	ns := m.Namespaces(NamespaceCacheTTL(0))
+	require.NoError(t, ns.Set(ctx, "user", "foo", []byte("bar"), 0, 0))
+	item, err := oldClient.Namespaces().Get(ctx, "user", "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+	require.NoError(t, ns.InvalidateNamespace(ctx, "user"))
+	_, err = oldClient.Namespaces().Get(ctx, "user", "foo")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// the lock is added to both Clients, and deleted from the old one on unlock.
+	mu := m.NewMutex("lock", time.Minute)
+	ok, err := mu.TryLock(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, err = oldClient.Get(ctx, "lock")
+	require.NoError(t, err)
+	require.NoError(t, mu.Unlock(ctx))
+	_, err = oldClient.Get(ctx, "lock")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// the commands bound to the new Client are not supported.
+	assert.ErrorIs(t, m.WithConn(ctx, "foo", func(ConnCommander) error { return nil }), ErrNotSupported)
+	assert.ErrorIs(t, m.DoOnNode(ctx, nil, func(context.Context) error { return nil }), ErrNotSupported)
+	assert.ErrorIs(t, m.ScheduleFlush(ctx, nil, time.Second), ErrNotSupported)
+	_, err = m.Node(nil)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = m.With()
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
+
+func Test_MigrationClient_readMethods(t *testing.T) {
+	m, oldClient, newClient := newTestMigrationClient(t, MigrationReadPercent(100), MigrationBackfill(time.Hour))
+	ctx := context.Background()
+
+	keys := []string{"a", "b", "c", "d"}
+	for _, key := range keys {
+		require.NoError(t, oldClient.Set(ctx, key, []byte("old"), 0, 0))
+	}
+
+	// the keys missing in the new Client fall back to the old one.
+	value, err := m.GetValue(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(value.Bytes()))
+	value.Release()
+	item, err := m.GetAndTouchWithExpiration(ctx, FromDuration(time.Hour), "b")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(item.Value))
+	items, err := m.GetAndTouches(ctx, time.Hour, "c")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	found, err := m.TouchAndGetMulti(ctx, map[string]uint32{"d": 3600, "missing": 3600})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "old", string(found["d"].Value))
+
+	// and they're backfilled.
+	items, err = newClient.Gets(ctx, keys...)
+	require.NoError(t, err)
+	assert.Len(t, items, len(keys))
+}
+
+func Test_MigrationClient_read(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	m, oldClient, newClient := newTestMigrationClient(t,
+		MigrationBackfill(time.Hour),
+		MigrationOnError(func(key string, err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}),
+	)
+	ctx := context.Background()
+
+	keys := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		require.NoError(t, oldClient.Set(ctx, key, []byte("old"), 0, 0))
+	}
+	require.NoError(t, newClient.Set(ctx, "key-0", []byte("new"), 0, 0))
+
+	// all keys are read from the old Client.
+	assert.Equal(t, 0, m.ReadPercent())
+	item, err := m.Get(ctx, "key-0")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(item.Value))
+
+	// all keys are read from the new Client, and fall back to the old one.
+	m.SetReadPercent(200)
+	assert.Equal(t, 100, m.ReadPercent())
+	item, err = m.Get(ctx, "key-0")
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(item.Value))
+	item, err = m.Get(ctx, "key-1")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(item.Value))
+
+	// the items read from the old Client are backfilled.
+	item, err = newClient.Get(ctx, "key-1")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(item.Value))
+
+	items, err := m.Gets(ctx, append(keys, "missing")...)
+	require.NoError(t, err)
+	require.Len(t, items, 20)
+	for i, item := range items {
+		assert.Equal(t, keys[i], item.Key)
+	}
+	items, err = newClient.Gets(ctx, keys...)
+	require.NoError(t, err)
+	assert.Len(t, items, 20)
+
+	_, err = m.Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	mu.Lock()
+	assert.Empty(t, errs)
+	mu.Unlock()
+}
+
+func Test_MigrationClient_GetsMissing(t *testing.T) {
+	m, oldClient, newClient := newTestMigrationClient(t, MigrationReadPercent(100))
+	ctx := context.Background()
+
+	// all the keys miss in the new Client and hit in the old one.
+	require.NoError(t, oldClient.Set(ctx, "a", []byte("old"), 0, 0))
+	items, err := m.Gets(ctx, "a")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "old", string(items[0].Value))
+
+	// the hits in the new Client are kept when the others miss in the old one.
+	require.NoError(t, newClient.Set(ctx, "b", []byte("new"), 0, 0))
+	items, err = m.Gets(ctx, "b", "c")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "new", string(items[0].Value))
+
+	_, err = m.Gets(ctx, "c", "d")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func Test_MigrationClient_readsNew(t *testing.T) {
+	m := NewMigrationClient(nil, nil)
+
+	count := func() int {
+		n := 0
+		for i := 0; i < 1000; i++ {
+			if m.readsNew(fmt.Sprintf("key-%d", i)) {
+				n++
+			}
+		}
+		return n
+	}
+
+	assert.Zero(t, count())
+	m.SetReadPercent(30)
+	assert.InDelta(t, 300, count(), 60)
+	m.SetReadPercent(100)
+	assert.Equal(t, 1000, count())
+}
@@ -0,0 +1,280 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMutexRetryInterval is the default interval of Lock to retry acquiring
+// the lock which is held by others.
+const defaultMutexRetryInterval = 50 * time.Millisecond
+
+// MutexOption is used to set options for Mutex.
+type MutexOption func(*Mutex)
+
+// MutexRetryInterval sets the interval of Lock to retry acquiring the lock
+// which is held by others, default is 50ms.
+func MutexRetryInterval(d time.Duration) MutexOption {
+	return func(m *Mutex) {
+		if d > 0 {
+			m.retryInterval = d
+		}
+	}
+}
+
+// MutexAutoRefresh makes the Mutex extend the ttl of the lock every ttl/3 in
+// background until it's unlocked, or the lock is found lost.
+func MutexAutoRefresh() MutexOption {
+	return func(m *Mutex) {
+		m.autoRefresh = true
+	}
+}
+
+// Mutex is a distributed lock stored in memcached. The lock is acquired by
+// adding the key with a random token, and released or refreshed only if the
+// key still holds the token, so that a Mutex never releases the lock acquired
+// by others after its own one expired.
+//
+// Be careful, the lock is NOT safe in the strict sense, it's only suitable for
+// efficiency (e.g. avoid doing the same work twice) rather than correctness:
+//
+//   - the holder could be paused (e.g. GC or network delay) longer than the ttl,
+//     and keep working after the lock is acquired by another one.
+//   - memcached evicts items under memory pressure and loses them on restart,
+//     the lock could disappear before the ttl.
+//   - in cluster mode, the key is moved to another server if its server is down,
+//     where the lock is not held.
+//
+// The release and refresh are built on meta commands, so that the memcached
+// server must be 1.6.0 or later. A Mutex must not be copied after first use.
+type Mutex struct {
+	client *client
+	// commands sends the commands, it's the client itself unless the Mutex is
+	// returned by MigrationClient.
+	commands      Client
+	key           string
+	ttl           time.Duration
+	retryInterval time.Duration
+	autoRefresh   bool
+
+	mu    sync.Mutex // guards following
+	token []byte
+	// stopRefresh is closed to stop the refresh goroutine, refreshDone is closed
+	// when the goroutine exits.
+	stopRefresh chan struct{}
+	refreshDone chan struct{}
+}
+
+// NewMutex returns a distributed lock of the given key, the lock expires after
+// ttl if it's not unlocked or refreshed, so that a crashed holder does not hold
+// it forever. The ttl is rounded up to seconds.
+func (c *client) NewMutex(key string, ttl time.Duration, opts ...MutexOption) *Mutex {
+	m := &Mutex{
+		client:        c,
+		commands:      c,
+		key:           key,
+		ttl:           ttl,
+		retryInterval: defaultMutexRetryInterval,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// TryLock tries to acquire the lock once, it returns false if the lock is held
+// by others or by this Mutex already.
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	if m.ttl <= 0 {
+		return false, errors.Wrap(ErrInvalidArgument, "mutex ttl must be positive")
+	}
+	// whether the key is added is unknown in noreply mode.
+	if m.client.options.noReply {
+		return false, errors.Wrap(ErrNotSupported, "mutex in noreply mode")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != nil {
+		return false, nil
+	}
+
+	token, err := newLockToken()
+	if err != nil {
+		return false, err
+	}
+
+	err = m.commands.AddWithExpiration(ctx, m.key, token, 0, expirationAfter(m.client.now(), m.ttl))
+	if errors.Is(err, ErrNotStored) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "lock")
+	}
+
+	m.token = token
+	if m.autoRefresh {
+		m.stopRefresh = make(chan struct{})
+		m.refreshDone = make(chan struct{})
+		go m.refreshLoop(token, m.stopRefresh, m.refreshDone)
+	}
+
+	return true, nil
+}
+
+// Lock acquires the lock, it retries until the lock is acquired or the context
+// is done.
+func (m *Mutex) Lock(ctx context.Context) error {
+	ticker := time.NewTicker(m.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := m.TryLock(ctx)
+		if err != nil {
+			// the deadline of the connection is set by the context, the request
+			// could time out slightly before the context is done. It's compared
+			// with the wall clock rather than the clock of the client, since the
+			// deadline of the context is.
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if deadline, ok := ctx.Deadline(); ok && !nowFunc().Before(deadline) {
+				return context.DeadlineExceeded
+			}
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Unlock releases the lock, it returns ErrLockNotHeld if the lock is not held
+// by this Mutex, e.g. it has expired and possibly been acquired by others.
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	token, stop, done := m.token, m.stopRefresh, m.refreshDone
+	m.token, m.stopRefresh, m.refreshDone = nil, nil, nil
+	m.mu.Unlock()
+
+	if token == nil {
+		return ErrLockNotHeld
+	}
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	cas, err := m.holding(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.commands.MetaDelete(ctx, []byte(m.key), MetaDeleteFlagCompareCAS(cas))
+	if errors.Is(err, ErrExists) || errors.Is(err, ErrNotFound) {
+		return ErrLockNotHeld
+	}
+	if err != nil {
+		return errors.Wrap(err, "unlock")
+	}
+
+	return nil
+}
+
+// Refresh extends the ttl of the lock, it returns ErrLockNotHeld if the lock is
+// not held by this Mutex.
+func (m *Mutex) Refresh(ctx context.Context) error {
+	m.mu.Lock()
+	token := m.token
+	m.mu.Unlock()
+
+	if token == nil {
+		return ErrLockNotHeld
+	}
+
+	return m.refresh(ctx, token)
+}
+
+func (m *Mutex) refresh(ctx context.Context, token []byte) error {
+	cas, err := m.holding(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.commands.MetaSet(ctx, []byte(m.key), token,
+		MetaSetFlagCompareCAS(cas), MetaSetFlagTTL(metaTTL(expirationAfter(m.client.now(), m.ttl))))
+	if errors.Is(err, ErrExists) || errors.Is(err, ErrNotFound) {
+		return ErrLockNotHeld
+	}
+	if err != nil {
+		return errors.Wrap(err, "refresh lock")
+	}
+
+	return nil
+}
+
+// holding checks the lock is held by the token, and returns the cas unique of it.
+func (m *Mutex) holding(ctx context.Context, token []byte) (uint64, error) {
+	item, err := m.commands.MetaGet(ctx, []byte(m.key), MetaGetFlagReturnValue(), MetaGetFlagReturnCAS())
+	if errors.Is(err, ErrNotFound) {
+		return 0, ErrLockNotHeld
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "get lock")
+	}
+	if !bytes.Equal(item.Value, token) {
+		return 0, ErrLockNotHeld
+	}
+
+	return item.CAS, nil
+}
+
+func (m *Mutex) refreshLoop(token []byte, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	interval := m.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := m.refresh(ctx, token)
+		cancel()
+		// the other errors are possibly temporary, retry on the next tick.
+		if errors.Is(err, ErrLockNotHeld) {
+			return
+		}
+	}
+}
+
+// newLockToken returns a random token identifying the holder of a lock.
+func newLockToken() ([]byte, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "generate lock token")
+	}
+
+	token := make([]byte, hex.EncodedLen(len(b)))
+	hex.Encode(token, b)
+	return token, nil
+}
@@ -0,0 +1,145 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Mutex(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	t.Run("try lock", func(t *testing.T) {
+		m1 := c.NewMutex("try", time.Minute)
+		m2 := c.NewMutex("try", time.Minute)
+
+		ok, err := m1.TryLock(ctx)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = m1.TryLock(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok, "not reentrant")
+		ok, err = m2.TryLock(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		require.ErrorIs(t, m2.Unlock(ctx), ErrLockNotHeld)
+		require.NoError(t, m1.Unlock(ctx))
+		require.ErrorIs(t, m1.Unlock(ctx), ErrLockNotHeld)
+
+		ok, err = m2.TryLock(ctx)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		require.NoError(t, m2.Unlock(ctx))
+	})
+
+	t.Run("invalid ttl", func(t *testing.T) {
+		_, err := c.NewMutex("invalid", 0).TryLock(ctx)
+		require.ErrorIs(t, err, ErrInvalidArgument)
+	})
+
+	// the lock expired and acquired by others must not be released by the
+	// previous holder.
+	t.Run("lost lock", func(t *testing.T) {
+		m1 := c.NewMutex("lost", time.Minute)
+		m2 := c.NewMutex("lost", time.Minute)
+
+		ok, err := m1.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// simulate the expiration of the lock.
+		require.NoError(t, c.Delete(ctx, "lost"))
+		ok, err = m2.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		require.ErrorIs(t, m1.Unlock(ctx), ErrLockNotHeld)
+		ok, err = c.NewMutex("lost", time.Minute).TryLock(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok, "the lock of m2 must be kept")
+
+		require.NoError(t, m2.Refresh(ctx))
+		require.NoError(t, m2.Unlock(ctx))
+	})
+
+	t.Run("lock waits", func(t *testing.T) {
+		m1 := c.NewMutex("wait", time.Minute)
+		m2 := c.NewMutex("wait", time.Minute, MutexRetryInterval(10*time.Millisecond))
+		require.NoError(t, m1.Lock(ctx))
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, m2.Lock(timeoutCtx), context.DeadlineExceeded)
+
+		time.AfterFunc(50*time.Millisecond, func() { _ = m1.Unlock(ctx) })
+		require.NoError(t, m2.Lock(ctx))
+		require.NoError(t, m2.Unlock(ctx))
+	})
+
+	t.Run("mutual exclusion", func(t *testing.T) {
+		const workers = 8
+
+		var (
+			wg      sync.WaitGroup
+			holders atomic.Int32
+			entered atomic.Int32
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				m := c.NewMutex("exclusive", time.Minute, MutexRetryInterval(time.Millisecond))
+				if !assert.NoError(t, m.Lock(ctx)) {
+					return
+				}
+				assert.Equal(t, int32(1), holders.Add(1))
+				entered.Add(1)
+				time.Sleep(time.Millisecond)
+				holders.Add(-1)
+				assert.NoError(t, m.Unlock(ctx))
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(workers), entered.Load())
+	})
+
+	t.Run("auto refresh", func(t *testing.T) {
+		m := c.NewMutex("refreshed", time.Second, MutexAutoRefresh())
+		ok, err := m.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		time.Sleep(1500 * time.Millisecond)
+		ok, err = c.NewMutex("refreshed", time.Second).TryLock(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok, "the lock must be refreshed")
+
+		require.NoError(t, m.Unlock(ctx))
+	})
+}
+
+func Test_Mutex_noReply(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithNoReply())
+	require.NoError(t, err)
+	defer c.Close()
+
+	m := c.NewMutex("foo", time.Minute)
+	ok, err := m.TryLock(context.Background())
+	require.ErrorIs(t, err, ErrNotSupported)
+	assert.False(t, ok)
+	require.ErrorIs(t, m.Lock(context.Background()), ErrNotSupported)
+}
@@ -0,0 +1,418 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMuxQueueSize is the number of requests which could be queued on one
+// multiplexed connection before the callers are blocked.
+const defaultMuxQueueSize = 1024
+
+// errMultiplexerClosed is returned when the request is dispatched to a closed multiplexer.
+var errMultiplexerClosed = errors.New("multiplexer closed")
+
+// muxCoalescing is the window of the requests whose writes are coalesced into one
+// flush, see WithWriteCoalescing. The zero value means each request is flushed.
+type muxCoalescing struct {
+	// window is the max duration to wait for more requests after the first one.
+	window time.Duration
+	// maxBatch is the max number of requests flushed at once.
+	maxBatch int
+}
+
+// batchWriter is implemented by the connections whose writes could be buffered,
+// so that several requests are flushed in one syscall.
+type batchWriter interface {
+	// bufferedWrite writes p into the buffer, it's sent once the buffer is full or flushed.
+	bufferedWrite(p []byte) (n int, err error)
+	flush() error
+}
+
+// multiplexer shares a fixed number of connections to one memcached server
+// among all requests, rather than holding a connection for each request in flight.
+//
+// Each connection has a writer goroutine which writes the queued requests one
+// by one without waiting for the responses, and a reader goroutine which reads
+// the responses. The memcached server replies the requests on one connection
+// in the same order as they are received, so that the responses are correlated
+// with the requests by FIFO ordering. Requests without reply (noreply mode)
+// break the ordering, so they are not supported. Quiet meta commands are fenced
+// by mn, so that they always have a reply.
+type multiplexer struct {
+	dial func(ctx context.Context) (memcachedConn, error)
+	// timeouts returns the read and write timeouts of the connections, they
+	// could be updated at runtime.
+	timeouts func() (readTimeout, writeTimeout time.Duration)
+	// coalescing is the window of the writes coalesced on each connection.
+	coalescing muxCoalescing
+
+	next   atomic.Uint32
+	slots  []*muxSlot
+	closed atomic.Bool
+}
+
+func newMultiplexer(
+	conns int, timeouts func() (readTimeout, writeTimeout time.Duration), coalescing muxCoalescing,
+	dial func(ctx context.Context) (memcachedConn, error),
+) *multiplexer {
+	if conns <= 0 {
+		conns = 1
+	}
+
+	m := &multiplexer{
+		dial:       dial,
+		timeouts:   timeouts,
+		coalescing: coalescing,
+		slots:      make([]*muxSlot, conns),
+	}
+	for i := range m.slots {
+		m.slots[i] = &muxSlot{}
+	}
+
+	return m
+}
+
+// muxSlot holds one of the fixed connections of the multiplexer, the broken
+// session is replaced by a new one lazily by the next request.
+type muxSlot struct {
+	mu   sync.Mutex // guards following
+	sess *muxSession
+}
+
+// muxCall is a request in flight over a multiplexed connection.
+type muxCall struct {
+	ctx context.Context
+	raw []byte
+	// resp is owned by the multiplexer until the call is done, so that the
+	// caller could give up waiting without racing with the reader goroutine.
+	resp *response
+	done chan error
+}
+
+// session returns the alive session of the slot, it dials a new connection if
+// there is no session or the session is broken.
+func (m *multiplexer) session(ctx context.Context) (*muxSession, error) {
+	if m.closed.Load() {
+		return nil, errMultiplexerClosed
+	}
+
+	slot := m.slots[int(m.next.Add(1)-1)%len(m.slots)]
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	if slot.sess != nil && !slot.sess.isClosed() {
+		return slot.sess, nil
+	}
+
+	cn, err := m.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the multiplexer may be closed while dialing, after close has visited the slot.
+	if m.closed.Load() {
+		_ = cn.Close()
+		return nil, errMultiplexerClosed
+	}
+
+	slot.sess = newMuxSession(cn, m.timeouts, m.coalescing)
+	return slot.sess, nil
+}
+
+// roundTrip sends the request over one of the connections and waits for the response.
+func (m *multiplexer) roundTrip(ctx context.Context, sess *muxSession, req *request, resp *response) error {
+	if resp.endIndicator == endIndicatorNoReply {
+		return errors.Wrap(ErrNotSupported, "noreply requests in multiplexing mode")
+	}
+
+	private := acquireResponse()
+	private.endIndicator = resp.endIndicator
+	private.limitedLines = resp.limitedLines
+	private.specEndLine = resp.specEndLine
+	private.lenientFaultLine = resp.lenientFaultLine
+	private.inlineFaults = resp.inlineFaults
+	private.rawLines = private.rawLines[:0]
+
+	call := &muxCall{
+		ctx:  ctx,
+		raw:  req.raw,
+		resp: private,
+		done: make(chan error, 1),
+	}
+
+	select {
+	case sess.queue <- call:
+	case <-sess.closing:
+		return sess.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var err error
+	select {
+	case err = <-call.done:
+	case <-sess.closing:
+		select {
+		case err = <-call.done:
+		default:
+			return sess.err
+		}
+	case <-ctx.Done():
+		// the response is read and dropped by the reader goroutine.
+		return ctx.Err()
+	}
+
+	// take over the lines, and put the buffers of the caller's response back to the pool.
+	resp.rawLines, private.rawLines = private.rawLines, resp.rawLines
+	resp.buf, private.buf = private.buf, resp.buf
+	resp.faultLine = private.faultLine
+	private.release()
+
+	return err
+}
+
+func (m *multiplexer) close() error {
+	if m.closed.Swap(true) {
+		return nil
+	}
+
+	for _, slot := range m.slots {
+		slot.mu.Lock()
+		if slot.sess != nil {
+			slot.sess.close(errMultiplexerClosed)
+		}
+		slot.mu.Unlock()
+	}
+
+	return nil
+}
+
+// muxSession is a multiplexed connection with its writer and reader goroutines.
+type muxSession struct {
+	cn         memcachedConn
+	timeouts   func() (readTimeout, writeTimeout time.Duration)
+	coalescing muxCoalescing
+
+	// queue holds the calls to write.
+	queue chan *muxCall
+	// pending holds the calls have been written and waiting for the responses in order.
+	pending chan *muxCall
+	// written is reused by batchWriteLoop to hold the calls written in a batch.
+	written []*muxCall
+
+	closeOnce sync.Once
+	// closing is closed when the session is broken or closed, err is set before it.
+	closing chan struct{}
+	err     error
+}
+
+func newMuxSession(
+	cn memcachedConn, timeouts func() (readTimeout, writeTimeout time.Duration), coalescing muxCoalescing,
+) *muxSession {
+	s := &muxSession{
+		cn:         cn,
+		timeouts:   timeouts,
+		coalescing: coalescing,
+		queue:      make(chan *muxCall, defaultMuxQueueSize),
+		pending:    make(chan *muxCall, defaultMuxQueueSize),
+		closing:    make(chan struct{}),
+	}
+
+	if bw, ok := cn.(batchWriter); ok && coalescing.maxBatch > 1 {
+		go s.batchWriteLoop(bw)
+	} else {
+		go s.writeLoop()
+	}
+	go s.readLoop()
+
+	return s
+}
+
+func (s *muxSession) isClosed() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *muxSession) close(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.closing)
+		_ = s.cn.Close()
+	})
+}
+
+func (s *muxSession) writeLoop() {
+	for {
+		var call *muxCall
+		select {
+		case <-s.closing:
+			return
+		case call = <-s.queue:
+		}
+
+		// the caller has given up before the request is written, skip it
+		// so that no response is expected.
+		if err := call.ctx.Err(); err != nil {
+			call.done <- err
+			continue
+		}
+
+		_, writeTimeout := s.timeouts()
+		_ = s.cn.setWriteDeadline(nowFunc().Add(writeTimeout))
+		if _, err := s.cn.Write(call.raw); err != nil {
+			err = errors.Wrap(err, "multiplexer write")
+			call.done <- err
+			s.close(err)
+			return
+		}
+
+		select {
+		case s.pending <- call:
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// batchWriteLoop writes the queued requests as writeLoop does, but it coalesces
+// the requests queued within the window into one flush.
+func (s *muxSession) batchWriteLoop(bw batchWriter) {
+	batch := make([]*muxCall, 0, s.coalescing.maxBatch)
+	var timer *time.Timer
+	if s.coalescing.window > 0 {
+		timer = time.NewTimer(s.coalescing.window)
+		timer.Stop()
+		defer timer.Stop()
+	}
+
+	for {
+		var call *muxCall
+		select {
+		case <-s.closing:
+			return
+		case call = <-s.queue:
+		}
+
+		batch = append(batch[:0], call)
+		if timer != nil {
+			timer.Reset(s.coalescing.window)
+		}
+	collect:
+		for len(batch) < s.coalescing.maxBatch {
+			// take the queued requests at once, then wait for more within the window.
+			select {
+			case call = <-s.queue:
+				batch = append(batch, call)
+				continue
+			default:
+			}
+			if timer == nil {
+				break
+			}
+
+			select {
+			case <-s.closing:
+				return
+			case call = <-s.queue:
+				batch = append(batch, call)
+			case <-timer.C:
+				break collect
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if !s.writeBatch(bw, batch) {
+			return
+		}
+	}
+}
+
+// writeBatch writes the calls and flushes them at once, the calls are passed to
+// the reader in order. It returns false if the session is broken or closed.
+func (s *muxSession) writeBatch(bw batchWriter, batch []*muxCall) bool {
+	_, writeTimeout := s.timeouts()
+	_ = s.cn.setWriteDeadline(nowFunc().Add(writeTimeout))
+
+	written := s.written[:0]
+	var err error
+	for _, call := range batch {
+		// the caller has given up before the request is written, skip it
+		// so that no response is expected.
+		if ctxErr := call.ctx.Err(); ctxErr != nil {
+			call.done <- ctxErr
+			continue
+		}
+		if _, err = bw.bufferedWrite(call.raw); err != nil {
+			break
+		}
+		written = append(written, call)
+	}
+	if err == nil && len(written) > 0 {
+		err = bw.flush()
+	}
+	s.written = written
+	if err != nil {
+		// the written requests may be sent partially, so that the session is broken.
+		err = errors.Wrap(err, "multiplexer write")
+		for _, call := range batch {
+			// the skipped calls have got their errors.
+			select {
+			case call.done <- err:
+			default:
+			}
+		}
+		s.close(err)
+		return false
+	}
+
+	for _, call := range written {
+		select {
+		case s.pending <- call:
+		case <-s.closing:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *muxSession) readLoop() {
+	for {
+		var call *muxCall
+		select {
+		case <-s.closing:
+			return
+		case call = <-s.pending:
+		}
+
+		readTimeout, _ := s.timeouts()
+		err := call.resp.recv(context.Background(), s.cn, readTimeout)
+		// the response is released by the caller once it's done.
+		desynced := call.resp.desynced(err)
+		call.done <- err
+		if desynced {
+			s.close(errors.Wrap(err, "multiplexer read"))
+			return
+		}
+	}
+}
+
+// isUDPNetwork reports whether the address is a udp address.
+func isUDPNetwork(addr *Addr) bool {
+	switch addr.Network {
+	case "udp", "udp4", "udp6":
+		return true
+	}
+
+	return false
+}
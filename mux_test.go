@@ -0,0 +1,281 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveGets serves get commands on all accepted connections, the value of a key
+// is the key itself except:
+//
+//	miss*  replies END
+//	slow*  replies after 200ms
+//	close* closes the connection without reply
+func serveGets(t testing.TB) (string, *atomic.Int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	accepted := &atomic.Int32{}
+	go func() {
+		for {
+			cn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+
+			go func() {
+				defer cn.Close()
+				rr := bufio.NewReader(cn)
+				for {
+					line, err := rr.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					key := strings.TrimSpace(strings.TrimPrefix(line, "get "))
+					switch {
+					case strings.HasPrefix(key, "miss"):
+						_, _ = io.WriteString(cn, "END\r\n")
+						continue
+					case strings.HasPrefix(key, "slow"):
+						time.Sleep(200 * time.Millisecond)
+					case strings.HasPrefix(key, "close"):
+						return
+					}
+
+					_, _ = fmt.Fprintf(cn, "VALUE %s 0 %d\r\n%s\r\nEND\r\n", key, len(key), key)
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), accepted
+}
+
+func TestMultiplexing_concurrentRequests(t *testing.T) {
+	addr, accepted := serveGets(t)
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMultiplexing(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("key-%d", i)
+			item, err := c.Get(context.Background(), key)
+			if assert.NoError(t, err) {
+				assert.Equal(t, key, string(item.Value))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestMultiplexing_inSyncError(t *testing.T) {
+	addr, accepted := serveGets(t)
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMultiplexing(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Get(context.Background(), "miss")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	item, err := c.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(item.Value))
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestMultiplexing_redialBrokenConnection(t *testing.T) {
+	addr, accepted := serveGets(t)
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMultiplexing(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Get(context.Background(), "close")
+	require.Error(t, err)
+
+	item, err := c.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(item.Value))
+	assert.Equal(t, int32(2), accepted.Load())
+}
+
+func TestMultiplexing_abandonedRequest(t *testing.T) {
+	addr, accepted := serveGets(t)
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMultiplexing(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.Get(ctx, "slow")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the response of the abandoned request must not be taken by the next one.
+	item, err := c.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(item.Value))
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestMultiplexing_noReplyNotSupported(t *testing.T) {
+	addr, _ := serveGets(t)
+
+	_, err := New(addr, WithMultiplexing(1), WithNoReply())
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+// writeCountingConn counts the writes to the socket.
+type writeCountingConn struct {
+	net.Conn
+	writes *atomic.Int32
+}
+
+func (c writeCountingConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(p)
+}
+
+func dialCountingWrites(writes *atomic.Int32) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		cn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		return writeCountingConn{Conn: cn, writes: writes}, nil
+	}
+}
+
+func TestMultiplexing_writeCoalescing(t *testing.T) {
+	addr, _ := serveGets(t)
+
+	writes := &atomic.Int32{}
+	c, err := New(addr, WithCapabilityDetection(false), WithMultiplexing(1),
+		WithWriteCoalescing(5*time.Millisecond, 16), WithDialer(dialCountingWrites(writes)))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// a single request is flushed once the window ends.
+	item, err := c.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(item.Value))
+	assert.Equal(t, int32(1), writes.Load())
+
+	// the requests within the window are flushed at once.
+	writes.Store(0)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("key-%d", i)
+			item, err := c.Get(context.Background(), key)
+			if assert.NoError(t, err) {
+				assert.Equal(t, key, string(item.Value))
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, writes.Load(), int32(4))
+	assert.LessOrEqual(t, writes.Load(), int32(32))
+
+	// the abandoned request in a batch is skipped.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.Get(ctx, "slow")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	item, err = c.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(item.Value))
+}
+
+// BenchmarkMultiplexing_writeCoalescing sends the small requests over one
+// multiplexed connection concurrently, with and without coalescing the writes.
+//
+// go test -run=^$ -bench=BenchmarkMultiplexing_writeCoalescing -cpu=8
+func BenchmarkMultiplexing_writeCoalescing(b *testing.B) {
+	benches := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "off"},
+		{name: "window=0", opts: []ClientOption{WithWriteCoalescing(0, 16)}},
+		{name: "window=50us", opts: []ClientOption{WithWriteCoalescing(50*time.Microsecond, 16)}},
+	}
+
+	for _, bench := range benches {
+		b.Run(bench.name, func(b *testing.B) {
+			addr, _ := serveGets(b)
+			opts := append([]ClientOption{WithCapabilityDetection(false), WithMultiplexing(1)}, bench.opts...)
+			c, err := New(addr, opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+
+			b.ReportAllocs()
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := c.Get(context.Background(), "foo"); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestMultiplexing_closedWhileDialing(t *testing.T) {
+	addr, _ := serveGets(t)
+
+	var (
+		m      *multiplexer
+		dialed *conn
+	)
+	m = newMultiplexer(1, func() (time.Duration, time.Duration) { return time.Second, time.Second }, muxCoalescing{},
+		func(ctx context.Context) (memcachedConn, error) {
+			raw, err := net.Dial("tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			dialed = &conn{raw: raw, rr: bufio.NewReader(raw), wr: bufio.NewWriter(raw)}
+
+			// the multiplexer is closed before the dialing session takes the slot.
+			go func() { _ = m.close() }()
+			require.Eventually(t, m.closed.Load, time.Second, time.Millisecond)
+
+			return dialed, nil
+		})
+
+	_, err := m.session(context.Background())
+	require.ErrorIs(t, err, errMultiplexerClosed)
+	assert.True(t, dialed.closed, "the connection dialed after closing must be closed")
+}
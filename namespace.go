@@ -0,0 +1,232 @@
+package memcached
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultNamespaceCacheTTL is the default duration the version of a namespace
+// is cached locally.
+const defaultNamespaceCacheTTL = time.Second
+
+// namespaceKeyPrefix is the prefix of the keys of namespaces.
+const namespaceKeyPrefix = "ns:"
+
+// maxNamespaceAttempts is the max attempts to read or bump the version of a
+// namespace, while it's deleted or initialized by others concurrently.
+const maxNamespaceAttempts = 3
+
+// NamespaceOption is used to set options for Namespaces.
+type NamespaceOption func(*Namespaces)
+
+// NamespaceCacheTTL sets the duration the version of a namespace is cached
+// locally, default is 1 second. The invalidation by other clients takes effect
+// on this client after it at most, 0 disables the cache.
+func NamespaceCacheTTL(d time.Duration) NamespaceOption {
+	return func(ns *Namespaces) {
+		if d < 0 {
+			d = 0
+		}
+		ns.cacheTTL = d
+	}
+}
+
+// Namespaces groups keys into namespaces which could be invalidated at once.
+//
+// The keys of a namespace are stored under a versioned prefix "ns:<name>:<version>:<key>",
+// and the version is stored in the key "ns:<name>". Invalidating a namespace bumps
+// the version, so that all keys of the namespace are missed logically and then
+// evicted by memcached as they are never accessed again.
+//
+// The version is initialized with the current time in nanoseconds, so that an
+// evicted version never goes back to the ones used before. The versions could not
+// be read back in noreply mode, so that Namespaces fail with ErrNotSupported then.
+type Namespaces struct {
+	client *client
+	// commands sends the commands, it's the client itself unless the Namespaces
+	// is returned by MigrationClient.
+	commands Client
+	cacheTTL time.Duration
+
+	mu       sync.Mutex // guards following
+	versions map[string]cachedNamespaceVersion
+}
+
+type cachedNamespaceVersion struct {
+	version   uint64
+	expiresAt time.Time
+}
+
+// Namespaces returns the helper to access keys grouped by namespaces.
+func (c *client) Namespaces(opts ...NamespaceOption) *Namespaces {
+	ns := &Namespaces{
+		client:   c,
+		commands: c,
+		cacheTTL: defaultNamespaceCacheTTL,
+		versions: make(map[string]cachedNamespaceVersion, 8),
+	}
+	for _, opt := range opts {
+		opt(ns)
+	}
+
+	return ns
+}
+
+// Key returns the key in memcached of the given key in the namespace.
+func (ns *Namespaces) Key(ctx context.Context, name, key string) (string, error) {
+	version, err := ns.Version(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	return namespaceKeyPrefix + name + ":" + strconv.FormatUint(version, 10) + ":" + key, nil
+}
+
+// Get gets the item of the given key in the namespace, the Key of the returned
+// item is the given key rather than the one in memcached.
+func (ns *Namespaces) Get(ctx context.Context, name, key string) (*Item, error) {
+	nsKey, err := ns.Key(ctx, name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := ns.commands.Get(ctx, nsKey)
+	if err != nil {
+		return nil, err
+	}
+	item.Key = key
+
+	return item, nil
+}
+
+// Set stores the given key-value pair in the namespace.
+func (ns *Namespaces) Set(ctx context.Context, name, key string, value []byte, flag uint32, expiry time.Duration) error {
+	nsKey, err := ns.Key(ctx, name, key)
+	if err != nil {
+		return err
+	}
+
+	return ns.commands.Set(ctx, nsKey, value, flag, expiry)
+}
+
+// Delete deletes the given key in the namespace.
+func (ns *Namespaces) Delete(ctx context.Context, name, key string) error {
+	nsKey, err := ns.Key(ctx, name, key)
+	if err != nil {
+		return err
+	}
+
+	return ns.commands.Delete(ctx, nsKey)
+}
+
+// Version returns the current version of the namespace, it's read from the
+// local cache if possible, and initialized if the namespace does not exist.
+func (ns *Namespaces) Version(ctx context.Context, name string) (uint64, error) {
+	if version, ok := ns.cached(name); ok {
+		return version, nil
+	}
+	if err := ns.checkNoReply(); err != nil {
+		return 0, err
+	}
+
+	versionKey := namespaceKeyPrefix + name
+	for attempt := 0; attempt < maxNamespaceAttempts; attempt++ {
+		item, err := ns.commands.Get(ctx, versionKey)
+		if err == nil {
+			version, err := strconv.ParseUint(string(item.Value), 10, 64)
+			if err != nil {
+				return 0, errors.Wrapf(ErrMalformedResponse, "namespace version %q is not a decimal number", item.Value)
+			}
+			ns.cache(name, version)
+			return version, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return 0, errors.Wrap(err, "get namespace version")
+		}
+
+		version := uint64(ns.client.now().UnixNano())
+		err = ns.commands.Add(ctx, versionKey, []byte(strconv.FormatUint(version, 10)), 0, 0)
+		if err == nil {
+			ns.cache(name, version)
+			return version, nil
+		}
+		// the version is initialized concurrently, read it again.
+		if !errors.Is(err, ErrNotStored) {
+			return 0, errors.Wrap(err, "init namespace version")
+		}
+	}
+
+	return 0, errors.Wrapf(ErrNotStored, "namespace version changed concurrently in %d attempts", maxNamespaceAttempts)
+}
+
+// InvalidateNamespace invalidates all keys in the namespace by bumping its version.
+func (ns *Namespaces) InvalidateNamespace(ctx context.Context, name string) error {
+	if err := ns.checkNoReply(); err != nil {
+		return err
+	}
+
+	versionKey := namespaceKeyPrefix + name
+	for attempt := 0; attempt < maxNamespaceAttempts; attempt++ {
+		version, err := ns.commands.Incr(ctx, versionKey, 1)
+		if err == nil {
+			ns.cache(name, version)
+			return nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return errors.Wrap(err, "bump namespace version")
+		}
+
+		// the version does not exist, a new one invalidates the namespace as well.
+		version = uint64(ns.client.now().UnixNano())
+		err = ns.commands.Add(ctx, versionKey, []byte(strconv.FormatUint(version, 10)), 0, 0)
+		if err == nil {
+			ns.cache(name, version)
+			return nil
+		}
+		if !errors.Is(err, ErrNotStored) {
+			return errors.Wrap(err, "init namespace version")
+		}
+	}
+
+	return errors.Wrapf(ErrNotStored, "namespace version changed concurrently in %d attempts", maxNamespaceAttempts)
+}
+
+// checkNoReply returns ErrNotSupported in noreply mode, where the version read
+// by incr and whether it's initialized by add are unknown.
+func (ns *Namespaces) checkNoReply() error {
+	if ns.client.options.noReply {
+		return errors.Wrap(ErrNotSupported, "namespaces in noreply mode")
+	}
+
+	return nil
+}
+
+func (ns *Namespaces) cached(name string) (uint64, bool) {
+	if ns.cacheTTL <= 0 {
+		return 0, false
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	v, ok := ns.versions[name]
+	if !ok || !ns.client.now().Before(v.expiresAt) {
+		return 0, false
+	}
+
+	return v.version, true
+}
+
+func (ns *Namespaces) cache(name string, version uint64) {
+	if ns.cacheTTL <= 0 {
+		return
+	}
+
+	ns.mu.Lock()
+	ns.versions[name] = cachedNamespaceVersion{version: version, expiresAt: ns.client.now().Add(ns.cacheTTL)}
+	ns.mu.Unlock()
+}
@@ -0,0 +1,144 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Namespaces(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	t.Run("invalidate", func(t *testing.T) {
+		ns := c.Namespaces()
+
+		require.NoError(t, ns.Set(ctx, "user:1", "profile", []byte("alice"), 0, 0))
+		require.NoError(t, ns.Set(ctx, "user:2", "profile", []byte("bob"), 0, 0))
+
+		item, err := ns.Get(ctx, "user:1", "profile")
+		require.NoError(t, err)
+		assert.Equal(t, "profile", item.Key)
+		assert.Equal(t, "alice", string(item.Value))
+
+		require.NoError(t, ns.InvalidateNamespace(ctx, "user:1"))
+		_, err = ns.Get(ctx, "user:1", "profile")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		item, err = ns.Get(ctx, "user:2", "profile")
+		require.NoError(t, err)
+		assert.Equal(t, "bob", string(item.Value), "other namespaces are not affected")
+	})
+
+	t.Run("key", func(t *testing.T) {
+		ns := c.Namespaces()
+
+		version, err := ns.Version(ctx, "keyed")
+		require.NoError(t, err)
+		key, err := ns.Key(ctx, "keyed", "foo")
+		require.NoError(t, err)
+		assert.Equal(t, "ns:keyed:"+strconv.FormatUint(version, 10)+":foo", key)
+
+		require.NoError(t, ns.InvalidateNamespace(ctx, "keyed"))
+		bumped, err := ns.Version(ctx, "keyed")
+		require.NoError(t, err)
+		assert.Equal(t, version+1, bumped)
+	})
+
+	t.Run("shared by clients", func(t *testing.T) {
+		cached := c.Namespaces(NamespaceCacheTTL(time.Hour))
+		uncached := c.Namespaces(NamespaceCacheTTL(0))
+
+		require.NoError(t, cached.Set(ctx, "shared", "foo", []byte("bar"), 0, 0))
+		_, err := uncached.Get(ctx, "shared", "foo")
+		require.NoError(t, err)
+
+		require.NoError(t, uncached.InvalidateNamespace(ctx, "shared"))
+		_, err = uncached.Get(ctx, "shared", "foo")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// the version is cached, the invalidation by others is not seen yet.
+		_, err = cached.Get(ctx, "shared", "foo")
+		require.NoError(t, err)
+	})
+
+	t.Run("evicted version", func(t *testing.T) {
+		ns := c.Namespaces(NamespaceCacheTTL(0))
+		require.NoError(t, ns.Set(ctx, "evicted", "foo", []byte("bar"), 0, 0))
+		version, err := ns.Version(ctx, "evicted")
+		require.NoError(t, err)
+
+		// the new version must not reuse the previous one.
+		require.NoError(t, c.Delete(ctx, "ns:evicted"))
+		renewed, err := ns.Version(ctx, "evicted")
+		require.NoError(t, err)
+		assert.NotEqual(t, version, renewed)
+		_, err = ns.Get(ctx, "evicted", "foo")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, c.Delete(ctx, "ns:evicted"))
+		require.NoError(t, ns.InvalidateNamespace(ctx, "evicted"))
+		invalidated, err := ns.Version(ctx, "evicted")
+		require.NoError(t, err)
+		assert.NotEqual(t, renewed, invalidated)
+	})
+}
+
+func Test_Namespaces_racing(t *testing.T) {
+	// the version is always deleted right after it's initialized by others.
+	var adds atomic.Int32
+	addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+		for {
+			line, err := rr.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "get "):
+				_, _ = io.WriteString(w, "END\r\n")
+			case strings.HasPrefix(line, "incr "):
+				_, _ = io.WriteString(w, "NOT_FOUND\r\n")
+			case strings.HasPrefix(line, "add "):
+				_, _ = rr.ReadString('\n')
+				adds.Add(1)
+				_, _ = io.WriteString(w, "NOT_STORED\r\n")
+			}
+		}
+	})
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ns := c.Namespaces(NamespaceCacheTTL(0))
+	_, err = ns.Version(context.Background(), "user:1")
+	require.ErrorIs(t, err, ErrNotStored)
+	assert.Equal(t, int32(maxNamespaceAttempts), adds.Load())
+
+	require.ErrorIs(t, ns.InvalidateNamespace(context.Background(), "user:1"), ErrNotStored)
+	assert.Equal(t, int32(2*maxNamespaceAttempts), adds.Load())
+}
+
+func Test_Namespaces_noReply(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithNoReply())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ns := c.Namespaces()
+	_, err = ns.Version(context.Background(), "user:1")
+	require.ErrorIs(t, err, ErrNotSupported)
+	require.ErrorIs(t, ns.InvalidateNamespace(context.Background(), "user:1"), ErrNotSupported)
+}
@@ -0,0 +1,177 @@
+package memcached
+
+import (
+	"context"
+	"time"
+)
+
+// nodeKey is the context key of the memcached server targeted by DoOnNode.
+type nodeKey struct{}
+
+// nodeFrom returns the memcached server targeted by the context, or nil.
+func nodeFrom(ctx context.Context) *Addr {
+	addr, _ := ctx.Value(nodeKey{}).(*Addr)
+	return addr
+}
+
+// DoOnNode runs fn with the context targeting the memcached server at addr, one of
+// the servers of the client. The commands called with the context are sent to the
+// server without picking it by their keys, and the commands sent to all servers,
+// such as VersionAll and FlushAll, are sent to it only. It's useful to debug which
+// node holds a key or why one node misbehaves:
+//
+//	err := client.DoOnNode(ctx, addr, func(ctx context.Context) error {
+//		item, err := client.Get(ctx, "foo")
+//		...
+//	})
+//
+// NOTE: the keys written on the server which is not theirs are unreachable by the
+// commands out of DoOnNode. The error returned by fn is returned as is.
+func (c *client) DoOnNode(ctx context.Context, addr *Addr, fn func(ctx context.Context) error) error {
+	addr, err := c.lookupAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	return fn(context.WithValue(ctx, nodeKey{}, addr))
+}
+
+// NodeClient is the commands bound to one memcached server of the client, see
+// client.Node. It shares the connections with the client.
+type NodeClient interface {
+	// ConnCommander is the key-value commands, Addr returns the server.
+	ConnCommander
+
+	MetaDebug(ctx context.Context, key []byte, options ...MetaDebugOption) (*MetaItemDebug, error)
+	Stats(ctx context.Context) (*Statistic, error)
+	Version(ctx context.Context) (string, error)
+	FlushAll(ctx context.Context) error
+}
+
+var _ NodeClient = (*nodeClient)(nil)
+
+// Node returns the commands bound to the memcached server at addr, one of the
+// servers of the client, the keys are sent to it without picking the server by
+// them, e.g. for the tools and the tests targeting individual nodes:
+//
+//	node, err := client.Node(&memcached.Addr{Address: "10.0.0.2:11211"})
+//	stats, err := node.Stats(ctx)
+//
+// It's DoOnNode of each command, see DoOnNode for the caveats.
+func (c *client) Node(addr *Addr) (NodeClient, error) {
+	addr, err := c.lookupAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nodeClient{client: c, addr: addr}, nil
+}
+
+// nodeClient implements NodeClient by the client with the context targeting the
+// memcached server.
+type nodeClient struct {
+	client *client
+	addr   *Addr
+}
+
+func (nc *nodeClient) onNode(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nodeKey{}, nc.addr)
+}
+
+func (nc *nodeClient) Addr() *Addr { return nc.addr }
+
+func (nc *nodeClient) Set(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return nc.client.Set(nc.onNode(ctx), key, value, flag, expiry)
+}
+
+func (nc *nodeClient) Add(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return nc.client.Add(nc.onNode(ctx), key, value, flag, expiry)
+}
+
+func (nc *nodeClient) Replace(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return nc.client.Replace(nc.onNode(ctx), key, value, flag, expiry)
+}
+
+func (nc *nodeClient) Append(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return nc.client.Append(nc.onNode(ctx), key, value, flag, expiry)
+}
+
+func (nc *nodeClient) Prepend(ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration) error {
+	return nc.client.Prepend(nc.onNode(ctx), key, value, flag, expiry)
+}
+
+func (nc *nodeClient) Cas(
+	ctx context.Context, key string, value []byte, flag uint32, expiry time.Duration, cas uint64,
+) error {
+	return nc.client.Cas(nc.onNode(ctx), key, value, flag, expiry, cas)
+}
+
+func (nc *nodeClient) Get(ctx context.Context, key string) (*Item, error) {
+	return nc.client.Get(nc.onNode(ctx), key)
+}
+
+func (nc *nodeClient) Gets(ctx context.Context, keys ...string) ([]*Item, error) {
+	return nc.client.Gets(nc.onNode(ctx), keys...)
+}
+
+func (nc *nodeClient) GetAndTouch(ctx context.Context, expiry time.Duration, key string) (*Item, error) {
+	return nc.client.GetAndTouch(nc.onNode(ctx), expiry, key)
+}
+
+func (nc *nodeClient) Delete(ctx context.Context, key string) error {
+	return nc.client.Delete(nc.onNode(ctx), key)
+}
+
+func (nc *nodeClient) DeleteCAS(ctx context.Context, key string, cas uint64) error {
+	return nc.client.DeleteCAS(nc.onNode(ctx), key, cas)
+}
+
+func (nc *nodeClient) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return nc.client.Incr(nc.onNode(ctx), key, delta)
+}
+
+func (nc *nodeClient) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return nc.client.Decr(nc.onNode(ctx), key, delta)
+}
+
+func (nc *nodeClient) Touch(ctx context.Context, key string, expiry time.Duration) error {
+	return nc.client.Touch(nc.onNode(ctx), key, expiry)
+}
+
+func (nc *nodeClient) MetaSet(ctx context.Context, key, value []byte, options ...MetaSetOption) (*MetaItem, error) {
+	return nc.client.MetaSet(nc.onNode(ctx), key, value, options...)
+}
+
+func (nc *nodeClient) MetaGet(ctx context.Context, key []byte, options ...MetaGetOption) (*MetaItem, error) {
+	return nc.client.MetaGet(nc.onNode(ctx), key, options...)
+}
+
+func (nc *nodeClient) MetaDelete(ctx context.Context, key []byte, options ...MetaDeleteOption) (*MetaItem, error) {
+	return nc.client.MetaDelete(nc.onNode(ctx), key, options...)
+}
+
+func (nc *nodeClient) MetaArithmetic(
+	ctx context.Context, key []byte, delta uint64, options ...MetaArithmeticOption,
+) (*MetaItem, error) {
+	return nc.client.MetaArithmetic(nc.onNode(ctx), key, delta, options...)
+}
+
+func (nc *nodeClient) MetaNoOp(ctx context.Context) error {
+	return nc.client.MetaNoOp(nc.onNode(ctx))
+}
+
+func (nc *nodeClient) MetaDebug(ctx context.Context, key []byte, options ...MetaDebugOption) (*MetaItemDebug, error) {
+	return nc.client.MetaDebug(nc.onNode(ctx), key, options...)
+}
+
+func (nc *nodeClient) Stats(ctx context.Context) (*Statistic, error) {
+	return nc.client.Stats(nc.onNode(ctx))
+}
+
+func (nc *nodeClient) Version(ctx context.Context) (string, error) {
+	return nc.client.Version(nc.onNode(ctx))
+}
+
+func (nc *nodeClient) FlushAll(ctx context.Context) error {
+	return nc.client.FlushAll(nc.onNode(ctx))
+}
@@ -0,0 +1,99 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_DoOnNode(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	addr1, addr2 := c.(*client).topology().addrs[0], c.(*client).topology().addrs[1]
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key-%d", i)
+		if node, err := c.WhichNode(key); err == nil && node == addr1 {
+			break
+		}
+	}
+
+	// the key is written on the server which is not its own.
+	err = c.DoOnNode(ctx, &Addr{Address: addr2.Address}, func(ctx context.Context) error {
+		if err := c.Set(ctx, key, []byte("v"), 0, 0); err != nil {
+			return err
+		}
+
+		item, err := c.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, "v", string(item.Value))
+
+		items, err := c.Gets(ctx, key, "missing")
+		require.NoError(t, err)
+		assert.Len(t, items, 1)
+
+		versions, err := c.VersionAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, versions, 1)
+		assert.Contains(t, versions, addr2)
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = c.Get(ctx, key)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, c.DoOnNode(ctx, addr1, func(ctx context.Context) error {
+		_, err := c.Get(ctx, key)
+		assert.ErrorIs(t, err, ErrNotFound)
+		return nil
+	}))
+
+	fnErr := fmt.Errorf("fn failed")
+	require.Equal(t, fnErr, c.DoOnNode(ctx, addr1, func(context.Context) error { return fnErr }))
+	require.ErrorIs(t, c.DoOnNode(ctx, &Addr{Address: "unknown:11211"}, func(context.Context) error { return nil }), ErrInvalidArgument)
+}
+
+func Test_client_Node(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	addr1, addr2 := c.(*client).topology().addrs[0], c.(*client).topology().addrs[1]
+	node1, err := c.Node(&Addr{Address: addr1.Address})
+	require.NoError(t, err)
+	node2, err := c.Node(addr2)
+	require.NoError(t, err)
+	assert.Equal(t, addr1, node1.Addr())
+
+	// the same key is stored on both servers.
+	require.NoError(t, node1.Set(ctx, "foo", []byte("1"), 0, 0))
+	require.NoError(t, node2.Set(ctx, "foo", []byte("2"), 0, 0))
+	item, err := node1.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(item.Value))
+	item, err = node2.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(item.Value))
+
+	stats, err := node2.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.CurrItems)
+
+	require.NoError(t, node2.FlushAll(ctx))
+	_, err = node2.Get(ctx, "foo")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = node1.Get(ctx, "foo")
+	require.NoError(t, err)
+
+	_, err = c.Node(&Addr{Address: "unknown:11211"})
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
@@ -0,0 +1,68 @@
+package memcached
+
+import (
+	"github.com/pkg/errors"
+)
+
+// noReplyCounter is implemented by the connections counting the noreply requests
+// sent over them, see WithNoReplyVerify.
+type noReplyCounter interface {
+	// countNoReply counts a noreply request, and reports whether it's the n-th one
+	// since the last verification.
+	countNoReply(n int) bool
+}
+
+var _ noReplyCounter = (*conn)(nil)
+
+func (cn *conn) countNoReply(n int) bool {
+	cn.noReplies++
+	if cn.noReplies < n {
+		return false
+	}
+
+	cn.noReplies = 0
+	return true
+}
+
+// fenceNoReply fences the noreply request with a version command if it's the one
+// to verify over the connection, the response is read until the VERSION line then.
+// It reports whether the request is fenced.
+func (c *client) fenceNoReply(cn memcachedConn, req *request, resp *response) bool {
+	n := c.options.noReplyVerifyEvery
+	if n <= 0 || resp.endIndicator != endIndicatorNoReply || resp.udpEnabled {
+		return false
+	}
+
+	counter, ok := cn.(noReplyCounter)
+	if !ok || !counter.countNoReply(n) {
+		return false
+	}
+
+	req.raw = append(req.raw, _VersionCRLFBytes...)
+	resp.endIndicator = endIndicatorFenced
+	resp.specEndLine = _VersionLineBytes
+	resp.rawLines = resp.rawLines[:0]
+	return true
+}
+
+// verifiedNoReply handles the result of the noreply request fenced by fenceNoReply.
+// The drained errors are passed to the handler of WithNoReplyVerify rather than
+// returned, and the response is restored to the noreply one, so that the caller
+// handles it as not fenced. The errors failing the connection are returned as is.
+func (c *client) verifiedNoReply(addr *Addr, resp *response, err error) error {
+	if err != nil && !resp.drained {
+		return err
+	}
+
+	if err == nil && len(resp.rawLines) > 0 {
+		err = errors.Wrapf(ErrMalformedResponse, "unexpected reply of noreply request %q", trimCRLF(resp.rawLines[0]))
+	}
+	if err != nil && c.options.noReplyErrorHandler != nil {
+		c.options.noReplyErrorHandler(addr, err)
+	}
+
+	resp.endIndicator = endIndicatorNoReply
+	resp.specEndLine = nil
+	resp.rawLines = resp.rawLines[:0]
+	return nil
+}
@@ -0,0 +1,93 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_WithNoReplyVerify(t *testing.T) {
+	srv := newTestServer(t)
+
+	var (
+		mu      sync.Mutex
+		addrs   []string
+		drained []error
+	)
+	onError := func(addr *Addr, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		addrs = append(addrs, addr.Address)
+		drained = append(drained, err)
+	}
+
+	c, err := New(srv.Addr(), WithNoReply(), WithMaxConns(1), WithNoReplyVerify(3, onError))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	// the error of the noreply incr is left in the connection, and drained by
+	// the verification after the next noreply request.
+	_, err = c.Incr(ctx, "foo", 1)
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "counter", []byte("1"), 0, 0))
+
+	mu.Lock()
+	require.Len(t, drained, 1)
+	assert.ErrorIs(t, drained[0], ErrNonNumericValue)
+	assert.Equal(t, []string{srv.Addr()}, addrs)
+	mu.Unlock()
+
+	// the following requests are in sync with their replies.
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+	item, err = c.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(item.Value))
+
+	// the broadcast commands are verified too, FlushAll is the third noreply request
+	// since the last verification.
+	require.NoError(t, c.Delete(ctx, "missing"))
+	require.NoError(t, c.Delete(ctx, "foo"))
+	require.NoError(t, c.FlushAll(ctx))
+	_, err = c.Get(ctx, "counter")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	mu.Lock()
+	assert.Len(t, drained, 1)
+	mu.Unlock()
+}
+
+func Test_client_fenceNoReply(t *testing.T) {
+	c := &client{options: newClientOptions(), clientState: newClientState()}
+	c.options.noReplyVerifyEvery = 3
+	cn := &conn{}
+
+	fenced := 0
+	for i := 0; i < 9; i++ {
+		req, resp := buildDeleteCommand("foo", true)
+		if c.fenceNoReply(cn, req, resp) {
+			fenced++
+			assert.Equal(t, "delete foo noreply\r\nversion\r\n", string(req.raw))
+			assert.Equal(t, endIndicatorFenced, resp.endIndicator)
+
+			require.NoError(t, c.verifiedNoReply(nil, resp, nil))
+			assert.Equal(t, endIndicatorNoReply, resp.endIndicator)
+		}
+		releaseReqAndResp(req, resp)
+	}
+	assert.Equal(t, 3, fenced)
+
+	// the requests waiting for the reply are never fenced.
+	req, resp := buildDeleteCommand("foo", false)
+	defer releaseReqAndResp(req, resp)
+	for i := 0; i < 3; i++ {
+		assert.False(t, c.fenceNoReply(cn, req, resp))
+	}
+}
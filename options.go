@@ -1,6 +1,8 @@
 package memcached
 
 import (
+	"math"
+	"net"
 	"time"
 
 	memcodec "github.com/yeqown/memcached/codec"
@@ -11,6 +13,10 @@ import (
 type ClientOption func(*clientOptions)
 
 type clientOptions struct {
+	// configErr is the error of the Config applied by FromConfig, the client
+	// fails to be created with it.
+	configErr error
+
 	pickBuilder Builder
 
 	// resolver is the resolver for the client to resolve the given address
@@ -22,6 +28,14 @@ type clientOptions struct {
 	// The defaultResolver supports tcp、udp and unix domain socket. Default is tcp if the address
 	// is not specified start with `udp://` or `unix://`.
 	resolver Resolver
+	// topologyRefresh is the interval to refresh the memcached servers resolved
+	// from the address, 0 means the servers are resolved only once.
+	topologyRefresh time.Duration
+
+	// hashTag is the pair of delimiters of the hash tag in keys, the part of a key
+	// between them is used to pick the server instead of the whole key. It's
+	// disabled if nil.
+	hashTag *[2]byte
 
 	// dialTimeout is the timeout for dialing a connection to the memcached server
 	// instance. Default is 5 seconds.
@@ -35,6 +49,25 @@ type clientOptions struct {
 	// Default is 5 seconds.
 	// (Connection Timeout)
 	writeTimeout time.Duration
+	// failOpen means the requests to the unavailable memcached servers fail open as
+	// cache misses or no-op writes, rather than fail with the errors.
+	// Default is false.
+	failOpen bool
+	// adaptiveTimeout means the read timeout of each memcached server is computed
+	// from the latencies of its recent requests, rather than readTimeout.
+	// Default is false.
+	adaptiveTimeout    bool
+	adaptiveMultiplier float64
+	adaptiveMinTimeout time.Duration
+	adaptiveMaxTimeout time.Duration
+	// hedgeDelay is the delay to send the read request again if it has not been
+	// replied, 0 means the hedged reads are disabled.
+	// Default is 0.
+	hedgeDelay time.Duration
+	// deadlineBudget splits the deadline of the hedged reads between their
+	// attempts, nil means the first attempt takes the whole deadline.
+	// Default is nil.
+	deadlineBudget *deadlineBudget
 
 	// maxConns is the max connections in the pool.
 	// Default is 100.
@@ -48,22 +81,166 @@ type clientOptions struct {
 	// maxIdleTimeout is the max idle timeout for a connection, 0 means no idle timeout.
 	// Default is 0.
 	maxIdleTimeout time.Duration
+	// warmUpConns is the number of connections opened to each memcached server when
+	// the client is created, 0 means the connections are opened on demand.
+	// Default is 0.
+	warmUpConns int
+	// eagerConnect means the client connects to each memcached server when it's
+	// created, and fails if any of them could not be connected.
+	// Default is false.
+	eagerConnect bool
+	// poolWaitTimeout is the max duration to wait for a connection when the pool
+	// is exhausted, 0 means waiting until the context is done.
+	// Default is 0.
+	poolWaitTimeout time.Duration
+	// poolShards is the number of shards the connection pool of each memcached
+	// server is striped over.
+	// Default is 1.
+	poolShards int
+
+	// maxConcurrentRequests is the max in-flight requests to each memcached server,
+	// 0 means no limit.
+	// Default is 0.
+	maxConcurrentRequests int
+	// concurrencyWaitTimeout is the max duration to wait for an in-flight request
+	// to finish when the limit is reached, 0 means failing fast.
+	// Default is 0.
+	concurrencyWaitTimeout time.Duration
+
+	// rateLimit and rateBurst are the token bucket limiting the requests to each
+	// memcached server, and globalRateLimit and globalRateBurst are the one shared
+	// by all servers. 0 rate means no limit.
+	// Default is 0.
+	rateLimit       float64
+	rateBurst       int
+	globalRateLimit float64
+	globalRateBurst int
+	// rateLimitWait means the requests beyond the rate limit wait until allowed,
+	// rather than failing with ErrRateLimited.
+	// Default is false.
+	rateLimitWait bool
 
 	// noReply is the flag to indicate whether the client should wait for the response.
 	noReply bool
+	// noReplyVerifyEvery is the number of noreply requests over each connection
+	// between the verifications, 0 disables it. See WithNoReplyVerify.
+	noReplyVerifyEvery int
+	// noReplyErrorHandler is called with the errors drained by the verifications.
+	noReplyErrorHandler func(addr *Addr, err error)
+	// readYourWrites is the max number of the keys written by noreply requests
+	// tracked until acknowledged, 0 means disabled. See WithReadYourWrites.
+	readYourWrites int
 
 	// enableTLS means whether the client should use TLS to connect to the server.
 	enableSASL    bool
 	plainUsername string
 	plainPassword string
 
+	// tcpKeepAlive is the period of the TCP keepalive probes, negative means disabled.
+	// Default is 15s.
+	tcpKeepAlive time.Duration
+	// tcpNoDelay means whether the TCP connections disable the Nagle's algorithm.
+	// Default is true.
+	tcpNoDelay bool
+	// socketReadBuffer and socketWriteBuffer are the sizes of the socket buffers
+	// of the connections, 0 means the OS default.
+	socketReadBuffer  int
+	socketWriteBuffer int
+
+	// connReaderSize and connWriterSize are the sizes of the reader and the writer
+	// buffers of each connection.
+	// Default is 4KB.
+	connReaderSize int
+	connWriterSize int
+
+	// dialer dials the connections to the memcached servers, nil means the net.Dialer.
+	dialer DialFunc
+
+	// addrOptions are the options overriding the ones above for the servers,
+	// keyed by their addresses. See WithAddrOptions.
+	addrOptions map[string][]ClientOption
+
+	// proxyProtocol is the version of the PROXY header sent right after connecting,
+	// proxySourceAddr is the source address in it, nil means the local address.
+	// Default is ProxyProtocolNone.
+	proxyProtocol   ProxyProtocol
+	proxySourceAddr net.Addr
+
 	// enableUDP means whether the client should use UDP datagram to send the request.
 	enableUDP bool
 
 	// telemetryOptions holds the OpenTelemetry configuration options.
 	telemetryOptions []telemetry.Option
+	// requestHooks are called after each request is finished.
+	requestHooks []RequestHook
+	// wireLogger writes the request and response lines of every command, nil
+	// means disabled.
+	wireLogger *WireLogger
+	// protocolErrorCapture is the number of the last malformed responses kept by
+	// the client, 0 means disabled. See WithProtocolErrorCapture.
+	protocolErrorCapture int
 
 	codec Codec
+	// transformer transforms the values encoded by the codec, e.g. encrypts them,
+	// nil means disabled.
+	transformer *valueTransformer
+	// checksum is the algorithm of the checksum appended to the values.
+	// Default is ChecksumNone.
+	checksum Checksum
+	// flagsPolicy checks the caller-facing flags of the writes, nil means any
+	// flags are allowed.
+	flagsPolicy *memcodec.FlagsPolicy
+
+	// compatibility indicates the kind of server the client talks to, it
+	// adjusts behaviors of commands which differ between servers.
+	compatibility Compatibility
+	// casParsing is how the CAS uniques are parsed, see WithCASParsing.
+	casParsing CASParsing
+
+	// getAndTouchFallback means multi-key gat/gats rejected by a server are
+	// retried key by key.
+	getAndTouchFallback bool
+
+	// multiKeyMaxKeys and multiKeyMaxBytes bound the keys of each request of the
+	// multi-key retrievals, 0 means no limit.
+	// Default is 0 keys and 64KB.
+	multiKeyMaxKeys  int
+	multiKeyMaxBytes int
+
+	// capabilityDetection means whether the client should detect the version
+	// of each memcached server, and reject the commands which are not supported.
+	capabilityDetection bool
+
+	// staleConnReplay means the idempotent requests failed by a stale pooled
+	// connection are replayed over a new connection once.
+	staleConnReplay bool
+
+	// livenessIdle is the idle time of the connections to be checked before they
+	// are taken out of the pool by livenessProbe, 0 means they are not checked.
+	livenessIdle  time.Duration
+	livenessProbe LivenessProbe
+
+	// maxItemSize is the max size of an item stored by the client, 0 means no limit
+	// and DetectMaxItemSize means the limit is detected from each memcached server.
+	maxItemSize int
+	// autoTune makes the client configure its guards by the settings of each
+	// memcached server, see WithAutoTune.
+	autoTune bool
+
+	// multiplexConns is the number of connections shared by all requests to
+	// each memcached server in multiplexing mode, 0 means the mode is disabled
+	// and the connection pool is used.
+	multiplexConns int
+	// coalesceWindow and coalesceMaxBatch are the window of the writes coalesced
+	// into one flush on each multiplexed connection, see WithWriteCoalescing.
+	// Default is 0, each request is flushed.
+	coalesceWindow   time.Duration
+	coalesceMaxBatch int
+
+	// clock tells the current time to the pools, the adaptive timeouts, SoftTTL
+	// and Mutex, see WithClock.
+	// Default is the wall clock.
+	clock Clock
 }
 
 func newClientOptions() *clientOptions {
@@ -79,6 +256,13 @@ func newClientOptions() *clientOptions {
 		maxIdleConns:   10,
 		maxLifetime:    0,
 		maxIdleTimeout: 0,
+		poolShards:     1,
+
+		connReaderSize: defaultConnBufferSize,
+		connWriterSize: defaultConnBufferSize,
+
+		tcpKeepAlive: 15 * time.Second,
+		tcpNoDelay:   true,
 
 		noReply: false,
 
@@ -87,6 +271,71 @@ func newClientOptions() *clientOptions {
 		plainPassword: "",
 
 		codec: memcodec.Noop,
+
+		compatibility:       CompatMemcached,
+		capabilityDetection: true,
+		staleConnReplay:     true,
+
+		multiKeyMaxBytes: defaultMultiKeyMaxBytes,
+
+		clock: systemClock{},
+	}
+}
+
+// WithMaxConcurrentRequests limits the in-flight requests to each memcached server,
+// the requests beyond the limit fail fast with ErrOverloaded, or wait for the duration
+// set by WithConcurrencyWaitTimeout, so that a slow server could not absorb unbounded
+// goroutines. The shed requests are counted in PoolStats and reported to the request
+// hooks. 0 means no limit.
+func WithMaxConcurrentRequests(n int) ClientOption {
+	return func(o *clientOptions) {
+		if n < 0 {
+			n = 0
+		}
+
+		o.maxConcurrentRequests = n
+	}
+}
+
+// WithConcurrencyWaitTimeout sets the max duration to wait for an in-flight request
+// to finish when the limit set by WithMaxConcurrentRequests is reached, ErrOverloaded
+// is returned if none finishes within the duration. 0 means failing fast.
+func WithConcurrencyWaitTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if d < 0 {
+			d = 0
+		}
+
+		o.concurrencyWaitTimeout = d
+	}
+}
+
+// WithRateLimit limits the requests to each memcached server to rps per second with
+// bursts of up to burst requests, by a token bucket of each server. It protects
+// the shared memcached servers from runaway callers, e.g. batch jobs. The requests
+// beyond the limit fail with ErrRateLimited, unless WithRateLimitWait is set.
+// The non-positive rps means no limit.
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(o *clientOptions) {
+		o.rateLimit = math.Max(rps, 0)
+		o.rateBurst = burst
+	}
+}
+
+// WithGlobalRateLimit is the same as WithRateLimit, but the token bucket is shared
+// by all memcached servers. It could be used together with WithRateLimit.
+func WithGlobalRateLimit(rps float64, burst int) ClientOption {
+	return func(o *clientOptions) {
+		o.globalRateLimit = math.Max(rps, 0)
+		o.globalRateBurst = burst
+	}
+}
+
+// WithRateLimitWait makes the requests beyond the rate limit wait until allowed
+// or the context is done, rather than failing with ErrRateLimited.
+func WithRateLimitWait(enabled bool) ClientOption {
+	return func(o *clientOptions) {
+		o.rateLimitWait = enabled
 	}
 }
 
@@ -102,6 +351,23 @@ func WithResolver(r Resolver) ClientOption {
 	}
 }
 
+// WithTopologyRefresh makes the client created by New or NewWithContext follow the
+// changes of the memcached servers resolved from its address, e.g. the nodes of an
+// auto-discovered cluster, the servers are swapped by UpdateAddrs without dropping
+// the connections to the servers kept. The resolver implementing WatchResolver
+// watches the changes by itself every interval, the other ones are called every
+// interval. The failed resolutions are skipped, and the refresh is stopped when the
+// client is closed. It's ignored by NewFromAddrs, whose callers call UpdateAddrs.
+func WithTopologyRefresh(interval time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if interval <= 0 {
+			return
+		}
+
+		o.topologyRefresh = interval
+	}
+}
+
 // WithPickBuilder sets the pickBuilder for the client to build a Picker from
 // a list of Addr.
 func WithPickBuilder(p Builder) ClientOption {
@@ -114,6 +380,17 @@ func WithPickBuilder(p Builder) ClientOption {
 	}
 }
 
+// WithHashTag enables the hash tag in keys, which is delimited by open and close,
+// e.g. WithHashTag('{', '}'). If a key contains a non-empty hash tag, only the tag
+// is used to pick the server, so that "{user:123}:profile" and "{user:123}:settings"
+// are stored in the same server, and multi-key commands on them are sent to it
+// in one request. The keys without a hash tag are picked by the whole key.
+func WithHashTag(open, close byte) ClientOption {
+	return func(o *clientOptions) {
+		o.hashTag = &[2]byte{open, close}
+	}
+}
+
 // WithDialTimeout sets the dial timeout for the client.
 // Default is 5 seconds.
 func WithDialTimeout(timeout time.Duration) ClientOption {
@@ -138,6 +415,72 @@ func WithReadTimeout(timeout time.Duration) ClientOption {
 	}
 }
 
+// WithAdaptiveReadTimeout makes the read timeout of each memcached server adapt to
+// its recent latencies: the p99 latency multiplied by multiplier, bounded by
+// [minTimeout, maxTimeout].
+// A degraded server is detected by the timeout sooner than the static read timeout,
+// which is used until enough requests to the server are observed. The latencies are
+// measured from sending the request to receiving the response. The requests timed
+// out by the read timeout are observed as the censored samples at the timeout, so
+// that the timeout of a server getting slower grows rather than times out the
+// requests persistently.
+//
+// It does not apply to the multiplexing mode, whose requests queue on the shared
+// connections. The non-positive multiplier disables it.
+func WithAdaptiveReadTimeout(multiplier float64, minTimeout, maxTimeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if multiplier <= 0 {
+			o.adaptiveTimeout = false
+			return
+		}
+		if maxTimeout < minTimeout {
+			maxTimeout = minTimeout
+		}
+
+		o.adaptiveTimeout = true
+		o.adaptiveMultiplier = multiplier
+		o.adaptiveMinTimeout = minTimeout
+		o.adaptiveMaxTimeout = maxTimeout
+	}
+}
+
+// WithHedgedReads makes Get and MetaGet send the request again over another connection
+// to the same memcached server if it has not been replied within delay, and take the
+// first reply, which cuts the tail latency caused by a slow connection. The delay is
+// usually the p95 latency of the reads, so that about 5% of them are sent twice.
+//
+// MetaGet is not hedged if it modifies the item, e.g. with MetaGetFlagVivifyOnMiss.
+// The non-positive delay disables it.
+func WithHedgedReads(delay time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if delay < 0 {
+			delay = 0
+		}
+
+		o.hedgeDelay = delay
+	}
+}
+
+// WithDeadlineBudget splits the deadline of the context of each hedged read between
+// its attempts, rather than letting the first attempt consume the whole deadline
+// when its connection is slow. The first attempt takes firstShare of the remaining
+// time, e.g. 0.6, and the hedged attempt takes the rest. Each attempt takes at least
+// minAttempt, and the deadline is not split if it's shorter than two of them.
+//
+// The hedged attempt is sent at once if the first one runs out of its share before
+// the delay of WithHedgedReads. It has no effect without WithHedgedReads or without
+// the deadline of the context. The firstShare out of (0, 1) disables it.
+func WithDeadlineBudget(firstShare float64, minAttempt time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if firstShare <= 0 || firstShare >= 1 {
+			o.deadlineBudget = nil
+			return
+		}
+
+		o.deadlineBudget = &deadlineBudget{firstShare: firstShare, minAttempt: max(minAttempt, 0)}
+	}
+}
+
 // WithWriteTimeout sets the write timeout for the client.
 func WithWriteTimeout(timeout time.Duration) ClientOption {
 	return func(o *clientOptions) {
@@ -185,6 +528,78 @@ func WithMaxIdleTimeout(d time.Duration) ClientOption {
 	}
 }
 
+// WithWarmUp opens n connections to each memcached server into the pool when the
+// client is created, so that the first requests do not pay for dialing. n is bounded
+// by the max idle connections (see WithMaxIdleConns), and the warm-up is bounded by
+// the context of NewWithContext. It's best effort, the failures are ignored and the
+// connections are opened on demand as usual. It's not applied in multiplexing mode.
+func WithWarmUp(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.warmUpConns = max(n, 0)
+	}
+}
+
+// WithEagerConnect makes the client connect to each memcached server when it's created,
+// the connection is authenticated if WithSASL is set, and the server must reply the
+// version. The client fails to be created if any server could not be connected, the
+// error lists the error of each failed server as a CommandError, rather than the
+// failures surface at the first requests at runtime. The connection is kept in the
+// pool. The connecting is bounded by the context of NewWithContext.
+func WithEagerConnect() ClientOption {
+	return func(o *clientOptions) {
+		o.eagerConnect = true
+	}
+}
+
+// WithFailOpen makes the requests to the unavailable memcached servers fail open,
+// so that the outage of the cache does not fail the callers. A server is unavailable
+// if it could not be connected, or the connection to it fails or times out. The reads
+// (e.g. Get, Gets, MetaGet) and the arithmetic commands (e.g. Incr) fail with
+// ErrFailedOpen which is also an ErrNotFound, and the unconditional writes (Set,
+// Delete, Touch, and MetaSet and MetaDelete without comparing the CAS unique or
+// switching the mode) succeed as no-ops. The conditional writes, e.g. Add, Replace
+// and Cas, and the other commands, e.g. Version, Stats and FlushAll, fail as usual.
+//
+// The server which fails to connect is marked down for a second, during which the
+// requests to it fail open at once rather than wait for connecting. The requests
+// failed open are counted by PoolStats.FailedOpenRequests.
+func WithFailOpen() ClientOption {
+	return func(o *clientOptions) {
+		o.failOpen = true
+	}
+}
+
+// WithPoolShards stripes the connection pool of each memcached server over n shards,
+// each of them has its own lock, to reduce the contention on the lock of the pool at
+// high parallelism, e.g. dozens of goroutines sending requests to one server. A
+// request takes a connection from a random shard, the other shards are tried before
+// it waits, and the connection is put back to the shard it's taken from.
+//
+// The limits of WithMaxConns and WithMaxIdleConns are split over the shards, and n is
+// bounded by the max connections. Each shard holds one connection at least, so that
+// the limits updated by UpdateOptions are rounded up to n if they are smaller. The
+// callers waiting for a connection are served in order within each shard only. The
+// default is 1, which means the pool is not striped.
+func WithPoolShards(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.poolShards = max(n, 1)
+	}
+}
+
+// WithPoolWaitTimeout sets the max duration to wait for a connection when all
+// connections of the pool are busy, ErrPoolWaitTimeout is returned if no connection
+// is returned within the duration. It's distinct from the deadline of the context,
+// which limits the whole command. 0 means waiting until the context is done.
+func WithPoolWaitTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if d < 0 {
+			d = 0
+		}
+
+		o.poolWaitTimeout = d
+	}
+}
+
 // WithNoReply sets the flag to indicate whether the client should wait for the response.
 func WithNoReply() ClientOption {
 	return func(o *clientOptions) {
@@ -192,6 +607,51 @@ func WithNoReply() ClientOption {
 	}
 }
 
+// WithNoReplyVerify verifies the noreply requests of WithNoReply every n requests over
+// each connection, including the broadcast ones, e.g. FlushAll. A version command is
+// sent right after the n-th one, and the replies before VERSION are drained: they are
+// the errors of the noreply requests, e.g. CLIENT_ERROR of a bad command or
+// SERVER_ERROR out of memory, which the server replies even in noreply mode.
+//
+// Without it, the error lines are left in the connection and read by the following
+// requests as their replies. The first error drained by each verification is passed
+// to onError rather than returned, since it could be of any noreply request since the
+// last verification. n <= 0 disables it, and 1 verifies every noreply request.
+func WithNoReplyVerify(n int, onError func(addr *Addr, err error)) ClientOption {
+	return func(o *clientOptions) {
+		if n < 0 {
+			n = 0
+		}
+
+		o.noReplyVerifyEvery = n
+		o.noReplyErrorHandler = onError
+	}
+}
+
+// WithReadYourWrites makes the requests read the noreply writes of the same keys
+// by the client, e.g. a get following a set of WithNoReply or a meta set with
+// MetaSetFlagNoReply. The noreply writes are not acknowledged, so that a request
+// over another pooled connection could be processed by the server before them.
+//
+// The keys written by the noreply requests are tracked along with the connections
+// they're written over, and the next request of a dirty key waits until any reply
+// is received over that connection, or sends a version command over it as a fence
+// if it's idle. The multi-key retrievals wait for all the dirty keys of the server.
+// At most maxDirtyKeys keys are tracked, the noreply write beyond it is fenced at
+// once, so that it trades the latency of the writes for the memory. The requests
+// over WithConn don't wait, the ones in multiplexing mode or over UDP are not
+// tracked, and the writes by other clients are never waited. maxDirtyKeys <= 0
+// disables it.
+func WithReadYourWrites(maxDirtyKeys int) ClientOption {
+	return func(o *clientOptions) {
+		if maxDirtyKeys < 0 {
+			maxDirtyKeys = 0
+		}
+
+		o.readYourWrites = maxDirtyKeys
+	}
+}
+
 // WithSASL sets the SASL authentication for the client.
 // @Deprecated: since SASL is supported over binary protocol, but binary protocol is deprecated.
 func WithSASL(username, password string) ClientOption {
@@ -202,6 +662,112 @@ func WithSASL(username, password string) ClientOption {
 	}
 }
 
+// WithTCPKeepAlive sets the period of the TCP keepalive probes of the connections,
+// so that the connections broken silently, e.g. dropped by a NAT or a load balancer,
+// are detected. Negative means disabled, 0 means the default 15s.
+func WithTCPKeepAlive(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if d == 0 {
+			d = 15 * time.Second
+		}
+
+		o.tcpKeepAlive = d
+	}
+}
+
+// WithTCPNoDelay sets whether the TCP connections disable the Nagle's algorithm,
+// it's enabled by default so that the small requests are sent at once. Disabling
+// it could raise the throughput of the pipelined or the multiplexed requests at
+// the cost of the latency.
+func WithTCPNoDelay(noDelay bool) ClientOption {
+	return func(o *clientOptions) {
+		o.tcpNoDelay = noDelay
+	}
+}
+
+// WithSocketBuffers sets the sizes of the receive and the send socket buffers of
+// the connections in bytes, 0 means the OS default. The OS may round or cap them.
+func WithSocketBuffers(read, write int) ClientOption {
+	return func(o *clientOptions) {
+		if read < 0 {
+			read = 0
+		}
+		if write < 0 {
+			write = 0
+		}
+
+		o.socketReadBuffer = read
+		o.socketWriteBuffer = write
+	}
+}
+
+// WithConnBufferSizes sets the sizes of the reader and the writer buffers of each
+// connection in bytes, 0 means the default 4KB. The workloads of large values could
+// use 64-256KB buffers to read and write them with fewer syscalls, while the ones of
+// tiny values could shrink them to save the memory of each connection. The memory
+// taken by the buffers is reported by PoolStats.BufferedBytes.
+func WithConnBufferSizes(readerBytes, writerBytes int) ClientOption {
+	return func(o *clientOptions) {
+		if readerBytes <= 0 {
+			readerBytes = defaultConnBufferSize
+		}
+		if writerBytes <= 0 {
+			writerBytes = defaultConnBufferSize
+		}
+
+		o.connReaderSize = readerBytes
+		o.connWriterSize = writerBytes
+	}
+}
+
+// WithDialer sets the function to dial the connections to the memcached servers
+// instead of the net.Dialer, e.g. to route them through a SOCKS5 proxy, an SSH
+// tunnel or a service mesh sidecar. The dial timeout is applied to its context.
+// The golang.org/x/net/proxy dialers could be used as:
+//
+//	socks5, _ := proxy.SOCKS5("tcp", "127.0.0.1:1080", nil, proxy.Direct)
+//	memcached.WithDialer(socks5.(proxy.ContextDialer).DialContext)
+//
+// See HTTPConnectDialer for the HTTP proxies.
+func WithDialer(dialer DialFunc) ClientOption {
+	return func(o *clientOptions) {
+		o.dialer = dialer
+	}
+}
+
+// WithAddrOptions overrides the options of the client for the memcached server of
+// the address, which is the Addr.Address, e.g. "10.0.0.1:11211", so that the servers
+// of a heterogeneous cluster could have their own pool sizes, timeouts or credentials:
+//
+//	memcached.New("10.0.0.1:11211,10.0.0.2:11211,10.0.0.3:11211",
+//		memcached.WithMaxConns(20),
+//		memcached.WithAddrOptions("10.0.0.1:11211", memcached.WithMaxConns(200), memcached.WithReadTimeout(time.Second)))
+//
+// Only the options which could be given to UpdateOptions and WithSASL are supported,
+// New returns ErrInvalidArgument for the others. It could be given more than once
+// for the same address, the options are applied in order.
+func WithAddrOptions(address string, opts ...ClientOption) ClientOption {
+	return func(o *clientOptions) {
+		if o.addrOptions == nil {
+			o.addrOptions = make(map[string][]ClientOption, 2)
+		}
+
+		o.addrOptions[address] = append(o.addrOptions[address], opts...)
+	}
+}
+
+// WithProxyProtocol makes the client send the HAProxy PROXY protocol header of
+// the version right after connecting, before SASL and any command, which is
+// required by the load balancers configured to expect it in front of memcached.
+// The sourceAddr is the client address reported in the header, nil means the
+// local address of each connection. Only the TCP connections send it.
+func WithProxyProtocol(version ProxyProtocol, sourceAddr net.Addr) ClientOption {
+	return func(o *clientOptions) {
+		o.proxyProtocol = version
+		o.proxySourceAddr = sourceAddr
+	}
+}
+
 // WithUDPEnabled sets the UDP mode for the client.
 // Note: UDP mode would affect all connections to all servers, NOT ONLY the udp servers.
 func WithUDPEnabled() ClientOption {
@@ -218,6 +784,45 @@ func WithTelemetry(opts ...telemetry.Option) ClientOption {
 	}
 }
 
+// WithRequestHook adds hooks which are called after each request is finished,
+// e.g. to collect metrics of requests. It could be called multiple times, and
+// the hooks are called in the order they are added.
+func WithRequestHook(hooks ...RequestHook) ClientOption {
+	return func(o *clientOptions) {
+		for _, hook := range hooks {
+			if hook != nil {
+				o.requestHooks = append(o.requestHooks, hook)
+			}
+		}
+	}
+}
+
+// WithWireLogging writes the request and response lines of every command on the
+// wire to the logger, see WireLogger for more details. The logger could be
+// toggled at runtime, and shared by multiple clients.
+func WithWireLogging(l *WireLogger) ClientOption {
+	return func(o *clientOptions) {
+		o.wireLogger = l
+	}
+}
+
+// WithProtocolErrorCapture keeps the last n malformed responses, i.e. the ones failed
+// with ErrMalformedResponse, with the requests they're replied to, so that they
+// could be retrieved by LastProtocolErrors and attached to the bug reports without
+// capturing packets. The lines are printed both escaped and in hex by
+// ProtocolError.String. 0 means disabled.
+//
+// NOTE: the values are captured too, up to 1KB each.
+func WithProtocolErrorCapture(n int) ClientOption {
+	return func(o *clientOptions) {
+		if n < 0 {
+			n = 0
+		}
+
+		o.protocolErrorCapture = n
+	}
+}
+
 // WithCodec sets the codec used to transform value and flags.
 func WithCodec(codec Codec) ClientOption {
 	return func(o *clientOptions) {
@@ -227,3 +832,255 @@ func WithCodec(codec Codec) ClientOption {
 		o.codec = codec
 	}
 }
+
+// WithValueTransformer transforms the values of all the storage and retrieval
+// commands, including the meta ones, by encrypt before they're written and by
+// decrypt after they're read, e.g. to encrypt the values at rest by AESGCMKeyring.
+// The values are transformed after encoded by the codec, i.e. after compressed,
+// and before the checksum is appended.
+//
+// All clients sharing the keys should set the same transformer. Append, Prepend
+// and the streaming commands are not supported, and the counters of Incr/Decr
+// should not be set with it. Either nil function disables it.
+func WithValueTransformer(encrypt, decrypt func([]byte) ([]byte, error)) ClientOption {
+	return func(o *clientOptions) {
+		if encrypt == nil || decrypt == nil {
+			o.transformer = nil
+			return
+		}
+
+		o.transformer = &valueTransformer{encrypt: encrypt, decrypt: decrypt}
+	}
+}
+
+// WithChecksum appends the checksum of the algorithm to the values written, and
+// verifies it when they are read, so that the values corrupted by a misbehaving
+// proxy or server are reported as ErrChecksumMismatch rather than returned. The
+// checksum is computed over the value encoded by the codec.
+//
+// All clients sharing the keys should enable it, the values without checksum are
+// reported as ErrChecksumMismatch too. Append, Prepend and the streaming commands
+// are not supported, and the counters of Incr/Decr should not be set with it. The
+// values of MetaArithmetic and Counter are not checksummed.
+func WithChecksum(algorithm Checksum) ClientOption {
+	return func(o *clientOptions) {
+		if algorithm.size() == 0 {
+			algorithm = ChecksumNone
+		}
+
+		o.checksum = algorithm
+	}
+}
+
+// WithFlagsPolicy makes the writes check their caller-facing flags by the policy
+// before encoded by the codec, the flags which set the bits not reserved by the
+// policy are rejected with ErrInvalidArgument, so that the bits of the application
+// and the serializers are never clobbered by a mistake.
+func WithFlagsPolicy(policy *memcodec.FlagsPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.flagsPolicy = policy
+	}
+}
+
+// WithCompatibility sets the compatibility mode for the client. Different from
+// memcached, servers like Dragonfly and proxies like twemproxy do not support
+// some commands, the compatibility mode makes the client adjust its behaviors:
+// meta commands and unsupported gat/gats report ErrNotSupported, multi-key
+// retrieval falls back to one request per key and error lines are parsed leniently.
+func WithCompatibility(mode Compatibility) ClientOption {
+	return func(o *clientOptions) {
+		o.compatibility = mode
+	}
+}
+
+// WithCASParsing sets how the CAS uniques replied by the server are parsed, default
+// is CASParsingAuto by the compatibility mode. Some memcached-compatible servers
+// reply CAS uniques which overflow 64 bits or are in other formats, they fail the
+// commands with *CASParseError by CASParsingStrict, or are read as 0 by
+// CASParsingLenient, so that the items are still returned. The items read with
+// CAS 0 could not be written by CasItem, Update or MetaUpdate.
+func WithCASParsing(mode CASParsing) ClientOption {
+	return func(o *clientOptions) {
+		o.casParsing = mode
+	}
+}
+
+// WithGetAndTouchFallback enables or disables the fallback of multi-key gat/gats, it's
+// disabled by default. Some servers (e.g. Dragonfly) reply an error to gat/gats with
+// multiple keys, when the fallback is enabled, the keys sent to such a server are
+// retried one by one and the server is remembered for 10 minutes, so that the
+// following gat/gats are sent key by key to it directly. Only the rejection of the
+// command (ERROR or CLIENT_ERROR bad command line format) triggers the fallback. It's useful when the kind of servers is
+// unknown or mixed in cluster mode, otherwise WithCompatibility is preferred.
+func WithGetAndTouchFallback(enabled bool) ClientOption {
+	return func(o *clientOptions) {
+		o.getAndTouchFallback = enabled
+	}
+}
+
+// defaultMultiKeyMaxBytes is the default max bytes of the keys of each request of
+// the multi-key retrievals, see WithMultiKeyLimits.
+const defaultMultiKeyMaxBytes = 64 * 1024
+
+// WithMultiKeyLimits bounds the keys of each request of the multi-key retrievals,
+// e.g. Gets and GetAndTouches, by the number of keys and the bytes of the keys
+// (with the spaces between them) in the command line, 0 means no limit. The keys
+// beyond the limits are split into more requests which are sent to the server one
+// by one, and the items are merged, so that the command line never exceeds the
+// limits of the server or the proxy. By default, only the bytes are limited to 64KB.
+func WithMultiKeyLimits(maxKeys, maxBytes int) ClientOption {
+	return func(o *clientOptions) {
+		o.multiKeyMaxKeys = max(maxKeys, 0)
+		o.multiKeyMaxBytes = max(maxBytes, 0)
+	}
+}
+
+// WithCapabilityDetection enables or disables the capability detection, it's enabled by default.
+// The client queries the version of each memcached server by the first connection to it,
+// and the commands which are not supported by the server (e.g. meta commands before 1.6.0)
+// fail with ErrNotSupported instead of a malformed response.
+func WithCapabilityDetection(enabled bool) ClientOption {
+	return func(o *clientOptions) {
+		o.capabilityDetection = enabled
+	}
+}
+
+// WithStaleConnReplay enables or disables the replay of the requests failed by stale
+// connections, it's enabled by default. A pooled connection may have been closed by
+// the server while idle (e.g. by its idle timeout or restart), the request over it
+// fails with "broken pipe", "connection reset" or EOF before any reply. When enabled,
+// such a connection is discarded, and the idempotent requests (e.g. get, gets, set,
+// touch and mg without vivifying) are sent again over a new connection once, the
+// others (e.g. add, delete, incr and append) fail as before, since they may have
+// been executed by the server.
+func WithStaleConnReplay(enabled bool) ClientOption {
+	return func(o *clientOptions) {
+		o.staleConnReplay = enabled
+	}
+}
+
+// WithLivenessCheck checks whether the connections idle longer than idle are alive
+// before they are taken out of the pool, the dead ones are closed and counted in
+// PoolStats, so that the requests are not burned on them. 0 disables the check, and
+// it's disabled by default. ProbePoll costs nearly nothing but only detects the
+// connections closed or reset, while ProbeNoOp costs a round trip to the server for
+// each check. The smaller idle is, the more connections are checked.
+//
+// The TCP keepalive (see WithTCPKeepAlive) detects the dead peers in the background,
+// but it takes minutes for the kernel to give up, the liveness check detects the
+// connections closed by the server (e.g. by its idle timeout or restart) at once.
+func WithLivenessCheck(idle time.Duration, probe LivenessProbe) ClientOption {
+	return func(o *clientOptions) {
+		if idle < 0 {
+			idle = 0
+		}
+
+		o.livenessIdle = idle
+		o.livenessProbe = probe
+	}
+}
+
+// WithMaxItemSize sets the max size of an item stored by the client in bytes, the
+// storage commands (e.g. Set, Cas, MetaSet and SetReader) of the larger items fail
+// with ErrValueTooLarge before sent, rather than wasting a round trip to be rejected
+// by the server. The size of an item is counted as memcached does approximately: the
+// item header, the key, and the value encoded by the codec. See DetectMaxItemSize to
+// detect the limit of each memcached server, the limit is disabled by default.
+//
+// The commands pipelined in batches, e.g. by Async, are not checked, and append and
+// prepend are checked by the size of the value given rather than the whole item.
+func WithMaxItemSize(size int) ClientOption {
+	return func(o *clientOptions) {
+		if size < 0 && size != DetectMaxItemSize {
+			size = 0
+		}
+
+		o.maxItemSize = size
+	}
+}
+
+// WithAutoTune makes the client configure its guards by the settings of each
+// memcached server, which are queried by `stats settings` over the first connection
+// to it:
+//   - the max item size is detected from item_size_max, as DetectMaxItemSize does,
+//     unless it's set by WithMaxItemSize explicitly.
+//   - with WithUDPEnabled, the requests are sent in UDP datagrams only to the servers
+//     listening on UDP and reached over UDP, rather than to all of them.
+//
+// The servers other than memcached and the ones reached over UDP are not tuned. See
+// Client.StatsSettings to query the settings.
+func WithAutoTune() ClientOption {
+	return func(o *clientOptions) {
+		o.autoTune = true
+	}
+}
+
+// WithMultiplexing enables the multiplexing mode, which shares connsPerNode
+// connections to each memcached server among all requests instead of the
+// connection pool. Requests are pipelined over the connections and the responses
+// are correlated by the order, which reduces the connection count dramatically
+// while keeping the throughput.
+//
+// The noreply mode and UDP are not supported in multiplexing mode. Broadcast
+// commands (e.g. FlushAll) and streaming commands (GetReader and SetReader) still
+// use the connection pool.
+func WithMultiplexing(connsPerNode int) ClientOption {
+	return func(o *clientOptions) {
+		if connsPerNode <= 0 {
+			connsPerNode = 1
+		}
+
+		o.multiplexConns = connsPerNode
+	}
+}
+
+// defaultCoalesceMaxBatch is the max number of requests coalesced into one flush
+// if it's not set by WithWriteCoalescing.
+const defaultCoalesceMaxBatch = 16
+
+// WithWriteCoalescing coalesces the writes of the requests on each multiplexed
+// connection into one flush, so that several small requests cost one syscall,
+// which raises the throughput of high-QPS workloads of small requests. After a
+// request is queued, the writer waits up to window for more requests, and flushes
+// once maxBatch requests are buffered or the window ends. The requests queued
+// already are always coalesced without waiting, a zero window means only them.
+// The window adds up to its duration to the latency of the requests at low load.
+// maxBatch defaults to 16 if it's not positive.
+//
+// It only applies to the multiplexing mode, see WithMultiplexing.
+func WithWriteCoalescing(window time.Duration, maxBatch int) ClientOption {
+	return func(o *clientOptions) {
+		if maxBatch <= 0 {
+			maxBatch = defaultCoalesceMaxBatch
+		}
+
+		o.coalesceWindow = max(window, 0)
+		o.coalesceMaxBatch = maxBatch
+	}
+}
+
+// WithClock sets the Clock telling the current time to the client, so that the tests
+// of the code depending on the time could move it without sleeping, e.g. by the
+// memcachedtest.FakeClock. It's used by:
+//
+//   - the connection pools, to age the connections by WithMaxLifetime, WithMaxIdleTimeout
+//     and WithLivenessCheck.
+//   - the adaptive timeouts, to measure the latencies of the requests.
+//   - SoftTTL, to stamp and check the logical expiry of the values.
+//   - Mutex and Counter, to convert the ttl longer than 30 days into an absolute Unix timestamp.
+//   - Namespaces, to initialize the versions and expire the cached ones.
+//   - ScheduleFlush and ScheduledFlushes, to time the scheduled flushes.
+//   - WithFailOpen, to cool down the servers marked down.
+//   - StatsDelta and MetaDebugEach, to stamp the rates and age the items.
+//
+// The deadlines of the network I/O and the contexts always follow the wall clock.
+// nil means the wall clock, which is the default.
+func WithClock(clock Clock) ClientOption {
+	return func(o *clientOptions) {
+		if clock == nil {
+			clock = systemClock{}
+		}
+
+		o.clock = clock
+	}
+}
@@ -0,0 +1,250 @@
+package memcached
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errPoolExhausted is returned by connPool.tryGet if the pool is full.
+var errPoolExhausted = errors.New("connection pool exhausted")
+
+// shardedPool stripes the connections to one memcached server over the shards,
+// each of them is a connPool with its own lock, so that the concurrent callers
+// contend for the lock of a random shard rather than one lock, see WithPoolShards.
+//
+// The limits of the pool are split over the shards, and the connection is put
+// back to the shard it's taken from. A caller takes a connection from a random
+// shard, and tries the other shards if it's full. If all shards are full, the
+// caller waits until any shard has an idle connection or a free slot, so that
+// it never waits while another shard could serve it. The callers waiting are
+// not served in order.
+type shardedPool struct {
+	shards []*connPool
+
+	// waiting is the number of callers waiting for a connection, the shards wake
+	// them up only if it's not zero.
+	waiting atomic.Int32
+
+	mu sync.Mutex // guards following
+	// wake is closed to wake up the waiters, and replaced by a new one.
+	wake         chan struct{}
+	waitTimeout  time.Duration
+	waitCount    int64
+	waitDuration time.Duration
+}
+
+// newShardedPool creates the pool of n shards, n is bounded by maxConns so that
+// each shard holds one connection at least.
+func newShardedPool(
+	n, maxIdle, maxConns int,
+	maxLifeTime, maxIdleTime time.Duration,
+	createConn func(ctx context.Context) (memcachedConn, error),
+) *shardedPool {
+	n = max(1, min(n, maxConns))
+
+	p := &shardedPool{
+		shards: make([]*connPool, n),
+		wake:   make(chan struct{}),
+	}
+	for i := range p.shards {
+		p.shards[i] = newConnPool(shareOf(maxIdle, n, i), shareOf(maxConns, n, i), maxLifeTime, maxIdleTime, createConn)
+		if n > 1 {
+			p.shards[i].notify = p.notify
+		}
+	}
+
+	return p
+}
+
+// shareOf returns the share of the i-th shard when the limit is split over n
+// shards, it's one at least if the pool is striped.
+func shareOf(limit, n, i int) int {
+	if n == 1 {
+		return limit
+	}
+
+	share := limit / n
+	if i < limit%n {
+		share++
+	}
+
+	return max(1, share)
+}
+
+// get takes a connection from a random shard, see shardedPool. The pool of one
+// shard is used as is, the callers waiting are served in order.
+func (p *shardedPool) get(ctx context.Context) (memcachedConn, error) {
+	if len(p.shards) == 1 {
+		return p.shards[0].get(ctx)
+	}
+
+	cn, err := p.tryGet(ctx)
+	if !errors.Is(err, errPoolExhausted) {
+		return cn, err
+	}
+
+	return p.wait(ctx)
+}
+
+// tryGet tries the shards from a random one, it fails with errPoolExhausted if
+// all of them are full.
+func (p *shardedPool) tryGet(ctx context.Context) (memcachedConn, error) {
+	start := rand.IntN(len(p.shards))
+	for i := range p.shards {
+		cn, err := p.shards[(start+i)%len(p.shards)].tryGet(ctx)
+		if !errors.Is(err, errPoolExhausted) {
+			return cn, err
+		}
+	}
+
+	return nil, errPoolExhausted
+}
+
+// wait waits until any shard could serve the caller.
+func (p *shardedPool) wait(ctx context.Context) (memcachedConn, error) {
+	// count the waiter before trying the shards, so that the connection put back
+	// after the trying wakes it up.
+	p.waiting.Add(1)
+	defer p.waiting.Add(-1)
+
+	p.mu.Lock()
+	p.waitCount++
+	waitTimeout := p.waitTimeout
+	p.mu.Unlock()
+
+	start := nowFunc()
+	defer func() {
+		p.mu.Lock()
+		p.waitDuration += nowFunc().Sub(start)
+		p.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if waitTimeout > 0 {
+		timer := time.NewTimer(waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		p.mu.Lock()
+		wake := p.wake
+		p.mu.Unlock()
+
+		cn, err := p.tryGet(ctx)
+		if !errors.Is(err, errPoolExhausted) {
+			return cn, err
+		}
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, errors.Wrapf(ErrPoolWaitTimeout, "waited %s", waitTimeout)
+		}
+	}
+}
+
+// notify wakes up the waiters if any, it's called by the shards.
+func (p *shardedPool) notify() {
+	if p.waiting.Load() == 0 {
+		return
+	}
+
+	p.broadcast()
+}
+
+// broadcast wakes up all waiters.
+func (p *shardedPool) broadcast() {
+	p.mu.Lock()
+	close(p.wake)
+	p.wake = make(chan struct{})
+	p.mu.Unlock()
+}
+
+func (p *shardedPool) close() error {
+	for _, shard := range p.shards {
+		_ = shard.close()
+	}
+	// the waiters would find the shards are closed.
+	p.broadcast()
+
+	return nil
+}
+
+// setWaitTimeout sets the max duration to wait for a connection.
+func (p *shardedPool) setWaitTimeout(d time.Duration) {
+	p.mu.Lock()
+	p.waitTimeout = d
+	p.mu.Unlock()
+
+	for _, shard := range p.shards {
+		shard.waitTimeout = d
+	}
+}
+
+// setLiveness sets the liveness check of each shard.
+func (p *shardedPool) setLiveness(l *livenessCheck) {
+	for _, shard := range p.shards {
+		shard.liveness = l
+	}
+}
+
+// setClock sets the clock aging the connections of each shard.
+func (p *shardedPool) setClock(now nowFuncType) {
+	for _, shard := range p.shards {
+		shard.now = now
+	}
+}
+
+// resize splits the new limits over the shards, see connPool.resize. The waiters
+// are woken up to take the new slots if the pool grows.
+func (p *shardedPool) resize(
+	maxIdle, maxConns int,
+	maxLifeTime, maxIdleTime, waitTimeout time.Duration,
+) {
+	p.mu.Lock()
+	p.waitTimeout = waitTimeout
+	p.mu.Unlock()
+
+	n := len(p.shards)
+	for i, shard := range p.shards {
+		shard.resize(shareOf(maxIdle, n, i), shareOf(maxConns, n, i), maxLifeTime, maxIdleTime, waitTimeout)
+	}
+	if n > 1 {
+		p.notify()
+	}
+}
+
+// stats sums up the statistics of the shards.
+func (p *shardedPool) stats() *PoolStats {
+	s := &PoolStats{}
+	for _, shard := range p.shards {
+		ss := shard.stats()
+		s.TotalConns += ss.TotalConns
+		s.IdleConns += ss.IdleConns
+		s.MaxConns += ss.MaxConns
+		s.MaxIdle += ss.MaxIdle
+		s.WaitCount += ss.WaitCount
+		s.WaitDuration += ss.WaitDuration
+		s.Waiting += ss.Waiting
+		s.MaxIdleClosed += ss.MaxIdleClosed
+		s.MaxIdleTimeClosed += ss.MaxIdleTimeClosed
+		s.MaxLifeTimeClosed += ss.MaxLifeTimeClosed
+		s.DeadClosed += ss.DeadClosed
+	}
+
+	p.mu.Lock()
+	s.WaitCount += p.waitCount
+	s.WaitDuration += p.waitDuration
+	p.mu.Unlock()
+	s.Waiting += int(p.waiting.Load())
+
+	return s
+}
@@ -0,0 +1,269 @@
+package memcached
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_shareOf(t *testing.T) {
+	tests := []struct {
+		limit, n int
+		want     []int
+	}{
+		{limit: 10, n: 1, want: []int{10}},
+		{limit: 10, n: 4, want: []int{3, 3, 2, 2}},
+		{limit: 8, n: 4, want: []int{2, 2, 2, 2}},
+		// each shard holds one at least.
+		{limit: 2, n: 4, want: []int{1, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		got := make([]int, 0, tt.n)
+		for i := 0; i < tt.n; i++ {
+			got = append(got, shareOf(tt.limit, tt.n, i))
+		}
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func Test_shardedPool_limits(t *testing.T) {
+	pool := newShardedPool(4, 4, 6, 0, 0, createConn)
+	defer pool.close()
+
+	stats := pool.stats()
+	assert.Equal(t, 6, stats.MaxConns)
+	assert.Equal(t, 4, stats.MaxIdle)
+
+	// the shards are bounded by the max connections.
+	assert.Len(t, newShardedPool(8, 2, 2, 0, 0, createConn).shards, 2)
+
+	// all connections could be taken without waiting, whichever shard is picked.
+	conns := make([]memcachedConn, 0, 6)
+	for i := 0; i < 6; i++ {
+		cn, err := pool.get(context.Background())
+		require.NoError(t, err)
+		conns = append(conns, cn)
+	}
+	assert.Equal(t, 6, pool.stats().TotalConns)
+	assert.Equal(t, int64(0), pool.stats().WaitCount)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := pool.get(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(1), pool.stats().WaitCount)
+
+	// the connections are put back to the shards they are taken from.
+	for _, cn := range conns {
+		require.NoError(t, cn.getConnPool().put(cn))
+	}
+	stats = pool.stats()
+	assert.Equal(t, 4, stats.IdleConns)
+	assert.Equal(t, 4, stats.TotalConns)
+	assert.Equal(t, int64(2), stats.MaxIdleClosed)
+}
+
+func Test_shardedPool_wait(t *testing.T) {
+	pool := newShardedPool(4, 4, 4, 0, 0, createConn)
+	defer pool.close()
+
+	conns := make([]memcachedConn, 0, 4)
+	for i := 0; i < 4; i++ {
+		cn, err := pool.get(context.Background())
+		require.NoError(t, err)
+		conns = append(conns, cn)
+	}
+
+	// the waiter is woken up by the connection put back to any shard.
+	for _, cn := range conns {
+		done := make(chan memcachedConn, 1)
+		go func() {
+			got, err := pool.get(context.Background())
+			assert.NoError(t, err)
+			done <- got
+		}()
+		require.Eventually(t, func() bool { return pool.stats().Waiting == 1 }, time.Second, time.Millisecond)
+
+		require.NoError(t, cn.getConnPool().put(cn))
+		select {
+		case got := <-done:
+			assert.Same(t, cn, got)
+		case <-time.After(time.Second):
+			t.Fatal("waiter is not woken up")
+		}
+	}
+
+	// and by the slot released.
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.get(context.Background())
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return pool.stats().Waiting == 1 }, time.Second, time.Millisecond)
+	conns[0].getConnPool().discard(conns[0])
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter is not woken up")
+	}
+
+	// and by closing.
+	go func() {
+		_, err := pool.get(context.Background())
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return pool.stats().Waiting == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.close())
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter is not woken up")
+	}
+}
+
+func Test_shardedPool_waitTimeout(t *testing.T) {
+	pool := newShardedPool(2, 2, 2, 0, 0, createConn)
+	pool.setWaitTimeout(20 * time.Millisecond)
+	defer pool.close()
+
+	for i := 0; i < 2; i++ {
+		_, err := pool.get(context.Background())
+		require.NoError(t, err)
+	}
+	_, err := pool.get(context.Background())
+	require.ErrorIs(t, err, ErrPoolWaitTimeout)
+}
+
+func Test_shardedPool_resize(t *testing.T) {
+	pool := newShardedPool(2, 2, 2, 0, 0, createConn)
+	defer pool.close()
+
+	for i := 0; i < 2; i++ {
+		_, err := pool.get(context.Background())
+		require.NoError(t, err)
+	}
+
+	// the waiter takes over the new slot.
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.get(context.Background())
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return pool.stats().Waiting == 1 }, time.Second, time.Millisecond)
+
+	pool.resize(4, 4, 0, 0, 0)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter is not woken up")
+	}
+	assert.Equal(t, 4, pool.stats().MaxConns)
+}
+
+// Test_shardedPool_stress takes and puts back the connections concurrently, the
+// connections in use must never exceed the max connections.
+func Test_shardedPool_stress(t *testing.T) {
+	const maxConns = 8
+	pool := newShardedPool(4, 4, maxConns, 0, 0, createConn)
+	defer pool.close()
+
+	inUse := atomic.Int32{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				cn, err := pool.get(context.Background())
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.LessOrEqual(t, inUse.Add(1), int32(maxConns))
+				runtime.Gosched()
+				inUse.Add(-1)
+
+				if j%10 == 0 {
+					cn.getConnPool().discard(cn)
+					continue
+				}
+				assert.NoError(t, cn.getConnPool().put(cn))
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := pool.stats()
+	assert.LessOrEqual(t, stats.TotalConns, maxConns)
+	assert.Equal(t, 0, stats.Waiting)
+}
+
+func Test_client_poolShards(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithPoolShards(4), WithMaxConns(8), WithMaxIdleConns(8))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := "key-" + strconv.Itoa(i)
+			assert.NoError(t, c.Set(ctx, key, []byte("value"), 0, 0))
+			item, err := c.Get(ctx, key)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "value", string(item.Value))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.PoolStats()[srv.Addr()]
+	require.NotNil(t, stats)
+	assert.Equal(t, 8, stats.MaxConns)
+	assert.LessOrEqual(t, stats.TotalConns, 8)
+}
+
+// Benchmark_shardedPool takes and puts back the connections by 64 goroutines or
+// more, the contention on the lock of the pool drops as the shards grow.
+//
+// go test -run=^$ -bench=Benchmark_shardedPool -cpu=8
+func Benchmark_shardedPool(b *testing.B) {
+	for _, goroutines := range []int{64, 256} {
+		for _, shards := range []int{1, 4, 16} {
+			b.Run("goroutines="+strconv.Itoa(goroutines)+"/shards="+strconv.Itoa(shards), func(b *testing.B) {
+				pool := newShardedPool(shards, 64, 64, 0, 0, createConn)
+				defer pool.close()
+
+				b.ReportAllocs()
+				b.SetParallelism(max(1, goroutines/runtime.GOMAXPROCS(0)))
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					ctx := context.Background()
+					for pb.Next() {
+						cn, err := pool.get(ctx)
+						if err != nil {
+							b.Error(err)
+							return
+						}
+						_ = cn.getConnPool().put(cn)
+					}
+				})
+			})
+		}
+	}
+}
@@ -2,12 +2,15 @@ package memcached
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/json"
 	"log"
 	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
+
+	memcodec "github.com/yeqown/memcached/codec"
 )
 
 // Codec transforms value and flags at the protocol boundary.
@@ -22,6 +25,8 @@ type Codec interface {
 	// Decode transforms a value and raw 32-bit client flags after retrieval.
 	Decode(key, value []byte, flag uint32) (decodedValue []byte, decodedFlags uint32, err error)
 	// SupportsOperation reports whether the codec can preserve semantics for an operation.
+	// The operation is the command name, or "stream" for GetReader and SetReader which
+	// transfer values without buffering them.
 	SupportsOperation(operation string) error
 }
 
@@ -32,6 +37,21 @@ func checkCodecSupportsOperation(codec Codec, operation string) error {
 	return nil
 }
 
+// flagsPolicyCodec checks the flags by the policy before encoding them by Codec.
+type flagsPolicyCodec struct {
+	Codec
+
+	policy *memcodec.FlagsPolicy
+}
+
+func (c flagsPolicyCodec) Encode(key, value []byte, flag uint32) ([]byte, uint32, error) {
+	if err := c.policy.Check(flag); err != nil {
+		return nil, 0, errors.Wrap(ErrInvalidArgument, err.Error())
+	}
+
+	return c.Codec.Encode(key, value, flag)
+}
+
 // Item represents a key-value pair to be got or stored.
 type Item struct {
 	Key   string
@@ -53,6 +73,65 @@ func (i *Item) String() string {
 		"}"
 }
 
+// StoreResult is the outcome of a storage command (set, add, replace, append,
+// prepend and cas) replied by the memcached server.
+type StoreResult uint8
+
+const (
+	// StoreResultFailed means the command failed before the server replied an outcome,
+	// such as a network error or a server error.
+	StoreResultFailed StoreResult = iota
+	// StoreResultStored means the item has been stored.
+	StoreResultStored
+	// StoreResultNotStored means the condition of add, replace, append or prepend is not met.
+	StoreResultNotStored
+	// StoreResultExists means the item has been modified since the cas value was fetched.
+	StoreResultExists
+	// StoreResultNotFound means the item of cas does not exist.
+	StoreResultNotFound
+)
+
+func (r StoreResult) String() string {
+	switch r {
+	case StoreResultStored:
+		return "STORED"
+	case StoreResultNotStored:
+		return "NOT_STORED"
+	case StoreResultExists:
+		return "EXISTS"
+	case StoreResultNotFound:
+		return "NOT_FOUND"
+	default:
+		return "FAILED"
+	}
+}
+
+// StoreResultOf converts the error returned by a storage command into its StoreResult,
+// for the callers that don't treat the outcomes like Add on an existing key as
+// exceptional. The returned error is nil unless the command failed:
+//
+//	result, err := memcached.StoreResultOf(client.Add(ctx, "foo", value, 0, 0))
+//	if err != nil {
+//		return err
+//	}
+//	if result == memcached.StoreResultNotStored {
+//		// "foo" already exists.
+//	}
+func StoreResultOf(err error) (StoreResult, error) {
+	switch {
+	case err == nil:
+		return StoreResultStored, nil
+	case errors.Is(err, ErrNotStored):
+		return StoreResultNotStored, nil
+	case errors.Is(err, ErrExists):
+		return StoreResultExists, nil
+	case errors.Is(err, ErrNotFound):
+		return StoreResultNotFound, nil
+	default:
+		return StoreResultFailed, err
+	}
+}
+
 // MetaItem represents a key-value pair with meta information.
 type MetaItem struct {
 	Key   []byte
@@ -104,6 +183,9 @@ func (m *MetaItem) String() string {
 //	fetch = whether an item has been fetched before
 //	cls   = slab class id
 //	size  = total size in bytes
+//
+// The key is decoded from the response, base64 encoded or URL-encoded keys are
+// returned as their original bytes.
 type MetaItemDebug struct {
 	Key            []byte // key
 	TTL            int64  // exp, expiration time in seconds, -1 means never expire
@@ -114,23 +196,41 @@ type MetaItemDebug struct {
 	Size           uint64 // size
 }
 
+func (m *MetaItemDebug) String() string {
+	return "MetaItemDebug{" +
+		"Key:" + string(m.Key) +
+		" TTL:" + strconv.FormatInt(m.TTL, 10) +
+		" LastAccessTime:" + strconv.FormatInt(m.LastAssessTime, 10) +
+		" CAS:" + strconv.FormatUint(m.CAS, 10) +
+		" HitBefore:" + strconv.FormatBool(m.HitBefore) +
+		" SlabClassID:" + strconv.FormatUint(m.SlabClassID, 10) +
+		" Size:" + strconv.FormatUint(m.Size, 10) +
+		"}"
+}
+
 func buildVersionCommand() (*request, *response) {
 	req := buildRequest([]byte("version"), nil, []byte("version\r\n"))
 	resp := buildLimitedLineResponse(1)
 	return req, resp
 }
 
-func buildFlushAllCommand(noReply bool) (*request, *response) {
-	req := buildRequest([]byte("flush_all"), nil, []byte("flush_all\r\n"))
+// buildFlushAllCommand constructs flush_all command, the items are flushed after
+// the delay if it's not NoExpiration.
+//
+// flush_all [delay] [noreply]\r\n
+func buildFlushAllCommand(delay Expiration, noReply bool) (*request, *response) {
+	line := "flush_all"
+	if delay != NoExpiration {
+		line += " " + strconv.FormatInt(int64(delay), 10)
+	}
 
-	var resp *response
 	if noReply {
-		resp = buildNoReplyResponse()
-	} else {
-		resp = buildLimitedLineResponse(1)
+		req := buildRequest([]byte("flush_all"), nil, []byte(line+" noreply\r\n"))
+		return req, buildNoReplyResponse()
 	}
 
-	return req, resp
+	req := buildRequest([]byte("flush_all"), nil, []byte(line+"\r\n"))
+	return req, buildLimitedLineResponse(1)
 }
 
 // buildStorageCommand constructs storage class command, including:
@@ -143,7 +243,7 @@ func buildStorageCommand(
 	command, key string,
 	value []byte,
 	flags uint32,
-	exptime time.Duration,
+	exptime Expiration,
 	noReply bool,
 	codec Codec,
 ) (*request, *response, error) {
@@ -159,10 +259,10 @@ func buildStorageCommand(
 
 	b := newProtocolBuilder().
 		AddString(command).
-		AddString(key).                     // key
-		AddUint(uint64(eflags)).            // flags
-		AddUint(uint64(exptime.Seconds())). // exptime
-		AddInt(len(evalue))                 // bytes
+		AddString(key).          // key
+		AddUint(uint64(eflags)). // flags
+		AddInt(int(exptime)).    // exptime
+		AddInt(len(evalue))      // bytes
 	defer b.release()
 
 	if noReply {
@@ -175,6 +275,7 @@ func buildStorageCommand(
 		build()
 
 	req := buildRequest([]byte(command), []byte(key), raw)
+	req.itemSize = itemSize(len(key), len(evalue))
 
 	var resp *response
 	if noReply {
@@ -210,11 +311,11 @@ func buildDeleteCommand(key string, noReply bool) (*request, *response) {
 }
 
 // touch <key> <exptime> [noreply]\r\n
-func buildTouchCommand(key string, expTime time.Duration, noReply bool) (*request, *response) {
+func buildTouchCommand(key string, expTime Expiration, noReply bool) (*request, *response) {
 	b := newProtocolBuilder().
 		AddString("touch").
 		AddString(key).
-		AddUint(uint64(expTime.Seconds()))
+		AddInt(int(expTime))
 	defer b.release()
 
 	if noReply {
@@ -235,7 +336,7 @@ func buildTouchCommand(key string, expTime time.Duration, noReply bool) (*reques
 
 // cas <key> <flag> <exptime> <bytes> <cas unique> [noreply]\r\n
 func buildCasCommand(
-	key string, value []byte, flag uint32, expTime time.Duration, casUnique uint64, noReply bool, codec Codec,
+	key string, value []byte, flag uint32, expTime Expiration, casUnique uint64, noReply bool, codec Codec,
 ) (*request, *response, error) {
 	if err := checkCodecSupportsOperation(codec, "cas"); err != nil {
 		return nil, nil, errors.Wrap(err, "codec does not support operation")
@@ -247,12 +348,12 @@ func buildCasCommand(
 	}
 
 	b := newProtocolBuilder().
-		AddString("cas").                   // command
-		AddString(key).                     // key
-		AddUint(uint64(eflag)).             // flags
-		AddUint(uint64(expTime.Seconds())). // exptime
-		AddInt(len(evalue)).                // bytes
-		AddUint(casUnique)                  // cas unique
+		AddString("cas").       // command
+		AddString(key).         // key
+		AddUint(uint64(eflag)). // flags
+		AddInt(int(expTime)).   // exptime
+		AddInt(len(evalue)).    // bytes
+		AddUint(casUnique)      // cas unique
 	defer b.release()
 
 	if noReply {
@@ -265,6 +366,7 @@ func buildCasCommand(
 		build()
 
 	req := buildRequest([]byte("cas"), []byte(key), raw)
+	req.itemSize = itemSize(len(key), len(evalue))
 
 	var resp *response
 	if noReply {
@@ -288,7 +390,7 @@ func buildGetsCommand(command string, keys ...string) (*request, *response) {
 	}
 	b.AddCRLF()
 
-	req := buildRequest([]byte(command), nil, b.build())
+	req := buildRequest([]byte(command), routingKey(keys), b.build())
 	resp := buildSpecEndLineResponse(_EndCRLFBytes, len(keys)*2+1)
 
 	return req, resp
@@ -296,10 +398,10 @@ func buildGetsCommand(command string, keys ...string) (*request, *response) {
 
 // buildGetAndTouchCommand constructs get and touch command.
 // gat/gats <exptime> <key>*\r\n
-func buildGetAndTouchesCommand(command string, expiry time.Duration, keys ...string) (*request, *response) {
+func buildGetAndTouchesCommand(command string, expiry Expiration, keys ...string) (*request, *response) {
 	b := newProtocolBuilder().
 		AddString(command).
-		AddUint(uint64(expiry.Seconds()))
+		AddInt(int(expiry))
 	defer b.release()
 
 	for _, key := range keys {
@@ -308,12 +410,23 @@ func buildGetAndTouchesCommand(command string, expiry time.Duration, keys ...str
 
 	b.AddCRLF()
 
-	req := buildRequest([]byte(command), nil, b.build())
+	req := buildRequest([]byte(command), routingKey(keys), b.build())
 	resp := buildSpecEndLineResponse(_EndCRLFBytes, len(keys)*2+1)
 
 	return req, resp
 }
 
+// routingKey returns the key to pick the server for retrieval commands. The
+// command with only one key is routed as the storage commands, while the command
+// with multiple keys could not be routed by any of them.
+func routingKey(keys []string) []byte {
+	if len(keys) != 1 {
+		return nil
+	}
+
+	return []byte(keys[0])
+}
+
 // parseValueItems parses the response from memcached server, the response
 // is a list of items, each item is a key-value pair.
 //
@@ -324,6 +437,9 @@ func buildGetAndTouchesCommand(command string, expiry time.Duration, keys ...str
 // <data block>\r\n
 // ...
 // END\r\n
+//
+// The items whose CAS uniques could not be parsed are kept with CAS 0, and the
+// *CASParseError of the first one is returned along with the items.
 func parseValueItems(lines [][]byte, withoutEndLine, withCAS bool, codec Codec) (_ []*Item, err error) {
 	n := len(lines)
 	if withoutEndLine && n%2 != 0 {
@@ -339,6 +455,7 @@ func parseValueItems(lines [][]byte, withoutEndLine, withCAS bool, codec Codec)
 		rn      = n
 		items   = make([]*Item, 0, (n/2)+1) // pre-alloc to avoid memory allocation
 		dataLen uint64
+		casErr  error
 	)
 
 	if !withoutEndLine {
@@ -359,7 +476,9 @@ func parseValueItems(lines [][]byte, withoutEndLine, withCAS bool, codec Codec)
 			CAS:   0,
 		}
 		dataLen, err = parseValueLine(line, item, withCAS)
-		if err != nil {
+		if isCASParseError(err) {
+			casErr = cmp.Or(casErr, err)
+		} else if err != nil {
 			return nil, err
 		}
 
@@ -367,7 +486,8 @@ func parseValueItems(lines [][]byte, withoutEndLine, withCAS bool, codec Codec)
 		if i+1 >= n {
 			return nil, errors.Wrap(ErrMalformedResponse, "missing data block")
 		}
-		item.Value = trimCRLF(lines[i+1])
+		// the lines are reused after the response is released, copy the data block.
+		item.Value = bytes.Clone(trimCRLF(lines[i+1]))
 		if len(item.Value) != int(dataLen) {
 			return nil, errors.Wrap(ErrMalformedResponse, "data block length mismatch")
 		}
@@ -381,7 +501,7 @@ func parseValueItems(lines [][]byte, withoutEndLine, withCAS bool, codec Codec)
 		items = append(items, item)
 	}
 
-	return items, nil
+	return items, casErr
 }
 
 // parseValueLine extract item from VALUE line, like following:
@@ -389,6 +509,9 @@ func parseValueItems(lines [][]byte, withoutEndLine, withCAS bool, codec Codec)
 //
 // if withCas is false, VALUE line is:
 // VALUE <key> <flags> <bytes> => Item{key, flags, 0}
+//
+// The CAS unique which could not be parsed is set to 0, and the *CASParseError is
+// returned after the line is parsed.
 func parseValueLine(line []byte, item *Item, withCas bool) (dataLen uint64, err error) {
 	const (
 		keyIndex     = 1
@@ -401,6 +524,7 @@ func parseValueLine(line []byte, item *Item, withCas bool) (dataLen uint64, err
 	start := len(_ValueBytes)
 	fieldStart := start
 	nField := 0
+	var casErr error
 
 	for i := start; i < n; i++ {
 		if nField > 5 || (!withCas && nField > 4) {
@@ -415,7 +539,7 @@ func parseValueLine(line []byte, item *Item, withCas bool) (dataLen uint64, err
 		// the 'i' is the index of space or the last byte.
 		switch nField {
 		case keyIndex:
-			item.Key = unsafeByteSliceToString(line[fieldStart:i])
+			item.Key = string(line[fieldStart:i])
 		case flagsIndex:
 			flags, err := parseUintFromBytes(line[fieldStart:i])
 			if err != nil {
@@ -436,17 +560,35 @@ func parseValueLine(line []byte, item *Item, withCas bool) (dataLen uint64, err
 			if i == n-1 {
 				si = i + 1
 			}
-			item.CAS, err = parseUintFromBytes(line[fieldStart:si])
-			if err != nil {
-				return 0, errors.Wrap(ErrMalformedResponse, "invalid CAS")
-			}
+			item.CAS, casErr = parseCAS(line[fieldStart:si])
 		}
 
 		fieldStart = i + 1
 		nField++
 	}
 
-	return dataLen, nil
+	return dataLen, casErr
+}
+
+// parseCAS parses the CAS unique, it must be a 64-bit unsigned decimal, otherwise
+// 0 and the *CASParseError are returned.
+func parseCAS(token []byte) (uint64, error) {
+	cas, err := strconv.ParseUint(string(token), 10, 64)
+	if err != nil {
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) {
+			err = numErr.Err
+		}
+		return 0, &CASParseError{Token: string(token), Err: err}
+	}
+
+	return cas, nil
+}
+
+// isCASParseError reports whether err is a *CASParseError.
+func isCASParseError(err error) bool {
+	var casErr *CASParseError
+	return errors.As(err, &casErr)
 }
 
 // parseUintFromBytes parses slice of bytes to uint64.
@@ -486,13 +628,7 @@ func buildArithmeticCommand(command, key string, delta uint64, noReply bool) (*r
 		b.AddBytes(_NoReplyBytes)
 	}
 
-	raw := b.AddCRLF().build()
-
-	req := &request{
-		cmd: []byte(command),
-		key: []byte(key),
-		raw: raw,
-	}
+	req := buildRequest([]byte(command), []byte(key), b.AddCRLF().build())
 
 	var resp *response
 	if noReply {
@@ -515,6 +651,13 @@ func parseArithmetic(line []byte) (uint64, error) {
 	return strconv.ParseUint(string(trimCRLF(line)), 10, 64)
 }
 
+// ServerInfo represents the metadata of a memcached server.
+type ServerInfo struct {
+	Version     string
+	Uptime      time.Duration
+	PointerSize int // 32 or 64
+}
+
 // Statistic represents the statistics of the memcached server.
 type Statistic struct {
 	PID                    int64   `json:"pid"`
@@ -692,6 +835,16 @@ func buildStatsCommand(subCommand string) (*request, *response) {
 	return req, resp
 }
 
+// buildMetadumpCommand constructs the command to dump the metadata of all items.
+//
+// lru_crawler metadump all\r\n
+func buildMetadumpCommand() (*request, *response) {
+	req := buildRequest([]byte("lru_crawler"), nil, []byte("lru_crawler metadump all\r\n"))
+	resp := buildSpecEndLineResponse(_EndCRLFBytes, 256)
+
+	return req, resp
+}
+
 //nolint:unused
 func buildRawCommand(rawCommand string, indicator responseEndIndicator, lines int) (*request, *response) {
 	_, _, _ = rawCommand, indicator, lines
@@ -109,6 +109,11 @@ const (
 	_binaryDataTypeRawBytes = 0x00 // Raw bytes
 )
 
+// maxBinaryBodyLength limits the body of binary responses, the SASL responses
+// are far smaller than it, so that a corrupted header could not make the client
+// allocate gigabytes.
+const maxBinaryBodyLength = 1 << 20
+
 type binaryRequest struct {
 	// magic        uint8 // must be 0x80
 	opcode uint8
@@ -203,7 +208,11 @@ func (br *binaryResponse) expect(status uint16) error {
 	case _binaryStatusInvalidArgs:
 		return ErrInvalidArgument
 	case _binaryStatusOutOfMemory:
-		return errors.Wrap(ErrServerError, "out of memory")
+		return ErrServerOOM
+	case _binaryStatusValueTooBig:
+		return ErrValueTooLarge
+	case _binaryStatusNonNumeric:
+		return ErrNonNumericValue
 	}
 
 	// return: status: 0x1234 format
@@ -232,6 +241,13 @@ func (br *binaryResponse) read(rr io.Reader) error {
 		// no extras, key, value
 		return nil
 	}
+	if br.totalBodyLength > maxBinaryBodyLength {
+		return errors.Wrapf(ErrInvalidBinaryProtocol, "body too large: %d", br.totalBodyLength)
+	}
+	if uint32(br.extrasLength)+uint32(br.keyLength) > br.totalBodyLength {
+		return errors.Wrapf(ErrInvalidBinaryProtocol,
+			"extras(%d) and key(%d) exceed body length: %d", br.extrasLength, br.keyLength, br.totalBodyLength)
+	}
 
 	// read the whole body and split them into extras, key, value
 	body := make([]byte, br.totalBodyLength)
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"io"
 	"math"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -19,11 +23,12 @@ const (
 )
 
 var (
-	_SpaceBytes    = []byte{' '}
-	_SpaceByte     = byte(' ')
-	_CRLFBytes     = []byte("\r\n")
-	_NoReplyBytes  = []byte("noreply")
-	_QuitCRLFBytes = []byte("quit\r\n")
+	_SpaceBytes       = []byte{' '}
+	_SpaceByte        = byte(' ')
+	_CRLFBytes        = []byte("\r\n")
+	_NoReplyBytes     = []byte("noreply")
+	_QuitCRLFBytes    = []byte("quit\r\n")
+	_VersionCRLFBytes = []byte("version\r\n")
 
 	_OKCRLFBytes      = []byte("OK\r\n")
 	_ValueBytes       = []byte("VALUE")
@@ -32,8 +37,10 @@ var (
 	_DeletedCRLFBytes = []byte("DELETED\r\n")
 	_TouchedCRLFBytes = []byte("TOUCHED\r\n")
 	_VersionBytes     = []byte("VERSION")
+	_VersionLineBytes = []byte("VERSION ")
 
-	_MetaMNCRLFBytes = []byte("MN\r\n")
+	_MetaMNCRLFBytes   = []byte("MN\r\n")
+	_MetaNoOpCRLFBytes = []byte("mn\r\n")
 )
 
 // forecastCommonFaultLine forecasts the error line from the response line.
@@ -52,11 +59,9 @@ func forecastCommonFaultLine(line []byte) error {
 	case bytes.Equal(line, []byte("ERROR\r\n")):
 		return ErrNonexistentCommand
 	case bytes.HasPrefix(line, []byte("CLIENT_ERROR")):
-		message := string(line[12 : len(line)-2])
-		return errors.Wrap(ErrClientError, message)
+		return parseClientError(string(line[12 : len(line)-2]))
 	case bytes.HasPrefix(line, []byte("SERVER_ERROR")):
-		message := string(line[12 : len(line)-2])
-		return errors.Wrap(ErrServerError, message)
+		return parseServerError(string(trimCRLF(line[12:])))
 	case bytes.Equal(line, []byte("NOT_FOUND\r\n")):
 		return ErrNotFound
 	case bytes.Equal(line, []byte("EXISTS\r\n")):
@@ -78,12 +83,91 @@ func forecastCommonFaultLine(line []byte) error {
 	return nil
 }
 
+// errBadCommandLineFormat is the CLIENT_ERROR replied to a command with unexpected
+// tokens, e.g. gat/gats with multiple keys to the servers accepting one key only.
+var errBadCommandLineFormat = errors.WithMessage(ErrClientError, "bad command line format")
+
+// clientErrorMessages maps the well-known messages of CLIENT_ERROR lines to typed errors.
+var clientErrorMessages = []struct {
+	prefix string
+	err    error
+}{
+	{prefix: "cannot increment or decrement non-numeric value", err: ErrNonNumericValue},
+	{prefix: "bad command line format", err: errBadCommandLineFormat},
+}
+
+// parseClientError converts the message of CLIENT_ERROR line into typed error,
+// unknown messages are wrapped as ErrClientError.
+// CLIENT_ERROR <message>\r\n
+func parseClientError(message string) error {
+	message = strings.TrimSpace(message)
+	for _, m := range clientErrorMessages {
+		if strings.HasPrefix(message, m.prefix) {
+			return m.err
+		}
+	}
+
+	return errors.Wrap(ErrClientError, message)
+}
+
+// serverErrorMessages maps the well-known messages of SERVER_ERROR lines to typed errors,
+// the messages are shared by text and meta protocol.
+var serverErrorMessages = []struct {
+	prefix string
+	err    error
+}{
+	{prefix: "object too large for cache", err: ErrValueTooLarge},
+	{prefix: "out of memory", err: ErrServerOOM},
+}
+
+// parseServerError converts the message of SERVER_ERROR line into typed error,
+// unknown messages are wrapped as ErrServerError.
+// SERVER_ERROR <message>\r\n
+func parseServerError(message string) error {
+	message = strings.TrimSpace(message)
+	for _, m := range serverErrorMessages {
+		if strings.HasPrefix(message, m.prefix) {
+			return m.err
+		}
+	}
+
+	return errors.Wrap(ErrServerError, message)
+}
+
 const (
 	// defaultBufferSize is the default size of the buffer.
 	// TODO: It is used to avoid the buffer growth, but is 64B the most common case?
 	defaultBufferSize = 64
+	// maxRetainedBufferSize is the maximum capacity of the response buffer
+	// and the builder buffer which is kept in the pool.
+	maxRetainedBufferSize = 64 << 10
+	// maxRetainedLines is the maximum capacity of the response lines which
+	// is kept in the pool, e.g. the ones of a large multi-key get are dropped.
+	maxRetainedLines = 1024
 )
 
+// poisonReleased makes the released responses overwrite their buffers with
+// poisonByte, so that the bytes used after released are detected by the tests.
+var poisonReleased atomic.Bool
+
+const poisonByte = 0xA5
+
+// assertOwnership makes the requests and responses panic once they're used or
+// released after released, rather than being ignored, so that the violations of
+// the ownership are caught by the tests.
+var assertOwnership atomic.Bool
+
+// errReleased is returned by the requests and responses used after released.
+var errReleased = errors.New("memcached: request or response used after released")
+
+// ownershipViolated reports the request or response used after released, it
+// panics if assertOwnership is set.
+func ownershipViolated(what string) {
+	if assertOwnership.Load() {
+		panic("memcached: " + what)
+	}
+}
+
 var (
 	bufferPool = sync.Pool{
 		New: func() any {
@@ -128,7 +212,10 @@ func newProtocolBuilder() *protocolBuilder {
 func (b *protocolBuilder) release() {
 	if b.buf != nil {
 		b.buf.Reset()
-		bufferPool.Put(b.buf)
+		// do not keep the large buffer in the pool, e.g. the one of a large value.
+		if b.buf.Cap() <= maxRetainedBufferSize {
+			bufferPool.Put(b.buf)
+		}
 		b.buf = nil
 	}
 
@@ -248,6 +335,14 @@ type request struct {
 	// this field is used to indicate whether the request is UDP enabled.
 	// And it's set by the memcached client before sending the request.
 	udpEnabled bool
+	// itemSize is the approximate size of the item stored by the request, it's 0
+	// if the request stores nothing. See itemSize.
+	itemSize int
+	// owned is true from the request is taken from the pool until it's released,
+	// so that it's never put back to the pool twice and shared by two callers.
+	owned bool
+	// fenced is true if the mn command is appended to raw by fenceRequest.
+	fenced bool
 }
 
 func buildRequest(cmd []byte, key []byte, raw []byte) *request {
@@ -255,19 +350,31 @@ func buildRequest(cmd []byte, key []byte, raw []byte) *request {
 	req.cmd = cmd
 	req.key = key
 	req.raw = raw
+	req.owned = true
 	return req
 }
 
 func (req *request) release() {
+	if !req.owned {
+		ownershipViolated("request released twice")
+		return
+	}
+	req.owned = false
 	req.cmd = nil
 	req.key = nil
 	req.raw = nil
 	req.udpEnabled = false
+	req.itemSize = 0
+	req.fenced = false
 
 	requestPool.Put(req)
 }
 
 func (req *request) send(ctx context.Context, rr memcachedConn, writeTimeout time.Duration) (err error) {
+	if !req.owned {
+		ownershipViolated("request sent after released")
+		return errReleased
+	}
 	if has := selectProximateDeadline(ctx, rr, writeTimeout, nowFunc, false); has {
 		defer func() { _ = rr.setWriteDeadline(zeroTime) }()
 	}
@@ -333,6 +440,11 @@ const (
 	// the client should read lines from response until the specific end line.
 	// The delimiter is '\n'.
 	endIndicatorSpecificEndLine
+	// endIndicatorFenced indicates the response of quiet meta commands which are
+	// fenced by a trailing mn command; the client should read lines until "MN\r\n",
+	// the lines before it are the replies which are not suppressed. The noreply
+	// requests verified by WithNoReplyVerify are fenced by version, see specEndLine.
+	endIndicatorFenced
 )
 
 // response represents a structural response from memcached server.
@@ -346,30 +458,70 @@ type response struct {
 	// ready to be read from the connection.
 	limitedLines uint8
 	// specEndLine is the specific end line of the response, it helps to read
-	// from the connection.
+	// from the connection. It's the prefix of the fence line of fenced response.
 	specEndLine []byte
 
 	// rawLines is the raw bytes of the response, it has been divided by '\n'.
 	// .e.g. "VALUE key 0 5\r\nvalue\r\nEND\r\n" will be divided into
 	// ["VALUE key 0 5\r\n", "value\r\n", "END\r\n"].
+	//
+	// The lines refer to buf which is reused after the response is released,
+	// so that parsers must copy the bytes which are returned to the caller,
+	// it's checked by the tests with poisonReleased.
 	rawLines [][]byte
+	// buf holds the bytes of rawLines, it's reused with the response to avoid
+	// allocating for each line.
+	buf []byte
 
 	// This field is used to indicate whether the request is UDP enabled.
 	// And it's set by the memcached client before sending the request.
 	udpEnabled bool
+
+	// lenientFaultLine indicates whether the error lines should be forecasted
+	// leniently, it's set by the memcached client according to the compatibility mode.
+	lenientFaultLine bool
+
+	// drained is true if the fenced response is read until "MN\r\n", so that the
+	// connection is in sync with the requests even if an error line is replied.
+	drained bool
+	// inlineFaults keeps the error lines of the fenced response in rawLines in
+	// order rather than returning the first one, so that the pipelined commands
+	// could tie them to the commands, see dispatchQuietPipeline.
+	inlineFaults bool
+
+	// faultLine is the line forecasted as an error (e.g. NOT_FOUND), it's not
+	// in rawLines and kept for the wire logging and the diagnostics only. It refers
+	// to buf too.
+	faultLine []byte
+
+	// addr is the memcached server the response is received from, it's set by
+	// dispatchRequestTo and kept for the diagnostics of the malformed responses.
+	addr *Addr
+
+	// owned is true from the response is taken from the pool until it's released,
+	// so that its lines are never shared by two callers, see acquireResponse.
+	owned bool
 }
 
-func buildNoReplyResponse() *response {
+// acquireResponse takes a response from the pool, it's owned by the caller until
+// released.
+func acquireResponse() *response {
 	resp := responsePool.Get().(*response)
+	resp.owned = true
+	return resp
+}
+
+func buildNoReplyResponse() *response {
+	resp := acquireResponse()
 	resp.endIndicator = endIndicatorNoReply
 	return resp
 }
 
 func buildLimitedLineResponse(lines uint8) *response {
-	resp := responsePool.Get().(*response)
+	resp := acquireResponse()
 	resp.endIndicator = endIndicatorLimitedLines
 	resp.limitedLines = lines
-	resp.rawLines = make([][]byte, 0, lines)
+	resp.rawLines = resp.rawLines[:0]
 	return resp
 }
 
@@ -378,23 +530,80 @@ func buildSpecEndLineResponse(endLine []byte, predictLines int) *response {
 		predictLines = 8
 	}
 
-	resp := responsePool.Get().(*response)
+	resp := acquireResponse()
 	resp.endIndicator = endIndicatorSpecificEndLine
 	resp.specEndLine = endLine
-	resp.rawLines = make([][]byte, 0, predictLines)
+	if cap(resp.rawLines) < predictLines {
+		resp.rawLines = make([][]byte, 0, predictLines)
+	}
+	resp.rawLines = resp.rawLines[:0]
 	return resp
 }
 
+func buildFencedResponse() *response {
+	resp := acquireResponse()
+	resp.endIndicator = endIndicatorFenced
+	resp.specEndLine = _MetaMNCRLFBytes
+	resp.rawLines = resp.rawLines[:0]
+	return resp
+}
+
+// fenceRequest appends the mn command to the request of quiet meta commands, so
+// that the replies which are not suppressed (e.g. errors, or values of mg) are
+// always drained by reading until "MN\r\n", rather than being left in the
+// connection and read by the following requests.
+func fenceRequest(req *request) {
+	req.raw = append(req.raw, _MetaNoOpCRLFBytes...)
+	req.fenced = true
+}
+
 func (resp *response) release() {
+	if !resp.owned {
+		ownershipViolated("response released twice")
+		return
+	}
+	resp.owned = false
+	resp.reset()
+	responsePool.Put(resp)
+}
+
+// reset clears the response to be reused, the lines and the buffer returned
+// by it MUST NOT be used after reset.
+func (resp *response) reset() {
 	resp.endIndicator = endIndicatorUnknown
 	resp.limitedLines = 0
 	resp.specEndLine = nil
-	resp.rawLines = nil
+	if poisonReleased.Load() {
+		poison := resp.buf[:cap(resp.buf)]
+		for i := range poison {
+			poison[i] = poisonByte
+		}
+	}
+	// the lines refer to buf, they are cleared so that the pooled response does
+	// not keep the dropped buffer alive.
+	clear(resp.rawLines)
+	resp.rawLines = resp.rawLines[:0]
+	if cap(resp.rawLines) > maxRetainedLines {
+		resp.rawLines = nil
+	}
+	resp.buf = resp.buf[:0]
+	// do not keep the large buffer in the pool.
+	if cap(resp.buf) > maxRetainedBufferSize {
+		resp.buf = nil
+	}
 	resp.udpEnabled = false
-	responsePool.Put(resp)
+	resp.lenientFaultLine = false
+	resp.drained = false
+	resp.inlineFaults = false
+	resp.faultLine = nil
+	resp.addr = nil
 }
 
 func (resp *response) recv(ctx context.Context, rr memcachedConn, readTimeout time.Duration) error {
+	if !resp.owned {
+		ownershipViolated("response received after released")
+		return errReleased
+	}
 	if has := selectProximateDeadline(ctx, rr, readTimeout, nowFunc, true); has {
 		defer func() { _ = rr.setReadDeadline(zeroTime) }()
 	}
@@ -403,13 +612,11 @@ func (resp *response) recv(ctx context.Context, rr memcachedConn, readTimeout ti
 	case endIndicatorNoReply:
 		return nil
 	case endIndicatorLimitedLines:
-		// FIXME(@yeqown): read limited line would block waiting for the response
-		//  But there's no more lines to read, since error encountered.
-		// 	.e.g: "EN kfoo\r\n" means the key "foo" does not exist, but the client
-		//  maybe want 2 lines, but only 1 line to read.
 		return resp.read1(rr)
 	case endIndicatorSpecificEndLine:
 		return resp.read2(rr)
+	case endIndicatorFenced:
+		return resp.read3(rr)
 	default:
 	}
 
@@ -463,6 +670,10 @@ func parseUDPHeader(line []byte) []byte {
 }
 
 // read1 reads the response from the connection with limited lines.
+//
+// The response with more than one line always carries a data block, e.g. "VA 3\r\nbar\r\n",
+// which is read by its length. If the first line does not carry a data block, such as
+// "EN\r\n" or "HD\r\n", there is no more line to read.
 func (resp *response) read1(rr memcachedConn) error {
 	read := 0
 	for read < int(resp.limitedLines) {
@@ -476,12 +687,24 @@ func (resp *response) read1(rr memcachedConn) error {
 				line = parseUDPHeader(line)
 			}
 
-			if err = forecastCommonFaultLine(line); err != nil {
+			if err = resp.forecastFaultLine(line); err != nil {
 				return err
 			}
 		}
 
-		resp.rawLines = append(resp.rawLines, line)
+		resp.rawLines = append(resp.rawLines, resp.retain(line))
+		read++
+
+		n, ok, err := dataBlockLength(line)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err = resp.readDataBlock(rr, n); err != nil {
+			return err
+		}
 		read++
 	}
 
@@ -504,21 +727,188 @@ func (resp *response) read2(rr memcachedConn) error {
 
 		// FIXED(@yeqown): The end line also should be added to the rawLines.
 		if bytes.Equal(line, resp.specEndLine) {
-			resp.rawLines = append(resp.rawLines, line)
+			resp.rawLines = append(resp.rawLines, resp.retain(line))
 			break
 		}
 
-		if err = forecastCommonFaultLine(line); err != nil {
+		if err = resp.forecastFaultLine(line); err != nil {
+			return err
+		}
+
+		resp.rawLines = append(resp.rawLines, resp.retain(line))
+		read++
+
+		// the data block may contain '\n', so it's read by the length in the header
+		// rather than by line.
+		n, ok, err := dataBlockLength(line)
+		if err != nil {
 			return err
 		}
+		if ok {
+			if err = resp.readDataBlock(rr, n); err != nil {
+				return err
+			}
+			read++
+		}
+	}
+
+	return nil
+}
+
+// read3 reads the response of fenced quiet meta commands until "MN\r\n", or the
+// fence line of specEndLine. The error
+// lines (ERROR, CLIENT_ERROR and SERVER_ERROR) carry no opaque token, they're
+// drained and the first one is returned after the whole response is read, so that
+// the connection is still in sync with the requests, unless inlineFaults is set.
+// The other lines, including NS/EX/NF, are kept to be parsed by the caller.
+func (resp *response) read3(rr memcachedConn) error {
+	var fault error
+
+	read := 0
+	for {
+		line, err := rr.readLine('\n')
+		if err != nil {
+			return errors.Wrap(err, "dispatchRequest read")
+		}
 
-		resp.rawLines = append(resp.rawLines, line)
+		if read == 0 && resp.udpEnabled {
+			line = parseUDPHeader(line)
+		}
 		read++
+
+		if bytes.HasPrefix(line, resp.specEndLine) {
+			resp.drained = true
+			return fault
+		}
+
+		if isErrorLine(line) && !resp.inlineFaults {
+			if fault == nil {
+				fault = resp.forecastFaultLine(line)
+			}
+			continue
+		}
+
+		resp.rawLines = append(resp.rawLines, resp.retain(line))
+
+		n, ok, err := dataBlockLength(line)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err = resp.readDataBlock(rr, n); err != nil {
+				return err
+			}
+		}
 	}
+}
 
+// isErrorLine reports whether the line is an error line rather than a reply
+// of the command.
+func isErrorLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("ERROR")) ||
+		bytes.HasPrefix(line, []byte("CLIENT_ERROR")) ||
+		bytes.HasPrefix(line, []byte("SERVER_ERROR"))
+}
+
+// dataBlockLength returns the length of the data block following the line,
+// ok is false if the line is not followed by a data block.
+//
+// VALUE <key> <flags> <bytes> [<cas unique>]\r\n
+// VA <size> <flags>*\r\n
+func dataBlockLength(line []byte) (n int, ok bool, err error) {
+	var field []byte
+	switch {
+	case bytes.HasPrefix(line, []byte("VALUE ")):
+		field = nthField(line, 3)
+	case bytes.HasPrefix(line, []byte("VA ")):
+		field = nthField(line, 1)
+	default:
+		return 0, false, nil
+	}
+
+	size, err := parseUintFromBytes(field)
+	if err != nil || len(field) == 0 || size > maxValueSize {
+		return 0, false, errors.Wrapf(ErrMalformedResponse, "invalid data block length in %q", trimCRLF(line))
+	}
+
+	return int(size), true, nil
+}
+
+// nthField returns the n-th(0-based) field of the line separated by space.
+func nthField(line []byte, n int) []byte {
+	line = trimCRLF(line)
+	for i := 0; i < n; i++ {
+		idx := bytes.IndexByte(line, ' ')
+		if idx < 0 {
+			return nil
+		}
+		line = line[idx+1:]
+	}
+
+	if idx := bytes.IndexByte(line, ' '); idx >= 0 {
+		return line[:idx]
+	}
+
+	return line
+}
+
+// readDataBlock reads the data block with n bytes and the trailing CRLF into buf,
+// and appends it to rawLines.
+func (resp *response) readDataBlock(rr memcachedConn, n int) error {
+	start := len(resp.buf)
+	resp.buf = slices.Grow(resp.buf, n+2)[:start+n+2]
+	if _, err := io.ReadFull(rr, resp.buf[start:]); err != nil {
+		resp.buf = resp.buf[:start]
+		return errors.Wrap(err, "dispatchRequest read data block")
+	}
+
+	block := resp.buf[start : start+n+2 : start+n+2]
+	if !bytes.HasSuffix(block, _CRLFBytes) {
+		return errors.Wrap(ErrMalformedResponse, "data block is not terminated by CRLF")
+	}
+
+	resp.rawLines = append(resp.rawLines, block)
 	return nil
 }
 
+// rewind clears the received lines of the response, so that the request could be
+// replayed with it, see WithStaleConnReplay.
+func (resp *response) rewind() {
+	clear(resp.rawLines)
+	resp.rawLines = resp.rawLines[:0]
+	resp.buf = resp.buf[:0]
+	resp.drained = false
+	resp.faultLine = nil
+}
+
+// retain copies the line which is only valid until the next read into buf,
+// and returns the copy.
+func (resp *response) retain(line []byte) []byte {
+	start := len(resp.buf)
+	resp.buf = append(resp.buf, line...)
+	return resp.buf[start:len(resp.buf):len(resp.buf)]
+}
+
+// desynced reports whether the connection is out of sync with the requests
+// after the response is received with the error.
+func (resp *response) desynced(err error) bool {
+	return err != nil && !resp.drained && !isInSyncError(err)
+}
+
+func (resp *response) forecastFaultLine(line []byte) error {
+	var err error
+	if resp.lenientFaultLine {
+		err = forecastLenientFaultLine(line)
+	} else {
+		err = forecastCommonFaultLine(line)
+	}
+	if err != nil && resp.faultLine == nil {
+		resp.faultLine = resp.retain(line)
+	}
+
+	return err
+}
+
 // expect checks the response from the server is expected or not.
 // if the response is not expected, it returns error.
 //
@@ -1,11 +1,19 @@
 package memcached
 
 import (
+	"bufio"
 	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memcodec "github.com/yeqown/memcached/codec"
 )
 
 func Test_protocolBuilder(t *testing.T) {
@@ -103,3 +111,429 @@ func Test_selectProximateDeadline(t *testing.T) {
 		})
 	}
 }
+
+func Test_forecastCommonFaultLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    []byte
+		wantErr error
+		also    error
+	}{
+		{
+			name:    "object too large",
+			line:    []byte("SERVER_ERROR object too large for cache\r\n"),
+			wantErr: ErrValueTooLarge,
+			also:    ErrServerError,
+		},
+		{
+			name:    "out of memory storing object",
+			line:    []byte("SERVER_ERROR out of memory storing object\r\n"),
+			wantErr: ErrServerOOM,
+			also:    ErrServerError,
+		},
+		{
+			name:    "unknown server error",
+			line:    []byte("SERVER_ERROR something happened\r\n"),
+			wantErr: ErrServerError,
+		},
+		{
+			name:    "client error",
+			line:    []byte("CLIENT_ERROR bad data chunk\r\n"),
+			wantErr: ErrClientError,
+		},
+		{
+			name:    "non-numeric value",
+			line:    []byte("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"),
+			wantErr: ErrNonNumericValue,
+			also:    ErrClientError,
+		},
+		{
+			name:    "meta not found",
+			line:    []byte("NF\r\n"),
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "normal line",
+			line:    []byte("STORED\r\n"),
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := forecastCommonFaultLine(tt.line)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.also != nil {
+				assert.ErrorIs(t, err, tt.also)
+			}
+		})
+	}
+
+	// unknown server error should not be classified as typed errors.
+	err := forecastCommonFaultLine([]byte("SERVER_ERROR something happened\r\n"))
+	assert.NotErrorIs(t, err, ErrValueTooLarge)
+	assert.NotErrorIs(t, err, ErrServerOOM)
+	err = forecastCommonFaultLine([]byte("CLIENT_ERROR bad data chunk\r\n"))
+	assert.NotErrorIs(t, err, ErrNonNumericValue)
+}
+
+// repeatReader repeats the payload endlessly.
+type repeatReader struct {
+	payload []byte
+	offset  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.payload[r.offset:])
+	r.offset = (r.offset + n) % len(r.payload)
+	return n, nil
+}
+
+func newPayloadConn(payload string) *conn {
+	return &conn{rr: bufio.NewReader(&repeatReader{payload: []byte(payload)})}
+}
+
+func Test_responseRecvRetainsLines(t *testing.T) {
+	cn := newPayloadConn("VALUE foo 0 3\r\nbar\r\nEND\r\n")
+
+	req, resp := buildGetsCommand("get", "foo")
+	require.NoError(t, resp.recv(context.Background(), cn, 0))
+	items, err := parseValueItems(resp.rawLines, false, false, memcodec.Noop)
+	require.NoError(t, err)
+	releaseReqAndResp(req, resp)
+
+	// the next response reuses the buffer, but the items must not be affected.
+	req, resp = buildGetsCommand("get", "foo")
+	resp.buf = append(resp.buf[:0], "xxxxxxxxxxxxxxxxxxxxxxxxxxxx"...)
+	releaseReqAndResp(req, resp)
+
+	require.Len(t, items, 1)
+	assert.Equal(t, "foo", items[0].Key)
+	assert.Equal(t, []byte("bar"), items[0].Value)
+}
+
+func Test_connReadLineLongerThanBuffer(t *testing.T) {
+	value := strings.Repeat("v", 3*4096)
+	cn := newPayloadConn("VALUE foo 0 " + strconv.Itoa(len(value)) + "\r\n" + value + "\r\nEND\r\n")
+
+	req, resp := buildGetsCommand("get", "foo")
+	defer releaseReqAndResp(req, resp)
+
+	require.NoError(t, resp.recv(context.Background(), cn, 0))
+	items, err := parseValueItems(resp.rawLines, false, false, memcodec.Noop)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, value, string(items[0].Value))
+}
+
+// Benchmark_responseRecv measures the allocations of reading and parsing a get response.
+// go test -run=^$ -bench=^Benchmark_responseRecv$ -benchmem
+func Benchmark_responseRecv(b *testing.B) {
+	value := strings.Repeat("v", 1024)
+	cn := newPayloadConn("VALUE foo 0 " + strconv.Itoa(len(value)) + "\r\n" + value + "\r\nEND\r\n")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, resp := buildGetsCommand("get", "foo")
+		if err := resp.recv(context.Background(), cn, 0); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := parseValueItems(resp.rawLines, false, false, memcodec.Noop); err != nil {
+			b.Fatal(err)
+		}
+		releaseReqAndResp(req, resp)
+	}
+}
+
+func Test_responseRecvDataBlockByLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		buildResp func() *response
+		wantLines []string
+		wantErr   error
+	}{
+		{
+			name:      "value contains LF and CRLF",
+			payload:   "VALUE foo 0 10\r\nb\na\r\nEND\r\n\r\nEND\r\n",
+			buildResp: func() *response { return buildSpecEndLineResponse(_EndCRLFBytes, 3) },
+			wantLines: []string{"VALUE foo 0 10\r\n", "b\na\r\nEND\r\n\r\n", "END\r\n"},
+		},
+		{
+			name:      "value looks like an error line",
+			payload:   "VALUE foo 0 7 12\r\nERROR\r\n\r\nEND\r\n",
+			buildResp: func() *response { return buildSpecEndLineResponse(_EndCRLFBytes, 3) },
+			wantLines: []string{"VALUE foo 0 7 12\r\n", "ERROR\r\n\r\n", "END\r\n"},
+		},
+		{
+			name:      "meta value with binary",
+			payload:   "VA 4 f1\r\n\x00\n\r\x01\r\n",
+			buildResp: func() *response { return buildLimitedLineResponse(2) },
+			wantLines: []string{"VA 4 f1\r\n", "\x00\n\r\x01\r\n"},
+		},
+		{
+			name:      "meta response without value does not block",
+			payload:   "HD f1\r\n",
+			buildResp: func() *response { return buildLimitedLineResponse(2) },
+			wantLines: []string{"HD f1\r\n"},
+		},
+		{
+			name:      "data block length mismatch",
+			payload:   "VALUE foo 0 2\r\nbar\r\nEND\r\n",
+			buildResp: func() *response { return buildSpecEndLineResponse(_EndCRLFBytes, 3) },
+			wantErr:   ErrMalformedResponse,
+		},
+		{
+			name:      "invalid data block length",
+			payload:   "VALUE foo 0 x\r\nbar\r\nEND\r\n",
+			buildResp: func() *response { return buildSpecEndLineResponse(_EndCRLFBytes, 3) },
+			wantErr:   ErrMalformedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.buildResp()
+			defer resp.release()
+
+			err := resp.recv(context.Background(), newPayloadConn(tt.payload), 0)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			lines := make([]string, 0, len(resp.rawLines))
+			for _, line := range resp.rawLines {
+				lines = append(lines, string(line))
+			}
+			assert.Equal(t, tt.wantLines, lines)
+		})
+	}
+}
+
+func Test_responseRecvFenced(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantLines   []string
+		wantErr     error
+		wantDrained bool
+	}{
+		{
+			name:        "all replies suppressed",
+			payload:     "MN\r\n",
+			wantLines:   []string{},
+			wantDrained: true,
+		},
+		{
+			name:        "replies and values",
+			payload:     "NS O1\r\nVA 4 O2\r\nMN\r\n\r\nMN\r\n",
+			wantLines:   []string{"NS O1\r\n", "VA 4 O2\r\n", "MN\r\n\r\n"},
+			wantDrained: true,
+		},
+		{
+			name:        "error lines are drained",
+			payload:     "CLIENT_ERROR bad data chunk\r\nHD O1\r\nSERVER_ERROR out of memory\r\nMN\r\n",
+			wantLines:   []string{"HD O1\r\n"},
+			wantErr:     ErrClientError,
+			wantDrained: true,
+		},
+		{
+			name:    "connection closed before fence",
+			payload: "HD O1\r\n",
+			wantErr: io.EOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cn := &conn{rr: bufio.NewReader(strings.NewReader(tt.payload))}
+			resp := buildFencedResponse()
+			defer resp.release()
+
+			err := resp.recv(context.Background(), cn, 0)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantDrained, resp.drained)
+			assert.Equal(t, tt.wantDrained, !resp.desynced(err))
+			if tt.wantLines == nil {
+				return
+			}
+
+			lines := make([]string, 0, len(resp.rawLines))
+			for _, line := range resp.rawLines {
+				lines = append(lines, string(line))
+			}
+			assert.Equal(t, tt.wantLines, lines)
+		})
+	}
+}
+
+func Test_responseReset(t *testing.T) {
+	resp := buildSpecEndLineResponse(_EndCRLFBytes, 0)
+	line := resp.retain([]byte("VALUE foo 0 3\r\n"))
+	resp.rawLines = append(resp.rawLines, line)
+	resp.buf = append(resp.buf, make([]byte, maxRetainedBufferSize)...)
+	resp.rawLines = append(resp.rawLines, make([][]byte, maxRetainedLines)...)
+	lines := resp.rawLines
+
+	resp.reset()
+
+	// the lines do not keep the dropped buffer alive.
+	assert.Nil(t, lines[0])
+	assert.Nil(t, resp.buf)
+	assert.Nil(t, resp.rawLines)
+	assert.Equal(t, endIndicatorUnknown, resp.endIndicator)
+
+	resp = buildSpecEndLineResponse(_EndCRLFBytes, 0)
+	resp.rawLines = append(resp.rawLines, resp.retain([]byte("END\r\n")))
+	resp.reset()
+	assert.Empty(t, resp.rawLines)
+	assert.NotNil(t, resp.buf)
+}
+
+// Test_client_releasedBuffersNotAliased checks the items returned by the commands
+// never refer to the buffers of the pooled responses, the released buffers are
+// poisoned and reused by the concurrent commands.
+func Test_client_releasedBuffersNotAliased(t *testing.T) {
+	poisonReleased.Store(true)
+	defer poisonReleased.Store(false)
+
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithMaxConns(4))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	const n = 16
+	for i := 0; i < n; i++ {
+		key := "key:" + strconv.Itoa(i)
+		require.NoError(t, c.Set(ctx, key, []byte("value:"+strconv.Itoa(i)), 0, 0))
+	}
+
+	type result struct {
+		key   string
+		value []byte
+	}
+	results := make(chan result, n*8)
+
+	async := c.Async()
+	defer async.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := "key:" + strconv.Itoa(i)
+
+			item, err := c.Get(ctx, key)
+			if assert.NoError(t, err) {
+				results <- result{key: item.Key, value: item.Value}
+			}
+			items, err := c.Gets(ctx, key, "key:"+strconv.Itoa((i+1)%n))
+			if assert.NoError(t, err) {
+				for _, item := range items {
+					results <- result{key: item.Key, value: item.Value}
+				}
+			}
+			meta, err := c.MetaGet(ctx, []byte(key), MetaGetFlagReturnValue(), MetaGetFlagReturnKey())
+			if assert.NoError(t, err) {
+				results <- result{key: key, value: meta.Value}
+			}
+			fetched, err := async.Get(ctx, key).Wait(ctx)
+			if assert.NoError(t, err) {
+				results <- result{key: key, value: fetched.Value}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	// more commands reuse and poison the buffers.
+	for i := 0; i < n; i++ {
+		_, err = c.Gets(ctx, "key:"+strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+
+	count := 0
+	for r := range results {
+		count++
+		assert.Equal(t, "value:"+strings.TrimPrefix(r.key, "key:"), string(r.value), "key %s", r.key)
+	}
+	assert.Equal(t, n*5, count)
+}
+
+func Test_ownership(t *testing.T) {
+	tests := []struct {
+		name string
+		use  func()
+	}{
+		{
+			name: "request released twice",
+			use: func() {
+				req := buildRequest([]byte("get"), nil, []byte("get foo\r\n"))
+				req.release()
+				req.release()
+			},
+		},
+		{
+			name: "request sent after released",
+			use: func() {
+				req := buildRequest([]byte("get"), nil, []byte("get foo\r\n"))
+				req.release()
+				_ = req.send(context.Background(), nil, time.Second)
+			},
+		},
+		{
+			name: "response released twice",
+			use: func() {
+				resp := buildLimitedLineResponse(1)
+				resp.release()
+				resp.release()
+			},
+		},
+		{
+			name: "response received after released",
+			use: func() {
+				resp := buildLimitedLineResponse(1)
+				resp.release()
+				_ = resp.recv(context.Background(), nil, time.Second)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the violations are ignored without the assertion.
+			assert.NotPanics(t, tt.use)
+
+			assertOwnership.Store(true)
+			defer assertOwnership.Store(false)
+			assert.Panics(t, tt.use)
+		})
+	}
+
+	// the response released twice is put back to the pool once only.
+	resp := buildLimitedLineResponse(1)
+	resp.release()
+	resp.release()
+	first, second := buildLimitedLineResponse(1), buildLimitedLineResponse(1)
+	assert.NotSame(t, first, second)
+	releaseReqAndResp(nil, first)
+	releaseReqAndResp(nil, second)
+
+	req := buildRequest([]byte("get"), nil, nil)
+	req.release()
+	assert.ErrorIs(t, req.send(context.Background(), nil, time.Second), errReleased)
+}
@@ -2,8 +2,8 @@ package memcached
 
 import (
 	"bytes"
-	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -85,6 +85,12 @@ func MetaSetFlagTTL(ttl uint64) MetaSetOption {
 	return func(flags *metaSetFlags) { flags.T = ttl }
 }
 
+// MetaSetFlagExpireAt sets the flag to Time-To-Live for item, the item expires at the given time.
+// If the time is zero, the item will never expire.
+func MetaSetFlagExpireAt(t time.Time) MetaSetOption {
+	return func(flags *metaSetFlags) { flags.T = metaTTL(ExpireAt(t)) }
+}
+
 type metaSetMode string
 
 const (
@@ -100,6 +106,25 @@ const (
 	MetaSetModeSet metaSetMode = "set"
 )
 
+// token returns the mode token of meta set command. The server only checks the
+// first character of the token, so that "add" would be taken as "append".
+func (m metaSetMode) token() string {
+	switch m {
+	case MetaSetModeAdd:
+		return "E"
+	case MetaSetModeReplace:
+		return "R"
+	case MetaSetModeAppend:
+		return "A"
+	case MetaSetModePrepend:
+		return "P"
+	case MetaSetModeSet:
+		return "S"
+	}
+
+	return string(m)
+}
+
 // MetaSetFlagModeSwitch sets the flag to mode switch to change behavior to: add, replace, append, prepend, set(default).
 func MetaSetFlagModeSwitch(mode metaSetMode) MetaSetOption {
 	return func(flags *metaSetFlags) { flags.M = mode }
@@ -127,6 +152,7 @@ func buildMetaSetCommand(key, value []byte, flags *metaSetFlags, codec Codec) (*
 		return nil, nil, errors.Wrap(err, "encode value and flags")
 	}
 	flags.F = eflags
+	size := itemSize(len(key), len(evalue))
 
 	if flags.b {
 		key = base64Encode(key)
@@ -149,7 +175,7 @@ func buildMetaSetCommand(key, value []byte, flags *metaSetFlags, codec Codec) (*
 	b.AddFlagBool("q", flags.q)
 	b.AddFlagBool("s", flags.s)
 	b.AddFlagUint("T", flags.T)
-	b.AddFlagString("M", string(flags.M))
+	b.AddFlagString("M", flags.M.token())
 	b.AddFlagUint("N", flags.N)
 
 	raw := b.AddCRLF().
@@ -158,10 +184,12 @@ func buildMetaSetCommand(key, value []byte, flags *metaSetFlags, codec Codec) (*
 		build()
 
 	req := buildRequest([]byte("ms"), key, raw)
+	req.itemSize = size
 
 	var resp *response
 	if flags.q {
-		resp = buildNoReplyResponse()
+		fenceRequest(req)
+		resp = buildFencedResponse()
 	} else {
 		resp = buildLimitedLineResponse(1)
 	}
@@ -195,6 +223,11 @@ type metaGetFlags struct {
 	Z bool // Z: item has already sent a winning flag
 }
 
+// modifies reports whether the meta get command modifies the item.
+func (flags *metaGetFlags) modifies() bool {
+	return flags.E != 0 || flags.N != 0 || flags.R != 0 || flags.T != 0
+}
+
 // MetaGetOption is the option to set flags for meta get command.
 type MetaGetOption func(*metaGetFlags)
 
@@ -278,6 +311,11 @@ func MetaGetFlagUpdateRemainingTTL(ttl uint64) MetaGetOption {
 	return func(flags *metaGetFlags) { flags.T = ttl }
 }
 
+// MetaGetFlagUpdateExpireAt sets the flag to update remaining TTL, the item expires at the given time.
+func MetaGetFlagUpdateExpireAt(t time.Time) MetaGetOption {
+	return func(flags *metaGetFlags) { flags.T = metaTTL(ExpireAt(t)) }
+}
+
 // MetaGetFlagClientHasWonRecache sets the flag to client has "won" the recache flag.
 func MetaGetFlagClientHasWonRecache() MetaGetOption {
 	return func(flags *metaGetFlags) { flags.W = true }
@@ -328,7 +366,8 @@ func buildMetaGetCommand(key []byte, flags *metaGetFlags) (*request, *response)
 
 	var resp *response
 	if flags.q {
-		resp = buildNoReplyResponse()
+		fenceRequest(req)
+		resp = buildFencedResponse()
 	} else if flags.v {
 		resp = buildLimitedLineResponse(2)
 	} else {
@@ -351,6 +390,9 @@ func buildMetaGetCommand(key []byte, flags *metaGetFlags) (*request, *response)
 //	VA(value).
 //
 // VA is specified as: VA <size> <flags>*\r\n<data block>\r\n.
+//
+// The CAS unique which could not be parsed is set to 0, and the *CASParseError is
+// returned after the item is parsed.
 func parseMetaItem(lines [][]byte, item *MetaItem, noReply bool, codec Codec) error {
 	if noReply && len(lines) == 0 {
 		return nil
@@ -360,6 +402,10 @@ func parseMetaItem(lines [][]byte, item *MetaItem, noReply bool, codec Codec) er
 	if len(lines) == 0 {
 		return errors.Wrap(ErrMalformedResponse, "missing response")
 	}
+	// the error line tied to the command in a pipeline, see dispatchQuietPipeline.
+	if isErrorLine(lines[0]) {
+		return forecastLenientFaultLine(lines[0])
+	}
 
 	// Normal CD handling
 	parts := bytes.Split(trimCRLF(lines[0]), _SpaceBytes)
@@ -384,31 +430,37 @@ func parseMetaItem(lines [][]byte, item *MetaItem, noReply bool, codec Codec) er
 	}
 
 	if !bytes.Equal(cd, []byte("VA")) {
-		parseFlags(parts, 1, item)
-		return nil
+		return parseFlags(parts, 1, item)
 	}
 
 	// VA handling
+	if len(parts) < 2 {
+		return errors.Wrap(ErrMalformedResponse, "missing data length")
+	}
 	item.Size, _ = strconv.ParseUint(string(parts[dataLenIndex]), 10, 32)
-	parseFlags(parts, 2, item)
+	casErr := parseFlags(parts, 2, item)
 
 	if len(lines) < 2 {
 		return errors.Wrap(ErrMalformedResponse, "missing value")
 	}
 
+	// the lines are reused after the response is released, copy the data block.
 	var err error
-	if item.Value, item.Flags, err = codec.Decode(item.Key, trimCRLF(lines[1]), item.Flags); err != nil {
+	if item.Value, item.Flags, err = codec.Decode(item.Key, bytes.Clone(trimCRLF(lines[1])), item.Flags); err != nil {
 		return errors.Wrap(err, "codec decode")
 	}
 
-	return nil
+	return casErr
 }
 
 // CD <flags>*\r\n
 // .e.g:
 //
 //	HD c26 kZm9v b O456 s3\r\n
-func parseFlags(parts [][]byte, startPos int, item *MetaItem) {
+//
+// The flags are parsed loosely, except that the *CASParseError of the CAS unique
+// is returned, see parseCAS.
+func parseFlags(parts [][]byte, startPos int, item *MetaItem) (casErr error) {
 	parseUint := func(b []byte) uint64 {
 		v, _ := strconv.ParseUint(string(b), 10, 64)
 		return v
@@ -420,9 +472,14 @@ func parseFlags(parts [][]byte, startPos int, item *MetaItem) {
 	}
 
 	for i := startPos; i < len(parts); i++ {
+		// skip the empty token caused by consecutive spaces.
+		if len(parts[i]) == 0 {
+			continue
+		}
+
 		switch parts[i][0] {
 		case 'c':
-			item.CAS = parseUint(parts[i][1:])
+			item.CAS, casErr = parseCAS(parts[i][1:])
 		case 'f':
 			item.Flags = uint32(parseUint(parts[i][1:]))
 		case 't':
@@ -440,6 +497,8 @@ func parseFlags(parts [][]byte, startPos int, item *MetaItem) {
 			//	item.Key = string(parts[i][1:])
 		}
 	}
+
+	return casErr
 }
 
 // MetaDeleteOption is used to set options for MetaDelete command.
@@ -498,6 +557,12 @@ func MetaDeleteFlagUpdateTTL(ttl uint64) MetaDeleteOption {
 	return func(flags *metaDeleteFlags) { flags.T = ttl }
 }
 
+// MetaDeleteFlagUpdateExpireAt sets the flag to updates TTL, the item expires at the given time.
+// Only when paired with the 'I' flag (MetaDeleteFlagInvalidate).
+func MetaDeleteFlagUpdateExpireAt(t time.Time) MetaDeleteOption {
+	return func(flags *metaDeleteFlags) { flags.T = metaTTL(ExpireAt(t)) }
+}
+
 // MetaDeleteFlagRemoveValueOnly sets the flag to
 // removes the item value, but leaves the item.
 func MetaDeleteFlagRemoveValueOnly() MetaDeleteOption {
@@ -532,7 +597,8 @@ func buildMetaDeleteCommand(key []byte, flags *metaDeleteFlags) (*request, *resp
 
 	var resp *response
 	if flags.q {
-		resp = buildNoReplyResponse()
+		fenceRequest(req)
+		resp = buildFencedResponse()
 	} else {
 		resp = buildLimitedLineResponse(1)
 	}
@@ -540,6 +606,30 @@ func buildMetaDeleteCommand(key []byte, flags *metaDeleteFlags) (*request, *resp
 	return req, resp
 }
 
+// buildMetaTouchCommand builds the meta get command which only updates the TTL of
+// the item, the T flag is always sent even if ttl is 0 (never expire). The hit is
+// replied as HD with the opaque token, and the miss as EN unless it's quiet.
+//
+// mg <key> T<ttl> [q] O<opaque>\r\n
+func buildMetaTouchCommand(key []byte, ttl, opaque uint64, quiet bool) (*request, *response) {
+	b := newProtocolBuilder().
+		AddString("mg").
+		AddBytes(key).
+		AddString("T" + strconv.FormatUint(ttl, 10))
+	defer b.release()
+
+	b.AddFlagBool("q", quiet)
+	b.AddFlagUint("O", opaque)
+
+	req := buildRequest([]byte("mg"), key, b.AddCRLF().build())
+	if !quiet {
+		return req, buildLimitedLineResponse(1)
+	}
+	fenceRequest(req)
+
+	return req, buildFencedResponse()
+}
+
 // MetaArithmeticOption is used to set options for MetaArithmetic command.
 type MetaArithmeticOption func(*metaArithmeticFlags)
 
@@ -548,6 +638,7 @@ type metaArithmeticFlags struct {
 	C uint64             // C(token): compare CAS value
 	E uint64             // E(token): use token as new CAS value
 	N uint64             // N(token): auto create item on miss with supplied TTL
+	n bool               // n is set if N is set, since N0 means auto create item which never expires
 	J uint64             // J(token): initial value to use if auto created after miss (default 0)
 	D uint64             // D(token): delta to apply (decimal unsigned 64-bit number, default 1)
 	T uint64             // T(token): update TTL on success
@@ -576,8 +667,9 @@ func MetaArithmeticFlagNewCAS(casUnique uint64) MetaArithmeticOption {
 }
 
 // MetaArithmeticFlagAutoCreate sets the flag to auto create item on miss with supplied TTL.
+// The TTL 0 means the created item never expires.
 func MetaArithmeticFlagAutoCreate(ttl uint64) MetaArithmeticOption {
-	return func(flags *metaArithmeticFlags) { flags.N = ttl }
+	return func(flags *metaArithmeticFlags) { flags.N, flags.n = ttl, true }
 }
 
 // MetaArithmeticFlagInitialValue sets the flag to initial value to use if auto created after miss (default 0).
@@ -590,6 +682,11 @@ func MetaArithmeticFlagUpdateTTL(ttl uint64) MetaArithmeticOption {
 	return func(flags *metaArithmeticFlags) { flags.T = ttl }
 }
 
+// MetaArithmeticFlagUpdateExpireAt sets the flag to update TTL on success, the item expires at the given time.
+func MetaArithmeticFlagUpdateExpireAt(t time.Time) MetaArithmeticOption {
+	return func(flags *metaArithmeticFlags) { flags.T = metaTTL(ExpireAt(t)) }
+}
+
 type metaArithmeticMode string
 
 const (
@@ -648,7 +745,11 @@ func buildMetaArithmeticCommand(key []byte, delta uint64, flags *metaArithmeticF
 	b.AddFlagBool("b", flags.b)
 	b.AddFlagUint("C", flags.C)
 	b.AddFlagUint("E", flags.E)
-	b.AddFlagUint("N", flags.N)
+	if flags.n && flags.N == 0 {
+		b.AddString("N0")
+	} else {
+		b.AddFlagUint("N", flags.N)
+	}
 	b.AddFlagUint("J", flags.J)
 	b.AddFlagUint("D", flags.D)
 	b.AddFlagUint("T", flags.T)
@@ -665,7 +766,8 @@ func buildMetaArithmeticCommand(key []byte, delta uint64, flags *metaArithmeticF
 
 	var resp *response
 	if flags.q {
-		resp = buildNoReplyResponse()
+		fenceRequest(req)
+		resp = buildFencedResponse()
 	} else if flags.v {
 		resp = buildLimitedLineResponse(2)
 	} else {
@@ -709,15 +811,16 @@ func buildMetaDebugCommand(key []byte, flags *metaDebugFlags) (*request, *respon
 // parseMetaItemDebug parses the response from memcached server. It could be:
 // success: ME foo exp=-1 la=2 cas=18 fetch=no cls=1 size=65\r\n
 // failed:  EN\r\n
+//
+// The key in response is decoded only if the server marks it as base64 encoded by
+// the b flag, otherwise it's kept as it is. Unknown fields are ignored, so that the
+// fields added by newer servers do not break it.
 func parseMetaItemDebug(lines [][]byte, item *MetaItemDebug) error {
 	if len(lines) != 1 {
 		return errors.Wrap(ErrMalformedResponse, "invalid response")
 	}
 
 	parts := bytes.Split(trimCRLF(lines[0]), _SpaceBytes)
-	if len(parts) < 1 {
-		return errors.Wrap(ErrMalformedResponse, "invalid response")
-	}
 
 	const (
 		CDIndex  = 0
@@ -734,36 +837,73 @@ func parseMetaItemDebug(lines [][]byte, item *MetaItemDebug) error {
 		return errors.Wrap(ErrMalformedResponse, "unexpected cd<="+string(cd)+">")
 	}
 
-	// parse key
-	// item.Key = parts[KeyIndex]
-	for i := KeyIndex + 1; i < len(parts); i++ {
-		kv := bytes.Split(parts[i], []byte("="))
-		if len(kv) != 2 {
-			fmt.Printf("memcached: parseMetaItemDebug got invalid key-value pair: %s\n", parts[i])
+	if len(parts) <= KeyIndex || len(parts[KeyIndex]) == 0 {
+		return errors.Wrap(ErrMalformedResponse, "missing key")
+	}
+	key, err := decodeMetaDebugKey(parts[KeyIndex], parts[KeyIndex+1:])
+	if err != nil {
+		return errors.Wrapf(ErrMalformedResponse, "invalid key %q", parts[KeyIndex])
+	}
+	item.Key = key
+
+	return parseMetaDebugFields(parts[KeyIndex+1:], item)
+}
+
+// parseMetaDebugFields parses the fields of the item replied by me command or
+// lru_crawler metadump, e.g. "exp=-1 la=3 cas=1 fetch=no cls=1 size=3", the
+// unknown fields are ignored. The CAS unique which could not be parsed is set to
+// 0, and the *CASParseError is returned after the fields are parsed.
+func parseMetaDebugFields(fields [][]byte, item *MetaItemDebug) (casErr error) {
+	for i := range fields {
+		name, value, ok := bytes.Cut(fields[i], []byte("="))
+		if !ok {
 			continue
 		}
 
-		switch string(kv[0]) {
+		var err error
+		switch string(name) {
 		case "exp":
-			item.TTL, _ = strconv.ParseInt(string(kv[1]), 10, 64)
+			item.TTL, err = strconv.ParseInt(string(value), 10, 64)
 		case "la":
-			item.LastAssessTime, _ = strconv.ParseInt(string(kv[1]), 10, 64)
+			item.LastAssessTime, err = strconv.ParseInt(string(value), 10, 64)
 		case "cas":
-			item.CAS, _ = strconv.ParseUint(string(kv[1]), 10, 64)
+			item.CAS, casErr = parseCAS(value)
 		case "fetch":
-			item.HitBefore = string(kv[1]) == "yes"
+			switch string(value) {
+			case "yes":
+				item.HitBefore = true
+			case "no":
+				item.HitBefore = false
+			default:
+				err = strconv.ErrSyntax
+			}
 		case "cls":
-			item.SlabClassID, _ = strconv.ParseUint(string(kv[1]), 10, 32)
+			item.SlabClassID, err = strconv.ParseUint(string(value), 10, 32)
 		case "size":
-			item.Size, _ = strconv.ParseUint(string(kv[1]), 10, 64)
+			item.Size, err = strconv.ParseUint(string(value), 10, 64)
+		}
+		if err != nil {
+			return errors.Wrapf(ErrMalformedResponse, "invalid field %q", fields[i])
+		}
+	}
+
+	return casErr
+}
+
+// decodeMetaDebugKey decodes the key in the response of me command, which is base64
+// encoded if the b flag is among the fields.
+func decodeMetaDebugKey(key []byte, fields [][]byte) ([]byte, error) {
+	for _, field := range fields {
+		if len(field) == 1 && field[0] == 'b' {
+			return base64Decode(key)
 		}
 	}
 
-	return nil
+	return bytes.Clone(key), nil
 }
 
 func buildMetaNoOpCommand() (*request, *response) {
-	req := buildRequest([]byte("mn"), nil, []byte("noop\r\n"))
+	req := buildRequest([]byte("mn"), nil, []byte("mn\r\n"))
 	resp := buildLimitedLineResponse(1)
 	return req, resp
 }
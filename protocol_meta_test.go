@@ -195,6 +195,80 @@ func Test_parseMetaItem(t *testing.T) {
 	}
 }
 
+func Test_parseMetaItemDebug(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *MetaItemDebug
+		wantErr error
+	}{
+		{
+			name: "all fields",
+			line: "ME foo exp=-1 la=2 cas=18 fetch=yes cls=1 size=65\r\n",
+			want: &MetaItemDebug{Key: []byte("foo"), TTL: -1, LastAssessTime: 2, CAS: 18, HitBefore: true, SlabClassID: 1, Size: 65},
+		},
+		{
+			name: "base64 key marked by b",
+			line: "ME AAEC exp=30 la=0 cas=1 fetch=no cls=2 size=70 b\r\n",
+			want: &MetaItemDebug{Key: []byte{0, 1, 2}, TTL: 30, CAS: 1, SlabClassID: 2, Size: 70},
+		},
+		{
+			name: "unmarked key is kept",
+			line: "ME foo%2Fbar exp=-1 la=0 cas=1 fetch=no cls=1 size=65\r\n",
+			want: &MetaItemDebug{Key: []byte("foo%2Fbar"), TTL: -1, CAS: 1, SlabClassID: 1, Size: 65},
+		},
+		{
+			name: "unmarked base64-like key is kept",
+			line: "ME AAEC exp=30 la=0 cas=1 fetch=no cls=2 size=70\r\n",
+			want: &MetaItemDebug{Key: []byte("AAEC"), TTL: 30, CAS: 1, SlabClassID: 2, Size: 70},
+		},
+		{
+			name: "unknown fields are ignored",
+			line: "ME foo exp=-1 la=2 cas=18 fetch=no cls=1 size=65 x new=1\r\n",
+			want: &MetaItemDebug{Key: []byte("foo"), TTL: -1, LastAssessTime: 2, CAS: 18, SlabClassID: 1, Size: 65},
+		},
+		{
+			name:    "miss",
+			line:    "EN\r\n",
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "missing key",
+			line:    "ME\r\n",
+			wantErr: ErrMalformedResponse,
+		},
+		{
+			name:    "invalid number",
+			line:    "ME foo exp=never\r\n",
+			wantErr: ErrMalformedResponse,
+		},
+		{
+			name:    "invalid fetch",
+			line:    "ME foo fetch=maybe\r\n",
+			wantErr: ErrMalformedResponse,
+		},
+		{
+			name:    "invalid base64 key",
+			line:    "ME !!! exp=-1 b\r\n",
+			wantErr: ErrMalformedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &MetaItemDebug{}
+			err := parseMetaItemDebug([][]byte{[]byte(tt.line)}, item)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, item)
+		})
+	}
+}
+
 func Test_parseMetaItemPreservesEncodedValue(t *testing.T) {
 	src := []byte("hello hello hello hello hello hello")
 	codec := mustCompressCodec(t, memcodec.CompressionAlgorithmDeflate, 1, 6)
@@ -265,8 +339,8 @@ func Test_buildMetaArithmeticCommand(t *testing.T) {
 				v: true,
 				k: true,
 			},
-			wantRequestRaw:    []byte("ma Zm9v b C1 E2 N3 J4 D64 T6 MD O7 q t c v k\r\n"),
-			wantRespIndicator: endIndicatorNoReply,
+			wantRequestRaw:    []byte("ma Zm9v b C1 E2 N3 J4 D64 T6 MD O7 q t c v k\r\nmn\r\n"),
+			wantRespIndicator: endIndicatorFenced,
 		},
 		{
 			name: "normal:not binary no quite increment",
@@ -289,6 +363,17 @@ func Test_buildMetaArithmeticCommand(t *testing.T) {
 			wantRequestRaw:    []byte("ma foo C1 E2 N3 J4 D64 T6 MI O7 t c v k\r\n"),
 			wantRespIndicator: endIndicatorLimitedLines,
 		},
+		{
+			name: "normal:auto create never expires",
+			flags: &metaArithmeticFlags{
+				N: 0,
+				n: true,
+				J: 4,
+				v: true,
+			},
+			wantRequestRaw:    []byte("ma foo N0 J4 D64 v\r\n"),
+			wantRespIndicator: endIndicatorLimitedLines,
+		},
 	}
 
 	for _, tt := range tests {
@@ -332,8 +417,8 @@ func Test_buildMetaGetCommand(t *testing.T) {
 				X: true,
 				Z: true,
 			},
-			wantRequestRaw:    []byte("mg Zm9v b c f h k l O1 q s t u v E2 N3 R4 T5\r\n"),
-			wantRespIndicator: endIndicatorNoReply,
+			wantRequestRaw:    []byte("mg Zm9v b c f h k l O1 q s t u v E2 N3 R4 T5\r\nmn\r\n"),
+			wantRespIndicator: endIndicatorFenced,
 		},
 		{
 			name: "normal2:not binary no quite",
@@ -380,6 +465,37 @@ func Test_buildMetaGetCommandDoesNotApplyCodecToKey(t *testing.T) {
 	assert.Contains(t, string(req.raw), "mg foo")
 }
 
+func Test_buildMetaNoOpCommand(t *testing.T) {
+	req, resp := buildMetaNoOpCommand()
+	defer releaseReqAndResp(req, resp)
+
+	assert.Equal(t, []byte("mn\r\n"), req.raw)
+	assert.Equal(t, endIndicatorLimitedLines, resp.endIndicator)
+}
+
+func Test_metaSetMode_token(t *testing.T) {
+	// the server only checks the first character, "add" would be taken as append.
+	assert.Equal(t, "E", MetaSetModeAdd.token())
+	assert.Equal(t, "R", MetaSetModeReplace.token())
+	assert.Equal(t, "A", MetaSetModeAppend.token())
+	assert.Equal(t, "P", MetaSetModePrepend.token())
+	assert.Equal(t, "S", MetaSetModeSet.token())
+}
+
+func Test_buildMetaTouchCommand(t *testing.T) {
+	req, resp := buildMetaTouchCommand([]byte("foo"), 0, 1, true)
+	defer releaseReqAndResp(req, resp)
+
+	// T0 is sent to make the item never expire.
+	assert.Equal(t, "mg foo T0 q O1\r\nmn\r\n", string(req.raw))
+	assert.Equal(t, endIndicatorFenced, resp.endIndicator)
+
+	// the miss is replied as EN unless it's quiet.
+	req, resp = buildMetaTouchCommand([]byte("foo"), 60, 2, false)
+	defer releaseReqAndResp(req, resp)
+	assert.Equal(t, "mg foo T60 O2\r\n", string(req.raw))
+}
+
 func Test_buildMetaSetCommand(t *testing.T) {
 	key := []byte("foo")
 	value := []byte("bar")
@@ -407,8 +523,8 @@ func Test_buildMetaSetCommand(t *testing.T) {
 				M: MetaSetModeSet,
 				N: 6,
 			},
-			wantRequestRaw:    []byte("ms Zm9v 3 b c C1 E2 F3 I k O4 q s T5 Mset N6\r\nbar\r\n"),
-			wantRespIndicator: endIndicatorNoReply,
+			wantRequestRaw:    []byte("ms Zm9v 3 b c C1 E2 F3 I k O4 q s T5 MS N6\r\nbar\r\nmn\r\n"),
+			wantRespIndicator: endIndicatorFenced,
 		},
 		{
 			name: "normal2:not binary no quite replace",
@@ -427,7 +543,7 @@ func Test_buildMetaSetCommand(t *testing.T) {
 				M: MetaSetModeReplace,
 				N: 6,
 			},
-			wantRequestRaw:    []byte("ms foo 3 c C1 E2 F3 I k O4 s T5 Mreplace N6\r\nbar\r\n"),
+			wantRequestRaw:    []byte("ms foo 3 c C1 E2 F3 I k O4 s T5 MR N6\r\nbar\r\n"),
 			wantRespIndicator: endIndicatorLimitedLines,
 		},
 		{
@@ -8,6 +8,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	memcodec "github.com/yeqown/memcached/codec"
 )
 
@@ -184,7 +185,7 @@ func Test_parseValueItemsDecodesAppFlags(t *testing.T) {
 }
 
 func Test_buildGetAndTouchesCommand(t *testing.T) {
-	req, resp := buildGetAndTouchesCommand("gats", time.Second, "key1", "key2")
+	req, resp := buildGetAndTouchesCommand("gats", FromDuration(time.Second), "key1", "key2")
 	defer releaseReqAndResp(req, resp)
 
 	assert.Equal(t, []byte("gats 1 key1 key2\r\n"), req.raw)
@@ -193,6 +194,22 @@ func Test_buildGetAndTouchesCommand(t *testing.T) {
 	assert.Len(t, resp.rawLines, 0)
 }
 
+func Test_buildGetsCommand_routingKey(t *testing.T) {
+	// the command with only one key is routed by it.
+	req, resp := buildGetsCommand("get", "key1")
+	assert.Equal(t, []byte("key1"), req.key)
+	releaseReqAndResp(req, resp)
+
+	req, resp = buildGetAndTouchesCommand("gat", FromDuration(time.Second), "key1")
+	assert.Equal(t, []byte("key1"), req.key)
+	releaseReqAndResp(req, resp)
+
+	// the command with multiple keys could not be routed by any of them.
+	req, resp = buildGetsCommand("gets", "key1", "key2")
+	assert.Nil(t, req.key)
+	releaseReqAndResp(req, resp)
+}
+
 func constructParts(raw []byte) [][]byte {
 	return bytes.Split(trimCRLF(raw), []byte(" "))
 }
@@ -439,3 +456,41 @@ func Test_parseStats(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseCAS(t *testing.T) {
+	cas, err := parseCAS([]byte("18446744073709551615"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(18446744073709551615), cas)
+
+	for token, want := range map[string]error{
+		"18446744073709551616": strconv.ErrRange,
+		"-1":                   strconv.ErrSyntax,
+		"0x1f":                 strconv.ErrSyntax,
+	} {
+		cas, err = parseCAS([]byte(token))
+		assert.Zero(t, cas)
+		var casErr *CASParseError
+		require.ErrorAs(t, err, &casErr, token)
+		assert.Equal(t, token, casErr.Token)
+		assert.ErrorIs(t, err, want, token)
+	}
+
+	// the item is kept with CAS 0, and the error is returned along with the items.
+	items, err := parseValueItems([][]byte{
+		[]byte("VALUE foo 0 3 18446744073709551616"), []byte("bar"),
+		[]byte("VALUE baz 0 3 12"), []byte("qux"),
+		[]byte("END"),
+	}, false, true, memcodec.Noop)
+	require.True(t, isCASParseError(err))
+	require.Len(t, items, 2)
+	assert.Zero(t, items[0].CAS)
+	assert.Equal(t, uint64(12), items[1].CAS)
+
+	// the meta flag 'c' is parsed the same way, the other flags are still parsed.
+	item := &MetaItem{}
+	err = parseMetaItem([][]byte{[]byte("VA 3 c99999999999999999999 f5"), []byte("bar")}, item, false, memcodec.Noop)
+	require.True(t, isCASParseError(err))
+	assert.Zero(t, item.CAS)
+	assert.Equal(t, uint32(5), item.Flags)
+	assert.Equal(t, []byte("bar"), item.Value)
+}
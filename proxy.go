@@ -0,0 +1,456 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultProxyDialTimeout is the default timeout of Proxy to dial the upstream.
+const defaultProxyDialTimeout = 5 * time.Second
+
+// _ReplayMismatchBytes is replied by the replaying Proxy to the request which is
+// not recorded.
+var _ReplayMismatchBytes = []byte("SERVER_ERROR replay mismatch\r\n")
+
+// ProxyExchange is one request and its reply relayed by Proxy, it's recorded as a
+// line of JSON by ProxyRecorder and replayed by ProxyReplay. The quiet and noreply
+// commands are recorded along with the next command which has a reply.
+type ProxyExchange struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	Request  []byte    `json:"request"`
+	Response []byte    `json:"response"`
+}
+
+// ReadProxyExchanges reads the exchanges recorded by ProxyRecorder.
+func ReadProxyExchanges(r io.Reader) ([]*ProxyExchange, error) {
+	var exchanges []*ProxyExchange
+
+	dec := json.NewDecoder(r)
+	for {
+		e := &ProxyExchange{}
+		err := dec.Decode(e)
+		if errors.Is(err, io.EOF) {
+			return exchanges, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode exchange %d", len(exchanges)+1)
+		}
+		exchanges = append(exchanges, e)
+	}
+}
+
+// ProxyOption configures the Proxy.
+type ProxyOption func(*Proxy)
+
+// ProxyWireLogger logs the commands relayed by the Proxy and their replies, see
+// WireLogger for the format.
+func ProxyWireLogger(l *WireLogger) ProxyOption {
+	return func(p *Proxy) {
+		p.logger = l
+	}
+}
+
+// ProxyRecorder records the exchanges relayed by the Proxy to w, one line of JSON
+// per exchange, so that they could be replayed by ProxyReplay.
+func ProxyRecorder(w io.Writer) ProxyOption {
+	return func(p *Proxy) {
+		p.recorder = json.NewEncoder(w)
+	}
+}
+
+// ProxyReplay makes the Proxy reply the recorded exchanges rather than relaying
+// the commands to the upstream. Each request is replied by the first exchange not
+// replayed yet which has the same request, and the request not recorded is replied
+// by "SERVER_ERROR replay mismatch".
+func ProxyReplay(exchanges []*ProxyExchange) ProxyOption {
+	return func(p *Proxy) {
+		p.replay = exchanges
+		p.replayed = make([]bool, len(exchanges))
+	}
+}
+
+// ProxyDialTimeout sets the timeout to dial the upstream, default is 5s.
+func ProxyDialTimeout(d time.Duration) ProxyOption {
+	return func(p *Proxy) {
+		if d > 0 {
+			p.dialTimeout = d
+		}
+	}
+}
+
+// Proxy sits between the applications and a memcached server to debug the traffic,
+// it relays the commands of each client connection over a connection to the upstream,
+// logs them with the replies by WireLogger, and records them to be replayed later:
+//
+//	recording, _ := os.Create("session.jsonl")
+//	proxy := memcached.NewProxy("10.0.0.1:11211", memcached.ProxyRecorder(recording),
+//		memcached.ProxyWireLogger(memcached.NewWireLogger(os.Stderr)))
+//	ln, _ := net.Listen("tcp", "127.0.0.1:11311")
+//	err := proxy.Serve(ln)
+//
+// The replies are framed by the same parsers of the client, so that the exchanges
+// are attributed to the commands correctly. A replaying Proxy serves the recorded
+// replies without upstream, so that the bugs caused by the replies, e.g. a garbled
+// reply of touch, are reproduced deterministically.
+//
+// The quiet meta commands must be fenced by mn as the client does, since their
+// replies are framed by it. The connection falls back to relay the bytes as they
+// are once a reply could not be framed, e.g. a malformed one.
+type Proxy struct {
+	upstream    string
+	dialTimeout time.Duration
+	logger      *WireLogger
+
+	mu       sync.Mutex // guards following
+	recorder *json.Encoder
+	replay   []*ProxyExchange
+	replayed []bool
+	closed   bool
+	lns      map[net.Listener]struct{}
+	conns    map[net.Conn]struct{}
+
+	wg sync.WaitGroup
+}
+
+// NewProxy creates the Proxy relaying the commands to the memcached server at the
+// upstream address, e.g. "localhost:11211" or "unix:///tmp/memcached.sock". The
+// upstream is ignored by ProxyReplay.
+func NewProxy(upstream string, opts ...ProxyOption) *Proxy {
+	p := &Proxy{
+		upstream:    upstream,
+		dialTimeout: defaultProxyDialTimeout,
+		lns:         make(map[net.Listener]struct{}, 1),
+		conns:       make(map[net.Conn]struct{}, 8),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Serve accepts the client connections from ln and serves each of them until it's
+// closed, it blocks until ln fails or the Proxy is closed.
+func (p *Proxy) Serve(ln net.Listener) error {
+	var addr *Addr
+	if p.replay == nil {
+		addrs, err := defaultResolver{}.Resolve(p.upstream)
+		if err != nil {
+			return errors.Wrap(err, "resolve upstream")
+		}
+		addr = addrs[0]
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errors.New("proxy is closed")
+	}
+	p.lns[ln] = struct{}{}
+	p.mu.Unlock()
+
+	for {
+		cn, err := ln.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		if !p.track(cn) {
+			_ = cn.Close()
+			return nil
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer p.untrack(cn)
+			p.serveConn(cn, addr)
+		}()
+	}
+}
+
+// Close stops the listeners and closes the client connections.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	for ln := range p.lns {
+		_ = ln.Close()
+	}
+	for cn := range p.conns {
+		_ = cn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
+
+func (p *Proxy) track(cn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.conns[cn] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(cn net.Conn) {
+	p.mu.Lock()
+	delete(p.conns, cn)
+	p.mu.Unlock()
+
+	_ = cn.Close()
+}
+
+// serveConn relays the commands of the client connection to the upstream at addr,
+// or replies the recorded exchanges if addr is nil.
+func (p *Proxy) serveConn(client net.Conn, addr *Addr) {
+	var (
+		upstream net.Conn
+		upR      *bufio.Reader
+		err      error
+	)
+	if addr != nil {
+		upstream, err = addr.dial(context.Background(), p.dialTimeout, nil)
+		if err != nil {
+			_, _ = client.Write([]byte("SERVER_ERROR proxy: " + err.Error() + "\r\n"))
+			return
+		}
+		defer func() { _ = upstream.Close() }()
+		upR = bufio.NewReader(upstream)
+	} else {
+		addr = NewAddr("tcp", "replay", 0)
+	}
+
+	clientR := bufio.NewReader(client)
+	// pending holds the quiet and noreply commands relayed since the last reply.
+	var pending []byte
+	for {
+		raw, fields, err := readProxyCommand(clientR)
+		if err != nil {
+			if len(pending) > 0 {
+				p.record(client, pending, nil)
+			}
+			return
+		}
+		if string(fields[0]) == "quit" {
+			if upstream != nil {
+				_, _ = upstream.Write(raw)
+			}
+			return
+		}
+
+		resp := proxyResponse(fields)
+		pending = append(pending, raw...)
+		if upstream != nil {
+			if _, err = upstream.Write(raw); err != nil {
+				return
+			}
+		}
+		if resp == nil {
+			continue
+		}
+
+		var reply []byte
+		if upstream != nil {
+			tap := &tapConn{rr: upR}
+			err = resp.recv(context.Background(), tap, 0)
+			reply = tap.tapped
+		} else {
+			reply = p.replayReply(pending)
+			err = resp.recv(context.Background(), &tapConn{rr: bufio.NewReader(bytes.NewReader(reply))}, 0)
+		}
+
+		req := buildRequest(fields[0], nil, pending)
+		p.logger.log(addr, req, resp, err)
+		desynced := resp.desynced(err)
+		releaseReqAndResp(req, resp)
+
+		p.record(client, pending, reply)
+		pending = nil
+		if _, werr := client.Write(reply); werr != nil {
+			return
+		}
+
+		if desynced {
+			if upstream == nil || !isMalformed(err) {
+				return
+			}
+			// the replies could not be framed any more, relay the bytes as they are.
+			relayRaw(client, clientR, upstream, upR)
+			return
+		}
+	}
+}
+
+// replayReply returns the recorded reply of the request, see ProxyReplay.
+func (p *Proxy) replayReply(request []byte) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, e := range p.replay {
+		if !p.replayed[i] && bytes.Equal(e.Request, request) {
+			p.replayed[i] = true
+			return e.Response
+		}
+	}
+
+	return _ReplayMismatchBytes
+}
+
+// record writes the exchange to the recorder if any.
+func (p *Proxy) record(client net.Conn, request, response []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.recorder == nil {
+		return
+	}
+	_ = p.recorder.Encode(&ProxyExchange{
+		Time:     time.Now().UTC(),
+		Client:   client.RemoteAddr().String(),
+		Request:  request,
+		Response: response,
+	})
+}
+
+// isMalformed reports whether the reply could not be framed.
+func isMalformed(err error) bool {
+	return errors.Is(err, ErrMalformedResponse)
+}
+
+// relayRaw relays the bytes between the client and the upstream until either side
+// is closed, the buffered bytes are relayed first.
+func relayRaw(client net.Conn, clientR *bufio.Reader, upstream net.Conn, upR *bufio.Reader) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(upstream, clientR)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upR)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// readProxyCommand reads a command line and its data block if any from the client,
+// the fields of the command line are returned too.
+//
+// <command name> <key> <flags> <exptime> <bytes> [noreply]\r\n<data block>\r\n
+// ms <key> <datalen> <flags>*\r\n<data block>\r\n
+func readProxyCommand(rr *bufio.Reader) (raw []byte, fields [][]byte, err error) {
+	for len(fields) == 0 {
+		raw, err = rr.ReadBytes('\n')
+		if err != nil {
+			return nil, nil, err
+		}
+		fields = bytes.Fields(raw)
+	}
+
+	sizeIndex := -1
+	switch string(fields[0]) {
+	case "set", "add", "replace", "append", "prepend", "cas":
+		sizeIndex = 4
+	case "ms":
+		sizeIndex = 2
+	}
+	if sizeIndex < 0 || len(fields) <= sizeIndex {
+		return raw, fields, nil
+	}
+
+	size, err := strconv.Atoi(string(fields[sizeIndex]))
+	if err != nil || size < 0 || size > maxValueSize {
+		// the server replies the error without reading the data block.
+		return raw, fields, nil
+	}
+	block := make([]byte, size+2)
+	if _, err = io.ReadFull(rr, block); err != nil {
+		return nil, nil, err
+	}
+
+	return append(raw, block...), fields, nil
+}
+
+// proxyResponse returns the response to read the reply of the command, nil if the
+// command has no reply, e.g. with noreply or the quiet mode.
+func proxyResponse(fields [][]byte) *response {
+	last := string(fields[len(fields)-1])
+	switch cmd := string(fields[0]); cmd {
+	case "get", "gets", "gat", "gats", "stats", "lru_crawler":
+		if cmd == "lru_crawler" && (len(fields) < 2 || string(fields[1]) != "metadump") {
+			return buildLimitedLineResponse(1)
+		}
+		return buildSpecEndLineResponse(_EndCRLFBytes, 0)
+	case "mn":
+		return buildFencedResponse()
+	case "mg", "ms", "md", "ma":
+		for _, flag := range fields[2:] {
+			if string(flag) == "q" {
+				return nil
+			}
+		}
+		return buildLimitedLineResponse(1)
+	default:
+		if last == "noreply" {
+			return nil
+		}
+		return buildLimitedLineResponse(1)
+	}
+}
+
+// tapConn is the memcachedConn reading the replies relayed by Proxy, it keeps the
+// bytes read so that they're relayed to the client as they are.
+type tapConn struct {
+	rr     *bufio.Reader
+	tapped []byte
+}
+
+var _ memcachedConn = (*tapConn)(nil)
+
+func (t *tapConn) readLine(delim byte) ([]byte, error) {
+	line, err := t.rr.ReadBytes(delim)
+	t.tapped = append(t.tapped, line...)
+	return line, err
+}
+
+func (t *tapConn) Read(p []byte) (int, error) {
+	n, err := t.rr.Read(p)
+	t.tapped = append(t.tapped, p[:n]...)
+	return n, err
+}
+
+func (t *tapConn) Write([]byte) (int, error) { return 0, errors.New("tapConn is read only") }
+
+func (t *tapConn) Close() error { return nil }
+
+func (t *tapConn) expired(time.Time) (time.Duration, bool) { return 0, false }
+
+func (t *tapConn) idle(time.Time) (time.Duration, bool) { return 0, false }
+
+func (t *tapConn) release() error { return nil }
+
+func (t *tapConn) setConnPool(*connPool) {}
+
+func (t *tapConn) getConnPool() *connPool { return nil }
+
+func (t *tapConn) setReadDeadline(time.Time) error { return nil }
+
+func (t *tapConn) setWriteDeadline(time.Time) error { return nil }
@@ -0,0 +1,137 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeqown/memcached/internal/testserver"
+)
+
+// startProxy serves the proxy on a random local port and returns its address.
+func startProxy(t *testing.T, p *Proxy) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() { _ = p.Serve(ln) }()
+	t.Cleanup(func() { _ = p.Close() })
+
+	return ln.Addr().String()
+}
+
+func Test_readProxyCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantRaw string
+	}{
+		{name: "get", input: "get foo bar\r\nversion\r\n", wantRaw: "get foo bar\r\n"},
+		{name: "set", input: "set foo 0 0 5\r\nhello\r\nversion\r\n", wantRaw: "set foo 0 0 5\r\nhello\r\n"},
+		{name: "ms", input: "ms foo 2 T0 q\r\nhi\r\nmn\r\n", wantRaw: "ms foo 2 T0 q\r\nhi\r\n"},
+		{name: "empty lines", input: "\r\n\r\nmn\r\n", wantRaw: "mn\r\n"},
+		{name: "invalid size", input: "set foo 0 0 x\r\nversion\r\n", wantRaw: "set foo 0 0 x\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, fields, err := readProxyCommand(bufio.NewReader(strings.NewReader(tt.input)))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRaw, string(raw))
+			assert.NotEmpty(t, fields)
+		})
+	}
+}
+
+func Test_proxyResponse(t *testing.T) {
+	tests := []struct {
+		line      string
+		wantReply bool
+	}{
+		{line: "get foo", wantReply: true},
+		{line: "stats settings", wantReply: true},
+		{line: "lru_crawler metadump all", wantReply: true},
+		{line: "touch foo 10", wantReply: true},
+		{line: "touch foo 10 noreply", wantReply: false},
+		{line: "mg foo v", wantReply: true},
+		{line: "mg foo v q", wantReply: false},
+		{line: "mn", wantReply: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			resp := proxyResponse(bytes.Fields([]byte(tt.line)))
+			assert.Equal(t, tt.wantReply, resp != nil)
+			if resp != nil {
+				resp.release()
+			}
+		})
+	}
+}
+
+func Test_Proxy_recordAndReplay(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+
+	// session runs the commands through the proxy, the touch is garbled by the
+	// server while recording.
+	session := func(t *testing.T, addr string, garble func()) {
+		c, err := New(addr)
+		require.NoError(t, err)
+		defer c.Close()
+
+		require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+		item, err := c.Get(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(item.Value))
+
+		garble()
+		err = c.Touch(ctx, "foo", time.Minute)
+		require.ErrorIs(t, err, ErrMalformedResponse)
+	}
+
+	var recording, wire bytes.Buffer
+	recorder := NewProxy(srv.Addr(), ProxyRecorder(&recording), ProxyWireLogger(NewWireLogger(&wire)))
+	session(t, startProxy(t, recorder), func() { srv.InjectFaults(testserver.FaultGarbage) })
+	require.NoError(t, recorder.Close())
+
+	assert.Contains(t, wire.String(), `> "get foo\r\n"`)
+	assert.Contains(t, wire.String(), `< "VALUE foo 0 3\r\n"`)
+
+	exchanges, err := ReadProxyExchanges(&recording)
+	require.NoError(t, err)
+	// the version probed by the client, set, get and touch.
+	require.Len(t, exchanges, 4)
+	assert.Equal(t, "touch foo 60\r\n", string(exchanges[3].Request))
+	assert.Equal(t, "#$%^&* garbage\r\n", string(exchanges[3].Response))
+
+	// the garbled touch is reproduced without the server.
+	replayer := NewProxy("", ProxyReplay(exchanges))
+	session(t, startProxy(t, replayer), func() {})
+}
+
+func Test_Proxy_replayMismatch(t *testing.T) {
+	// the first version is probed by the client.
+	p := NewProxy("", ProxyReplay([]*ProxyExchange{
+		{Request: []byte("version\r\n"), Response: []byte("VERSION 1.6.0\r\n")},
+		{Request: []byte("version\r\n"), Response: []byte("VERSION 1.6.0\r\n")},
+	}))
+
+	c, err := New(startProxy(t, p))
+	require.NoError(t, err)
+	defer c.Close()
+
+	version, err := c.Version(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.6.0", version)
+
+	// the exchange is replayed only once.
+	_, err = c.Version(context.Background())
+	require.ErrorContains(t, err, "replay mismatch")
+}
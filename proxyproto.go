@@ -0,0 +1,135 @@
+package memcached
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ProxyProtocol is the version of the HAProxy PROXY protocol header sent by the
+// client right after connecting, see WithProxyProtocol.
+// https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+type ProxyProtocol uint8
+
+const (
+	// ProxyProtocolNone disables the PROXY header.
+	ProxyProtocolNone ProxyProtocol = iota
+	// ProxyProtocolV1 is the human-readable header, e.g. "PROXY TCP4 ...\r\n".
+	ProxyProtocolV1
+	// ProxyProtocolV2 is the binary header.
+	ProxyProtocolV2
+)
+
+func (p ProxyProtocol) String() string {
+	switch p {
+	case ProxyProtocolNone:
+		return "none"
+	case ProxyProtocolV1:
+		return "v1"
+	case ProxyProtocolV2:
+		return "v2"
+	}
+
+	return "unknown(" + strconv.Itoa(int(p)) + ")"
+}
+
+// proxyProtocolV2Signature is the signature of the PROXY protocol v2 header.
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	// proxyProtocolV2Proxy is the version (high 4 bits) and the command PROXY (low 4 bits).
+	proxyProtocolV2Proxy = 0x21
+	// the address family (high 4 bits) and the transport protocol STREAM (low 4 bits).
+	proxyProtocolV2TCP4   = 0x11
+	proxyProtocolV2TCP6   = 0x21
+	proxyProtocolV2Unspec = 0x00
+)
+
+// buildProxyHeader builds the PROXY header of the version for the connection
+// from src to dst. The addresses which are not TCP, e.g. unix sockets, are sent
+// as UNKNOWN (v1) or UNSPEC (v2), so the proxy uses the real connection addresses.
+func buildProxyHeader(version ProxyProtocol, src, dst net.Addr) ([]byte, error) {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	known := ok1 && ok2
+
+	// both addresses must be of the same family, the IPv4 ones are mapped to IPv6 if mixed.
+	var srcIP, dstIP net.IP
+	ipv4 := false
+	if known {
+		srcIP, dstIP = srcTCP.IP.To4(), dstTCP.IP.To4()
+		ipv4 = srcIP != nil && dstIP != nil
+		if !ipv4 {
+			srcIP, dstIP = srcTCP.IP.To16(), dstTCP.IP.To16()
+			known = srcIP != nil && dstIP != nil
+		}
+	}
+
+	switch version {
+	case ProxyProtocolV1:
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+
+		family := "TCP6"
+		if ipv4 {
+			family = "TCP4"
+		}
+		header := "PROXY " + family + " " + srcIP.String() + " " + dstIP.String() + " " +
+			strconv.Itoa(srcTCP.Port) + " " + strconv.Itoa(dstTCP.Port) + "\r\n"
+		return []byte(header), nil
+	case ProxyProtocolV2:
+		header := make([]byte, 0, 16+36)
+		header = append(header, proxyProtocolV2Signature...)
+		header = append(header, proxyProtocolV2Proxy)
+
+		var addrs []byte
+		switch {
+		case !known:
+			header = append(header, proxyProtocolV2Unspec)
+		case ipv4:
+			header = append(header, proxyProtocolV2TCP4)
+		default:
+			header = append(header, proxyProtocolV2TCP6)
+		}
+		if known {
+			addrs = append(addrs, srcIP...)
+			addrs = append(addrs, dstIP...)
+			addrs = binary.BigEndian.AppendUint16(addrs, uint16(srcTCP.Port))
+			addrs = binary.BigEndian.AppendUint16(addrs, uint16(dstTCP.Port))
+		}
+
+		header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+		return append(header, addrs...), nil
+	}
+
+	return nil, errors.Wrapf(ErrInvalidArgument, "proxy protocol %s", version)
+}
+
+// sendProxyHeader sends the PROXY header over the connection just dialed, before
+// any other bytes. The source address is the one set by WithProxyProtocol, or the
+// local address of the connection.
+func (c *client) sendProxyHeader(ctx context.Context, addr *Addr, cn *conn) error {
+	src := c.options.proxySourceAddr
+	if src == nil {
+		src = cn.raw.LocalAddr()
+	}
+
+	header, err := buildProxyHeader(c.options.proxyProtocol, src, cn.raw.RemoteAddr())
+	if err != nil {
+		return err
+	}
+
+	if has := selectProximateDeadline(ctx, cn, c.writeTimeout(addr), nowFunc, false); has {
+		defer func() { _ = cn.setWriteDeadline(zeroTime) }()
+	}
+
+	if _, err = cn.Write(header); err != nil {
+		return errors.Wrap(err, "write proxy protocol header")
+	}
+
+	return nil
+}
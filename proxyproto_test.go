@@ -0,0 +1,141 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_buildProxyHeader(t *testing.T) {
+	src4 := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324}
+	dst4 := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 11211}
+	src6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}
+	unix := &net.UnixAddr{Name: "/tmp/memcached.sock", Net: "unix"}
+
+	tests := []struct {
+		name    string
+		version ProxyProtocol
+		src     net.Addr
+		dst     net.Addr
+		want    string
+		wantHex string
+		wantErr error
+	}{
+		{
+			name:    "v1 tcp4",
+			version: ProxyProtocolV1,
+			src:     src4,
+			dst:     dst4,
+			want:    "PROXY TCP4 192.168.0.1 10.0.0.2 56324 11211\r\n",
+		},
+		{
+			name:    "v1 mixed families mapped to tcp6",
+			version: ProxyProtocolV1,
+			src:     src6,
+			dst:     dst4,
+			want:    "PROXY TCP6 2001:db8::1 10.0.0.2 56324 11211\r\n",
+		},
+		{
+			name:    "v1 unix",
+			version: ProxyProtocolV1,
+			src:     unix,
+			dst:     unix,
+			want:    "PROXY UNKNOWN\r\n",
+		},
+		{
+			name:    "v2 tcp4",
+			version: ProxyProtocolV2,
+			src:     src4,
+			dst:     dst4,
+			wantHex: "0d0a0d0a000d0a515549540a" + "21" + "11" + "000c" + "c0a80001" + "0a000002" + "dc04" + "2bcb",
+		},
+		{
+			name:    "v2 tcp6",
+			version: ProxyProtocolV2,
+			src:     src6,
+			dst:     src6,
+			wantHex: "0d0a0d0a000d0a515549540a" + "21" + "21" + "0024" +
+				"20010db8000000000000000000000001" + "20010db8000000000000000000000001" + "dc04" + "dc04",
+		},
+		{
+			name:    "v2 unix",
+			version: ProxyProtocolV2,
+			src:     unix,
+			dst:     unix,
+			wantHex: "0d0a0d0a000d0a515549540a" + "21" + "00" + "0000",
+		},
+		{
+			name:    "invalid version",
+			version: ProxyProtocol(3),
+			src:     src4,
+			dst:     dst4,
+			wantErr: ErrInvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := buildProxyHeader(tt.version, tt.src, tt.dst)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.wantHex != "" {
+				assert.Equal(t, tt.wantHex, hex.EncodeToString(header))
+				return
+			}
+			assert.Equal(t, tt.want, string(header))
+		})
+	}
+}
+
+func Test_client_WithProxyProtocol(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	lines := make(chan string, 3)
+	go func() {
+		cn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer cn.Close()
+
+		r := bufio.NewReader(cn)
+		for i := 0; i < 3; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+		_, _ = cn.Write([]byte("STORED\r\n"))
+	}()
+
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+	c, err := New(ln.Addr().String(), WithProxyProtocol(ProxyProtocolV1, src),
+		WithCapabilityDetection(false), WithReadTimeout(time.Second))
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+
+	// the header is sent before the first command.
+	header := <-lines
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	assert.Equal(t, "PROXY TCP4 203.0.113.7 127.0.0.1 40000 "+port+"\r\n", header)
+	assert.True(t, strings.HasPrefix(<-lines, "set foo "))
+
+	_, err = New(ln.Addr().String(), WithProxyProtocol(ProxyProtocol(3), nil))
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
@@ -0,0 +1,203 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// awaitWritesInterval is the interval to check whether the connection of a noreply
+// write is returned to the pool or has received a reply, see awaitWrite.
+const awaitWritesInterval = time.Millisecond
+
+// replyCounter is implemented by the connections counting the replies received
+// over them, see WithReadYourWrites.
+type replyCounter interface {
+	// countReply counts a reply received over the connection.
+	countReply()
+	// repliesReceived returns the number of replies received.
+	repliesReceived() uint64
+	// isClosed reports whether the connection is closed.
+	isClosed() bool
+}
+
+var _ replyCounter = (*conn)(nil)
+
+func (c *conn) countReply() { c.replies.Add(1) }
+
+func (c *conn) repliesReceived() uint64 { return c.replies.Load() }
+
+func (c *conn) isClosed() bool {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	return c.closed
+}
+
+// dirtyWrite is a noreply write of a key which is not acknowledged yet.
+type dirtyWrite struct {
+	addr *Addr
+	cn   memcachedConn
+	// replies is the number of replies received over cn before the write, any
+	// reply received after it acknowledges the write.
+	replies uint64
+}
+
+// acked reports whether the write is processed by the server, the write over the
+// closed connection is taken as processed since it's flushed before closing.
+func (w *dirtyWrite) acked() bool {
+	counter := w.cn.(replyCounter)
+	return counter.repliesReceived() > w.replies || counter.isClosed()
+}
+
+// dirtyKeys tracks the keys written by the noreply requests, see WithReadYourWrites.
+type dirtyKeys struct {
+	limit int
+
+	mu   sync.Mutex // guards following
+	keys map[string]*dirtyWrite
+}
+
+func newDirtyKeys(limit int) *dirtyKeys {
+	return &dirtyKeys{limit: limit, keys: make(map[string]*dirtyWrite, min(limit, 1024))}
+}
+
+// mark marks the key written over the connection, it reports false if there are
+// too many dirty keys, and the write should be acknowledged at once.
+func (d *dirtyKeys) mark(key []byte, addr *Addr, cn memcachedConn) bool {
+	counter, ok := cn.(replyCounter)
+	if !ok {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok = d.keys[string(key)]; !ok && len(d.keys) >= d.limit {
+		return false
+	}
+	d.keys[string(key)] = &dirtyWrite{addr: addr, cn: cn, replies: counter.repliesReceived()}
+	return true
+}
+
+// pending returns the writes not acknowledged yet of the key on the server, or of
+// all the keys on the server if all is true, e.g. for the multi-key retrievals.
+func (d *dirtyKeys) pending(addr *Addr, key []byte, all bool) map[string]*dirtyWrite {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var writes map[string]*dirtyWrite
+	add := func(key string, w *dirtyWrite) {
+		if w.acked() {
+			delete(d.keys, key)
+			return
+		}
+		if writes == nil {
+			writes = make(map[string]*dirtyWrite, 1)
+		}
+		writes[key] = w
+	}
+
+	if !all {
+		if w, ok := d.keys[string(key)]; ok && w.addr == addr {
+			add(string(key), w)
+		}
+		return writes
+	}
+
+	for key, w := range d.keys {
+		if w.addr == addr {
+			add(key, w)
+		}
+	}
+	return writes
+}
+
+// clear removes the key if it's still dirty by the given write.
+func (d *dirtyKeys) clear(key string, w *dirtyWrite) {
+	d.mu.Lock()
+	if d.keys[key] == w {
+		delete(d.keys, key)
+	}
+	d.mu.Unlock()
+}
+
+// isMultiKeyRetrieval reports whether the request retrieves multiple keys, which
+// is not routed by any of them, see routingKey.
+func isMultiKeyRetrieval(req *request) bool {
+	if len(req.key) != 0 {
+		return false
+	}
+
+	switch string(req.cmd) {
+	case "get", "gets", "gat", "gats":
+		return true
+	}
+
+	return false
+}
+
+// awaitWrites waits for the noreply writes of the keys of the request to be
+// acknowledged, before the request is sent to the server at addr.
+func (c *client) awaitWrites(ctx context.Context, addr *Addr, req *request) error {
+	all := isMultiKeyRetrieval(req)
+	if len(req.key) == 0 && !all {
+		return nil
+	}
+
+	for key, w := range c.dirty.pending(addr, req.key, all) {
+		if err := c.awaitWrite(ctx, w); err != nil {
+			return err
+		}
+		c.dirty.clear(key, w)
+	}
+
+	return nil
+}
+
+// trackWrite tracks the noreply request sent over the connection, or counts the
+// reply received over it. The write beyond the limit of the dirty keys is fenced
+// by a version command at once.
+func (c *client) trackWrite(ctx context.Context, addr *Addr, cn memcachedConn, req *request, noReply bool) error {
+	if !noReply {
+		if counter, ok := cn.(replyCounter); ok {
+			counter.countReply()
+		}
+		return nil
+	}
+	if len(req.key) == 0 || req.udpEnabled || c.dirty.mark(req.key, addr, cn) {
+		return nil
+	}
+
+	return c.fenceWrites(ctx, addr, cn)
+}
+
+// fenceWrites acknowledges the noreply writes over the connection by a version
+// command, the connection must not be used by others.
+func (c *client) fenceWrites(ctx context.Context, addr *Addr, cn memcachedConn) error {
+	if _, err := c.versionOf(ctx, addr, cn); err != nil {
+		return err
+	}
+
+	cn.(replyCounter).countReply()
+	return nil
+}
+
+// awaitWrite waits for the write to be acknowledged by any reply over its connection.
+// The connection is fenced by a version command if it's idle in the pool, otherwise
+// it's in use and the reply of the request using it acknowledges the write.
+func (c *client) awaitWrite(ctx context.Context, w *dirtyWrite) (err error) {
+	for !w.acked() {
+		if pool := w.cn.getConnPool(); pool != nil && pool.take(w.cn) {
+			err = c.fenceWrites(ctx, w.addr, w.cn)
+			releaseConn(w.cn, err)
+			return err
+		}
+
+		if err = sleepContext(ctx, awaitWritesInterval); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dirtyKeysOf(c Client) int {
+	d := c.(*client).dirty
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.keys)
+}
+
+func Test_client_WithReadYourWrites(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithNoReply(), WithMaxConns(4), WithReadYourWrites(8))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				key := fmt.Sprintf("key-%d-%d", i, n%4)
+				value := []byte(fmt.Sprintf("%d", n))
+				require.NoError(t, c.Set(ctx, key, value, 0, 0))
+
+				item, err := c.Get(ctx, key)
+				require.NoError(t, err)
+				assert.Equal(t, value, item.Value)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), 0, 0))
+	items, err := c.Gets(ctx, "a", "missing")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Zero(t, dirtyKeysOf(c))
+}
+
+func Test_client_WithReadYourWrites_limit(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithNoReply(), WithReadYourWrites(2))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, c.Set(ctx, key, []byte(key), 0, 0))
+	}
+	// the writes beyond the limit are fenced at once, and acknowledge the former
+	// writes over the same connection.
+	assert.LessOrEqual(t, dirtyKeysOf(c), 2)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		item, err := c.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, key, string(item.Value))
+	}
+	assert.Zero(t, dirtyKeysOf(c))
+}
+
+func Test_client_awaitWrite_inUse(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithReadYourWrites(8))
+	require.NoError(t, err)
+	defer c.Close()
+
+	cc := c.(*client)
+	addr := cc.topology().addrs[0]
+	ctx := context.Background()
+	cn, err := cc.getConn(ctx, addr)
+	require.NoError(t, err)
+	require.True(t, cc.dirty.mark([]byte("foo"), addr, cn))
+
+	// the connection is in use, the write is acknowledged by the reply of its user.
+	done := make(chan error, 1)
+	go func() {
+		req, resp := buildGetsCommand("get", "foo")
+		done <- cc.dispatchRequestTo(ctx, addr, req, resp)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("request is not waiting: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cn.(replyCounter).countReply()
+	require.NoError(t, <-done)
+	releaseConn(cn, nil)
+	assert.Zero(t, dirtyKeysOf(c))
+
+	// the idle connection is fenced.
+	cn, err = cc.getConn(ctx, addr)
+	require.NoError(t, err)
+	require.True(t, cc.dirty.mark([]byte("foo"), addr, cn))
+	replies := cn.(replyCounter).repliesReceived()
+	releaseConn(cn, nil)
+	require.NoError(t, cc.awaitWrites(ctx, addr, &request{cmd: []byte("get"), key: []byte("foo"), raw: []byte("get foo\r\n")}))
+	assert.Equal(t, replies+1, cn.(replyCounter).repliesReceived())
+	assert.Zero(t, dirtyKeysOf(c))
+}
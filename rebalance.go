@@ -0,0 +1,352 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	memcodec "github.com/yeqown/memcached/codec"
+)
+
+// _MetadumpKeyPrefix is the prefix of the key of the lines replied by
+// `lru_crawler metadump`, e.g. "key=foo exp=-1 la=1700000000 cas=1 ...".
+var _MetadumpKeyPrefix = []byte("key=")
+
+// RebalanceStats is the progress of Rebalance.
+type RebalanceStats struct {
+	// Scanned is the number of keys dumped from the old servers.
+	Scanned int
+	// Moved is the number of keys copied to their new servers.
+	Moved int
+	// Skipped is the number of keys not copied, since they stay in the same server,
+	// vanished before copied, or are already stored in the new servers.
+	Skipped int
+	// Deleted is the number of keys deleted from the old servers once copied.
+	Deleted int
+	// Failed is the number of keys which could not be copied or deleted.
+	Failed int
+}
+
+// RebalanceOption configures Rebalance.
+type RebalanceOption func(*rebalanceOptions)
+
+type rebalanceOptions struct {
+	clientOptions []ClientOption
+	deleteSource  bool
+	rateLimit     float64
+	progress      func(addr *Addr, stats RebalanceStats)
+}
+
+// RebalanceClientOptions sets the options of the clients to the old and new servers,
+// the hash options (e.g. WithPickBuilder and WithHashTag) must be the same as the
+// ones of the applications, so that the keys are moved to the servers they're
+// picked to.
+func RebalanceClientOptions(opts ...ClientOption) RebalanceOption {
+	return func(o *rebalanceOptions) {
+		o.clientOptions = append(o.clientOptions, opts...)
+	}
+}
+
+// RebalanceDeleteSource makes Rebalance delete the keys from the old servers once
+// they're copied, unless they're modified in between.
+func RebalanceDeleteSource() RebalanceOption {
+	return func(o *rebalanceOptions) {
+		o.deleteSource = true
+	}
+}
+
+// RebalanceRateLimit limits the number of keys moved per second, 0 means unlimited
+// which is the default.
+func RebalanceRateLimit(keysPerSecond float64) RebalanceOption {
+	return func(o *rebalanceOptions) {
+		if keysPerSecond > 0 {
+			o.rateLimit = keysPerSecond
+		}
+	}
+}
+
+// RebalanceProgress sets the function called after each key is handled, with the
+// old server the key is dumped from and the stats so far.
+func RebalanceProgress(fn func(addr *Addr, stats RebalanceStats)) RebalanceOption {
+	return func(o *rebalanceOptions) {
+		o.progress = fn
+	}
+}
+
+// Rebalance moves the keys to the servers they're picked to after the topology is
+// changed from oldAddrs to newAddrs, e.g. a server is leaving the ring or a new one
+// joins it. It dumps the keys of every old server by `lru_crawler metadump all`, and
+// copies each key whose server is changed to its new server, with the flags and the
+// remaining TTL:
+//
+//	stats, err := memcached.Rebalance(ctx, "10.0.0.1:11211,10.0.0.2:11211", "10.0.0.1:11211,10.0.0.3:11211",
+//		memcached.RebalanceClientOptions(memcached.WithPickBuilder(memcached.NewMurmur3HashPickBuilder(42))),
+//		memcached.RebalanceDeleteSource(), memcached.RebalanceRateLimit(1000))
+//
+// The keys are copied by `add`, so that the values written to the new servers since
+// the topology is changed are never overwritten. It's best-effort only: the keys
+// set or deleted during the dump are missed or copied stale, and the dump of each
+// server is read into memory at once.
+//
+// The servers must be memcached 1.6.0 or later, since the keys are read by meta
+// commands. The stats are returned even if some servers or keys fail.
+func Rebalance(ctx context.Context, oldAddrs, newAddrs string, opts ...RebalanceOption) (*RebalanceStats, error) {
+	o := &rebalanceOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	oldClient, err := New(oldAddrs, o.clientOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "create client of old servers")
+	}
+	defer func() { _ = oldClient.Close() }()
+
+	newClient, err := New(newAddrs, o.clientOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "create client of new servers")
+	}
+	defer func() { _ = newClient.Close() }()
+
+	r := &rebalancer{
+		from:    oldClient.(*client),
+		to:      newClient.(*client),
+		options: o,
+		stats:   &RebalanceStats{},
+	}
+	if o.rateLimit > 0 {
+		r.bucket = newTokenBucket(o.rateLimit, 1)
+	}
+
+	var multiErr error
+	for _, addr := range r.from.topology().addrs {
+		if err = r.rebalanceNode(ctx, addr); err != nil {
+			multiErr = multierror.Append(multiErr, newCommandError(addr, []byte("lru_crawler"), nil, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return r.stats, multiErr
+}
+
+// rebalancer moves the keys from the servers of one client to the ones of another.
+type rebalancer struct {
+	from    *client
+	to      *client
+	options *rebalanceOptions
+	bucket  *tokenBucket
+	stats   *RebalanceStats
+}
+
+// rebalanceNode moves the keys of the old server at addr, the error of each key is
+// counted in the stats, and the first one is returned after all the keys are handled.
+func (r *rebalancer) rebalanceNode(ctx context.Context, addr *Addr) error {
+	keys, err := r.from.metadumpKeys(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	var keyErr error
+	for _, key := range keys {
+		r.stats.Scanned++
+
+		if err = r.moveKey(ctx, addr, key); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			r.stats.Failed++
+			if keyErr == nil {
+				keyErr = errors.Wrapf(err, "move %s", key)
+			}
+		}
+
+		if r.options.progress != nil {
+			r.options.progress(addr, *r.stats)
+		}
+	}
+
+	return keyErr
+}
+
+// moveKey copies the key from the old server at addr to its new server if it's
+// changed, and deletes it from the old server if required.
+func (r *rebalancer) moveKey(ctx context.Context, addr *Addr, key string) error {
+	target, err := r.to.pick(ctx, []byte("add"), []byte(key))
+	if err != nil {
+		return errors.Wrap(err, "pick node failed")
+	}
+	if target.Address == addr.Address {
+		r.stats.Skipped++
+		return nil
+	}
+
+	if r.bucket != nil {
+		if err = r.bucket.wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	item, err := r.readRaw(ctx, addr, key)
+	if errors.Is(err, ErrNotFound) {
+		r.stats.Skipped++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	expiry := NoExpiration
+	if item.TTL >= 0 {
+		expiry = FromDuration(time.Duration(max(item.TTL, 1)) * time.Second)
+	}
+
+	req, resp, err := buildStorageCommand("add", key, item.Value, item.Flags, expiry, false, memcodec.Noop)
+	if err != nil {
+		return err
+	}
+	defer releaseReqAndResp(req, resp)
+
+	err = storageReply(resp, r.to.dispatchRequestTo(ctx, target, req, resp))
+	switch {
+	case errors.Is(err, ErrNotStored):
+		r.stats.Skipped++
+		return nil
+	case err != nil:
+		return err
+	}
+	r.stats.Moved++
+
+	if !r.options.deleteSource {
+		return nil
+	}
+
+	return r.deleteRaw(ctx, addr, key, item.CAS)
+}
+
+// readRaw reads the value, client flags, CAS unique and remaining TTL of the key
+// from the server at addr, the value and flags are not decoded by the codec.
+func (r *rebalancer) readRaw(ctx context.Context, addr *Addr, key string) (*MetaItem, error) {
+	req, resp := buildMetaGetCommand([]byte(key), &metaGetFlags{v: true, f: true, c: true, t: true, u: true})
+	defer releaseReqAndResp(req, resp)
+
+	if err := r.from.dispatchRequestTo(ctx, addr, req, resp); err != nil {
+		return nil, err
+	}
+
+	item := &MetaItem{Key: []byte(key)}
+	if err := parseMetaItem(resp.rawLines, item, false, memcodec.Noop); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// deleteRaw deletes the key from the server at addr if its CAS unique is still cas,
+// the key modified since it's read is kept.
+func (r *rebalancer) deleteRaw(ctx context.Context, addr *Addr, key string, cas uint64) error {
+	req, resp := buildMetaDeleteCommand([]byte(key), &metaDeleteFlags{C: cas})
+	defer releaseReqAndResp(req, resp)
+
+	err := r.from.dispatchRequestTo(ctx, addr, req, resp)
+	if err == nil {
+		err = parseMetaItem(resp.rawLines, &MetaItem{}, false, memcodec.Noop)
+	}
+	switch {
+	case errors.Is(err, ErrExists), errors.Is(err, ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	}
+	r.stats.Deleted++
+
+	return nil
+}
+
+// metadumpKeys returns the keys of the server at addr by `lru_crawler metadump all`.
+// ErrNotSupported is returned for the servers other than memcached, or the ones
+// which reject the command, e.g. the lru_crawler is disabled.
+func (c *client) metadumpKeys(ctx context.Context, addr *Addr) ([]string, error) {
+	lines, err := c.metadumpLines(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMetadump(lines)
+}
+
+// metadumpLines returns the lines replied by `lru_crawler metadump all` before END,
+// see metadumpKeys for the errors.
+func (c *client) metadumpLines(ctx context.Context, addr *Addr) (lines [][]byte, err error) {
+	if c.options.compatibility != CompatMemcached {
+		return nil, errors.Wrapf(ErrNotSupported, "lru_crawler metadump with %s", c.options.compatibility)
+	}
+	if err := c.checkFeature(addr, featureMetadump); err != nil {
+		return nil, err
+	}
+	if err := c.checkFeature(addr, featureMeta); err != nil {
+		return nil, err
+	}
+
+	cn, err := c.getConn(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { releaseConn(cn, err) }()
+
+	req, resp := buildMetadumpCommand()
+	defer releaseReqAndResp(req, resp)
+
+	if err = req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
+		return nil, errors.Wrap(err, "send failed")
+	}
+	err = resp.recv(ctx, cn, c.baseReadTimeout(addr))
+	c.options.wireLogger.log(addr, req, resp, err)
+	if err != nil {
+		if errors.Is(err, ErrNonexistentCommand) || errors.Is(err, ErrClientError) {
+			return nil, errors.Wrapf(ErrNotSupported, "lru_crawler metadump: %v", err)
+		}
+		return nil, errors.Wrap(err, "recv failed")
+	}
+
+	// the lines are only valid until the response is released.
+	lines = make([][]byte, 0, len(resp.rawLines))
+	for _, line := range resp.rawLines {
+		if bytes.Equal(line, _EndCRLFBytes) {
+			break
+		}
+		lines = append(lines, bytes.Clone(trimCRLF(line)))
+	}
+
+	return lines, nil
+}
+
+// parseMetadump parses the keys from the reply of `lru_crawler metadump`, e.g.
+// "key=foo exp=-1 la=1700000000 cas=1 fetch=no cls=1 size=3", the keys are URL
+// encoded by the server.
+func parseMetadump(lines [][]byte) ([]string, error) {
+	keys := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if bytes.Equal(line, _EndCRLFBytes) {
+			break
+		}
+
+		field, _, _ := bytes.Cut(trimCRLF(line), _SpaceBytes)
+		if !bytes.HasPrefix(field, _MetadumpKeyPrefix) {
+			return nil, errors.Wrapf(ErrMalformedResponse, "unexpected metadump line %q", trimCRLF(line))
+		}
+
+		key, err := url.QueryUnescape(string(field[len(_MetadumpKeyPrefix):]))
+		if err != nil {
+			return nil, errors.Wrapf(ErrMalformedResponse, "unexpected metadump key %q", field)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,131 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Rebalance(t *testing.T) {
+	srv1, srv2, srv3 := newTestServer(t), newTestServer(t), newTestServer(t)
+	oldAddrs := srv1.Addr() + "," + srv2.Addr()
+	newAddrs := srv1.Addr() + "," + srv3.Addr()
+
+	oldClient, err := New(oldAddrs)
+	require.NoError(t, err)
+	defer oldClient.Close()
+	newClient, err := New(newAddrs)
+	require.NoError(t, err)
+	defer newClient.Close()
+
+	ctx := context.Background()
+	const n = 32
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		require.NoError(t, oldClient.Set(ctx, key, []byte("value-"+key), uint32(i), 0))
+	}
+
+	// the key written to its new server since the topology is changed is kept.
+	var fresh string
+	for i := 0; i < n && fresh == ""; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		oldAddr, _ := oldClient.(*client).pick(context.Background(), nil, []byte(key))
+		newAddr, _ := newClient.(*client).pick(context.Background(), nil, []byte(key))
+		if oldAddr.Address == srv2.Addr() && newAddr.Address == srv3.Addr() {
+			fresh = key
+		}
+	}
+	require.NotEmpty(t, fresh)
+	require.NoError(t, newClient.Set(ctx, fresh, []byte("fresh"), 0, 0))
+
+	progressed := 0
+	stats, err := Rebalance(ctx, oldAddrs, newAddrs,
+		RebalanceDeleteSource(),
+		RebalanceRateLimit(10000),
+		RebalanceProgress(func(addr *Addr, stats RebalanceStats) {
+			progressed++
+			assert.Equal(t, progressed, stats.Scanned)
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, n, stats.Scanned)
+	assert.Equal(t, n, progressed)
+	assert.Equal(t, n, stats.Moved+stats.Skipped)
+	assert.NotZero(t, stats.Moved)
+	assert.Equal(t, stats.Moved, stats.Deleted)
+	assert.Zero(t, stats.Failed)
+
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		item, err := newClient.Get(ctx, key)
+		require.NoError(t, err, key)
+		if key == fresh {
+			assert.Equal(t, "fresh", string(item.Value))
+			continue
+		}
+		assert.Equal(t, "value-"+key, string(item.Value))
+		assert.Equal(t, uint32(i), item.Flags)
+	}
+
+	// the moved keys are deleted from the leaving server.
+	leaving, err := New(srv2.Addr())
+	require.NoError(t, err)
+	defer leaving.Close()
+	keys, err := leaving.(*client).metadumpKeys(ctx, leaving.(*client).topology().addrs[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{fresh}, keys, "the key not copied is kept")
+}
+
+func Test_parseMetadump(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "keys",
+			lines: []string{
+				"key=foo exp=-1 la=1700000000 cas=1 fetch=no cls=1 size=3\r\n",
+				"key=a%20b exp=1700000100 la=1700000000 cas=2 fetch=yes cls=1 size=1\r\n",
+				"END\r\n",
+			},
+			want: []string{"foo", "a b"},
+		},
+		{
+			name:  "empty",
+			lines: []string{"END\r\n"},
+			want:  []string{},
+		},
+		{
+			name:    "unexpected line",
+			lines:   []string{"BUSY currently processing crawler request\r\n"},
+			wantErr: ErrMalformedResponse,
+		},
+		{
+			name:    "invalid key",
+			lines:   []string{"key=%zz exp=-1\r\n"},
+			wantErr: ErrMalformedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make([][]byte, 0, len(tt.lines))
+			for _, line := range tt.lines {
+				lines = append(lines, []byte(line))
+			}
+
+			keys, err := parseMetadump(lines)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, keys)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package memcached
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// runtimeOptions holds the options which could be updated by UpdateOptions while
+// the client is in use. It's replaced as a whole rather than modified, so that
+// the requests always see a consistent snapshot.
+type runtimeOptions struct {
+	dialTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	maxConns        int
+	maxIdleConns    int
+	maxLifetime     time.Duration
+	maxIdleTimeout  time.Duration
+	poolWaitTimeout time.Duration
+
+	// addrs are the runtime options of the servers overridden by WithAddrOptions,
+	// keyed by their addresses.
+	addrs map[string]*runtimeOptions
+}
+
+// newRuntimeOptions creates the runtime options of o, and the ones of the servers
+// which are overridden by WithAddrOptions on top of them.
+func newRuntimeOptions(o *clientOptions) *runtimeOptions {
+	r := newBaseRuntimeOptions(o)
+	if len(o.addrOptions) == 0 {
+		return r
+	}
+
+	r.addrs = make(map[string]*runtimeOptions, len(o.addrOptions))
+	for address, opts := range o.addrOptions {
+		ao := &clientOptions{}
+		r.applyTo(ao)
+		for _, opt := range opts {
+			opt(ao)
+		}
+		r.addrs[address] = newBaseRuntimeOptions(ao)
+	}
+
+	return r
+}
+
+func newBaseRuntimeOptions(o *clientOptions) *runtimeOptions {
+	return &runtimeOptions{
+		dialTimeout:     o.dialTimeout,
+		readTimeout:     o.readTimeout,
+		writeTimeout:    o.writeTimeout,
+		maxConns:        o.maxConns,
+		maxIdleConns:    o.maxIdleConns,
+		maxLifetime:     o.maxLifetime,
+		maxIdleTimeout:  o.maxIdleTimeout,
+		poolWaitTimeout: o.poolWaitTimeout,
+	}
+}
+
+// of returns the runtime options of the server at addr.
+func (r *runtimeOptions) of(addr *Addr) *runtimeOptions {
+	if addr != nil {
+		if ar, ok := r.addrs[addr.Address]; ok {
+			return ar
+		}
+	}
+
+	return r
+}
+
+// applyTo sets the runtime options to o.
+func (r *runtimeOptions) applyTo(o *clientOptions) {
+	o.dialTimeout = r.dialTimeout
+	o.readTimeout = r.readTimeout
+	o.writeTimeout = r.writeTimeout
+	o.maxConns = r.maxConns
+	o.maxIdleConns = r.maxIdleConns
+	o.maxLifetime = r.maxLifetime
+	o.maxIdleTimeout = r.maxIdleTimeout
+	o.poolWaitTimeout = r.poolWaitTimeout
+}
+
+// updatableAtRuntime reports whether the option only changes the runtime options.
+func updatableAtRuntime(opt ClientOption) bool {
+	o := &clientOptions{}
+	opt(o)
+	(&runtimeOptions{}).applyTo(o)
+
+	return reflect.ValueOf(o).Elem().IsZero()
+}
+
+// overridableByAddr reports whether the option only changes the runtime options
+// or the SASL credentials, which could be overridden by WithAddrOptions.
+func overridableByAddr(opt ClientOption) bool {
+	o := &clientOptions{}
+	opt(o)
+	(&runtimeOptions{}).applyTo(o)
+	o.enableSASL, o.plainUsername, o.plainPassword = false, "", ""
+
+	return reflect.ValueOf(o).Elem().IsZero()
+}
+
+// saslOf returns the options holding the SASL credentials of the server at addr.
+func (c *client) saslOf(addr *Addr) *clientOptions {
+	opts, ok := c.options.addrOptions[addr.Address]
+	if !ok {
+		return c.options
+	}
+
+	o := &clientOptions{
+		enableSASL:    c.options.enableSASL,
+		plainUsername: c.options.plainUsername,
+		plainPassword: c.options.plainPassword,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// UpdateOptions applies the options to the client in use, without recreating it
+// and dropping the warm connections. Only the following options are supported,
+// ErrInvalidArgument is returned and nothing is changed if any other one is given:
+//
+//   - WithDialTimeout, WithReadTimeout and WithWriteTimeout take effect on the next requests.
+//   - WithMaxConns, WithMaxIdleConns, WithMaxLifetime, WithMaxIdleTimeout and
+//     WithPoolWaitTimeout resize the connection pools gradually: the idle connections
+//     beyond the new limits are closed at once, and the connections in use are
+//     closed when they are put back.
+//
+// The multiplexed connections pick up the new timeouts too. The options of the
+// servers overridden by WithAddrOptions are kept.
+func (c *client) UpdateOptions(opts ...ClientOption) error {
+	for idx, opt := range opts {
+		if opt == nil || !updatableAtRuntime(opt) {
+			return errors.Wrapf(ErrInvalidArgument, "option %d could not be updated at runtime", idx)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o := &clientOptions{addrOptions: c.options.addrOptions}
+	c.runtime.Load().applyTo(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	r := newRuntimeOptions(o)
+	c.runtime.Store(r)
+	for addr, pool := range c.connPools {
+		ar := r.of(addr)
+		pool.resize(ar.maxIdleConns, ar.maxConns, ar.maxLifetime, ar.maxIdleTimeout, ar.poolWaitTimeout)
+	}
+
+	return nil
+}
+
+// dialTimeout returns the timeout of dialing a connection to the memcached server at addr.
+func (c *client) dialTimeout(addr *Addr) time.Duration {
+	return c.runtime.Load().of(addr).dialTimeout
+}
+
+// writeTimeout returns the timeout of writing a request to the memcached server at addr.
+func (c *client) writeTimeout(addr *Addr) time.Duration {
+	if c.writeTimeoutOverride > 0 {
+		return c.writeTimeoutOverride
+	}
+
+	return c.runtime.Load().of(addr).writeTimeout
+}
+
+// baseReadTimeout returns the read timeout of the memcached server at addr set by
+// the options or overridden by With, regardless of the adaptive read timeout.
+func (c *client) baseReadTimeout(addr *Addr) time.Duration {
+	if c.readTimeoutOverride > 0 {
+		return c.readTimeoutOverride
+	}
+
+	return c.runtime.Load().of(addr).readTimeout
+}
@@ -0,0 +1,121 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_UpdateOptions(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithReadTimeout(time.Second), WithMaxConns(4))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	require.NoError(t, c.UpdateOptions(
+		WithReadTimeout(2*time.Second),
+		WithWriteTimeout(3*time.Second),
+		WithMaxConns(2),
+		WithMaxIdleConns(1),
+	))
+	cc := c.(*client)
+	assert.Equal(t, 2*time.Second, cc.baseReadTimeout(nil))
+	assert.Equal(t, 3*time.Second, cc.writeTimeout(nil))
+
+	// the warm connection is kept, and the pool is resized.
+	stats := c.PoolStats()[srv.Addr()]
+	assert.Equal(t, 1, stats.TotalConns)
+	assert.Equal(t, 2, stats.MaxConns)
+	assert.Equal(t, 1, stats.MaxIdle)
+	assert.Equal(t, 2*time.Second, stats.ReadTimeout)
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+
+	tests := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "structural option", opts: []ClientOption{WithNoReply()}},
+		{name: "mixed options", opts: []ClientOption{WithReadTimeout(time.Minute), WithMultiplexing(2)}},
+		{name: "nil option", opts: []ClientOption{nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, c.UpdateOptions(tt.opts...), ErrInvalidArgument)
+			// nothing is changed.
+			assert.Equal(t, 2*time.Second, cc.baseReadTimeout(nil))
+		})
+	}
+}
+
+func Test_client_UpdateOptions_multiplexing(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithMultiplexing(1), WithReadTimeout(time.Second))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	require.NoError(t, c.UpdateOptions(WithReadTimeout(2*time.Second)))
+	readTimeout, _ := c.(*client).multiplexers[c.(*client).topology().addrs[0]].timeouts()
+	assert.Equal(t, 2*time.Second, readTimeout)
+
+	_, err = c.Get(ctx, "foo")
+	require.NoError(t, err)
+}
+
+func Test_client_WithAddrOptions(t *testing.T) {
+	big, small := newTestServer(t), newTestServer(t)
+	c, err := New(big.Addr()+","+small.Addr(),
+		WithMaxConns(2), WithReadTimeout(time.Second),
+		WithAddrOptions(big.Addr(), WithMaxConns(20), WithMaxIdleConns(5)),
+		WithAddrOptions(big.Addr(), WithReadTimeout(3*time.Second)),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	cc := c.(*client)
+	bigAddr, smallAddr := cc.topology().addrs[0], cc.topology().addrs[1]
+	if bigAddr.Address != big.Addr() {
+		bigAddr, smallAddr = smallAddr, bigAddr
+	}
+	assert.Equal(t, 3*time.Second, cc.baseReadTimeout(bigAddr))
+	assert.Equal(t, time.Second, cc.baseReadTimeout(smallAddr))
+
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, c.Set(ctx, "key:"+string(rune('a'+i)), []byte("bar"), 0, 0))
+	}
+
+	stats := c.PoolStats()
+	require.NotNil(t, stats[big.Addr()])
+	require.NotNil(t, stats[small.Addr()])
+	assert.Equal(t, 20, stats[big.Addr()].MaxConns)
+	assert.Equal(t, 5, stats[big.Addr()].MaxIdle)
+	assert.Equal(t, 3*time.Second, stats[big.Addr()].ReadTimeout)
+	assert.Equal(t, 2, stats[small.Addr()].MaxConns)
+	assert.Equal(t, time.Second, stats[small.Addr()].ReadTimeout)
+
+	// the overrides are kept by UpdateOptions.
+	require.NoError(t, c.UpdateOptions(WithMaxConns(4), WithReadTimeout(2*time.Second)))
+	stats = c.PoolStats()
+	assert.Equal(t, 20, stats[big.Addr()].MaxConns)
+	assert.Equal(t, 3*time.Second, stats[big.Addr()].ReadTimeout)
+	assert.Equal(t, 4, stats[small.Addr()].MaxConns)
+	assert.Equal(t, 2*time.Second, stats[small.Addr()].ReadTimeout)
+
+	_, err = New(big.Addr(), WithAddrOptions(big.Addr(), WithNoReply()))
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = New(big.Addr(), WithAddrOptions(big.Addr(), WithSASL("user", "pass")))
+	require.NoError(t, err)
+}
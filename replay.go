@@ -0,0 +1,111 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// idempotentCommands are the commands which leave the same result if they are
+// executed twice, so that they could be replayed over a new connection when the
+// pooled one is stale, see WithStaleConnReplay. The commands whose reply differs
+// if executed twice are not replayed, e.g. delete replies NOT_FOUND and add replies
+// NOT_STORED the second time, and the arithmetic, append, prepend and cas are not
+// idempotent at all.
+var idempotentCommands = map[string]struct{}{
+	"get": {}, "gets": {}, "gat": {}, "gats": {}, "touch": {},
+	"set":     {},
+	"version": {}, "stats": {},
+	"mg": {}, "ms": {}, "mn": {}, "me": {},
+}
+
+// isIdempotent reports whether the request could be replayed safely. The meta
+// commands are idempotent unless they carry the flags which are not, i.e. mg
+// vivifying the missed key, and ms in the modes other than set or comparing the
+// CAS unique.
+func isIdempotent(req *request) bool {
+	if _, ok := idempotentCommands[string(req.cmd)]; !ok {
+		return false
+	}
+
+	var notIdempotent func(flag []byte) bool
+	switch string(req.cmd) {
+	case "mg":
+		notIdempotent = func(flag []byte) bool { return flag[0] == 'N' }
+	case "ms":
+		notIdempotent = func(flag []byte) bool {
+			return flag[0] == 'C' || flag[0] == 'I' ||
+				(flag[0] == 'M' && len(flag) > 1 && flag[1] != 'S' && flag[1] != 's')
+		}
+	default:
+		return true
+	}
+
+	line, _, _ := bytes.Cut(req.raw, _CRLFBytes)
+	// the first two fields are the command and the key.
+	for i, flag := range bytes.Fields(line) {
+		if i >= 2 && notIdempotent(flag) {
+			return false
+		}
+	}
+	return true
+}
+
+// reusedConn is implemented by the connections which know whether they have been
+// put back to the pool, i.e. they may have been closed by the server while idle,
+// and whether any byte is received since they are taken from the pool.
+type reusedConn interface {
+	reused() bool
+	received() bool
+}
+
+var _ reusedConn = (*conn)(nil)
+
+func (c *conn) reused() bool {
+	return c.released
+}
+
+func (c *conn) received() bool {
+	return c.gotBytes
+}
+
+// replayable reports whether the request could be replayed over a new connection
+// if the connection turns out to be stale, it's checked before the request is sent.
+func (c *client) replayable(req *request, resp *response) bool {
+	return c.options.staleConnReplay &&
+		resp.endIndicator != endIndicatorNoReply &&
+		isIdempotent(req)
+}
+
+// staleConn reports whether the round trip failed since the pooled connection had
+// been closed by the server (e.g. by its idle timeout or restart) before the request,
+// i.e. the request is refused or the connection is closed without any reply.
+func staleConn(cn memcachedConn, err error) bool {
+	r, ok := cn.(reusedConn)
+	if !ok || !r.reused() || r.received() {
+		return false
+	}
+
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// replay sends the request again over a new connection to the memcached server at
+// addr, after the stale connection is discarded. The new connection is dialed rather
+// than taken from the idle ones, which may be stale as well.
+func (c *client) replay(
+	ctx context.Context, addr *Addr, pool *connPool, req *request, resp *response,
+) (memcachedConn, bool, error) {
+	cn, err := pool.dial(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "redial stale connection failed")
+	}
+
+	resp.rewind()
+	broken, err := c.roundTrip(ctx, addr, cn, req, resp)
+	return cn, broken, err
+}
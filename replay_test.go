@@ -0,0 +1,104 @@
+package memcached
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeqown/memcached/internal/testserver"
+)
+
+func Test_isIdempotent(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{raw: "get foo\r\n", want: true},
+		{raw: "gets foo bar\r\n", want: true},
+		{raw: "set foo 0 0 3\r\nbar\r\n", want: true},
+		{raw: "touch foo 10\r\n", want: true},
+		{raw: "add foo 0 0 3\r\nbar\r\n", want: false},
+		{raw: "delete foo\r\n", want: false},
+		{raw: "incr foo 1\r\n", want: false},
+		{raw: "cas foo 0 0 3 1\r\nbar\r\n", want: false},
+		{raw: "mg foo v t T30\r\n", want: true},
+		{raw: "mg foo v N30\r\n", want: false},
+		{raw: "ms foo 3 T30\r\nbar\r\n", want: true},
+		{raw: "ms foo 3 MS\r\nbar\r\n", want: true},
+		{raw: "ms foo 3 MA\r\nbar\r\n", want: false},
+		{raw: "ms foo 3 C12\r\nbar\r\n", want: false},
+		// the flag-like data block is not taken as the flags.
+		{raw: "ms foo 3\r\nMA \r\n", want: true},
+		{raw: "md foo\r\n", want: false},
+		{raw: "ma foo\r\n", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			cmd, _, _ := strings.Cut(tt.raw, " ")
+			req := buildRequest([]byte(cmd), []byte("foo"), []byte(tt.raw))
+			defer req.release()
+
+			assert.Equal(t, tt.want, isIdempotent(req))
+		})
+	}
+}
+
+// dropStaleConn makes the pooled connections stale by closing them on the server.
+func dropStaleConn(srv *testserver.Server) {
+	srv.DropConnections()
+	// wait for the close to be delivered to the client.
+	time.Sleep(50 * time.Millisecond)
+}
+
+func Test_client_staleConnReplay(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+	accepted := srv.Accepted()
+
+	// the idempotent commands are replayed over a new connection.
+	dropStaleConn(srv)
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+	assert.Equal(t, accepted+1, srv.Accepted())
+
+	dropStaleConn(srv)
+	require.NoError(t, c.Set(ctx, "foo", []byte("baz"), 0, 0))
+
+	// the others fail, and the stale connection is discarded.
+	dropStaleConn(srv)
+	_, err = c.Incr(ctx, "counter", 1)
+	require.Error(t, err)
+
+	item, err = c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", string(item.Value))
+}
+
+func Test_client_staleConnReplay_disabled(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithMaxConns(1), WithStaleConnReplay(false))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+
+	dropStaleConn(srv)
+	_, err = c.Get(ctx, "foo")
+	require.Error(t, err)
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+}
@@ -0,0 +1,224 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ ContextResolver = (*SRVResolver)(nil)
+	_ WatchResolver   = (*FileResolver)(nil)
+)
+
+// defaultSRVLookupTimeout is the default timeout of looking up SRV records.
+const defaultSRVLookupTimeout = 5 * time.Second
+
+// SRVResolver resolves the DNS SRV name into the addresses of its targets, e.g.
+// "_memcached._tcp.example.com". Only the records of the lowest priority value are
+// used, the others are the backups of them by RFC 2782, which the client does not
+// fail over to. The weight of each address is the weight of its SRV record, and a
+// record with weight 0 is treated as weight 1.
+//
+//	client, err := memcached.New("_memcached._tcp.example.com",
+//		memcached.WithResolver(memcached.NewSRVResolver()), memcached.WithTopologyRefresh(time.Minute))
+//
+// The records are looked up again every interval of WithTopologyRefresh, and the
+// client follows the changes of them.
+type SRVResolver struct {
+	timeout time.Duration
+	// lookupSRV is net.DefaultResolver.LookupSRV, it's replaced in tests.
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// NewSRVResolver creates a SRVResolver with the default DNS resolver.
+func NewSRVResolver() *SRVResolver {
+	return &SRVResolver{
+		timeout:   defaultSRVLookupTimeout,
+		lookupSRV: net.DefaultResolver.LookupSRV,
+	}
+}
+
+// Resolve looks up the SRV records of the name, the addresses are sorted by their
+// targets and ports, so that the priorities of them are stable between lookups.
+func (r *SRVResolver) Resolve(name string) ([]*Addr, error) {
+	return r.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext is the same as Resolve, but the lookup is canceled if ctx is done.
+func (r *SRVResolver) ResolveContext(ctx context.Context, name string) ([]*Addr, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.Wrap(ErrInvalidAddress, "empty SRV name")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, records, err := r.lookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "lookup SRV %s", name)
+	}
+	if len(records) == 0 {
+		return nil, errors.Wrapf(ErrInvalidAddress, "no SRV records of %s", name)
+	}
+
+	records = preferredSRVRecords(records)
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Target != records[j].Target {
+			return records[i].Target < records[j].Target
+		}
+		return records[i].Port < records[j].Port
+	})
+
+	addrs := make([]*Addr, 0, len(records))
+	for idx, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		addr := NewAddr("tcp", net.JoinHostPort(host, strconv.Itoa(int(record.Port))), idx)
+		addr.Weight = int(record.Weight)
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
+// preferredSRVRecords returns the records of the lowest priority value, which are
+// the preferred targets by RFC 2782.
+func preferredSRVRecords(records []*net.SRV) []*net.SRV {
+	lowest := records[0].Priority
+	for _, record := range records[1:] {
+		lowest = min(lowest, record.Priority)
+	}
+
+	preferred := make([]*net.SRV, 0, len(records))
+	for _, record := range records {
+		if record.Priority == lowest {
+			preferred = append(preferred, record)
+		}
+	}
+
+	return preferred
+}
+
+// seedServer is a memcached server in the seed file.
+type seedServer struct {
+	Address string `json:"address" yaml:"address"`
+	Weight  int    `json:"weight" yaml:"weight"`
+}
+
+// FileResolver resolves the path of a seed file into the addresses listed in it.
+// The file is in JSON or YAML format by its extension (.json, .yaml or .yml), and
+// lists the servers in the same format as the defaultResolver, e.g.
+//
+//	[
+//	  {"address": "localhost:11211", "weight": 3},
+//	  {"address": "unix:///var/run/memcached.sock"}
+//	]
+//
+// The file is read every time Resolve is called, and Watch reports the changes of it,
+// which are followed by the client if WithTopologyRefresh is set.
+type FileResolver struct{}
+
+// NewFileResolver creates a FileResolver.
+func NewFileResolver() *FileResolver {
+	return &FileResolver{}
+}
+
+// Resolve reads the seed file at path and resolves the servers in it.
+func (r *FileResolver) Resolve(path string) ([]*Addr, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read seed file")
+	}
+
+	return r.resolve(path, data)
+}
+
+// resolve parses the content of the seed file at path.
+func (r *FileResolver) resolve(path string, data []byte) ([]*Addr, error) {
+	var (
+		servers []seedServer
+		err     error
+	)
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &servers)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &servers)
+	default:
+		return nil, errors.Wrapf(ErrInvalidArgument, "unknown seed file format %q", ext)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidArgument, "parse seed file %s: %v", path, err)
+	}
+	if len(servers) == 0 {
+		return nil, errors.Wrapf(ErrInvalidAddress, "no servers in seed file %s", path)
+	}
+
+	return resolveSeedServers(servers)
+}
+
+// resolveSeedServers resolves the servers listed in the seed file or the cluster
+// config in DiscoveryFormatJSON format.
+func resolveSeedServers(servers []seedServer) ([]*Addr, error) {
+	addrs := make([]*Addr, 0, len(servers))
+	for idx, server := range servers {
+		if server.Weight < 0 {
+			return nil, errors.Wrapf(ErrInvalidAddress, "weight of address %s must not be negative", server.Address)
+		}
+
+		network, address, err := defaultResolver{}.resolveAddr(server.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		addr := NewAddr(network, address, idx)
+		addr.Weight = server.Weight
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
+// Watch checks the seed file at path every interval until the context is done,
+// and calls fn with the resolved addresses of the file first, then every time the
+// content of the file changes. The file which could not be resolved is skipped
+// until it's fixed. Watch blocks the caller, and returns the error of the context.
+func (r *FileResolver) Watch(ctx context.Context, path string, interval time.Duration, fn func([]*Addr)) error {
+	var last []byte
+	check := func() {
+		data, err := os.ReadFile(path)
+		if err != nil || (last != nil && bytes.Equal(data, last)) {
+			return
+		}
+
+		addrs, err := r.resolve(path, data)
+		if err != nil {
+			return
+		}
+		last = data
+		fn(addrs)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for check(); ; check() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package memcached
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SRVResolver_Resolve(t *testing.T) {
+	r := NewSRVResolver()
+	r.lookupSRV = func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		assert.Empty(t, service)
+		assert.Empty(t, proto)
+
+		switch name {
+		case "_memcached._tcp.example.com":
+			return name, []*net.SRV{
+				{Target: "mc2.example.com.", Port: 11211, Weight: 0},
+				{Target: "mc1.example.com.", Port: 11212, Weight: 3},
+				{Target: "mc1.example.com.", Port: 11211, Weight: 1},
+			}, nil
+		case "_backup._tcp.example.com":
+			return name, []*net.SRV{
+				{Target: "backup.example.com.", Port: 11211, Priority: 20},
+				{Target: "mc2.example.com.", Port: 11211, Priority: 10},
+				{Target: "mc1.example.com.", Port: 11211, Priority: 10},
+			}, nil
+		case "_empty._tcp.example.com":
+			return name, nil, nil
+		}
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	addrs, err := r.Resolve("_memcached._tcp.example.com")
+	require.NoError(t, err)
+	require.Len(t, addrs, 3)
+
+	want := []struct {
+		address string
+		weight  int
+	}{
+		{address: "mc1.example.com:11211", weight: 1},
+		{address: "mc1.example.com:11212", weight: 3},
+		{address: "mc2.example.com:11211", weight: 0},
+	}
+	for i, addr := range addrs {
+		assert.Equal(t, "tcp", addr.Network)
+		assert.Equal(t, want[i].address, addr.Address)
+		assert.Equal(t, want[i].weight, addr.Weight)
+		assert.Equal(t, i, addr.Priority)
+	}
+
+	// the backup records of higher priority values are not used.
+	addrs, err = r.Resolve("_backup._tcp.example.com")
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+	assert.Equal(t, "mc1.example.com:11211", addrs[0].Address)
+	assert.Equal(t, "mc2.example.com:11211", addrs[1].Address)
+
+	_, err = r.Resolve("_empty._tcp.example.com")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+	_, err = r.Resolve("_missing._tcp.example.com")
+	require.Error(t, err)
+	_, err = r.Resolve("")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func Test_FileResolver_Resolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		wantAddrs   []string
+		wantWeights []int
+		wantErr     error
+	}{
+		{
+			name:        "json",
+			file:        "seeds.json",
+			content:     `[{"address": "127.0.0.1:11211", "weight": 3}, {"address": "unix:///tmp/memcached.sock"}]`,
+			wantAddrs:   []string{"127.0.0.1:11211", "/tmp/memcached.sock"},
+			wantWeights: []int{3, 0},
+		},
+		{
+			name:        "yaml",
+			file:        "seeds.yml",
+			content:     "- address: 127.0.0.1:11211\n- address: 127.0.0.1:11212\n  weight: 2\n",
+			wantAddrs:   []string{"127.0.0.1:11211", "127.0.0.1:11212"},
+			wantWeights: []int{0, 2},
+		},
+		{
+			name:    "unknown format",
+			file:    "seeds.txt",
+			content: "127.0.0.1:11211",
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "malformed",
+			file:    "seeds.json",
+			content: `{"address": "127.0.0.1:11211"}`,
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "empty",
+			file:    "seeds.yaml",
+			content: "[]",
+			wantErr: ErrInvalidAddress,
+		},
+		{
+			name:    "negative weight",
+			file:    "seeds.json",
+			content: `[{"address": "127.0.0.1:11211", "weight": -1}]`,
+			wantErr: ErrInvalidAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			addrs, err := NewFileResolver().Resolve(path)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			gotAddrs := make([]string, 0, len(addrs))
+			gotWeights := make([]int, 0, len(addrs))
+			for _, addr := range addrs {
+				gotAddrs = append(gotAddrs, addr.Address)
+				gotWeights = append(gotWeights, addr.Weight)
+			}
+			assert.Equal(t, tt.wantAddrs, gotAddrs)
+			assert.Equal(t, tt.wantWeights, gotWeights)
+		})
+	}
+}
+
+func Test_FileResolver_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeds.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"address": "127.0.0.1:11211"}]`), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan []*Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewFileResolver().Watch(ctx, path, 5*time.Millisecond, func(addrs []*Addr) { changes <- addrs })
+	}()
+
+	// the addresses are reported first, then the malformed content is skipped.
+	select {
+	case addrs := <-changes:
+		require.Len(t, addrs, 1)
+	case <-time.After(time.Second):
+		t.Fatal("the first addresses are not reported")
+	}
+	require.NoError(t, os.WriteFile(path, []byte(`[{"address": `), 0o600))
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, os.WriteFile(path, []byte(`[{"address": "127.0.0.1:11211"}, {"address": "127.0.0.1:11212"}]`), 0o600))
+
+	select {
+	case addrs := <-changes:
+		require.Len(t, addrs, 2)
+		assert.Equal(t, "127.0.0.1:11212", addrs[1].Address)
+	case <-time.After(time.Second):
+		t.Fatal("the change is not reported")
+	}
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func Test_SRVResolver_topologyRefresh(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	record := func(srv string, priority uint16) *net.SRV {
+		host, port, err := net.SplitHostPort(srv)
+		require.NoError(t, err)
+		p, err := strconv.Atoi(port)
+		require.NoError(t, err)
+		return &net.SRV{Target: host + ".", Port: uint16(p), Priority: priority}
+	}
+
+	var (
+		mu      sync.Mutex
+		records = []*net.SRV{record(srv1.Addr(), 10), record(srv2.Addr(), 20)}
+	)
+	r := NewSRVResolver()
+	r.lookupSRV = func(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return name, records, nil
+	}
+
+	c, err := New("_memcached._tcp.example.com", WithResolver(r), WithTopologyRefresh(5*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+	mc := c.(*client)
+	require.Len(t, mc.topology().addrs, 1)
+	assert.Equal(t, srv1.Addr(), mc.topology().addrs[0].Address)
+
+	// the backup becomes the preferred target.
+	mu.Lock()
+	records = []*net.SRV{record(srv2.Addr(), 20)}
+	mu.Unlock()
+	require.Eventually(t, func() bool {
+		return mc.topology().addrs[0].Address == srv2.Addr()
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+}
+
+func Test_FileResolver_topologyRefresh(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	path := filepath.Join(t.TempDir(), "seeds.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"address": "`+srv1.Addr()+`"}]`), 0o600))
+
+	c, err := New(path, WithResolver(NewFileResolver()), WithTopologyRefresh(5*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+	mc := c.(*client)
+
+	seeds := `[{"address": "` + srv1.Addr() + `"}, {"address": "` + srv2.Addr() + `"}]`
+	require.NoError(t, os.WriteFile(path, []byte(seeds), 0o600))
+	require.Eventually(t, func() bool { return len(mc.topology().addrs) == 2 }, time.Second, 5*time.Millisecond)
+}
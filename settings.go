@@ -0,0 +1,167 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ServerSettings represents the settings of a memcached server replied by
+// `stats settings`, the settings missing in the reply are zero.
+type ServerSettings struct {
+	// MaxBytes is the max memory for the items in bytes.
+	MaxBytes int64
+	// MaxConns is the max number of simultaneous connections.
+	MaxConns int
+	// TCPPort and UDPPort are the ports the server listens on, 0 means disabled.
+	TCPPort int
+	UDPPort int
+	// NumThreads is the number of worker threads.
+	NumThreads int
+	// ItemSizeMax is the max size of an item in bytes.
+	ItemSizeMax int
+	// CASEnabled reports whether the CAS unique is enabled.
+	CASEnabled bool
+	// BindingProtocol is the protocol accepted by the server, one of "ascii",
+	// "binary" and "auto-negotiate".
+	BindingProtocol string
+
+	// Raw holds all the settings replied by the server by their names.
+	Raw map[string]string
+}
+
+// UDPAvailable reports whether the server listens on UDP.
+func (s *ServerSettings) UDPAvailable() bool {
+	return s.UDPPort != 0
+}
+
+// StatsSettings queries the settings of all memcached servers by `stats settings`.
+// The settings of the servers succeeded are returned even if some servers fail.
+func (c *client) StatsSettings(ctx context.Context) (map[*Addr]*ServerSettings, error) {
+	var mu sync.Mutex
+	all := make(map[*Addr]*ServerSettings, len(c.topology().addrs))
+
+	call := func(ctx context.Context, addr *Addr, cn memcachedConn) error {
+		lines, err := c.statsLines(ctx, addr, cn, "settings")
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		all[addr] = parseStatsSettings(lines)
+		mu.Unlock()
+		return nil
+	}
+
+	if err := c.broadcastRequest(ctx, "stats settings", call); err != nil {
+		return all, errors.Wrap(err, "request failed")
+	}
+
+	return all, nil
+}
+
+// parseStatsSettings parses the reply of `stats settings`, e.g.
+// "STAT item_size_max 1048576", the malformed values are ignored.
+func parseStatsSettings(lines [][]byte) *ServerSettings {
+	s := &ServerSettings{Raw: make(map[string]string, len(lines))}
+	for _, line := range lines {
+		// STAT <name> <value>
+		fields := bytes.Fields(trimCRLF(line))
+		if len(fields) != 3 || !bytes.Equal(fields[0], []byte("STAT")) {
+			continue
+		}
+
+		name, value := string(fields[1]), string(fields[2])
+		s.Raw[name] = value
+
+		switch name {
+		case "maxbytes":
+			s.MaxBytes, _ = strconv.ParseInt(value, 10, 64)
+		case "maxconns":
+			s.MaxConns, _ = strconv.Atoi(value)
+		case "tcpport":
+			s.TCPPort, _ = strconv.Atoi(value)
+		case "udpport":
+			s.UDPPort, _ = strconv.Atoi(value)
+		case "num_threads":
+			s.NumThreads, _ = strconv.Atoi(value)
+		case "item_size_max":
+			s.ItemSizeMax, _ = strconv.Atoi(value)
+		case "cas_enabled":
+			s.CASEnabled = value == "yes"
+		case "binding_protocol":
+			s.BindingProtocol = value
+		}
+	}
+
+	return s
+}
+
+// shouldDetectSettings reports whether the client should detect the settings of
+// the server at given address, they're detected once by the first connection if
+// WithAutoTune or DetectMaxItemSize is set.
+func (c *client) shouldDetectSettings(addr *Addr) bool {
+	if !c.options.autoTune && c.options.maxItemSize != DetectMaxItemSize {
+		return false
+	}
+	if c.options.compatibility != CompatMemcached || isUDPNetwork(addr) {
+		return false
+	}
+
+	c.mu.Lock()
+	_, detected := c.settings[addr]
+	c.mu.Unlock()
+
+	return !detected
+}
+
+// detectSettings queries the settings of the server over the given connection, nil
+// is returned if the server rejects `stats settings`.
+func detectSettings(ctx context.Context, addr *Addr, cn memcachedConn, c *client) (*ServerSettings, error) {
+	lines, err := c.statsLines(ctx, addr, cn, "settings")
+	if errors.Is(err, ErrNotSupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseStatsSettings(lines), nil
+}
+
+func (c *client) setSettings(addr *Addr, settings *ServerSettings) {
+	c.mu.Lock()
+	c.settings[addr] = settings
+	c.mu.Unlock()
+}
+
+// settingsOf returns the detected settings of the server at given address, nil if
+// they're not detected.
+func (c *client) settingsOf(addr *Addr) *ServerSettings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.settings[addr]
+}
+
+// udpEnabled reports whether the requests to the server at given address are sent
+// in UDP datagrams. With WithAutoTune, the servers whose settings are detected are
+// talked in UDP only if they listen on UDP and are reached over UDP.
+func (c *client) udpEnabled(addr *Addr) bool {
+	if !c.options.enableUDP {
+		return false
+	}
+	if !c.options.autoTune {
+		return true
+	}
+
+	settings := c.settingsOf(addr)
+	if settings == nil {
+		return true
+	}
+
+	return settings.UDPAvailable() && isUDPNetwork(addr)
+}
@@ -0,0 +1,135 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseStatsSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  *ServerSettings
+	}{
+		{
+			name: "normal",
+			lines: []string{
+				"STAT maxbytes 67108864", "STAT maxconns 1024", "STAT tcpport 11211", "STAT udpport 11211",
+				"STAT num_threads 4", "STAT item_size_max 1048576", "STAT cas_enabled yes",
+				"STAT binding_protocol auto-negotiate",
+			},
+			want: &ServerSettings{
+				MaxBytes: 67108864, MaxConns: 1024, TCPPort: 11211, UDPPort: 11211, NumThreads: 4,
+				ItemSizeMax: 1048576, CASEnabled: true, BindingProtocol: "auto-negotiate",
+			},
+		},
+		{
+			name:  "missing",
+			lines: []string{"STAT maxconns 1024"},
+			want:  &ServerSettings{MaxConns: 1024},
+		},
+		{
+			name:  "invalid",
+			lines: []string{"STAT item_size_max 1m", "STAT cas_enabled no", "garbage"},
+			want:  &ServerSettings{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make([][]byte, 0, len(tt.lines))
+			for _, line := range tt.lines {
+				lines = append(lines, []byte(line))
+			}
+
+			got := parseStatsSettings(lines)
+			assert.NotNil(t, got.Raw)
+			got.Raw = nil
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_client_StatsSettings(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetItemSizeMax(2048)
+
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	all, err := c.StatsSettings(context.Background())
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	for _, settings := range all {
+		assert.Equal(t, 2048, settings.ItemSizeMax)
+		assert.Equal(t, 4, settings.NumThreads)
+		assert.Equal(t, "ascii", settings.BindingProtocol)
+		assert.Equal(t, "1024", settings.Raw["maxconns"])
+		assert.False(t, settings.UDPAvailable())
+	}
+}
+
+func Test_client_WithAutoTune(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetItemSizeMax(1024)
+
+	tests := []struct {
+		name      string
+		opts      []ClientOption
+		largeFits bool
+	}{
+		{name: "detected", opts: []ClientOption{WithAutoTune()}},
+		{name: "explicit", opts: []ClientOption{WithAutoTune(), WithMaxItemSize(4096)}, largeFits: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(srv.Addr(), tt.opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			err = c.Set(context.Background(), "large", bytes.Repeat([]byte("a"), 2048), 0, 0)
+			if tt.largeFits {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrValueTooLarge)
+			}
+		})
+	}
+}
+
+func Test_client_udpEnabled(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want bool
+	}{
+		{name: "disabled", opts: nil, want: false},
+		{name: "enabled", opts: []ClientOption{WithUDPEnabled()}, want: true},
+		{name: "auto-tuned", opts: []ClientOption{WithUDPEnabled(), WithAutoTune()}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(srv.Addr(), tt.opts...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			mc := c.(*client)
+			addr := mc.topology().addrs[0]
+			// the settings are detected by the first connection.
+			cn, err := mc.getConn(context.Background(), addr)
+			require.NoError(t, err)
+			_ = cn.release()
+
+			assert.Equal(t, tt.want, mc.udpEnabled(addr))
+		})
+	}
+}
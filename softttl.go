@@ -0,0 +1,117 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// softTTLMagic is the prefix of the values wrapped in the soft TTL envelope.
+var softTTLMagic = []byte{0xF5, 0x7E}
+
+const (
+	// softTTLVersion is the version of the soft TTL envelope written by this client.
+	softTTLVersion = 1
+	// softTTLHeaderSize is the size of the envelope header of version 1:
+	// <magic:2 bytes> <version:1 byte> <soft expiry in unix milliseconds:8 bytes>
+	softTTLHeaderSize = 2 + 1 + 8
+)
+
+// WrapSoftTTL wraps the value in the soft TTL envelope with its logical expiry,
+// it's used with the commands other than SoftTTL, e.g. MetaSet. See SoftTTL.
+func WrapSoftTTL(value []byte, softExpireAt time.Time) []byte {
+	data := make([]byte, 0, softTTLHeaderSize+len(value))
+	data = append(data, softTTLMagic...)
+	data = append(data, softTTLVersion)
+	data = binary.BigEndian.AppendUint64(data, uint64(softExpireAt.UnixMilli()))
+
+	return append(data, value...)
+}
+
+// UnwrapSoftTTL unwraps the value and its logical expiry from the soft TTL envelope.
+// The value which is not wrapped, e.g. written by other clients, is returned as is
+// with the zero expiry. ErrNotSupported is returned if the envelope is written by a
+// newer version of the client.
+func UnwrapSoftTTL(data []byte) (value []byte, softExpireAt time.Time, err error) {
+	if len(data) < softTTLHeaderSize || !bytes.HasPrefix(data, softTTLMagic) {
+		return data, time.Time{}, nil
+	}
+
+	if version := data[len(softTTLMagic)]; version != softTTLVersion {
+		return nil, time.Time{}, errors.Wrapf(ErrNotSupported, "soft TTL envelope version %d", version)
+	}
+
+	millis := binary.BigEndian.Uint64(data[len(softTTLMagic)+1 : softTTLHeaderSize])
+	return data[softTTLHeaderSize:], time.UnixMilli(int64(millis)), nil
+}
+
+// SoftItem is the item read by SoftTTL.
+type SoftItem struct {
+	*Item
+
+	// SoftExpireAt is the logical expiry of the item, it's zero if the value is
+	// not wrapped in the envelope, e.g. written by other clients.
+	SoftExpireAt time.Time
+	// Expired reports whether the item is expired logically, it's still valid
+	// until its TTL, but should be refreshed.
+	Expired bool
+}
+
+// SoftTTL stores the values with a logical expiry (the soft TTL) ahead of their
+// TTL in memcached (the hard TTL), so that the callers could refresh the values
+// once they are expired logically, while serving the stale values rather than
+// all missing at the same time:
+//
+//	softTTL := client.SoftTTL()
+//	item, err := softTTL.Get(ctx, "foo")
+//	if err == nil && item.Expired {
+//		go refresh(ctx, "foo") // e.g. guarded by a Mutex, and stores by softTTL.Set.
+//	}
+//
+// The logical expiry is stored in an envelope before the value, which carries its
+// version, the values which are not wrapped are read as never expired logically.
+type SoftTTL struct {
+	client *client
+	// commands sends the commands, it's the client itself unless the SoftTTL is
+	// returned by MigrationClient.
+	commands Client
+}
+
+// SoftTTL returns the helper to store the values with the soft TTL.
+func (c *client) SoftTTL() *SoftTTL {
+	return &SoftTTL{client: c, commands: c}
+}
+
+// Set stores the value which is expired logically after softTTL, and removed by
+// memcached after hardTTL. The softTTL must be positive and not longer than the
+// hardTTL, 0 hardTTL means never expire.
+func (s *SoftTTL) Set(ctx context.Context, key string, value []byte, flags uint32, softTTL, hardTTL time.Duration) error {
+	if softTTL <= 0 || (hardTTL > 0 && softTTL > hardTTL) {
+		return errors.Wrapf(ErrInvalidArgument, "soft TTL %s should be positive and not longer than hard TTL %s", softTTL, hardTTL)
+	}
+
+	return s.commands.Set(ctx, key, WrapSoftTTL(value, s.client.now().Add(softTTL)), flags, hardTTL)
+}
+
+// Get gets the item of the given key with its logical expiry.
+func (s *SoftTTL) Get(ctx context.Context, key string) (*SoftItem, error) {
+	item, err := s.commands.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	value, softExpireAt, err := UnwrapSoftTTL(item.Value)
+	if err != nil {
+		return nil, err
+	}
+	item.Value = value
+
+	return &SoftItem{
+		Item:         item,
+		SoftExpireAt: softExpireAt,
+		Expired:      !softExpireAt.IsZero() && !s.client.now().Before(softExpireAt),
+	}, nil
+}
@@ -0,0 +1,104 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_UnwrapSoftTTL(t *testing.T) {
+	softExpireAt := time.UnixMilli(1700000000123)
+	future := WrapSoftTTL([]byte("bar"), softExpireAt)
+	future[len(softTTLMagic)] = softTTLVersion + 1
+
+	tests := []struct {
+		name             string
+		data             []byte
+		wantValue        string
+		wantSoftExpireAt time.Time
+		wantErr          error
+	}{
+		{
+			name:             "wrapped",
+			data:             WrapSoftTTL([]byte("bar"), softExpireAt),
+			wantValue:        "bar",
+			wantSoftExpireAt: softExpireAt,
+		},
+		{
+			name:             "wrapped empty value",
+			data:             WrapSoftTTL(nil, softExpireAt),
+			wantValue:        "",
+			wantSoftExpireAt: softExpireAt,
+		},
+		{
+			name:      "plain",
+			data:      []byte("bar"),
+			wantValue: "bar",
+		},
+		{
+			name:      "plain with magic but too short",
+			data:      append(append([]byte{}, softTTLMagic...), 'x'),
+			wantValue: string(append(append([]byte{}, softTTLMagic...), 'x')),
+		},
+		{
+			name:    "newer version",
+			data:    future,
+			wantErr: ErrNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, softExpireAt, err := UnwrapSoftTTL(tt.data)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantValue, string(value))
+			assert.True(t, tt.wantSoftExpireAt.Equal(softExpireAt))
+		})
+	}
+}
+
+func Test_SoftTTL(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	softTTL := c.SoftTTL()
+
+	require.NoError(t, softTTL.Set(ctx, "fresh", []byte("bar"), 1, time.Minute, time.Hour))
+	item, err := softTTL.Get(ctx, "fresh")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+	assert.Equal(t, uint32(1), item.Flags)
+	assert.False(t, item.Expired)
+	assert.False(t, item.SoftExpireAt.IsZero())
+
+	require.NoError(t, softTTL.Set(ctx, "stale", []byte("bar"), 0, time.Millisecond, 0))
+	time.Sleep(5 * time.Millisecond)
+	item, err = softTTL.Get(ctx, "stale")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+	assert.True(t, item.Expired)
+
+	// the plain values are never expired logically.
+	require.NoError(t, c.Set(ctx, "plain", []byte("bar"), 0, 0))
+	item, err = softTTL.Get(ctx, "plain")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+	assert.False(t, item.Expired)
+	assert.True(t, item.SoftExpireAt.IsZero())
+
+	_, err = softTTL.Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.ErrorIs(t, softTTL.Set(ctx, "foo", []byte("bar"), 0, 0, time.Minute), ErrInvalidArgument)
+	require.ErrorIs(t, softTTL.Set(ctx, "foo", []byte("bar"), 0, time.Hour, time.Minute), ErrInvalidArgument)
+}
@@ -0,0 +1,84 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+)
+
+// resolveContext resolves the address by the resolver within ctx. The resolver
+// implementing ContextResolver is given ctx, otherwise it's not waited for after
+// ctx is done, and its result is dropped.
+func resolveContext(ctx context.Context, resolver Resolver, addr string) ([]*Addr, error) {
+	if r, ok := resolver.(ContextResolver); ok {
+		return r.ResolveContext(ctx, addr)
+	}
+	if ctx.Done() == nil {
+		return resolver.Resolve(addr)
+	}
+
+	type result struct {
+		addrs []*Addr
+		err   error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		addrs, err := resolver.Resolve(addr)
+		resultCh <- result{addrs: addrs, err: err}
+	}()
+
+	select {
+	case r := <-resultCh:
+		return r.addrs, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// eagerConnect opens a connection to each memcached server concurrently, which is
+// authenticated if WithSASL is set, and checks the server replies the version. The
+// error of each failed server is reported as a CommandError. The UDP servers are
+// not checked since there is nothing to connect.
+func (c *client) eagerConnect(ctx context.Context) error {
+	return c.broadcastRequest(ctx, "version", func(ctx context.Context, addr *Addr, cn memcachedConn) error {
+		if isUDPNetwork(addr) {
+			return nil
+		}
+
+		_, err := c.versionOf(ctx, addr, cn)
+		return err
+	})
+}
+
+// warmUp opens the connections set by WithWarmUp to each memcached server into
+// its pool concurrently, the failures are ignored.
+func (c *client) warmUp(ctx context.Context) {
+	if c.options.warmUpConns <= 0 {
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for _, addr := range c.topology().addrs {
+		if c.useMultiplexer(addr) {
+			continue
+		}
+
+		n := min(c.options.warmUpConns, c.runtime.Load().of(addr).maxIdleConns)
+		wg.Add(1)
+		go func(addr *Addr) {
+			defer wg.Done()
+
+			conns := make([]memcachedConn, 0, n)
+			for range n {
+				cn, err := c.getConn(ctx, addr)
+				if err != nil {
+					break
+				}
+				conns = append(conns, cn)
+			}
+			for _, cn := range conns {
+				_ = cn.release()
+			}
+		}(addr)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,84 @@
+package memcached
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingResolver blocks until unblocked is closed.
+type blockingResolver struct {
+	unblocked chan struct{}
+}
+
+func (r blockingResolver) Resolve(addr string) ([]*Addr, error) {
+	<-r.unblocked
+	return []*Addr{NewAddr("tcp", addr, 0)}, nil
+}
+
+func Test_NewWithContext_resolve(t *testing.T) {
+	r := blockingResolver{unblocked: make(chan struct{})}
+	defer close(r.unblocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := NewWithContext(ctx, "localhost:11211", WithResolver(r))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the ContextResolver is given the context.
+	srv := NewSRVResolver()
+	srv.lookupSRV = func(ctx context.Context, _, _, _ string) (string, []*net.SRV, error) {
+		<-ctx.Done()
+		return "", nil, ctx.Err()
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = NewWithContext(ctx, "_memcached._tcp.example.com", WithResolver(srv))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func Test_NewWithContext_warmUp(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := NewWithContext(context.Background(), srv.Addr(), WithWarmUp(3), WithMaxIdleConns(2))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the warm-up is bounded by the max idle connections.
+	stats := c.PoolStats()[srv.Addr()]
+	require.NotNil(t, stats)
+	assert.Equal(t, 2, stats.IdleConns)
+	require.Eventually(t, func() bool { return srv.Accepted() == 2 }, time.Second, time.Millisecond)
+
+	require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+	assert.Equal(t, 2, srv.Accepted())
+
+	// the failures of the warm-up are ignored.
+	c2, err := New("127.0.0.1:1", WithWarmUp(1), WithDialTimeout(10*time.Millisecond))
+	require.NoError(t, err)
+	_ = c2.Close()
+}
+
+func Test_NewWithContext_eagerConnect(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := NewWithContext(context.Background(), srv1.Addr()+","+srv2.Addr(), WithEagerConnect())
+	require.NoError(t, err)
+	_ = c.Close()
+	require.Eventually(t, func() bool {
+		return srv1.Accepted() == 1 && srv2.Accepted() == 1
+	}, time.Second, time.Millisecond)
+
+	// the failed server is reported.
+	srv2.Stop()
+	_, err = NewWithContext(context.Background(), srv1.Addr()+","+srv2.Addr(),
+		WithEagerConnect(), WithDialTimeout(100*time.Millisecond))
+	require.Error(t, err)
+	var cmdErr *CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	assert.Equal(t, srv2.Addr(), cmdErr.Addr.Address)
+	assert.Contains(t, err.Error(), srv2.Addr())
+	assert.NotContains(t, err.Error(), srv1.Addr())
+}
@@ -0,0 +1,146 @@
+package memcached
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StatRate is the change of the counters of a memcached server between two polls
+// of StatsDelta, in the number per second.
+type StatRate struct {
+	// Addr is the memcached server.
+	Addr *Addr
+	// Time is when the stats are received, Interval is the time elapsed since the
+	// previous successful poll, which the rates are computed over.
+	Time     time.Time
+	Interval time.Duration
+	// Stats is the stats received by the poll.
+	Stats *Statistic
+
+	GetsPerSec         float64
+	SetsPerSec         float64
+	HitsPerSec         float64
+	MissesPerSec       float64
+	EvictionsPerSec    float64
+	BytesReadPerSec    float64
+	BytesWrittenPerSec float64
+	ConnectionsPerSec  float64
+	// HitRate is the ratio of the hits to the gets within the interval, 0 if
+	// there is no get.
+	HitRate float64
+
+	// Err is the error of the poll, the other fields except Addr and Time are
+	// zero if it's set.
+	Err error
+}
+
+// StatsDelta polls the stats of the memcached server at addr, one of the servers of
+// the client, every interval, and sends the rates of the counters between each two
+// polls to the returned channel, e.g. the gets and evictions per second:
+//
+//	rates, err := client.StatsDelta(ctx, addr, 5*time.Second)
+//	for rate := range rates {
+//		if rate.Err == nil {
+//			fmt.Printf("%.1f gets/s, %.1f evictions/s\n", rate.GetsPerSec, rate.EvictionsPerSec)
+//		}
+//	}
+//
+// The first rate is sent after the second poll. A failed poll is sent with Err set
+// and the polling goes on, the rate of the next successful poll is computed since
+// the last successful one. When the server restarted, its counters are reset, so
+// that the poll is taken as the new base and no rate is sent for it.
+//
+// The channel is closed after ctx is done. The polling waits for the receiver, the
+// ticks missed meanwhile are dropped.
+func (c *client) StatsDelta(ctx context.Context, addr *Addr, interval time.Duration) (<-chan *StatRate, error) {
+	if interval <= 0 {
+		return nil, errors.Wrap(ErrInvalidArgument, "non-positive interval")
+	}
+	addr, err := c.lookupAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *StatRate, 1)
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var (
+			prev   *Statistic
+			prevAt time.Time
+		)
+		for {
+			stats, err := c.Stats(context.WithValue(ctx, nodeKey{}, addr))
+			now := c.now()
+
+			var rate *StatRate
+			switch {
+			case err != nil:
+				if ctx.Err() != nil {
+					return
+				}
+				rate = &StatRate{Addr: addr, Time: now, Err: err}
+			case prev == nil || restarted(prev, stats):
+				prev, prevAt = stats, now
+			default:
+				rate = statRate(addr, prev, stats, now.Sub(prevAt))
+				rate.Time = now
+				prev, prevAt = stats, now
+			}
+
+			if rate != nil {
+				select {
+				case ch <- rate:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// restarted reports whether the server restarted between the two stats, its uptime
+// or the counters are going backward.
+func restarted(prev, cur *Statistic) bool {
+	return cur.Uptime < prev.Uptime || cur.CmdGet < prev.CmdGet || cur.CmdSet < prev.CmdSet
+}
+
+// statRate computes the rates of the counters from prev to cur within elapsed.
+func statRate(addr *Addr, prev, cur *Statistic, elapsed time.Duration) *StatRate {
+	rate := &StatRate{Addr: addr, Interval: elapsed, Stats: cur}
+	if elapsed <= 0 {
+		return rate
+	}
+
+	seconds := elapsed.Seconds()
+	perSec := func(prev, cur int64) float64 {
+		return float64(cur-prev) / seconds
+	}
+
+	rate.GetsPerSec = perSec(prev.CmdGet, cur.CmdGet)
+	rate.SetsPerSec = perSec(prev.CmdSet, cur.CmdSet)
+	rate.HitsPerSec = perSec(prev.GetHits, cur.GetHits)
+	rate.MissesPerSec = perSec(prev.GetMisses, cur.GetMisses)
+	rate.EvictionsPerSec = perSec(prev.Evictions, cur.Evictions)
+	rate.BytesReadPerSec = perSec(prev.BytesRead, cur.BytesRead)
+	rate.BytesWrittenPerSec = perSec(prev.BytesWritten, cur.BytesWritten)
+	rate.ConnectionsPerSec = perSec(prev.TotalConnections, cur.TotalConnections)
+	if gets := (cur.GetHits - prev.GetHits) + (cur.GetMisses - prev.GetMisses); gets > 0 {
+		rate.HitRate = float64(cur.GetHits-prev.GetHits) / float64(gets)
+	}
+
+	return rate
+}
@@ -0,0 +1,101 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_statRate(t *testing.T) {
+	addr := &Addr{Address: "a:11211"}
+	prev := &Statistic{CmdGet: 100, CmdSet: 10, GetHits: 80, GetMisses: 20, Evictions: 1, BytesRead: 1000}
+	cur := &Statistic{CmdGet: 300, CmdSet: 30, GetHits: 230, GetMisses: 70, Evictions: 5, BytesRead: 3000}
+
+	rate := statRate(addr, prev, cur, 2*time.Second)
+	assert.Equal(t, addr, rate.Addr)
+	assert.Equal(t, cur, rate.Stats)
+	assert.Equal(t, 2*time.Second, rate.Interval)
+	assert.InDelta(t, 100, rate.GetsPerSec, 1e-9)
+	assert.InDelta(t, 10, rate.SetsPerSec, 1e-9)
+	assert.InDelta(t, 75, rate.HitsPerSec, 1e-9)
+	assert.InDelta(t, 25, rate.MissesPerSec, 1e-9)
+	assert.InDelta(t, 2, rate.EvictionsPerSec, 1e-9)
+	assert.InDelta(t, 1000, rate.BytesReadPerSec, 1e-9)
+	assert.InDelta(t, 0.75, rate.HitRate, 1e-9)
+
+	// no get within the interval.
+	rate = statRate(addr, cur, cur, time.Second)
+	assert.Zero(t, rate.GetsPerSec)
+	assert.Zero(t, rate.HitRate)
+
+	rate = statRate(addr, prev, cur, 0)
+	assert.Zero(t, rate.GetsPerSec)
+
+	assert.True(t, restarted(&Statistic{Uptime: 100}, &Statistic{Uptime: 3}))
+	assert.True(t, restarted(&Statistic{Uptime: 100, CmdGet: 10}, &Statistic{Uptime: 101}))
+	assert.False(t, restarted(prev, cur))
+}
+
+func Test_client_StatsDelta(t *testing.T) {
+	// the server restarts before the third poll.
+	polls := []struct{ uptime, gets, hits int }{{100, 0, 0}, {101, 100, 60}, {1, 10, 0}, {2, 40, 15}}
+	addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+		for _, poll := range polls {
+			if line, _ := rr.ReadString('\n'); line != "stats\r\n" {
+				return
+			}
+			_, _ = fmt.Fprintf(w, "STAT uptime %d\r\nSTAT cmd_get %d\r\nSTAT get_hits %d\r\nSTAT get_misses %d\r\nEND\r\n",
+				poll.uptime, poll.gets, poll.hits, poll.gets-poll.hits)
+		}
+		_, _ = rr.ReadString('\n')
+		_, _ = io.WriteString(w, "SERVER_ERROR out of memory\r\n")
+	})
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rates, err := c.StatsDelta(ctx, &Addr{Address: addr}, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	rate := <-rates
+	require.NoError(t, rate.Err)
+	assert.Equal(t, addr, rate.Addr.Address)
+	assert.Equal(t, int64(100), rate.Stats.CmdGet)
+	assert.Positive(t, rate.GetsPerSec)
+	assert.InDelta(t, 0.6, rate.HitRate, 1e-9)
+
+	// the poll after the restart is the new base.
+	rate = <-rates
+	require.NoError(t, rate.Err)
+	assert.Equal(t, int64(40), rate.Stats.CmdGet)
+	assert.InDelta(t, 0.5, rate.HitRate, 1e-9)
+
+	// the failed poll is sent, and the channel is closed after ctx is done.
+	rate = <-rates
+	require.ErrorIs(t, rate.Err, ErrServerError)
+	cancel()
+	for range rates {
+	}
+}
+
+func Test_client_StatsDelta_invalid(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	_, err = c.StatsDelta(ctx, &Addr{Address: srv.Addr()}, 0)
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = c.StatsDelta(ctx, &Addr{Address: "unknown:11211"}, time.Second)
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
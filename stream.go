@@ -0,0 +1,280 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxDrainSize is the maximum number of unread bytes which are drained when
+// a ValueReader is closed early, the connection is discarded if more bytes
+// are left, since draining them costs more than dialing a new connection.
+const maxDrainSize = 64 << 10
+
+type streamingTextProtocolCommander interface {
+	// GetReader gets the value of the given key as a stream, the data block is read
+	// straight from the connection rather than buffered in memory.
+	//
+	// The connection is held by the ValueReader until it's closed, so the caller
+	// MUST close it. It returns ErrNotFound if the key does not exist.
+	GetReader(ctx context.Context, key string) (*ValueReader, error)
+	// SetReader stores the value read from r with exactly size bytes as the value
+	// of the given key, the value is written to the connection without buffering
+	// it in memory.
+	SetReader(ctx context.Context, key string, r io.Reader, size int64, flag uint32, expiry Expiration) error
+}
+
+// ValueReader streams the value of an item from the connection.
+type ValueReader struct {
+	Key   string
+	Flags uint32
+	// Size is the length of the value in bytes.
+	Size int64
+
+	ctx         context.Context
+	cn          memcachedConn
+	readTimeout time.Duration
+	remaining   int64
+	err         error
+}
+
+var _ io.ReadCloser = (*ValueReader)(nil)
+
+// Read reads the value from the connection, it returns io.EOF after Size bytes are read.
+func (r *ValueReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	// extend the deadline for each read, since a large value could take
+	// longer than the read timeout.
+	_ = selectProximateDeadline(r.ctx, r.cn, r.readTimeout, nowFunc, true)
+
+	n, err := r.cn.Read(p)
+	r.remaining -= int64(n)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = errors.Wrap(err, "read value")
+		return n, r.err
+	}
+
+	return n, nil
+}
+
+// Close releases the connection to the pool after the rest of the response is
+// read, or closes the connection if the response could not be read completely.
+func (r *ValueReader) Close() error {
+	if r.cn == nil {
+		return nil
+	}
+	cn := r.cn
+	r.cn = nil
+
+	if r.err != nil || r.remaining > maxDrainSize {
+		cn.getConnPool().discard(cn)
+		return nil
+	}
+
+	_ = selectProximateDeadline(r.ctx, cn, r.readTimeout, nowFunc, true)
+	if r.remaining > 0 {
+		if _, err := io.CopyN(io.Discard, cn, r.remaining); err != nil {
+			cn.getConnPool().discard(cn)
+			return nil
+		}
+		r.remaining = 0
+	}
+
+	// <data block>\r\n
+	// END\r\n
+	if err := expectLine(cn, _CRLFBytes); err != nil {
+		cn.getConnPool().discard(cn)
+		return err
+	}
+	if err := expectLine(cn, _EndCRLFBytes); err != nil {
+		cn.getConnPool().discard(cn)
+		return err
+	}
+
+	return cn.release()
+}
+
+func expectLine(cn memcachedConn, want []byte) error {
+	line, err := cn.readLine('\n')
+	if err != nil {
+		return errors.Wrap(err, "read line")
+	}
+	if !bytes.Equal(line, want) {
+		return errors.Wrapf(ErrMalformedResponse, "expect %q, got %q", want, line)
+	}
+
+	return nil
+}
+
+// streamConn picks the node of the key and gets a connection to it.
+func (c *client) streamConn(ctx context.Context, cmd, key string) (*Addr, memcachedConn, error) {
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	default:
+	}
+
+	if c.options.enableUDP {
+		return nil, nil, errors.Wrap(ErrNotSupported, "streaming values over UDP")
+	}
+	if err := checkCodecSupportsOperation(c.options.codec, "stream"); err != nil {
+		return nil, nil, errors.Wrap(err, "codec does not support operation")
+	}
+
+	addr, err := c.pick(ctx, []byte(cmd), []byte(key))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "pick node failed")
+	}
+
+	cn, err := c.getConn(ctx, addr)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "alloc connection failed")
+	}
+
+	return addr, cn, nil
+}
+
+func (c *client) GetReader(ctx context.Context, key string) (*ValueReader, error) {
+	if err := validateKeyAndValue([]byte(key), nil); err != nil {
+		return nil, err
+	}
+
+	addr, cn, err := c.streamConn(ctx, "get", key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, resp := buildGetsCommand("get", key)
+	defer releaseReqAndResp(req, resp)
+
+	if err = req.send(ctx, cn, c.writeTimeout(addr)); err != nil {
+		cn.getConnPool().discard(cn)
+		return nil, errors.Wrap(err, "send failed")
+	}
+
+	// only the VALUE line is read here, the data block is read by ValueReader.
+	_ = selectProximateDeadline(ctx, cn, c.baseReadTimeout(addr), nowFunc, true)
+	line, err := cn.readLine('\n')
+	if err != nil {
+		cn.getConnPool().discard(cn)
+		return nil, errors.Wrap(err, "recv failed")
+	}
+
+	if bytes.Equal(line, _EndCRLFBytes) {
+		_ = cn.release()
+		return nil, errors.Wrap(ErrNotFound, "no items found")
+	}
+	if err = forecastCommonFaultLine(line); err != nil {
+		_ = cn.release()
+		return nil, err
+	}
+
+	item := &Item{}
+	size, err := parseValueLine(trimCRLF(line), item, false)
+	if err != nil {
+		cn.getConnPool().discard(cn)
+		return nil, err
+	}
+
+	return &ValueReader{
+		Key:         item.Key,
+		Flags:       item.Flags,
+		Size:        int64(size),
+		ctx:         ctx,
+		cn:          cn,
+		readTimeout: c.baseReadTimeout(addr),
+		remaining:   int64(size),
+	}, nil
+}
+
+func (c *client) SetReader(
+	ctx context.Context, key string, r io.Reader, size int64, flag uint32, expiry Expiration,
+) error {
+	if err := validateKeyAndValue([]byte(key), nil); err != nil {
+		return err
+	}
+	if size < 0 || size > maxValueSize {
+		return errors.Wrap(ErrInvalidValue, "invalid value size")
+	}
+	if err := expiry.validate(); err != nil {
+		return err
+	}
+
+	addr, cn, err := c.streamConn(ctx, "set", key)
+	if err != nil {
+		return err
+	}
+	if err = c.checkItemSize(addr, itemSize(len(key), int(size))); err != nil {
+		_ = cn.release()
+		return err
+	}
+
+	// set <key> <flags> <exptime> <bytes> [noreply]\r\n
+	b := newProtocolBuilder().
+		AddString("set").
+		AddString(key).
+		AddUint(uint64(flag)).
+		AddInt(int(expiry)).
+		AddUint(uint64(size))
+	if c.options.noReply {
+		b.AddBytes(_NoReplyBytes)
+	}
+	header := b.AddCRLF().build()
+	b.release()
+
+	if has := selectProximateDeadline(ctx, cn, c.writeTimeout(addr), nowFunc, false); has {
+		defer func() { _ = cn.setWriteDeadline(zeroTime) }()
+	}
+
+	if _, err = cn.Write(header); err != nil {
+		cn.getConnPool().discard(cn)
+		return errors.Wrap(err, "send failed")
+	}
+	// the connection is left with a partial data block if the reader fails,
+	// so it must be discarded.
+	if _, err = io.CopyN(cn, r, size); err != nil {
+		cn.getConnPool().discard(cn)
+		return errors.Wrap(err, "send value failed")
+	}
+	if _, err = cn.Write(_CRLFBytes); err != nil {
+		cn.getConnPool().discard(cn)
+		return errors.Wrap(err, "send failed")
+	}
+
+	if c.options.noReply {
+		return cn.release()
+	}
+
+	_ = selectProximateDeadline(ctx, cn, c.baseReadTimeout(addr), nowFunc, true)
+	line, err := cn.readLine('\n')
+	if err != nil {
+		cn.getConnPool().discard(cn)
+		return errors.Wrap(err, "recv failed")
+	}
+	_ = cn.release()
+
+	if err = forecastCommonFaultLine(line); err != nil {
+		return err
+	}
+	if !bytes.Equal(line, _StoredCRLFBytes) {
+		return errors.Wrapf(ErrMalformedResponse, "unexpected response %q", line)
+	}
+
+	return nil
+}
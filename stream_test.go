@@ -0,0 +1,97 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memcodec "github.com/yeqown/memcached/codec"
+)
+
+// serveOnce accepts one connection and replies it with the handler.
+func serveOnce(t *testing.T, handler func(rr *bufio.Reader, w io.Writer)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		cn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer cn.Close()
+		handler(bufio.NewReader(cn), cn)
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestGetReader(t *testing.T) {
+	value := strings.Repeat("0123456789\n", 10000)
+	addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+		for i := 0; i < 2; i++ {
+			line, _ := rr.ReadString('\n')
+			switch line {
+			case "get foo\r\n":
+				_, _ = io.WriteString(w, "VALUE foo 12 110000\r\n"+value+"\r\nEND\r\n")
+			case "get bar\r\n":
+				_, _ = io.WriteString(w, "END\r\n")
+			}
+		}
+	})
+
+	c, err := New(addr, WithCapabilityDetection(false), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	r, err := c.GetReader(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", r.Key)
+	assert.Equal(t, uint32(12), r.Flags)
+	assert.Equal(t, int64(len(value)), r.Size)
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, value, string(got))
+	require.NoError(t, r.Close())
+
+	// the connection is released and reused by the next command.
+	_, err = c.GetReader(context.Background(), "bar")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSetReader(t *testing.T) {
+	value := strings.Repeat("v\r\n", 50000)
+	received := make(chan string, 1)
+	addr := serveOnce(t, func(rr *bufio.Reader, w io.Writer) {
+		header, _ := rr.ReadString('\n')
+		data := make([]byte, len(value)+2)
+		_, _ = io.ReadFull(rr, data)
+		received <- header + string(data)
+		_, _ = io.WriteString(w, "STORED\r\n")
+	})
+
+	c, err := New(addr, WithCapabilityDetection(false))
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.SetReader(context.Background(), "foo", strings.NewReader(value), int64(len(value)), 1, NoExpiration)
+	require.NoError(t, err)
+	assert.Equal(t, "set foo 1 0 150000\r\n"+value+"\r\n", <-received)
+}
+
+func TestStreamingRejectsTransformingCodec(t *testing.T) {
+	c := &client{options: newClientOptions(), clientState: newClientState()}
+	c.options.codec = mustCompressCodec(t, memcodec.CompressionAlgorithmDeflate, 0, 6)
+
+	_, err := c.GetReader(context.Background(), "foo")
+	require.ErrorIs(t, err, ErrNotSupported)
+	err = c.SetReader(context.Background(), "foo", strings.NewReader("bar"), 3, 0, NoExpiration)
+	require.ErrorIs(t, err, ErrNotSupported)
+}
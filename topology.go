@@ -0,0 +1,217 @@
+package memcached
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WatchResolver is implemented by the resolvers which report the changes of the
+// memcached servers by themselves, e.g. ElastiCacheResolver. Watch blocks the
+// caller until ctx is done, and calls fn with the servers resolved from addr every
+// time they're changed, it's checked every interval.
+type WatchResolver interface {
+	Resolver
+
+	Watch(ctx context.Context, addr string, interval time.Duration, fn func([]*Addr)) error
+}
+
+// topology is the memcached servers of the client and the state of each one of
+// them, it's replaced as a whole when the servers are changed, see UpdateAddrs.
+type topology struct {
+	// addrs represents the list of memcached addresses.
+	// each one of them means a memcached server instance.
+	addrs []*Addr
+
+	// picker represents the picker strategy built from addrs.
+	// it is used to pick a memcached server instance to execute a command.
+	picker Picker
+
+	// limiters holds the limiter of in-flight requests of each memcached server,
+	// it's nil if the limit is not set.
+	limiters map[*Addr]*concurrencyLimiter
+	// buckets holds the token bucket limiting the rate of requests to each memcached
+	// server, it's nil if the rate limit is not set.
+	buckets map[*Addr]*tokenBucket
+	// breakers holds the breaker of each memcached server, it's nil if WithFailOpen
+	// is not set.
+	breakers map[*Addr]*failOpenBreaker
+}
+
+// newTopology builds the topology of addrs by the options. The state of the servers
+// in prev, which is nil for a new client, is carried over.
+func newTopology(options *clientOptions, addrs []*Addr, prev *topology) *topology {
+	t := &topology{
+		addrs:  addrs,
+		picker: options.pickBuilder.Build(addrs),
+	}
+	if prev == nil {
+		prev = &topology{}
+	}
+
+	if options.maxConcurrentRequests > 0 {
+		t.limiters = make(map[*Addr]*concurrencyLimiter, len(addrs))
+		for _, addr := range addrs {
+			l, ok := prev.limiters[addr]
+			if !ok {
+				l = newConcurrencyLimiter(options.maxConcurrentRequests, options.concurrencyWaitTimeout)
+			}
+			t.limiters[addr] = l
+		}
+	}
+
+	if options.rateLimit > 0 {
+		t.buckets = make(map[*Addr]*tokenBucket, len(addrs))
+		for _, addr := range addrs {
+			b, ok := prev.buckets[addr]
+			if !ok {
+				b = newTokenBucket(options.rateLimit, options.rateBurst)
+			}
+			t.buckets[addr] = b
+		}
+	}
+
+	if options.failOpen {
+		t.breakers = make(map[*Addr]*failOpenBreaker, len(addrs))
+		for _, addr := range addrs {
+			b, ok := prev.breakers[addr]
+			if !ok {
+				b = &failOpenBreaker{}
+			}
+			t.breakers[addr] = b
+		}
+	}
+
+	return t
+}
+
+// topology returns the current topology of the client.
+func (c *client) topology() *topology {
+	return c.topo.Load()
+}
+
+// validateAddrs checks the addresses given by the caller rather than the resolver.
+func validateAddrs(addrs []*Addr) error {
+	if len(addrs) == 0 {
+		return errors.Wrap(ErrInvalidAddress, "empty address")
+	}
+
+	for _, addr := range addrs {
+		if addr == nil || addr.Address == "" {
+			return errors.Wrap(ErrInvalidAddress, "empty address")
+		}
+		if addr.Weight < 0 {
+			return errors.Wrapf(ErrInvalidAddress, "weight of address %s must not be negative", addr.Address)
+		}
+	}
+
+	return nil
+}
+
+// sameNode reports whether a and b are the same memcached server, which is picked
+// for the same keys.
+func sameNode(a, b *Addr) bool {
+	return a.Network == b.Network && a.Address == b.Address &&
+		a.Priority == b.Priority && a.Weight == b.Weight
+}
+
+// UpdateAddrs replaces the memcached servers of the client with addrs, e.g. when
+// the nodes of the cluster are changed, the keys are picked among the new servers
+// by the next requests. The servers in both, matched by their networks, addresses,
+// priorities and weights, keep their connections and states. The connections to
+// the removed servers are closed, the ones in use are closed when they're put back.
+//
+// The addresses are checked in the same way as NewFromAddrs, and should not be
+// modified after then. It's called by the client itself if WithTopologyRefresh is
+// set, see Rebalance to move the keys to their new servers.
+func (c *client) UpdateAddrs(addrs []*Addr) error {
+	if err := validateAddrs(addrs); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.topology()
+	kept := make(map[*Addr]bool, len(prev.addrs))
+	next := make([]*Addr, 0, len(addrs))
+	changed := len(addrs) != len(prev.addrs)
+	for idx, addr := range addrs {
+		for _, old := range prev.addrs {
+			if sameNode(old, addr) {
+				addr = old
+				kept[old] = true
+				break
+			}
+		}
+		changed = changed || addr != prev.addrs[idx]
+		next = append(next, addr)
+	}
+	if !changed {
+		return nil
+	}
+
+	c.topo.Store(newTopology(c.options, next, prev))
+	if c.adaptive != nil {
+		c.adaptive.update(next)
+	}
+
+	for _, addr := range prev.addrs {
+		if kept[addr] {
+			continue
+		}
+
+		if pool, ok := c.connPools[addr]; ok {
+			_ = pool.close()
+			delete(c.connPools, addr)
+		}
+		if m, ok := c.multiplexers[addr]; ok {
+			_ = m.close()
+			delete(c.multiplexers, addr)
+		}
+		delete(c.capabilities, addr)
+		delete(c.settings, addr)
+		delete(c.scheduledFlushes, addr)
+		delete(c.noMultiKeyGetAndTouch, addr)
+	}
+
+	return nil
+}
+
+// startTopologyRefresh follows the changes of the memcached servers resolved from
+// addr in the background until the client is closed, see WithTopologyRefresh.
+func (c *client) startTopologyRefresh(addr string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.stopRefresh = func() {
+		cancel()
+		<-done
+	}
+
+	interval := c.options.topologyRefresh
+	update := func(addrs []*Addr) { _ = c.UpdateAddrs(addrs) }
+	go func() {
+		defer close(done)
+
+		if r, ok := c.options.resolver.(WatchResolver); ok {
+			_ = r.Watch(ctx, addr, interval, update)
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// the failed resolutions are skipped, the servers are kept until then.
+			if addrs, err := resolveContext(ctx, c.options.resolver, addr); err == nil {
+				update(addrs)
+			}
+		}
+	}()
+}
@@ -0,0 +1,155 @@
+package memcached
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_UpdateAddrs(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	addr1 := NewAddr("tcp", srv1.Addr(), 0)
+	c, err := NewFromAddrs([]*Addr{addr1}, WithFailOpen(), WithMaxConcurrentRequests(8))
+	require.NoError(t, err)
+	defer c.Close()
+	mc := c.(*client)
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+	pool := mc.connPools[addr1]
+	require.NotNil(t, pool)
+	limiter := mc.topology().limiters[addr1]
+
+	// the node kept is matched by its address, and keeps its connections and state.
+	addr2 := NewAddr("tcp", srv2.Addr(), 1)
+	require.NoError(t, c.UpdateAddrs([]*Addr{NewAddr("tcp", srv1.Addr(), 0), addr2}))
+	assert.Equal(t, []*Addr{addr1, addr2}, mc.topology().addrs)
+	assert.Same(t, pool, mc.connPools[addr1])
+	assert.Same(t, limiter, mc.topology().limiters[addr1])
+	assert.NotNil(t, mc.topology().limiters[addr2])
+	assert.NotNil(t, mc.topology().breakers[addr2])
+
+	picked := make(map[*Addr]int, 2)
+	for i := 0; i < 100; i++ {
+		addr, err := c.WhichNode("key" + strconv.Itoa(i))
+		require.NoError(t, err)
+		picked[addr]++
+	}
+	assert.Len(t, picked, 2)
+
+	// the same servers change nothing.
+	require.NoError(t, c.UpdateAddrs([]*Addr{addr1, NewAddr("tcp", srv2.Addr(), 1)}))
+	assert.Equal(t, []*Addr{addr1, addr2}, mc.topology().addrs)
+
+	// the connections to the removed node are closed.
+	require.NoError(t, c.UpdateAddrs([]*Addr{addr2}))
+	assert.Equal(t, []*Addr{addr2}, mc.topology().addrs)
+	assert.NotContains(t, mc.connPools, addr1)
+	assert.NotContains(t, mc.topology().limiters, addr1)
+
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+		addr, err := c.WhichNode(key)
+		require.NoError(t, err)
+		assert.Same(t, addr2, addr)
+		require.NoError(t, c.Set(ctx, key, []byte("value"), 0, 0))
+	}
+	_, err = c.Get(ctx, "foo")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.ErrorIs(t, c.UpdateAddrs(nil), ErrInvalidAddress)
+	require.ErrorIs(t, c.UpdateAddrs([]*Addr{{Network: "tcp"}}), ErrInvalidAddress)
+	assert.Equal(t, []*Addr{addr2}, mc.topology().addrs)
+}
+
+func Test_client_UpdateAddrs_async(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	a := c.(*client).Async()
+	defer a.Close()
+
+	// the worker of the node added is started on demand.
+	require.NoError(t, c.UpdateAddrs([]*Addr{NewAddr("tcp", srv2.Addr(), 0)}))
+	ctx := context.Background()
+	_, err = a.Set(ctx, "foo", []byte("bar"), 0, 0).Wait(ctx)
+	require.NoError(t, err)
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+}
+
+func Test_WithTopologyRefresh(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	config := func(version int, srvs ...string) string {
+		nodes := make([]string, 0, len(srvs))
+		for idx, srv := range srvs {
+			host, port, err := net.SplitHostPort(srv)
+			require.NoError(t, err)
+			nodes = append(nodes, "node"+strconv.Itoa(idx)+"|"+host+"|"+port)
+		}
+		return strconv.Itoa(version) + "\n" + strings.Join(nodes, " ") + "\n"
+	}
+	endpoint := newFakeConfigEndpoint(t, false, config(1, srv1.Addr()))
+
+	c, err := New(endpoint.ln.Addr().String(),
+		WithResolver(NewElastiCacheResolver()), WithTopologyRefresh(5*time.Millisecond))
+	require.NoError(t, err)
+	mc := c.(*client)
+	require.Len(t, mc.topology().addrs, 1)
+
+	// the client follows the nodes reported by the configuration endpoint.
+	endpoint.setConfig(config(2, srv1.Addr(), srv2.Addr()))
+	require.Eventually(t, func() bool { return len(mc.topology().addrs) == 2 }, time.Second, 5*time.Millisecond)
+
+	endpoint.setConfig(config(3, srv2.Addr()))
+	require.Eventually(t, func() bool { return len(mc.topology().addrs) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, srv2.Addr(), mc.topology().addrs[0].Address)
+	require.NoError(t, c.Set(context.Background(), "foo", []byte("bar"), 0, 0))
+
+	// the refresh is stopped once the client is closed.
+	require.NoError(t, c.Close())
+	endpoint.setConfig(config(4, srv1.Addr()))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, srv2.Addr(), mc.topology().addrs[0].Address)
+}
+
+// resolverFunc is a Resolver which does not watch the changes by itself.
+type resolverFunc func(addr string) ([]*Addr, error)
+
+func (f resolverFunc) Resolve(addr string) ([]*Addr, error) { return f(addr) }
+
+func Test_WithTopologyRefresh_polling(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	addrs := make(chan string, 1)
+	addrs <- srv1.Addr()
+	resolver := resolverFunc(func(string) ([]*Addr, error) {
+		select {
+		case addr := <-addrs:
+			return newDefaultResolver().Resolve(addr)
+		default:
+			return nil, ErrInvalidAddress
+		}
+	})
+
+	c, err := New("cluster", WithResolver(resolver), WithTopologyRefresh(5*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+	mc := c.(*client)
+
+	// the failed resolutions keep the nodes.
+	time.Sleep(20 * time.Millisecond)
+	require.Len(t, mc.topology().addrs, 1)
+
+	addrs <- srv1.Addr() + "," + srv2.Addr()
+	require.Eventually(t, func() bool { return len(mc.topology().addrs) == 2 }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,132 @@
+package memcached
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// valueTransformer holds the functions set by WithValueTransformer.
+type valueTransformer struct {
+	encrypt func([]byte) ([]byte, error)
+	decrypt func([]byte) ([]byte, error)
+}
+
+// transformCodec transforms the values encoded by Codec, and transforms them back
+// before they are decoded by Codec, see WithValueTransformer.
+type transformCodec struct {
+	Codec
+
+	transformer *valueTransformer
+}
+
+func (c transformCodec) Encode(key, value []byte, flag uint32) ([]byte, uint32, error) {
+	evalue, eflag, err := c.Codec.Encode(key, value, flag)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	transformed, err := c.transformer.encrypt(evalue)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "transform value of key %s", key)
+	}
+
+	return transformed, eflag, nil
+}
+
+func (c transformCodec) Decode(key, value []byte, flag uint32) ([]byte, uint32, error) {
+	restored, err := c.transformer.decrypt(value)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "restore value of key %s", key)
+	}
+
+	return c.Codec.Decode(key, restored, flag)
+}
+
+// SupportsOperation rejects the operations which break the transformed values,
+// appending or prepending bytes to them, and streaming them without buffering.
+func (c transformCodec) SupportsOperation(operation string) error {
+	if operation == "append" || operation == "prepend" || operation == "stream" {
+		return errors.Wrapf(ErrNotSupported, "%s with value transformer", operation)
+	}
+
+	return c.Codec.SupportsOperation(operation)
+}
+
+// AESGCMKeyring encrypts the values by AES-GCM for WithValueTransformer, with the
+// keys identified by one byte IDs to rotate them:
+//
+//	<key ID:1 byte> <nonce:12 bytes> <ciphertext with tag>
+//
+// The values are encrypted by the current key, and decrypted by the key whose ID
+// prefixes them, so that a key is rotated by adding the new key as current while
+// keeping the old one until the values encrypted by it expire.
+//
+//	ring, err := memcached.NewAESGCMKeyring(2, map[byte][]byte{1: oldKey, 2: newKey})
+//	client, err := memcached.New(addrs, memcached.WithValueTransformer(ring.Encrypt, ring.Decrypt))
+type AESGCMKeyring struct {
+	current byte
+	aeads   map[byte]cipher.AEAD
+}
+
+// NewAESGCMKeyring creates the AESGCMKeyring encrypting by the key of current ID,
+// the keys must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+func NewAESGCMKeyring(current byte, keys map[byte][]byte) (*AESGCMKeyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, errors.Wrapf(ErrInvalidArgument, "missing current key %d", current)
+	}
+
+	aeads := make(map[byte]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidArgument, "key %d: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidArgument, "key %d: %v", id, err)
+		}
+		aeads[id] = aead
+	}
+
+	return &AESGCMKeyring{current: current, aeads: aeads}, nil
+}
+
+// Encrypt encrypts the value by the current key with a random nonce.
+func (k *AESGCMKeyring) Encrypt(value []byte) ([]byte, error) {
+	aead := k.aeads[k.current]
+
+	out := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(value)+aead.Overhead())
+	out[0] = k.current
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+
+	return aead.Seal(out, out[1:], value, nil), nil
+}
+
+// Decrypt decrypts the value by the key whose ID prefixes it, ErrDecryptionFailed
+// is returned if the key is unknown or the value is not authentic.
+func (k *AESGCMKeyring) Decrypt(value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return nil, errors.Wrap(ErrDecryptionFailed, "missing key ID")
+	}
+
+	aead, ok := k.aeads[value[0]]
+	if !ok {
+		return nil, errors.Wrapf(ErrDecryptionFailed, "unknown key %d", value[0])
+	}
+	if len(value) < 1+aead.NonceSize()+aead.Overhead() {
+		return nil, errors.Wrap(ErrDecryptionFailed, "truncated value")
+	}
+
+	nonce, ciphertext := value[1:1+aead.NonceSize()], value[1+aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrapf(ErrDecryptionFailed, "key %d: %v", value[0], err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,103 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memcodec "github.com/yeqown/memcached/codec"
+)
+
+func Test_AESGCMKeyring(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 16), bytes.Repeat([]byte{2}, 32)
+	old, err := NewAESGCMKeyring(1, map[byte][]byte{1: oldKey})
+	require.NoError(t, err)
+	rotated, err := NewAESGCMKeyring(2, map[byte][]byte{1: oldKey, 2: newKey})
+	require.NoError(t, err)
+
+	value := []byte("pii")
+	encrypted, err := old.Encrypt(value)
+	require.NoError(t, err)
+	assert.Equal(t, byte(1), encrypted[0])
+	assert.NotContains(t, string(encrypted), "pii")
+
+	// the values encrypted by the old key are decrypted after rotation.
+	decrypted, err := rotated.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, value, decrypted)
+
+	reencrypted, err := rotated.Encrypt(value)
+	require.NoError(t, err)
+	assert.Equal(t, byte(2), reencrypted[0])
+	_, err = old.Decrypt(reencrypted)
+	require.ErrorIs(t, err, ErrDecryptionFailed)
+
+	tampered := bytes.Clone(encrypted)
+	tampered[len(tampered)-1] ^= 0xFF
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "empty", value: nil},
+		{name: "truncated", value: encrypted[:10]},
+		{name: "tampered", value: tampered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := rotated.Decrypt(tt.value)
+			require.ErrorIs(t, err, ErrDecryptionFailed)
+		})
+	}
+
+	_, err = NewAESGCMKeyring(3, map[byte][]byte{1: oldKey})
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = NewAESGCMKeyring(1, map[byte][]byte{1: []byte("short")})
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func Test_client_WithValueTransformer(t *testing.T) {
+	srv := newTestServer(t)
+	ring, err := NewAESGCMKeyring(1, map[byte][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+
+	c, err := New(srv.Addr(),
+		WithValueTransformer(ring.Encrypt, ring.Decrypt),
+		WithCodec(mustCompressCodec(t, memcodec.CompressionAlgorithmDeflate, 1, 6)),
+		WithChecksum(ChecksumCRC32),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+	raw, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer raw.Close()
+
+	ctx := context.Background()
+	value := []byte("secret secret secret secret secret")
+	require.NoError(t, c.Set(ctx, "foo", value, 1, 0))
+	_, err = c.MetaSet(ctx, []byte("bar"), value)
+	require.NoError(t, err)
+
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, value, item.Value)
+	assert.Equal(t, uint32(1), item.Flags)
+
+	mi, err := c.MetaGet(ctx, []byte("bar"), MetaGetFlagReturnValue())
+	require.NoError(t, err)
+	assert.Equal(t, value, mi.Value)
+
+	// the values are encrypted at rest.
+	stored, err := raw.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored.Value), "secret")
+
+	// the values written without the transformer could not be read.
+	require.NoError(t, raw.Set(ctx, "plain", value, 0, 0))
+	_, err = c.Get(ctx, "plain")
+	require.Error(t, err)
+
+	require.ErrorIs(t, c.Append(ctx, "foo", []byte("bar"), 0, 0), ErrNotSupported)
+}
@@ -0,0 +1,278 @@
+package memcached
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultUpdateMaxRetries is the default number of retries of Update when the
+// item is modified concurrently.
+const defaultUpdateMaxRetries = 10
+
+// UpdateFunc returns the new value of the item from the current one, old is
+// nil if the item does not exist and UpdateAutoCreate is set. The old value MUST
+// NOT be modified, since it's possibly called multiple times.
+type UpdateFunc func(old []byte) (new []byte, err error)
+
+// UpdateOption is used to set options for Update and MetaUpdate.
+type UpdateOption func(*updateOptions)
+
+type updateOptions struct {
+	maxRetries int
+	autoCreate bool
+	flags      uint32
+	expiry     Expiration
+	// baseBackoff and maxBackoff bound the backoff before each retry, zero means
+	// retrying immediately.
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+// UpdateMaxRetries sets the max number of retries when the item is modified
+// concurrently, default is 10.
+func UpdateMaxRetries(n int) UpdateOption {
+	return func(o *updateOptions) {
+		if n < 0 {
+			n = 0
+		}
+		o.maxRetries = n
+	}
+}
+
+// UpdateAutoCreate makes Update create the item with the given flags if it does
+// not exist, fn is called with a nil value in that case.
+func UpdateAutoCreate(flags uint32) UpdateOption {
+	return func(o *updateOptions) {
+		o.autoCreate = true
+		o.flags = flags
+	}
+}
+
+// UpdateExpiration sets the expiration of the updated item.
+func UpdateExpiration(expiry Expiration) UpdateOption {
+	return func(o *updateOptions) {
+		o.expiry = expiry
+	}
+}
+
+// UpdateBackoff makes Update and MetaUpdate wait before each retry, the wait is
+// drawn uniformly from zero to base doubled by each conflict, capped at
+// maxBackoff, so that the conflicting callers spread out rather than retry in
+// lockstep. By default they retry immediately.
+func UpdateBackoff(base, maxBackoff time.Duration) UpdateOption {
+	return func(o *updateOptions) {
+		if base <= 0 {
+			base, maxBackoff = 0, 0
+		}
+		o.baseBackoff = base
+		o.maxBackoff = max(maxBackoff, base)
+	}
+}
+
+func newUpdateOptions(opts []UpdateOption) (*updateOptions, error) {
+	o := &updateOptions{maxRetries: defaultUpdateMaxRetries, expiry: NoExpiration}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := o.expiry.validate(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// backoff returns the jittered wait before the retry following the given attempt.
+func (o *updateOptions) backoff(attempt int) time.Duration {
+	if o.baseBackoff == 0 {
+		return 0
+	}
+
+	ceiling := o.baseBackoff
+	for i := 0; i < attempt && ceiling < o.maxBackoff; i++ {
+		ceiling *= 2
+	}
+
+	return rand.N(min(ceiling, o.maxBackoff) + 1)
+}
+
+// retry runs try until it's done, backing off between the attempts, and returns
+// ErrExists once the retries are exhausted.
+func (o *updateOptions) retry(ctx context.Context, try func() (bool, error)) error {
+	for attempt := 0; attempt <= o.maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, o.backoff(attempt-1)); err != nil {
+				return err
+			}
+		}
+
+		done, err := try()
+		if done {
+			return err
+		}
+	}
+
+	return errors.Wrapf(ErrExists, "update conflicted %d times", o.maxRetries+1)
+}
+
+// sleepContext waits for d, it returns the error of ctx if it's done earlier.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *client) Update(ctx context.Context, key string, fn UpdateFunc, opts ...UpdateOption) error {
+	if err := validateKeyAndValue([]byte(key), nil); err != nil {
+		return err
+	}
+	// the result of cas is unknown in noreply mode.
+	if c.options.noReply {
+		return errors.Wrap(ErrNotSupported, "update in noreply mode")
+	}
+
+	o, err := newUpdateOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	return o.retry(ctx, func() (bool, error) {
+		return c.tryUpdate(ctx, key, fn, o)
+	})
+}
+
+// tryUpdate runs one round of the read-modify-write loop, it returns false if
+// the item is modified concurrently and the caller should retry.
+func (c *client) tryUpdate(ctx context.Context, key string, fn UpdateFunc, o *updateOptions) (bool, error) {
+	items, err := c.Gets(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return true, err
+	}
+
+	if err != nil {
+		if !o.autoCreate {
+			return true, err
+		}
+
+		value, err := fn(nil)
+		if err != nil {
+			return true, err
+		}
+		// the item is created concurrently, retry with it.
+		err = c.AddWithExpiration(ctx, key, value, o.flags, o.expiry)
+		if errors.Is(err, ErrNotStored) {
+			return false, nil
+		}
+
+		return true, err
+	}
+
+	item := items[0]
+	// the cas unique is read as 0 leniently, the item could not be compared.
+	if item.CAS == 0 {
+		return true, errors.Wrap(ErrNotSupported, "update of the item with cas unique 0")
+	}
+	value, err := fn(item.Value)
+	if err != nil {
+		return true, err
+	}
+
+	err = c.CasWithExpiration(ctx, key, value, item.Flags, o.expiry, item.CAS)
+	// the item is modified or deleted concurrently, retry with the latest state.
+	if errors.Is(err, ErrExists) || errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	return true, err
+}
+
+func (c *client) MetaUpdate(ctx context.Context, key []byte, fn UpdateFunc, opts ...UpdateOption) (uint64, error) {
+	if err := c.checkMetaSupported(); err != nil {
+		return 0, err
+	}
+	if err := validateKeyAndValue(key, nil); err != nil {
+		return 0, err
+	}
+
+	o, err := newUpdateOptions(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var cas uint64
+	err = o.retry(ctx, func() (bool, error) {
+		var (
+			done bool
+			err  error
+		)
+		cas, done, err = c.tryMetaUpdate(ctx, key, fn, o)
+		return done, err
+	})
+
+	return cas, err
+}
+
+// tryMetaUpdate runs one round of the read-modify-write loop by the meta commands,
+// it returns false if the item is modified concurrently and the caller should retry.
+func (c *client) tryMetaUpdate(ctx context.Context, key []byte, fn UpdateFunc, o *updateOptions) (uint64, bool, error) {
+	item, err := c.MetaGet(ctx, key,
+		MetaGetFlagReturnValue(), MetaGetFlagReturnCAS(), MetaGetFlagReturnClientFlags())
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, true, err
+	}
+
+	msOptions := []MetaSetOption{MetaSetFlagReturnCAS(), MetaSetFlagTTL(metaTTL(o.expiry))}
+	if err != nil {
+		if !o.autoCreate {
+			return 0, true, err
+		}
+
+		value, err := fn(nil)
+		if err != nil {
+			return 0, true, err
+		}
+		// the item is created concurrently, retry with it.
+		stored, err := c.MetaSet(ctx, key, value, append(msOptions,
+			MetaSetFlagModeSwitch(MetaSetModeAdd), MetaSetFlagClientFlags(o.flags))...)
+		if errors.Is(err, ErrNotStored) {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, true, err
+		}
+
+		return stored.CAS, true, nil
+	}
+
+	// the cas unique is read as 0 leniently, ms with C0 would overwrite it unconditionally.
+	if item.CAS == 0 {
+		return 0, true, errors.Wrap(ErrNotSupported, "update of the item with cas unique 0")
+	}
+	value, err := fn(item.Value)
+	if err != nil {
+		return 0, true, err
+	}
+
+	stored, err := c.MetaSet(ctx, key, value, append(msOptions,
+		MetaSetFlagCompareCAS(item.CAS), MetaSetFlagClientFlags(item.Flags))...)
+	// the item is modified or deleted concurrently, retry with the latest state.
+	if errors.Is(err, ErrExists) || errors.Is(err, ErrNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, true, err
+	}
+
+	return stored.CAS, true, nil
+}
@@ -0,0 +1,216 @@
+package memcached
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func incrementBy(delta int) UpdateFunc {
+	return func(old []byte) ([]byte, error) {
+		n := 0
+		if old != nil {
+			var err error
+			if n, err = strconv.Atoi(string(old)); err != nil {
+				return nil, err
+			}
+		}
+
+		return []byte(strconv.Itoa(n + delta)), nil
+	}
+}
+
+func Test_client_Update(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		err := c.Update(ctx, "missing", incrementBy(1))
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("auto create", func(t *testing.T) {
+		require.NoError(t, c.Update(ctx, "created", incrementBy(1), UpdateAutoCreate(3)))
+
+		item, err := c.Get(ctx, "created")
+		require.NoError(t, err)
+		assert.Equal(t, "1", string(item.Value))
+		assert.Equal(t, uint32(3), item.Flags)
+	})
+
+	t.Run("keep flags", func(t *testing.T) {
+		require.NoError(t, c.Set(ctx, "flagged", []byte("10"), 7, 0))
+		require.NoError(t, c.Update(ctx, "flagged", incrementBy(5)))
+
+		item, err := c.Get(ctx, "flagged")
+		require.NoError(t, err)
+		assert.Equal(t, "15", string(item.Value))
+		assert.Equal(t, uint32(7), item.Flags)
+	})
+
+	t.Run("fn error", func(t *testing.T) {
+		require.NoError(t, c.Set(ctx, "aborted", []byte("old"), 0, 0))
+		errAbort := errors.New("abort")
+		err := c.Update(ctx, "aborted", func([]byte) ([]byte, error) { return nil, errAbort })
+		require.Equal(t, errAbort, err)
+
+		item, err := c.Get(ctx, "aborted")
+		require.NoError(t, err)
+		assert.Equal(t, "old", string(item.Value))
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		require.NoError(t, c.Set(ctx, "conflicted", []byte("0"), 0, 0))
+
+		calls := 0
+		err := c.Update(ctx, "conflicted", func(old []byte) ([]byte, error) {
+			calls++
+			// modify the item behind the update every time.
+			if err := c.Set(ctx, "conflicted", []byte("0"), 0, 0); err != nil {
+				return nil, err
+			}
+			return []byte("1"), nil
+		}, UpdateMaxRetries(2))
+		require.ErrorIs(t, err, ErrExists)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		const workers, times = 8, 20
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < times; j++ {
+					err := c.Update(ctx, "concurrent", incrementBy(1), UpdateAutoCreate(0), UpdateMaxRetries(1000))
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		item, err := c.Get(ctx, "concurrent")
+		require.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(workers*times), string(item.Value))
+	})
+}
+
+func Test_client_Update_noReply(t *testing.T) {
+	c, err := New("localhost:11211", WithNoReply())
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Update(context.Background(), "foo", incrementBy(1))
+	require.ErrorIs(t, err, ErrNotSupported)
+}
+
+func Test_client_MetaUpdate(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := c.MetaUpdate(ctx, []byte("missing"), incrementBy(1))
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("auto create", func(t *testing.T) {
+		cas, err := c.MetaUpdate(ctx, []byte("created"), incrementBy(1), UpdateAutoCreate(3))
+		require.NoError(t, err)
+
+		item, err := c.MetaGet(ctx, []byte("created"),
+			MetaGetFlagReturnValue(), MetaGetFlagReturnCAS(), MetaGetFlagReturnClientFlags())
+		require.NoError(t, err)
+		assert.Equal(t, "1", string(item.Value))
+		assert.Equal(t, uint32(3), item.Flags)
+		assert.Equal(t, item.CAS, cas)
+	})
+
+	t.Run("returns final cas", func(t *testing.T) {
+		require.NoError(t, c.Set(ctx, "chained", []byte("10"), 7, 0))
+		cas, err := c.MetaUpdate(ctx, []byte("chained"), incrementBy(5))
+		require.NoError(t, err)
+
+		// the returned cas is valid for the next compare-and-set.
+		_, err = c.MetaSet(ctx, []byte("chained"), []byte("20"), MetaSetFlagCompareCAS(cas))
+		require.NoError(t, err)
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		require.NoError(t, c.Set(ctx, "conflicted", []byte("0"), 0, 0))
+
+		calls := 0
+		_, err := c.MetaUpdate(ctx, []byte("conflicted"), func(old []byte) ([]byte, error) {
+			calls++
+			// modify the item behind the update every time.
+			if err := c.Set(ctx, "conflicted", []byte("0"), 0, 0); err != nil {
+				return nil, err
+			}
+			return []byte("1"), nil
+		}, UpdateMaxRetries(2), UpdateBackoff(time.Millisecond, 2*time.Millisecond))
+		require.ErrorIs(t, err, ErrExists)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		const workers, times = 8, 20
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < times; j++ {
+					_, err := c.MetaUpdate(ctx, []byte("concurrent"), incrementBy(1),
+						UpdateAutoCreate(0), UpdateMaxRetries(1000), UpdateBackoff(time.Microsecond, time.Millisecond))
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		item, err := c.Get(ctx, "concurrent")
+		require.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(workers*times), string(item.Value))
+	})
+}
+
+func Test_updateOptions_backoff(t *testing.T) {
+	o, err := newUpdateOptions([]UpdateOption{UpdateBackoff(10*time.Millisecond, 50*time.Millisecond)})
+	require.NoError(t, err)
+
+	for attempt, ceiling := range []time.Duration{10, 20, 40, 50, 50} {
+		for i := 0; i < 100; i++ {
+			d := o.backoff(attempt)
+			assert.GreaterOrEqual(t, d, time.Duration(0))
+			assert.LessOrEqual(t, d, ceiling*time.Millisecond)
+		}
+	}
+
+	o, err = newUpdateOptions(nil)
+	require.NoError(t, err)
+	assert.Zero(t, o.backoff(3))
+
+	// the backoff is interrupted by the context.
+	o, err = newUpdateOptions([]UpdateOption{UpdateBackoff(time.Hour, time.Hour)})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = o.retry(ctx, func() (bool, error) { return false, nil })
+	require.ErrorIs(t, err, context.Canceled)
+}
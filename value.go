@@ -0,0 +1,212 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxRetainedValueBufferSize is the maximum capacity of the value buffer which
+// is kept in the pool, it's the default max item size of memcached.
+const maxRetainedValueBufferSize = 1 << 20
+
+// valueBuffer holds the bytes received for a Value, it's pooled to be reused by
+// the following borrowing retrievals.
+type valueBuffer struct {
+	b []byte
+}
+
+var valueBufferPool = sync.Pool{
+	New: func() any {
+		return &valueBuffer{}
+	},
+}
+
+func releaseValueBuffer(vb *valueBuffer) {
+	if poisonReleased.Load() {
+		poison := vb.b[:cap(vb.b)]
+		for i := range poison {
+			poison[i] = poisonByte
+		}
+	}
+	vb.b = vb.b[:0]
+	// do not keep the large buffer in the pool.
+	if cap(vb.b) > maxRetainedValueBufferSize {
+		vb.b = nil
+	}
+	valueBufferPool.Put(vb)
+}
+
+// Value is an item whose value is borrowed from a buffer managed by the client
+// rather than copied into a fresh slice, it's returned by GetValue and
+// GetAndTouchValue to avoid allocating for each retrieval of large values.
+//
+// The bytes returned by Bytes are only valid until the Value is released, they
+// are overwritten by the following retrievals after then. So that:
+//
+//   - Release MUST be called exactly once when the bytes are no longer used,
+//     otherwise the buffer is not reused, which is safe but wastes the pooling.
+//   - The bytes MUST NOT be retained or used after Release, copy them if needed.
+//   - The Value shared by goroutines must be retained by Retain for each of them,
+//     and released by each of them.
+//
+// The copying retrievals, e.g. Get, are preferred unless the allocation matters.
+type Value struct {
+	Key string
+	// Flags is the caller-facing flags value after codec decode.
+	Flags uint32
+
+	data []byte
+	buf  *valueBuffer
+	// refs is the number of holders of the Value, the buffer is put back to the
+	// pool once it drops to zero.
+	refs atomic.Int32
+}
+
+// Bytes returns the value which is only valid until the Value is released.
+func (v *Value) Bytes() []byte {
+	if v.refs.Load() <= 0 {
+		ownershipViolated("value used after released")
+	}
+
+	return v.data
+}
+
+// Len returns the length of the value.
+func (v *Value) Len() int {
+	return len(v.data)
+}
+
+// Retain adds a holder of the Value, which must call Release as well.
+func (v *Value) Retain() {
+	if v.refs.Add(1) <= 1 {
+		ownershipViolated("value retained after released")
+	}
+}
+
+// Release releases the Value by one of its holders, the buffer is reused once
+// all holders have released it.
+func (v *Value) Release() {
+	refs := v.refs.Add(-1)
+	switch {
+	case refs < 0:
+		ownershipViolated("value released twice")
+	case refs == 0:
+		v.data = nil
+		if v.buf != nil {
+			releaseValueBuffer(v.buf)
+			v.buf = nil
+		}
+	}
+}
+
+// GetValue is the same as Get, but the value is borrowed rather than copied, see
+// Value. The Value must be released by the caller.
+func (c *client) GetValue(ctx context.Context, key string) (*Value, error) {
+	if err := validateKeyAndValue([]byte(key), nil); err != nil {
+		return nil, err
+	}
+
+	req, resp := buildGetsCommand("get", key)
+	defer releaseReqAndResp(req, resp)
+
+	return c.borrowValue(ctx, key, req, resp, func() error {
+		return c.dispatchHedgedRequest(ctx, req, resp)
+	})
+}
+
+// GetAndTouchValue is the same as GetAndTouch, but the value is borrowed rather
+// than copied, see Value. The Value must be released by the caller.
+func (c *client) GetAndTouchValue(ctx context.Context, expiry time.Duration, key string) (*Value, error) {
+	if err := validateKeyAndValue([]byte(key), nil); err != nil {
+		return nil, err
+	}
+	exp := FromDuration(expiry)
+	if err := exp.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.checkGetAndTouchSupported(); err != nil {
+		return nil, err
+	}
+
+	req, resp := buildGetAndTouchesCommand("gat", exp, key)
+	defer releaseReqAndResp(req, resp)
+
+	return c.borrowValue(ctx, key, req, resp, func() error {
+		return c.dispatchRequest(ctx, req, resp)
+	})
+}
+
+// borrowValue dispatches the retrieval of one key with the buffer of resp replaced
+// by a pooled value buffer, so that the data block is read into the value buffer
+// directly, and the Value refers to it rather than a copy.
+func (c *client) borrowValue(
+	ctx context.Context, key string, req *request, resp *response, dispatch func() error,
+) (*Value, error) {
+	vb := valueBufferPool.Get().(*valueBuffer)
+	resp.buf, vb.b = vb.b[:0], resp.buf
+	err := dispatch()
+	// the response takes its own buffer back, the received lines refer to the
+	// buffer held by vb now, whichever the dispatching has swapped.
+	resp.buf, vb.b = vb.b[:0], resp.buf
+	if err != nil {
+		releaseValueBuffer(vb)
+		return nil, errors.Wrap(err, "request failed")
+	}
+
+	v, err := parseValue(resp.rawLines, c.options.codec)
+	if err != nil {
+		// the lines refer to vb, they're captured before it's released.
+		_ = c.captureMalformed(req, resp, err)
+		releaseValueBuffer(vb)
+		return nil, errors.Wrap(err, "parse values failed")
+	}
+	c.countKeyHit(resp.addr, v != nil)
+	if v == nil {
+		releaseValueBuffer(vb)
+		return nil, errors.Wrap(ErrNotFound, "no items found")
+	}
+
+	v.buf = vb
+	v.refs.Store(1)
+	return v, nil
+}
+
+// parseValue parses the response of one key like parseValueItems, but the value
+// refers to the lines rather than a copy. It returns nil if the key is missing.
+func parseValue(lines [][]byte, codec Codec) (*Value, error) {
+	switch len(lines) {
+	case 1:
+		return nil, nil
+	case 3:
+	default:
+		return nil, errors.Wrap(ErrMalformedResponse, "want 1 or 3 lines, got "+strconv.Itoa(len(lines)))
+	}
+
+	line := trimCRLF(lines[0])
+	if !bytes.HasPrefix(line, _ValueBytes) {
+		return nil, errors.Wrap(ErrMalformedResponse, "missing VALUE line")
+	}
+
+	item := &Item{}
+	dataLen, err := parseValueLine(line, item, false)
+	if err != nil {
+		return nil, err
+	}
+	data := trimCRLF(lines[1])
+	if len(data) != int(dataLen) {
+		return nil, errors.Wrap(ErrMalformedResponse, "data block length mismatch")
+	}
+
+	data, flags, err := codec.Decode([]byte(item.Key), data, item.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Value{Key: item.Key, Flags: flags, data: data}, nil
+}
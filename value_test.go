@@ -0,0 +1,174 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_GetValue(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 7, 0))
+
+	v, err := c.GetValue(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", v.Key)
+	assert.Equal(t, uint32(7), v.Flags)
+	assert.Equal(t, "bar", string(v.Bytes()))
+	assert.Equal(t, 3, v.Len())
+	v.Release()
+
+	v, err = c.GetAndTouchValue(ctx, time.Minute, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(v.Bytes()))
+	v.Release()
+
+	_, err = c.GetValue(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = c.GetAndTouchValue(ctx, time.Minute, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	hits := c.Metrics().Nodes[srv.Addr()]
+	require.NotNil(t, hits)
+	assert.Equal(t, uint64(2), hits.Hits)
+	assert.Equal(t, uint64(2), hits.Misses)
+}
+
+// Test_client_GetValue_borrowed checks the values are intact until released, the
+// released buffers are poisoned and reused by the concurrent retrievals.
+func Test_client_GetValue_borrowed(t *testing.T) {
+	poisonReleased.Store(true)
+	defer poisonReleased.Store(false)
+
+	tests := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "pooled"},
+		{name: "multiplexing", opts: []ClientOption{WithMultiplexing(1)}},
+		{name: "hedged", opts: []ClientOption{WithHedgedReads(time.Millisecond)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			c, err := New(srv.Addr(), append([]ClientOption{WithMaxConns(4)}, tt.opts...)...)
+			require.NoError(t, err)
+			defer c.Close()
+
+			ctx := context.Background()
+			const n = 16
+			values := make([][]byte, n)
+			for i := range values {
+				// the values larger than the retained response buffer are included.
+				values[i] = bytes.Repeat([]byte(strconv.Itoa(i%10)), 1+i*8<<10)
+				require.NoError(t, c.Set(ctx, "key:"+strconv.Itoa(i), values[i], 0, 0))
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < n*4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					v, err := c.GetValue(ctx, "key:"+strconv.Itoa(i%n))
+					if !assert.NoError(t, err) {
+						return
+					}
+
+					// the value shared by another goroutine is retained for it.
+					v.Retain()
+					shared := make(chan struct{})
+					go func() {
+						defer close(shared)
+						defer v.Release()
+						assert.True(t, bytes.Equal(values[i%n], v.Bytes()))
+					}()
+
+					for j := 0; j < 4; j++ {
+						other, err := c.GetValue(ctx, "key:"+strconv.Itoa((i+j)%n))
+						if assert.NoError(t, err) {
+							assert.True(t, bytes.Equal(values[(i+j)%n], other.Bytes()))
+							other.Release()
+						}
+					}
+					<-shared
+					assert.True(t, bytes.Equal(values[i%n], v.Bytes()))
+					v.Release()
+				}(i)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func Test_Value_ownership(t *testing.T) {
+	vb := valueBufferPool.Get().(*valueBuffer)
+	vb.b = append(vb.b[:0], "bar"...)
+	v := &Value{Key: "foo", data: vb.b, buf: vb}
+	v.refs.Store(1)
+
+	v.Retain()
+	v.Release()
+	assert.Equal(t, "bar", string(v.Bytes()))
+	v.Release()
+
+	// the violations are ignored without the assertion.
+	assert.NotPanics(t, func() { v.Release() })
+
+	assertOwnership.Store(true)
+	defer assertOwnership.Store(false)
+	assert.Panics(t, func() { v.Bytes() })
+	assert.Panics(t, func() { v.Release() })
+	assert.Panics(t, func() { v.Retain() })
+}
+
+// Benchmark_client_GetValue compares the borrowing retrieval with the copying one.
+func Benchmark_client_GetValue(b *testing.B) {
+	srv := newTestServer(b)
+	c, err := New(srv.Addr())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	for _, size := range []int{16, 16 << 10, 256 << 10} {
+		key := "key:" + strconv.Itoa(size)
+		if err = c.Set(ctx, key, bytes.Repeat([]byte("v"), size), 0, 0); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run("size="+strconv.Itoa(size)+"/Get", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Get(ctx, key); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("size="+strconv.Itoa(size)+"/GetValue", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				v, err := c.GetValue(ctx, key)
+				if err != nil {
+					b.Fatal(err)
+				}
+				v.Release()
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package memcached
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// overridableByView reports whether the option only changes the settings of the
+// requests, which could be overridden by With.
+func overridableByView(opt ClientOption) bool {
+	o := &clientOptions{}
+	opt(o)
+	o.readTimeout, o.writeTimeout = 0, 0
+	o.noReply = false
+	o.hedgeDelay, o.deadlineBudget = 0, nil
+	o.staleConnReplay = false
+
+	return reflect.ValueOf(o).Elem().IsZero()
+}
+
+// With returns a view of the client with the settings of the requests overridden,
+// it shares the connection pools, the picker and all other state with the client,
+// so that the callers of different latency classes against the same cluster do
+// not maintain multiple clients. Only the following options are supported,
+// ErrInvalidArgument is returned if any other one is given:
+//
+//   - WithReadTimeout and WithWriteTimeout override the timeouts of the requests
+//     over the pooled connections, for all servers regardless of WithAddrOptions
+//     and WithAdaptiveReadTimeout. The multiplexed connections keep their timeouts.
+//   - WithNoReply makes the storage commands of the view not wait for the replies.
+//   - WithHedgedReads, WithDeadlineBudget and WithStaleConnReplay override the
+//     retry policy of the requests.
+//
+// Close of the view is a no-op, the pools are closed by the client it's derived
+// from, after then the view must not be used. UpdateOptions of the view updates
+// the shared pools, the same as the client's.
+func (c *client) With(opts ...ClientOption) (Client, error) {
+	for idx, opt := range opts {
+		if opt == nil || !overridableByView(opt) {
+			return nil, errors.Wrapf(ErrInvalidArgument, "option %d could not be overridden by a view", idx)
+		}
+	}
+
+	options := *c.options
+	overrides := &clientOptions{}
+	for _, opt := range opts {
+		opt(&options)
+		opt(overrides)
+	}
+	if options.multiplexConns > 0 && options.noReply {
+		return nil, errors.Wrap(ErrInvalidArgument, "multiplexing mode does not support noreply")
+	}
+
+	view := *c
+	view.options = &options
+	view.derived = true
+	if overrides.readTimeout > 0 {
+		view.readTimeoutOverride = overrides.readTimeout
+	}
+	if overrides.writeTimeout > 0 {
+		view.writeTimeoutOverride = overrides.writeTimeout
+	}
+
+	return &view, nil
+}
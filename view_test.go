@@ -0,0 +1,81 @@
+package memcached
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_client_With(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithReadTimeout(time.Second), WithMaxConns(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	view, err := c.With(WithReadTimeout(50*time.Millisecond), WithWriteTimeout(20*time.Millisecond), WithNoReply())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, view.Set(ctx, "foo", []byte("bar"), 0, 0))
+	item, err := c.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(item.Value))
+
+	// the view shares the connection pool.
+	assert.Equal(t, 1, c.PoolStats()[srv.Addr()].TotalConns)
+	assert.Equal(t, 1, view.PoolStats()[srv.Addr()].TotalConns)
+
+	// the settings of the requests are overridden by the view only.
+	addr := c.(*client).topology().addrs[0]
+	vc := view.(*client)
+	assert.Equal(t, 50*time.Millisecond, vc.readTimeout(addr))
+	assert.Equal(t, 20*time.Millisecond, vc.writeTimeout(addr))
+	assert.True(t, vc.options.noReply)
+	assert.Equal(t, time.Second, c.(*client).readTimeout(addr))
+	assert.False(t, c.(*client).options.noReply)
+
+	// closing the view does not close the pools.
+	require.NoError(t, view.Close())
+	_, err = view.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.PoolStats()[srv.Addr()].TotalConns)
+}
+
+func Test_client_With_invalid(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.Addr(), WithMultiplexing(1))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.With(WithMaxConns(1))
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = c.With(nil)
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = c.With(WithNoReply())
+	require.ErrorIs(t, err, ErrInvalidArgument)
+
+	view, err := c.With(WithHedgedReads(time.Millisecond), WithStaleConnReplay(false))
+	require.NoError(t, err)
+	assert.Equal(t, time.Millisecond, view.(*client).options.hedgeDelay)
+	assert.False(t, view.(*client).options.staleConnReplay)
+	assert.Zero(t, c.(*client).options.hedgeDelay)
+}
+
+func Test_client_With_adaptiveTimeout(t *testing.T) {
+	addr := NewAddr("tcp", "localhost:11211", 0)
+	c := &client{
+		options:     newClientOptions(),
+		adaptive:    newAdaptiveTimeout([]*Addr{addr}, 2, time.Millisecond, time.Millisecond),
+		clientState: newClientState(),
+	}
+	c.runtime.Store(newRuntimeOptions(c.options))
+
+	view, err := c.With(WithReadTimeout(time.Minute))
+	require.NoError(t, err)
+
+	// the overridden read timeout takes precedence over the adaptive one.
+	assert.Equal(t, time.Minute, view.(*client).readTimeout(addr))
+}
@@ -0,0 +1,297 @@
+package memcached
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultWatchInterval is the default interval of KeyWatcher to poll the keys.
+	defaultWatchInterval = time.Second
+	// defaultWatchBatchSize is the default max number of keys pipelined to one
+	// memcached server in one round trip.
+	defaultWatchBatchSize = 128
+)
+
+// KeyEventType is the type of the change of a watched key.
+type KeyEventType uint8
+
+const (
+	// KeyChanged means the item is modified, its CAS unique is changed.
+	KeyChanged KeyEventType = iota + 1
+	// KeyDeleted means the item vanished, e.g. deleted, expired or evicted.
+	KeyDeleted
+	// KeyCreated means the item appeared after it's missing.
+	KeyCreated
+)
+
+func (t KeyEventType) String() string {
+	switch t {
+	case KeyChanged:
+		return "changed"
+	case KeyDeleted:
+		return "deleted"
+	case KeyCreated:
+		return "created"
+	default:
+		return "unknown"
+	}
+}
+
+// KeyEvent is the change of a watched key found by KeyWatcher.
+type KeyEvent struct {
+	Key  string
+	Type KeyEventType
+	// CAS is the CAS unique of the item after the change, 0 if it's deleted.
+	CAS uint64
+}
+
+// KeyWatcherOption configures the KeyWatcher.
+type KeyWatcherOption func(*KeyWatcher)
+
+// KeyWatcherInterval sets the interval of Run to poll the keys, default is 1s.
+func KeyWatcherInterval(d time.Duration) KeyWatcherOption {
+	return func(w *KeyWatcher) {
+		if d > 0 {
+			w.interval = d
+		}
+	}
+}
+
+// KeyWatcherJitter randomizes each interval of Run by up to the given fraction
+// of it in both directions, e.g. 0.1 polls every 0.9s to 1.1s with the default
+// interval, so that many processes watching the same keys are spread out. The
+// fraction is capped at 1, default is 0.
+func KeyWatcherJitter(fraction float64) KeyWatcherOption {
+	return func(w *KeyWatcher) {
+		if fraction > 0 {
+			w.jitter = min(fraction, 1)
+		}
+	}
+}
+
+// KeyWatcherBatchSize sets the max number of keys pipelined to one memcached
+// server in one round trip, default is 128.
+func KeyWatcherBatchSize(n int) KeyWatcherOption {
+	return func(w *KeyWatcher) {
+		if n > 0 {
+			w.batchSize = n
+		}
+	}
+}
+
+// KeyWatcherOnError sets the function called with the error of polling the keys
+// of a memcached server. The keys of the server are kept unchanged until the next
+// successful poll, so that a failing server is never reported as the keys deleted.
+func KeyWatcherOnError(fn func(addr *Addr, err error)) KeyWatcherOption {
+	return func(w *KeyWatcher) {
+		w.onError = fn
+	}
+}
+
+// KeyWatcher polls a set of keys and reports their changes, it's a poor man's
+// invalidation bus for the processes which could not receive the invalidation
+// pushed by others:
+//
+//	watcher := client.WatchKeys([]string{"config:a", "config:b"}, KeyWatcherJitter(0.2))
+//	err := watcher.Run(ctx, func(events []KeyEvent) {
+//		for _, event := range events {
+//			invalidate(event.Key)
+//		}
+//	})
+//
+// The keys are polled by meta get commands which return the CAS unique only,
+// without the value and without bumping the items in the LRU, and the keys of
+// each memcached server are pipelined in batches. So that the polling is cheap,
+// but the changes between two polls are merged into one, e.g. an item deleted
+// and set again is reported as changed.
+//
+// The watcher is built on meta commands, so that the memcached server must be
+// 1.6.0 or later.
+type KeyWatcher struct {
+	client    *client
+	keys      []string
+	interval  time.Duration
+	jitter    float64
+	batchSize int
+	onError   func(addr *Addr, err error)
+
+	mu sync.Mutex
+	// cas holds the CAS unique of each key found by the last poll, the missing
+	// keys are absent. It's nil before the first poll.
+	cas map[string]uint64
+}
+
+// WatchKeys returns the KeyWatcher of the given keys, see KeyWatcher.
+func (c *client) WatchKeys(keys []string, opts ...KeyWatcherOption) *KeyWatcher {
+	w := &KeyWatcher{
+		client:    c,
+		keys:      keys,
+		interval:  defaultWatchInterval,
+		batchSize: defaultWatchBatchSize,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Run polls the keys every interval and calls fn with the changes of each poll,
+// fn is not called if nothing changed. The first poll only records the current
+// state of the keys. It blocks until ctx is done, and returns ctx.Err().
+func (w *KeyWatcher) Run(ctx context.Context, fn func(events []KeyEvent)) error {
+	for {
+		events, _ := w.Poll(ctx)
+		if len(events) > 0 {
+			fn(events)
+		}
+
+		timer := time.NewTimer(w.nextInterval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Poll polls the keys once and returns their changes since the last poll, the
+// first poll returns no changes. The error of the first failed memcached server is
+// returned with the changes of the others.
+func (w *KeyWatcher) Poll(ctx context.Context) ([]KeyEvent, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.client.checkMetaSupported(); err != nil {
+		return nil, err
+	}
+	for _, key := range w.keys {
+		if err := validateKeyAndValue([]byte(key), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := w.client.groupKeysByNode(ctx, "mg", w.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu       sync.Mutex
+		current  = make(map[string]uint64, len(w.keys))
+		firstErr error
+	)
+	wg := sync.WaitGroup{}
+	for _, g := range groups {
+		wg.Add(1)
+		go func(g *keyGroup) {
+			defer wg.Done()
+
+			cas, err := w.pollNode(ctx, g)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if w.onError != nil {
+					w.onError(g.addr, err)
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				// keep the last state of the keys, they're not known.
+				for _, key := range g.keys {
+					if last, ok := w.cas[key]; ok {
+						current[key] = last
+					}
+				}
+				return
+			}
+			for key, unique := range cas {
+				current[key] = unique
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	last := w.cas
+	w.cas = current
+	if last == nil {
+		return nil, firstErr
+	}
+
+	return diffKeyEvents(w.keys, last, current), firstErr
+}
+
+// pollNode returns the CAS unique of the keys found in the memcached server of the
+// group, the keys are pipelined in batches.
+func (w *KeyWatcher) pollNode(ctx context.Context, g *keyGroup) (map[string]uint64, error) {
+	cas := make(map[string]uint64, len(g.keys))
+
+	for start := 0; start < len(g.keys); start += w.batchSize {
+		batch := g.keys[start:min(start+w.batchSize, len(g.keys))]
+
+		reqs := make([]*request, 0, len(batch))
+		for i, key := range batch {
+			req, resp := buildMetaGetCommand([]byte(key), &metaGetFlags{c: true, u: true, q: true, O: uint64(i + 1)})
+			reqs = append(reqs, req)
+			defer releaseReqAndResp(req, resp)
+		}
+
+		replies, err := w.client.dispatchQuietPipeline(ctx, g.addr, reqs)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, key := range batch {
+			reply, ok := replies[uint64(i+1)]
+			if !ok {
+				// the miss is suppressed by the quiet mode.
+				continue
+			}
+
+			item := &MetaItem{}
+			if err := w.client.tolerateCAS(parseMetaItem(reply, item, true, nil)); err != nil {
+				return nil, errors.Wrapf(err, "parse reply of %s", key)
+			}
+			cas[key] = item.CAS
+		}
+	}
+
+	return cas, nil
+}
+
+// nextInterval returns the interval before the next poll with the jitter.
+func (w *KeyWatcher) nextInterval() time.Duration {
+	if w.jitter == 0 {
+		return w.interval
+	}
+
+	delta := (rand.Float64()*2 - 1) * w.jitter * float64(w.interval)
+	return w.interval + time.Duration(delta)
+}
+
+// diffKeyEvents returns the changes of the keys from last to current, ordered as
+// the given keys.
+func diffKeyEvents(keys []string, last, current map[string]uint64) []KeyEvent {
+	var events []KeyEvent
+	for _, key := range keys {
+		before, existed := last[key]
+		after, exists := current[key]
+
+		switch {
+		case existed && !exists:
+			events = append(events, KeyEvent{Key: key, Type: KeyDeleted})
+		case !existed && exists:
+			events = append(events, KeyEvent{Key: key, Type: KeyCreated, CAS: after})
+		case existed && exists && before != after:
+			events = append(events, KeyEvent{Key: key, Type: KeyChanged, CAS: after})
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,116 @@
+package memcached
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_KeyWatcher_Poll(t *testing.T) {
+	srv1, srv2 := newTestServer(t), newTestServer(t)
+	c, err := New(srv1.Addr() + "," + srv2.Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Set(ctx, key, []byte("1"), 0, 0))
+	}
+
+	watcher := c.WatchKeys([]string{"a", "b", "c", "d"}, KeyWatcherBatchSize(1))
+	events, err := watcher.Poll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, events, "the first poll only records the state")
+
+	events, err = watcher.Poll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	require.NoError(t, c.Set(ctx, "a", []byte("2"), 0, 0))
+	require.NoError(t, c.Delete(ctx, "b"))
+	require.NoError(t, c.Set(ctx, "d", []byte("1"), 0, 0))
+
+	events, err = watcher.Poll(ctx)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "a", events[0].Key)
+	assert.Equal(t, KeyChanged, events[0].Type)
+	assert.NotZero(t, events[0].CAS)
+	assert.Equal(t, KeyEvent{Key: "b", Type: KeyDeleted}, events[1])
+	assert.Equal(t, "d", events[2].Key)
+	assert.Equal(t, KeyCreated, events[2].Type)
+
+	_, err = c.WatchKeys([]string{""}).Poll(ctx)
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func Test_KeyWatcher_Run(t *testing.T) {
+	c, err := New(newTestServer(t).Addr())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		got    []KeyEvent
+		polled = make(chan struct{}, 1)
+	)
+	watcher := c.WatchKeys([]string{"foo"}, KeyWatcherInterval(10*time.Millisecond), KeyWatcherJitter(0.5))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watcher.Run(ctx, func(events []KeyEvent) {
+			mu.Lock()
+			got = append(got, events...)
+			mu.Unlock()
+			select {
+			case polled <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	// wait for the first poll recording the missing key.
+	require.Eventually(t, func() bool {
+		watcher.mu.Lock()
+		defer watcher.mu.Unlock()
+		return watcher.cas != nil
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, c.Set(ctx, "foo", []byte("bar"), 0, 0))
+	select {
+	case <-polled:
+	case <-ctx.Done():
+		t.Fatal("no event reported")
+	}
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, got)
+	assert.Equal(t, "foo", got[0].Key)
+	assert.Equal(t, KeyCreated, got[0].Type)
+}
+
+func Test_KeyWatcher_nextInterval(t *testing.T) {
+	w := &KeyWatcher{interval: time.Second}
+	assert.Equal(t, time.Second, w.nextInterval())
+
+	KeyWatcherJitter(0.2)(w)
+	for i := 0; i < 100; i++ {
+		d := w.nextInterval()
+		assert.GreaterOrEqual(t, d, 800*time.Millisecond)
+		assert.LessOrEqual(t, d, 1200*time.Millisecond)
+	}
+
+	KeyWatcherJitter(5)(w)
+	assert.Equal(t, 1.0, w.jitter)
+}
@@ -0,0 +1,115 @@
+package memcached
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultWireLogMaxLineLength is the max bytes of each line written by the WireLogger.
+const defaultWireLogMaxLineLength = 128
+
+// WireLoggerOption configures the WireLogger.
+type WireLoggerOption func(*WireLogger)
+
+// WireLoggerMaxLineLength sets the max bytes of each logged line, the longer one
+// (usually a value) is truncated with its total length. The default is 128, and
+// 0 means never truncate.
+func WireLoggerMaxLineLength(n int) WireLoggerOption {
+	return func(l *WireLogger) {
+		if n >= 0 {
+			l.maxLineLength = n
+		}
+	}
+}
+
+// WireLogger writes the request and response lines of every command on the wire,
+// to diagnose the issues such as malformed responses without capturing packets.
+// The lines are quoted so that the binary data and CRLF are printed safely:
+//
+//	2024-01-02T15:04:05.000000Z 127.0.0.1:11211 > "touch foo 60\r\n"
+//	2024-01-02T15:04:05.000000Z 127.0.0.1:11211 < "TOUCHED\r\n"
+//	2024-01-02T15:04:05.000000Z 127.0.0.1:11211 ! "malformed response"
+//
+// The lines of one command are written together. It's enabled once created, and
+// could be toggled at runtime by Enable and Disable.
+//
+// NOTE: the values are logged too, truncate them by WireLoggerMaxLineLength, and
+// do not log the sensitive data in production.
+type WireLogger struct {
+	enabled       atomic.Bool
+	maxLineLength int
+
+	mu sync.Mutex // guards w
+	w  io.Writer
+}
+
+// NewWireLogger creates an enabled WireLogger writing to w.
+func NewWireLogger(w io.Writer, opts ...WireLoggerOption) *WireLogger {
+	l := &WireLogger{
+		w:             w,
+		maxLineLength: defaultWireLogMaxLineLength,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.enabled.Store(true)
+
+	return l
+}
+
+// Enable starts logging the commands.
+func (l *WireLogger) Enable() { l.enabled.Store(true) }
+
+// Disable stops logging the commands.
+func (l *WireLogger) Disable() { l.enabled.Store(false) }
+
+// Enabled reports whether the commands are logged.
+func (l *WireLogger) Enabled() bool { return l.enabled.Load() }
+
+// log writes the request and the response lines of one command to the memcached
+// server at addr, err is the error of the command if any.
+func (l *WireLogger) log(addr *Addr, req *request, resp *response, err error) {
+	if l == nil || !l.Enabled() {
+		return
+	}
+
+	prefix := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00") + " " + addr.Address + " "
+
+	buf := bytes.Buffer{}
+	for _, line := range bytes.SplitAfter(req.raw, _CRLFBytes) {
+		if len(line) > 0 {
+			l.writeLine(&buf, prefix+"> ", line)
+		}
+	}
+	if resp != nil {
+		for _, line := range resp.rawLines {
+			l.writeLine(&buf, prefix+"< ", line)
+		}
+		if resp.faultLine != nil {
+			l.writeLine(&buf, prefix+"< ", resp.faultLine)
+		}
+	}
+	if err != nil {
+		l.writeLine(&buf, prefix+"! ", []byte(err.Error()))
+	}
+
+	l.mu.Lock()
+	_, _ = l.w.Write(buf.Bytes())
+	l.mu.Unlock()
+}
+
+// writeLine writes the quoted line, which is truncated if it's too long.
+func (l *WireLogger) writeLine(buf *bytes.Buffer, prefix string, line []byte) {
+	buf.WriteString(prefix)
+	if l.maxLineLength > 0 && len(line) > l.maxLineLength {
+		buf.WriteString(strconv.Quote(string(line[:l.maxLineLength])))
+		buf.WriteString("...(" + strconv.Itoa(len(line)) + " bytes)")
+	} else {
+		buf.WriteString(strconv.Quote(string(line)))
+	}
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,68 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WireLogger(t *testing.T) {
+	srv := newTestServer(t)
+	buf := &bytes.Buffer{}
+	logger := NewWireLogger(buf, WireLoggerMaxLineLength(24))
+
+	c, err := New(srv.Addr(), WithWireLogging(logger), WithCapabilityDetection(false))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	linesOf := func() []string {
+		defer buf.Reset()
+
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			// strip the timestamp.
+			_, rest, _ := strings.Cut(line, " ")
+			lines = append(lines, rest)
+		}
+		return lines
+	}
+
+	require.NoError(t, c.Set(ctx, "foo", []byte(strings.Repeat("x", 32)), 0, 0))
+	assert.Equal(t, []string{
+		srv.Addr() + ` > "set foo 0 0 32\r\n"`,
+		srv.Addr() + ` > "xxxxxxxxxxxxxxxxxxxxxxxx"...(34 bytes)`,
+		srv.Addr() + ` < "STORED\r\n"`,
+	}, linesOf())
+
+	err = c.Touch(ctx, "missing", time.Minute)
+	require.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, []string{
+		srv.Addr() + ` > "touch missing 60\r\n"`,
+		srv.Addr() + ` < "NOT_FOUND\r\n"`,
+		srv.Addr() + ` ! "not found"`,
+	}, linesOf())
+
+	require.NoError(t, c.FlushAll(ctx))
+	assert.Equal(t, []string{
+		srv.Addr() + ` > "flush_all\r\n"`,
+		srv.Addr() + ` < "OK\r\n"`,
+	}, linesOf())
+
+	logger.Disable()
+	assert.False(t, logger.Enabled())
+	_, _ = c.Get(ctx, "foo")
+	assert.Empty(t, linesOf())
+
+	logger.Enable()
+	_, _ = c.Get(ctx, "foo")
+	assert.NotEmpty(t, linesOf())
+}